@@ -46,6 +46,30 @@ func (m *Map) Add(keys ...string) {
 	sort.Ints(m.keys)
 }
 
+// Remove removes some keys and their replicas from the hash. Keys that were
+// never added are ignored, and the remaining keys keep their positions, so
+// only the items the removed keys owned move to other keys.
+func (m *Map) Remove(keys ...string) {
+
+	removed := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		removed[key] = true
+	}
+
+	kept := m.keys[:0]
+	for _, hash := range m.keys {
+		if !removed[m.hashMap[hash]] {
+			kept = append(kept, hash)
+		}
+	}
+	m.keys = kept
+	for hash, key := range m.hashMap {
+		if removed[key] {
+			delete(m.hashMap, hash)
+		}
+	}
+}
+
 // Get gets the closest item in the hash to the provided key.
 func (m *Map) Get(key string) string {
 
@@ -61,3 +85,29 @@ func (m *Map) Get(key string) string {
 
 	return m.hashMap[m.keys[idx%len(m.keys)]]
 }
+
+// GetN returns up to n distinct items, walking clockwise from the item
+// that owns key. The first element is the same as Get(key).
+func (m *Map) GetN(key string, n int) []string {
+
+	if len(m.keys) == 0 || n <= 0 {
+		return nil
+	}
+
+	hash := int(m.hash([]byte(key)))
+
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+
+	items := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for i := 0; i < len(m.keys) && len(items) < n; i++ {
+		item := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if !seen[item] {
+			seen[item] = true
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -1,6 +1,7 @@
 package consistenthash
 
 import (
+	"reflect"
 	"strconv"
 	"testing"
 )
@@ -41,3 +42,61 @@ func TestHashing(t *testing.T) {
 	}
 
 }
+
+func TestGetN(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+
+	// 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("6", "4", "2")
+
+	testCases := map[string][]string{
+		"11": {"2", "4"},
+		"23": {"4", "6"},
+		"27": {"2", "4"},
+	}
+
+	for k, v := range testCases {
+		if got := hash.GetN(k, 2); !reflect.DeepEqual(got, v) {
+			t.Errorf("Asking for %s, should have yielded %v, got %v", k, v, got)
+		}
+	}
+
+	if got := hash.GetN("11", 5); !reflect.DeepEqual(got, []string{"2", "4", "6"}) {
+		t.Errorf("Asking for more items than exist should yield all of them, got %v", got)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+
+	// 2, 4, 6, 8, 12, 14, 16, 18, 22, 24, 26, 28
+	hash.Add("6", "4", "2", "8")
+	hash.Remove("8", "9")
+
+	// Back to 2, 4, 6, 12, 14, 16, 22, 24, 26: 27 wraps around to 2 again.
+	testCases := map[string]string{
+		"2":  "2",
+		"11": "2",
+		"23": "4",
+		"27": "2",
+	}
+	for k, v := range testCases {
+		if hash.Get(k) != v {
+			t.Errorf("Asking for %s, should have yielded %s", k, v)
+		}
+	}
+	if len(hash.keys) != 9 || len(hash.hashMap) != 9 {
+		t.Errorf("expect the replicas of 8 removed, got %v", hash.keys)
+	}
+
+	hash.Remove("2", "4", "6")
+	if got := hash.Get("11"); got != "" {
+		t.Errorf("expect an empty hash, got %s", got)
+	}
+}
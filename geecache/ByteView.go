@@ -1,9 +1,20 @@
 package geecache
 
+import (
+	"bytes"
+	"io"
+	"time"
+)
+
 // ByteView 是一个只读的字节视图，用于保证缓存值的不可变性。
 // 它可以持有任意类型的数据（例如字符串或图片），但其内容一旦创建便不能被修改。
 type ByteView struct {
-	b []byte // b 是一个字节切片，用于存储实际数据。它被视为只读。
+	b       []byte    // b 是一个字节切片，用于存储实际数据。它被视为只读。
+	expire  time.Time // 值的过期时间，零值表示永不过期
+	stale   time.Time // 值需要在后台刷新的时间，零值表示不需要刷新，见 WithRefreshAhead
+	err     error     // 负缓存中缓存的 getter 错误，为 nil 表示这是墓碑条目或正常的值，见 WithErrorCacheTTL
+	noStore bool      // 值不应被写入缓存，见 CacheOptions.NoStore 和 WithCacheFilter
+	version uint64    // 拥有者节点为缓存条目分配的版本号，0 表示没有版本，见 SetIfVersion
 }
 
 // Len 实现了 lru.Value 接口，返回 ByteView 所持有的数据的字节长度。
@@ -15,6 +26,34 @@ func (v ByteView) Len() int {
 	return len(v.b)
 }
 
+// Expire 返回值的过期时间。
+//
+// 返回值:
+//
+//	time.Time: 过期时间，零值表示永不过期。
+func (v ByteView) Expire() time.Time {
+	return v.expire
+}
+
+// Version 返回拥有者节点为值分配的版本号，可以传给 SetIfVersion 进行比较并交换。
+//
+// 返回值:
+//
+//	uint64: 版本号，0 表示值没有缓存在拥有者节点上，例如被 WithCacheFilter 排除的 key。
+func (v ByteView) Version() uint64 {
+	return v.version
+}
+
+// expired 判断值在 t 时刻是否已经过期。
+func (v ByteView) expired(t time.Time) bool {
+	return !v.expire.IsZero() && !t.Before(v.expire)
+}
+
+// needsRefresh 判断值在 t 时刻是否已经过了软过期时间，需要在后台刷新。
+func (v ByteView) needsRefresh(t time.Time) bool {
+	return !v.stale.IsZero() && !t.Before(v.stale)
+}
+
 // ByteSlice 返回一个数据的拷贝。
 //
 // 为了保证 ByteView 的不可变性，此方法返回一个底层字节数组的克隆，
@@ -27,6 +66,30 @@ func (v ByteView) ByteSlice() []byte {
 	return cloneBytes(v.b)
 }
 
+// Reader 返回一个读取数据的 io.Reader。它直接读取 ByteView 持有的数据，不会复制。
+//
+// 返回值:
+//
+//	io.Reader: 从头读取数据的 Reader。
+func (v ByteView) Reader() io.Reader {
+	return bytes.NewReader(v.b)
+}
+
+// WriteTo 实现了 io.WriterTo 接口，把数据写入 w，io.Copy 因此不需要中间的缓冲区。
+//
+// 参数:
+//
+//	w: 写入数据的目标。
+//
+// 返回值:
+//
+//	n: 写入的字节数。
+//	err: w 返回的错误。
+func (v ByteView) WriteTo(w io.Writer) (n int64, err error) {
+	m, err := w.Write(v.b)
+	return int64(m), err
+}
+
 // String 将数据作为字符串返回，并实现了 fmt.Stringer 接口。
 //
 // 返回值:
@@ -0,0 +1,126 @@
+package geecache
+
+import (
+	"bufio"
+	"encoding/hex"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WithAccessLog 设置 ServeHTTP 的访问日志。默认每个请求记录一行日志，包括方法、路径、状态码、
+// 响应体的字节数、处理时间和请求方的地址，日志交给 SetLogger 设置的 Logger；健康检查和不属于 basePath 的请求不记录。
+//
+// 参数:
+//
+//	enabled: 是否记录访问日志，为 false 时 ServeHTTP 不再记录任何请求。
+//	redactKeys: 是否在日志中隐藏 key，为 true 时路径中的 key 被替换为它的哈希，
+//	  同一个 key 的请求仍然可以相互对应，但日志中不再出现 key 本身。
+//
+// 返回值:
+//
+//	PoolOption: 可传递给 NewHTTPPool 的配置项。
+func WithAccessLog(enabled bool, redactKeys bool) PoolOption {
+	return func(p *HTTPPool) {
+		p.noAccessLog = !enabled
+		p.redactKeys = redactKeys
+	}
+}
+
+// accessLogging 报告 r 是否需要记录访问日志。全局 Logger 是 NopLogger 时不记录，响应也就不需要被包装。
+func (h *HTTPPool) accessLogging(r *http.Request) bool {
+	if h.noAccessLog || r.URL.Path == h.basePath+healthzPath {
+		return false
+	}
+	_, nop := globalLogger.Load().(loggerHolder).l.(NopLogger)
+	return !nop
+}
+
+// logAccess 在请求结束之后记录一行访问日志。
+func (h *HTTPPool) logAccess(w *accessLogWriter, r *http.Request, start time.Time) {
+	status := w.status
+	if status == 0 {
+		// 没有写入任何内容的 handler 由 net/http 回应 200
+		status = http.StatusOK
+	}
+	h.Log("%s %s %d %dB %v from %s", r.Method, h.accessLogPath(r.URL.EscapedPath()),
+		status, w.bytes, now().Sub(start), r.RemoteAddr)
+}
+
+// accessLogPath 返回访问日志中的路径，设置了 redactKeys 时 /<basepath>/<groupname>/<key> 中的 key 被替换为
+// "#" 加 FNV-1a 64 位哈希；批量请求的 key 不在路径中，不受影响。
+func (h *HTTPPool) accessLogPath(path string) string {
+	if !h.redactKeys {
+		return path
+	}
+	// 与 splitKeyPath 一样按路径段跳过 basePath
+	i := 0
+	for range strings.Count(h.basePath, "/") {
+		j := strings.IndexByte(path[i:], '/')
+		if j < 0 {
+			return path
+		}
+		i += j + 1
+	}
+	j := strings.IndexByte(path[i:], '/')
+	if j < 0 || i+j+1 == len(path) {
+		return path
+	}
+	i += j + 1
+	hash := fnv.New64a()
+	hash.Write([]byte(path[i:]))
+	return path[:i] + "#" + hex.EncodeToString(hash.Sum(nil))
+}
+
+// accessLogWriter 记录响应的状态码和响应体的字节数，同时保留底层 ResponseWriter 的 Flush 和 Hijack。
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessLogWriter) WriteHeader(code int) {
+	if w.status == 0 && code >= 200 {
+		// 1xx 的响应之后还会有最终的状态码
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *accessLogWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush 实现了 http.Flusher 接口，底层 ResponseWriter 不支持时什么也不做。
+func (w *accessLogWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+// Hijack 实现了 http.Hijacker 接口，底层 ResponseWriter 不支持时返回 http.ErrNotSupported。
+func (w *accessLogWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return hj.Hijack()
+}
+
+// Unwrap 让 http.ResponseController 找到底层的 ResponseWriter。
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
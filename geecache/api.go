@@ -0,0 +1,332 @@
+package geecache
+
+import (
+	"GeeCache/lru"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultAPIBasePath 是 APIServer 默认的路径前缀。
+const defaultAPIBasePath = "/api/cache/"
+
+// APIServer 是面向应用客户端的 REST 接口，与节点之间的协议（HTTPPool）分开提供：
+//
+//	GET    <basePath><group>/<key>          读取值，HEAD 只返回头部
+//	PUT    <basePath><group>/<key>[?ttl=1m]  写入值（需要 WithAPIWrites），ttl 为 time.ParseDuration 的格式
+//	DELETE <basePath><group>/<key>          删除值（需要 WithAPIWrites）
+//
+// group 和 key 分别按路径段转义。成功的 GET 以原始的字节返回值，Content-Type 取自 WithAPIContentType，
+// 没有设置时为 application/octet-stream；写入成功返回 204。错误以 {"error": "..."} 的 JSON 返回：
+// key 不存在、group 不存在或者不在 WithAPIGroups 之内时返回 404，key 被拒绝时返回 400，值过大时返回 413，
+// 暂时性的加载失败返回 503，其他错误返回 500，后两者不包含原始的错误信息。APIServer 不需要 HTTPPool，也不提供节点之间的任何操作，
+// 可以挂在独立的端口上，也可以注册到应用自己的 mux 中。
+type APIServer struct {
+	registry     *Registry
+	basePath     string
+	groups       []string          // WithAPIGroups 允许访问的 group，为 nil 时允许 registry 中所有的 group
+	writes       bool              // 是否接受 PUT 和 DELETE
+	origins      []string          // WithAPICORS 允许的来源，"*" 表示任何来源
+	contentTypes map[string]string // WithAPIContentType 设置的每个 group 的 Content-Type
+	maxBody      int64             // PUT 请求体的大小上限
+}
+
+// APIOption 用于在 NewAPIServer 时对 APIServer 进行可选配置。
+type APIOption func(*APIServer)
+
+// NewAPIServer 创建一个提供 r 中的 group 的 APIServer，默认只读，路径前缀为 /api/cache/。
+//
+// 参数:
+//
+//	r: 提供 group 的 Registry，为 nil 时使用包级别函数使用的 Registry。
+//	opts: 可选的配置项。
+//
+// 返回值:
+//
+//	*APIServer: 一个指向新创建的 APIServer 实例的指针。
+func NewAPIServer(r *Registry, opts ...APIOption) *APIServer {
+	if r == nil {
+		r = defaultRegistry
+	}
+	s := &APIServer{
+		registry:     r,
+		basePath:     defaultAPIBasePath,
+		contentTypes: make(map[string]string),
+		maxBody:      defaultMaxBodyBytes,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// WithAPIBasePath 设置 APIServer 的路径前缀，不以 "/" 结尾时会自动补上。
+//
+// 参数:
+//
+//	p: 路径前缀，例如 "/v1/cache/"。
+//
+// 返回值:
+//
+//	APIOption: 可传递给 NewAPIServer 的配置项。
+func WithAPIBasePath(p string) APIOption {
+	return func(s *APIServer) {
+		if !strings.HasPrefix(p, "/") {
+			p = "/" + p
+		}
+		if !strings.HasSuffix(p, "/") {
+			p += "/"
+		}
+		s.basePath = p
+	}
+}
+
+// WithAPIGroups 只允许客户端访问名为 names 的 group，其他 group 与不存在的 group 一样返回 404。
+//
+// 参数:
+//
+//	names: 允许访问的 group 名称。
+//
+// 返回值:
+//
+//	APIOption: 可传递给 NewAPIServer 的配置项。
+func WithAPIGroups(names ...string) APIOption {
+	return func(s *APIServer) {
+		s.groups = append([]string{}, names...)
+	}
+}
+
+// WithAPIWrites 让 APIServer 接受 PUT 和 DELETE，通过 Group.Set 和 Group.Remove 写入和删除值。
+// 默认只读，这两个方法返回 405。
+//
+// 返回值:
+//
+//	APIOption: 可传递给 NewAPIServer 的配置项。
+func WithAPIWrites() APIOption {
+	return func(s *APIServer) {
+		s.writes = true
+	}
+}
+
+// WithAPICORS 允许来自 origins 的浏览器跨域访问 APIServer，"*" 表示任何来源。
+// 来源匹配的请求的响应带有 Access-Control-Allow-Origin，OPTIONS 预检请求返回 204 和允许的方法；
+// 默认不设置任何 CORS 头部。
+//
+// 参数:
+//
+//	origins: 允许的来源，例如 "https://app.example.com"。
+//
+// 返回值:
+//
+//	APIOption: 可传递给 NewAPIServer 的配置项。
+func WithAPICORS(origins ...string) APIOption {
+	return func(s *APIServer) {
+		s.origins = append([]string{}, origins...)
+	}
+}
+
+// WithAPIContentType 设置 group 中的值在 GET 响应中的 Content-Type，例如 "application/json"。
+//
+// 参数:
+//
+//	group: group 的名称。
+//	contentType: 值的 Content-Type。
+//
+// 返回值:
+//
+//	APIOption: 可传递给 NewAPIServer 的配置项。
+func WithAPIContentType(group, contentType string) APIOption {
+	return func(s *APIServer) {
+		s.contentTypes[group] = contentType
+	}
+}
+
+// RegisterOn 把 APIServer 注册到 mux 的路径前缀上，与应用的其他 handler 共用一个服务器。
+//
+// 参数:
+//
+//	mux: 要注册到的 ServeMux。
+func (s *APIServer) RegisterOn(mux *http.ServeMux) {
+	mux.Handle(s.basePath, s)
+}
+
+// ServeHTTP 实现了 http.Handler 接口，见 APIServer。
+func (s *APIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, s.basePath) {
+		writeAPIError(w, http.StatusNotFound, "not found")
+		return
+	}
+	allow := "GET, HEAD, OPTIONS"
+	if s.writes {
+		allow = "GET, HEAD, PUT, DELETE, OPTIONS"
+	}
+	if s.cors(w, r, allow) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPut, http.MethodDelete:
+		if s.writes {
+			break
+		}
+		fallthrough
+	default:
+		w.Header().Set("Allow", allow)
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	groupName, key, err := s.splitPath(r.URL)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	group := s.group(groupName)
+	if group == nil {
+		writeAPIError(w, http.StatusNotFound, "no such group: "+groupName)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		s.serveGet(w, r, group, key)
+	case http.MethodPut:
+		s.servePut(w, r, group, key)
+	case http.MethodDelete:
+		if err := group.RemoveContext(r.Context(), key); err != nil {
+			s.writeLoadError(w, group, key, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// serveGet 以原始的字节返回 key 的值，HEAD 请求只返回头部。
+func (s *APIServer) serveGet(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	view, err := group.GetContext(r.Context(), key)
+	if err != nil {
+		s.writeLoadError(w, group, key, err)
+		return
+	}
+	w.Header().Set("Content-Type", cmp.Or(s.contentTypes[group.name], "application/octet-stream"))
+	w.Header().Set("Content-Length", strconv.Itoa(view.Len()))
+	if r.Method == http.MethodGet {
+		w.Write(view.b)
+	}
+}
+
+// servePut 以请求体为值、以 ttl 参数为存活时间写入 key。
+func (s *APIServer) servePut(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	var ttl time.Duration
+	if v := r.URL.Query().Get("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			writeAPIError(w, http.StatusBadRequest, "bad ttl: "+v)
+			return
+		}
+		ttl = d
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxBody))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeAPIError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("value larger than %d bytes", s.maxBody))
+			return
+		}
+		writeAPIError(w, http.StatusBadRequest, "failed to read value")
+		return
+	}
+	if err := group.SetContext(r.Context(), key, body, ttl); err != nil {
+		s.writeLoadError(w, group, key, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// splitPath 从请求路径 <basePath><group>/<key> 中取出 group 和 key，两者分别按路径段转义。
+func (s *APIServer) splitPath(u *url.URL) (group, key string, err error) {
+	rest, ok := strings.CutPrefix(u.EscapedPath(), s.basePath)
+	if !ok {
+		rest, _ = strings.CutPrefix(u.Path, s.basePath)
+	}
+	g, k, ok := strings.Cut(rest, "/")
+	if !ok || g == "" || k == "" {
+		return "", "", errors.New("expect " + s.basePath + "<group>/<key>")
+	}
+	if group, err = url.PathUnescape(g); err != nil {
+		return "", "", errors.New("bad group escaping")
+	}
+	if key, err = url.PathUnescape(k); err != nil {
+		return "", "", errors.New("bad key escaping")
+	}
+	return group, key, nil
+}
+
+// group 返回客户端可以访问的名为 name 的 group，不存在或者不在 WithAPIGroups 之内时返回 nil。
+func (s *APIServer) group(name string) *Group {
+	if s.groups != nil && !slices.Contains(s.groups, name) {
+		return nil
+	}
+	return s.registry.GetGroup(name)
+}
+
+// cors 为来源被允许的请求设置 CORS 头部，并回应 OPTIONS 预检请求，返回值报告是否已经写入了响应。
+func (s *APIServer) cors(w http.ResponseWriter, r *http.Request, allow string) bool {
+	origin := r.Header.Get("Origin")
+	if len(s.origins) > 0 {
+		w.Header().Add("Vary", "Origin")
+	}
+	allowed := origin != "" && (slices.Contains(s.origins, "*") || slices.Contains(s.origins, origin))
+	if allowed {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if r.Method != http.MethodOptions {
+		return false
+	}
+	w.Header().Set("Allow", allow)
+	if allowed {
+		w.Header().Set("Access-Control-Allow-Methods", allow)
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Max-Age", "600")
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+// writeLoadError 把读写 key 失败的错误返回给客户端：key 被拒绝时返回 400，值过大时返回 413，
+// 其他错误按 peerError 分类，只有 key 不存在和 key 被拒绝时包含原始的错误信息。
+func (s *APIServer) writeLoadError(w http.ResponseWriter, group *Group, key string, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidKey):
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, ErrValueTooLarge), errors.Is(err, lru.ErrEntryTooLarge):
+		writeAPIError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	code, _, msg := peerError(group, err)
+	if code != http.StatusNotFound {
+		group.logf("[GeeCache] failed to serve %s to an API client: %v", key, err)
+	}
+	if code == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", retryAfterSeconds)
+	}
+	writeAPIError(w, code, msg)
+}
+
+// writeAPIError 以 JSON 返回错误。
+func writeAPIError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{msg})
+}
@@ -0,0 +1,106 @@
+package geecache
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// authScheme 是节点之间的请求在 Authorization 头部中使用的认证方案，见 HTTPPoolOptions.Secret。
+	authScheme = "GeeCache-HMAC-SHA256 "
+	// timestampHeader 携带请求被签名时的 Unix 时间（秒），它是签名的一部分。
+	timestampHeader = "X-GeeCache-Timestamp"
+	// maxClockSkew 是签名时间与本节点时间之间允许的最大差距，超出的请求被当作重放拒绝。
+	maxClockSkew = 5 * time.Minute
+)
+
+// signedHeaders 是除 timestampHeader 之外参与签名的请求头部，它们会改变写入的值的含义。
+var signedHeaders = []string{ttlMsHeader, versionHeader}
+
+// signature 返回请求的签名：以 secret 为密钥，对方法、路径和查询参数、签名时间、
+// signedHeaders 中的头部以及请求体计算的 HMAC-SHA256。
+func signature(secret []byte, method, requestURI string, header http.Header, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	for _, s := range []string{method, requestURI, header.Get(timestampHeader)} {
+		io.WriteString(mac, s)
+		mac.Write([]byte{'\n'})
+	}
+	for _, name := range signedHeaders {
+		io.WriteString(mac, header.Get(name))
+		mac.Write([]byte{'\n'})
+	}
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sign 为发往其他节点的 req 设置 Authorization 头部。请求体会被读出并替换为内容相同的 Reader。
+func sign(req *http.Request, secret []byte) error {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	req.Header.Set(timestampHeader, strconv.FormatInt(now().Unix(), 10))
+	req.Header.Set("Authorization", authScheme+signature(secret, req.Method, req.URL.RequestURI(), req.Header, body))
+	return nil
+}
+
+// authenticate 检查其他节点发来的请求的签名，签名不正确或者签名时间与本节点相差超过 maxClockSkew 时
+// 返回 401 并返回 false。
+// 请求体会被读出（不超过 WithMaxBodyBytes 的上限）并替换为内容相同的 Reader，供之后的处理使用。
+func (h *HTTPPool) authenticate(w http.ResponseWriter, r *http.Request) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), authScheme)
+	if !ok {
+		h.rejectUnauthorized(w, r, "missing credentials")
+		return false
+	}
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		reader := io.Reader(r.Body)
+		if h.maxBody > 0 {
+			reader = io.LimitReader(r.Body, h.maxBody+1)
+		}
+		var err error
+		if body, err = io.ReadAll(reader); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return false
+		}
+		if h.maxBody > 0 && int64(len(body)) > h.maxBody {
+			http.Error(w, fmt.Sprintf("request body too large: limit %d", h.maxBody), http.StatusRequestEntityTooLarge)
+			return false
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	want := signature(h.secret, r.Method, r.URL.RequestURI(), r.Header, body)
+	if !hmac.Equal([]byte(got), []byte(want)) {
+		h.rejectUnauthorized(w, r, "invalid credentials")
+		return false
+	}
+	// 签名正确之后再检查时间，签名时间无法被篡改
+	ts, err := strconv.ParseInt(r.Header.Get(timestampHeader), 10, 64)
+	if skew := now().Sub(time.Unix(ts, 0)).Abs(); err != nil || skew > maxClockSkew {
+		h.rejectUnauthorized(w, r, "stale or missing timestamp")
+		return false
+	}
+	return true
+}
+
+// rejectUnauthorized 记录被拒绝的请求，并以 401 返回不带细节的错误。
+func (h *HTTPPool) rejectUnauthorized(w http.ResponseWriter, r *http.Request, reason string) {
+	h.Log("rejecting %s %s from %s: %s", r.Method, r.URL.Path, r.RemoteAddr, reason)
+	w.Header().Set("WWW-Authenticate", strings.TrimSpace(authScheme))
+	// 不告诉请求方是缺少签名还是签名不正确
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+}
@@ -0,0 +1,150 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultBreakerWindow 和 defaultBreakerCooldown 是 HTTPPoolOptions.BreakerWindow 和 BreakerCooldown 的默认值。
+	defaultBreakerWindow   = 10 * time.Second
+	defaultBreakerCooldown = 5 * time.Second
+)
+
+// ErrPeerCircuitOpen 表示远程节点的熔断器处于打开状态，请求没有发出就失败了，见 HTTPPoolOptions.BreakerFailures。
+// 它不会被 WithPeerRetry 重试，Group 立即回退到下一个拥有者或本地加载。
+var ErrPeerCircuitOpen = errors.New("geecache: peer circuit breaker is open")
+
+// BreakerState 是远程节点的熔断器的状态，见 PeerStats.Breaker。
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // 请求正常发出，没有启用熔断时总是这个状态
+	BreakerOpen                         // 请求立即以 ErrPeerCircuitOpen 失败
+	BreakerHalfOpen                     // 冷却结束，只放行一个探测请求
+)
+
+// String 返回状态的名称，例如 "open"。
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("BreakerState(%d)", int(s))
+	}
+}
+
+// MarshalText 实现了 encoding.TextMarshaler 接口，统计接口中的状态因此是它的名称。
+func (s BreakerState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText 实现了 encoding.TextUnmarshaler 接口，接受 String 返回的名称。
+func (s *BreakerState) UnmarshalText(text []byte) error {
+	for _, state := range []BreakerState{BreakerClosed, BreakerOpen, BreakerHalfOpen} {
+		if string(text) == state.String() {
+			*s = state
+			return nil
+		}
+	}
+	return fmt.Errorf("geecache: unknown breaker state %q", text)
+}
+
+// breaker 是一个远程节点的熔断器，时间取自 now，为 nil 时不熔断。
+//
+// 关闭时，window 之内的失败达到 failures 次就打开；打开 cooldown 之后变为半开，放行一个探测请求，
+// 它成功时关闭，失败时重新打开。调用方取消的请求既不算成功也不算失败。
+type breaker struct {
+	failures int
+	window   time.Duration
+	cooldown time.Duration
+
+	mu      sync.Mutex
+	state   BreakerState
+	count   int       // 当前窗口之内失败的次数
+	since   time.Time // 当前窗口开始的时间，打开之后为打开的时间
+	probing bool      // 半开时是否已经放行了探测请求
+}
+
+// newBreaker 返回按 failures、window 和 cooldown 熔断的 breaker，failures 小于等于 0 时返回 nil。
+func newBreaker(failures int, window, cooldown time.Duration) *breaker {
+	if failures <= 0 {
+		return nil
+	}
+	return &breaker{failures: failures, window: window, cooldown: cooldown}
+}
+
+// allow 报告是否可以向节点发出请求，不可以时返回 ErrPeerCircuitOpen。
+func (b *breaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && now().Sub(b.since) >= b.cooldown {
+		b.state, b.probing = BreakerHalfOpen, false
+	}
+	switch {
+	case b.state == BreakerClosed:
+		return nil
+	case b.state == BreakerHalfOpen && !b.probing:
+		b.probing = true
+		return nil
+	default:
+		return ErrPeerCircuitOpen
+	}
+}
+
+// done 记录 allow 放行的一个请求的结果，失败的判断与 httpGetter.record 相同。
+func (b *breaker) done(ctx context.Context, err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cancelled := err != nil && ctx.Err() != nil
+	failed := err != nil && !errors.Is(err, ErrNotFound) && !cancelled
+	t := now()
+	switch b.state {
+	case BreakerHalfOpen:
+		b.probing = false
+		switch {
+		case cancelled:
+			// 仍然是半开，下一个请求重新探测
+		case failed:
+			b.state, b.since = BreakerOpen, t
+		default:
+			b.state, b.count = BreakerClosed, 0
+		}
+	case BreakerClosed:
+		if !failed {
+			return
+		}
+		if t.Sub(b.since) >= b.window {
+			b.count, b.since = 0, t
+		}
+		if b.count++; b.count >= b.failures {
+			b.state, b.since = BreakerOpen, t
+		}
+	}
+}
+
+// current 返回熔断器当前的状态，打开之后冷却结束的熔断器报告为半开。
+func (b *breaker) current() BreakerState {
+	if b == nil {
+		return BreakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && now().Sub(b.since) >= b.cooldown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
@@ -2,38 +2,408 @@ package geecache
 
 import (
 	"GeeCache/lru"
+	"io"
+	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// store 是 cache 对底层非并发安全缓存实现的抽象，
+// lru.Cache 与 lru.Approx 都满足此接口。
+type store interface {
+	Get(key string) (lru.Value, bool)
+	Peek(key string) (lru.Value, bool)
+	Promote(key string) bool
+	AddE(key string, value lru.Value) error
+	AddWithTTL(key string, value lru.Value, ttl time.Duration) error
+	AddCold(key string, value lru.Value) error
+	Touch(key string) bool
+	Remove(key string) bool
+	RemoveOldest()
+	RemoveExpired() int
+	Clear()
+	Bytes() int64
+	Stats() lru.Stats
+	Save(w io.Writer) error
+	Load(r io.Reader) error
+}
+
 // cache 是一个并发安全的缓存结构体，封装了 LRU 缓存策略。
+//
+// 默认情况下它用一个读写锁保护单个 lru.Cache：命中时只在读锁下 Peek，
+// 再把 LRU 提升记录到 pending 缓冲区中，等到下一次持有写锁时统一补做，
+// 因此并发读取不同的键不会互相阻塞。缓冲区写满时退化为立即获取写锁提升。
+// 当 shards 大于 1 时，改为使用自带分片锁的 lru.ShardedCache，此时不再使用 mu。
 type cache struct {
-	mu         sync.Mutex
-	cache      *lru.Cache
-	cacheBytes int64
+	mu            sync.RWMutex
+	pending       chan string       // 尚未补做 LRU 提升的命中键，在 init 中创建
+	cache         store             // 未分片时在 init 中按配置创建
+	sharded       *lru.ShardedCache // shards 大于 1 时在 init 中创建，之后只读
+	cacheBytes    int64
+	shards        int                                                     // 分片数量，0 或 1 表示不分片
+	approx        int                                                     // 大于 0 时使用采样数为 approx 的 lru.Approx 代替 lru.Cache
+	events        lru.Events                                              // 可选的事件钩子，在 lru.Cache 初始化时安装
+	cost          func(key string, value lru.Value) int64                 // 可选的条目开销函数
+	onEvicted     func(key string, value lru.Value)                       // 条目因容量被淘汰时的回调，在持有锁时调用
+	onExpired     func(key string, value lru.Value)                       // 条目因过期被删除时的回调，在持有锁时调用
+	onRemoved     func(key string, value lru.Value)                       // 条目被主动删除时的回调，为 nil 时使用 onEvicted
+	handler       func(key string, value ByteView, reason EvictionReason) // 可选的淘汰通知，在释放锁之后调用
+	evicted       func(key string, value ByteView)                        // 可选的容量淘汰通知，在释放锁之后调用
+	noticeMu      sync.Mutex                                              // 保护 notices
+	notices       []eviction                                              // 尚未交给 handler 的淘汰通知
+	maxValueBytes int64                                                   // 单个值允许缓存的最大字节数，0 表示不限制
+	rejected      atomic.Int64                                            // 因超过 maxValueBytes 被拒绝缓存的值的数量
+	versions      atomic.Uint64                                           // 最近分配的版本号，见 nextVersion
+	destroyed     atomic.Bool                                             // destroy 之后为 true，不再接受写入
+	janitor       time.Duration                                           // 后台清理过期条目的间隔，0 表示不启动
+	grace         time.Duration                                           // 值过期之后在底层 LRU 中继续保留的时长，见 WithStaleIfError
+	stop          chan struct{}                                           // 关闭后 janitor 退出
+}
+
+// init 在 Group 的配置项全部应用之后调用，根据配置完成缓存的初始化。
+//
+// 未分片时立即按配置创建底层的 lru.Cache 或 lru.Approx；
+// 分片时 lru.ShardedCache 会按同一份配置在分片第一次写入时创建分片。
+func (c *cache) init() {
+	c.pending = make(chan string, pendingHits)
+	if c.handler != nil || c.evicted != nil {
+		c.onRemoved = c.hook(c.onEvicted, EvictionRemoved)
+		c.onEvicted = c.hook(c.onEvicted, EvictionCapacity)
+		c.onExpired = c.hook(c.onExpired, EvictionExpired)
+	}
+	if c.shards == AutoShards {
+		c.shards = autoShards(runtime.GOMAXPROCS(0), c.cacheBytes)
+	}
+	if c.shards > 1 {
+		c.sharded = lru.NewSharded(c.shards, c.cacheBytes, c.onEvicted)
+		c.sharded.SetEvents(c.events)
+		c.sharded.SetCost(c.cost)
+		c.sharded.SetOnExpired(c.onExpired)
+		c.sharded.SetOnRemoved(c.onRemoved)
+		c.sharded.SetDecode(c.decodeByteView)
+	} else {
+		c.cache = c.newLRU()
+	}
+	if c.janitor > 0 {
+		c.stop = make(chan struct{})
+		go c.runJanitor(c.janitor, c.stop)
+	}
+}
+
+// admit 检查 value 是否允许被缓存，超过 maxValueBytes 时记录一次拒绝。
+func (c *cache) admit(value ByteView) error {
+	if c.destroyed.Load() {
+		return ErrGroupDestroyed
+	}
+	if c.maxValueBytes > 0 && int64(value.Len()) > c.maxValueBytes {
+		c.rejected.Add(1)
+		return ErrValueTooLarge
+	}
+	return nil
+}
+
+// eviction 是一条等待交给 handler 的淘汰通知。
+type eviction struct {
+	key    string
+	value  ByteView
+	reason EvictionReason
+}
+
+// hook 包装安装到底层 LRU 中的回调：先同步调用 fn（可以为 nil），
+// 再记录一条原因为 reason 的淘汰通知，由 notify 在释放锁之后交给 handler。
+func (c *cache) hook(fn func(key string, value lru.Value), reason EvictionReason) func(key string, value lru.Value) {
+	return func(key string, value lru.Value) {
+		if fn != nil {
+			fn(key, value)
+		}
+		c.noticeMu.Lock()
+		c.notices = append(c.notices, eviction{key: key, value: value.(ByteView), reason: reason})
+		c.noticeMu.Unlock()
+	}
+}
+
+// notify 将积累的淘汰通知交给 handler，其中因容量被淘汰的条目同时交给 evicted。
+//
+// 调用方不能持有 c.mu 或分片锁，因此各个会淘汰条目的方法都在
+// 获取锁之前 defer 此方法，使 handler 可以安全地回调同一个 Group。
+func (c *cache) notify() {
+	if c.handler == nil && c.evicted == nil {
+		return
+	}
+	c.noticeMu.Lock()
+	notices := c.notices
+	c.notices = nil
+	c.noticeMu.Unlock()
+	for _, n := range notices {
+		if c.handler != nil {
+			c.handler(n.key, n.value, n.reason)
+		}
+		if c.evicted != nil && n.reason == EvictionCapacity {
+			c.evicted(n.key, n.value)
+		}
+	}
+}
+
+// now 返回当前时间，测试中可以替换它来控制条目的过期。
+var now = time.Now
+
+// expireAfter 返回从现在起 ttl 之后的时间，ttl 小于等于 0 时返回零值，表示永不过期。
+func expireAfter(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now().Add(ttl)
+}
+
+// pendingHits 是读路径中暂存的待提升命中数量上限。
+const pendingHits = 64
+
+// lock 获取写锁，并补做所有暂存的 LRU 提升，使写操作看到最新的访问顺序。
+func (c *cache) lock() {
+	c.mu.Lock()
+	for {
+		select {
+		case key := <-c.pending:
+			c.cache.Promote(key)
+		default:
+			return
+		}
+	}
+}
+
+// recordHit 记录一次读锁下的命中，必要时退化为在写锁下立即提升。
+func (c *cache) recordHit(key string) {
+	select {
+	case c.pending <- key:
+	default:
+		c.lock()
+		c.cache.Promote(key)
+		c.mu.Unlock()
+	}
+}
+
+// minShardBytes 是自动分片时每个分片至少分到的容量。
+const minShardBytes = 64 << 10
+
+// autoShards 根据可用的 CPU 数量和缓存容量选择分片数量。
+//
+// 分片数为不小于 procs 的 2 的幂；当 cacheBytes 不为 0 时，
+// 会不断减半直到每个分片的额度不小于 minShardBytes。
+func autoShards(procs int, cacheBytes int64) int {
+	n := 1
+	for n < procs {
+		n <<= 1
+	}
+	for n > 1 && cacheBytes != 0 && cacheBytes/int64(n) < minShardBytes {
+		n >>= 1
+	}
+	return n
+}
+
+// runJanitor 每隔 interval 清理一次已过期的条目，直到 stop 被关闭。
+func (c *cache) runJanitor(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.removeExpired()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// removeExpired 删除缓存中所有已过期的条目，并返回删除的数量。
+//
+// 此方法是并发安全的。
+func (c *cache) removeExpired() int {
+	defer c.notify()
+	if c.sharded != nil {
+		return c.sharded.RemoveExpired()
+	}
+	c.lock()
+	defer c.mu.Unlock()
+	return c.cache.RemoveExpired()
+}
+
+// close 停止后台的 janitor，可以重复调用。
+func (c *cache) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
+
+// destroy 停止 janitor 并清空缓存，之后的写入都会返回 ErrGroupDestroyed。
+func (c *cache) destroy() {
+	c.destroyed.Store(true)
+	c.close()
+	c.clear()
+}
+
+// clear 删除缓存中的全部条目，不触发淘汰回调。
+//
+// 此方法是并发安全的。
+func (c *cache) clear() {
+	if c.sharded != nil {
+		c.sharded.Clear()
+		return
+	}
+	c.lock()
+	defer c.mu.Unlock()
+	c.cache.Clear()
+}
+
+// decodeByteView 将快照中的字节恢复为 ByteView。
+func (c *cache) decodeByteView(data []byte) lru.Value {
+	// 快照中没有保存版本号，恢复的条目分配新的版本号，与不存在的 key 区分开
+	return ByteView{b: data, version: c.versions.Add(1)}
+}
+
+// newLRU 根据 cache 的配置创建底层的 lru.Cache 或 lru.Approx。
+func (c *cache) newLRU() store {
+	if c.approx > 0 {
+		a := lru.NewApprox(c.cacheBytes, c.onEvicted)
+		a.Samples = c.approx
+		a.OnExpired = c.onExpired
+		a.OnRemoved = c.onRemoved
+		a.Events = c.events
+		a.Cost = c.cost
+		a.Decode = c.decodeByteView
+		return a
+	}
+	l := lru.New(c.cacheBytes, c.onEvicted)
+	l.OnExpired = c.onExpired
+	l.OnRemoved = c.onRemoved
+	l.Events = c.events
+	l.Cost = c.cost
+	l.Decode = c.decodeByteView
+	return l
 }
 
 // add 方法向缓存中添加一个键值对。
 //
-// 此方法是并发安全的。如果内部的 lru.Cache 尚未初始化，
-// 它会在此次调用中进行延迟初始化。
+// 此方法是并发安全的。expireAt 不为零时，它会被记录在缓存的 ByteView 中，
+// get 在此时间之后会把条目当作未命中并删除；已经过期的值不会被写入。
 //
 // 参数:
 //
 //	key: 要添加的键。
 //	value: 与键关联的值。
-func (c *cache) add(key string, value ByteView) {
-	c.mu.Lock()
+//	expireAt: 条目的过期时间，零值表示永不过期。
+//
+// 返回值:
+//
+//	error: 值超过 maxValueBytes 时返回 ErrValueTooLarge，条目超过缓存容量时返回 lru.ErrEntryTooLarge。
+func (c *cache) add(key string, value ByteView, expireAt time.Time) error {
+	defer c.notify()
+	if err := c.admit(value); err != nil {
+		return err
+	}
+	var ttl time.Duration
+	if !expireAt.IsZero() {
+		if ttl = expireAt.Sub(now()); ttl <= 0 {
+			return nil
+		}
+		ttl += c.grace
+		value.expire = expireAt
+	}
+	if c.sharded != nil {
+		return c.sharded.AddWithTTL(key, value, ttl)
+	}
+	c.lock()
 	defer c.mu.Unlock()
-	if c.cache == nil {
-		c.cache = lru.New(c.cacheBytes, nil)
+	return c.cache.AddWithTTL(key, value, ttl)
+}
+
+// addCold 以“冷”方式向缓存中添加一个键值对。
+//
+// 与 add 不同，新条目会被放在最先被淘汰的位置，直到它被真正读取，
+// 适用于预热和代替其他节点加载的数据。value 中记录的过期时间同样生效，
+// 已经过期的值不会被写入。
+//
+// 参数:
+//
+//	key: 要添加的键。
+//	value: 与键关联的值。
+//
+// 返回值:
+//
+//	error: 值超过 maxValueBytes 时返回 ErrValueTooLarge，条目超过缓存容量时返回 lru.ErrEntryTooLarge。
+func (c *cache) addCold(key string, value ByteView) error {
+	defer c.notify()
+	if err := c.admit(value); err != nil {
+		return err
 	}
-	c.cache.Add(key, value)
+	if value.expired(now()) {
+		return nil
+	}
+	if c.sharded != nil {
+		return c.sharded.AddCold(key, value)
+	}
+	c.lock()
+	defer c.mu.Unlock()
+	return c.cache.AddCold(key, value)
+}
 
+// update 在锁内读取 key 当前的值，用 fn 算出新值并写入，读取和写入之间不会插入其他写入。
+//
+// 此方法是并发安全的。与 add 相同，新值中记录的过期时间同时作为条目的过期时间，
+// 已经过期的值不会被写入。fn 不能再调用 c 的方法，否则会死锁。
+//
+// 参数:
+//
+//	key: 要更新的键。
+//	cold: 为 true 时与 addCold 一样以“冷”方式写入。
+//	fn: 接收当前的值并返回要写入的值，key 不存在或已过期时接收零值；返回错误时不写入。
+//
+// 返回值:
+//
+//	value: 写入的值。
+//	err: fn 返回的错误，或者与 add 相同的写入错误。
+func (c *cache) update(key string, cold bool, fn func(old ByteView) (ByteView, error)) (value ByteView, err error) {
+	defer c.notify()
+	apply := func(s store) error {
+		var old ByteView
+		if v, ok := s.Peek(key); ok && !v.(ByteView).expired(now()) {
+			old = v.(ByteView)
+		}
+		if value, err = fn(old); err != nil {
+			return err
+		}
+		if err := c.admit(value); err != nil {
+			return err
+		}
+		if value.expired(now()) {
+			return nil
+		}
+		if cold {
+			return s.AddCold(key, value)
+		}
+		var ttl time.Duration
+		if !value.expire.IsZero() {
+			ttl = value.expire.Sub(now()) + c.grace
+		}
+		return s.AddWithTTL(key, value, ttl)
+	}
+	if c.sharded != nil {
+		err = c.sharded.Do(key, func(lc *lru.Cache) error { return apply(lc) })
+		return value, err
+	}
+	c.lock()
+	defer c.mu.Unlock()
+	err = apply(c.cache)
+	return value, err
 }
 
 // get 方法根据键从缓存中查找对应的值。
 //
-// 此方法是并发安全的。如果缓存尚未初始化，它将直接返回零值。
+// 此方法是并发安全的。值中记录的过期时间已过时按未命中处理，条目会被删除，
+// 除非它还在 grace 之内，此时保留给 stale 使用。
 //
 // 参数:
 //
@@ -44,14 +414,211 @@ func (c *cache) add(key string, value ByteView) {
 //	value: 查找到的值。如果未找到，则为空的 ByteView。
 //	ok: 如果找到了键，则为 true；否则为 false。
 func (c *cache) get(key string) (value ByteView, ok bool) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.cache == nil {
+	value, ok = c.lookup(key)
+	if t := now(); ok && value.expired(t) {
+		if !t.Before(value.expire.Add(c.grace)) {
+			c.delete(key)
+		}
+		return ByteView{}, false
+	}
+	return value, ok
+}
+
+// stale 返回 key 已经过期但还在 grace 之内的值，不提升它的 LRU 位置，也不计入命中和未命中统计。
+func (c *cache) stale(key string) (value ByteView, ok bool) {
+	if c.grace <= 0 {
+		return ByteView{}, false
+	}
+	var v lru.Value
+	if c.sharded != nil {
+		v, ok = c.sharded.Peek(key)
+	} else {
+		c.mu.RLock()
+		v, ok = c.cache.Peek(key)
+		c.mu.RUnlock()
+	}
+	if !ok {
+		return ByteView{}, false
+	}
+	value = v.(ByteView)
+	if t := now(); !value.expired(t) || !t.Before(value.expire.Add(c.grace)) {
+		return ByteView{}, false
+	}
+	return value, true
+}
+
+// peek 查找 key 但不提升它的 LRU 位置，也不计入命中和未命中统计，已过期的值按未命中处理。
+func (c *cache) peek(key string) (value ByteView, ok bool) {
+	var v lru.Value
+	if c.sharded != nil {
+		v, ok = c.sharded.Peek(key)
+	} else {
+		c.mu.RLock()
+		v, ok = c.cache.Peek(key)
+		c.mu.RUnlock()
+	}
+	if !ok || v.(ByteView).expired(now()) {
+		return ByteView{}, false
+	}
+	return v.(ByteView), true
+}
+
+// lookup 在底层 LRU 中查找 key，不检查 ByteView 中记录的过期时间。
+func (c *cache) lookup(key string) (value ByteView, ok bool) {
+	if c.sharded != nil {
+		defer c.notify()
+		if v, ok := c.sharded.Get(key); ok {
+			return v.(ByteView), true
+		}
 		return
 	}
-	v, ok := c.cache.Get(key)
+	c.mu.RLock()
+	v, ok := c.cache.Peek(key)
+	c.mu.RUnlock()
 	if ok {
-		return v.(ByteView), ok
+		c.recordHit(key)
+		return v.(ByteView), true
+	}
+
+	// 未命中或已过期时在写锁下走完整的 Get，由它完成过期删除和未命中统计
+	defer c.notify()
+	c.lock()
+	defer c.mu.Unlock()
+	if v, ok := c.cache.Get(key); ok {
+		return v.(ByteView), true
 	}
 	return
 }
+
+// save 将缓存内容以快照形式写入 w。
+//
+// 此方法在整个写入期间持有锁，保证快照是某一时刻的一致视图。
+//
+// 参数:
+//
+//	w: 快照写入的目标。
+//
+// 返回值:
+//
+//	error: 写入失败时返回错误。
+func (c *cache) save(w io.Writer) error {
+	if c.sharded != nil {
+		return c.sharded.Save(w)
+	}
+	c.lock()
+	defer c.mu.Unlock()
+	return c.cache.Save(w)
+}
+
+// load 从 r 中读取快照并恢复到缓存中。
+//
+// 此方法在读取期间持有锁。
+//
+// 参数:
+//
+//	r: 快照数据的来源。
+//
+// 返回值:
+//
+//	error: 快照格式不正确或读取失败时返回错误。
+func (c *cache) load(r io.Reader) error {
+	defer c.notify()
+	if c.sharded != nil {
+		return c.sharded.Load(r)
+	}
+	c.lock()
+	defer c.mu.Unlock()
+	return c.cache.Load(r)
+}
+
+// bytes 返回缓存当前已用的字节数。
+//
+// 此方法是并发安全的。
+func (c *cache) bytes() int64 {
+	if c.sharded != nil {
+		return c.sharded.Bytes()
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cache.Bytes()
+}
+
+// stats 返回缓存当前的统计信息。
+//
+// 此方法是并发安全的，会先补做读路径中暂存的命中，使命中次数准确。
+func (c *cache) stats() lru.Stats {
+	if c.sharded != nil {
+		return c.sharded.Stats()
+	}
+	c.lock()
+	defer c.mu.Unlock()
+	return c.cache.Stats()
+}
+
+// maxBytes 返回缓存允许使用的最大字节数。
+func (c *cache) maxBytes() int64 {
+	return c.cacheBytes
+}
+
+// touch 刷新一个条目的最近使用时间。
+//
+// 此方法是并发安全的。
+//
+// 参数:
+//
+//	key: 要刷新的键。
+//
+// 返回值:
+//
+//	bool: 如果键存在，则为 true；否则为 false。
+func (c *cache) touch(key string) bool {
+	defer c.notify()
+	if c.sharded != nil {
+		return c.sharded.Touch(key)
+	}
+	c.lock()
+	defer c.mu.Unlock()
+	return c.cache.Touch(key)
+}
+
+// delete 从缓存中删除指定的键。
+//
+// 此方法是并发安全的。
+//
+// 参数:
+//
+//	key: 要删除的键。
+//
+// 返回值:
+//
+//	bool: 如果键存在并被删除，则为 true；否则为 false。
+func (c *cache) delete(key string) bool {
+	defer c.notify()
+	if c.sharded != nil {
+		return c.sharded.Remove(key)
+	}
+	c.lock()
+	defer c.mu.Unlock()
+	return c.cache.Remove(key)
+}
+
+// removeOldest 淘汰缓存中最久未使用的一个条目。
+//
+// 此方法是并发安全的。
+//
+// 返回值:
+//
+//	bool: 如果缓存中有条目被淘汰，则为 true；缓存为空时为 false。
+func (c *cache) removeOldest() bool {
+	defer c.notify()
+	if c.sharded != nil {
+		return c.sharded.RemoveOldest()
+	}
+	c.lock()
+	defer c.mu.Unlock()
+	if c.cache.Stats().Entries == 0 {
+		return false
+	}
+	c.cache.RemoveOldest()
+	return true
+}
@@ -0,0 +1,116 @@
+package geecache
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ChainedGetter 依次尝试多层数据源，例如先读 Redis 副本，未命中时再读权威的数据库。
+// 它由 ChainGetter 或 FallbackGetter 创建。
+//
+// ChainedGetter 实现了 RichGetter，因此是上下文感知的：Group 的上下文会传递给每一层，
+// 提供数据的那一层返回的 CacheOptions 原样交给 Group。每一层可以是 Getter、ContextGetter 或 RichGetter。
+// 作为 Group 的 getter 时，每一层成功加载的次数由 Group.ChainLoads 返回。
+type ChainedGetter struct {
+	tiers       []RichGetter
+	fallThrough func(err error) bool // 决定其他错误是否继续尝试下一层，为 nil 时立即失败
+}
+
+// ChainGetter 创建一个按顺序尝试 getters 的 ChainedGetter。
+//
+// 某一层返回满足 errors.Is(err, ErrNotFound) 的错误时尝试下一层，所有层都未找到时返回最后一层的错误，
+// 它同样满足 errors.Is(err, ErrNotFound)。其他错误会立即返回，不再尝试之后的层；
+// 需要在暂时性的故障时继续尝试时使用 FallbackGetter。
+//
+// 参数:
+//
+//	getters: 按顺序尝试的数据源，每一个都可以是 Getter、ContextGetter 或 RichGetter。
+//
+// 返回值:
+//
+//	*ChainedGetter: 可以作为 NewGroup 的 getter 使用。
+func ChainGetter(getters ...any) *ChainedGetter {
+	return FallbackGetter(nil, getters...)
+}
+
+// FallbackGetter 与 ChainGetter 相同，但由 fallThrough 决定其他错误是否继续尝试下一层。
+//
+// fallThrough 为 nil 时与 ChainGetter 相同；对所有错误都返回 true 时，任何一层失败都会尝试下一层。
+// 某一层失败之后，即使之后的层都返回 ErrNotFound，结果仍然是第一个失败的错误，
+// 避免暂时性的故障被当作 key 不存在而写入负缓存。上下文结束之后不再尝试之后的层。
+// 返回的错误包装了失败的那一层的错误，并带有它在链中的位置。
+//
+// 参数:
+//
+//	fallThrough: 对 ErrNotFound 以外的错误返回 true 时尝试下一层，会被并发调用。
+//	getters: 按顺序尝试的数据源，每一个都可以是 Getter、ContextGetter 或 RichGetter。
+//
+// 返回值:
+//
+//	*ChainedGetter: 可以作为 NewGroup 的 getter 使用。
+func FallbackGetter(fallThrough func(err error) bool, getters ...any) *ChainedGetter {
+	if len(getters) == 0 {
+		panic("geecache: ChainGetter needs at least one getter")
+	}
+	c := &ChainedGetter{tiers: make([]RichGetter, len(getters)), fallThrough: fallThrough}
+	for i, getter := range getters {
+		c.tiers[i] = richGetter(getter)
+	}
+	return c
+}
+
+// Get 实现了 RichGetter 接口，依次尝试每一层，直到某一层返回数据或返回需要立即失败的错误。
+func (c *ChainedGetter) Get(ctx context.Context, key string) ([]byte, CacheOptions, error) {
+	served := chainTier(ctx)
+	if served != nil {
+		// 嵌套的 ChainedGetter 不能覆盖外层记录的位置
+		ctx = context.WithValue(ctx, chainTierKey{}, (*int)(nil))
+	}
+	var failed, notFound error
+	for i, tier := range c.tiers {
+		b, opts, err := tier.Get(ctx, key)
+		if err == nil {
+			if served != nil {
+				*served = i
+			}
+			return b, opts, nil
+		}
+		if errors.Is(err, ErrNotFound) {
+			notFound = err
+		} else {
+			err = fmt.Errorf("geecache: chain tier %d: %w", i, err)
+			if failed == nil {
+				failed = err
+			}
+			if c.fallThrough == nil || !c.fallThrough(err) {
+				return nil, CacheOptions{}, failed
+			}
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil && i < len(c.tiers)-1 {
+			// 之后的层没有尝试过，不能断定 key 不存在
+			return nil, CacheOptions{}, cmp.Or(failed, ctxErr)
+		}
+	}
+	return nil, CacheOptions{}, cmp.Or(failed, notFound)
+}
+
+// chainTierKey 是 Group 在上下文中保存 ChainedGetter 提供数据的层的位置时使用的 key。
+type chainTierKey struct{}
+
+// chainTier 返回 Group 放在 ctx 中、用于接收提供数据的层的位置的变量，没有时返回 nil。
+func chainTier(ctx context.Context) *int {
+	served, _ := ctx.Value(chainTierKey{}).(*int)
+	return served
+}
+
+// callChain 调用作为 getter 的 ChainedGetter，并把提供数据的层计入 Group.ChainLoads。
+func (g *Group) callChain(ctx context.Context, key string) ([]byte, CacheOptions, error) {
+	served := -1
+	b, opts, err := g.getter.Get(context.WithValue(ctx, chainTierKey{}, &served), key)
+	if err == nil && served >= 0 {
+		g.stats.chainLoads[served].Add(1)
+	}
+	return b, opts, err
+}
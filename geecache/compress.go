@@ -0,0 +1,101 @@
+package geecache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultCompressThreshold 是响应体默认的压缩阈值，见 HTTPPoolOptions.CompressThreshold。
+const defaultCompressThreshold = 1 << 10
+
+// gzipWriters 复用压缩响应体使用的 gzip.Writer。
+var gzipWriters = sync.Pool{
+	New: func() any {
+		w, _ := gzip.NewWriterLevel(io.Discard, gzip.BestSpeed)
+		return w
+	},
+}
+
+// writeBody 把 b 作为响应体写入 w，并设置 Content-Type 和 Content-Length。
+//
+// 启用压缩、b 不小于阈值并且请求方的 Accept-Encoding 接受 gzip 时，响应体以 gzip 压缩；
+// 压缩之后没有变小的值（例如已经压缩过的数据）仍然原样发送。
+func (h *HTTPPool) writeBody(w http.ResponseWriter, r *http.Request, contentType string, b []byte) {
+	w.Header().Set("Content-Type", contentType)
+	if h.compress && len(b) >= h.compressMin {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if acceptsGzip(r) {
+			if z := gzipBytes(b); len(z) < len(b) {
+				w.Header().Set("Content-Encoding", "gzip")
+				b = z
+			}
+		}
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.Write(b)
+}
+
+// gzipBytes 返回 b 以 gzip 压缩之后的字节。
+func gzipBytes(b []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzipWriters.Get().(*gzip.Writer)
+	zw.Reset(&buf)
+	zw.Write(b)
+	zw.Close()
+	gzipWriters.Put(zw)
+	return buf.Bytes()
+}
+
+// acceptsGzip 报告请求方的 Accept-Encoding 是否接受 gzip，q=0 表示不接受。
+func acceptsGzip(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept-Encoding") {
+		for _, t := range strings.Split(accept, ",") {
+			coding, params, _ := strings.Cut(strings.TrimSpace(t), ";")
+			if strings.TrimSpace(coding) != "gzip" {
+				continue
+			}
+			q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+			if !ok {
+				return true
+			}
+			v, err := strconv.ParseFloat(q, 64)
+			return err == nil && v > 0
+		}
+	}
+	return false
+}
+
+// gzipBody 在读取时解压 gzip 压缩的响应体，关闭时同时关闭原始的响应体。
+type gzipBody struct {
+	zr   *gzip.Reader
+	body io.ReadCloser
+}
+
+func (g *gzipBody) Read(p []byte) (int, error) {
+	return g.zr.Read(p)
+}
+
+func (g *gzipBody) Close() error {
+	g.zr.Close()
+	return g.body.Close()
+}
+
+// decompress 把以 gzip 压缩的 rsp 的响应体替换为解压之后的内容，之后的读取与未压缩的响应相同。
+func decompress(rsp *http.Response) error {
+	zr, err := gzip.NewReader(rsp.Body)
+	if err != nil {
+		rsp.Body.Close()
+		return err
+	}
+	rsp.Body = &gzipBody{zr: zr, body: rsp.Body}
+	rsp.Header.Del("Content-Encoding")
+	rsp.Header.Del("Content-Length")
+	rsp.ContentLength = -1
+	rsp.Uncompressed = true
+	return nil
+}
@@ -0,0 +1,139 @@
+package geecache
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+)
+
+var (
+	poolsMu sync.Mutex
+	// published 记录传入 PublishExpvar 的 HTTPPool，按 self 索引，Close 时移除。
+	published = make(map[string]*HTTPPool)
+
+	publishOnce sync.Once
+)
+
+// PublishExpvar 通过 expvar 导出所有 Group 和 HTTPPool 的计数，可以在标准的 /debug/vars 中查看。
+//
+// 它注册两个变量：geecache.groups 按 group 名称列出默认的 Registry 中每个 Group 的计数，
+// geecache.pools 按节点地址列出传入的每个 HTTPPool 的计数。变量的值在每次读取时
+// 从 Group.Stats、Group.CacheStats、Group.ChainLoads 和 HTTPPool.Stats 中重新收集，
+// 因此之后创建的 Group 会自动出现，已销毁的 Group 则不再出现；HTTPPool 在 Close 或 Shutdown 之后不再出现。
+// 多次调用 PublishExpvar 只注册一次变量，每次传入的 HTTPPool 都会加入 geecache.pools。
+//
+// 参数:
+//
+//	pools: 要导出计数的 HTTPPool，同一个地址的 HTTPPool 以最后传入的为准。
+func PublishExpvar(pools ...*HTTPPool) {
+	publishOnce.Do(func() {
+		expvar.Publish("geecache.groups", expvar.Func(groupVars))
+		expvar.Publish("geecache.pools", expvar.Func(poolVars))
+	})
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+	for _, p := range pools {
+		published[p.self] = p
+	}
+}
+
+// unpublishPool 把 h 从 geecache.pools 中移除，同一个地址之后传入的其他 HTTPPool 不受影响。
+func unpublishPool(h *HTTPPool) {
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+	if published[h.self] == h {
+		delete(published, h.self)
+	}
+}
+
+// groupVars 返回 geecache.groups 的值。
+func groupVars() any {
+	return registryVars(defaultRegistry)
+}
+
+// registryVars 按 group 名称返回 r 中每个 Group 的计数，geecache.groups 和 HTTPPool 的统计接口共用它。
+func registryVars(r *Registry) map[string]map[string]int64 {
+	snapshot := r.snapshot()
+	vars := make(map[string]map[string]int64, len(snapshot))
+	for _, g := range snapshot {
+		s := g.Stats()
+		c := g.CacheStats()
+		vars[g.name] = map[string]int64{
+			"gets":            s.Gets,
+			"hits":            s.MainCacheHits + s.HotCacheHits,
+			"main_cache_hits": s.MainCacheHits,
+			"hot_cache_hits":  s.HotCacheHits,
+			"negative_hits":   s.NegativeHits,
+			"loads":           s.Loads,
+			"loads_deduped":   s.LoadsDeduped,
+			"local_loads":     s.LocalLoads,
+			"peer_loads":      s.PeerLoads,
+			"errors":          s.LocalLoadErrs + s.PeerErrors,
+			"local_load_errs": s.LocalLoadErrs,
+			"peer_errors":     s.PeerErrors,
+			"getter_panics":   s.GetterPanics,
+			"loads_in_flight": s.LoadsInFlight,
+			"load_rejections": s.LoadRejections,
+			"batch_loads":     s.BatchLoads,
+			"stale_serves":    s.StaleServes,
+			"revalidations":   s.Revalidations,
+			"not_modified":    s.NotModified,
+			"hedges":          s.Hedges,
+			"hedge_wins":      s.HedgeWins,
+			"server_requests": s.ServerRequests,
+			"cache_bytes":     c.Main.Bytes + c.Hot.Bytes,
+			"cache_entries":   int64(c.Main.Entries + c.Hot.Entries),
+			"main_bytes":      c.Main.Bytes,
+			"main_entries":    int64(c.Main.Entries),
+			"hot_bytes":       c.Hot.Bytes,
+			"hot_entries":     int64(c.Hot.Entries),
+			"evictions":       c.Main.Evictions + c.Hot.Evictions,
+		}
+		for i, n := range g.ChainLoads() {
+			vars[g.name][fmt.Sprintf("chain_tier_%d_loads", i)] = n
+		}
+	}
+	return vars
+}
+
+// poolVars 返回 geecache.pools 的值。
+func poolVars() any {
+	poolsMu.Lock()
+	snapshot := make([]*HTTPPool, 0, len(published))
+	for _, p := range published {
+		snapshot = append(snapshot, p)
+	}
+	poolsMu.Unlock()
+
+	out := make(map[string]poolStatsVars, len(snapshot))
+	for _, p := range snapshot {
+		out[p.self] = p.vars()
+	}
+	return out
+}
+
+// peerVars 是导出的一个远程节点的计数。
+type peerVars struct {
+	Fetches  int64        `json:"fetches"`
+	Errors   int64        `json:"errors"`
+	Breaker  BreakerState `json:"breaker"`
+	InFlight int64        `json:"in_flight"`
+	Retries  int64        `json:"retries"`
+}
+
+// poolStatsVars 是导出的一个 HTTPPool 的计数。
+type poolStatsVars struct {
+	Requests  int64               `json:"requests"`
+	Throttled int64               `json:"throttled"`
+	Peers     map[string]peerVars `json:"peers"`
+}
+
+// vars 从 HTTPPool.Stats 中收集 h 导出的计数。
+func (h *HTTPPool) vars() poolStatsVars {
+	s := h.Stats()
+	v := poolStatsVars{Requests: s.Requests, Throttled: s.Throttled, Peers: make(map[string]peerVars, len(s.Peers))}
+	for peer, ps := range s.Peers {
+		v.Peers[peer] = peerVars{Fetches: ps.Fetches, Errors: ps.Errors, Breaker: ps.Breaker, InFlight: ps.InFlight, Retries: ps.Retries}
+	}
+	return v
+}
@@ -1,8 +1,18 @@
 package geecache
 
 import (
-	"log"
+	"GeeCache/lru"
+	"GeeCache/singleflight"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Getter 接口定义了从数据源获取数据的回调。
@@ -32,174 +42,2275 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
+// ContextGetter 与 Getter 相同，但可以接收 Get 调用方的上下文，
+// 使数据源的加载能够响应取消并携带链路追踪等信息。
+type ContextGetter interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// ContextGetterFunc 类型是一个函数类型，它实现了 ContextGetter 接口。
+type ContextGetterFunc func(ctx context.Context, key string) ([]byte, error)
+
+// Get 实现了 ContextGetter 接口的 Get 方法。
+//
+// 参数:
+//
+//	ctx: 加载使用的上下文。
+//	key: 要获取数据的键。
+//
+// 返回值:
+//
+//	[]byte: 获取到的数据。
+//	error: 如果获取过程中发生错误，则返回错误信息。
+func (f ContextGetterFunc) Get(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
+// CacheOptions 是 RichGetter 随数据一起返回的缓存指令，零值表示按 Group 的配置缓存。
+type CacheOptions struct {
+	// TTL 是这个值的存活时间，小于等于 0 时使用 WithTTL 设置的默认值。
+	TTL time.Duration
+	// NoStore 表示这个值只返回给调用方，不写入任何缓存，也不会被请求它的其他节点缓存。
+	NoStore bool
+}
+
+// RichGetter 与 ContextGetter 相同，但可以为每个值返回缓存指令，
+// 例如数据源中的行自带过期时间时，让缓存的存活时间与它保持一致。
+// getter 同时满足多种接口时优先使用 RichGetter。
+type RichGetter interface {
+	Get(ctx context.Context, key string) (data []byte, opts CacheOptions, err error)
+}
+
+// RichGetterFunc 类型是一个函数类型，它实现了 RichGetter 接口。
+type RichGetterFunc func(ctx context.Context, key string) ([]byte, CacheOptions, error)
+
+// Get 实现了 RichGetter 接口的 Get 方法。
+//
+// 参数:
+//
+//	ctx: 加载使用的上下文。
+//	key: 要获取数据的键。
+//
+// 返回值:
+//
+//	[]byte: 获取到的数据。
+//	CacheOptions: 这个值的缓存指令。
+//	error: 如果获取过程中发生错误，则返回错误信息。
+func (f RichGetterFunc) Get(ctx context.Context, key string) ([]byte, CacheOptions, error) {
+	return f(ctx, key)
+}
+
+// getterAdapter 把 Getter 适配为忽略上下文、不返回缓存指令的 RichGetter。
+type getterAdapter struct {
+	getter Getter
+}
+
+// Get 实现了 RichGetter 接口，直接调用被适配的 Getter。
+func (a getterAdapter) Get(ctx context.Context, key string) ([]byte, CacheOptions, error) {
+	b, err := a.getter.Get(key)
+	return b, CacheOptions{}, err
+}
+
+// contextGetterAdapter 把 ContextGetter 适配为不返回缓存指令的 RichGetter。
+type contextGetterAdapter struct {
+	getter ContextGetter
+}
+
+// Get 实现了 RichGetter 接口，直接调用被适配的 ContextGetter。
+func (a contextGetterAdapter) Get(ctx context.Context, key string) ([]byte, CacheOptions, error) {
+	b, err := a.getter.Get(ctx, key)
+	return b, CacheOptions{}, err
+}
+
 // Group 是 GeeCache 的核心数据结构，负责与用户的交互，并且控制缓存值存储和获取的流程。
 // 一个 Group 可以被看作一个独立的缓存命名空间。
 type Group struct {
-	name      string
-	maincache cache
-	getter    Getter
-	peers     PeerPicker
+	name         string
+	cacheBytes   int64         // 主缓存与热点缓存合计的容量上限，0 表示不限制
+	maincache    cache         // 保存本节点负责的 key
+	hotcache     cache         // 保存从其他节点获取的热点 key，避免每次都发起远程请求
+	hotRate      int           // 从其他节点获取的值以 1/hotRate 的概率放入 hotcache，0 表示不启用
+	hotKeyQPS    int           // 每秒访问次数达到该值的远程 key 会被复制到 hotcache，0 表示不启用
+	hotKeyTTL    time.Duration // 热点 key 复制到 hotcache 后的存活时间
+	maxHotKeys   int           // 同时复制到 hotcache 的热点 key 的数量上限
+	hotKeys      *hotKeys      // 热点 key 统计器，未启用时为 nil
+	negcache     cache         // 保存数据源中不存在的 key 的墓碑条目
+	ttl          time.Duration // 加载到的值的存活时间，0 表示永不过期
+	softTTL      time.Duration // 加载到的值超过这个时间后在后台刷新，0 表示不启用
+	timeout      time.Duration // 一次加载允许的最长时间，0 表示不限制
+	retries      int           // 从远程节点获取失败时的最大重试次数
+	retryBase    time.Duration // 第一次重试之前的等待时间，之后每次翻倍
+	owners       int           // 远程获取时依次尝试的环上节点数量
+	fallback     time.Duration // 远程获取失败后在本地加载的值在 hotcache 中的存活时间，0 表示不缓存
+	refreshSem   chan struct{} // 限制同时进行的后台刷新数量
+	refreshing   sync.Map      // 正在后台刷新的 key，保证每个 key 同一时刻最多只有一次刷新
+	streaming    sync.Map      // 正在由 GetInto 以流的方式获取的 key，见 getStream
+	negTTL       time.Duration // 墓碑条目的存活时间，0 表示不启用负缓存
+	errTTL       time.Duration // 暂时性错误在负缓存中的存活时间，0 表示不缓存错误
+	getter       RichGetter    // Getter 和 ContextGetter 会被适配为 RichGetter
+	batch        BatchGetter   // getter 实现了 BatchGetter 时不为 nil，GetMulti 用它批量加载本节点的 key
+	peers        PeerPicker
+	loader       *singleflight.Group // 保证每个 key 同一时刻只有一次加载在进行
+	reloader     *singleflight.Group // 合并同一个 key 并发的 GetFresh，与 loader 分开以免共享到旧值
+	removals     removalGens         // 每个 key 的 RemoveLocal 和 GetFresh 的调用次数，与它们并发的加载结果不会被写入缓存
+	destroyed    atomic.Bool         // DestroyGroup 之后为 true，Get 返回 ErrGroupDestroyed
+	stats        groupStats
+	classify     func(err error) ErrorClass   // 决定加载失败的错误如何缓存，为 nil 时使用 defaultClassify
+	collector    MetricsCollector             // 为 nil 时使用 SetMetricsCollector 设置的全局收集器
+	filter       func(key string) bool        // 返回 false 的 key 不经过缓存，为 nil 时所有 key 都可以缓存
+	setter       Setter                       // Put 写穿的数据源，为 nil 时 Put 返回 ErrNoSetter
+	writeBack    *WriteBackQueue              // PutBack 使用的写回队列，未启用 WithWriteBack 时为 nil
+	logger       Logger                       // 为 nil 时使用 SetLogger 设置的全局 Logger
+	tracer       Tracer                       // 为 nil 时使用 SetTracer 设置的全局 Tracer
+	maxLoads     int                          // 同时调用 getter 的最大数量，0 表示不限制
+	loadQueue    int                          // 等待名额的加载的最大数量，小于 0 表示不限制
+	loadLimit    *loadLimiter                 // maxLoads 大于 0 时在 registerGroup 中创建
+	normalize    func(string) (string, error) // 返回 key 的规范形式，为 nil 时 key 原样使用
+	interceptors []Interceptor                // 按注册顺序包裹 GetContext 的查找过程，第一个在最外层
+	hedgeDelay   time.Duration                // 发出对冲请求之前等待的时间，为 0 时不对冲
+	maxHedges    int64                        // 同时进行的对冲请求的最大数量
+	hedging      atomic.Int64                 // 正在进行的对冲请求数量
+}
+
+// Stats 是 Group 各个处理阶段的计数，由 Group.Stats 返回。
+type Stats struct {
+	Gets           int64 // Get 和 GetContext 的调用次数
+	MainCacheHits  int64 // 在主缓存中命中的次数
+	HotCacheHits   int64 // 在热点缓存中命中的次数
+	NegativeHits   int64 // 在负缓存中命中墓碑条目的次数
+	ErrorCacheHits int64 // 在负缓存中命中缓存的 getter 错误的次数
+	Loads          int64 // 缓存未命中后需要加载的次数
+	LoadsDeduped   int64 // 经过 singleflight 合并之后实际执行的加载次数
+	LocalLoads     int64 // 调用 getter 成功的次数
+	LocalLoadErrs  int64 // 调用 getter 失败的次数
+	PeerLoads      int64 // 从远程节点获取成功的次数
+	PeerErrors     int64 // 从远程节点获取失败的次数
+	SecondaryLoads int64 // PeerLoads 中由第一个节点之后的候选节点提供的次数
+	ServerRequests int64 // 其他节点通过 HTTPPool 发来的请求次数
+	Bypasses       int64 // 被 WithCacheFilter 排除、不经过缓存直接加载的请求次数
+	HotKeys        int64 // 当前作为热点 key 复制到本地的 key 数量，是一个瞬时值而不是累计计数
+	PeerRetries    int64 // 从远程节点获取失败后重试的次数
+	PeerExhausted  int64 // 重试次数用完或时间不够仍然失败的远程获取次数
+	Refreshes      int64 // 超过软过期时间后发起的后台刷新次数
+	RefreshErrs    int64 // 失败的后台刷新次数
+	WriteBacks     int64 // 写回队列成功写回数据源的次数
+	WriteBackErrs  int64 // 写回队列重试用完之后仍然写回失败的次数
+	GetterPanics   int64 // getter 引发 panic 的次数，它们同时计入 LocalLoadErrs
+	LoadsInFlight  int64 // 当前正在调用 getter 的加载数量，是一个瞬时值而不是累计计数
+	LoadRejections int64 // 因 WithLoadQueueLimit 返回 ErrTooManyLoads 的加载次数
+	BatchLoads     int64 // GetMulti 调用 BatchGetter 的次数，其中的每个 key 仍然计入 LocalLoads 或 LocalLoadErrs
+	StaleServes    int64 // 加载失败之后按 WithStaleIfError 返回过期旧值的次数，共享同一次加载的调用者只计一次
+	Revalidations  int64 // Revalidate 向拥有者确认热点副本的次数
+	NotModified    int64 // Revalidations 中拥有者确认副本未改变、没有传输值的次数
+	Hedges         int64 // 按 WithHedging 向下一个节点发出对冲请求的次数
+	HedgeWins      int64 // Hedges 中对冲请求先于第一个拥有者成功的次数，它们同时计入 SecondaryLoads
 }
 
-var (
-	mu     sync.RWMutex
-	groups = make(map[string]*Group)
+// groupStats 是 Stats 的并发安全版本，各字段使用原子操作更新。
+type groupStats struct {
+	gets           atomic.Int64
+	mainCacheHits  atomic.Int64
+	hotCacheHits   atomic.Int64
+	negativeHits   atomic.Int64
+	errorCacheHits atomic.Int64
+	loads          atomic.Int64
+	loadsDeduped   atomic.Int64
+	localLoads     atomic.Int64
+	localLoadErrs  atomic.Int64
+	peerLoads      atomic.Int64
+	peerErrors     atomic.Int64
+	secondaryLoads atomic.Int64
+	serverRequests atomic.Int64
+	bypasses       atomic.Int64
+	peerRetries    atomic.Int64
+	peerExhausted  atomic.Int64
+	refreshes      atomic.Int64
+	refreshErrs    atomic.Int64
+	writeBacks     atomic.Int64
+	writeBackErrs  atomic.Int64
+	getterPanics   atomic.Int64
+	loadsInFlight  atomic.Int64
+	loadRejections atomic.Int64
+	batchLoads     atomic.Int64
+	staleServes    atomic.Int64
+	revalidations  atomic.Int64
+	notModified    atomic.Int64
+	hedges         atomic.Int64
+	hedgeWins      atomic.Int64
+	chainLoads     []atomic.Int64 // getter 是 ChainedGetter 时在 registerGroup 中按层数创建
+}
+
+const (
+	// defaultHotRate 是从其他节点获取的值被放入 hotcache 的默认概率的倒数。
+	defaultHotRate = 10
+	// hotCacheRatio 是 hotcache 容量占 cacheBytes 的比例的倒数。
+	hotCacheRatio = 8
+	// negCacheRatio 是 negcache 容量占 cacheBytes 的比例的倒数。
+	negCacheRatio = 16
+	// defaultPeerRetries 和 defaultRetryBase 是从远程节点获取失败时默认的重试次数和初始等待时间。
+	defaultPeerRetries = 2
+	defaultRetryBase   = 10 * time.Millisecond
+	// defaultOwners 是远程获取时默认依次尝试的环上节点数量。
+	defaultOwners = 2
+	// defaultFallbackTTL 是远程获取失败后在本地加载的值默认的缓存时间。
+	defaultFallbackTTL = time.Second
 )
 
-// NewGroup 创建并注册一个新的 Group 实例。
+// ErrNotFound 表示 key 在数据源中不存在。
+//
+// Getter 返回的错误满足 errors.Is(err, ErrNotFound) 时，
+// 启用了 WithNegativeTTL 的 Group 会把这次未命中缓存起来。
+// 这类错误在节点之间以 404 传递，非拥有者节点收到后同样返回满足
+// errors.Is(err, ErrNotFound) 的错误，而不会回退到本地的 Getter。
+var ErrNotFound = errors.New("geecache: key not found")
+
+// ErrGroupExists 表示已经存在同名的 Group，由 NewGroupStrict 返回。
+var ErrGroupExists = errors.New("geecache: group already exists")
+
+// ErrGroupDestroyed 表示 Group 已经被 DestroyGroup 销毁，不能再使用。
+var ErrGroupDestroyed = errors.New("geecache: group destroyed")
+
+// ErrLoadTimeout 表示加载超过了 WithLoadTimeout 设置的时间。
+// 它满足 errors.Is(err, context.DeadlineExceeded)。
+var ErrLoadTimeout error = loadTimeoutError{}
+
+// loadTimeoutError 是 ErrLoadTimeout 的类型。
+type loadTimeoutError struct{}
+
+// Error 实现了 error 接口。
+func (loadTimeoutError) Error() string {
+	return "geecache: load timed out"
+}
+
+// Is 使 errors.Is(ErrLoadTimeout, context.DeadlineExceeded) 成立。
+func (loadTimeoutError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+// Timeout 报告这是一个超时错误，与 net.Error 的约定相同。
+func (loadTimeoutError) Timeout() bool {
+	return true
+}
+
+// ErrValueTooLarge 表示值超过了 WithMaxValueBytes 设置的上限，不会被缓存或转发给其他节点。
+var ErrValueTooLarge = errors.New("geecache: value exceeds max value bytes")
+
+// ErrGetterPanic 表示 getter 在加载时引发了 panic。
 //
-// 此函数会检查提供的 getter 是否为 nil，如果是则会引发 panic。
-// 它会以并发安全的方式将新创建的 group 注册到全局的 groups 映射中。
-// 如果已存在同名 group，则会覆盖。
+// 加载返回的错误是 *GetterPanicError，它满足 errors.Is(err, ErrGetterPanic)，
+// 共享这次加载的所有调用者都会得到这个错误。
+var ErrGetterPanic = errors.New("geecache: getter panicked")
+
+// GetterPanicError 记录 getter 引发的 panic，由 Group 在恢复 panic 之后返回。
+type GetterPanicError struct {
+	Value any    // 传给 panic 的值
+	Stack []byte // 引发 panic 时 goroutine 的调用栈
+}
+
+// Error 实现了 error 接口。
+func (e *GetterPanicError) Error() string {
+	return fmt.Sprintf("geecache: getter panicked: %v", e.Value)
+}
+
+// Is 使 errors.Is(err, ErrGetterPanic) 成立。
+func (e *GetterPanicError) Is(target error) bool {
+	return target == ErrGetterPanic
+}
+
+// Unwrap 在传给 panic 的值是 error 时返回它。
+func (e *GetterPanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// notFoundError 是负缓存命中时返回的错误，保留了 Getter 原始的错误信息。
+type notFoundError string
+
+// Error 实现了 error 接口。
+func (e notFoundError) Error() string {
+	return string(e)
+}
+
+// Is 使 errors.Is(err, ErrNotFound) 对负缓存返回的错误成立。
+func (e notFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// GroupOption 用于在 NewGroup 时对 Group 进行可选配置。
+type GroupOption func(*Group)
+
+// WithCacheEvents 为 Group 的主缓存安装一个 lru.Events 事件钩子，
+// 可用于记录缓存的新增、命中、未命中和淘汰事件。
 //
 // 参数:
 //
-//	name: group 的唯一名称。
-//	cacheBytes: 分配给该 group 的缓存最大容量（字节）。
-//	getter: 当缓存未命中时，用于加载源数据的回调函数。
+//	events: 事件钩子的实现。
 //
 // 返回值:
 //
-//	*Group: 一个指向新创建的 Group 实例的指针。
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
-
-	if getter == nil {
-		panic(`geecache: nil Getter`)
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithCacheEvents(events lru.Events) GroupOption {
+	return func(g *Group) {
+		g.maincache.events = events
 	}
-	mu.Lock()
-	defer mu.Unlock()
+}
 
-	newGroup := &Group{
-		name:   name,
-		getter: getter,
-		maincache: cache{
-			cacheBytes: cacheBytes,
-		},
+// AutoShards 传给 WithShards 时，表示根据 GOMAXPROCS 自动选择分片数量。
+const AutoShards = -1
+
+// WithShards 将 Group 的主缓存拆分为 n 个分片，每个分片拥有独立的锁和
+// cacheBytes 的一份额度，用于降低热点 Group 上的锁竞争。
+// n 会被向上取整为 2 的幂，n 为 0 或 1 时不分片。
+// n 为 AutoShards 时使用不小于 GOMAXPROCS 的 2 的幂，但会保证每个分片
+// 至少有 minShardBytes 的额度，避免较小的缓存被切得过碎。
+//
+// 参数:
+//
+//	n: 分片数量，或 AutoShards。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithShards(n int) GroupOption {
+	return func(g *Group) {
+		g.maincache.shards = n
 	}
+}
 
-	groups[name] = newGroup
+// WithHotCacheRate 设置从其他节点获取的值被放入热点缓存的概率为 1/n。
+// n 为 1 时每个远程获取的值都会被缓存，n 小于 1 时关闭热点缓存。
+//
+// 参数:
+//
+//	n: 概率的倒数，默认为 10。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithHotCacheRate(n int) GroupOption {
+	return func(g *Group) {
+		if n < 1 {
+			n = 0
+		}
+		g.hotRate = n
+	}
+}
 
-	return newGroup
+// WithTTL 为 Group 设置默认的存活时间：每个值从被 getter 加载起 d 之后过期，
+// 过期的条目与未命中相同，下一次 Get 会重新加载它。
+//
+// 从其他节点获取的值沿用拥有者节点上剩余的存活时间，而不是重新开始计时，
+// 因此同一个值在所有节点上大致同时过期。Set 的 ttl 小于等于 0 时同样使用 d。
+//
+// 参数:
+//
+//	d: 存活时间，小于等于 0 时永不过期。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithTTL(d time.Duration) GroupOption {
+	return func(g *Group) {
+		if d < 0 {
+			d = 0
+		}
+		g.ttl = d
+	}
 }
 
-// GetGroup 根据名称从全局 `groups` 映射中获取一个 Group。
+// WithRefreshAhead 启用提前刷新：值从被加载起超过 soft 之后，Get 仍然立即返回缓存的值，
+// 同时在后台重新调用 getter 刷新它；刷新成功时替换缓存中的值，失败时保留原来的值。
+// 值在 hard 之后硬过期，与 WithTTL 相同，此时 Get 会同步地重新加载。
+// hard 会代替 WithTTL 设置的存活时间。
 //
-// 这是一个并发安全的只读操作。
+// 每个 key 同一时刻最多只有一次后台刷新，整个 Group 同时进行的后台刷新数量也有上限，
+// 超过上限时这次刷新会被跳过，由之后的 Get 再次触发。
 //
 // 参数:
 //
-//	name: 要获取的 group 的名称。
+//	soft: 开始后台刷新的时间，小于等于 0 或不小于 hard 时不启用提前刷新。
+//	hard: 值的存活时间，小于等于 0 时永不过期。
 //
 // 返回值:
 //
-//	*Group: 查找到的 Group 指针。如果未找到，则返回 nil。
-func GetGroup(name string) *Group {
-	mu.RLock()
-	defer mu.RUnlock()
-	g := groups[name]
-	return g
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithRefreshAhead(soft, hard time.Duration) GroupOption {
+	return func(g *Group) {
+		if hard < 0 {
+			hard = 0
+		}
+		g.ttl = hard
+		if soft <= 0 || (hard > 0 && soft >= hard) {
+			soft = 0
+		}
+		g.softTTL = soft
+	}
 }
 
-// Get 是 Group 的主要方法，用于根据 key 获取值。
+// WithOwnerCandidates 设置远程获取时依次尝试的环上节点数量。
 //
-// 它首先会尝试从主缓存 (maincache) 中获取值。如果缓存中不存在，
-// 它将调用 load 方法来从数据源加载数据。
+// 负责 key 的节点宕机时，如果每个节点都直接回退到本地的 getter，数据源会同时收到
+// 大量请求，key 的副本也会散落到所有节点上。注册的 PeerPicker 实现了 PeerListPicker 时，
+// 加载会先请求第一个拥有者，失败后再请求环上的下一个节点，全部失败之后才从本地加载；
+// 候选节点中遇到本节点时直接在本地加载。默认尝试 2 个节点。
 //
 // 参数:
 //
-//	key: 要获取值的键。
+//	n: 依次尝试的节点数量，小于等于 1 时只请求第一个拥有者。
 //
 // 返回值:
 //
-//	value: 查找到的值，类型为 ByteView。
-//	err: 如果在获取过程中发生错误，则返回错误信息。
-func (g *Group) Get(key string) (value ByteView, err error) {
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithOwnerCandidates(n int) GroupOption {
+	return func(g *Group) {
+		if n < 1 {
+			n = 1
+		}
+		g.owners = n
+	}
+}
 
-	if v, ok := g.maincache.get(key); ok {
-		log.Println("[GeeCache] hit")
-		return v, nil
+// WithFallbackTTL 设置远程获取失败、回退到本地 getter 加载的值的缓存时间。
+//
+// 本节点不是这些 key 的拥有者，因此它们不会写入 maincache，而是以不超过 d 的存活时间
+// 放入 hotcache：拥有者不可用期间不必每次都调用 getter，拥有者恢复之后本节点上的副本也会很快过期，
+// 集群中只有拥有者长期保存每个 key。默认为 1 秒。
+//
+// 参数:
+//
+//	d: 存活时间，小于等于 0 时回退加载的值不被缓存。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithFallbackTTL(d time.Duration) GroupOption {
+	return func(g *Group) {
+		if d < 0 {
+			d = 0
+		}
+		g.fallback = d
 	}
-	return g.load(key)
+}
 
+// WithPeerRetry 设置从远程节点获取失败时的重试策略：最多重试 retries 次，
+// 第 i 次重试之前等待大约 base*2^i，并加入随机抖动，避免多个节点同时重试。
+// 只有传输层错误（例如连接被重置）和 5xx 响应会被重试，ErrNotFound、ErrPeerInternal 等其他错误不会。
+// 重试受调用者 ctx 的截止时间约束，剩余时间不够等待下一次重试时直接放弃；
+// 重试用完之后与以前一样回退到本地的 getter。默认重试 2 次，初始等待 10ms。
+//
+// 参数:
+//
+//	retries: 最大重试次数，小于等于 0 时不重试。
+//	base: 第一次重试之前的等待时间，小于等于 0 时使用默认的 10ms。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithPeerRetry(retries int, base time.Duration) GroupOption {
+	return func(g *Group) {
+		if retries < 0 {
+			retries = 0
+		}
+		if base <= 0 {
+			base = defaultRetryBase
+		}
+		g.retries = retries
+		g.retryBase = base
+	}
 }
 
-// load 在缓存未命中时加载数据。
+// WithLoadTimeout 限制一次加载（包括从其他节点获取和调用 getter）的最长时间，
+// 避免挂起的 getter 或节点让 Get 永远等待。超时的 Get 返回 ErrLoadTimeout，
+// 共享同一次加载的其他调用者也会收到这个错误，之后的 Get 会重新发起加载。
 //
-// 目前它只调用 getLocally 从本地获取数据。
-// （在后续步骤中，这里将被扩展为可以从远程节点获取数据）。
+// 调用者的 ctx 带有更早的截止时间时，以 ctx 为准，它到期时 GetContext 返回 ctx.Err()。
+// 后台刷新同样受这个时间限制。
 //
 // 参数:
 //
-//	key: 要加载数据的键。
+//	d: 最长时间，小于等于 0 时不限制。
 //
 // 返回值:
 //
-//	value: 加载到的值。
-//	err: 如果加载过程中发生错误，则返回错误信息。
-func (g *Group) load(key string) (value ByteView, err error) {
-	if g.peers != nil {
-		if peerGetter, ok := g.peers.PickPeer(key); ok {
-			if v, err := g.getFromPeer(peerGetter, key); err == nil {
-				return v, nil
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithLoadTimeout(d time.Duration) GroupOption {
+	return func(g *Group) {
+		if d < 0 {
+			d = 0
+		}
+		g.timeout = d
+	}
+}
 
-			}
-			log.Println("[GeeCache] Failed to get from peer", err)
+// WithHotKeyQPS 启用热点 key 检测：Group 统计最近一秒内每个 key 被 Get 的次数，
+// 次数达到 qps 的远程 key 在下一次从其他节点获取后会被复制到本地的热点缓存，
+// 在 WithHotKeyTTL 设置的时间内直接由本节点返回，从而分散单个拥有者节点的压力。
+// 被复制的热点 key 不受 WithHotCacheRate 的概率限制。
+//
+// 参数:
+//
+//	qps: 判定为热点 key 的每秒访问次数，小于 1 时不启用。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithHotKeyQPS(qps int) GroupOption {
+	return func(g *Group) {
+		if qps < 1 {
+			qps = 0
 		}
-		log.Println("[GeeCache] Failed to get from peer, will try locally")
+		g.hotKeyQPS = qps
 	}
+}
 
-	return g.getLocally(key)
+// WithHotKeyTTL 设置热点 key 复制到本地后的存活时间，过期之后会重新从拥有者节点获取。
+// 较短的存活时间可以让拥有者节点上的更新更快地被看到。
+//
+// 参数:
+//
+//	d: 存活时间，小于等于 0 时使用默认的 1 秒。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithHotKeyTTL(d time.Duration) GroupOption {
+	return func(g *Group) {
+		if d <= 0 {
+			d = defaultHotKeyTTL
+		}
+		g.hotKeyTTL = d
+	}
 }
 
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
-	bytes, err := peer.Get(g.name, key)
-	if err != nil {
-		return ByteView{}, err
+// WithMaxHotKeys 限制同时复制到本地的热点 key 的数量，达到上限之后新的热点 key
+// 需要等已复制的 key 过期才会被复制。
+//
+// 参数:
+//
+//	n: 数量上限，小于 1 时使用默认的 64。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithMaxHotKeys(n int) GroupOption {
+	return func(g *Group) {
+		if n < 1 {
+			n = defaultMaxHotKeys
+		}
+		g.maxHotKeys = n
 	}
-	return ByteView{b: cloneBytes(bytes)}, err
+}
 
+// WithMaxValueBytes 限制单个值可以被缓存的最大字节数，避免某个异常的大值
+// 挤占整个 Group 的容量。超过上限的值仍会返回给 Get 的调用方，但不会被写入
+// 主缓存或热点缓存，本节点也会拒绝把它转发给其他节点。
+// GetInto 以流的方式读取的值超过上限时返回 ErrValueTooLarge，不会按拥有者声明的长度分配内存。
+// 被拒绝的次数记录在 TierStats.Rejected 中。
+//
+// 参数:
+//
+//	n: 单个值的最大字节数，小于等于 0 时不限制。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithMaxValueBytes(n int64) GroupOption {
+	return func(g *Group) {
+		if n < 0 {
+			n = 0
+		}
+		g.maincache.maxValueBytes = n
+		g.hotcache.maxValueBytes = n
+	}
 }
-func (g *Group) RegisterPeers(peers PeerPicker) {
-	if g.peers != nil {
-		panic("RegisterPeerPicker called more than once")
+
+// WithCacheFilter 设置判断 key 是否可以缓存的函数，用于排除每次请求都不同的 token
+// 或带有 nocache: 前缀之类天然不可缓存的 key，避免它们在 LRU 中来回挤占空间。
+//
+// fn 返回 false 的 key 在 Get 时跳过所有缓存层直接加载，加载结果不会写入任何缓存，
+// Set 也只会删除它的旧值。本节点作为拥有者为其他节点加载这类 key 时，
+// 会在响应中标记不可缓存，请求方同样不会把它放入热点缓存。
+//
+// 参数:
+//
+//	fn: 判断 key 是否可以缓存的函数，会被并发调用。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithCacheFilter(fn func(key string) bool) GroupOption {
+	return func(g *Group) {
+		g.filter = fn
 	}
-	g.peers = peers
 }
 
-// getLocally 调用用户提供的 getter 来获取源数据，并将其添加到缓存中。
+// WithNegativeTTL 启用负缓存：Getter 返回的错误被分类为 ErrorClassNotFound 时（默认是
+// 满足 errors.Is(err, ErrNotFound) 的错误，见 WithErrorClassifier），
+// 为该 key 记录一个存活 d 的墓碑条目，期间的 Get 直接返回错误而不再调用 Getter，
+// 避免对不存在的 key 的大量请求穿透到数据源。
+// 墓碑条目与值为空的正常条目相互独立，可以通过 RemoveLocal 提前删除。
 //
-// 它会调用 group 初始化时注册的 getter 函数来获取源数据。
-// 获取成功后，会将数据封装成 ByteView 并调用 populateCache 添加到缓存中。
+// 参数:
+//
+//	d: 墓碑条目的存活时间，小于等于 0 时不启用。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithNegativeTTL(d time.Duration) GroupOption {
+	return func(g *Group) {
+		if d < 0 {
+			d = 0
+		}
+		g.negTTL = d
+	}
+}
+
+// ErrorClass 是加载失败的错误的分类，决定错误是否以及如何被缓存，见 WithErrorClassifier。
+type ErrorClass int
+
+const (
+	// ErrorClassNotFound 表示 key 在数据源中不存在，错误按 WithNegativeTTL 记录为墓碑条目。
+	ErrorClassNotFound ErrorClass = iota
+	// ErrorClassTransient 表示暂时性的失败，例如数据源超时，错误按 WithErrorCacheTTL 缓存。
+	ErrorClassTransient
+	// ErrorClassFatal 表示不应缓存的错误，每次 Get 都会重新加载。
+	ErrorClassFatal
+)
+
+// String 返回错误分类的名称。
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorClassNotFound:
+		return "not-found"
+	case ErrorClassTransient:
+		return "transient"
+	case ErrorClassFatal:
+		return "fatal"
+	default:
+		return "unknown"
+	}
+}
+
+// WithErrorCacheTTL 启用错误缓存：getter 的错误被分类为 ErrorClassTransient 时，
+// 在负缓存中原样缓存这个错误 d，期间的 Get 直接返回它而不再调用 getter，
+// 避免数据源故障期间每个请求都去访问数据源。
+// 缓存的错误与墓碑条目一样独立于正常的值，过期之后或 Remove、RemoveLocal 之后会重新加载。
 //
 // 参数:
 //
-//	key: 要获取数据的键。
+//	d: 错误的缓存时间，小于等于 0 时不缓存错误。
 //
 // 返回值:
 //
-//	value: 从数据源获取到的值。
-//	err: 如果 getter 返回错误，则透传该错误。
-func (g *Group) getLocally(key string) (value ByteView, err error) {
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithErrorCacheTTL(d time.Duration) GroupOption {
+	return func(g *Group) {
+		if d < 0 {
+			d = 0
+		}
+		g.errTTL = d
+	}
+}
 
-	bytes, err := g.getter.Get(key)
-	if err != nil {
-		return ByteView{}, err
+// WithErrorClassifier 设置加载失败时错误的分类函数，由它决定错误作为墓碑条目缓存、
+// 作为暂时性错误缓存还是不缓存。默认把满足 errors.Is(err, ErrNotFound) 的错误归为
+// ErrorClassNotFound，其余错误归为 ErrorClassTransient。
+//
+// 参数:
+//
+//	fn: 错误的分类函数，会被并发调用。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithErrorClassifier(fn func(err error) ErrorClass) GroupOption {
+	return func(g *Group) {
+		g.classify = fn
 	}
+}
 
-	value = ByteView{b: cloneBytes(bytes)}
-	g.populateCache(key, value)
+// WithApproxLRU 让主缓存使用基于采样淘汰的 lru.Approx 代替精确的 lru.Cache，
+// 以减少超大缓存中每个条目的内存开销。与 WithShards 同时使用时以分片为准。
+//
+// 参数:
+//
+//	samples: 每次淘汰时采样的条目数，小于 1 时使用 lru.DefaultSamples。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithApproxLRU(samples int) GroupOption {
+	return func(g *Group) {
+		if samples < 1 {
+			samples = lru.DefaultSamples
+		}
+		g.maincache.approx = samples
+	}
+}
 
-	return value, nil
+// WithCost 使用自定义的开销函数为主缓存中的条目计费，代替默认的键和值长度之和。
+// 此时 cacheBytes 表示开销的上限，例如 cost 恒为 1 时即为条目数量的上限。
+//
+// 参数:
+//
+//	cost: 根据键和值计算条目开销的函数，对同一个条目必须返回相同的结果。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithCost(cost func(key string, value ByteView) int64) GroupOption {
+	return func(g *Group) {
+		g.maincache.cost = func(key string, value lru.Value) int64 {
+			return cost(key, value.(ByteView))
+		}
+	}
 }
 
-// populateCache 将一个键值对添加到 Group 的缓存中。
+// WithOnEvicted 设置主缓存和热点缓存中的条目因容量限制被淘汰时的回调函数，
+// 可用于把被淘汰的值交给写回流程。过期和主动删除不会触发它。
 //
-// 这是一个内部方法，用于将加载到的数据存入 maincache。
+// fn 在释放缓存锁之后、引起淘汰的那次写入返回之前调用，因此可以在其中访问同一个 Group；
+// 但并发写入时它可能被多个 goroutine 并发调用。同一次写入引起的淘汰按淘汰的先后顺序通知。
 //
 // 参数:
 //
-//	key: 要添加的键。
-//	value: 要添加的值。
-func (g *Group) populateCache(key string, value ByteView) {
-	g.maincache.add(key, value)
+//	fn: 接收被淘汰的键和值的回调函数。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithOnEvicted(fn func(key string, value ByteView)) GroupOption {
+	return func(g *Group) {
+		g.maincache.evicted = fn
+		g.hotcache.evicted = fn
+	}
+}
+
+// WithOnExpired 设置主缓存中的条目因过期被删除时的回调函数，
+// 无论删除发生在 Get 时的惰性检查还是后台 janitor 的清理中。
+// 与 WithOnEvicted 不同，回调在持有缓存锁时同步调用，不应在其中访问同一个 Group 的缓存。
+//
+// 参数:
+//
+//	fn: 接收过期的键和值的回调函数。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithOnExpired(fn func(key string, value ByteView)) GroupOption {
+	return func(g *Group) {
+		g.maincache.onExpired = func(key string, value lru.Value) {
+			fn(key, value.(ByteView))
+		}
+	}
+}
+
+// EvictionReason 表示条目离开缓存的原因。
+type EvictionReason int
+
+const (
+	// EvictionCapacity 表示条目因容量限制被淘汰。
+	EvictionCapacity EvictionReason = iota
+	// EvictionExpired 表示条目因过期被删除。
+	EvictionExpired
+	// EvictionRemoved 表示条目被 RemoveLocal 等方法主动删除。
+	EvictionRemoved
+)
+
+// String 返回淘汰原因的名称。
+func (r EvictionReason) String() string {
+	switch r {
+	case EvictionCapacity:
+		return "capacity"
+	case EvictionExpired:
+		return "expired"
+	case EvictionRemoved:
+		return "removed"
+	}
+	return "unknown"
+}
+
+// WithEvictionHandler 设置主缓存中的条目离开缓存时的通知函数，
+// 可用于记录日志或在写回场景中持久化被淘汰的值。
+//
+// 与 WithOnEvicted 一样，fn 在释放缓存锁之后调用，因此可以在其中访问同一个 Group；
+// 但它可能被多个 goroutine 并发调用。
+//
+// 参数:
+//
+//	fn: 接收离开缓存的键、值以及原因的函数。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithEvictionHandler(fn func(key string, value ByteView, reason EvictionReason)) GroupOption {
+	return func(g *Group) {
+		g.maincache.handler = fn
+	}
+}
+
+// WithJanitor 为主缓存启动一个后台清理任务，每隔 interval 删除一次已过期的条目。
+//
+// 参数:
+//
+//	interval: 清理间隔，小于等于 0 时不启动。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithJanitor(interval time.Duration) GroupOption {
+	return func(g *Group) {
+		g.maincache.janitor = interval
+	}
+}
+
+// NewGroup 创建并注册一个新的 Group 实例。
+//
+// getter 可以是 RichGetter、ContextGetter 或 Getter：实现了 RichGetter 时，
+// 它返回的 CacheOptions 决定每个值如何缓存；实现了 ContextGetter 时，
+// 加载会收到 GetContext 调用方的上下文；否则作为 Getter 调用，不接收上下文。
+// 如果 getter 为 nil 或三者都没有实现，则会引发 panic。
+// 它会以并发安全的方式将新创建的 group 注册到默认的 Registry 中，需要相互隔离的 Group 时使用 NewRegistry。
+// 如果已存在同名 group，则会引发 panic；需要替换时先调用 DestroyGroup。
+// 不希望 panic 时使用 NewGroupStrict，多处代码可能初始化同一个 group 时使用 GetOrCreateGroup。
+//
+// 参数:
+//
+//	name: group 的唯一名称。
+//	cacheBytes: 分配给该 group 的缓存最大容量（字节）。
+//	getter: 当缓存未命中时，用于加载源数据的 ContextGetter 或 Getter。
+//	opts: 可选的配置项。
+//
+// 返回值:
+//
+//	*Group: 一个指向新创建的 Group 实例的指针。
+func NewGroup(name string, cacheBytes int64, getter any, opts ...GroupOption) *Group {
+	return defaultRegistry.NewGroup(name, cacheBytes, getter, opts...)
+}
+
+// NewGroupStrict 与 NewGroup 相同，但已存在同名 group 时返回 ErrGroupExists 而不是引发 panic。
+//
+// 参数:
+//
+//	name: group 的唯一名称。
+//	cacheBytes: 分配给该 group 的缓存最大容量（字节）。
+//	getter: 当缓存未命中时，用于加载源数据的 ContextGetter 或 Getter。
+//	opts: 可选的配置项。
+//
+// 返回值:
+//
+//	*Group: 新创建的 Group；出错时为 nil。
+//	error: 已存在同名 group 时返回满足 errors.Is(err, ErrGroupExists) 的错误。
+func NewGroupStrict(name string, cacheBytes int64, getter any, opts ...GroupOption) (*Group, error) {
+	return defaultRegistry.NewGroupStrict(name, cacheBytes, getter, opts...)
+}
+
+// GetOrCreateGroup 返回名为 name 的 group，不存在时按给定的配置创建并注册一个。
+//
+// 查找和创建在同一把锁下完成，因此并发的初始化代码最终都会拿到同一个 Group。
+// group 已经存在时 cacheBytes、getter 和 opts 都会被忽略。
+//
+// 参数:
+//
+//	name: group 的唯一名称。
+//	cacheBytes: 创建 group 时分配的缓存最大容量（字节）。
+//	getter: 创建 group 时使用的 ContextGetter 或 Getter。
+//	opts: 创建 group 时的可选配置项。
+//
+// 返回值:
+//
+//	*Group: 已存在的或新创建的 Group。
+func GetOrCreateGroup(name string, cacheBytes int64, getter any, opts ...GroupOption) *Group {
+	return defaultRegistry.GetOrCreateGroup(name, cacheBytes, getter, opts...)
+}
+
+// richGetter 把 NewGroup 接收的 getter 统一为 RichGetter，getter 不合法时引发 panic。
+func richGetter(getter any) RichGetter {
+	switch getter := getter.(type) {
+	case nil:
+		panic(`geecache: nil Getter`)
+	case RichGetter:
+		return getter
+	case ContextGetter:
+		return contextGetterAdapter{getter: getter}
+	case Getter:
+		return getterAdapter{getter: getter}
+	default:
+		panic(fmt.Sprintf("geecache: %T implements none of Getter, ContextGetter and RichGetter", getter))
+	}
+}
+
+// registerGroup 创建 Group 并把它注册到 r 中。调用方需要持有 r.mu，并已确认 name 未被使用。
+func (r *Registry) registerGroup(name string, cacheBytes int64, loader RichGetter, opts []GroupOption) *Group {
+
+	newGroup := &Group{
+		name:       name,
+		getter:     loader,
+		loader:     &singleflight.Group{},
+		reloader:   &singleflight.Group{},
+		cacheBytes: cacheBytes,
+		maincache: cache{
+			cacheBytes: cacheBytes,
+		},
+		hotcache: cache{
+			cacheBytes: cacheBytes / hotCacheRatio,
+		},
+		hotRate:    defaultHotRate,
+		retries:    defaultPeerRetries,
+		retryBase:  defaultRetryBase,
+		owners:     defaultOwners,
+		fallback:   defaultFallbackTTL,
+		loadQueue:  -1,
+		hotKeyTTL:  defaultHotKeyTTL,
+		maxHotKeys: defaultMaxHotKeys,
+		negcache: cache{
+			cacheBytes: cacheBytes / negCacheRatio,
+		},
+	}
+	for _, opt := range opts {
+		opt(newGroup)
+	}
+	if newGroup.writeBack != nil {
+		newGroup.writeBack.start(newGroup)
+	}
+	newGroup.maincache.init()
+	newGroup.hotcache.init()
+	newGroup.negcache.init()
+	if newGroup.softTTL > 0 {
+		newGroup.refreshSem = make(chan struct{}, maxRefreshes)
+	}
+	if newGroup.hotKeyQPS > 0 {
+		newGroup.hotKeys = newHotKeys(newGroup.hotKeyQPS, newGroup.hotKeyTTL, newGroup.maxHotKeys)
+	}
+	if newGroup.maxLoads > 0 {
+		newGroup.loadLimit = newLoadLimiter(newGroup.maxLoads, newGroup.loadQueue)
+	}
+	newGroup.batch = asBatchGetter(loader)
+	if c, ok := loader.(*ChainedGetter); ok {
+		newGroup.stats.chainLoads = make([]atomic.Int64, len(c.tiers))
+	}
+
+	r.groups[name] = newGroup
+
+	return newGroup
+}
+
+// GetGroup 根据名称从默认的 Registry 中获取一个 Group。
+//
+// 这是一个并发安全的只读操作。
+//
+// 参数:
+//
+//	name: 要获取的 group 的名称。
+//
+// 返回值:
+//
+//	*Group: 查找到的 Group 指针。如果未找到，则返回 nil。
+func GetGroup(name string) *Group {
+	return defaultRegistry.GetGroup(name)
+}
+
+// DestroyGroup 从默认的 Registry 中删除名为 name 的 Group，并清空它的缓存。
+//
+// 销毁之后，通过之前的引用调用 Get 会返回 ErrGroupDestroyed，
+// HTTPPool 也不会再把请求交给它；之后可以用同一个名称重新创建 Group。
+// 写回队列中还没有写回的值会被丢弃，需要保留时先调用 WriteBackQueue.Flush。
+// name 不存在时什么也不做。
+//
+// 参数:
+//
+//	name: 要销毁的 group 的名称。
+func DestroyGroup(name string) {
+	defaultRegistry.DestroyGroup(name)
+}
+
+// destroy 把 Group 标记为已销毁，关闭写回队列并清空各层缓存。
+func (g *Group) destroy() {
+	g.destroyed.Store(true)
+	if g.writeBack != nil {
+		g.writeBack.close()
+	}
+	g.maincache.destroy()
+	g.hotcache.destroy()
+	g.negcache.destroy()
+}
+
+// ListGroups 返回默认的 Registry 中已注册的所有 Group 的名称，按字典序排列。
+//
+// 返回值:
+//
+//	[]string: group 名称列表。
+func ListGroups() []string {
+	return defaultRegistry.ListGroups()
+}
+
+// Get 是 Group 的主要方法，用于根据 key 获取值。
+//
+// 它首先会尝试从主缓存 (maincache) 和热点缓存 (hotcache) 中获取值。
+// 如果缓存中不存在，它将调用 load 方法来从远程节点或数据源加载数据。
+//
+// 参数:
+//
+//	key: 要获取值的键。
+//
+// 返回值:
+//
+//	value: 查找到的值，类型为 ByteView。
+//	err: 如果在获取过程中发生错误，则返回错误信息。
+func (g *Group) Get(key string) (value ByteView, err error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext 与 Get 相同，但可以通过 ctx 放弃缓存未命中时的加载。
+//
+// ctx 会被传递给远程节点的请求和 ContextGetter，ctx 结束时 GetContext 立即返回 ctx.Err()。
+// 传递给它们的上下文保留了发起加载的 ctx 中的值和截止时间，但不会随它一起被取消：
+// 如果其他调用者也在等待同一个 key 的加载，这次加载会继续为它们执行，
+// 只有当所有等待者都放弃，或者发起加载的 ctx 的截止时间到了时才会被取消。
+// 设置了 Tracer 时，每次调用都会在 ctx 中开始一个 SpanGet，加载过程中的 span 都是它的子 span。
+// WithInterceptor 设置的拦截器在 SpanGet 之内包裹缓存查找和加载。
+//
+// 参数:
+//
+//	ctx: 调用者的上下文。
+//	key: 要获取值的键。
+//
+// 返回值:
+//
+//	value: 查找到的值，类型为 ByteView。
+//	err: 如果在获取过程中发生错误或 ctx 已结束，则返回错误信息；Group 已被销毁时返回 ErrGroupDestroyed。
+func (g *Group) GetContext(ctx context.Context, key string) (value ByteView, err error) {
+	if g.destroyed.Load() {
+		return ByteView{}, ErrGroupDestroyed
+	}
+	key, err = g.canonicalKey(key)
+	if err != nil {
+		return ByteView{}, err
+	}
+	ctx, span := g.startSpan(ctx, SpanGet, SpanInternal, key)
+	defer func() { span.End(err) }()
+	if len(g.interceptors) > 0 {
+		return g.intercept(ctx, key)
+	}
+	return g.get(ctx, key)
+}
+
+// get 是 GetContext 在规范化 key 之后的查找过程：先查找缓存，未命中时加载。
+func (g *Group) get(ctx context.Context, key string) (ByteView, error) {
+	if v, ok, err := g.lookupCache(key); ok || err != nil {
+		return v, err
+	}
+	return g.load(ctx, key)
+}
+
+// GetInto 与 GetContext 相同，但把值写入 dest，调用方可以直接得到需要的类型。
+//
+// ByteViewSink 和 ProtoSink 可以不经复制地接收缓存中的数据，
+// 需要可修改的字节切片时使用 AllocatingByteSliceSink，它总会复制一份，
+// 因此修改得到的切片不会影响缓存中的值。
+//
+// dest 是 AllocatingByteSliceSink 或 WriterSink、key 没有缓存在本节点并且拥有者实现了 PeerGetterStream 时，
+// 值从拥有者的响应体直接读入 dest，不经过中间的缓冲区，见 getStream。
+// 按 WithHotCacheRate 被选中放入 hotcache 的值仍然按普通的方式获取，使 hotcache 的填充比例不受影响。
+//
+// 参数:
+//
+//	ctx: 调用者的上下文。
+//	key: 要获取值的键。
+//	dest: 接收值的 Sink。
+//
+// 返回值:
+//
+//	error: 获取失败或 dest 拒绝这个值时返回错误。
+func (g *Group) GetInto(ctx context.Context, key string, dest Sink) error {
+	if ss, ok := dest.(streamSetter); ok {
+		if g.hotRate > 0 && rand.IntN(g.hotRate) == 0 {
+			// 已经按 hotRate 抽中，acceptFromPeer 不再重复抽样
+			ctx = context.WithValue(ctx, hotCopyKey{}, true)
+		} else if handled, err := g.getStream(ctx, key, ss); handled {
+			return err
+		}
+	}
+	v, err := g.GetContext(ctx, key)
+	if err != nil {
+		return err
+	}
+	return setSinkView(dest, v)
+}
+
+// GetCached 只在本节点的主缓存和热点缓存中查找 key，不会调用 getter，也不会请求远程节点。
+//
+// 查找不会提升条目的 LRU 位置，也不计入统计信息，因此可以用来探测 key 是否已被缓存，
+// 例如决定是否需要预取，而不会影响缓存的淘汰顺序。
+//
+// 参数:
+//
+//	key: 要查找的键。
+//
+// 返回值:
+//
+//	ByteView: 缓存中的值。
+//	bool: 本节点缓存了该键时为 true；Group 已被销毁时总是 false。
+func (g *Group) GetCached(key string) (ByteView, bool) {
+	if g.destroyed.Load() {
+		return ByteView{}, false
+	}
+	key, err := g.canonicalKey(key)
+	if err != nil {
+		return ByteView{}, false
+	}
+	if v, ok := g.maincache.peek(key); ok {
+		return v, true
+	}
+	return g.hotcache.peek(key)
+}
+
+// lookupCache 依次在主缓存、热点缓存和负缓存中查找 key，并记录一次 Get。
+//
+// 返回值:
+//
+//	value: 命中时的值。
+//	ok: 在主缓存或热点缓存中命中时为 true。
+//	err: 命中负缓存的墓碑条目时返回的错误。
+func (g *Group) lookupCache(key string) (value ByteView, ok bool, err error) {
+	m := g.metrics()
+	g.stats.gets.Add(1)
+	m.IncGet(g.name)
+	if !g.cacheable(key) {
+		g.stats.bypasses.Add(1)
+		return ByteView{}, false, nil
+	}
+	if g.hotKeys != nil && g.peers != nil {
+		g.hotKeys.record(key)
+	}
+	if v, ok := g.maincache.get(key); ok {
+		g.stats.mainCacheHits.Add(1)
+		m.IncHit(g.name, TierMain)
+		g.logf("[GeeCache] hit")
+		g.maybeRefresh(key, v)
+		return v, true, nil
+	}
+	if v, ok := g.hotcache.get(key); ok {
+		g.stats.hotCacheHits.Add(1)
+		m.IncHit(g.name, TierHot)
+		g.logf("[GeeCache] hot hit")
+		return v, true, nil
+	}
+	if err := g.negativeHit(key); err != nil {
+		m.IncHit(g.name, TierNegative)
+		if v, ok := g.serveStale(key, err); ok {
+			return v, true, nil
+		}
+		return ByteView{}, false, err
+	}
+	return ByteView{}, false, nil
+}
+
+// load 在缓存未命中时加载数据。
+//
+// 如果 key 属于远程节点，会先尝试从该节点获取，失败时再调用 getFallback 从本地获取。
+// 同一个 key 的并发加载通过 singleflight 合并为一次，其余调用者等待并共享其结果和错误。
+// 调用者会在 ctx 结束时放弃等待并返回 ctx.Err()，共享的加载会继续为其他等待者执行，
+// 所有等待者都放弃后，加载使用的 context 会被取消。
+//
+// 参数:
+//
+//	ctx: 调用者的上下文。
+//	key: 要加载数据的键。
+//
+// 返回值:
+//
+//	value: 加载到的值。
+//	err: 如果加载过程中发生错误，则返回错误信息。
+func (g *Group) load(ctx context.Context, key string) (value ByteView, err error) {
+	g.stats.loads.Add(1)
+	viewi, err := g.loader.DoContext(ctx, key, func(ctx context.Context) (any, error) {
+		return g.loadOrStale(ctx, key, g.ownerFetch(key, false))
+	})
+	if err != nil {
+		return ByteView{}, err
+	}
+	return viewi.(ByteView), nil
+}
+
+// ownerFetch 返回从负责 key 的远程节点获取值的函数，key 属于本节点时返回 nil。
+// fresh 为 true 时要求拥有者跳过它的缓存重新加载，见 GetFresh。
+//
+// 注册的 PeerPicker 实现了 PeerListPicker 时，返回的函数按顺序请求最多 g.owners 个
+// 候选节点，直到某个节点成功或确认 key 不存在；否则只请求 PickPeer 选出的节点。
+// 设置了 WithHedging 时，前两个候选节点以对冲的方式请求，见 hedgedFetch。
+func (g *Group) ownerFetch(key string, fresh bool) peerFetch {
+	if g.peers == nil {
+		return nil
+	}
+	n := g.owners
+	if g.hedgeDelay > 0 {
+		n = max(n, 2)
+	}
+	var peers []PeerGetter
+	if lp, ok := g.peers.(PeerListPicker); ok && n > 1 {
+		peers = lp.PickPeers(key, n)
+	} else if peer, ok := g.peers.PickPeer(key); ok {
+		peers = []PeerGetter{peer}
+	}
+	if len(peers) == 0 {
+		return nil
+	}
+
+	fetches := make([]peerFetch, len(peers))
+	for i, peer := range peers {
+		fetches[i] = g.retryFetch(func(ctx context.Context) (ByteView, error) {
+			return g.getFromPeer(ctx, peer, key, fresh)
+		})
+	}
+	if g.hedgeDelay > 0 && len(fetches) > 1 {
+		// 前两个候选节点由对冲请求处理，第二个节点提供的结果由 hedgedFetch 计入 SecondaryLoads
+		fetches = append([]peerFetch{g.hedgedFetch(fetches[0], fetches[1])}, fetches[2:]...)
+	}
+	if len(fetches) == 1 {
+		return fetches[0]
+	}
+	return func(ctx context.Context) (ByteView, error) {
+		var err error
+		for i, fetch := range fetches {
+			var v ByteView
+			if v, err = fetch(ctx); err == nil {
+				if i > 0 {
+					g.stats.secondaryLoads.Add(1)
+				}
+				return v, nil
+			}
+			if errors.Is(err, ErrNotFound) || ctx.Err() != nil || i == len(fetches)-1 {
+				break
+			}
+			// 最后一次失败由 tryLoad 计数
+			g.stats.peerErrors.Add(1)
+			g.logf("[GeeCache] Failed to get from peer, will try the next owner: %v", err)
+		}
+		return ByteView{}, err
+	}
+}
+
+// peerFetch 从负责某个 key 的远程节点获取它的值。
+type peerFetch func(ctx context.Context) (ByteView, error)
+
+// doLoad 执行一次经过 singleflight 合并之后的加载。
+//
+// 设置了 WithLoadTimeout 时，加载超过这个时间就返回 ErrLoadTimeout，
+// 共享这次加载的所有等待者都会收到这个错误。不响应 ctx 的 getter 会在后台继续执行，
+// 它之后的结果仍然会被写入缓存。
+//
+// 参数:
+//
+//	ctx: 加载使用的上下文。
+//	key: 要加载数据的键。
+//	fetch: 从负责 key 的远程节点获取值的函数，key 属于本节点时为 nil。
+//
+// 返回值:
+//
+//	any: 加载到的 ByteView。
+//	error: 如果加载过程中发生错误，则返回错误信息。
+func (g *Group) doLoad(ctx context.Context, key string, fetch peerFetch) (any, error) {
+	g.stats.loadsDeduped.Add(1)
+	if g.timeout <= 0 {
+		return g.tryLoad(ctx, key, fetch)
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+	// ctx 也带有调用方的截止时间，只有 g.timeout 先到时才报告 ErrLoadTimeout
+	timedOut := func() bool {
+		return errors.Is(ctx.Err(), context.DeadlineExceeded) && parent.Err() == nil
+	}
+	type result struct {
+		v   any
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		v, err := g.tryLoad(ctx, key, fetch)
+		ch <- result{v, err}
+	}()
+	select {
+	case r := <-ch:
+		if r.err != nil && timedOut() {
+			return nil, ErrLoadTimeout
+		}
+		return r.v, r.err
+	case <-ctx.Done():
+		if timedOut() {
+			return nil, ErrLoadTimeout
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// tryLoad 是 doLoad 的实际加载过程。
+//
+// fetch 不为 nil 时先用它从远程节点获取，失败时再调用 getFallback 从本地获取；
+// 如果 ctx 已经结束，则不再回退到本地加载。远程节点返回 ErrNotFound 时直接
+// 返回该错误，并在启用了负缓存时在本节点记录墓碑条目。
+//
+// 参数:
+//
+//	ctx: 加载使用的上下文。
+//	key: 要加载数据的键。
+//	fetch: 从负责 key 的远程节点获取值的函数，key 属于本节点时为 nil。
+//
+// 返回值:
+//
+//	any: 加载到的 ByteView。
+//	error: 如果加载过程中发生错误，则返回错误信息。
+func (g *Group) tryLoad(ctx context.Context, key string, fetch peerFetch) (any, error) {
+	if fetch != nil {
+		removals := g.removals.load(key)
+		v, err := fetch(ctx)
+		if err == nil {
+			g.stats.peerLoads.Add(1)
+			return v, nil
+		}
+		if errors.Is(err, ErrNotFound) {
+			// 拥有者确认 key 不存在，这是一次成功的远程获取，不再回退到本地加载
+			g.stats.peerLoads.Add(1)
+			if g.removals.load(key) == removals {
+				g.populateNegative(ctx, key, err)
+			}
+			return nil, err
+		}
+		g.stats.peerErrors.Add(1)
+		if ctx.Err() != nil {
+			// 请求已被取消，不再回退到本地加载
+			return nil, ctx.Err()
+		}
+		g.logf("[GeeCache] Failed to get from peer, will try locally: %v", err)
+		return g.getFallback(ctx, key)
+	}
+
+	return g.getLocally(ctx, key)
+}
+
+// getFromPeer 从远程节点获取 key 对应的值。
+//
+// 获取成功后，被检测为热点的 key 会以 hotKeyTTL 的存活时间放入 hotcache，
+// 其余的值按 hotRate 的概率放入 hotcache，使频繁访问的远程 key 之后可以直接在本地命中。
+// 如果请求期间本节点执行过 RemoveLocal，获取到的可能是旧值，不会被放入 hotcache。
+//
+// 如果 peer 实现了 PeerTTLGetter，值沿用拥有者节点报告的剩余存活时间；
+// 否则按本 Group 的 WithTTL 从现在开始计时。
+//
+// 参数:
+//
+//	ctx: 加载使用的上下文。
+//	peer: 负责该 key 的远程节点。
+//	key: 要获取值的键。
+//	fresh: 为 true 时通过 PeerRefresher 要求拥有者重新加载，peer 没有实现它时发起普通的请求。
+//
+// 返回值:
+//
+//	ByteView: 获取到的值。
+//	error: 如果远程请求失败，则返回错误信息。
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string, fresh bool) (ByteView, error) {
+	removals := g.removals.load(key)
+	start := time.Now()
+	ctx, span := g.startSpan(ctx, SpanPeer, SpanClient, key)
+	r, err := requestPeer(ctx, peer, g.name, key, fresh)
+	span.End(err)
+	m := g.metrics()
+	if o, ok := m.(PeerRequestObserver); ok {
+		o.ObservePeerRequest(peerName(peer), time.Since(start), err)
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		if ctx.Err() == nil {
+			// 被取消的请求（例如对冲中落败的一方）不是节点的问题
+			m.IncPeerError(peerName(peer))
+		}
+		return ByteView{}, err
+	}
+	m.ObserveLoadDuration(g.name, SourcePeer, time.Since(start))
+	if err != nil {
+		return ByteView{}, err
+	}
+	if r.NoStore {
+		// 拥有者标记了不可缓存，只返回给调用方
+		return ByteView{b: r.Value, noStore: true}, nil
+	}
+	return g.acceptFromPeer(ctx, key, r, removals), nil
+}
+
+// requestPeer 按 peer 实现的接口向它请求 group 中 key 的值，fresh 见 getFromPeer。
+// 只有 peerValueGetter 和 PeerResultGetter 能报告值的版本号和 NoStore，返回的 PeerResult 中 Err 总是为 nil。
+func requestPeer(ctx context.Context, peer PeerGetter, group string, key string, fresh bool) (r PeerResult, err error) {
+	if p, ok := peer.(peerValueGetter); ok {
+		return p.getValue(ctx, group, key, fresh)
+	}
+	if p, ok := peer.(PeerRefresher); ok && fresh {
+		r.Value, r.TTL, err = p.GetFresh(ctx, group, key)
+		return r, err
+	}
+	if p, ok := peer.(PeerResultGetter); ok {
+		r, err = p.GetResult(ctx, group, key)
+		r.Err = nil
+		return r, err
+	}
+	switch p := peer.(type) {
+	case PeerTTLGetter:
+		r.Value, r.TTL, err = p.GetTTL(ctx, group, key)
+	default:
+		r.Value, err = peer.Get(ctx, group, key)
+	}
+	return r, err
+}
+
+// acceptFromPeer 把从远程节点获取到的数据封装为 ByteView，并按需放入 hotcache。
+//
+// 参数:
+//
+//	ctx: 获取使用的上下文，GetInto 已经抽中放入 hotcache 时带有 hotCopyKey。
+//	key: 值对应的键。
+//	r: 远程节点返回的结果。r.Value 按 PeerGetter 的约定归调用方所有，因此直接使用而不复制；
+//	   r.TTL 小于等于 0 时使用本 Group 的 WithTTL；r.Version 被保留在值中。
+//	removals: 发起请求之前 removals 的值，期间发生过删除时不写入 hotcache。
+//
+// 返回值:
+//
+//	ByteView: 封装好的值。
+func (g *Group) acceptFromPeer(ctx context.Context, key string, r PeerResult, removals uint64) ByteView {
+	ttl := r.TTL
+	if ttl <= 0 {
+		ttl = g.ttl
+	}
+	value := ByteView{b: r.Value, expire: expireAfter(ttl), version: r.Version}
+	if g.removals.load(key) != removals {
+		return value
+	}
+	if g.hotKeys != nil && g.hotKeys.hot(key) {
+		if expireAt, ok := g.hotKeys.replicate(key); ok {
+			replica := value
+			if replica.expire.IsZero() || expireAt.Before(replica.expire) {
+				replica.expire = expireAt
+			}
+			g.populateHotCache(key, replica)
+			return value
+		}
+	}
+	if g.hotRate > 0 && (ctx.Value(hotCopyKey{}) != nil || rand.IntN(g.hotRate) == 0) {
+		g.populateHotCache(key, value)
+	}
+	return value
+}
+
+// RegisterPeers 为 Group 注册用于选择远程节点的 PeerPicker，例如 HTTPPool。
+//
+// 注册之后，不属于本节点的 key 会先从负责它的远程节点获取。
+// 一个 Group 只能注册一次，重复调用会引发 panic。
+//
+// 参数:
+//
+//	peers: 根据 key 选择远程节点的 PeerPicker。
+func (g *Group) RegisterPeers(peers PeerPicker) {
+	if g.peers != nil {
+		panic("geecache: RegisterPeers called more than once")
+	}
+	g.peers = peers
+}
+
+// getLocally 调用用户提供的 getter 来获取源数据，并将其添加到缓存中。
+//
+// 它会调用 group 初始化时注册的 getter 函数来获取源数据。
+// 获取成功后，会将数据封装成 ByteView 并调用 populateCache 添加到缓存中。
+// 如果加载期间执行过 RemoveLocal，结果只返回给调用方而不写入缓存。
+//
+// 参数:
+//
+//	ctx: 加载使用的上下文。
+//	key: 要获取数据的键。
+//
+// 返回值:
+//
+//	value: 从数据源获取到的值。
+//	err: 如果 getter 返回错误，则透传该错误。
+func (g *Group) getLocally(ctx context.Context, key string) (value ByteView, err error) {
+
+	removals := g.removals.load(key)
+	value, err = g.fetchLocally(ctx, key)
+	if g.removals.load(key) != removals {
+		// 加载期间发生过删除，结果可能已经过时，只返回给调用方而不缓存
+		return value, err
+	}
+	if err != nil {
+		g.populateNegative(ctx, key, err)
+		return ByteView{}, err
+	}
+	value = g.populateCache(key, value)
+
+	return value, nil
+}
+
+// getFallback 在远程获取失败之后调用 getter 加载不属于本节点的 key。
+//
+// 与 getLocally 不同，加载到的值不会写入 maincache，避免多个节点同时保存同一个 key
+// 并在删除之后各自过时；启用了 WithFallbackTTL 时，值以不超过该时间的存活时间放入 hotcache。
+//
+// 参数:
+//
+//	ctx: 加载使用的上下文。
+//	key: 要获取数据的键。
+//
+// 返回值:
+//
+//	value: 从数据源获取到的值。
+//	err: 如果 getter 返回错误，则透传该错误。
+func (g *Group) getFallback(ctx context.Context, key string) (value ByteView, err error) {
+	removals := g.removals.load(key)
+	value, err = g.fetchLocally(ctx, key)
+	if g.removals.load(key) != removals {
+		return value, err
+	}
+	if err != nil {
+		g.populateNegative(ctx, key, err)
+		return ByteView{}, err
+	}
+	if g.fallback > 0 {
+		replica := value
+		if expireAt := now().Add(g.fallback); replica.expire.IsZero() || expireAt.Before(replica.expire) {
+			replica.expire = expireAt
+		}
+		g.populateHotCache(key, replica)
+	}
+	return value, nil
+}
+
+// fetchLocally 调用用户提供的 getter 获取源数据，但不写入缓存。
+//
+// 参数:
+//
+//	ctx: 传递给 ContextGetter 的上下文，已结束时不再调用 getter。
+//	key: 要获取数据的键。
+//
+// 返回值:
+//
+//	value: 从数据源获取到的值的拷贝，按 WithTTL 和 WithRefreshAhead 记录了过期和刷新时间。
+//	err: 如果 getter 返回错误，则透传该错误；getter 引发 panic 时返回 *GetterPanicError；
+//	     超过 WithMaxConcurrentLoads 的限制时返回 ErrTooManyLoads 或 ctx.Err()。
+func (g *Group) fetchLocally(ctx context.Context, key string) (value ByteView, err error) {
+	if err := ctx.Err(); err != nil {
+		return ByteView{}, err
+	}
+	if v, ok := g.writeBack.pending(key); ok {
+		// 数据源中还是旧值，使用还没有写回的值
+		return ByteView{b: v.b, expire: expireAfter(g.ttl)}, nil
+	}
+	batch := localBatchFrom(ctx)
+	if batch == nil {
+		if err := g.acquireLoad(ctx); err != nil {
+			return ByteView{}, err
+		}
+	}
+	start := time.Now()
+	ctx, span := g.startSpan(ctx, SpanLoad, SpanInternal, key)
+	var bytes []byte
+	var opts CacheOptions
+	if batch != nil {
+		// 名额由批量加载占用
+		bytes, err = batch.wait(ctx, key)
+	} else {
+		bytes, opts, err = g.callGetter(ctx, key)
+		g.releaseLoad()
+	}
+	span.End(err)
+	g.metrics().ObserveLoadDuration(g.name, SourceLocal, time.Since(start))
+	if err != nil {
+		g.stats.localLoadErrs.Add(1)
+		return ByteView{}, err
+	}
+	g.stats.localLoads.Add(1)
+	ttl := opts.TTL
+	if ttl <= 0 {
+		ttl = g.ttl
+	}
+	value = ByteView{b: cloneBytes(bytes), expire: expireAfter(ttl), noStore: opts.NoStore}
+	if g.softTTL > 0 {
+		value.stale = now().Add(g.softTTL)
+	}
+	return value, nil
+}
+
+// callGetter 调用 getter，并把 getter 引发的 panic 转换为 *GetterPanicError。
+//
+// getter 在 singleflight 的 goroutine 中执行，不恢复的 panic 会使整个进程退出，
+// 也会让等待这次加载的调用者永远等不到结果。
+func (g *Group) callGetter(ctx context.Context, key string) (b []byte, opts CacheOptions, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			g.stats.getterPanics.Add(1)
+			g.logf("[GeeCache] getter panicked loading %s: %v", key, v)
+			b, opts = nil, CacheOptions{}
+			err = &GetterPanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	if g.stats.chainLoads != nil {
+		return g.callChain(ctx, key)
+	}
+	return g.getter.Get(ctx, key)
+}
+
+// callBatchGetter 与 callGetter 相同，但调用 BatchGetter 一次加载 keys。
+func (g *Group) callBatchGetter(ctx context.Context, bg BatchGetter, keys []string) (m map[string][]byte, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			g.stats.getterPanics.Add(1)
+			g.logf("[GeeCache] batch getter panicked loading %d keys: %v", len(keys), v)
+			m, err = nil, &GetterPanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	return bg.GetMulti(ctx, keys)
+}
+
+// getForPeer 为其他节点的请求获取 key 对应的值。
+//
+// 本节点作为 key 的拥有者，只从本地缓存或数据源获取，不再向其他节点转发。
+// 代替其他节点加载的数据以“冷”方式写入缓存，在被再次读取之前不会挤占热点数据。
+// 第一个拥有者不是本节点时，本节点是 WithOwnerCandidates 的后备拥有者：Remove、Set 等操作只会发往
+// 第一个拥有者，值因此既不写入本节点的缓存，也标记为不应被请求方缓存。
+//
+// 参数:
+//
+//	ctx: 请求的上下文，会传递给 ContextGetter。
+//	key: 要获取值的键。
+//
+// 返回值:
+//
+//	value: 查找到的值。
+//	err: 如果 getter 返回错误，则透传该错误。
+func (g *Group) getForPeer(ctx context.Context, key string) (value ByteView, err error) {
+	if !g.cacheable(key) {
+		g.stats.bypasses.Add(1)
+		value, err = g.fetchLocally(ctx, key)
+		value.noStore = true
+		return value, err
+	}
+	if g.backupOwner(key) {
+		value, err = g.fetchLocally(ctx, key)
+		value.noStore = true
+		return value, err
+	}
+	if v, ok := g.maincache.get(key); ok {
+		g.maybeRefresh(key, v)
+		return v, nil
+	}
+	if err := g.negativeHit(key); err != nil {
+		return ByteView{}, err
+	}
+	removals := g.removals.load(key)
+	value, err = g.fetchLocally(ctx, key)
+	if g.removals.load(key) != removals {
+		// 与 getLocally 相同，加载期间发生过删除时只返回给请求方而不缓存
+		return value, err
+	}
+	if err != nil {
+		g.populateNegative(ctx, key, err)
+		return ByteView{}, err
+	}
+	return g.populateCacheCold(key, value), nil
+}
+
+// backupOwner 报告本节点是否只是 key 的后备拥有者，即注册的 PeerPicker 为 key 选出了其他节点。
+func (g *Group) backupOwner(key string) bool {
+	if g.peers == nil {
+		return false
+	}
+	_, ok := g.peers.PickPeer(key)
+	return ok
+}
+
+// cacheable 返回 key 是否允许被缓存，见 WithCacheFilter。
+func (g *Group) cacheable(key string) bool {
+	return g.filter == nil || g.filter(key)
+}
+
+// populateCache 将一个键值对添加到 Group 的缓存中。
+//
+// 这是一个内部方法，用于将加载到的数据存入 maincache。
+// 如果值过大无法缓存，只记录日志并跳过，不影响调用方拿到该值。
+//
+// 参数:
+//
+//	key: 要添加的键。
+//	value: 要添加的值，它记录的过期时间同时作为条目的过期时间。
+//
+// 返回值:
+//
+//	ByteView: 写入的值，带有新分配的版本号；没有写入时原样返回 value。
+func (g *Group) populateCache(key string, value ByteView) ByteView {
+	if value.noStore || !g.cacheable(key) {
+		return value
+	}
+	stored, err := g.maincache.update(key, false, g.maincache.nextVersion(value))
+	if err != nil {
+		g.logf("[GeeCache] skip caching %s: %v", key, err)
+		return value
+	}
+	g.enforceCacheBytes()
+	return stored
+}
+
+// populateHotCache 将从远程节点获取的键值对添加到 hotcache 中。
+//
+// 参数:
+//
+//	key: 要添加的键。
+//	value: 要添加的值。
+func (g *Group) populateHotCache(key string, value ByteView) {
+	if value.noStore || !g.cacheable(key) {
+		return
+	}
+	if g.cacheBytes != 0 && g.hotcache.maxBytes() == 0 {
+		// cacheBytes 太小，分不出热点缓存的额度
+		return
+	}
+	if err := g.hotcache.add(key, value, value.expire); err != nil {
+		return
+	}
+	g.enforceCacheBytes()
+}
+
+// enforceCacheBytes 保证主缓存与热点缓存合计不超过 cacheBytes。
+//
+// 与 groupcache 相同，超出时优先从主缓存淘汰；只有当热点缓存
+// 超过主缓存的 1/hotCacheRatio 时，才从热点缓存淘汰。
+func (g *Group) enforceCacheBytes() {
+	if g.cacheBytes == 0 {
+		return
+	}
+	for {
+		mainBytes := g.maincache.bytes()
+		hotBytes := g.hotcache.bytes()
+		if mainBytes+hotBytes <= g.cacheBytes {
+			return
+		}
+		victim := &g.maincache
+		if hotBytes > mainBytes/hotCacheRatio {
+			victim = &g.hotcache
+		}
+		if !victim.removeOldest() {
+			return
+		}
+	}
+}
+
+// negativeHit 检查 key 是否有未过期的墓碑条目或缓存的错误，并记录相应的命中次数。
+//
+// 参数:
+//
+//	key: 要检查的键。
+//
+// 返回值:
+//
+//	error: 命中墓碑条目时返回满足 errors.Is(err, ErrNotFound) 的错误，命中缓存的错误时
+//	返回 getter 当时返回的错误，否则为 nil。
+func (g *Group) negativeHit(key string) error {
+	if g.negTTL == 0 && g.errTTL == 0 {
+		return nil
+	}
+	v, ok := g.negcache.get(key)
+	if !ok {
+		return nil
+	}
+	if v.err != nil {
+		g.stats.errorCacheHits.Add(1)
+		g.logf("[GeeCache] error cache hit")
+		return v.err
+	}
+	g.stats.negativeHits.Add(1)
+	g.logf("[GeeCache] negative hit")
+	return notFoundError(v.String())
+}
+
+// populateNegative 按 err 的分类把加载失败记录到负缓存中。
+//
+// ErrorClassNotFound 的错误记录为存活 negTTL 的墓碑条目，ErrorClassTransient 的错误
+// 原样缓存 errTTL，ErrorClassFatal 的错误不缓存。ctx 已经结束时错误可能只是因为
+// 调用者放弃了加载，同样不缓存。
+//
+// 参数:
+//
+//	ctx: 加载使用的上下文。
+//	key: 加载失败的键。
+//	err: 加载返回的错误。
+func (g *Group) populateNegative(ctx context.Context, key string, err error) {
+	if ctx.Err() != nil || !g.cacheable(key) || errors.Is(err, ErrTooManyLoads) {
+		return
+	}
+	var v ByteView
+	var ttl time.Duration
+	switch g.classifyError(err) {
+	case ErrorClassNotFound:
+		v, ttl = ByteView{b: []byte(err.Error())}, g.negTTL
+	case ErrorClassTransient:
+		v, ttl = ByteView{b: []byte(err.Error()), err: err}, g.errTTL
+	}
+	if ttl == 0 {
+		return
+	}
+	if g.cacheBytes != 0 && g.negcache.maxBytes() == 0 {
+		// cacheBytes 太小，分不出负缓存的额度
+		return
+	}
+	if err := g.negcache.add(key, v, now().Add(ttl)); err != nil {
+		g.logf("[GeeCache] skip negative caching %s: %v", key, err)
+	}
+}
+
+// classifyError 返回 err 的分类，未设置 WithErrorClassifier 时使用 defaultClassify。
+func (g *Group) classifyError(err error) ErrorClass {
+	if g.classify != nil {
+		return g.classify(err)
+	}
+	return defaultClassify(err)
+}
+
+// defaultClassify 把满足 errors.Is(err, ErrNotFound) 的错误归为 ErrorClassNotFound，
+// 其余错误归为 ErrorClassTransient。
+func defaultClassify(err error) ErrorClass {
+	if errors.Is(err, ErrNotFound) {
+		return ErrorClassNotFound
+	}
+	return ErrorClassTransient
+}
+
+// populateCacheCold 以“冷”方式将一个键值对添加到 Group 的缓存中。
+//
+// 与 populateCache 相同，但新条目在被读取之前是最先被淘汰的，
+// 用于预热数据和代替其他节点加载的数据。
+//
+// 参数:
+//
+//	key: 要添加的键。
+//	value: 要添加的值。
+//
+// 返回值:
+//
+//	ByteView: 写入的值，带有新分配的版本号；没有写入时原样返回 value。
+func (g *Group) populateCacheCold(key string, value ByteView) ByteView {
+	if value.noStore || !g.cacheable(key) {
+		return value
+	}
+	stored, err := g.maincache.update(key, true, g.maincache.nextVersion(value))
+	if err != nil {
+		g.logf("[GeeCache] skip caching %s: %v", key, err)
+		return value
+	}
+	return stored
+}
+
+// RemoveLocal 从本节点的缓存中删除 key，不会通知其他节点。
+//
+// 适用于数据源中的数据被修改之后，使本节点缓存的旧值失效。
+// 该 key 上正在进行的加载也会被忘记，下一次 Get 会重新加载。
+//
+// 参数:
+//
+//	key: 要删除的键。
+//
+// 返回值:
+//
+//	bool: 如果本节点缓存了该键并已将其删除，则为 true。
+func (g *Group) RemoveLocal(key string) bool {
+	key, err := g.canonicalKey(key)
+	if err != nil {
+		return false
+	}
+	// 正在进行的加载可能读到的是旧数据，让之后的 Get 重新加载，
+	// 并阻止这些加载的结果被写回缓存
+	g.removals.bump(key)
+	g.loader.Forget(key)
+	g.forgetHotKey(key)
+	removed := g.maincache.delete(key)
+	removed = g.hotcache.delete(key) || removed
+	return g.negcache.delete(key) || removed
+}
+
+// Set 主动把 key 对应的值写入缓存，而不必等到下一次未命中时再调用 getter。
+//
+// 如果注册了节点并且 key 属于远程节点，值会通过 PeerSetter 转发给拥有者节点，
+// 同时删除本节点热点缓存中的旧副本；否则写入本节点的主缓存。
+// value 会被复制，调用方之后修改它不会影响缓存中的值。
+//
+// 参数:
+//
+//	key: 要写入的键。
+//	value: 要写入的值。
+//	ttl: 值的存活时间，小于等于 0 时使用拥有者节点上 WithTTL 设置的默认值，未设置时永不过期。
+//
+// 返回值:
+//
+//	error: 值超过 WithMaxValueBytes 的上限时返回 ErrValueTooLarge，超过缓存容量时返回
+//	lru.ErrEntryTooLarge，Group 已被销毁时返回 ErrGroupDestroyed，转发给拥有者节点失败时返回相应的错误。
+func (g *Group) Set(key string, value []byte, ttl time.Duration) error {
+	return g.SetContext(context.Background(), key, value, ttl)
+}
+
+// SetContext 与 Set 相同，但 ctx 结束时转发给拥有者节点的请求会被取消。
+func (g *Group) SetContext(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if g.destroyed.Load() {
+		return ErrGroupDestroyed
+	}
+	key, err := g.canonicalKey(key)
+	if err != nil {
+		return err
+	}
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(key); ok {
+			setter, ok := peer.(PeerSetter)
+			if !ok {
+				return fmt.Errorf("geecache: peer for %q does not support set", key)
+			}
+			if max := g.maincache.maxValueBytes; max > 0 && int64(len(value)) > max {
+				return ErrValueTooLarge
+			}
+			g.invalidate(key)
+			return setter.Set(ctx, g.name, key, value, ttl)
+		}
+	}
+	return g.setLocally(key, value, ttl)
+}
+
+// setLocally 把值写入本节点的主缓存，用于 Set 和来自其他节点的写入请求。
+//
+// 参数:
+//
+//	key: 要写入的键。
+//	value: 要写入的值，会被复制。
+//	ttl: 值的存活时间，小于等于 0 时使用 WithTTL 设置的默认值。
+//
+// 返回值:
+//
+//	error: 值过大无法缓存时返回错误，此时 key 原有的值也会被删除。
+func (g *Group) setLocally(key string, value []byte, ttl time.Duration) error {
+	g.invalidate(key)
+	if !g.cacheable(key) {
+		return nil
+	}
+	if ttl <= 0 {
+		ttl = g.ttl
+	}
+	view := ByteView{b: cloneBytes(value), expire: expireAfter(ttl)}
+	if _, err := g.maincache.update(key, false, g.maincache.nextVersion(view)); err != nil {
+		// 不能让旧值继续留在缓存中
+		g.maincache.delete(key)
+		return err
+	}
+	g.enforceCacheBytes()
+	return nil
+}
+
+// invalidate 使 key 在本节点上正在进行的加载失效，并删除热点缓存和负缓存中的旧副本。
+func (g *Group) invalidate(key string) {
+	g.removals.bump(key)
+	g.loader.Forget(key)
+	g.forgetHotKey(key)
+	g.hotcache.delete(key)
+	g.negcache.delete(key)
+}
+
+// forgetHotKey 取消 key 作为热点 key 的复制登记。
+func (g *Group) forgetHotKey(key string) {
+	if g.hotKeys != nil {
+		g.hotKeys.forget(key)
+	}
+}
+
+// hotKeyCount 返回当前复制到本地的热点 key 数量，未启用热点 key 检测时为 0。
+func (g *Group) hotKeyCount() int64 {
+	if g.hotKeys == nil {
+		return 0
+	}
+	return int64(g.hotKeys.len())
+}
+
+// Remove 在整个集群中使 key 失效。
+//
+// 如果注册了节点并且 key 属于远程节点，会先通过 PeerRemover 通知拥有者节点删除
+// 它缓存的权威副本，然后删除本节点的主缓存、热点缓存和负缓存中的 key。
+// 先删除远程副本可以避免并发的 Get 在两次删除之间把旧值重新取回本节点的热点缓存。
+// 无法通知拥有者节点时仍会完成本地删除，并返回该错误。
+//
+// 参数:
+//
+//	key: 要删除的键。
+//
+// 返回值:
+//
+//	error: 通知拥有者节点失败时返回错误信息。
+func (g *Group) Remove(key string) error {
+	return g.RemoveContext(context.Background(), key)
+}
+
+// RemoveContext 与 Remove 相同，但 ctx 结束时通知拥有者节点的请求会被取消，本地删除仍会完成。
+func (g *Group) RemoveContext(ctx context.Context, key string) error {
+	key, err := g.canonicalKey(key)
+	if err != nil {
+		return err
+	}
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(key); ok {
+			if remover, ok := peer.(PeerRemover); ok {
+				if err = remover.Remove(ctx, g.name, key); err != nil {
+					g.logf("[GeeCache] Failed to remove from peer %v", err)
+				}
+			} else {
+				err = fmt.Errorf("geecache: peer for %q does not support remove", key)
+			}
+		}
+	}
+	g.RemoveLocal(key)
+	return err
+}
+
+// Touch 刷新 key 的最近使用时间，而不读取它的值。
+//
+// 它会刷新本地主缓存中的条目；如果注册了节点并且 key 属于远程节点，
+// 还会通过 PeerToucher 通知拥有者节点，使权威副本保持活跃。
+// 转发失败只会记录日志。
+//
+// 参数:
+//
+//	key: 要刷新的键。
+//
+// 返回值:
+//
+//	bool: 如果本地或拥有者节点上存在该键，则为 true。
+func (g *Group) Touch(key string) bool {
+	return g.TouchContext(context.Background(), key)
+}
+
+// TouchContext 与 Touch 相同，但 ctx 结束时通知拥有者节点的请求会被取消。
+func (g *Group) TouchContext(ctx context.Context, key string) bool {
+	key, err := g.canonicalKey(key)
+	if err != nil {
+		return false
+	}
+	touched := g.maincache.touch(key)
+	touched = g.hotcache.touch(key) || touched
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(key); ok {
+			if toucher, ok := peer.(PeerToucher); ok {
+				found, err := toucher.Touch(ctx, g.name, key)
+				if err != nil {
+					g.logf("[GeeCache] Failed to touch peer %v", err)
+				}
+				touched = touched || found
+			}
+		}
+	}
+	return touched
+}
+
+// Stats 返回 Group 各个处理阶段计数的一份拷贝。
+//
+// 各个计数分别以原子操作读取，在并发访问时它们之间不保证是同一时刻的快照。
+//
+// 返回值:
+//
+//	Stats: 当前的计数。
+func (g *Group) Stats() Stats {
+	return Stats{
+		Gets:           g.stats.gets.Load(),
+		MainCacheHits:  g.stats.mainCacheHits.Load(),
+		HotCacheHits:   g.stats.hotCacheHits.Load(),
+		NegativeHits:   g.stats.negativeHits.Load(),
+		ErrorCacheHits: g.stats.errorCacheHits.Load(),
+		Loads:          g.stats.loads.Load(),
+		LoadsDeduped:   g.stats.loadsDeduped.Load(),
+		LocalLoads:     g.stats.localLoads.Load(),
+		LocalLoadErrs:  g.stats.localLoadErrs.Load(),
+		PeerLoads:      g.stats.peerLoads.Load(),
+		PeerErrors:     g.stats.peerErrors.Load(),
+		SecondaryLoads: g.stats.secondaryLoads.Load(),
+		ServerRequests: g.stats.serverRequests.Load(),
+		Bypasses:       g.stats.bypasses.Load(),
+		HotKeys:        g.hotKeyCount(),
+		PeerRetries:    g.stats.peerRetries.Load(),
+		PeerExhausted:  g.stats.peerExhausted.Load(),
+		Refreshes:      g.stats.refreshes.Load(),
+		RefreshErrs:    g.stats.refreshErrs.Load(),
+		WriteBacks:     g.stats.writeBacks.Load(),
+		WriteBackErrs:  g.stats.writeBackErrs.Load(),
+		GetterPanics:   g.stats.getterPanics.Load(),
+		LoadsInFlight:  g.stats.loadsInFlight.Load(),
+		LoadRejections: g.stats.loadRejections.Load(),
+		BatchLoads:     g.stats.batchLoads.Load(),
+		StaleServes:    g.stats.staleServes.Load(),
+		Revalidations:  g.stats.revalidations.Load(),
+		NotModified:    g.stats.notModified.Load(),
+		Hedges:         g.stats.hedges.Load(),
+		HedgeWins:      g.stats.hedgeWins.Load(),
+	}
+}
+
+// ChainLoads 返回 ChainedGetter 的每一层成功加载的次数，它们与 Stats 一起记录 Group 的加载情况。
+//
+// 返回值:
+//
+//	[]int64: 下标是层在链中的位置；getter 不是 ChainedGetter 时为 nil。
+func (g *Group) ChainLoads() []int64 {
+	if g.stats.chainLoads == nil {
+		return nil
+	}
+	loads := make([]int64, len(g.stats.chainLoads))
+	for i := range g.stats.chainLoads {
+		loads[i] = g.stats.chainLoads[i].Load()
+	}
+	return loads
+}
+
+// TierStats 描述 Group 中某一层缓存的使用情况。
+type TierStats struct {
+	Entries   int   // 当前的条目数量
+	Bytes     int64 // 当前已用的字节数
+	MaxBytes  int64 // 最大字节数，0 表示不限制容量
+	Hits      int64 // 命中次数
+	Misses    int64 // 未命中次数
+	Evictions int64 // 因容量限制被淘汰的条目数
+	Expired   int64 // 因过期被删除的条目数
+	Rejected  int64 // 因超过 WithMaxValueBytes 的上限被拒绝缓存的值的数量
+}
+
+// CacheStats 是 Group 各层缓存的统计信息，每一层单独报告。
+type CacheStats struct {
+	Main     TierStats // 主缓存，保存本节点负责的 key
+	Hot      TierStats // 热点缓存，保存从其他节点获取的 key
+	Negative TierStats // 负缓存，保存数据源中不存在的 key 的墓碑条目
+}
+
+// newTierStats 收集一层缓存的统计信息。
+func newTierStats(c *cache) TierStats {
+	s := c.stats()
+	return TierStats{
+		Entries:   s.Entries,
+		Bytes:     s.Bytes,
+		MaxBytes:  s.MaxBytes,
+		Hits:      s.Hits,
+		Misses:    s.Misses,
+		Evictions: s.Evictions,
+		Expired:   s.Expired,
+		Rejected:  c.rejected.Load(),
+	}
+}
+
+// CacheStats 返回 Group 各层缓存当前的统计信息。
+//
+// 统计信息在缓存的锁内收集，尚未使用过的缓存除 MaxBytes 之外均为 0。
+//
+// 返回值:
+//
+//	CacheStats: 各层缓存的统计信息。
+func (g *Group) CacheStats() CacheStats {
+	return CacheStats{
+		Main:     newTierStats(&g.maincache),
+		Hot:      newTierStats(&g.hotcache),
+		Negative: newTierStats(&g.negcache),
+	}
+}
+
+// TierInfo 是 CacheInfo 中一层缓存的容量使用情况，可以直接编码为 JSON。
+type TierInfo struct {
+	Bytes     int64         `json:"bytes"`     // 当前已用的字节数
+	MaxBytes  int64         `json:"maxBytes"`  // 最大字节数，0 表示不限制容量
+	Entries   int           `json:"entries"`   // 当前的条目数量
+	OldestAge time.Duration `json:"oldestAge"` // 最久未使用的条目的闲置时长（纳秒），见 lru.Stats.OldestAge
+	Evictions int64         `json:"evictions"` // 创建以来因容量限制被淘汰的条目数
+}
+
+// CacheInfo 是 Group 各层缓存的容量使用报告，由 Group.CacheInfo 返回。
+type CacheInfo struct {
+	Main TierInfo `json:"main"` // 主缓存
+	Hot  TierInfo `json:"hot"`  // 热点缓存
+}
+
+// newTierInfo 收集一层缓存的容量使用情况。
+func newTierInfo(c *cache) TierInfo {
+	s := c.stats()
+	return TierInfo{
+		Bytes:     s.Bytes,
+		MaxBytes:  s.MaxBytes,
+		Entries:   s.Entries,
+		OldestAge: s.OldestAge,
+		Evictions: s.Evictions,
+	}
+}
+
+// CacheInfo 返回主缓存和热点缓存的容量使用报告，用于容量规划。
+//
+// 启用 WithShards 时每一层的数值由所有分片汇总，OldestAge 取各分片中最大的一个。
+// 每一层只在锁内读取一次计数，开销与 CacheStats 相同，适合由指标采集器周期性调用。
+//
+// 返回值:
+//
+//	CacheInfo: 各层缓存的容量使用情况。
+func (g *Group) CacheInfo() CacheInfo {
+	return CacheInfo{
+		Main: newTierInfo(&g.maincache),
+		Hot:  newTierInfo(&g.hotcache),
+	}
+}
+
+// Bytes 返回 Group 主缓存当前已用的字节数。
+func (g *Group) Bytes() int64 {
+	return g.maincache.bytes()
+}
+
+// MaxBytes 返回 Group 主缓存允许使用的最大字节数。
+func (g *Group) MaxBytes() int64 {
+	return g.maincache.maxBytes()
+}
+
+// SaveTo 将 Group 主缓存的快照保存到 path 指定的文件中。
+//
+// 快照先写入同目录下的临时文件，成功后再重命名为目标文件，
+// 避免进程中途退出留下不完整的快照。
+//
+// 参数:
+//
+//	path: 快照文件的路径。
+//
+// 返回值:
+//
+//	error: 创建、写入或重命名文件失败时返回错误。
+func (g *Group) SaveTo(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if err := g.maincache.save(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadFrom 从 path 指定的快照文件中恢复 Group 的主缓存。
+//
+// 参数:
+//
+//	path: 由 SaveTo 生成的快照文件路径。
+//
+// 返回值:
+//
+//	error: 打开或解析快照失败时返回错误。
+func (g *Group) LoadFrom(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return g.maincache.load(f)
 }
@@ -1,10 +1,26 @@
 package geecache
 
 import (
+	"GeeCache/lru"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"maps"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 var db = map[string]string{
@@ -13,6 +29,14 @@ var db = map[string]string{
 	"Sam":  "567",
 }
 
+// newTestGroup 创建一个 Group，并在测试结束时将其销毁，使 group 名称可以在测试之间重复使用。
+func newTestGroup(t testing.TB, name string, cacheBytes int64, getter any, opts ...GroupOption) *Group {
+	t.Helper()
+	g := NewGroup(name, cacheBytes, getter, opts...)
+	t.Cleanup(func() { DestroyGroup(name) })
+	return g
+}
+
 func TestGetter(t *testing.T) {
 	var f Getter = GetterFunc(func(key string) ([]byte, error) {
 		return []byte(key), nil
@@ -26,7 +50,7 @@ func TestGetter(t *testing.T) {
 
 func TestGet(t *testing.T) {
 	loadCounts := make(map[string]int, len(db))
-	gee := NewGroup("scores", 2<<10, GetterFunc(
+	gee := newTestGroup(t, "scores", 2<<10, GetterFunc(
 		func(key string) ([]byte, error) {
 			log.Println("[SlowDB] search key", key)
 			if v, ok := db[key]; ok {
@@ -55,7 +79,7 @@ func TestGet(t *testing.T) {
 
 func TestGetGroup(t *testing.T) {
 	groupName := "scores"
-	NewGroup(groupName, 2<<10, GetterFunc(
+	newTestGroup(t, groupName, 2<<10, GetterFunc(
 		func(key string) (bytes []byte, err error) { return }))
 	if group := GetGroup(groupName); group == nil || group.name != groupName {
 		t.Fatalf("group %s not exist", groupName)
@@ -65,3 +89,3092 @@ func TestGetGroup(t *testing.T) {
 		t.Fatalf("expect nil, but %s got", group.name)
 	}
 }
+
+func TestSaveToLoadFrom(t *testing.T) {
+	src := newTestGroup(t, "snapshot-src", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	for k := range db {
+		src.Get(k)
+	}
+
+	path := filepath.Join(t.TempDir(), "scores.snap")
+	if err := src.SaveTo(path); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	dst := newTestGroup(t, "snapshot-dst", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("unexpected load of %s", key)
+		}))
+	if err := dst.LoadFrom(path); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	for k, v := range db {
+		if view, err := dst.Get(k); err != nil || view.String() != v {
+			t.Fatalf("expect %s=%s from snapshot, got %v %v", k, v, view, err)
+		}
+	}
+}
+
+type countEvents struct {
+	mu                      sync.Mutex
+	adds, hits, misses, evs int
+}
+
+func (c *countEvents) OnAdd(key string, value lru.Value) { c.mu.Lock(); c.adds++; c.mu.Unlock() }
+func (c *countEvents) OnHit(key string)                  { c.mu.Lock(); c.hits++; c.mu.Unlock() }
+func (c *countEvents) OnMiss(key string)                 { c.mu.Lock(); c.misses++; c.mu.Unlock() }
+func (c *countEvents) OnEvict(key string, v lru.Value)   { c.mu.Lock(); c.evs++; c.mu.Unlock() }
+
+func TestCacheEvents(t *testing.T) {
+	ev := &countEvents{}
+	gee := newTestGroup(t, "events", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithCacheEvents(ev))
+
+	gee.Get("Tom")
+	gee.Get("Tom")
+	gee.Get("Jack")
+
+	if ev.adds != 2 || ev.hits != 1 || ev.misses != 2 || ev.evs != 0 {
+		t.Fatalf("unexpected events: %+v", ev)
+	}
+}
+
+func TestGroupBytes(t *testing.T) {
+	gee := newTestGroup(t, "bytes", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		}))
+	if gee.Bytes() != 0 || gee.MaxBytes() != 2<<10 {
+		t.Fatalf("unexpected initial bytes %d/%d", gee.Bytes(), gee.MaxBytes())
+	}
+	gee.Get("Tom")
+	if want := int64(len("Tom") + len(db["Tom"])); gee.Bytes() != want {
+		t.Fatalf("expect %d bytes, got %d", want, gee.Bytes())
+	}
+}
+
+type fakePicker struct {
+	peer PeerGetter
+}
+
+func (p fakePicker) PickPeer(key string) (PeerGetter, bool) {
+	return p.peer, p.peer != nil
+}
+
+type fakePeer struct {
+	touched   []string
+	removed   []string
+	removeErr error
+}
+
+func (p *fakePeer) Get(_ context.Context, group string, key string) ([]byte, error) {
+	return nil, fmt.Errorf("fake peer has no %s", key)
+}
+
+func (p *fakePeer) Touch(_ context.Context, group string, key string) (bool, error) {
+	p.touched = append(p.touched, key)
+	return true, nil
+}
+
+func (p *fakePeer) Remove(_ context.Context, group string, key string) error {
+	p.removed = append(p.removed, key)
+	return p.removeErr
+}
+
+func TestGroupRemove(t *testing.T) {
+	gee := newTestGroup(t, "remove", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	peer := &fakePeer{}
+	gee.RegisterPeers(fakePicker{peer: peer})
+	gee.populateCache("Tom", ByteView{b: []byte("630")})
+	gee.populateHotCache("Jack", ByteView{b: []byte("589")})
+
+	if err := gee.Remove("Tom"); err != nil {
+		t.Fatalf("remove Tom: %v", err)
+	}
+	peer.removeErr = fmt.Errorf("owner unreachable")
+	if err := gee.Remove("Jack"); err == nil {
+		t.Fatalf("expect owner failure to be reported")
+	}
+	if !reflect.DeepEqual(peer.removed, []string{"Tom", "Jack"}) {
+		t.Fatalf("expect removes forwarded to the owner, got %v", peer.removed)
+	}
+	if _, ok := gee.maincache.get("Tom"); ok {
+		t.Fatalf("expect Tom removed locally")
+	}
+	if _, ok := gee.hotcache.get("Jack"); ok {
+		t.Fatalf("expect Jack removed locally even though the owner failed")
+	}
+}
+
+// slowPeer 在 release 关闭之前阻塞 Get，用于模拟与删除并发的远程获取。
+type slowPeer struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (p *slowPeer) Get(_ context.Context, group string, key string) ([]byte, error) {
+	close(p.started)
+	<-p.release
+	return []byte("old"), nil
+}
+
+func TestRemoveDoesNotResurrectFromHotCache(t *testing.T) {
+	gee := newTestGroup(t, "remove-race", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithHotCacheRate(1))
+	peer := &slowPeer{started: make(chan struct{}), release: make(chan struct{})}
+	gee.RegisterPeers(fakePicker{peer: peer})
+
+	done := make(chan struct{})
+	go func() {
+		gee.Get("Tom")
+		close(done)
+	}()
+	<-peer.started
+	gee.RemoveLocal("Tom")
+	close(peer.release)
+	<-done
+
+	if _, ok := gee.hotcache.get("Tom"); ok {
+		t.Fatalf("expect value fetched before the remove not to be cached")
+	}
+}
+
+func TestGroupTouch(t *testing.T) {
+	gee := newTestGroup(t, "touch", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	if gee.Touch("Tom") {
+		t.Fatalf("expect Tom absent before load")
+	}
+	gee.Get("Tom")
+	if !gee.Touch("Tom") {
+		t.Fatalf("expect Tom touched locally")
+	}
+
+	peer := &fakePeer{}
+	gee.RegisterPeers(fakePicker{peer: peer})
+	if !gee.Touch("Jack") || !reflect.DeepEqual(peer.touched, []string{"Jack"}) {
+		t.Fatalf("expect touch forwarded to owner, got %v", peer.touched)
+	}
+}
+
+// countingPeer 是一个总能返回值的远程节点，记录每个 key 被请求的次数。
+type countingPeer struct {
+	gets map[string]int
+}
+
+func (p *countingPeer) Get(_ context.Context, group string, key string) ([]byte, error) {
+	p.gets[key]++
+	return []byte("remote-" + key), nil
+}
+
+func TestHotCache(t *testing.T) {
+	gee := newTestGroup(t, "hot", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s should be fetched from the peer", key)
+		}), WithHotCacheRate(1))
+	peer := &countingPeer{gets: map[string]int{}}
+	gee.RegisterPeers(fakePicker{peer: peer})
+
+	for i := 0; i < 5; i++ {
+		if view, err := gee.Get("Tom"); err != nil || view.String() != "remote-Tom" {
+			t.Fatalf("get Tom from peer failed: %v %v", view, err)
+		}
+	}
+	if peer.gets["Tom"] != 1 {
+		t.Fatalf("expect 1 peer call after hot cache populated, got %d", peer.gets["Tom"])
+	}
+	if st := gee.CacheStats(); st.Hot.Entries != 1 || st.Hot.Hits != 4 || st.Main.Entries != 0 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+
+	if !gee.RemoveLocal("Tom") {
+		t.Fatalf("expect Tom removed from hot cache")
+	}
+	gee.Get("Tom")
+	if peer.gets["Tom"] != 2 {
+		t.Fatalf("expect peer called again after removal, got %d", peer.gets["Tom"])
+	}
+}
+
+func TestHotCacheDisabled(t *testing.T) {
+	gee := newTestGroup(t, "hot-disabled", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s should be fetched from the peer", key)
+		}), WithHotCacheRate(0))
+	peer := &countingPeer{gets: map[string]int{}}
+	gee.RegisterPeers(fakePicker{peer: peer})
+	gee.Get("Tom")
+	gee.Get("Tom")
+	if peer.gets["Tom"] != 2 {
+		t.Fatalf("expect every get to reach the peer, got %d", peer.gets["Tom"])
+	}
+}
+
+func TestHotCacheSharesBudget(t *testing.T) {
+	gee := newTestGroup(t, "hot-budget", 64, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithHotCacheRate(1))
+	for _, k := range []string{"k0", "k1", "k2", "k3", "k4", "k5", "k6", "k7", "k8", "k9"} {
+		gee.populateCache(k, ByteView{b: []byte("1234")})
+	}
+	gee.populateHotCache("h1", ByteView{b: []byte("1234")})
+	if total := gee.maincache.bytes() + gee.hotcache.bytes(); total > 64 {
+		t.Fatalf("main and hot caches use %d bytes, want <= 64", total)
+	}
+	if _, ok := gee.hotcache.get("h1"); !ok {
+		t.Fatalf("expect main cache to yield room for a small hot cache")
+	}
+	if _, ok := gee.maincache.get("k0"); ok {
+		t.Fatalf("expect oldest main entry evicted")
+	}
+}
+
+func TestMaxValueBytes(t *testing.T) {
+	gee := newTestGroup(t, "max-value", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "blob" {
+				return make([]byte, 1<<10), nil
+			}
+			return []byte(db[key]), nil
+		}), WithMaxValueBytes(64))
+	gee.Get("Tom")
+
+	view, err := gee.Get("blob")
+	if err != nil || view.Len() != 1<<10 {
+		t.Fatalf("expect oversized value returned to the caller, got %d bytes %v", view.Len(), err)
+	}
+	if _, ok := gee.maincache.get("blob"); ok {
+		t.Fatalf("expect oversized value not cached")
+	}
+	if _, ok := gee.maincache.get("Tom"); !ok {
+		t.Fatalf("expect small values still cached")
+	}
+	gee.Get("blob")
+	if st := gee.CacheStats().Main; st.Rejected != 2 || st.Entries != 1 {
+		t.Fatalf("expect 2 rejected values, got %+v", st)
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	calls := 0
+	gee := newTestGroup(t, "negative", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			calls++
+			if key == "empty" {
+				return []byte{}, nil
+			}
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}), WithNegativeTTL(20*time.Millisecond))
+
+	for i := 0; i < 100; i++ {
+		if _, err := gee.Get("missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expect ErrNotFound, got %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expect a miss storm to call the getter once, got %d", calls)
+	}
+	if st := gee.CacheStats(); st.Negative.Entries != 1 || st.Main.Entries != 0 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+
+	if view, err := gee.Get("empty"); err != nil || view.Len() != 0 {
+		t.Fatalf("expect real empty value, got %v %v", view, err)
+	}
+	if _, err := gee.Get("empty"); err != nil || calls != 2 {
+		t.Fatalf("expect empty value served from main cache, got %v after %d calls", err, calls)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	gee.Get("missing")
+	if calls != 3 {
+		t.Fatalf("expect getter called again after tombstone expired, got %d", calls)
+	}
+
+	if !gee.RemoveLocal("missing") {
+		t.Fatalf("expect tombstone removed")
+	}
+	gee.Get("missing")
+	if calls != 4 {
+		t.Fatalf("expect getter called again after removal, got %d", calls)
+	}
+}
+
+func TestNegativeCacheIgnoresOtherErrors(t *testing.T) {
+	calls := 0
+	gee := newTestGroup(t, "negative-other", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			calls++
+			return nil, fmt.Errorf("database unavailable")
+		}), WithNegativeTTL(time.Minute))
+	gee.Get("Tom")
+	gee.Get("Tom")
+	if calls != 2 {
+		t.Fatalf("expect transient errors not cached, got %d calls", calls)
+	}
+}
+
+func TestEvictionHandler(t *testing.T) {
+	var gee *Group
+	var got []string
+	gee = newTestGroup(t, "eviction-handler", int64(len("k1v1k2v2")), GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("v" + key[1:]), nil
+		}), WithEvictionHandler(func(key string, value ByteView, reason EvictionReason) {
+		// 在持有缓存锁时调用会在这里死锁
+		gee.Bytes()
+		got = append(got, key+"="+value.String()+":"+reason.String())
+	}))
+	gee.Get("k1")
+	gee.Get("k2")
+	gee.Get("k3")
+	gee.maincache.add("k4", ByteView{b: []byte("v4")}, time.Now().Add(time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	gee.maincache.get("k4")
+	gee.RemoveLocal("k3")
+
+	expect := []string{"k1=v1:capacity", "k2=v2:capacity", "k4=v4:expired", "k3=v3:removed"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("expect %v, got %v", expect, got)
+	}
+}
+
+func TestEvictionHandlerSharded(t *testing.T) {
+	var gee *Group
+	var got []string
+	gee = newTestGroup(t, "eviction-handler-sharded", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithShards(4), WithEvictionHandler(func(key string, value ByteView, reason EvictionReason) {
+		gee.Bytes()
+		got = append(got, key+":"+reason.String())
+	}))
+	gee.maincache.add("Tom", ByteView{b: []byte("630")}, time.Now().Add(time.Millisecond))
+	gee.Get("Jack")
+	time.Sleep(5 * time.Millisecond)
+	gee.maincache.get("Tom")
+	gee.RemoveLocal("Jack")
+
+	if expect := []string{"Tom:expired", "Jack:removed"}; !reflect.DeepEqual(got, expect) {
+		t.Fatalf("expect %v, got %v", expect, got)
+	}
+}
+
+// setNow 把缓存使用的时钟固定在 t，并返回恢复真实时钟的函数。
+func setNow(t *time.Time) func() {
+	now = func() time.Time { return *t }
+	return func() { now = time.Now }
+}
+
+func TestCacheExpireAt(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer setNow(&clock)()
+
+	gee := newTestGroup(t, "expire-at", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	gee.populateCache("Tom", ByteView{b: []byte("630"), expire: now().Add(time.Minute)})
+	gee.populateCache("Jack", ByteView{b: []byte("589")})
+
+	v, ok := gee.maincache.get("Tom")
+	if !ok || !v.Expire().Equal(clock.Add(time.Minute)) {
+		t.Fatalf("expect Tom cached with its deadline, got %v %v", v.Expire(), ok)
+	}
+	clock = clock.Add(time.Minute)
+	if _, ok := gee.maincache.get("Tom"); ok {
+		t.Fatalf("expect Tom to miss at its deadline")
+	}
+	if gee.maincache.delete("Tom") {
+		t.Fatalf("expect expired Tom deleted by get")
+	}
+	if v, ok := gee.maincache.get("Jack"); !ok || !v.Expire().IsZero() {
+		t.Fatalf("expect Jack never to expire")
+	}
+
+	if err := gee.maincache.add("Sam", ByteView{b: []byte("567")}, clock.Add(-time.Second)); err != nil {
+		t.Fatalf("add expired value: %v", err)
+	}
+	if _, ok := gee.maincache.get("Sam"); ok {
+		t.Fatalf("expect already expired value not cached")
+	}
+}
+
+func TestGetSingleflight(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	gee := newTestGroup(t, "singleflight", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return []byte(db[key]), nil
+		}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if view, err := gee.Get("Tom"); err != nil || view.String() != "630" {
+				t.Errorf("get Tom failed: %v %v", view, err)
+			}
+		}()
+	}
+	// 等待所有 goroutine 都未命中并阻塞在同一次加载上
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("expect getter called once for concurrent gets, got %d", n)
+	}
+}
+
+func TestLoadDeadline(t *testing.T) {
+	release := make(chan struct{})
+	gee := newTestGroup(t, "load-deadline", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			<-release
+			return []byte(db[key]), nil
+		}))
+
+	done := make(chan ByteView)
+	go func() {
+		view, _ := gee.load(context.Background(), "Tom")
+		done <- view
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := gee.load(ctx, "Tom"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect impatient caller to time out, got %v", err)
+	}
+
+	close(release)
+	if view := <-done; view.String() != "630" {
+		t.Fatalf("expect shared load to finish for the other caller, got %q", view)
+	}
+}
+
+func TestRemoveLocalForgetsLoad(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	gee := newTestGroup(t, "load-forget", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				<-release
+				return []byte("stale"), nil
+			}
+			return []byte("fresh"), nil
+		}))
+
+	done := make(chan struct{})
+	go func() {
+		gee.Get("Tom")
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	gee.RemoveLocal("Tom")
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "fresh" {
+		t.Fatalf("expect a fresh load after RemoveLocal, got %q %v", view, err)
+	}
+	close(release)
+	<-done
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("expect exactly one extra load, got %d", n)
+	}
+}
+
+func TestGetForPeerRacingRemove(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	gee := newTestGroup(t, "peer-remove-race", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "Tom" {
+				close(started)
+				<-release
+			}
+			return []byte("v:" + key), nil
+		}))
+
+	done := make(chan ByteView)
+	go func() {
+		view, _ := gee.getForPeer(context.Background(), "Tom")
+		done <- view
+	}()
+	<-started
+	gee.RemoveLocal("Tom")
+	close(release)
+	if view := <-done; view.String() != "v:Tom" {
+		t.Fatalf("expect the peer to get the loaded value, got %q", view)
+	}
+	if _, ok := gee.maincache.get("Tom"); ok {
+		t.Fatal("expect a load racing a delete not to be cached")
+	}
+	if _, err := gee.getForPeer(context.Background(), "Jack"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := gee.maincache.get("Jack"); !ok {
+		t.Fatal("expect loads of other keys to be cached")
+	}
+}
+
+type ctxKey struct{}
+
+func TestContextGetter(t *testing.T) {
+	var got any
+	gee := newTestGroup(t, "context-getter", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			got = ctx.Value(ctxKey{})
+			return []byte(db[key]), nil
+		}))
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "trace-42")
+	if view, err := gee.GetContext(ctx, "Tom"); err != nil || view.String() != "630" {
+		t.Fatalf("get Tom failed: %v %v", view, err)
+	}
+	if got != "trace-42" {
+		t.Fatalf("expect context value to reach the getter, got %v", got)
+	}
+}
+
+func TestContextGetterCancel(t *testing.T) {
+	gee := newTestGroup(t, "context-getter-cancel", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := gee.GetContext(ctx, "Tom"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestNewGroupRejectsUnknownGetter(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expect NewGroup to panic on a value that is not a getter")
+		}
+	}()
+	NewGroup("bad-getter", 2<<10, "not a getter")
+}
+
+func TestGroupSet(t *testing.T) {
+	calls := 0
+	gee := newTestGroup(t, "set", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			calls++
+			return []byte(db[key]), nil
+		}), WithMaxValueBytes(16))
+
+	value := []byte("computed")
+	if err := gee.Set("Tom", value, 0); err != nil {
+		t.Fatalf("set Tom: %v", err)
+	}
+	value[0] = 'X'
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "computed" || calls != 0 {
+		t.Fatalf("expect Set value served without the getter, got %q %v after %d calls", view, err, calls)
+	}
+
+	if err := gee.Set("Tom", make([]byte, 32), 0); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("expect ErrValueTooLarge, got %v", err)
+	}
+	if _, ok := gee.maincache.get("Tom"); ok {
+		t.Fatalf("expect rejected Set to drop the old value")
+	}
+
+	clock := time.Now()
+	defer setNow(&clock)()
+	gee.Set("Jack", []byte("589"), time.Minute)
+	clock = clock.Add(time.Minute)
+	if _, ok := gee.maincache.get("Jack"); ok {
+		t.Fatalf("expect Set value to expire after its ttl")
+	}
+}
+
+// keyPicker 只为 peers 中列出的 key 返回远程节点，其余 key 属于本节点。
+type keyPicker map[string]PeerGetter
+
+func (p keyPicker) PickPeer(key string) (PeerGetter, bool) {
+	peer, ok := p[key]
+	return peer, ok
+}
+
+func TestGroupStats(t *testing.T) {
+	gee := newTestGroup(t, "group-stats", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}), WithHotCacheRate(1))
+	gee.RegisterPeers(keyPicker{
+		"Jack": &countingPeer{gets: map[string]int{}},
+		"Sam":  &fakePeer{},
+	})
+
+	gee.Get("Tom")     // 本地加载
+	gee.Get("Tom")     // 主缓存命中
+	gee.Get("unknown") // 本地加载失败
+	gee.Get("Jack")    // 远程获取
+	gee.Get("Jack")    // 热点缓存命中
+	gee.Get("Sam")     // 远程获取失败后本地加载
+
+	expect := Stats{
+		Gets:          6,
+		MainCacheHits: 1,
+		HotCacheHits:  1,
+		Loads:         4,
+		LoadsDeduped:  4,
+		LocalLoads:    2,
+		LocalLoadErrs: 1,
+		PeerLoads:     1,
+		PeerErrors:    1,
+	}
+	if got := gee.Stats(); got != expect {
+		t.Fatalf("expect %+v, got %+v", expect, got)
+	}
+}
+
+func TestGetTooLarge(t *testing.T) {
+	gee := newTestGroup(t, "too-large", 16, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "big" {
+				return []byte("a value larger than the cache"), nil
+			}
+			return []byte(db[key]), nil
+		}))
+	gee.Get("Tom")
+	gee.Get("Sam")
+
+	view, err := gee.Get("big")
+	if err != nil || view.String() != "a value larger than the cache" {
+		t.Fatalf("expect oversized value returned uncached, got %v %v", view, err)
+	}
+	if _, ok := gee.maincache.get("Tom"); !ok {
+		t.Fatalf("oversized value should not wipe the cache")
+	}
+	if _, ok := gee.maincache.get("big"); ok {
+		t.Fatalf("oversized value should not be cached")
+	}
+}
+
+func TestShardedGroup(t *testing.T) {
+	loads := 0
+	gee := newTestGroup(t, "sharded", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte(db[key]), nil
+		}), WithShards(4))
+	if gee.maincache.sharded == nil {
+		t.Fatalf("expect WithShards to enable the sharded cache")
+	}
+	for k, v := range db {
+		if view, err := gee.Get(k); err != nil || view.String() != v {
+			t.Fatalf("failed to get value of %s", k)
+		}
+		gee.Get(k)
+	}
+	if loads != len(db) {
+		t.Fatalf("expect %d loads, got %d", len(db), loads)
+	}
+	if gee.MaxBytes() != 2<<10 {
+		t.Fatalf("expect MaxBytes %d, got %d", 2<<10, gee.MaxBytes())
+	}
+}
+
+func TestGroupCost(t *testing.T) {
+	gee := newTestGroup(t, "cost", 2, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		}), WithCost(func(key string, value ByteView) int64 { return 1 }))
+	gee.Get("Tom")
+	gee.Get("Jack")
+	gee.Get("Sam")
+	if gee.Bytes() != 2 {
+		t.Fatalf("expect main cache capped at 2 entries, got %d", gee.Bytes())
+	}
+}
+
+func TestOnExpiredLazy(t *testing.T) {
+	var expired, evicted []string
+	gee := newTestGroup(t, "expired-lazy", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}),
+		WithOnExpired(func(key string, value ByteView) { expired = append(expired, key) }),
+		WithOnEvicted(func(key string, value ByteView) { evicted = append(evicted, key) }))
+
+	gee.maincache.add("Tom", ByteView{b: []byte("630")}, time.Now().Add(10*time.Millisecond))
+	time.Sleep(20 * time.Millisecond)
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "Tom" {
+		t.Fatalf("expect expired Tom to be reloaded, got %v %v", view, err)
+	}
+	if !reflect.DeepEqual(expired, []string{"Tom"}) || len(evicted) != 0 {
+		t.Fatalf("expect OnExpired only, got expired %v evicted %v", expired, evicted)
+	}
+}
+
+func TestOnExpiredJanitor(t *testing.T) {
+	expired := make(chan string, 1)
+	gee := newTestGroup(t, "expired-janitor", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}),
+		WithOnExpired(func(key string, value ByteView) { expired <- key }),
+		WithJanitor(5*time.Millisecond))
+	defer gee.maincache.close()
+
+	gee.maincache.add("Tom", ByteView{b: []byte("630")}, time.Now().Add(10*time.Millisecond))
+	select {
+	case key := <-expired:
+		if key != "Tom" {
+			t.Fatalf("expect Tom expired, got %s", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("janitor did not expire Tom")
+	}
+	if gee.Bytes() != 0 {
+		t.Fatalf("expect empty cache after janitor, got %d bytes", gee.Bytes())
+	}
+}
+
+func TestApproxGroup(t *testing.T) {
+	gee := newTestGroup(t, "approx", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		}), WithApproxLRU(0))
+	for k, v := range db {
+		if view, err := gee.Get(k); err != nil || view.String() != v {
+			t.Fatalf("failed to get value of %s", k)
+		}
+	}
+	if _, ok := gee.maincache.cache.(*lru.Approx); !ok {
+		t.Fatalf("expect WithApproxLRU to select lru.Approx")
+	}
+}
+
+func TestAutoShards(t *testing.T) {
+	cases := []struct {
+		procs      int
+		cacheBytes int64
+		expect     int
+	}{
+		{1, 0, 1},
+		{6, 0, 8},
+		{32, 64 << 20, 32},
+		{32, 256 << 10, 4},
+		{32, 2 << 10, 1},
+	}
+	for _, c := range cases {
+		if got := autoShards(c.procs, c.cacheBytes); got != c.expect {
+			t.Errorf("autoShards(%d, %d) = %d, expect %d", c.procs, c.cacheBytes, got, c.expect)
+		}
+	}
+
+	gee := newTestGroup(t, "auto-shards", 0, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithShards(AutoShards))
+	if gee.maincache.shards < 1 {
+		t.Fatalf("expect AutoShards to resolve to a shard count, got %d", gee.maincache.shards)
+	}
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "Tom" {
+		t.Fatalf("failed to get Tom from auto-sharded group")
+	}
+}
+
+// BenchmarkCacheGetParallel 对比分片前后缓存读路径的并发吞吐，
+// 可使用 go test -bench CacheGetParallel -cpu 1,8,32 观察扩展性。
+func BenchmarkCacheGetParallel(b *testing.B) {
+	for _, shards := range []int{1, 32} {
+		b.Run("shards="+strconv.Itoa(shards), func(b *testing.B) {
+			c := &cache{cacheBytes: 64 << 20, shards: shards}
+			c.init()
+			keys := make([]string, 1024)
+			for i := range keys {
+				keys[i] = "key" + strconv.Itoa(i)
+				c.add(keys[i], ByteView{b: []byte("value")}, time.Time{})
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					c.get(keys[i&1023])
+					i++
+				}
+			})
+		})
+	}
+}
+
+func TestCacheConcurrentReadPath(t *testing.T) {
+	const maxBytes = 2 << 10
+	c := &cache{cacheBytes: maxBytes}
+	c.init()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				key := "key" + strconv.Itoa((g*31+i)%300)
+				if g%2 == 0 {
+					c.add(key, ByteView{b: []byte("value" + key)}, time.Time{})
+				} else if v, ok := c.get(key); ok && v.String() != "value"+key {
+					t.Errorf("got %s for %s", v, key)
+				}
+				if b := c.bytes(); b > maxBytes {
+					t.Errorf("cache uses %d bytes, over limit %d", b, maxBytes)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	c.lock()
+	defer c.mu.Unlock()
+	l := c.cache.(*lru.Cache)
+	if l.Bytes() > maxBytes || l.Bytes() != l.Stats().Bytes {
+		t.Fatalf("unexpected byte accounting %d", l.Bytes())
+	}
+}
+
+func TestCacheReadPathRecency(t *testing.T) {
+	c := &cache{cacheBytes: int64(len("k1v1k2v2"))}
+	c.init()
+	c.add("k1", ByteView{b: []byte("v1")}, time.Time{})
+	c.add("k2", ByteView{b: []byte("v2")}, time.Time{})
+	// 读锁下的命中会在下一次写入前补做提升，k2 成为最久未使用的条目
+	c.get("k1")
+	c.add("k3", ByteView{b: []byte("v3")}, time.Time{})
+	if _, ok := c.get("k1"); !ok {
+		t.Fatalf("expect recently read k1 kept")
+	}
+	if _, ok := c.get("k2"); ok {
+		t.Fatalf("expect k2 evicted")
+	}
+}
+
+func ExampleGroup_CacheStats() {
+	gee := NewGroup("stats-example", int64(len("k1v1k2v2")), GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("v" + key[1:]), nil
+		}))
+	defer DestroyGroup("stats-example")
+	for _, key := range []string{"k1", "k2", "k3", "k4", "k4"} {
+		gee.Get(key)
+	}
+
+	stats := gee.CacheStats().Main
+	fmt.Println("entries:", stats.Entries, "bytes:", stats.Bytes, "max:", stats.MaxBytes)
+	fmt.Println("hits:", stats.Hits, "misses:", stats.Misses, "evictions:", stats.Evictions)
+	// Output:
+	// entries: 2 bytes: 8 max: 8
+	// hits: 1 misses: 4 evictions: 2
+}
+
+func TestCacheStatsEmpty(t *testing.T) {
+	gee := newTestGroup(t, "stats-empty", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	if stats := gee.CacheStats().Main; stats != (TierStats{MaxBytes: 2 << 10}) {
+		t.Fatalf("expect zero stats before first use, got %+v", stats)
+	}
+	gee.maincache.get("Tom")
+	if stats := gee.CacheStats().Main; stats.Misses != 1 || stats.Entries != 0 {
+		t.Fatalf("expect a miss before any add to be counted, got %+v", stats)
+	}
+}
+
+func TestCacheBuiltAtConstruction(t *testing.T) {
+	var evicted []string
+	gee := newTestGroup(t, "eager", int64(len("k1v1")), GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("v" + key[1:]), nil
+		}), WithOnEvicted(func(key string, value ByteView) {
+		evicted = append(evicted, key)
+	}))
+	if _, ok := gee.maincache.cache.(*lru.Cache); !ok {
+		t.Fatalf("expect the LRU built by NewGroup, got %T", gee.maincache.cache)
+	}
+	if _, ok := gee.maincache.get("k1"); ok {
+		t.Fatalf("expect get before any add to miss")
+	}
+	// 第一次写入就能看到构造时配置的 OnEvicted
+	gee.Get("k1")
+	gee.Get("k2")
+	if !reflect.DeepEqual(evicted, []string{"k1"}) {
+		t.Fatalf("expect k1 evicted through the configured callback, got %v", evicted)
+	}
+}
+
+func TestRemoveLocal(t *testing.T) {
+	loads := 0
+	gee := newTestGroup(t, "remove-local", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte(db[key]), nil
+		}))
+	if gee.RemoveLocal("Tom") {
+		t.Fatalf("expect nothing removed before the cache exists")
+	}
+	gee.Get("Tom")
+	if !gee.RemoveLocal("Tom") || gee.RemoveLocal("Tom") {
+		t.Fatalf("expect Tom removed exactly once")
+	}
+	if gee.Bytes() != 0 {
+		t.Fatalf("expect byte accounting to drop to 0, got %d", gee.Bytes())
+	}
+	gee.Get("Tom")
+	if loads != 2 {
+		t.Fatalf("expect Tom reloaded after removal, loads %d", loads)
+	}
+}
+
+func TestDestroyGroup(t *testing.T) {
+	gee := NewGroup("destroy", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	gee.Get("Tom")
+	DestroyGroup("destroy")
+
+	if GetGroup("destroy") != nil {
+		t.Fatalf("expect destroyed group to be unregistered")
+	}
+	if gee.Bytes() != 0 {
+		t.Fatalf("expect caches cleared, got %d bytes", gee.Bytes())
+	}
+	if _, err := gee.Get("Tom"); !errors.Is(err, ErrGroupDestroyed) {
+		t.Fatalf("expect ErrGroupDestroyed, got %v", err)
+	}
+	if err := gee.Set("Tom", []byte("630"), 0); !errors.Is(err, ErrGroupDestroyed) {
+		t.Fatalf("expect Set to fail with ErrGroupDestroyed, got %v", err)
+	}
+	if gee.Bytes() != 0 {
+		t.Fatalf("expect no writes after destroy, got %d bytes", gee.Bytes())
+	}
+	// 销毁不存在的 group 不做任何事
+	DestroyGroup("destroy")
+
+	again := newTestGroup(t, "destroy", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("new"), nil
+		}))
+	if v, err := again.Get("Tom"); err != nil || v.String() != "new" {
+		t.Fatalf("expect the name reusable after destroy, got %v, %v", v, err)
+	}
+}
+
+func TestNewGroupDuplicateName(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return nil, nil })
+	newTestGroup(t, "duplicate", 2<<10, getter)
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expect NewGroup to panic on a duplicate name")
+		}
+	}()
+	NewGroup("duplicate", 2<<10, getter)
+}
+
+func TestNewGroupStrict(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return nil, nil })
+	g := newTestGroup(t, "strict", 2<<10, getter)
+	if dup, err := NewGroupStrict("strict", 2<<10, getter); !errors.Is(err, ErrGroupExists) || dup != nil {
+		t.Fatalf("expect ErrGroupExists, got %v %v", dup, err)
+	}
+	if GetGroup("strict") != g {
+		t.Fatalf("expect the existing group kept")
+	}
+}
+
+func TestGetOrCreateGroup(t *testing.T) {
+	t.Cleanup(func() { DestroyGroup("get-or-create") })
+	var created atomic.Int32
+	getter := GetterFunc(func(key string) ([]byte, error) { return nil, nil })
+
+	got := make([]*Group, 16)
+	var wg sync.WaitGroup
+	for i := range got {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got[i] = GetOrCreateGroup("get-or-create", 2<<10, getter, func(g *Group) {
+				created.Add(1)
+			})
+		}()
+	}
+	wg.Wait()
+	for _, g := range got {
+		if g != got[0] || g != GetGroup("get-or-create") {
+			t.Fatalf("expect every caller to get the same group")
+		}
+	}
+	if n := created.Load(); n != 1 {
+		t.Fatalf("expect the group created once, got %d", n)
+	}
+}
+
+func TestListGroups(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return nil, nil })
+	newTestGroup(t, "list-b", 2<<10, getter)
+	newTestGroup(t, "list-a", 2<<10, getter)
+
+	var got []string
+	for _, name := range ListGroups() {
+		if name == "list-a" || name == "list-b" {
+			got = append(got, name)
+		}
+	}
+	if !reflect.DeepEqual(got, []string{"list-a", "list-b"}) {
+		t.Fatalf("expect sorted group names, got %v", got)
+	}
+}
+
+func TestHotKeyReplication(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer setNow(&clock)()
+
+	gee := newTestGroup(t, "hot-keys", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s should be fetched from the peer", key)
+		}), WithHotCacheRate(0), WithHotKeyQPS(10), WithHotKeyTTL(2*time.Second))
+	peer := &countingPeer{gets: map[string]int{}}
+	gee.RegisterPeers(fakePicker{peer: peer})
+
+	// 每 10 次请求中有 9 次访问同一个 key
+	for i := 0; i < 100; i++ {
+		key := "hot"
+		if i%10 == 0 {
+			key = "cold" + strconv.Itoa(i)
+		}
+		if view, err := gee.Get(key); err != nil || view.String() != "remote-"+key {
+			t.Fatalf("get %s failed: %v %v", key, view, err)
+		}
+	}
+	if peer.gets["hot"] != 10 {
+		t.Fatalf("expect the hot key to reach the peer until it crosses the threshold, got %d", peer.gets["hot"])
+	}
+	if peer.gets["cold0"] != 1 || gee.CacheStats().Hot.Entries != 1 {
+		t.Fatalf("expect only the hot key replicated, stats %+v", gee.CacheStats().Hot)
+	}
+	if n := gee.Stats().HotKeys; n != 1 {
+		t.Fatalf("expect 1 replicated key, got %d", n)
+	}
+
+	// 副本过期之后重新从拥有者获取
+	clock = clock.Add(2 * time.Second)
+	if n := gee.Stats().HotKeys; n != 0 {
+		t.Fatalf("expect the replica expired, got %d replicated keys", n)
+	}
+	gee.Get("hot")
+	if peer.gets["hot"] != 11 {
+		t.Fatalf("expect an expired replica to be fetched again, got %d", peer.gets["hot"])
+	}
+}
+
+func TestMaxHotKeys(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer setNow(&clock)()
+
+	gee := newTestGroup(t, "max-hot-keys", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s should be fetched from the peer", key)
+		}), WithHotCacheRate(0), WithHotKeyQPS(2), WithMaxHotKeys(1))
+	peer := &countingPeer{gets: map[string]int{}}
+	gee.RegisterPeers(fakePicker{peer: peer})
+
+	for i := 0; i < 5; i++ {
+		gee.Get("a")
+		gee.Get("b")
+	}
+	if peer.gets["a"] != 2 || peer.gets["b"] != 5 {
+		t.Fatalf("expect only the first hot key replicated, got %v", peer.gets)
+	}
+	if n := gee.Stats().HotKeys; n != 1 {
+		t.Fatalf("expect 1 replicated key, got %d", n)
+	}
+
+	gee.RemoveLocal("a")
+	gee.Get("b")
+	if peer.gets["b"] != 6 || gee.Stats().HotKeys != 1 {
+		t.Fatalf("expect b replicated once a is removed, got %v", peer.gets)
+	}
+}
+
+func TestGroupTTL(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer setNow(&clock)()
+
+	loads := 0
+	gee := newTestGroup(t, "ttl", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte(db[key]), nil
+		}), WithTTL(5*time.Minute))
+
+	view, err := gee.Get("Tom")
+	if err != nil || !view.Expire().Equal(clock.Add(5*time.Minute)) {
+		t.Fatalf("expect Tom stamped with the group TTL, got %v %v", view.Expire(), err)
+	}
+	clock = clock.Add(5*time.Minute - time.Second)
+	gee.Get("Tom")
+	if loads != 1 {
+		t.Fatalf("expect Tom served from cache before expiry, loads %d", loads)
+	}
+	clock = clock.Add(time.Second)
+	gee.Get("Tom")
+	if loads != 2 || gee.Stats().MainCacheHits != 1 {
+		t.Fatalf("expect an expired entry to count as a miss, loads %d, stats %+v", loads, gee.Stats())
+	}
+
+	// Set 未指定 ttl 时使用 Group 的默认值
+	if err := gee.Set("Jack", []byte("589"), 0); err != nil {
+		t.Fatalf("set Jack: %v", err)
+	}
+	if v, ok := gee.maincache.get("Jack"); !ok || !v.Expire().Equal(clock.Add(5*time.Minute)) {
+		t.Fatalf("expect Set to use the group TTL, got %v %v", v.Expire(), ok)
+	}
+}
+
+// batchPeer 是一个支持批量获取的远程节点，记录每次批量请求的 key。
+// fail 中的 key 会返回单独的错误，block 不为 nil 时单个 Get 会等待它被关闭。
+type batchPeer struct {
+	mu      sync.Mutex
+	batches [][]string
+	gets    []string
+	fail    map[string]bool
+	block   chan struct{}
+	started chan struct{}
+}
+
+func (p *batchPeer) Get(_ context.Context, group string, key string) ([]byte, error) {
+	p.mu.Lock()
+	p.gets = append(p.gets, key)
+	p.mu.Unlock()
+	if p.block != nil {
+		close(p.started)
+		<-p.block
+	}
+	return []byte("remote-" + key), nil
+}
+
+func (p *batchPeer) GetMulti(ctx context.Context, group string, keys []string) ([]PeerResult, error) {
+	p.mu.Lock()
+	p.batches = append(p.batches, keys)
+	p.mu.Unlock()
+	results := make([]PeerResult, len(keys))
+	for i, key := range keys {
+		if p.fail[key] {
+			results[i].Err = fmt.Errorf("peer failed %s", key)
+			continue
+		}
+		results[i].Value = []byte("remote-" + key)
+	}
+	return results, nil
+}
+
+func TestGetMulti(t *testing.T) {
+	var mu sync.Mutex
+	loads := map[string]int{}
+	gee := newTestGroup(t, "get-multi", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			mu.Lock()
+			loads[key]++
+			mu.Unlock()
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+
+	values, err := gee.GetMulti(context.Background(), []string{"Tom", "Jack", "Tom", "unknown", "unknown"})
+	var keyErrs KeyErrors
+	if !errors.As(err, &keyErrs) || len(keyErrs) != 1 || keyErrs["unknown"] == nil {
+		t.Fatalf("expect only unknown to fail, got %v", err)
+	}
+	if len(values) != 2 || values["Tom"].String() != "630" || values["Jack"].String() != "589" {
+		t.Fatalf("unexpected values %v", values)
+	}
+	if loads["Tom"] != 1 || loads["unknown"] != 1 {
+		t.Fatalf("expect duplicate keys loaded once, got %v", loads)
+	}
+
+	values, err = gee.GetMulti(context.Background(), []string{"Jack", "Tom"})
+	if err != nil || len(values) != 2 || loads["Tom"] != 1 || loads["Jack"] != 1 {
+		t.Fatalf("expect cached keys served without loading, got %v %v, loads %v", values, err, loads)
+	}
+}
+
+func TestGetMultiBatchesPerPeer(t *testing.T) {
+	gee := newTestGroup(t, "get-multi-peers", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("local-" + key), nil
+		}), WithHotCacheRate(0))
+	p1 := &batchPeer{fail: map[string]bool{"c": true}}
+	p2 := &batchPeer{}
+	single := &countingPeer{gets: map[string]int{}}
+	gee.RegisterPeers(keyPicker{"a": p1, "b": p2, "c": p1, "d": single})
+
+	values, err := gee.GetMulti(context.Background(), []string{"a", "b", "c", "d", "e", "a"})
+	if err != nil {
+		t.Fatalf("expect every key to succeed, got %v", err)
+	}
+	expect := map[string]string{"a": "remote-a", "b": "remote-b", "c": "local-c", "d": "remote-d", "e": "local-e"}
+	for key, want := range expect {
+		if values[key].String() != want {
+			t.Fatalf("expect %s = %s, got %q", key, want, values[key])
+		}
+	}
+	if !reflect.DeepEqual(p1.batches, [][]string{{"a", "c"}}) || !reflect.DeepEqual(p2.batches, [][]string{{"b"}}) {
+		t.Fatalf("expect one batch per peer in input order, got %v and %v", p1.batches, p2.batches)
+	}
+	if single.gets["d"] != 1 {
+		t.Fatalf("expect a peer without batching to be asked directly, got %v", single.gets)
+	}
+	if st := gee.Stats(); st.PeerLoads != 3 || st.PeerErrors != 1 || st.LocalLoads != 2 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestGetMultiSharesInflightLoad(t *testing.T) {
+	gee := newTestGroup(t, "get-multi-inflight", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s should be fetched from the peer", key)
+		}), WithHotCacheRate(0))
+	peer := &batchPeer{block: make(chan struct{}), started: make(chan struct{})}
+	gee.RegisterPeers(fakePicker{peer: peer})
+
+	done := make(chan error)
+	go func() {
+		_, err := gee.Get("a")
+		done <- err
+	}()
+	<-peer.started
+
+	result := make(chan map[string]ByteView)
+	go func() {
+		values, _ := gee.GetMulti(context.Background(), []string{"a", "b"})
+		result <- values
+	}()
+	// 等到 b 的批量请求发出之后再让 a 的单独请求返回
+	for {
+		peer.mu.Lock()
+		n := len(peer.batches)
+		peer.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(peer.block)
+
+	if err := <-done; err != nil {
+		t.Fatalf("get a: %v", err)
+	}
+	values := <-result
+	if values["a"].String() != "remote-a" || values["b"].String() != "remote-b" {
+		t.Fatalf("unexpected values %v", values)
+	}
+	if !reflect.DeepEqual(peer.batches, [][]string{{"b"}}) || !reflect.DeepEqual(peer.gets, []string{"a"}) {
+		t.Fatalf("expect a to share the in-flight Get, got batches %v gets %v", peer.batches, peer.gets)
+	}
+}
+
+// batchSource 是实现了 BatchGetter 的数据源，记录单独的和批量的查询。
+type batchSource struct {
+	mu      sync.Mutex
+	gets    []string
+	batches [][]string
+	block   chan struct{} // 不为 nil 时 Get 和 GetMulti 等待它关闭
+	started chan struct{} // 不为 nil 时在开始查询时收到通知
+	err     error
+}
+
+func (s *batchSource) enter() {
+	if s.started != nil {
+		s.started <- struct{}{}
+	}
+	if s.block != nil {
+		<-s.block
+	}
+}
+
+func (s *batchSource) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	s.gets = append(s.gets, key)
+	s.mu.Unlock()
+	s.enter()
+	if v, ok := db[key]; ok {
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+}
+
+func (s *batchSource) GetMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	s.mu.Lock()
+	s.batches = append(s.batches, slices.Clone(keys))
+	s.mu.Unlock()
+	s.enter()
+	if s.err != nil {
+		return nil, s.err
+	}
+	out := make(map[string][]byte)
+	for _, key := range keys {
+		if v, ok := db[key]; ok {
+			out[key] = []byte(v)
+		}
+	}
+	return out, nil
+}
+
+func TestGetMultiBatchGetter(t *testing.T) {
+	src := &batchSource{}
+	gee := newTestGroup(t, "get-multi-batch-getter", 2<<10, src, WithNegativeTTL(time.Minute))
+
+	values, err := gee.GetMulti(context.Background(), []string{"Tom", "Jack", "unknown", "Tom"})
+	var keyErrs KeyErrors
+	if !errors.As(err, &keyErrs) || len(keyErrs) != 1 || !errors.Is(keyErrs["unknown"], ErrNotFound) {
+		t.Fatalf("expect the key missing from the batch to be ErrNotFound, got %v", err)
+	}
+	if values["Tom"].String() != "630" || values["Jack"].String() != "589" {
+		t.Fatalf("unexpected values %v", values)
+	}
+	if !reflect.DeepEqual(src.batches, [][]string{{"Tom", "Jack", "unknown"}}) || len(src.gets) != 0 {
+		t.Fatalf("expect one batch query, got batches %v gets %v", src.batches, src.gets)
+	}
+	if s := gee.Stats(); s.BatchLoads != 1 || s.LocalLoads != 2 || s.LocalLoadErrs != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	// 批量加载的结果与单独加载一样写入缓存和负缓存
+	if _, err := gee.GetMulti(context.Background(), []string{"Tom", "unknown"}); !errors.Is(err, ErrNotFound) || len(src.batches) != 1 {
+		t.Fatalf("expect cached results, got %v after %d batches", err, len(src.batches))
+	}
+	if v, err := gee.Get("Sam"); err != nil || v.String() != "567" || !slices.Equal(src.gets, []string{"Sam"}) {
+		t.Fatalf("expect Get to query a single key, got %q %v %v", v, err, src.gets)
+	}
+
+	src.err = errors.New("database is down")
+	_, err = gee.GetMulti(context.Background(), []string{"Kate", "Lily"})
+	if !errors.As(err, &keyErrs) || len(keyErrs) != 2 || !errors.Is(keyErrs["Kate"], src.err) {
+		t.Fatalf("expect the batch error for every key, got %v", err)
+	}
+}
+
+func TestGetMultiBatchGetterSingleflight(t *testing.T) {
+	src := &batchSource{block: make(chan struct{}), started: make(chan struct{})}
+	gee := newTestGroup(t, "get-multi-batch-inflight", 2<<10, src)
+
+	// Tom 正在被单独加载时，批量加载只包含 Jack 和 Sam，Tom 共享单独的加载
+	got := make(chan string, 2)
+	go func() {
+		v, err := gee.Get("Tom")
+		got <- fmt.Sprint(v, err)
+	}()
+	<-src.started
+	result := make(chan map[string]ByteView)
+	go func() {
+		values, _ := gee.GetMulti(context.Background(), []string{"Tom", "Jack", "Sam"})
+		result <- values
+	}()
+	<-src.started
+
+	// 批量加载期间的 Get 共享其中对应 key 的加载，不再单独查询
+	go func() {
+		v, err := gee.Get("Jack")
+		got <- fmt.Sprint(v, err)
+	}()
+	for gee.Stats().LoadsDeduped != 3 || gee.Stats().Loads != 5 {
+		time.Sleep(time.Millisecond)
+	}
+	close(src.block)
+
+	values := <-result
+	if values["Tom"].String() != "630" || values["Jack"].String() != "589" || values["Sam"].String() != "567" {
+		t.Fatalf("unexpected values %v", values)
+	}
+	for i := 0; i < 2; i++ {
+		if s := <-got; s != "630 <nil>" && s != "589 <nil>" {
+			t.Fatalf("unexpected Get result %s", s)
+		}
+	}
+	if !reflect.DeepEqual(src.batches, [][]string{{"Jack", "Sam"}}) || !slices.Equal(src.gets, []string{"Tom"}) {
+		t.Fatalf("expect in-flight keys shared, got batches %v gets %v", src.batches, src.gets)
+	}
+}
+
+func TestGetInto(t *testing.T) {
+	msg, _ := proto.Marshal(wrapperspb.String("hello"))
+	gee := newTestGroup(t, "get-into", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "msg" {
+				return msg, nil
+			}
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	ctx := context.Background()
+
+	var s string
+	if err := gee.GetInto(ctx, "Tom", StringSink(&s)); err != nil || s != "630" {
+		t.Fatalf("StringSink got %q %v", s, err)
+	}
+	var view ByteView
+	if err := gee.GetInto(ctx, "Tom", ByteViewSink(&view)); err != nil || view.String() != "630" {
+		t.Fatalf("ByteViewSink got %q %v", view, err)
+	}
+	cached, _ := gee.maincache.get("Tom")
+	if &view.b[0] != &cached.b[0] {
+		t.Fatalf("expect ByteViewSink to share the cached bytes without a copy")
+	}
+
+	var b []byte
+	if err := gee.GetInto(ctx, "Tom", AllocatingByteSliceSink(&b)); err != nil || string(b) != "630" {
+		t.Fatalf("AllocatingByteSliceSink got %q %v", b, err)
+	}
+	b[0] = 'x'
+	if v, _ := gee.Get("Tom"); v.String() != "630" {
+		t.Fatalf("expect cached bytes unchanged after modifying the sink's slice, got %q", v)
+	}
+
+	var m wrapperspb.StringValue
+	if err := gee.GetInto(ctx, "msg", ProtoSink(&m)); err != nil || m.GetValue() != "hello" {
+		t.Fatalf("ProtoSink got %q %v", m.GetValue(), err)
+	}
+	m.Value = "changed"
+	var again wrapperspb.StringValue
+	if err := gee.GetInto(ctx, "msg", ProtoSink(&again)); err != nil || again.GetValue() != "hello" {
+		t.Fatalf("expect cached message unchanged, got %q %v", again.GetValue(), err)
+	}
+
+	if err := gee.GetInto(ctx, "unknown", StringSink(&s)); err == nil {
+		t.Fatalf("expect the getter error passed through")
+	}
+}
+
+func TestSinkSetters(t *testing.T) {
+	src := []byte("abc")
+	var b []byte
+	sink := AllocatingByteSliceSink(&b)
+	sink.SetBytes(src)
+	src[0] = 'x'
+	if string(b) != "abc" {
+		t.Fatalf("expect SetBytes to copy, got %q", b)
+	}
+
+	var view ByteView
+	ByteViewSink(&view).SetProto(wrapperspb.String("p"))
+	var m wrapperspb.StringValue
+	if err := ProtoSink(&m).SetBytes(view.b); err != nil || m.GetValue() != "p" {
+		t.Fatalf("expect proto round trip through sinks, got %q %v", m.GetValue(), err)
+	}
+	var s string
+	StringSink(&s).SetString("str")
+	if s != "str" {
+		t.Fatalf("StringSink.SetString got %q", s)
+	}
+}
+
+// waitRefreshes 通过占满 g 的刷新额度等待后台刷新全部结束，然后归还额度。
+func waitRefreshes(t *testing.T, g *Group) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for i := 0; i < cap(g.refreshSem); i++ {
+		select {
+		case g.refreshSem <- struct{}{}:
+		case <-timeout:
+			t.Fatalf("background refresh did not finish")
+		}
+	}
+	for i := 0; i < cap(g.refreshSem); i++ {
+		<-g.refreshSem
+	}
+}
+
+func TestRefreshAhead(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer setNow(&clock)()
+
+	var loads atomic.Int32
+	var fail atomic.Bool
+	gee := newTestGroup(t, "refresh-ahead", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			n := loads.Add(1)
+			if fail.Load() {
+				return nil, errors.New("database is down")
+			}
+			return []byte("v" + strconv.Itoa(int(n))), nil
+		}), WithRefreshAhead(time.Minute, 5*time.Minute))
+
+	gee.Get("k")
+	clock = clock.Add(30 * time.Second)
+	if v, _ := gee.Get("k"); v.String() != "v1" || gee.Stats().Refreshes != 0 {
+		t.Fatalf("expect no refresh before the soft TTL, got %q %+v", v, gee.Stats())
+	}
+
+	// 过了软过期时间，先返回旧值，再在后台刷新
+	clock = clock.Add(time.Minute)
+	if v, _ := gee.Get("k"); v.String() != "v1" {
+		t.Fatalf("expect the stale value served immediately, got %q", v)
+	}
+	waitRefreshes(t, gee)
+	v, _ := gee.Get("k")
+	if v.String() != "v2" || !v.Expire().Equal(clock.Add(5*time.Minute)) {
+		t.Fatalf("expect the refreshed value with a new deadline, got %q %v", v, v.Expire())
+	}
+
+	// 刷新失败时保留原来的值
+	fail.Store(true)
+	clock = clock.Add(2 * time.Minute)
+	gee.Get("k")
+	waitRefreshes(t, gee)
+	if v, err := gee.Get("k"); err != nil || v.String() != "v2" {
+		t.Fatalf("expect the old value kept after a failed refresh, got %q %v", v, err)
+	}
+	waitRefreshes(t, gee)
+	if st := gee.Stats(); st.Refreshes != 3 || st.RefreshErrs != 2 {
+		t.Fatalf("unexpected refresh stats %+v", st)
+	}
+
+	// 超过硬过期时间之后按未命中处理
+	clock = clock.Add(5 * time.Minute)
+	if _, err := gee.Get("k"); err == nil {
+		t.Fatalf("expect a synchronous load after the hard TTL")
+	}
+}
+
+func TestRefreshAheadSingleFlight(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer setNow(&clock)()
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	gee := newTestGroup(t, "refresh-ahead-once", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if loads.Add(1) > 1 {
+				<-release
+			}
+			return []byte("v"), nil
+		}), WithRefreshAhead(time.Minute, time.Hour))
+
+	gee.Get("k")
+	clock = clock.Add(2 * time.Minute)
+	for i := 0; i < 50; i++ {
+		if v, _ := gee.Get("k"); v.String() != "v" {
+			t.Fatalf("expect the cached value while refreshing, got %q", v)
+		}
+	}
+	if n := len(gee.refreshSem); n != 1 {
+		t.Fatalf("expect a single refresh in flight, got %d", n)
+	}
+	close(release)
+	waitRefreshes(t, gee)
+	if n := loads.Load(); n != 2 {
+		t.Fatalf("expect one background load, got %d", n)
+	}
+}
+
+func TestLoadTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var calls atomic.Int32
+	gee := newTestGroup(t, "load-timeout", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if calls.Add(1) == 1 {
+				// 第一次加载挂起，并且不响应 ctx
+				close(started)
+				<-release
+			}
+			return []byte("v"), nil
+		}), WithLoadTimeout(100*time.Millisecond))
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = gee.Get("k")
+		}()
+		if i == 0 {
+			<-started
+		}
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if !errors.Is(err, ErrLoadTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expect every waiter to get ErrLoadTimeout, got %v", errs)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expect the waiters to share one load, got %d", n)
+	}
+
+	// 超时之后 Group 仍然可用
+	if v, err := gee.Get("k"); err != nil || v.String() != "v" {
+		t.Fatalf("expect a new load after the timeout, got %q %v", v, err)
+	}
+	close(release)
+
+	// 调用者的截止时间更早时以它为准
+	gee2 := newTestGroup(t, "load-timeout-ctx", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}), WithLoadTimeout(time.Minute))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := gee2.GetContext(ctx, "k"); err != context.DeadlineExceeded {
+		t.Fatalf("expect the caller's deadline to fire first, got %v", err)
+	}
+}
+
+func TestLoadTimeoutPeer(t *testing.T) {
+	gee := newTestGroup(t, "load-timeout-peer", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("local"), nil
+		}), WithLoadTimeout(20*time.Millisecond))
+	peer := &slowPeer{started: make(chan struct{}), release: make(chan struct{})}
+	defer close(peer.release)
+	gee.RegisterPeers(fakePicker{peer: peer})
+
+	if _, err := gee.Get("k"); !errors.Is(err, ErrLoadTimeout) {
+		t.Fatalf("expect a hung peer to hit the load timeout, got %v", err)
+	}
+}
+
+func TestPreload(t *testing.T) {
+	var calls, inflight, maxInflight int32
+	gee := newTestGroup(t, "preload", int64(len("k0v0")*3), GetterFunc(
+		func(key string) ([]byte, error) {
+			atomic.AddInt32(&calls, 1)
+			n := atomic.AddInt32(&inflight, 1)
+			defer atomic.AddInt32(&inflight, -1)
+			for m := atomic.LoadInt32(&maxInflight); n > m && !atomic.CompareAndSwapInt32(&maxInflight, m, n); m = atomic.LoadInt32(&maxInflight) {
+			}
+			time.Sleep(time.Millisecond)
+			if key == "bad" {
+				return nil, errors.New("bad key")
+			}
+			return []byte("v" + key[1:]), nil
+		}))
+	gee.Get("k0")
+
+	var progress []string
+	err := gee.Preload(context.Background(), []string{"k0", "k1", "k2", "bad", "k3", "k4", "k1"}, 2,
+		WithPreloadProgress(func(key string, err error) {
+			progress = append(progress, key)
+		}))
+	var errs KeyErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs["bad"] == nil {
+		t.Fatalf("expect only bad to fail, got %v", err)
+	}
+	if len(progress) != 6 {
+		t.Fatalf("expect progress for every distinct key, got %v", progress)
+	}
+	if n := atomic.LoadInt32(&calls); n != 6 {
+		t.Fatalf("expect k0 not reloaded and 5 preloads, got %d getter calls", n)
+	}
+	if n := atomic.LoadInt32(&maxInflight); n > 2 {
+		t.Fatalf("expect at most 2 concurrent loads, got %d", n)
+	}
+	// 预热的值是冷条目，只会互相淘汰，不会挤掉已经被访问过的 k0
+	if _, ok := gee.maincache.peek("k0"); !ok {
+		t.Fatalf("expect hot k0 kept after preloading")
+	}
+	if _, ok := gee.maincache.peek("k4"); !ok {
+		t.Fatalf("expect the last preloaded key cached")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := gee.Preload(ctx, []string{"k5"}, 1); err != context.Canceled {
+		t.Fatalf("expect a canceled preload to return ctx.Err(), got %v", err)
+	}
+}
+
+// setterPeer 记录通过 PeerSetter 写入的值。
+type setterPeer struct {
+	fakePeer
+	mu   sync.Mutex
+	sets map[string]string
+}
+
+func (p *setterPeer) Set(_ context.Context, group string, key string, value []byte, ttl time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sets[key] = string(value)
+	return nil
+}
+
+func TestPreloadPeerKeys(t *testing.T) {
+	var loaded []string
+	var mu sync.Mutex
+	gee := newTestGroup(t, "preload-peers", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			mu.Lock()
+			loaded = append(loaded, key)
+			mu.Unlock()
+			return []byte("v-" + key), nil
+		}))
+	peer := &setterPeer{sets: make(map[string]string)}
+	gee.RegisterPeers(keyPicker{"remote": peer})
+
+	var progress []string
+	report := WithPreloadProgress(func(key string, err error) {
+		progress = append(progress, key)
+	})
+	if err := gee.Preload(context.Background(), []string{"remote", "local"}, 4, report); err != nil {
+		t.Fatalf("preload: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, []string{"local"}) || !reflect.DeepEqual(progress, []string{"local"}) {
+		t.Fatalf("expect the peer's key skipped, loaded %v progress %v", loaded, progress)
+	}
+
+	progress = nil
+	if err := gee.Preload(context.Background(), []string{"remote"}, 1, WithPreloadPush(), report); err != nil {
+		t.Fatalf("preload with push: %v", err)
+	}
+	if peer.sets["remote"] != "v-remote" || !reflect.DeepEqual(progress, []string{"remote"}) {
+		t.Fatalf("expect remote pushed to its owner, got %v progress %v", peer.sets, progress)
+	}
+	if _, ok := gee.maincache.peek("remote"); ok {
+		t.Fatalf("expect the pushed key not cached locally")
+	}
+}
+
+func TestGetCached(t *testing.T) {
+	var calls int32
+	gee := newTestGroup(t, "get-cached", int64(len("k1v1k2v2")), GetterFunc(
+		func(key string) ([]byte, error) {
+			atomic.AddInt32(&calls, 1)
+			return []byte("v" + key[1:]), nil
+		}))
+	gee.Get("k1")
+	gee.Get("k2")
+	before := gee.Stats()
+
+	if v, ok := gee.GetCached("k1"); !ok || v.String() != "v1" {
+		t.Fatalf("expect k1 cached, got %q %v", v, ok)
+	}
+	if _, ok := gee.GetCached("k3"); ok {
+		t.Fatalf("expect k3 not cached")
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("expect GetCached never to call the getter, got %d calls", n)
+	}
+	if st := gee.Stats(); st != before {
+		t.Fatalf("expect GetCached not to change stats, got %+v want %+v", st, before)
+	}
+	// 探测没有提升 k1，它仍然是最久未使用的条目
+	gee.populateCache("k3", ByteView{b: []byte("v3")})
+	if _, ok := gee.GetCached("k1"); ok {
+		t.Fatalf("expect k1 evicted first after probing it")
+	}
+	if _, ok := gee.GetCached("k2"); !ok {
+		t.Fatalf("expect k2 kept")
+	}
+
+	hot := newTestGroup(t, "get-cached-hot", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s should not be loaded", key)
+		}))
+	hot.populateHotCache("remote", ByteView{b: []byte("hot")})
+	if v, ok := hot.GetCached("remote"); !ok || v.String() != "hot" {
+		t.Fatalf("expect GetCached to see the hot cache, got %q %v", v, ok)
+	}
+}
+
+func TestErrorCache(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer setNow(&clock)()
+
+	errTimeout := errors.New("backend timed out")
+	errBadKey := errors.New("bad key")
+	calls := make(map[string]int)
+	gee := newTestGroup(t, "error-cache", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			calls[key]++
+			switch key {
+			case "flaky":
+				return nil, errTimeout
+			case "fatal":
+				return nil, errBadKey
+			}
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}), WithErrorCacheTTL(time.Second), WithErrorClassifier(func(err error) ErrorClass {
+		switch {
+		case errors.Is(err, errBadKey):
+			return ErrorClassFatal
+		case errors.Is(err, ErrNotFound):
+			return ErrorClassNotFound
+		}
+		return ErrorClassTransient
+	}))
+
+	for i := 0; i < 3; i++ {
+		if _, err := gee.Get("flaky"); err != errTimeout {
+			t.Fatalf("expect the getter's error, got %v", err)
+		}
+	}
+	if calls["flaky"] != 1 || gee.Stats().ErrorCacheHits != 2 {
+		t.Fatalf("expect the transient error cached, got %d calls %+v", calls["flaky"], gee.Stats())
+	}
+	if _, ok := gee.maincache.peek("flaky"); ok {
+		t.Fatalf("expect the cached error kept apart from real values")
+	}
+
+	clock = clock.Add(time.Second)
+	gee.Get("flaky")
+	if calls["flaky"] != 2 {
+		t.Fatalf("expect the cached error to expire, got %d calls", calls["flaky"])
+	}
+	if err := gee.Remove("flaky"); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	gee.Get("flaky")
+	if calls["flaky"] != 3 {
+		t.Fatalf("expect Remove to clear the cached error, got %d calls", calls["flaky"])
+	}
+
+	// fatal 的错误不缓存；没有启用 WithNegativeTTL 时 not-found 也不缓存
+	gee.Get("fatal")
+	gee.Get("fatal")
+	gee.Get("missing")
+	gee.Get("missing")
+	if calls["fatal"] != 2 || calls["missing"] != 2 {
+		t.Fatalf("expect fatal and not-found errors not cached, got %v", calls)
+	}
+	if st := gee.Stats(); st.ErrorCacheHits != 2 || st.NegativeHits != 0 {
+		t.Fatalf("unexpected negative cache stats %+v", st)
+	}
+}
+
+func TestOnEvictedOutsideLock(t *testing.T) {
+	var evicted []string
+	var gee *Group
+	gee = newTestGroup(t, "on-evicted", int64(len("k1v1")*3), GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("v" + key[1:]), nil
+		}), WithOnEvicted(func(key string, value ByteView) {
+		// 回调在释放锁之后调用，可以访问同一个 Group
+		if _, ok := gee.GetCached(key); ok {
+			t.Errorf("expect %s gone before the callback", key)
+		}
+		evicted = append(evicted, key+"="+value.String())
+	}))
+
+	for i := 1; i <= 6; i++ {
+		gee.Get("k" + strconv.Itoa(i))
+	}
+	if want := []string{"k1=v1", "k2=v2", "k3=v3"}; !reflect.DeepEqual(evicted, want) {
+		t.Fatalf("expect evictions in LRU order %v, got %v", want, evicted)
+	}
+
+	// 主动删除不会触发回调
+	gee.RemoveLocal("k4")
+	if len(evicted) != 3 {
+		t.Fatalf("expect RemoveLocal not reported as an eviction, got %v", evicted)
+	}
+
+	hot := newTestGroup(t, "on-evicted-hot", int64(len("k1v1")*hotCacheRatio), GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s should not be loaded", key)
+		}), WithOnEvicted(func(key string, value ByteView) {
+		evicted = append(evicted, key)
+	}))
+	hot.populateHotCache("r1", ByteView{b: []byte("v1")})
+	hot.populateHotCache("r2", ByteView{b: []byte("v2")})
+	if evicted[len(evicted)-1] != "r1" {
+		t.Fatalf("expect hot cache evictions reported, got %v", evicted)
+	}
+}
+
+func TestMetricsCollector(t *testing.T) {
+	m := NewMemoryCollector()
+	gee := newTestGroup(t, "metrics", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "missing" {
+				return nil, ErrNotFound
+			}
+			return []byte(key), nil
+		}), WithMetrics(m), WithNegativeTTL(time.Minute))
+	gee.Get("Tom")
+	gee.Get("Tom")
+	gee.Get("missing")
+	gee.Get("missing")
+	if m.Gets("metrics") != 4 || m.Hits("metrics", TierMain) != 1 || m.Hits("metrics", TierNegative) != 1 {
+		t.Fatalf("unexpected get and hit metrics %+v", m)
+	}
+	if n := len(m.LoadDurations("metrics", SourceLocal)); n != 2 {
+		t.Fatalf("expect 2 local loads observed, got %d", n)
+	}
+
+	remote := newTestGroup(t, "metrics-remote", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithMetrics(m), WithPeerRetry(0, 0))
+	remote.RegisterPeers(fakePicker{peer: &fakePeer{}})
+	remote.Get("Tom")
+	if m.PeerErrors("*geecache.fakePeer") != 1 || len(m.LoadDurations("metrics-remote", SourcePeer)) != 0 {
+		t.Fatalf("expect one peer error and no peer load, got %+v", m)
+	}
+
+	// 没有单独设置收集器的 Group 使用全局的收集器
+	global := NewMemoryCollector()
+	SetMetricsCollector(global)
+	defer SetMetricsCollector(nil)
+	plain := newTestGroup(t, "metrics-global", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	plain.Get("Tom")
+	gee.Get("Tom")
+	if global.Gets("metrics-global") != 1 || global.Gets("metrics") != 0 || m.Gets("metrics") != 5 {
+		t.Fatalf("expect per-group collectors to take precedence over the global one")
+	}
+}
+
+// BenchmarkMetrics 衡量读路径上指标调用的开销，默认的 NopCollector 应当可以忽略不计。
+func BenchmarkMetrics(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		c    MetricsCollector
+	}{
+		{"nop", nil},
+		{"memory", NewMemoryCollector()},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			gee := newTestGroup(b, "metrics-bench", 2<<10, GetterFunc(
+				func(key string) ([]byte, error) {
+					return []byte(key), nil
+				}), WithMetrics(bc.c))
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					m := gee.metrics()
+					m.IncGet(gee.name)
+					m.IncHit(gee.name, TierMain)
+				}
+			})
+		})
+	}
+}
+
+func TestCacheFilter(t *testing.T) {
+	loads := make(map[string]int)
+	gee := newTestGroup(t, "cache-filter", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads[key]++
+			return []byte("v-" + key), nil
+		}), WithCacheFilter(func(key string) bool {
+		return !strings.HasPrefix(key, "nocache:")
+	}))
+
+	for i := 0; i < 3; i++ {
+		if v, err := gee.Get("nocache:token"); err != nil || v.String() != "v-nocache:token" {
+			t.Fatalf("expect the filtered key loaded, got %q %v", v, err)
+		}
+		gee.Get("Tom")
+	}
+	if loads["nocache:token"] != 3 || loads["Tom"] != 1 {
+		t.Fatalf("expect only the filtered key to bypass the cache, got %v", loads)
+	}
+	if err := gee.Set("nocache:token", []byte("set"), 0); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	gee.populateHotCache("nocache:token", ByteView{b: []byte("hot")})
+	if _, ok := gee.GetCached("nocache:token"); ok || gee.maincache.stats().Entries != 1 {
+		t.Fatalf("expect the filtered key never stored, main cache has %d entries", gee.maincache.stats().Entries)
+	}
+	if st := gee.Stats(); st.Bypasses != 3 || st.MainCacheHits != 2 {
+		t.Fatalf("expect 3 bypassed gets, got %+v", st)
+	}
+}
+
+func TestRichGetter(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer setNow(&clock)()
+
+	loads := make(map[string]int)
+	gee := newTestGroup(t, "rich-getter", 2<<10, RichGetterFunc(
+		func(ctx context.Context, key string) ([]byte, CacheOptions, error) {
+			loads[key]++
+			switch key {
+			case "short":
+				return []byte("s"), CacheOptions{TTL: time.Second}, nil
+			case "volatile":
+				return []byte("v"), CacheOptions{NoStore: true}, nil
+			}
+			return []byte(key), CacheOptions{}, nil
+		}), WithTTL(time.Minute))
+
+	for i := 0; i < 2; i++ {
+		for _, key := range []string{"short", "volatile", "Tom"} {
+			if _, err := gee.Get(key); err != nil {
+				t.Fatalf("get %s: %v", key, err)
+			}
+		}
+	}
+	if loads["short"] != 1 || loads["volatile"] != 2 || loads["Tom"] != 1 {
+		t.Fatalf("expect only the NoStore value reloaded, got %v", loads)
+	}
+	if _, ok := gee.GetCached("volatile"); ok {
+		t.Fatalf("expect the NoStore value never cached")
+	}
+
+	// 值自带的 TTL 比 WithTTL 短，以它为准
+	clock = clock.Add(time.Second)
+	gee.Get("short")
+	gee.Get("Tom")
+	if loads["short"] != 2 || loads["Tom"] != 1 {
+		t.Fatalf("expect short to expire after its own ttl, got %v", loads)
+	}
+}
+
+func TestFallbackTTL(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer setNow(&clock)()
+
+	loads := 0
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(key), nil
+	})
+	gee := newTestGroup(t, "fallback-ttl", 2<<10, getter, WithPeerRetry(0, 0), WithTTL(time.Minute))
+	gee.RegisterPeers(fakePicker{peer: &fakePeer{}})
+
+	gee.Get("Tom")
+	gee.Get("Tom")
+	if loads != 1 {
+		t.Fatalf("expect the fallback value served from hotcache, got %d loads", loads)
+	}
+	if st := gee.CacheStats(); st.Main.Entries != 0 || st.Hot.Entries != 1 {
+		t.Fatalf("expect the fallback value kept out of maincache, got %+v", st)
+	}
+	clock = clock.Add(defaultFallbackTTL)
+	gee.Get("Tom")
+	if loads != 2 {
+		t.Fatalf("expect the fallback copy to expire after %v, got %d loads", defaultFallbackTTL, loads)
+	}
+
+	uncached := newTestGroup(t, "fallback-off", 2<<10, getter, WithPeerRetry(0, 0), WithFallbackTTL(0))
+	uncached.RegisterPeers(fakePicker{peer: &fakePeer{}})
+	uncached.Get("Tom")
+	uncached.Get("Tom")
+	if loads != 4 || uncached.Bytes() != 0 {
+		t.Fatalf("expect fallback values not cached, got %d loads and %d bytes", loads, uncached.Bytes())
+	}
+}
+
+func TestGetFresh(t *testing.T) {
+	var version atomic.Int32
+	var block chan struct{}
+	gee := newTestGroup(t, "get-fresh", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "gone" && version.Load() > 0 {
+				return nil, ErrNotFound
+			}
+			if block != nil {
+				<-block
+			}
+			return []byte("v" + strconv.Itoa(int(version.Add(1)))), nil
+		}))
+
+	gee.Get("Tom")
+	if v, err := gee.GetFresh(context.Background(), "Tom"); err != nil || v.String() != "v2" {
+		t.Fatalf("expect GetFresh to reload, got %q %v", v, err)
+	}
+	if v, _ := gee.Get("Tom"); v.String() != "v2" || version.Load() != 2 {
+		t.Fatalf("expect the fresh value cached, got %q after %d loads", v, version.Load())
+	}
+
+	// 重新加载期间 Get 不等待，直接返回旧值
+	block = make(chan struct{})
+	done := make(chan ByteView)
+	go func() {
+		v, _ := gee.GetFresh(context.Background(), "Tom")
+		done <- v
+	}()
+	for gee.Stats().LoadsDeduped < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	if v, _ := gee.Get("Tom"); v.String() != "v2" {
+		t.Fatalf("expect the old value during the reload, got %q", v)
+	}
+	close(block)
+	if v := <-done; v.String() != "v3" {
+		t.Fatalf("expect v3 from GetFresh, got %q", v)
+	}
+	if v, _ := gee.Get("Tom"); v.String() != "v3" {
+		t.Fatalf("expect v3 cached after the reload, got %q", v)
+	}
+
+	gee.Get("gone")
+	if _, err := gee.GetFresh(context.Background(), "gone"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound, got %v", err)
+	}
+	if _, ok := gee.GetCached("gone"); ok {
+		t.Fatalf("expect the stale value dropped once the key is gone")
+	}
+}
+
+func TestSetIfVersion(t *testing.T) {
+	for _, shards := range []int{1, 4} {
+		gee := newTestGroup(t, "set-if-version-"+strconv.Itoa(shards), 2<<10, GetterFunc(
+			func(key string) ([]byte, error) {
+				return []byte(key), nil
+			}), WithShards(shards))
+
+		if v, _ := gee.Get("Tom"); v.Version() != 1 {
+			t.Fatalf("expect a loaded value at version 1, got %d", v.Version())
+		}
+		gee.Set("Tom", []byte("set"), 0)
+		if v, _ := gee.Get("Tom"); v.Version() != 2 {
+			t.Fatalf("expect Set to bump the version, got %d", v.Version())
+		}
+
+		// 多个写入方基于同一个版本号竞争，只有一个成功
+		var wg sync.WaitGroup
+		var wins atomic.Int32
+		var winner atomic.Value
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func(value string) {
+				defer wg.Done()
+				version, err := gee.SetIfVersion("Tom", []byte(value), 2)
+				switch {
+				case err == nil && version == 3:
+					wins.Add(1)
+					winner.Store(value)
+				case !errors.Is(err, ErrVersionMismatch):
+					t.Errorf("unexpected result %d %v", version, err)
+				}
+			}("w" + strconv.Itoa(i))
+		}
+		wg.Wait()
+		if wins.Load() != 1 {
+			t.Fatalf("expect exactly one writer to win, got %d", wins.Load())
+		}
+		if v, _ := gee.Get("Tom"); v.String() != winner.Load() || v.Version() != 3 {
+			t.Fatalf("expect the winner's value at version 3, got %q at %d", v, v.Version())
+		}
+
+		if _, err := gee.SetIfVersion("new", []byte("x"), 1); !errors.Is(err, ErrVersionMismatch) {
+			t.Fatalf("expect a mismatch for a missing key, got %v", err)
+		}
+		if version, err := gee.SetIfVersion("new", []byte("x"), 0); err != nil || version != 4 {
+			t.Fatalf("expect version 0 to create the key, got %d %v", version, err)
+		}
+		// 删除之后重新写入的 key 不会重新使用旧的版本号
+		gee.Remove("Tom")
+		if version, err := gee.SetIfVersion("Tom", []byte("again"), 0); err != nil || version != 5 {
+			t.Fatalf("expect Remove to start the key over at a new version, got %d %v", version, err)
+		}
+		gee.Remove("Tom")
+		gee.Get("Tom")
+		if _, err := gee.SetIfVersion("Tom", []byte("late"), 5); !errors.Is(err, ErrVersionMismatch) {
+			t.Fatalf("expect a version from before the Remove to mismatch, got %v", err)
+		}
+	}
+}
+
+func TestPut(t *testing.T) {
+	store := map[string]string{"Tom": "630"}
+	var storeErr error
+	var gee *Group
+	setter := SetterFunc(func(ctx context.Context, key string, value []byte) error {
+		// 写入数据源时缓存中还是旧值
+		if v, ok := gee.GetCached(key); ok && v.String() != store[key] {
+			t.Errorf("expect the cache updated after the store, got %q", v)
+		}
+		if storeErr != nil {
+			return storeErr
+		}
+		store[key] = string(value)
+		return nil
+	})
+	gee = newTestGroup(t, "put", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(store[key]), nil
+		}), WithSetter(setter), WithMaxValueBytes(8))
+
+	gee.Get("Tom")
+	if err := gee.Put(context.Background(), "Tom", []byte("631")); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if v, ok := gee.GetCached("Tom"); !ok || v.String() != "631" || store["Tom"] != "631" {
+		t.Fatalf("expect both the store and the cache updated, got %q %v %q", v, ok, store["Tom"])
+	}
+
+	storeErr = errors.New("db down")
+	if err := gee.Put(context.Background(), "Tom", []byte("632")); !errors.Is(err, storeErr) {
+		t.Fatalf("expect the store error, got %v", err)
+	}
+	if v, _ := gee.GetCached("Tom"); v.String() != "631" {
+		t.Fatalf("expect the cache untouched after a store failure, got %q", v)
+	}
+
+	storeErr = nil
+	if err := gee.Put(context.Background(), "Tom", []byte("too large")); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("expect ErrValueTooLarge, got %v", err)
+	}
+	if _, ok := gee.GetCached("Tom"); ok || store["Tom"] != "too large" {
+		t.Fatalf("expect the stale value dropped once the store is updated")
+	}
+
+	plain := newTestGroup(t, "put-no-setter", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	if err := plain.Put(context.Background(), "Tom", []byte("x")); !errors.Is(err, ErrNoSetter) {
+		t.Fatalf("expect ErrNoSetter, got %v", err)
+	}
+}
+
+// countingStore 是写回测试使用的数据源，记录每个 key 被写入的次数。
+type countingStore struct {
+	mu     sync.Mutex
+	data   map[string]string
+	writes map[string]int
+	fail   func(key string) error
+	block  chan struct{}
+}
+
+func newCountingStore() *countingStore {
+	return &countingStore{data: make(map[string]string), writes: make(map[string]int)}
+}
+
+func (s *countingStore) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return []byte(s.data[key]), nil
+}
+
+func (s *countingStore) Set(ctx context.Context, key string, value []byte) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != nil {
+		if err := s.fail(key); err != nil {
+			return err
+		}
+	}
+	s.data[key] = string(value)
+	s.writes[key]++
+	return nil
+}
+
+func (s *countingStore) snapshot() (map[string]string, map[string]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.data), maps.Clone(s.writes)
+}
+
+func TestWriteBackFlush(t *testing.T) {
+	store := newCountingStore()
+	gee := newTestGroup(t, "write-back", 2<<10, GetterFunc(store.Get),
+		WithSetter(store), WithWriteBack(WithWriteBackInterval(0)))
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		key := "k" + strconv.Itoa(i)
+		gee.PutBack(ctx, key, []byte("old"))
+		gee.PutBack(ctx, key, []byte("v"+strconv.Itoa(i)))
+	}
+	if data, _ := store.snapshot(); len(data) != 0 {
+		t.Fatalf("expect nothing written before a flush, got %v", data)
+	}
+	if v, _ := gee.Get("k3"); v.String() != "v3" {
+		t.Fatalf("expect PutBack visible to Get, got %q", v)
+	}
+	if n := gee.WriteBack().Len(); n != 10 {
+		t.Fatalf("expect 10 dirty keys, got %d", n)
+	}
+	if err := gee.WriteBack().Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	data, writes := store.snapshot()
+	for i := 0; i < 10; i++ {
+		key := "k" + strconv.Itoa(i)
+		if data[key] != "v"+strconv.Itoa(i) || writes[key] != 1 {
+			t.Fatalf("expect %s written once with its latest value, got %q x%d", key, data[key], writes[key])
+		}
+	}
+	if err := gee.WriteBack().Flush(ctx); err != nil || gee.WriteBack().Len() != 0 {
+		t.Fatalf("expect a second flush to have nothing to do, got %v", err)
+	}
+	if _, writes := store.snapshot(); writes["k0"] != 1 || gee.Stats().WriteBacks != 10 {
+		t.Fatalf("expect every key flushed exactly once, got %v", writes)
+	}
+}
+
+func TestWriteBackOnEviction(t *testing.T) {
+	store := newCountingStore()
+	store.block = make(chan struct{})
+	gee := newTestGroup(t, "write-back-evict", 2<<10, GetterFunc(store.Get),
+		WithSetter(store), WithWriteBack(WithWriteBackInterval(0)))
+	ctx := context.Background()
+
+	gee.PutBack(ctx, "Tom", []byte("631"))
+	gee.RemoveLocal("Tom")
+	for gee.WriteBack().Len() != 1 || !writeBackBusy(gee, "Tom") {
+		time.Sleep(time.Millisecond)
+	}
+	// 写回还没有完成时，重新加载使用队列中的值而不是数据源中的旧值
+	if v, _ := gee.Get("Tom"); v.String() != "631" {
+		t.Fatalf("expect the pending value while it is written back, got %q", v)
+	}
+	close(store.block)
+	if err := gee.WriteBack().Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if data, writes := store.snapshot(); data["Tom"] != "631" || writes["Tom"] != 1 {
+		t.Fatalf("expect Tom written back once after leaving the cache, got %v %v", data, writes)
+	}
+}
+
+// writeBackBusy 返回 key 是否正在写回。
+func writeBackBusy(g *Group, key string) bool {
+	g.writeBack.mu.Lock()
+	defer g.writeBack.mu.Unlock()
+	_, ok := g.writeBack.inflight[key]
+	return ok
+}
+
+func TestWriteBackInterval(t *testing.T) {
+	store := newCountingStore()
+	gee := newTestGroup(t, "write-back-timer", 2<<10, GetterFunc(store.Get),
+		WithSetter(store), WithWriteBack(WithWriteBackInterval(5*time.Millisecond)))
+	gee.PutBack(context.Background(), "Tom", []byte("631"))
+	deadline := time.Now().Add(time.Second)
+	for gee.Stats().WriteBacks == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if data, writes := store.snapshot(); data["Tom"] != "631" || writes["Tom"] != 1 {
+		t.Fatalf("expect the timer to write Tom back once, got %v %v", data, writes)
+	}
+}
+
+func TestWriteBackOverflow(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range []struct {
+		policy OverflowPolicy
+		err    error
+	}{
+		{OverflowBlock, nil},
+		{OverflowReject, ErrWriteBackFull},
+		{OverflowWriteThrough, nil},
+	} {
+		store := newCountingStore()
+		gee := newTestGroup(t, "write-back-overflow-"+strconv.Itoa(int(tt.policy)), 2<<10, GetterFunc(store.Get),
+			WithSetter(store), WithWriteBack(WithWriteBackInterval(0), WithWriteBackLimit(2, tt.policy)))
+		gee.PutBack(ctx, "a", []byte("1"))
+		gee.PutBack(ctx, "b", []byte("2"))
+		if err := gee.PutBack(ctx, "c", []byte("3")); !errors.Is(err, tt.err) {
+			t.Fatalf("policy %d: expect %v, got %v", tt.policy, tt.err, err)
+		}
+		if tt.err != nil {
+			if _, ok := gee.GetCached("c"); ok {
+				t.Fatalf("expect a rejected value kept out of the cache")
+			}
+		}
+		if tt.policy == OverflowWriteThrough {
+			if data, _ := store.snapshot(); data["c"] != "3" || len(data) != 1 {
+				t.Fatalf("expect only c written through, got %v", data)
+			}
+		}
+		if err := gee.WriteBack().Flush(ctx); err != nil {
+			t.Fatalf("flush: %v", err)
+		}
+		for key, n := range func() map[string]int { _, w := store.snapshot(); return w }() {
+			if n != 1 {
+				t.Fatalf("policy %d: expect %s written once, got %d", tt.policy, key, n)
+			}
+		}
+	}
+}
+
+func TestWriteBackRetry(t *testing.T) {
+	store := newCountingStore()
+	failures := 1
+	store.fail = func(key string) error {
+		if failures > 0 {
+			failures--
+			return errors.New("db busy")
+		}
+		return nil
+	}
+	gee := newTestGroup(t, "write-back-retry", 2<<10, GetterFunc(store.Get), WithSetter(store),
+		WithWriteBack(WithWriteBackInterval(0), WithWriteBackRetry(1, time.Millisecond)))
+	ctx := context.Background()
+
+	gee.PutBack(ctx, "Tom", []byte("631"))
+	if err := gee.WriteBack().Flush(ctx); err != nil {
+		t.Fatalf("expect the retry to succeed, got %v", err)
+	}
+
+	store.fail = func(key string) error { return errors.New("db down") }
+	gee.PutBack(ctx, "Jack", []byte("589"))
+	var errs KeyErrors
+	if err := gee.WriteBack().Flush(ctx); !errors.As(err, &errs) || errs["Jack"] == nil {
+		t.Fatalf("expect Jack to fail, got %v", err)
+	}
+	if gee.WriteBack().Len() != 1 || gee.Stats().WriteBackErrs == 0 {
+		t.Fatalf("expect the failed key kept for the next flush")
+	}
+	store.fail = nil
+	if err := gee.WriteBack().Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if data, _ := store.snapshot(); data["Jack"] != "589" {
+		t.Fatalf("expect Jack written back once the store recovers, got %v", data)
+	}
+}
+
+// recordingLogger 记录收到的每一条日志。
+type recordingLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *recordingLogger) Printf(format string, v ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, fmt.Sprintf(format, v...))
+}
+
+func TestLogger(t *testing.T) {
+	own := &recordingLogger{}
+	gee := newTestGroup(t, "logger", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithLogger(own), WithPeerRetry(0, 0), WithFallbackTTL(0))
+	gee.RegisterPeers(fakePicker{peer: &fakePeer{}})
+
+	global := &recordingLogger{}
+	SetLogger(global)
+	defer SetLogger(nil)
+	other := newTestGroup(t, "logger-global", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	other.Get("Tom")
+	other.Get("Tom")
+
+	gee.Get("Tom")
+	want := []string{"[GeeCache] Failed to get from peer, will try locally: fake peer has no Tom"}
+	if !reflect.DeepEqual(own.msgs, want) {
+		t.Fatalf("expect %q, got %q", want, own.msgs)
+	}
+	if !slices.Contains(global.msgs, "[GeeCache] hit") {
+		t.Fatalf("expect groups without WithLogger to use the global logger, got %q", global.msgs)
+	}
+}
+
+func TestNopLoggerAllocs(t *testing.T) {
+	gee := newTestGroup(t, "logger-nop", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithLogger(NopLogger{}))
+	gee.Get("Tom")
+	if n := testing.AllocsPerRun(100, func() { gee.Get("Tom") }); n != 0 {
+		t.Fatalf("expect a cache hit not to allocate with NopLogger, got %v allocs", n)
+	}
+}
+
+func TestGetterPanic(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	gee := newTestGroup(t, "getter-panic", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			calls.Add(1)
+			<-release
+			if key == "boom" {
+				panic("source exploded")
+			}
+			return []byte(key), nil
+		}), WithLogger(NopLogger{}))
+
+	before := runtime.NumGoroutine()
+	const callers = 20
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		go func() {
+			_, err := gee.Get("boom")
+			errs <- err
+		}()
+	}
+	for gee.Stats().Loads < callers {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	for i := 0; i < callers; i++ {
+		err := <-errs
+		var pe *GetterPanicError
+		if !errors.Is(err, ErrGetterPanic) || !errors.As(err, &pe) {
+			t.Fatalf("expect ErrGetterPanic, got %v", err)
+		}
+		if pe.Value != "source exploded" || !strings.Contains(string(pe.Stack), "TestGetterPanic") {
+			t.Fatalf("unexpected panic error: %v\n%s", pe.Value, pe.Stack)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expect the waiters to share one load, got %d", n)
+	}
+	if s := gee.Stats(); s.GetterPanics != 1 || s.LocalLoadErrs != 1 {
+		t.Fatalf("expect one panic counted, got %+v", s)
+	}
+
+	// 恢复之后 Group 仍然可用，没有 goroutine 被留下
+	if v, err := gee.Get("Tom"); err != nil || v.String() != "Tom" {
+		t.Fatalf("get after panic: %q %v", v, err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Fatalf("goroutines leaked: %d before, %d after", before, n)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	a, b := NewRegistry(), NewRegistry()
+	ga := a.NewGroup("scores", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("a:" + key), nil
+		}))
+	gb := b.NewGroup("scores", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("b:" + key), nil
+		}))
+	defer a.DestroyGroup("scores")
+	defer b.DestroyGroup("scores")
+
+	if a.GetGroup("scores") != ga || b.GetGroup("scores") != gb {
+		t.Fatalf("expect each registry to return its own group")
+	}
+	if GetGroup("scores") != nil {
+		t.Fatalf("expect the default registry to be unaffected")
+	}
+	if _, err := a.NewGroupStrict("scores", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return nil, nil })); !errors.Is(err, ErrGroupExists) {
+		t.Fatalf("expect ErrGroupExists within one registry, got %v", err)
+	}
+	if v, _ := ga.Get("Tom"); v.String() != "a:Tom" {
+		t.Fatalf("registry a got %q", v)
+	}
+	if v, _ := gb.Get("Tom"); v.String() != "b:Tom" {
+		t.Fatalf("registry b got %q", v)
+	}
+
+	a.DestroyGroup("scores")
+	if _, err := ga.Get("Tom"); !errors.Is(err, ErrGroupDestroyed) {
+		t.Fatalf("expect ErrGroupDestroyed, got %v", err)
+	}
+	if v, err := gb.Get("Tom"); err != nil || v.String() != "b:Tom" {
+		t.Fatalf("expect registry b untouched, got %q %v", v, err)
+	}
+	if !reflect.DeepEqual(a.ListGroups(), []string{}) || !reflect.DeepEqual(b.ListGroups(), []string{"scores"}) {
+		t.Fatalf("unexpected groups: %v %v", a.ListGroups(), b.ListGroups())
+	}
+}
+
+func TestCacheInfo(t *testing.T) {
+	for _, shards := range []int{1, 4} {
+		t.Run(strconv.Itoa(shards), func(t *testing.T) {
+			gee := newTestGroup(t, "cache-info-"+strconv.Itoa(shards), 64, GetterFunc(
+				func(key string) ([]byte, error) {
+					return []byte("0123456789"), nil
+				}), WithShards(shards))
+			if info := gee.CacheInfo(); info.Main.Entries != 0 || info.Main.OldestAge != 0 || info.Main.MaxBytes != 64 {
+				t.Fatalf("expect an empty report, got %+v", info)
+			}
+			gee.Get("k0")
+			time.Sleep(20 * time.Millisecond)
+			for i := 1; i < 20; i++ {
+				gee.Get("k" + strconv.Itoa(i))
+			}
+			gee.hotcache.add("remote", ByteView{b: []byte("v")}, time.Time{})
+
+			info := gee.CacheInfo()
+			main := gee.CacheStats().Main
+			if info.Main.Entries != main.Entries || info.Main.Bytes != main.Bytes || info.Main.Evictions != main.Evictions {
+				t.Fatalf("expect the report to match CacheStats, got %+v and %+v", info.Main, main)
+			}
+			if info.Main.Evictions == 0 || info.Main.Bytes > 64 {
+				t.Fatalf("expect evictions to keep the main cache within 64 bytes, got %+v", info.Main)
+			}
+			if info.Hot.Entries != 1 || info.Hot.Bytes != int64(len("remotev")) {
+				t.Fatalf("expect one hot entry, got %+v", info.Hot)
+			}
+			if shards == 1 && info.Main.OldestAge >= 20*time.Millisecond {
+				t.Fatalf("expect k0 evicted and the oldest entry to be recent, got %v", info.Main.OldestAge)
+			}
+
+			b, err := json.Marshal(info)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			var decoded map[string]map[string]int64
+			if err := json.Unmarshal(b, &decoded); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			for _, key := range []string{"bytes", "maxBytes", "entries", "oldestAge", "evictions"} {
+				if _, ok := decoded["main"][key]; !ok {
+					t.Fatalf("expect %q in %s", key, b)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxConcurrentLoads(t *testing.T) {
+	release := make(chan struct{})
+	var running, peak atomic.Int32
+	slow := GetterFunc(func(key string) ([]byte, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		<-release
+		return []byte(key), nil
+	})
+	waitFor := func(cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	gee := newTestGroup(t, "max-loads", 2<<10, slow, WithMaxConcurrentLoads(2))
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := gee.Get("k" + strconv.Itoa(i)); err != nil {
+				t.Errorf("get: %v", err)
+			}
+		}()
+	}
+	waitFor(func() bool { return gee.Stats().LoadsInFlight == 2 })
+	// 等待名额的加载遵守上下文
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := gee.GetContext(ctx, "late"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect the waiting load to give up, got %v", err)
+	}
+	close(release)
+	wg.Wait()
+	if p := peak.Load(); p != 2 {
+		t.Fatalf("expect at most 2 concurrent loads, peak %d", p)
+	}
+	if s := gee.Stats(); s.LoadsInFlight != 0 || s.LocalLoads != 6 || s.LoadRejections != 0 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+
+	release = make(chan struct{})
+	peak.Store(0)
+	queued := newTestGroup(t, "max-loads-queue", 2<<10, slow,
+		WithMaxConcurrentLoads(2), WithLoadQueueLimit(1), WithErrorCacheTTL(time.Minute))
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		go func() {
+			_, err := queued.Get("k" + strconv.Itoa(i))
+			errs <- err
+		}()
+	}
+	// 两个加载在进行，一个在等待，其余的立即失败
+	if err := <-errs; !errors.Is(err, ErrTooManyLoads) {
+		t.Fatalf("expect ErrTooManyLoads, got %v", err)
+	}
+	waitFor(func() bool { return queued.Stats().LoadRejections == 1 })
+	close(release)
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("expect the admitted loads to succeed, got %v", err)
+		}
+	}
+	if p := peak.Load(); p != 2 {
+		t.Fatalf("expect at most 2 concurrent loads, peak %d", p)
+	}
+	// 被拒绝的加载不会被当作数据源的错误缓存起来
+	if queued.negcache.bytes() != 0 {
+		t.Fatalf("expect ErrTooManyLoads not to be cached")
+	}
+}
+
+func TestStaleIfError(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer setNow(&clock)()
+
+	var loads atomic.Int32
+	var fail, missing atomic.Bool
+	var block chan struct{}
+	gee := newTestGroup(t, "stale-if-error", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			n := loads.Add(1)
+			if block != nil {
+				<-block
+			}
+			if missing.Load() {
+				return nil, ErrNotFound
+			}
+			if fail.Load() {
+				return nil, errors.New("database is down")
+			}
+			return []byte("v" + strconv.Itoa(int(n))), nil
+		}), WithTTL(time.Minute), WithStaleIfError(2*time.Minute), WithErrorCacheTTL(10*time.Second))
+
+	first, _ := gee.Get("k")
+	fail.Store(true)
+	clock = clock.Add(90 * time.Second)
+	v, err := gee.Get("k")
+	if err != nil || v.String() != "v1" {
+		t.Fatalf("expect the stale value within the grace window, got %q %v", v, err)
+	}
+	if !v.Expire().Equal(first.Expire()) {
+		t.Fatalf("expect the stale value's TTL not extended, got %v want %v", v.Expire(), first.Expire())
+	}
+	// 负缓存中缓存的错误同样被旧值代替，过了 errTTL 之后会再次尝试加载
+	if v, err := gee.Get("k"); err != nil || v.String() != "v1" || loads.Load() != 2 {
+		t.Fatalf("expect the cached error replaced by the stale value, got %q %v after %d loads", v, err, loads.Load())
+	}
+	clock = clock.Add(10 * time.Second)
+
+	// 并发的调用者共享同一次失败的加载，都得到旧值
+	block = make(chan struct{})
+	results := make(chan ByteView, 5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			v, err := gee.Get("k")
+			if err != nil {
+				t.Errorf("get: %v", err)
+			}
+			results <- v
+		}()
+	}
+	for gee.Stats().Loads < 7 {
+		time.Sleep(time.Millisecond)
+	}
+	close(block)
+	for i := 0; i < 5; i++ {
+		if v := <-results; v.String() != "v1" {
+			t.Fatalf("expect every waiter to get the stale value, got %q", v)
+		}
+	}
+	block = nil
+	if n := loads.Load(); n != 3 {
+		t.Fatalf("expect the waiters to share one load, got %d loads", n)
+	}
+	if s := gee.Stats(); s.StaleServes != 3 {
+		t.Fatalf("expect the shared load to count one stale serve, got %d", s.StaleServes)
+	}
+
+	// 数据源恢复、缓存的错误过期之后返回新值
+	fail.Store(false)
+	clock = clock.Add(10 * time.Second)
+	if v, err := gee.Get("k"); err != nil || v.String() != "v4" {
+		t.Fatalf("expect a fresh value after recovery, got %q %v", v, err)
+	}
+
+	// 超过 grace 之后错误照常返回
+	fail.Store(true)
+	clock = clock.Add(time.Minute + 2*time.Minute)
+	if _, err := gee.Get("k"); err == nil {
+		t.Fatalf("expect the error after the grace window")
+	}
+
+	// 确认 key 已不存在时不返回旧值
+	gee.Remove("k")
+	fail.Store(false)
+	gee.Get("k")
+	missing.Store(true)
+	clock = clock.Add(90 * time.Second)
+	if _, err := gee.Get("k"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound not to be masked, got %v", err)
+	}
+}
+
+func TestStaleIfErrorWithRefreshAhead(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer setNow(&clock)()
+
+	var fail atomic.Bool
+	gee := newTestGroup(t, "stale-refresh-ahead", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if fail.Load() {
+				return nil, errors.New("database is down")
+			}
+			return []byte("v"), nil
+		}), WithRefreshAhead(30*time.Second, time.Minute), WithStaleIfError(time.Minute))
+
+	gee.Get("k")
+	fail.Store(true)
+	// 过了软过期时间：立即返回缓存的值，后台刷新失败时保留它
+	clock = clock.Add(45 * time.Second)
+	if v, err := gee.Get("k"); err != nil || v.String() != "v" {
+		t.Fatalf("expect the cached value before the hard TTL, got %q %v", v, err)
+	}
+	waitRefreshes(t, gee)
+	if s := gee.Stats(); s.RefreshErrs != 1 || s.StaleServes != 0 {
+		t.Fatalf("expect a failed background refresh and no stale serve yet, got %+v", s)
+	}
+
+	// 硬过期之后同步地重新加载，失败时在 grace 之内返回旧值
+	clock = clock.Add(30 * time.Second)
+	if v, err := gee.Get("k"); err != nil || v.String() != "v" {
+		t.Fatalf("expect the stale value after the hard TTL, got %q %v", v, err)
+	}
+	if s := gee.Stats(); s.StaleServes != 1 || s.Refreshes != 1 {
+		t.Fatalf("expect a synchronous reload served stale, got %+v", s)
+	}
+}
+
+// pickRecorder 记录 PickPeer 收到的 key，所有 key 都属于本节点。
+type pickRecorder struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (p *pickRecorder) PickPeer(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = append(p.keys, key)
+	return nil, false
+}
+
+func normalizeKey(key string) (string, error) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	if key == "" {
+		return "", errors.New("empty key")
+	}
+	return key, nil
+}
+
+func TestKeyNormalizer(t *testing.T) {
+	var loaded []string
+	gee := newTestGroup(t, "key-normalizer", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loaded = append(loaded, key)
+			return []byte("v:" + key), nil
+		}), WithKeyNormalizer(normalizeKey))
+	picker := &pickRecorder{}
+	gee.RegisterPeers(picker)
+
+	for _, key := range []string{"Tom", " tom ", "TOM\n"} {
+		if v, err := gee.Get(key); err != nil || v.String() != "v:tom" {
+			t.Fatalf("Get(%q) = %q %v", key, v, err)
+		}
+	}
+	if !slices.Equal(loaded, []string{"tom"}) {
+		t.Fatalf("expect one load of the canonical key, got %q", loaded)
+	}
+	if slices.ContainsFunc(picker.keys, func(k string) bool { return k != "tom" }) {
+		t.Fatalf("expect PickPeer to see only the canonical key, got %q", picker.keys)
+	}
+
+	_, err := gee.Get("  ")
+	var invalid *InvalidKeyError
+	if !errors.Is(err, ErrInvalidKey) || !errors.As(err, &invalid) || invalid.Key != "  " {
+		t.Fatalf("expect an InvalidKeyError, got %v", err)
+	}
+	if err := gee.Set("", []byte("x"), 0); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("expect Set to reject the key, got %v", err)
+	}
+	if s := gee.Stats(); s.Loads != 1 {
+		t.Fatalf("expect rejected keys not to load, got %d loads", s.Loads)
+	}
+
+	if err := gee.Set(" Jack", []byte("set"), 0); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if v, ok := gee.GetCached("JACK"); !ok || v.String() != "set" {
+		t.Fatalf("expect the set value under the canonical key, got %q %v", v, ok)
+	}
+
+	values, err := gee.GetMulti(context.Background(), []string{"Tom", "jack ", "", "Sam"})
+	var errs KeyErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || !errors.Is(errs[""], ErrInvalidKey) {
+		t.Fatalf("expect only the empty key to fail, got %v", err)
+	}
+	want := map[string]string{"Tom": "v:tom", "jack ": "set", "Sam": "v:sam"}
+	if len(values) != len(want) {
+		t.Fatalf("expect values keyed by the caller's keys, got %v", values)
+	}
+	for key, v := range want {
+		if values[key].String() != v {
+			t.Fatalf("GetMulti[%q] = %q, want %q", key, values[key], v)
+		}
+	}
+
+	if err := gee.Remove(" TOM "); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if _, ok := gee.GetCached("tom"); ok {
+		t.Fatalf("expect Remove to delete the canonical key")
+	}
+}
+
+func TestChainGetter(t *testing.T) {
+	var calls []string
+	tier := func(name string, data map[string]string, errs map[string]error) GetterFunc {
+		return func(key string) ([]byte, error) {
+			calls = append(calls, name+":"+key)
+			if err := errs[key]; err != nil {
+				return nil, err
+			}
+			if v, ok := data[key]; ok {
+				return []byte(name + ":" + v), nil
+			}
+			return nil, fmt.Errorf("%s has no %s: %w", name, key, ErrNotFound)
+		}
+	}
+	down := errors.New("replica is down")
+	replica := tier("redis", map[string]string{"Tom": "630"}, map[string]error{"Sam": down})
+	primary := ContextGetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		return tier("pg", map[string]string{"Tom": "631", "Jack": "589", "Sam": "567"}, nil)(key)
+	})
+
+	always := func(error) bool { return true }
+	for _, c := range []struct {
+		name   string
+		getter *ChainedGetter
+		key    string
+		want   string
+		err    error
+		calls  []string
+	}{
+		{"first tier", ChainGetter(replica, primary), "Tom", "redis:630", nil, []string{"redis:Tom"}},
+		{"fall through on miss", ChainGetter(replica, primary), "Jack", "pg:589", nil, []string{"redis:Jack", "pg:Jack"}},
+		{"all tiers miss", ChainGetter(replica, primary), "Kate", "", ErrNotFound, []string{"redis:Kate", "pg:Kate"}},
+		{"fail fast", ChainGetter(replica, primary), "Sam", "", down, []string{"redis:Sam"}},
+		{"continue on failure", FallbackGetter(always, replica, primary), "Sam", "pg:567", nil, []string{"redis:Sam", "pg:Sam"}},
+		{"failure then miss", FallbackGetter(always, replica, tier("pg", nil, nil)), "Sam", "", down, []string{"redis:Sam", "pg:Sam"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			calls = nil
+			b, _, err := c.getter.Get(context.Background(), c.key)
+			if string(b) != c.want || !errors.Is(err, c.err) || (c.err == nil) != (err == nil) {
+				t.Fatalf("Get(%q) = %q %v, want %q %v", c.key, b, err, c.want, c.err)
+			}
+			if c.err != ErrNotFound && errors.Is(err, ErrNotFound) {
+				t.Fatalf("expect the failure not to be reported as a miss, got %v", err)
+			}
+			if !slices.Equal(calls, c.calls) {
+				t.Fatalf("calls = %q, want %q", calls, c.calls)
+			}
+		})
+	}
+
+	gee := newTestGroup(t, "chain-getter", 2<<10, ChainGetter(replica, primary))
+	for _, key := range []string{"Tom", "Jack", "Kate", "Sam"} {
+		gee.Get(key)
+	}
+	if loads := gee.ChainLoads(); !slices.Equal(loads, []int64{1, 1}) {
+		t.Fatalf("expect one load served by each tier, got %v", loads)
+	}
+	if s := gee.Stats(); s.LocalLoads != 2 || s.LocalLoadErrs != 2 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	if loads := newTestGroup(t, "plain-getter", 2<<10, replica).ChainLoads(); loads != nil {
+		t.Fatalf("expect no chain loads for a plain getter, got %v", loads)
+	}
+}
+
+func TestInterceptor(t *testing.T) {
+	var order []string
+	trace := func(name string) Interceptor {
+		return func(ctx context.Context, key string, next func() (ByteView, error)) (ByteView, error) {
+			order = append(order, name+">"+key)
+			v, err := next()
+			order = append(order, "<"+name)
+			return v, err
+		}
+	}
+	denied := errors.New("access denied")
+	auth := func(ctx context.Context, key string, next func() (ByteView, error)) (ByteView, error) {
+		if strings.HasPrefix(key, "secret") {
+			return ByteView{}, denied
+		}
+		return next()
+	}
+	var observed []error
+	logs := &recordingLogger{}
+	gee := newTestGroup(t, "interceptor", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}),
+		WithKeyNormalizer(func(key string) (string, error) { return strings.TrimSpace(key), nil }),
+		WithInterceptor(trace("outer")),
+		WithInterceptor(LatencyInterceptor(func(key string, d time.Duration, err error) {
+			observed = append(observed, err)
+		})),
+		WithInterceptor(LoggingInterceptor(logs)),
+		WithInterceptor(auth),
+		WithInterceptor(trace("inner")))
+
+	if v, err := gee.Get(" Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("get: %q %v", v, err)
+	}
+	if want := []string{"outer>Tom", "inner>Tom", "<inner", "<outer"}; !slices.Equal(order, want) {
+		t.Fatalf("expect interceptors in registration order, got %q want %q", order, want)
+	}
+
+	// 拦截器可以不调用 next 直接返回，之后的拦截器、缓存和 getter 都不会被调用
+	order = nil
+	if _, err := gee.Get("secret-plan"); err != denied {
+		t.Fatalf("expect the interceptor's error, got %v", err)
+	}
+	if want := []string{"outer>secret-plan", "<outer"}; !slices.Equal(order, want) {
+		t.Fatalf("expect the inner interceptor skipped, got %q", order)
+	}
+	if s := gee.Stats(); s.Gets != 1 || s.Loads != 1 {
+		t.Fatalf("expect the short-circuited Get not to reach the cache, got %+v", s)
+	}
+
+	if _, err := gee.Get("unknown"); err == nil {
+		t.Fatalf("expect the getter's error")
+	}
+	if len(observed) != 3 || observed[0] != nil || observed[1] != denied || observed[2] == nil {
+		t.Fatalf("expect every result observed, got %v", observed)
+	}
+	if len(logs.msgs) != 3 || !strings.Contains(logs.msgs[0], "Get Tom (3 bytes)") || !strings.Contains(logs.msgs[2], "unknown not exist") {
+		t.Fatalf("unexpected logs %q", logs.msgs)
+	}
+}
@@ -0,0 +1,70 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// groupcacheBasePath 是 groupcache 的 HTTPPool 默认的路径前缀。
+const groupcacheBasePath = "/_groupcache/"
+
+// WithGroupcacheCompat 让 HTTPPool 使用 github.com/golang/groupcache 的协议，GeeCache 节点因此可以与
+// groupcache 节点组成同一个集群，用于从 groupcache 迁移的过渡期间。
+//
+// 兼容模式下路径前缀默认为 /_groupcache/，HTTPPoolOptions.BasePath 仍然可以另外设置，但必须与 groupcache 的
+// HTTPPoolOptions.BasePath 相同。作为服务端，GET <basepath><group>/<key> 总是以只有 value 字段的
+// GetResponse 返回值，与 groupcache 的编码相同，值的存活时间和版本号放在响应头部中；节点之间的其他操作仍然可用。
+// 作为客户端，group 和 key 与 groupcache 一样按查询参数转义；作为服务端同样按查询参数解码，"+" 被解码为空格。
+// PickPeer 返回的节点只支持获取值（PeerGetter），Set、Remove、批量获取等 groupcache 没有的操作
+// 由本节点处理，就像节点没有实现这些可选接口一样。
+//
+// 一致性哈希环的虚拟节点与 groupcache 相同，都是 CRC32(strconv.Itoa(i) + 节点地址)，
+// 因此只要所有节点以相同的字符串列出同样的节点（小写的主机名，末尾没有 "/"），并且 HTTPPoolOptions.Replicas
+// 和 HashFn 与 groupcache 的 HTTPPoolOptions 相同（默认都是 50 和 CRC32），两者对 key 的拥有者的判断就相同。
+// groupcache 节点不支持签名和健康检查接口，兼容模式下不应设置 HTTPPoolOptions.Secret 或启用 WithHealthCheck。
+//
+// 返回值:
+//
+//	PoolOption: 可传递给 NewHTTPPool 的配置项。
+func WithGroupcacheCompat() PoolOption {
+	return func(p *HTTPPool) {
+		p.groupcache = true
+	}
+}
+
+// peerGetter 返回 PickPeer 和 PickPeers 交给 Group 的节点，兼容模式下只暴露 groupcache 支持的操作。
+func (h *HTTPPool) peerGetter(getter *httpGetter) PeerGetter {
+	if h.groupcache {
+		return groupcacheGetter{getter}
+	}
+	return getter
+}
+
+// groupcacheGetter 是兼容模式下的远程节点，它只通过 GET 获取值，见 WithGroupcacheCompat。
+type groupcacheGetter struct {
+	h *httpGetter
+}
+
+// Get 实现了 PeerGetter 接口。
+func (g groupcacheGetter) Get(ctx context.Context, group string, key string) ([]byte, error) {
+	return g.h.Get(ctx, group, key)
+}
+
+// getValue 实现了 peerValueGetter 接口。GeeCache 节点在响应头部中返回的存活时间和版本号会被读取，
+// groupcache 节点的值没有存活时间。
+func (g groupcacheGetter) getValue(ctx context.Context, group string, key string, fresh bool) (PeerResult, error) {
+	return g.h.getValue(ctx, group, key, fresh)
+}
+
+// String 返回节点的地址，用作指标中的节点名称。
+func (g groupcacheGetter) String() string {
+	return g.h.String()
+}
+
+// groupcacheKeyURL 与 groupcache 一样按查询参数转义 group 和 key，key 中的空格因此变成 "+"。
+// 兼容模式的 GeeCache 节点会把 "+" 解码回空格；groupcache 节点只对路径做一次解码，它读到的 key 中空格仍然是 "+"，
+// 这与 groupcache 节点之间的行为相同。
+func (h *httpGetter) groupcacheKeyURL(group string, key string) string {
+	return fmt.Sprintf("%v%v/%v", h.baseURL, url.QueryEscape(group), url.QueryEscape(key))
+}
@@ -0,0 +1,6 @@
+// Package groupcachecompat 验证 geecache.WithGroupcacheCompat 与 github.com/golang/groupcache 的互通。
+//
+// 它是一个只有测试的独立模块，groupcache 只是测试的依赖，geecache 本身不依赖它：
+// 测试在同一个进程中启动一个 groupcache 节点和一个 GeeCache 节点，检查两者对 key 的拥有者的判断相同，
+// 并且各自都能从对方获取由对方负责的 key。
+package groupcachecompat
@@ -0,0 +1,17 @@
+module GeeCache/geecache/groupcachecompat
+
+go 1.24.2
+
+require (
+	GeeCache v0.0.0-00010101000000-000000000000
+	github.com/golang/groupcache v0.0.0-20241129210726-2c02b8208cf8
+)
+
+require (
+	github.com/golang/protobuf v1.5.4 // indirect
+	golang.org/x/net v0.41.0 // indirect
+	golang.org/x/text v0.26.0 // indirect
+	google.golang.org/protobuf v1.36.12 // indirect
+)
+
+replace GeeCache => ../../
@@ -0,0 +1,125 @@
+package groupcachecompat
+
+import (
+	"GeeCache/geecache"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang/groupcache"
+	"github.com/golang/groupcache/consistenthash"
+)
+
+// loads 记录一个节点的 getter 被调用时的 key。
+type loads struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (l *loads) add(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.keys = append(l.keys, key)
+}
+
+func (l *loads) has(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Contains(l.keys, key)
+}
+
+// startServer 在 l 上以 h 启动一个测试服务器。
+func startServer(t *testing.T, l net.Listener, h http.Handler) {
+	srv := &httptest.Server{Listener: l, Config: &http.Server{Handler: h}}
+	srv.Start()
+	t.Cleanup(srv.Close)
+}
+
+func listen(t *testing.T) (net.Listener, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l, "http://" + l.Addr().String()
+}
+
+func TestGroupcacheInterop(t *testing.T) {
+	geecache.SetLogger(geecache.NopLogger{})
+	defer geecache.SetLogger(nil)
+	gl, gcURL := listen(t)
+	el, geeURL := listen(t)
+	peers := []string{gcURL, geeURL}
+
+	// groupcache 节点：NewHTTPPoolOpts 在一个进程中只能调用一次
+	gcPool := groupcache.NewHTTPPoolOpts(gcURL, &groupcache.HTTPPoolOptions{})
+	gcPool.Set(peers...)
+	var gcLoads loads
+	gcGroup := groupcache.NewGroup("scores", 1<<20, groupcache.GetterFunc(
+		func(ctx context.Context, key string, dest groupcache.Sink) error {
+			gcLoads.add(key)
+			return dest.SetString("groupcache:" + key)
+		}))
+	startServer(t, gl, gcPool)
+
+	// GeeCache 节点
+	r := geecache.NewRegistry()
+	geePool := geecache.NewHTTPPool(geeURL, geecache.WithRegistry(r), geecache.WithGroupcacheCompat())
+	if err := geePool.Set(peers...); err != nil {
+		t.Fatal(err)
+	}
+	var geeLoads loads
+	geeGroup := r.NewGroup("scores", 1<<20, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			geeLoads.add(key)
+			return []byte("geecache:" + key), nil
+		}), geecache.WithHotCacheRate(0), geecache.WithPeerRetry(0, 0))
+	geeGroup.RegisterPeers(geePool)
+	startServer(t, el, geePool)
+
+	// 两边对每个 key 的拥有者的判断相同
+	ring := consistenthash.New(50, nil)
+	ring.Add(peers...)
+	// groupcache 节点读到的 key 中空格仍然是 "+"，由它负责的 key 不含空格；GeeCache 会把 "+" 解码回空格
+	var gcKey, geeKey string
+	for i := range 1000 {
+		for _, key := range []string{fmt.Sprintf("user-%d/profile", i), fmt.Sprintf("user %d/profile", i)} {
+			owner := ring.Get(key)
+			if _, remote := geePool.PickPeer(key); remote != (owner == gcURL) {
+				t.Fatalf("%q: groupcache picks %s, GeeCache picks remote=%v", key, owner, remote)
+			}
+			if owner == gcURL && gcKey == "" && !strings.Contains(key, " ") {
+				gcKey = key
+			}
+			if owner == geeURL && geeKey == "" && strings.Contains(key, " ") {
+				geeKey = key
+			}
+		}
+	}
+	if gcKey == "" || geeKey == "" {
+		t.Fatal("expect both nodes to own some keys")
+	}
+
+	// GeeCache 从 groupcache 获取由 groupcache 负责的 key
+	v, err := geeGroup.Get(gcKey)
+	if err != nil || v.String() != "groupcache:"+gcKey {
+		t.Fatalf("GeeCache from groupcache: got %q %v", v, err)
+	}
+	if !gcLoads.has(gcKey) || geeLoads.has(gcKey) {
+		t.Fatalf("expect %q loaded by groupcache only, groupcache %q, GeeCache %q", gcKey, gcLoads.keys, geeLoads.keys)
+	}
+
+	// groupcache 从 GeeCache 获取由 GeeCache 负责的 key
+	var s string
+	if err := gcGroup.Get(context.Background(), geeKey, groupcache.StringSink(&s)); err != nil || s != "geecache:"+geeKey {
+		t.Fatalf("groupcache from GeeCache: got %q %v", s, err)
+	}
+	if !geeLoads.has(geeKey) || gcLoads.has(geeKey) {
+		t.Fatalf("expect %q loaded by GeeCache only, groupcache %q, GeeCache %q", geeKey, gcLoads.keys, geeLoads.keys)
+	}
+}
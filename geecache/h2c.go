@@ -0,0 +1,203 @@
+package geecache
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// h2cRetryInterval 是回退到 HTTP/1.1 的节点再次尝试 h2c 之前的时间，滚动升级之后的节点因此会重新使用 HTTP/2。
+const h2cRetryInterval = time.Minute
+
+// WithH2C 让 HTTPPool 在节点之间使用不加密的 HTTP/2（h2c），一对节点之间的并发请求复用同一个连接，
+// 不再为每个并发请求建立一个 HTTP/1.1 连接。
+//
+// 作为服务端，ServeHTTP 接受以 prior knowledge 建立的 h2c 连接和 Upgrade: h2c 请求，
+// 连接上的请求交给服务器的根 handler，与 HTTP/1.1 的请求经过同样的 handler；
+// prior knowledge 的连接以 "PRI *" 开始，因此 HTTPPool 需要是服务器的根 handler，或者在根 handler 中
+// 把这样的请求交给它。没有 h2c 的请求仍然按 HTTP/1.1 处理。
+//
+// 作为客户端，发往 http:// 节点的请求以 prior knowledge 使用 h2c；节点拒绝 h2c 时（例如没有启用 WithH2C
+// 的旧版本节点）GET 和 HEAD 请求以 HTTP/1.1 重新发出，之后一段时间内发往这个节点的请求直接使用 HTTP/1.1，
+// 因此启用和没有启用的节点可以在同一个集群中共存。https:// 节点不受影响，它们通过 TLS 的 ALPN 协商协议。
+// 客户端的 Transport 必须是 *http.Transport，否则 NewHTTPPoolOpts 返回错误。
+//
+// 返回值:
+//
+//	PoolOption: 可传递给 NewHTTPPool 的配置项。
+func WithH2C() PoolOption {
+	return func(p *HTTPPool) {
+		p.h2cServer = &http2.Server{}
+	}
+}
+
+// isH2C 报告 r 是否开始一个 h2c 连接：prior knowledge 的连接前言或者 Upgrade: h2c 请求。
+func isH2C(r *http.Request) bool {
+	if r.Method == "PRI" && r.ProtoMajor == 2 && r.RequestURI == "*" {
+		return true
+	}
+	return headerHasToken(r.Header, "Upgrade", "h2c") && headerHasToken(r.Header, "Connection", "HTTP2-Settings")
+}
+
+// headerHasToken 报告 header 中逗号分隔的 name 的值是否包含 token，不区分大小写。
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, v := range header.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serveH2C 在 r 的连接上提供 h2c，连接上的请求交给服务器的根 handler，没有时交给 h。
+func (h *HTTPPool) serveH2C(w http.ResponseWriter, r *http.Request) {
+	var root http.Handler = h
+	if srv, ok := r.Context().Value(http.ServerContextKey).(*http.Server); ok {
+		root = srv.Handler
+		if root == nil {
+			root = http.DefaultServeMux
+		}
+	}
+	h2c.NewHandler(root, h.h2cServer).ServeHTTP(w, r)
+}
+
+// h2cTransport 以 h2c 发出 http:// 的请求，节点不支持时回退到 HTTP/1.1，见 WithH2C。
+type h2cTransport struct {
+	h2 *http2.Transport
+	h1 *http.Transport // https:// 的请求和回退的请求使用的 Transport
+
+	mu    sync.Mutex
+	http1 map[string]time.Time // 回退到 HTTP/1.1 的节点和回退的时间
+}
+
+// newH2CTransport 返回以 t 的拨号设置建立 h2c 连接、以 t 发出其他请求的 h2cTransport。
+func newH2CTransport(t *http.Transport) *h2cTransport {
+	dial := t.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: defaultDialTimeout}).DialContext
+	}
+	return &h2cTransport{
+		h2: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				c, err := dial(ctx, network, addr)
+				if err != nil {
+					return nil, err
+				}
+				return &h2cConn{Conn: c}, nil
+			},
+		},
+		h1:    t,
+		http1: make(map[string]time.Time),
+	}
+}
+
+// RoundTrip 实现了 http.RoundTripper 接口。
+//
+// 只有节点拒绝了 h2c 的连接前言时才回退：节点以 HTTP/1.1 的响应回应，或者连接在节点发送任何数据之前就断开了，
+// 节点因此没有以 HTTP/2 处理这个请求，见 h2cConn.rejected。
+// 这时之后 h2cRetryInterval 之内发往这个节点的请求直接使用 HTTP/1.1，GET 和 HEAD 请求在调用方的上下文
+// 仍未结束时立即以 HTTP/1.1 重新发出，其他方法的请求返回原来的错误，由调用方决定是否重试。
+// 其他错误（例如连接失败、节点在处理请求的过程中断开）原样返回。
+func (t *h2cTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "http" || t.useHTTP1(req.URL.Host) {
+		return t.h1.RoundTrip(req)
+	}
+	// http2.Transport 可能在新的连接上重试请求，其中任何一个连接被拒绝都说明节点不支持 h2c
+	var conns []*h2cConn
+	trace := &httptrace.ClientTrace{GotConn: func(info httptrace.GotConnInfo) {
+		if c, ok := info.Conn.(*h2cConn); ok {
+			conns = append(conns, c)
+		}
+	}}
+	rsp, err := t.h2.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err == nil || !slices.ContainsFunc(conns, (*h2cConn).rejected) {
+		return rsp, err
+	}
+	t.mu.Lock()
+	t.http1[req.URL.Host] = now()
+	t.mu.Unlock()
+	if req.Method != http.MethodGet && req.Method != http.MethodHead || req.Context().Err() != nil {
+		return nil, err
+	}
+	retry := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, err
+		}
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return t.h1.RoundTrip(retry)
+}
+
+// useHTTP1 报告发往 host 的请求是否应当直接使用 HTTP/1.1。
+func (t *h2cTransport) useHTTP1(host string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	since, ok := t.http1[host]
+	if ok && now().Sub(since) >= h2cRetryInterval {
+		delete(t.http1, host)
+		return false
+	}
+	return ok
+}
+
+// h2cClosed 是 h2cConn.first 的特殊值，表示连接在读到任何数据之前就失败或者被关闭了。
+const h2cClosed = -1
+
+// h2cConn 记录连接上读到的第一个字节，用来判断节点是否以 HTTP/2 回应了连接前言。
+type h2cConn struct {
+	net.Conn
+	first atomic.Int32 // 读到的第一个字节加上 0x100，0 表示还没有读到任何数据
+}
+
+func (c *h2cConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.first.CompareAndSwap(0, int32(b[0])|0x100)
+	} else if err != nil {
+		c.first.CompareAndSwap(0, h2cClosed)
+	}
+	return n, err
+}
+
+func (c *h2cConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if err != nil {
+		c.first.CompareAndSwap(0, h2cClosed)
+	}
+	return n, err
+}
+
+func (c *h2cConn) Close() error {
+	c.first.CompareAndSwap(0, h2cClosed)
+	return c.Conn.Close()
+}
+
+// rejected 报告节点是否拒绝了连接前言：节点以 HTTP/1.1 的响应回应，或者连接在节点发送任何数据之前就断开了。
+// HTTP/2 的节点首先发送的 SETTINGS 帧以帧长度的最高字节开始，不会是 HTTP/1.1 响应的 'H'。
+// 仍然打开、还没有读到数据的连接不算被拒绝，节点可能只是还没有发送 SETTINGS 帧就开始处理请求。
+func (c *h2cConn) rejected() bool {
+	first := c.first.Load()
+	return first == h2cClosed || first == 'H'|0x100
+}
+
+// CloseIdleConnections 关闭两个 Transport 中的空闲连接。
+func (t *h2cTransport) CloseIdleConnections() {
+	t.h2.CloseIdleConnections()
+	t.h1.CloseIdleConnections()
+}
@@ -0,0 +1,193 @@
+package geecache
+
+import (
+	"GeeCache/consistenthash"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// healthzPath 是健康检查接口相对于 basePath 的路径，节点总是提供它，见 WithHealthCheck。
+	healthzPath = "-/healthz"
+	// defaultHealthFailures 和 defaultHealthRecoveries 是 WithHealthCheck 默认的连续失败和连续成功次数。
+	defaultHealthFailures   = 3
+	defaultHealthRecoveries = 2
+)
+
+// WithHealthCheck 让 HTTPPool 在后台定期探测每个远程节点的 GET <basePath>-/healthz，
+// 把连续 failures 次探测失败的节点暂时移出一致性哈希环，在它连续 recoveries 次探测成功之后再加回来。
+//
+// 节点被移出期间，它负责的 key 由环上的下一个节点负责，PickPeer 和 PickPeers 不再返回它，
+// 请求不必每次等到超时才回退；所有远程节点都被移出时 key 全部在本地加载。
+// 每次探测的时限为 interval，返回 200 以外的状态码或请求失败都算作失败。
+// 环的变化在持有 HTTPPool 的锁时一次替换，调用 Set 时仍在列表中的节点保留它们的健康状态，
+// 新加入的节点被视为健康的。本节点自己（self）不会被探测。
+//
+// 健康检查接口很轻量，不会计入 PoolStats.Requests，也不会访问任何 Group；
+// 名为 "-" 的 group 中的 key "healthz" 因此不能被其他节点访问。
+// 启用之后需要在不再使用 HTTPPool 时调用 Close 停止后台的探测。
+//
+// 参数:
+//
+//	interval: 两轮探测之间的间隔，小于等于 0 时不启用。
+//	failures: 节点被移出环之前连续失败的次数，小于 1 时为 3。
+//	recoveries: 被移出的节点加回环之前连续成功的次数，小于 1 时为 2。
+//
+// 返回值:
+//
+//	PoolOption: 可传递给 NewHTTPPool 的配置项。
+func WithHealthCheck(interval time.Duration, failures, recoveries int) PoolOption {
+	return func(p *HTTPPool) {
+		if failures < 1 {
+			failures = defaultHealthFailures
+		}
+		if recoveries < 1 {
+			recoveries = defaultHealthRecoveries
+		}
+		p.healthInterval = max(interval, 0)
+		p.healthFailures = failures
+		p.healthRecoveries = recoveries
+	}
+}
+
+// peerHealth 是 WithHealthCheck 记录的一个远程节点的健康状态，由 HTTPPool 的锁保护。
+type peerHealth struct {
+	down   bool // 是否已被移出一致性哈希环
+	streak int  // 健康时为连续失败的次数，被移出时为连续成功的次数
+}
+
+// Close 停止 WithHealthCheck 启动的后台探测，并把 h 从 PublishExpvar 导出的 geecache.pools 中移除。可以多次调用。
+func (h *HTTPPool) Close() {
+	if h.stop != nil {
+		h.stopOnce.Do(func() { close(h.stop) })
+	}
+	unpublishPool(h)
+}
+
+// runHealthCheck 每隔 healthInterval 探测一轮远程节点，直到 Close 被调用。
+func (h *HTTPPool) runHealthCheck() {
+	tick := time.NewTicker(h.healthInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-tick.C:
+			h.probePeers()
+		}
+	}
+}
+
+// probePeers 并发地探测当前所有远程节点，然后在持有锁时更新它们的健康状态，需要时重建一致性哈希环。
+func (h *HTTPPool) probePeers() {
+	h.mu.Lock()
+	getters := make(map[string]*httpGetter, len(h.httpGetters))
+	for peer, getter := range h.httpGetters {
+		if peer != h.self {
+			getters[peer] = getter
+		}
+	}
+	h.mu.Unlock()
+
+	var mu sync.Mutex
+	healthy := make(map[string]bool, len(getters))
+	var wg sync.WaitGroup
+	for peer, getter := range getters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok := h.probe(getter)
+			mu.Lock()
+			healthy[peer] = ok
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	changed := false
+	for peer, ok := range healthy {
+		if h.httpGetters[peer] != getters[peer] {
+			// 探测期间 Set 替换或移除了这个节点
+			continue
+		}
+		if h.observeHealth(peer, ok) {
+			changed = true
+		}
+	}
+	if changed {
+		h.rebuildRing()
+	}
+}
+
+// probe 向 getter 的健康检查接口发起一次请求，返回 200 时认为节点健康。
+func (h *HTTPPool) probe(getter *httpGetter) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), h.healthInterval)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, getter.baseURL+healthzPath, nil)
+	if err != nil {
+		return false
+	}
+	rsp, err := getter.do(req)
+	if err != nil {
+		return false
+	}
+	rsp.Body.Close()
+	return rsp.StatusCode == http.StatusOK
+}
+
+// observeHealth 记录对 peer 的一次探测结果，返回它是否因此被移出或加回一致性哈希环。调用方需要持有 h.mu。
+func (h *HTTPPool) observeHealth(peer string, ok bool) bool {
+	s := h.health[peer]
+	if s == nil {
+		s = &peerHealth{}
+		h.health[peer] = s
+	}
+	if ok == !s.down {
+		s.streak = 0
+		return false
+	}
+	s.streak++
+	if !s.down && s.streak >= h.healthFailures {
+		s.down, s.streak = true, 0
+		h.Log("peer %s is unhealthy, removing it from the ring", peer)
+		return true
+	}
+	if s.down && s.streak >= h.healthRecoveries {
+		s.down, s.streak = false, 0
+		h.Log("peer %s recovered, adding it back to the ring", peer)
+		return true
+	}
+	return false
+}
+
+// rebuildRing 用 Set 设置的节点中当前健康的那些重建一致性哈希环。调用方需要持有 h.mu。
+func (h *HTTPPool) rebuildRing() {
+	ring := make([]string, 0, len(h.members))
+	for _, peer := range h.members {
+		if s := h.health[peer]; s == nil || !s.down {
+			ring = append(ring, peer)
+		}
+	}
+	h.peers = consistenthash.New(h.replicas, h.hashFn)
+	h.peers.Add(ring...)
+}
+
+// serveHealthz 处理健康检查接口，节点能处理请求时返回 200，Shutdown 开始之后返回 503 和 "draining"。
+func (h *HTTPPool) serveHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if h.drain.isDraining() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("draining\n"))
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
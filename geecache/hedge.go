@@ -0,0 +1,111 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// defaultMaxHedges 是 WithHedging 默认允许同时进行的对冲请求数量。
+const defaultMaxHedges = 16
+
+// WithHedging 为远程获取启用对冲请求，降低个别节点偶尔变慢造成的尾延迟。
+//
+// 向第一个拥有者发出的请求超过 delay 还没有结果时，再向环上的下一个节点发出一个相同的请求，
+// 两者中先成功（或确认 key 不存在）的结果被使用，另一个请求随即被取消。delay 通常取远程获取延迟的 p95。
+// 每次加载最多对冲一次；同时进行的对冲请求超过 maxInFlight 时不再对冲，只等待第一个拥有者，
+// 避免整个集群变慢时请求量翻倍。delay 之前第一个拥有者失败时，与 WithOwnerCandidates 一样
+// 立即请求下一个节点，这不算作对冲。对冲需要注册的 PeerPicker 实现 PeerListPicker，
+// 候选节点不足两个时 WithOwnerCandidates 被视为 2。对冲和胜出的次数见 Stats.Hedges 和 Stats.HedgeWins。
+//
+// 参数:
+//
+//	delay: 发出对冲请求之前等待的时间，小于等于 0 时不启用。
+//	maxInFlight: 同时进行的对冲请求的最大数量，小于等于 0 时为 16。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithHedging(delay time.Duration, maxInFlight int) GroupOption {
+	return func(g *Group) {
+		if maxInFlight <= 0 {
+			maxInFlight = defaultMaxHedges
+		}
+		g.hedgeDelay = max(delay, 0)
+		g.maxHedges = int64(maxInFlight)
+	}
+}
+
+// hedgedFetch 返回先调用 primary、超过 hedgeDelay 还没有结果时再调用 secondary 的函数，见 WithHedging。
+func (g *Group) hedgedFetch(primary, secondary peerFetch) peerFetch {
+	return func(ctx context.Context) (ByteView, error) {
+		type result struct {
+			v         ByteView
+			err       error
+			secondary bool
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		results := make(chan result, 2)
+		start := func(fetch peerFetch, isSecondary bool, release func()) {
+			go func() {
+				if release != nil {
+					defer release()
+				}
+				v, err := fetch(ctx)
+				results <- result{v, err, isSecondary}
+			}()
+		}
+		start(primary, false, nil)
+		timer := time.NewTimer(g.hedgeDelay)
+		defer timer.Stop()
+
+		// started 表示 secondary 已经被调用，hedged 表示它是作为对冲被调用的
+		pending, started, hedged := 1, false, false
+		for {
+			select {
+			case <-timer.C:
+				if !started && g.acquireHedge() {
+					started, hedged = true, true
+					pending++
+					g.stats.hedges.Add(1)
+					start(secondary, true, func() { g.hedging.Add(-1) })
+				}
+			case r := <-results:
+				pending--
+				if r.err == nil || errors.Is(r.err, ErrNotFound) || ctx.Err() != nil {
+					if r.secondary && r.err == nil {
+						g.stats.secondaryLoads.Add(1)
+						if hedged {
+							g.stats.hedgeWins.Add(1)
+						}
+					}
+					return r.v, r.err
+				}
+				if pending > 0 {
+					// 另一个请求还在进行，等待它的结果；最后一次失败由调用方计数
+					g.stats.peerErrors.Add(1)
+					continue
+				}
+				if started {
+					return ByteView{}, r.err
+				}
+				// 对冲之前第一个拥有者已经失败，与不对冲时一样请求下一个节点
+				g.stats.peerErrors.Add(1)
+				g.logf("[GeeCache] Failed to get from peer, will try the next owner: %v", r.err)
+				started = true
+				pending++
+				start(secondary, true, nil)
+			}
+		}
+	}
+}
+
+// acquireHedge 在同时进行的对冲请求少于 WithHedging 的上限时占用一个名额并返回 true。
+func (g *Group) acquireHedge() bool {
+	if g.hedging.Add(1) > g.maxHedges {
+		g.hedging.Add(-1)
+		return false
+	}
+	return true
+}
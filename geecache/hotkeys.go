@@ -0,0 +1,131 @@
+package geecache
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// sketchDepth 和 sketchWidth 是 count-min sketch 的行数和每行的计数器数量。
+	sketchDepth = 4
+	sketchWidth = 1024
+	// hotKeyWindow 是统计访问频率的时间窗口，阈值按每个窗口内的访问次数比较。
+	hotKeyWindow = time.Second
+	// defaultHotKeyTTL 是热点 key 复制到本地后的默认存活时间。
+	defaultHotKeyTTL = time.Second
+	// defaultMaxHotKeys 是同时复制到本地的热点 key 的默认数量上限。
+	defaultMaxHotKeys = 64
+)
+
+// hotKeys 用 count-min sketch 统计最近一个时间窗口内各个 key 的访问次数，
+// 并记录当前被复制到本地 hotcache 的热点 key。
+//
+// count-min sketch 只会高估访问次数，因此偶尔会把一个不够热的 key 当作热点，
+// 但不会漏掉真正的热点。每个时间窗口开始时计数器会被清零。
+type hotKeys struct {
+	qps     uint32        // 一个窗口内访问次数达到 qps 的 key 被当作热点
+	ttl     time.Duration // 热点 key 复制到本地后的存活时间
+	maxKeys int           // 同时复制到本地的热点 key 的数量上限
+
+	mu         sync.Mutex
+	window     time.Time // 当前窗口的开始时间
+	counts     [sketchDepth][sketchWidth]uint32
+	replicated map[string]time.Time // 已复制的 key 及其过期时间
+}
+
+// newHotKeys 创建一个热点 key 统计器。
+func newHotKeys(qps int, ttl time.Duration, maxKeys int) *hotKeys {
+	return &hotKeys{
+		qps:        uint32(qps),
+		ttl:        ttl,
+		maxKeys:    maxKeys,
+		replicated: make(map[string]time.Time),
+	}
+}
+
+// hash 返回 key 的两个独立哈希值，各行的下标由它们线性组合得到。
+func (h *hotKeys) hash(key string) (uint32, uint32) {
+	h1 := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h1 ^= uint64(key[i])
+		h1 *= 1099511628211
+	}
+	return uint32(h1), uint32(h1>>32) | 1
+}
+
+// roll 在当前窗口结束时清零所有计数器。调用方需要持有 h.mu。
+func (h *hotKeys) roll(t time.Time) {
+	if t.Sub(h.window) < hotKeyWindow {
+		return
+	}
+	h.window = t
+	h.counts = [sketchDepth][sketchWidth]uint32{}
+}
+
+// record 记录一次对 key 的访问。
+func (h *hotKeys) record(key string) {
+	a, b := h.hash(key)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.roll(now())
+	for i := range h.counts {
+		if c := &h.counts[i][(a+uint32(i)*b)%sketchWidth]; *c < ^uint32(0) {
+			*c++
+		}
+	}
+}
+
+// hot 返回 key 在当前窗口内的估计访问次数是否达到阈值。
+func (h *hotKeys) hot(key string) bool {
+	a, b := h.hash(key)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.roll(now())
+	for i := range h.counts {
+		if h.counts[i][(a+uint32(i)*b)%sketchWidth] < h.qps {
+			return false
+		}
+	}
+	return true
+}
+
+// replicate 尝试把 key 登记为已复制的热点 key，并返回它在本地的过期时间。
+// 已复制的 key 数量达到上限时返回 false。
+func (h *hotKeys) replicate(key string) (time.Time, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t := now()
+	if _, ok := h.replicated[key]; !ok && len(h.replicated) >= h.maxKeys {
+		h.purge(t)
+		if len(h.replicated) >= h.maxKeys {
+			return time.Time{}, false
+		}
+	}
+	expireAt := t.Add(h.ttl)
+	h.replicated[key] = expireAt
+	return expireAt, true
+}
+
+// forget 取消 key 的复制登记。
+func (h *hotKeys) forget(key string) {
+	h.mu.Lock()
+	delete(h.replicated, key)
+	h.mu.Unlock()
+}
+
+// purge 删除已经过期的复制登记。调用方需要持有 h.mu。
+func (h *hotKeys) purge(t time.Time) {
+	for key, expireAt := range h.replicated {
+		if !t.Before(expireAt) {
+			delete(h.replicated, key)
+		}
+	}
+}
+
+// len 返回当前尚未过期的已复制热点 key 的数量。
+func (h *hotKeys) len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.purge(now())
+	return len(h.replicated)
+}
@@ -2,18 +2,77 @@ package geecache
 
 import (
 	"GeeCache/consistenthash"
+	"GeeCache/geecachepb"
+	"GeeCache/lru"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"path"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/proto"
 )
 
 const (
 	defaultBasePath = "/_geecache/"
 	defaultReplicas = 50
+	// defaultPeerTimeout 是向远程节点的一次请求默认的总时限，包括读取响应体。
+	defaultPeerTimeout = 2 * time.Second
+	// defaultDialTimeout 是默认的客户端建立连接和完成 TLS 握手各自的时限。
+	defaultDialTimeout = time.Second
+	// defaultMaxIdleConnsPerHost 是默认的客户端为每个节点保留的空闲连接数量。节点不多而请求很多，
+	// http.DefaultTransport 的 2 个会让突发的请求不断建立和关闭连接。
+	defaultMaxIdleConnsPerHost = 64
+	// ttlHeader 是旧版本的节点在 GET 响应中携带值剩余存活时间的头部，值为 time.Duration 的字符串形式。
+	// 拥有者与 ttlMsHeader 一起写入，让只认识它的旧版本请求方仍然能限制热点副本的存活时间。
+	ttlHeader = "X-GeeCache-TTL"
+	// ttlMsHeader 是 PUT 请求中携带值的存活时间、GET 响应中携带值剩余存活时间的头部，值为毫秒数。
+	// PUT 请求中旧版本的节点使用 ttl 查询参数，GET 响应中旧版本的节点只写入 ttlHeader，
+	// 两种都接受，ttlMsHeader 优先。
+	ttlMsHeader = "X-GeeCache-TTL-Ms"
+	// defaultMaxBodyBytes 是 PUT 请求体默认的大小上限，见 WithMaxBodyBytes。
+	defaultMaxBodyBytes = 32 << 20
+	// defaultMaxBatchKeys 是一次批量获取请求中 key 的数量默认的上限，见 WithMaxBatchKeys。
+	defaultMaxBatchKeys = 100
+	// maxEachRequests 是 GetMulti 向不支持批量请求的旧版本节点同时发出的单独请求的数量上限。
+	maxEachRequests = 8
+	// errorHeader 标记 404 响应的原因，值为 notFoundReason 时表示 key 在数据源中不存在，
+	// 用于和 group 不存在等其他 404 区分开。
+	errorHeader    = "X-GeeCache-Error"
+	notFoundReason = "not-found"
+	// unavailableReason 是拥有者的加载暂时失败、返回 503 时 errorHeader 的值，见 ErrPeerUnavailable。
+	unavailableReason = "unavailable"
+	// internalReason 是拥有者的加载发生意外的错误、返回 500 时 errorHeader 的值，见 ErrPeerInternal。
+	internalReason = "internal"
+	// retryAfterSeconds 是 503 响应中 Retry-After 的值。
+	retryAfterSeconds = "1"
+	// allowedMethods 是 ServeHTTP 支持的方法，其他方法的请求以 405 拒绝。
+	allowedMethods = "GET, HEAD, POST, PUT, DELETE"
+	// statsPath 是统计接口相对于 basePath 的路径，见 WithStatsEndpoint。
+	statsPath = "-/stats"
+	// noStoreHeader 标记响应中的值不应被请求方缓存，见 WithCacheFilter 和 CacheOptions.NoStore。
+	noStoreHeader = "X-GeeCache-No-Store"
+	// versionHeader 是 GET 响应中携带值的版本号的头部，也是 SetIfVersion 成功之后返回新版本号的头部。
+	versionHeader = "X-GeeCache-Version"
+	// versionMismatchReason 是 SetIfVersion 因版本号不一致返回 409 时 errorHeader 的值。
+	versionMismatchReason = "version-mismatch"
+	// protobufType 是以 geecachepb.GetResponse 编码的响应的 Content-Type。
+	// 请求方在 Accept 中声明它时，成功的 GET 响应以 GetResponse 编码，否则返回原始的字节和上面的头部。
+	protobufType = "application/x-protobuf"
 )
 
 // HTTPPool 作为一个 HTTP 服务端，负责处理节点间的通信。
@@ -23,70 +82,1335 @@ type HTTPPool struct {
 	mu          sync.Mutex             //锁机制，并发安全
 	peers       *consistenthash.Map    //一致性哈希结构体
 	httpGetters map[string]*httpGetter //通过节点的名称作为键找到httpGetter的地址
+	requests    atomic.Int64           // ServeHTTP 处理的请求数量
+	registry    *Registry              // ServeHTTP 从中查找 Group，默认为包级别函数使用的 Registry
+	client      *http.Client           // 向其他节点发起请求使用的客户端
+	timeout     *time.Duration         // WithPeerTimeout 设置的时限，为 nil 时不修改 client
+	transport   http.RoundTripper      // WithTransport 设置的 RoundTripper，为 nil 时不修改 client
+	replicas    int                    // 一致性哈希环上每个节点的虚拟节点数量
+	hashFn      consistenthash.Hash    // 一致性哈希环使用的哈希函数，为 nil 时使用 crc32
+	maxBody     int64                  // PUT 请求体的大小上限，小于等于 0 时不限制
+	maxBatch    int                    // 批量获取请求中 key 的数量上限
+	statsOn     bool                   // 是否提供 WithStatsEndpoint 的统计接口
+
+	members          []string               // Set 设置的所有节点，一致性哈希环只包含其中健康的节点
+	health           map[string]*peerHealth // WithHealthCheck 记录的远程节点的健康状态，由 mu 保护
+	healthInterval   time.Duration          // 两轮健康检查之间的间隔，为 0 时不启用
+	healthFailures   int                    // 节点被移出环之前连续失败的次数
+	healthRecoveries int                    // 被移出的节点加回环之前连续成功的次数
+	stop             chan struct{}          // 关闭之后后台的健康检查退出
+	stopOnce         sync.Once
+
+	secret          []byte // 节点之间的请求签名使用的密钥，为空时不认证
+	skipHealthzAuth bool   // 健康检查接口是否不要求签名
+
+	tlsConfig *tls.Config   // WithTLSConfig 设置的 TLS 配置，为 nil 时不修改 client
+	serverTLS *tls.Config   // WithServerTLSConfig 设置的服务端 TLS 配置
+	h2cServer *http2.Server // WithH2C 设置的 h2c 服务端，为 nil 时不使用 h2c
+
+	compress    bool // 是否压缩响应体并在请求中声明接受 gzip
+	compressMin int  // 压缩响应体的最小字节数
+
+	breakerFailures int           // 打开熔断器需要的失败次数，小于等于 0 时不熔断
+	breakerWindow   time.Duration // 统计失败次数的时间窗口
+	breakerCooldown time.Duration // 熔断器打开之后到放行探测请求的时间
+
+	maxPeerRequests  int  // 发往每个远程节点的并发获取请求的上限，小于等于 0 时不限制
+	peerBusyFailFast bool // 达到上限时是否立即以 ErrPeerBusy 失败而不是等待
+
+	retry RetryPolicy // WithRetryPolicy 设置的传输层重试策略
+
+	tuning *HTTPPoolOptions // 设置了调整 http.Transport 的字段时为创建时的选项的拷贝，否则为 nil
+
+	drain drainState // Shutdown 的状态和正在处理的请求
+
+	noAccessLog bool // WithAccessLog 是否关闭了访问日志
+	groupcache  bool // 是否使用 groupcache 的协议，见 WithGroupcacheCompat
+	redactKeys  bool // 访问日志中是否隐藏 key
+
+	rateLimit   atomic.Pointer[tokenBucket]   // SetRateLimit 设置的限制，为 nil 时不限制
+	clientLimit atomic.Pointer[clientLimiter] // SetClientRateLimit 设置的限制，为 nil 时不限制
+	throttled   atomic.Int64                  // 因超过限制以 429 拒绝的请求数量
+}
+
+// PoolOption 用于在 NewHTTPPool 时对 HTTPPool 进行可选配置。
+type PoolOption func(*HTTPPool)
+
+// WithRegistry 让 HTTPPool 从 r 而不是默认的 Registry 中查找其他节点请求的 Group。
+//
+// 参数:
+//
+//	r: HTTPPool 使用的 Registry。
+//
+// 返回值:
+//
+//	PoolOption: 可传递给 NewHTTPPool 的配置项。
+func WithRegistry(r *Registry) PoolOption {
+	return func(p *HTTPPool) {
+		p.registry = r
+	}
+}
+
+// WithClient 设置 HTTPPool 向其他节点发起请求时使用的 http.Client，例如配置了 mTLS 或代理的客户端。
+//
+// 默认的客户端每次请求的总时限为 2 秒，建立连接和 TLS 握手各自的时限为 1 秒，避免卡住的节点
+// 无限期地占用 goroutine。c 原样使用，它的 Timeout 为 0 时请求只受调用方上下文的限制；
+// 同时使用 WithPeerTimeout 或 WithTransport 时，修改的是 c 的一份拷贝，不修改 c 本身。
+//
+// 参数:
+//
+//	c: 发起请求使用的客户端，为 nil 时使用默认的客户端。
+//
+// 返回值:
+//
+//	PoolOption: 可传递给 NewHTTPPool 的配置项。
+func WithClient(c *http.Client) PoolOption {
+	return func(p *HTTPPool) {
+		p.client = c
+	}
+}
+
+// WithPeerTimeout 设置向其他节点的一次请求的总时限，包括建立连接和读取响应体，默认为 2 秒。
+//
+// 超过时限的请求返回满足 errors.Is(err, ErrPeerTimeout) 的错误，它是暂时性的，会被 WithPeerRetry 重试。
+// 调用方的上下文先结束时返回的仍然是上下文的错误。
+//
+// 参数:
+//
+//	d: 一次请求的总时限，小于等于 0 时不限制。
+//
+// 返回值:
+//
+//	PoolOption: 可传递给 NewHTTPPool 的配置项。
+func WithPeerTimeout(d time.Duration) PoolOption {
+	return func(p *HTTPPool) {
+		d = max(d, 0)
+		p.timeout = &d
+	}
+}
+
+// WithTransport 让 HTTPPool 向其他节点发起的所有请求都经过 rt，例如为请求签名或经过代理的 RoundTripper。
+//
+// rt 代替客户端原有的 Transport，作用于 Get、GetMulti、Set、Remove 等所有发往其他节点的请求。
+// 它与 WithClient 和 WithPeerTimeout 可以同时使用：以客户端的一份拷贝替换 Transport，
+// 总时限仍然有效。默认客户端建立连接和 TLS 握手的时限属于被替换的 Transport，需要时由 rt 自己设置。
+//
+// 参数:
+//
+//	rt: 发出请求使用的 RoundTripper，会被并发调用。
+//
+// 返回值:
+//
+//	PoolOption: 可传递给 NewHTTPPool 的配置项。
+func WithTransport(rt http.RoundTripper) PoolOption {
+	return func(p *HTTPPool) {
+		p.transport = rt
+	}
+}
+
+// WithTLSConfig 设置向 https:// 节点发起请求时使用的 TLS 配置，例如信任内部 CA 签发的证书，
+// 或者只在测试中使用的 InsecureSkipVerify。
+//
+// cfg 被设置在客户端 Transport 的一份拷贝上，不修改 WithClient 传入的客户端本身；
+// 客户端的 Transport 不是 *http.Transport 时 NewHTTPPoolOpts 返回错误。同一个 HTTPPool 可以同时
+// 使用 http:// 和 https:// 的节点，只有 https:// 的节点使用 cfg。
+// 服务端照常以 http.ListenAndServeTLS(addr, certFile, keyFile, pool) 或 http.Server.ServeTLS 提供 HTTPPool。
+//
+// 参数:
+//
+//	cfg: TLS 配置，例如 &tls.Config{RootCAs: certPool}。
+//
+// 返回值:
+//
+//	PoolOption: 可传递给 NewHTTPPool 的配置项。
+func WithTLSConfig(cfg *tls.Config) PoolOption {
+	return func(p *HTTPPool) {
+		p.tlsConfig = cfg
+	}
+}
+
+// WithMaxBodyBytes 限制其他节点通过 PUT 写入的请求体和批量获取的请求体的大小，超过时返回 413，默认为 32 MiB。
+//
+// 它作用于所有 Group，与各个 Group 的 WithMaxValueBytes 同时生效时以较小的为准。
+//
+// 参数:
+//
+//	n: 请求体的最大字节数，小于等于 0 时不限制。
+//
+// 返回值:
+//
+//	PoolOption: 可传递给 NewHTTPPool 的配置项。
+func WithMaxBodyBytes(n int64) PoolOption {
+	return func(p *HTTPPool) {
+		p.maxBody = max(n, 0)
+	}
+}
+
+// WithMaxBatchKeys 设置一次批量获取请求中 key 的数量上限，默认为 100。
+//
+// 向其他节点发起的 GetMulti 请求超过上限时会被分成多个请求；处理其他节点的批量请求时，
+// 超过上限的请求以 413 拒绝，因此集群中的节点应当使用相同的上限。
+//
+// 参数:
+//
+//	n: 一次请求中 key 的最大数量，小于等于 0 时使用默认值。
+//
+// 返回值:
+//
+//	PoolOption: 可传递给 NewHTTPPool 的配置项。
+func WithMaxBatchKeys(n int) PoolOption {
+	return func(p *HTTPPool) {
+		if n <= 0 {
+			n = defaultMaxBatchKeys
+		}
+		p.maxBatch = n
+	}
+}
+
+// WithStatsEndpoint 让 HTTPPool 在 GET <basePath>-/stats（默认为 /_geecache/-/stats）上以 JSON 返回统计信息，
+// 方便运维人员用 curl 查看节点的状态，默认不提供。路径中的 "-" 使它不会与名为 stats 的 group 冲突，
+// 但启用之后名为 "-" 的 group 中的 key "stats" 不能再被其他节点访问。
+//
+// 响应中的 groups 按 group 名称列出 HTTPPool 的 Registry 中每个 Group 的计数，与 PublishExpvar
+// 导出的 geecache.groups 相同，数据来自 Group.Stats、Group.CacheStats 和 Group.ChainLoads；
+// 其余字段来自 HTTPPool.Stats：self 是本节点的地址，requests 是处理的请求数量，
+// throttled 是因超过 SetRateLimit 或 SetClientRateLimit 的限制以 429 拒绝的请求数量，
+// peers 按节点地址列出向每个远程节点发起的获取请求和失败的数量。
+//
+// 返回值:
+//
+//	PoolOption: 可传递给 NewHTTPPool 的配置项。
+func WithStatsEndpoint() PoolOption {
+	return func(p *HTTPPool) {
+		p.statsOn = true
+	}
+}
+
+// newPeerClient 返回默认的客户端：在 http.DefaultTransport 的基础上限制建立连接和 TLS 握手的时间，
+// 并为每个节点保留更多的空闲连接。
+func newPeerClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	setDialTimeout(transport, defaultDialTimeout)
+	transport.MaxIdleConns = 0
+	transport.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	return &http.Client{Transport: transport, Timeout: defaultPeerTimeout}
+}
+
+// setDialTimeout 让 t 建立连接和完成 TLS 握手各自最多花费 d。
+func setDialTimeout(t *http.Transport, d time.Duration) {
+	t.DialContext = (&net.Dialer{
+		Timeout:   d,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	t.TLSHandshakeTimeout = d
+}
+
+// defaultPeerClient 是没有设置 WithClient 的 HTTPPool 共享的客户端，共享连接池。
+var defaultPeerClient = newPeerClient()
+
+// httpGetter 属于PeerGetter接口的类型，Pickpeer通过key获取节点返回PeerGetter，即可以返回httpGetter
+type httpGetter struct {
+	baseURL      string
+	client       *http.Client  // 为 nil 时使用 defaultPeerClient
+	maxBatchKeys int           // GetMulti 一次请求中 key 的数量上限，为 0 时使用 defaultMaxBatchKeys
+	secret       []byte        // 请求签名使用的密钥，为空时不签名
+	compress     bool          // 是否在请求中声明接受 gzip
+	breaker      *breaker      // 获取请求的熔断器，为 nil 时不熔断
+	sem          chan struct{} // 并发获取请求的名额，为 nil 时不限制
+	failFast     bool          // 名额已满时是否立即以 ErrPeerBusy 失败
+	inFlight     atomic.Int64  // 正在进行的获取请求数量
+	retry        RetryPolicy   // 传输层的重试策略
+	retries      atomic.Int64  // 按 retry 重新发出的请求数量
+	fetches      atomic.Int64  // 向该节点发起的获取请求数量，批量请求算作一次
+	proto        atomic.Int32  // 与该节点共同支持的协议版本，为 0 时尚未确定，见 GetMulti
+	groupcache   bool          // 是否按 groupcache 的方式转义路径，见 WithGroupcacheCompat
+	errors       atomic.Int64  // 失败的获取请求数量，key 在数据源中不存在不算作失败
+}
+
+// PoolStats 是 HTTPPool 的计数，由 HTTPPool.Stats 返回。
+type PoolStats struct {
+	Requests  int64                // 处理的其他节点的请求数量
+	Throttled int64                // 因超过 SetRateLimit 或 SetClientRateLimit 的限制以 429 拒绝的请求数量
+	Peers     map[string]PeerStats // 按节点地址记录的获取请求计数
+}
+
+// PeerStats 是 HTTPPool 向一个远程节点发起的获取请求的计数。
+type PeerStats struct {
+	Fetches int64 // 获取请求的数量，批量请求算作一次
+	Errors  int64 // 失败的获取请求数量
+	Healthy bool  // 是否在一致性哈希环中，没有启用 WithHealthCheck 时总是为 true
+
+	Breaker BreakerState // 熔断器的状态，没有启用 HTTPPoolOptions.BreakerFailures 时总是 BreakerClosed
+
+	InFlight int64 // 正在进行的获取请求数量，不超过 HTTPPoolOptions.MaxPeerRequests
+	Retries  int64 // 按 WithRetryPolicy 在传输层重新发出的请求数量
+}
+
+// ErrPeerUnavailable 表示拥有者节点正常工作，但暂时无法加载值，例如它的数据源故障、加载超时
+// 或加载名额已满（ErrTooManyLoads）。拥有者以 503 和 Retry-After 返回，请求方按 WithPeerRetry 重试，
+// 重试用完之后与网络错误一样回退到本地加载。
+var ErrPeerUnavailable = errors.New("geecache: peer unavailable")
+
+// ErrPeerInternal 表示拥有者节点的加载发生了意外的错误，例如 getter 引发了 panic，
+// 或 WithErrorClassifier 把错误归为 ErrorClassFatal。拥有者以 500 返回，重试不会改变结果，
+// 因此请求方不重试而是直接回退到本地加载。
+var ErrPeerInternal = errors.New("geecache: peer internal error")
+
+// statusError 表示远程节点返回了非预期的 HTTP 状态码。
+type statusError struct {
+	code   int
+	reason string // 响应中 errorHeader 的值，不是 GeeCache 节点返回的错误时为空
+}
+
+// Error 实现了 error 接口。
+func (e *statusError) Error() string {
+	if e.reason != "" {
+		return fmt.Sprintf("server returned:%v (%s)", e.code, e.reason)
+	}
+	return fmt.Sprintf("server returned:%v", e.code)
+}
+
+// Is 使拥有者报告的错误满足 errors.Is(err, ErrPeerUnavailable)、errors.Is(err, ErrPeerInternal)
+// 或 errors.Is(err, ErrPeerDraining)。
+func (e *statusError) Is(target error) bool {
+	switch e.reason {
+	case unavailableReason:
+		return target == ErrPeerUnavailable
+	case internalReason:
+		return target == ErrPeerInternal
+	case drainingReason:
+		return target == ErrPeerDraining
+	}
+	return false
+}
+
+// responseError 返回非预期的响应 rsp 对应的错误。
+func responseError(rsp *http.Response) error {
+	return &statusError{code: rsp.StatusCode, reason: rsp.Header.Get(errorHeader)}
+}
+
+// Temporary 报告错误是否是暂时的，5xx 响应在重试之后可能成功，拥有者报告的 ErrPeerInternal
+// 和正在关闭的节点返回的 ErrPeerDraining 除外。
+func (e *statusError) Temporary() bool {
+	return e.code >= 500 && e.reason != internalReason && e.reason != drainingReason
+}
+
+// ErrPeerTimeout 表示向远程节点的请求超过了 WithPeerTimeout 或 WithClient 设置的时限，
+// 与远程节点返回的 HTTP 状态码错误不同，它总是暂时性的，会被 WithPeerRetry 重试。
+var ErrPeerTimeout = errors.New("geecache: peer request timed out")
+
+// peerTimeoutError 是请求超过时限时返回的错误，它满足 errors.Is(err, ErrPeerTimeout)，
+// 并实现了 net.Error。
+type peerTimeoutError struct {
+	peer string
+	err  error // http.Client 返回的错误
+}
+
+// Error 实现了 error 接口。
+func (e *peerTimeoutError) Error() string {
+	return fmt.Sprintf("geecache: request to %s timed out: %v", e.peer, e.err)
+}
+
+// Is 使 errors.Is(err, ErrPeerTimeout) 成立。
+func (e *peerTimeoutError) Is(target error) bool {
+	return target == ErrPeerTimeout
+}
+
+// Unwrap 返回 http.Client 返回的错误。
+func (e *peerTimeoutError) Unwrap() error {
+	return e.err
+}
+
+// Timeout 实现了 net.Error 接口。
+func (e *peerTimeoutError) Timeout() bool {
+	return true
+}
+
+// Temporary 报告错误是暂时的，节点恢复之后重试可能成功。
+func (e *peerTimeoutError) Temporary() bool {
+	return true
+}
+
+// do 用 httpGetter 的客户端发出 req。请求因客户端的时限失败而调用方的上下文仍未结束时，
+// 返回 *peerTimeoutError，避免它被当作调用方的上下文超时而不再重试。
+func (h *httpGetter) do(req *http.Request) (*http.Response, error) {
+	c := h.client
+	if c == nil {
+		c = defaultPeerClient
+	}
+	if len(h.secret) > 0 {
+		if err := sign(req, h.secret); err != nil {
+			return nil, err
+		}
+	}
+	req.Header.Set(protoHeader, strconv.Itoa(protoVersion))
+	if req.Header.Get("Accept-Encoding") == "" {
+		// 自己声明 Accept-Encoding 时 http.Transport 不会自动解压，由下面的 decompress 处理
+		if h.compress {
+			req.Header.Set("Accept-Encoding", "gzip")
+		} else {
+			req.Header.Set("Accept-Encoding", "identity")
+		}
+	}
+	rsp, err := h.send(c, req)
+	if err != nil && req.Context().Err() == nil {
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			return nil, &peerTimeoutError{peer: h.baseURL, err: err}
+		}
+	}
+	if err == nil {
+		h.learnProto(rsp)
+	}
+	if err == nil && rsp.Header.Get("Content-Encoding") == "gzip" {
+		if err := decompress(rsp); err != nil {
+			return nil, fmt.Errorf("decompressing response: %v", err)
+		}
+	}
+	return rsp, err
+}
+
+// String 返回节点的地址，用作指标中的节点名称。
+func (h *httpGetter) String() string {
+	return h.baseURL
+}
+
+// keyURL 返回某个 group 中 key 对应的远程节点地址。
+// group 和 key 按路径段转义，否则 key 中的空格会被拥有者节点读成 "+"。
+func (h *httpGetter) keyURL(group string, key string) string {
+	if h.groupcache {
+		return h.groupcacheKeyURL(group, key)
+	}
+	return fmt.Sprintf("%v%v/%v", h.baseURL,
+		url.PathEscape(group), url.PathEscape(key),
+	)
+}
+
+// Get 实现了 PeerGetter 接口，从远程节点获取 group 中 key 对应的值，ctx 结束时请求会被取消。
+func (h *httpGetter) Get(ctx context.Context, group string, key string) ([]byte, error) {
+	bytes, _, err := h.GetTTL(ctx, group, key)
+	return bytes, err
+}
+
+// GetTTL 实现了 PeerTTLGetter 接口，从响应头中读取值在远程节点上剩余的存活时间。
+func (h *httpGetter) GetTTL(ctx context.Context, group string, key string) ([]byte, time.Duration, error) {
+	r, err := h.getValue(ctx, group, key, false)
+	return r.Value, r.TTL, err
+}
+
+// GetFresh 实现了 PeerRefresher 接口，请求带有 refresh 参数，拥有者节点会跳过缓存重新加载。
+func (h *httpGetter) GetFresh(ctx context.Context, group string, key string) ([]byte, time.Duration, error) {
+	r, err := h.getValue(ctx, group, key, true)
+	return r.Value, r.TTL, err
+}
+
+// peerValueGetter 是 httpGetter 实现的接口，除了剩余的存活时间，还会告诉调用方值的版本号
+// 以及值是否不应被缓存，结果中的 Err 总是为 nil。fresh 为 true 时拥有者跳过缓存重新加载，见 PeerRefresher。
+type peerValueGetter interface {
+	getValue(ctx context.Context, group string, key string, fresh bool) (PeerResult, error)
+}
+
+// record 记录一次获取请求及其结果，并把结果交给熔断器。调用方取消 ctx 导致的失败不是节点的问题，不算作失败。
+func (h *httpGetter) record(ctx context.Context, err error) {
+	h.breaker.done(ctx, err)
+	h.fetches.Add(1)
+	if err != nil && !errors.Is(err, ErrNotFound) && ctx.Err() == nil {
+		h.errors.Add(1)
+	}
+}
+
+// getValue 实现了 peerValueGetter 接口，响应带有 noStoreHeader 时 NoStore 为 true。
+//
+// 请求在 Accept 中声明 protobufType：支持它的节点返回 GetResponse，旧版本的节点
+// 忽略 Accept 返回原始的字节和头部，两种响应都能被解码，因此新旧版本的节点可以在滚动升级期间共存。
+// group 和 key 编码在 GET 的路径中而不是放进 POST 的 GetRequest（只有 grpcpool 使用它），
+// 这样旧版本的节点和按路径转发请求的代理都不需要改变。
+func (h *httpGetter) getValue(ctx context.Context, group string, key string, fresh bool) (r PeerResult, err error) {
+	r, _, err = h.fetch(ctx, group, key, fresh, "")
+	return r, err
+}
+
+// Revalidate 实现了 PeerRevalidator 接口，以 If-None-Match 携带 etag 请求拥有者，304 表示副本未改变。
+func (h *httpGetter) Revalidate(ctx context.Context, group string, key string, etag string) (PeerResult, bool, error) {
+	return h.fetch(ctx, group, key, false, etag)
+}
+
+// fetch 向拥有者请求 key 的值。etag 不为空时请求是条件请求，拥有者的值的 ETag 与它相同时
+// 返回的 modified 为 false，结果中只有剩余存活时间、版本号和不可缓存标记。
+func (h *httpGetter) fetch(ctx context.Context, group string, key string, fresh bool, etag string) (r PeerResult, modified bool, err error) {
+	end, err := h.begin(ctx)
+	if err != nil {
+		return PeerResult{}, false, err
+	}
+	defer end()
+	defer func() { h.record(ctx, err) }()
+	u := h.keyURL(group, key)
+	if fresh {
+		u += "?refresh=1"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return PeerResult{}, false, err
+	}
+	req.Header.Set("Accept", protobufType)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	injectTrace(ctx, req.Header)
+	rsp, err := h.do(req)
+	if err != nil {
+		return PeerResult{}, false, err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode == http.StatusNotFound && rsp.Header.Get(errorHeader) == notFoundReason {
+		// 保留拥有者节点上的错误信息，同时让 errors.Is(err, ErrNotFound) 成立
+		msg, _ := io.ReadAll(rsp.Body)
+		return PeerResult{}, false, notFoundError(strings.TrimSpace(string(msg)))
+	}
+	unchanged := etag != "" && rsp.StatusCode == http.StatusNotModified
+	if rsp.StatusCode != http.StatusOK && !unchanged {
+		return PeerResult{}, false, responseError(rsp)
+	}
+	if !unchanged && rsp.Header.Get("Content-Type") == protobufType {
+		if r, err = readGetResponse(rsp.Body, rsp.ContentLength); err == nil && h.groupcache {
+			// 兼容模式的 GetResponse 只有值，GeeCache 节点把其余的信息放在头部中
+			err = readValueHeaders(rsp.Header, &r)
+		}
+		return r, true, err
+	}
+
+	if err := readValueHeaders(rsp.Header, &r); err != nil {
+		return PeerResult{}, false, err
+	}
+	if unchanged {
+		return r, false, nil
+	}
+
+	if r.Value, err = readValue(rsp.Body, rsp.ContentLength); err != nil {
+		return PeerResult{}, false, fmt.Errorf("reading response body:%w", err)
+	}
+	return r, true, nil
+}
+
+const (
+	// maxPrealloc 是按 Content-Length 预先分配的最大字节数，更大的响应体边读边扩大，
+	// 声明了错误长度的响应不会让请求方一次分配过多的内存。
+	maxPrealloc = 64 << 20
+	// maxPooledBuffer 是放回 bodyBuffers 的缓冲区的最大容量，偶尔出现的大响应体不会一直留在池中。
+	maxPooledBuffer = 64 << 10
+)
+
+// bodyBuffers 复用读取 GetResponse 响应体的缓冲区。解码时 proto.Unmarshal 复制出值，
+// 返回的 PeerResult 不引用缓冲区，因此解码之后缓冲区可以立即放回。
+var bodyBuffers = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// readValue 读取以原始字节发送的值。size 是响应的 Content-Length，已知时一次分配恰好的大小，
+// 返回的切片由调用方独占，可以直接交给 ByteView 而不需要再复制；未知时（例如解压之后）与 io.ReadAll 相同。
+func readValue(body io.Reader, size int64) ([]byte, error) {
+	if size < 0 || size > maxPrealloc {
+		return io.ReadAll(body)
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(body, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// readGetResponse 解码以 GetResponse 编码的响应体，size 是响应的 Content-Length，未知时为 -1。
+func readGetResponse(body io.Reader, size int64) (PeerResult, error) {
+	buf := bodyBuffers.Get().(*bytes.Buffer)
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			buf.Reset()
+			bodyBuffers.Put(buf)
+		}
+	}()
+	if size > 0 && size <= maxPrealloc {
+		buf.Grow(int(size))
+	}
+	if _, err := buf.ReadFrom(body); err != nil {
+		return PeerResult{}, fmt.Errorf("reading response body:%w", err)
+	}
+	var out geecachepb.GetResponse
+	if err := proto.Unmarshal(buf.Bytes(), &out); err != nil {
+		return PeerResult{}, fmt.Errorf("decoding response body:%v", err)
+	}
+	return PeerResult{
+		Value:   out.Value,
+		TTL:     time.Duration(out.TtlMs) * time.Millisecond,
+		NoStore: out.Flags&uint32(geecachepb.Flag_FLAG_NO_STORE) != 0,
+		Version: out.Version,
+	}, nil
+}
+
+// multiRequest 是批量获取请求的请求体。
+type multiRequest struct {
+	Keys []string `json:"keys"`
+}
+
+// multiResult 是批量获取请求中一个 key 的结果，Error 不为空时表示该 key 获取失败，
+// NotFound 表示失败的原因是 key 在数据源中不存在，NoStore 表示值不应被请求方缓存。
+type multiResult struct {
+	Value    []byte `json:"value,omitempty"`
+	TTL      string `json:"ttl,omitempty"`
+	Error    string `json:"error,omitempty"`
+	NotFound bool   `json:"notFound,omitempty"`
+	Reason   string `json:"reason,omitempty"` // 与单个请求的 errorHeader 相同，见 peerError
+	NoStore  bool   `json:"noStore,omitempty"`
+	Version  uint64 `json:"version,omitempty"`
+}
+
+// keyError 返回批量请求中失败的 key 的错误，拥有者报告的分类与单个请求一样可以用 errors.Is 判断。
+func keyError(r multiResult) error {
+	var class error
+	switch r.Reason {
+	case unavailableReason:
+		class = ErrPeerUnavailable
+	case internalReason:
+		class = ErrPeerInternal
+	default:
+		return errors.New(r.Error)
+	}
+	if r.Error == class.Error() {
+		return class
+	}
+	return fmt.Errorf("%w: %s", class, r.Error)
+}
+
+// GetMulti 实现了 PeerBatchGetter 接口，通过 POST 请求获取 group 中的多个 key。
+//
+// 请求和响应的内容都是 JSON，响应中结果的顺序与 keys 相同。keys 不超过 WithMaxBatchKeys 的上限时
+// 只发起一次请求，否则按上限分成多个请求并发发出；某个请求失败时它负责的 key 的结果中的 Err
+// 为这个错误，所有请求都失败时返回第一个错误。
+//
+// 批量请求需要协议版本 protoV2。已知节点的版本更低时，每个 key 以单独的请求获取，最多 maxEachRequests 个同时进行；
+// 版本未知而批量请求被节点以 400、404、405 或 501 拒绝时，以 versionPath 探测节点的版本，旧版本的节点同样按单独的请求获取，
+// 探测的结果缓存在 httpGetter 中，之后由响应中的 protoHeader 更新，升级之后的节点会重新使用批量请求。
+func (h *httpGetter) GetMulti(ctx context.Context, group string, keys []string) ([]PeerResult, error) {
+	if h.proto.Load() == protoV1 {
+		return h.getEach(ctx, group, keys)
+	}
+	out, err := h.getMulti(ctx, group, keys)
+	if err != nil && h.proto.Load() == 0 && batchRejected(err) && h.probeProto(ctx) == protoV1 {
+		return h.getEach(ctx, group, keys)
+	}
+	return out, err
+}
+
+// getMulti 以批量请求获取 keys，按 WithMaxBatchKeys 的上限分块。
+func (h *httpGetter) getMulti(ctx context.Context, group string, keys []string) ([]PeerResult, error) {
+	chunk := h.maxBatchKeys
+	if chunk <= 0 {
+		chunk = defaultMaxBatchKeys
+	}
+	if len(keys) <= chunk {
+		return h.getMultiChunk(ctx, group, keys)
+	}
+
+	out := make([]PeerResult, len(keys))
+	errs := make([]error, (len(keys)+chunk-1)/chunk)
+	var wg sync.WaitGroup
+	for i := range errs {
+		start := i * chunk
+		end := min(start+chunk, len(keys))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, err := h.getMultiChunk(ctx, group, keys[start:end])
+			if err == nil && len(results) != end-start {
+				err = fmt.Errorf("peer returned %d results for %d keys", len(results), end-start)
+			}
+			if err != nil {
+				errs[i] = err
+				for j := start; j < end; j++ {
+					out[j].Err = err
+				}
+				return
+			}
+			copy(out[start:end], results)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err == nil {
+			return out, nil
+		}
+	}
+	return nil, errs[0]
+}
+
+// getEach 以单独的请求获取 keys，最多 maxEachRequests 个请求同时进行，所有请求都失败时返回第一个错误。
+func (h *httpGetter) getEach(ctx context.Context, group string, keys []string) ([]PeerResult, error) {
+	out := make([]PeerResult, len(keys))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for n := min(len(keys), maxEachRequests); n > 0; n-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				if out[i], out[i].Err = h.getValue(ctx, group, keys[i], false); out[i].Err != nil {
+					out[i] = PeerResult{Err: out[i].Err}
+				}
+			}
+		}()
+	}
+	for i := range keys {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	for _, r := range out {
+		if r.Err == nil || errors.Is(r.Err, ErrNotFound) {
+			return out, nil
+		}
+	}
+	if len(out) == 0 {
+		return out, nil
+	}
+	return nil, out[0].Err
+}
+
+// getMultiChunk 通过一次 POST 请求获取 keys，是 GetMulti 的一个分块。
+func (h *httpGetter) getMultiChunk(ctx context.Context, group string, keys []string) (_ []PeerResult, err error) {
+	end, err := h.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+	defer func() { h.record(ctx, err) }()
+	body, err := json.Marshal(multiRequest{Keys: keys})
+	if err != nil {
+		return nil, err
+	}
+	u := h.baseURL + url.PathEscape(group) + "/?op=getmulti"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	injectTrace(ctx, req.Header)
+	rsp, err := h.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		if rsp.Header.Get(protoHeader) == "" {
+			// 没有返回协议版本的拒绝可能来自回滚到旧版本的节点，让 GetMulti 重新探测
+			h.proto.CompareAndSwap(protoV2, 0)
+		}
+		return nil, responseError(rsp)
+	}
+	var results []multiResult
+	if err := json.NewDecoder(rsp.Body).Decode(&results); err != nil {
+		return nil, fmt.Errorf("decoding response body:%v", err)
+	}
+
+	out := make([]PeerResult, len(results))
+	for i, r := range results {
+		if r.NotFound {
+			out[i].Err = notFoundError(r.Error)
+			continue
+		}
+		if r.Error != "" {
+			out[i].Err = keyError(r)
+			continue
+		}
+		out[i].Value = r.Value
+		out[i].NoStore = r.NoStore
+		out[i].Version = r.Version
+		if r.TTL != "" {
+			if out[i].TTL, err = time.ParseDuration(r.TTL); err != nil {
+				out[i].Err = fmt.Errorf("bad ttl:%v", err)
+			}
+		}
+	}
+	return out, nil
+}
+
+// Touch 实现了 PeerToucher 接口，通知远程节点刷新 key 的最近使用时间。
+//
+// 远程节点返回 204 表示 key 存在，返回 404 表示 key 不存在。与获取请求一样，
+// 请求经过 h.do，并受 MaxPeerRequests 和熔断器的约束，ctx 结束时请求会被取消。
+func (h *httpGetter) Touch(ctx context.Context, group string, key string) (_ bool, err error) {
+	end, err := h.begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer end()
+	defer func() { h.record(ctx, err) }()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.keyURL(group, key)+"?op=touch", nil)
+	if err != nil {
+		return false, err
+	}
+	rsp, err := h.do(req)
+	if err != nil {
+		return false, err
+	}
+	defer rsp.Body.Close()
+
+	switch rsp.StatusCode {
+	case http.StatusNoContent:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, responseError(rsp)
+	}
+}
+
+// GetCached 实现了 PeerCacheChecker 接口，询问远程节点是否缓存了 key，不会让它加载数据。
+func (h *httpGetter) GetCached(ctx context.Context, group string, key string) ([]byte, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.keyURL(group, key)+"?op=cached", nil)
+	if err != nil {
+		return nil, false, err
+	}
+	rsp, err := h.do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rsp.Body.Close()
+
+	switch rsp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, false, nil
+	default:
+		return nil, false, responseError(rsp)
+	}
+
+	bytes, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, false, fmt.Errorf("reading response body:%w", err)
+	}
+	return bytes, true, nil
+}
+
+// Remove 实现了 PeerRemover 接口，通知远程节点删除它缓存的 key。
+// 远程节点没有缓存这个 key 时同样返回 nil，删除是幂等的。ctx 结束时请求会被取消。
+func (h *httpGetter) Remove(ctx context.Context, group string, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, h.keyURL(group, key), nil)
+	if err != nil {
+		return err
+	}
+	rsp, err := h.do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode == http.StatusNotFound && rsp.Header.Get(errorHeader) == notFoundReason {
+		return nil
+	}
+	if rsp.StatusCode != http.StatusNoContent {
+		return responseError(rsp)
+	}
+	return nil
+}
+
+// Set 实现了 PeerSetter 接口，通过 PUT 请求把值写入远程节点的缓存。
+//
+// ttl 大于 0 时以 ttlMsHeader 头部传递，远程节点返回 413 表示值过大。ctx 结束时请求会被取消。
+func (h *httpGetter) Set(ctx context.Context, group string, key string, value []byte, ttl time.Duration) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, h.keyURL(group, key), bytes.NewReader(value))
+	if err != nil {
+		return err
+	}
+	if ttl > 0 {
+		// 向上取整，不足 1 毫秒的存活时间不能被当作使用默认值
+		req.Header.Set(ttlMsHeader, strconv.FormatInt(int64((ttl+time.Millisecond-1)/time.Millisecond), 10))
+	}
+	rsp, err := h.do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	switch rsp.StatusCode {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusRequestEntityTooLarge:
+		return ErrValueTooLarge
+	default:
+		return responseError(rsp)
+	}
+}
+
+// SetIfVersion 实现了 PeerVersionSetter 接口，通过带 ifversion 参数的 PUT 请求写入远程节点的缓存。
+//
+// 远程节点返回 409 表示版本号不一致，成功时新的版本号通过 versionHeader 返回。
+func (h *httpGetter) SetIfVersion(ctx context.Context, group string, key string, value []byte, expected uint64) (uint64, error) {
+	u := h.keyURL(group, key) + "?ifversion=" + strconv.FormatUint(expected, 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, bytes.NewReader(value))
+	if err != nil {
+		return 0, err
+	}
+	rsp, err := h.do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer rsp.Body.Close()
+
+	switch {
+	case rsp.StatusCode == http.StatusNoContent:
+	case rsp.StatusCode == http.StatusConflict && rsp.Header.Get(errorHeader) == versionMismatchReason:
+		return 0, ErrVersionMismatch
+	case rsp.StatusCode == http.StatusRequestEntityTooLarge:
+		return 0, ErrValueTooLarge
+	default:
+		return 0, responseError(rsp)
+	}
+	version, err := strconv.ParseUint(rsp.Header.Get(versionHeader), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad %s header:%v", versionHeader, err)
+	}
+	return version, nil
+}
+
+// HTTPPoolOptions 是 NewHTTPPoolOpts 的选项。
+type HTTPPoolOptions struct {
+	// BasePath 是节点间通讯地址的前缀，例如 "/internal/cache/v1/"，为空时使用 /_geecache/。
+	// 它必须以 "/" 开头，不以 "/" 结尾时会自动补上。集群中的节点必须使用相同的 BasePath，
+	// 因为 Set 用它拼接其他节点的地址。
+	BasePath string
+
+	// Replicas 是每个节点在一致性哈希环上的虚拟节点数量，小于等于 0 时使用 50。
+	// 节点较少时增大它可以让 key 分布得更均匀。
+	Replicas int
+
+	// HashFn 是一致性哈希环使用的哈希函数，为 nil 时使用 crc32.ChecksumIEEE。
+	HashFn consistenthash.Hash
+
+	// Secret 是集群中的节点共享的密钥，为空时不认证。设置之后，发往其他节点的每个请求都在
+	// Authorization 头部中携带以它对方法、路径、查询参数、签名时间、X-GeeCache-TTL-Ms 和 X-GeeCache-Version 头部
+	// 以及请求体计算的 HMAC-SHA256，ServeHTTP 在访问任何 Group 之前以常数时间比较签名，缺少签名、签名不正确
+	// 或者签名时间与本节点相差超过 5 分钟的请求（包括 PUT、DELETE 和 WithStatsEndpoint 的统计接口）以 401 拒绝，
+	// 因此节点之间的时钟需要同步。这个时间窗口之内的重放仍然可能，节点之间的网络不可信时应当同时使用 TLS。
+	Secret []byte
+
+	// SkipHealthzAuth 为 true 时健康检查接口不要求签名，方便负载均衡器等不知道 Secret 的组件探测节点。
+	SkipHealthzAuth bool
+
+	// DisableCompression 为 true 时不压缩响应体，向其他节点发起的请求也不再声明接受 gzip。
+	// 默认情况下，请求方声明 Accept-Encoding: gzip 时，不小于 CompressThreshold 的值、
+	// GetResponse 和批量获取的结果以 gzip 压缩，请求方透明地解压，得到的字节与不压缩时相同。
+	DisableCompression bool
+
+	// CompressThreshold 是压缩响应体的最小字节数，小于等于 0 时为 1 KiB。更小的响应体压缩的收益
+	// 抵不上消耗的 CPU，原样发送。
+	CompressThreshold int
+
+	// BreakerFailures 为每个远程节点启用熔断器，小于等于 0 时不启用。
+	//
+	// BreakerWindow 之内向一个节点的获取请求失败达到这个次数时（key 不存在和调用方取消不算），
+	// 它的熔断器打开：之后 BreakerCooldown 之内发往它的获取请求不再发出，立即以 ErrPeerCircuitOpen 失败，
+	// Group 因此不必等到超时就回退到下一个拥有者或本地加载。冷却之后熔断器半开，放行一个探测请求，
+	// 它成功时熔断器关闭，失败时重新打开。熔断器的状态见 PeerStats.Breaker 和 WithStatsEndpoint 的统计接口。
+	BreakerFailures int
+
+	// BreakerWindow 是统计失败次数的时间窗口，小于等于 0 时为 10 秒。
+	BreakerWindow time.Duration
+
+	// BreakerCooldown 是熔断器打开之后拒绝请求的时间，小于等于 0 时为 5 秒。
+	BreakerCooldown time.Duration
+
+	// MaxPeerRequests 限制同时发往每个远程节点的获取请求数量，小于等于 0 时不限制。
+	//
+	// 一个变慢的节点因此最多占用这么多 goroutine 和连接，其他节点不受影响。批量获取的每个分块算作一个请求，
+	// GetStream 的请求在调用方关闭响应体之前一直占用名额；健康检查的探测不受限制。
+	// 正在进行的请求数量见 PeerStats.InFlight 和 WithStatsEndpoint 的统计接口。
+	MaxPeerRequests int
+
+	// PeerBusyFailFast 为 true 时，达到 MaxPeerRequests 的请求立即以 ErrPeerBusy 失败，
+	// Group 回退到下一个拥有者或本地加载；默认等待空出的名额，直到调用方的上下文结束。
+	PeerBusyFailFast bool
+
+	// 下面的字段调整向其他节点发起请求的 http.Transport，为零值时使用默认的设置。
+	// 设置了任意一个时，HTTPPool 在默认的（或 WithClient、WithTransport 设置的）Transport 的拷贝上应用它们，
+	// 所有远程节点共用这一个属于 HTTPPool 的客户端，不再与其他 HTTPPool 共享连接池；
+	// 此时 Transport 必须是 *http.Transport，否则 NewHTTPPoolOpts 返回错误。
+
+	// MaxIdleConnsPerHost 是为每个节点保留的空闲连接数量，默认为 64。
+	// 它小于同时发往一个节点的请求数量时，突发的请求结束之后多出的连接被关闭，之后又要重新建立。
+	MaxIdleConnsPerHost int
+
+	// MaxConnsPerHost 限制与每个节点同时建立的连接数量，包括正在使用的连接，默认不限制。
+	// 达到上限的请求等待空出的连接；需要限制的是请求而不是连接时使用 MaxPeerRequests。
+	MaxConnsPerHost int
+
+	// IdleConnTimeout 是空闲连接被关闭之前保留的时间，默认为 90 秒。
+	IdleConnTimeout time.Duration
+
+	// DialTimeout 是建立连接和完成 TLS 握手各自的时限，默认为 1 秒。
+	DialTimeout time.Duration
+
+	// DisableKeepAlives 为 true 时每个请求使用一个新的连接，请求结束之后关闭，通常只用于调试。
+	DisableKeepAlives bool
+}
+
+// tunesTransport 报告 o 是否设置了调整 http.Transport 的字段。
+func (o *HTTPPoolOptions) tunesTransport() bool {
+	return o.MaxIdleConnsPerHost > 0 || o.MaxConnsPerHost > 0 || o.IdleConnTimeout > 0 || o.DialTimeout > 0 || o.DisableKeepAlives
+}
+
+// tuneTransport 在 t 上应用 o 中调整 http.Transport 的字段，零值的字段保持不变。
+func (o *HTTPPoolOptions) tuneTransport(t *http.Transport) {
+	if o.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = o.MaxIdleConnsPerHost
+	}
+	if o.MaxConnsPerHost > 0 {
+		t.MaxConnsPerHost = o.MaxConnsPerHost
+	}
+	if o.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = o.IdleConnTimeout
+	}
+	if o.DialTimeout > 0 {
+		setDialTimeout(t, o.DialTimeout)
+	}
+	if o.DisableKeepAlives {
+		t.DisableKeepAlives = true
+	}
+}
+
+// NewHTTPPool 创建一个新的 HTTPPool 实例，节点间通讯地址的前缀为 /_geecache/。
+//
+// 此函数用于初始化一个 HTTPPool，它将作为分布式缓存节点间的通信服务端。
+//
+// 参数:
+//
+//	self: 当前节点的地址，例如 "localhost:8001"。
+//	opts: 可选的配置项。
+//
+// 返回值:
+//
+//	*HTTPPool: 一个指向新创建的 HTTPPool 实例的指针。
+func NewHTTPPool(self string, opts ...PoolOption) *HTTPPool {
+	p, err := NewHTTPPoolOpts(self, nil, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// NewHTTPPoolOpts 与 NewHTTPPool 相同，但按 o 设置节点间通讯地址的前缀和一致性哈希环等选项。
+//
+// o 只在创建时读取，之后修改它不会影响已创建的 HTTPPool；每次 Set 都用创建时的 Replicas 和 HashFn 重建哈希环。
+// 集群中的节点必须使用相同的 Replicas 和 HashFn，否则它们对 key 的拥有者会有不同的判断。
+//
+// 参数:
+//
+//	self: 当前节点的地址，例如 "localhost:8001"。
+//	o: HTTPPool 的选项，为 nil 时与 NewHTTPPool 相同。
+//	opts: 可选的配置项。
+//
+// 返回值:
+//
+//	*HTTPPool: 一个指向新创建的 HTTPPool 实例的指针。
+//	error: o.BasePath 不是合法的路径前缀时返回错误，此时不创建 HTTPPool。
+func NewHTTPPoolOpts(self string, o *HTTPPoolOptions, opts ...PoolOption) (*HTTPPool, error) {
+	basePath := defaultBasePath
+	if o != nil && o.BasePath != "" {
+		var err error
+		if basePath, err = normalizeBasePath(o.BasePath); err != nil {
+			return nil, err
+		}
+	}
+	p := &HTTPPool{
+		self:     self,
+		basePath: basePath,
+		registry: defaultRegistry,
+		replicas: defaultReplicas,
+		maxBody:  defaultMaxBodyBytes,
+		maxBatch: defaultMaxBatchKeys,
+
+		compress:    true,
+		compressMin: defaultCompressThreshold,
+
+		breakerWindow:   defaultBreakerWindow,
+		breakerCooldown: defaultBreakerCooldown,
+	}
+	if o != nil {
+		if o.Replicas > 0 {
+			p.replicas = o.Replicas
+		}
+		p.hashFn = o.HashFn
+		p.secret = bytes.Clone(o.Secret)
+		p.skipHealthzAuth = o.SkipHealthzAuth
+		p.compress = !o.DisableCompression
+		if o.CompressThreshold > 0 {
+			p.compressMin = o.CompressThreshold
+		}
+		p.breakerFailures = o.BreakerFailures
+		if o.BreakerWindow > 0 {
+			p.breakerWindow = o.BreakerWindow
+		}
+		if o.BreakerCooldown > 0 {
+			p.breakerCooldown = o.BreakerCooldown
+		}
+		p.maxPeerRequests = o.MaxPeerRequests
+		p.peerBusyFailFast = o.PeerBusyFailFast
+		if o.tunesTransport() {
+			tuning := *o
+			p.tuning = &tuning
+		}
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.groupcache && (o == nil || o.BasePath == "") {
+		p.basePath = groupcacheBasePath
+	}
+	if p.timeout != nil || p.transport != nil || p.tlsConfig != nil || p.tuning != nil || p.h2cServer != nil {
+		c := *cmp.Or(p.client, defaultPeerClient)
+		if p.timeout != nil {
+			c.Timeout = *p.timeout
+		}
+		if p.transport != nil {
+			c.Transport = p.transport
+		}
+		if p.tlsConfig != nil {
+			t, ok := cmp.Or(c.Transport, http.DefaultTransport).(*http.Transport)
+			if !ok {
+				return nil, fmt.Errorf("geecache: WithTLSConfig needs an *http.Transport, got %T", c.Transport)
+			}
+			t = t.Clone()
+			t.TLSClientConfig = p.tlsConfig
+			c.Transport = t
+		}
+		if p.tuning != nil {
+			t, ok := cmp.Or(c.Transport, http.DefaultTransport).(*http.Transport)
+			if !ok {
+				return nil, fmt.Errorf("geecache: HTTPPoolOptions transport settings need an *http.Transport, got %T", c.Transport)
+			}
+			t = t.Clone()
+			p.tuning.tuneTransport(t)
+			c.Transport = t
+		}
+		if p.h2cServer != nil {
+			t, ok := cmp.Or(c.Transport, http.DefaultTransport).(*http.Transport)
+			if !ok {
+				return nil, fmt.Errorf("geecache: WithH2C needs an *http.Transport, got %T", c.Transport)
+			}
+			c.Transport = newH2CTransport(t)
+		}
+		p.client = &c
+	}
+	if addr, err := normalizePeer(self); err == nil {
+		// self 与 Set 中的地址按同样的规则比较；不是 URL 的名称原样保留
+		p.self = addr
+	}
+	if p.healthInterval > 0 {
+		p.stop = make(chan struct{})
+		go p.runHealthCheck()
+	}
+	return p, nil
+}
+
+// normalizeBasePath 为 p 补上结尾的 "/"，并拒绝不以 "/" 开头、带有查询或片段以及不是规范形式的路径。
+func normalizeBasePath(p string) (string, error) {
+	if !strings.HasPrefix(p, "/") {
+		return "", fmt.Errorf("geecache: base path %q must start with /", p)
+	}
+	if strings.ContainsAny(p, "?#") {
+		return "", fmt.Errorf("geecache: base path %q must not contain a query or fragment", p)
+	}
+	if !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+	if p != "/" && path.Clean(p)+"/" != p {
+		// 带有 "//"、"." 或 ".." 的路径会被代理和 http.ServeMux 改写，请求到达时不再以它开头
+		return "", fmt.Errorf("geecache: base path %q is not clean", p)
+	}
+	return p, nil
 }
 
-// httpGetter 属于PeerGetter接口的类型，Pickpeer通过key获取节点返回PeerGetter，即可以返回httpGetter
-type httpGetter struct {
-	baseURL string
+// normalizePeer 检查节点地址，返回它的规范形式 scheme://host[:port]：scheme 和主机名转为小写，
+// 去掉结尾的 "/"。地址必须以 http:// 或 https:// 开头，不能带有路径、查询、片段或用户信息。
+func normalizePeer(addr string) (string, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", fmt.Errorf("geecache: invalid peer %q: %v", addr, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("geecache: peer %q must start with http:// or https://", addr)
+	}
+	if u.Host == "" || u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("geecache: peer %q must be scheme://host[:port] without a path, query or user info", addr)
+	}
+	return u.Scheme + "://" + strings.ToLower(u.Host), nil
 }
 
-func (h *httpGetter) Get(group string, key string) ([]byte, error) {
+// Stats 返回 HTTPPool 计数的一份拷贝，Peers 只包含当前通过 Set 设置的节点。
+//
+// 返回值:
+//
+//	PoolStats: 当前的计数。
+func (h *HTTPPool) Stats() PoolStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := PoolStats{
+		Requests:  h.requests.Load(),
+		Throttled: h.throttled.Load(),
+		Peers:     make(map[string]PeerStats, len(h.httpGetters)),
+	}
+	for peer, getter := range h.httpGetters {
+		s.Peers[peer] = PeerStats{
+			Fetches: getter.fetches.Load(),
+			Errors:  getter.errors.Load(),
+			Healthy: h.health[peer] == nil || !h.health[peer].down,
+			Breaker: getter.breaker.current(),
 
-	newUrl := fmt.Sprintf("%v%v/%v", h.baseURL,
-		url.QueryEscape(group), url.QueryEscape(key),
-	)
+			InFlight: getter.inFlight.Load(),
+			Retries:  getter.retries.Load(),
+		}
+	}
+	return s
+}
 
-	rsp, err := http.Get(newUrl)
+// Set updates the pool's list of peers. Each peer is an http:// or https://
+// URL such as "https://cache-2:8443", and http and https peers may be mixed;
+// an entry equal to the pool's own self is accepted as is. Addresses are
+// normalized (lower-case scheme and host, no trailing slash), duplicates are
+// dropped, and an invalid address leaves the pool unchanged and is reported
+// as an error. With WithHealthCheck, peers that stay in the list keep their
+// health state and unhealthy ones stay off the ring until they recover.
+//
+// Getters of peers that stay in the list are kept, so their stats survive;
+// use AddPeers and RemovePeers when peers join or leave one at a time.
+func (h *HTTPPool) Set(peers ...string) error {
+	peers, err := h.normalizePeers(peers)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rsp.Body.Close()
 
-	if rsp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server returned:%v", rsp.StatusCode)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.members = peers
+	health := make(map[string]*peerHealth)
+	for _, peer := range peers {
+		if s := h.health[peer]; s != nil {
+			health[peer] = s
+		}
 	}
+	h.health = health
+	h.rebuildRing()
 
-	bytes, err := io.ReadAll(rsp.Body)
+	getters := make(map[string]*httpGetter, len(peers))
+	for _, peer := range peers {
+		if getters[peer] = h.httpGetters[peer]; getters[peer] == nil {
+			getters[peer] = h.newGetter(peer)
+		}
+	}
+	h.httpGetters = getters
+	return nil
+}
+
+// AddPeers adds peers to the pool without rebuilding it: only the new peers'
+// virtual nodes are inserted into the ring, so only the keys they now own
+// move, and the existing getters are kept along with their connections and
+// stats. Addresses are validated and normalized as in Set, peers that are
+// already members are ignored, and an invalid address leaves the pool
+// unchanged and is reported as an error. New peers are considered healthy.
+func (h *HTTPPool) AddPeers(peers ...string) error {
+	peers, err := h.normalizePeers(peers)
 	if err != nil {
-		return nil, fmt.Errorf("reading response body:%v", err)
+		return err
 	}
 
-	return bytes, nil
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.httpGetters == nil {
+		h.httpGetters = make(map[string]*httpGetter)
+		h.health = make(map[string]*peerHealth)
+	}
+	if h.peers == nil {
+		h.peers = consistenthash.New(h.replicas, h.hashFn)
+	}
+	for _, peer := range peers {
+		if h.httpGetters[peer] != nil {
+			continue
+		}
+		h.members = append(h.members, peer)
+		h.httpGetters[peer] = h.newGetter(peer)
+		h.peers.Add(peer)
+	}
+	return nil
 }
 
-// NewHTTPPool 创建一个新的 HTTPPool 实例。
-//
-// 此函数用于初始化一个 HTTPPool，它将作为分布式缓存节点间的通信服务端。
-//
-// 参数:
-//
-//	self: 当前节点的地址，例如 "localhost:8001"。
-//	basePath: 节点间通信的基础路径前缀。
-//
-// 返回值:
-//
-//	*HTTPPool: 一个指向新创建的 HTTPPool 实例的指针。
-func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
-		self:     self,
-		basePath: defaultBasePath,
+// RemovePeers removes peers from the pool without rebuilding it: only the
+// keys they owned move to the remaining peers, whose getters are kept.
+// Peers that are not members are ignored. Removing the pool's own self, or
+// passing an invalid address, leaves the pool unchanged and is reported as
+// an error.
+func (h *HTTPPool) RemovePeers(peers ...string) error {
+	peers, err := h.normalizePeers(peers)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(peers, h.self) {
+		return fmt.Errorf("geecache: cannot remove self %s from the pool", h.self)
 	}
-}
 
-// Set updates the pool's list of peers.
-func (h *HTTPPool) Set(peers ...string) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	h.peers = consistenthash.New(defaultReplicas, nil)
-	h.peers.Add(peers...)
+	h.members = slices.DeleteFunc(h.members, func(peer string) bool {
+		return slices.Contains(peers, peer)
+	})
+	for _, peer := range peers {
+		delete(h.httpGetters, peer)
+		delete(h.health, peer)
+	}
+	if h.peers != nil {
+		h.peers.Remove(peers...)
+	}
+	return nil
+}
 
-	h.httpGetters = make(map[string]*httpGetter)
+// normalizePeers 按 normalizePeer 规范化 peers 并去掉重复的地址，与 self 相同的项原样保留。
+func (h *HTTPPool) normalizePeers(peers []string) ([]string, error) {
+	normalized := make([]string, 0, len(peers))
+	seen := make(map[string]bool, len(peers))
 	for _, peer := range peers {
-		h.httpGetters[peer] = &httpGetter{
-			baseURL: peer + h.basePath,
+		if peer != h.self {
+			var err error
+			if peer, err = normalizePeer(peer); err != nil {
+				return nil, err
+			}
+		}
+		if !seen[peer] {
+			seen[peer] = true
+			normalized = append(normalized, peer)
 		}
 	}
+	return normalized, nil
+}
 
+// newGetter 返回访问 peer 的 httpGetter，它使用 HTTPPool 的客户端和配置。
+func (h *HTTPPool) newGetter(peer string) *httpGetter {
+	getter := &httpGetter{
+		baseURL:      peer + h.basePath,
+		client:       h.client,
+		maxBatchKeys: h.maxBatch,
+		secret:       h.secret,
+		compress:     h.compress,
+		breaker:      newBreaker(h.breakerFailures, h.breakerWindow, h.breakerCooldown),
+		failFast:     h.peerBusyFailFast,
+		retry:        h.retry,
+		groupcache:   h.groupcache,
+	}
+	if h.maxPeerRequests > 0 {
+		getter.sem = make(chan struct{}, h.maxPeerRequests)
+	}
+	return getter
 }
 
 // PickPeer picks a peer according to key
@@ -102,32 +1426,91 @@ func (h *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
 
 	if peer := h.peers.Get(key); peer != "" && peer != h.self {
 		h.Log("Pick peer %s", peer)
-		return h.httpGetters[peer], true
+		return h.peerGetter(h.httpGetters[peer]), true
 	}
 
 	return nil, false
 
 }
 
+// PickPeers picks up to n successive owners of key on the ring, stopping
+// before self.
+func (h *HTTPPool) PickPeers(key string, n int) []PeerGetter {
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.peers == nil {
+		h.Log("HTTPPool peers is nil")
+		return nil
+	}
+
+	var getters []PeerGetter
+	for _, peer := range h.peers.GetN(key, n) {
+		if peer == h.self {
+			break
+		}
+		getters = append(getters, h.peerGetter(h.httpGetters[peer]))
+	}
+	if len(getters) > 0 {
+		h.Log("Pick %d peers for %s", len(getters), key)
+	}
+	return getters
+
+}
+
+// BasePath 返回节点间通讯地址的前缀，以 "/" 结尾，例如 "/_geecache/"。
+func (h *HTTPPool) BasePath() string {
+	return h.basePath
+}
+
+// RegisterOn 把 HTTPPool 挂载到 mux 上，只处理 BasePath 之下的请求，mux 中的其他 handler 不受影响。
+// 它与 mux.Handle(h.BasePath(), h) 相同。
+//
+// 参数:
+//
+//	mux: 同时服务应用自己的接口的 http.ServeMux。
+func (h *HTTPPool) RegisterOn(mux *http.ServeMux) {
+	mux.Handle(h.basePath, h)
+}
+
 // Log 是一个日志记录辅助方法。
 //
 // 它会在日志消息前加上服务器的地址（self 字段），
-// 方便在查看多个节点的聚合日志时区分日志来源。
+// 方便在查看多个节点的聚合日志时区分日志来源。日志交给 SetLogger 设置的全局 Logger，
+// 全局 Logger 是 NopLogger 时不会格式化消息。
 //
 // 参数:
 //
 //	format: 日志消息的格式化字符串。
 //	a:      格式化字符串对应的可变参数。
 func (h *HTTPPool) Log(format string, a ...any) {
-	log.Printf("[Server %s]%s", h.self, fmt.Sprintf(format, a...))
+	l := globalLogger.Load().(loggerHolder).l
+	if _, nop := l.(NopLogger); nop {
+		return
+	}
+	l.Printf("[Server %s]%s", h.self, fmt.Sprintf(format, a...))
 }
 
 // ServeHTTP 实现了 http.Handler 接口，用于处理 HTTP 请求。
 //
 // 它的核心功能是解析请求路径，格式应为 /<basepath>/<groupname>/<key>。
-// 它会验证路径前缀，然后提取 group 名称和 key。
+// 它会验证路径前缀，然后提取 group 名称和 key，两者分别按路径段转义，见 splitKeyPath。
 // 之后，它会从对应的 group 中获取缓存数据，并将其作为 HTTP 响应返回。
-// 如果发生任何错误（如路径格式错误、group 不存在），它会返回相应的 HTTP 错误码。
+// 如果发生任何错误（如路径格式错误、group 不存在），它会返回相应的 HTTP 错误码；
+// 路径不以 basepath 开头时返回 404，因此 HTTPPool 也可以作为同时服务应用接口的服务器的根 handler。
+//
+// WithServerTLSConfig 要求客户端证书时，没有出示证书的请求以 403 拒绝；
+// 设置了 HTTPPoolOptions.Secret 时，签名不正确的请求在做其他任何事之前以 401 拒绝；
+// 超过 SetRateLimit 或 SetClientRateLimit 的限制的请求在此之前就以 429 拒绝。
+// GET <basepath>-/healthz 是 WithHealthCheck 探测的健康检查接口，节点总是提供它。
+// Shutdown 开始之后其他请求以 503 拒绝，健康检查接口返回 503 和 "draining"。
+// 启用 WithH2C 时，开始 h2c 连接的请求在路径检查之前交给 h2c。
+// 路径检查之后的请求（健康检查除外）在结束时记录访问日志，见 WithAccessLog。
+// 请求携带的 X-GeeCache-Proto 不是正整数时返回 400，否则响应中带有双方共同支持的协议版本；
+// GET <basepath>-/version 返回本节点支持的最高协议版本。
+// GET 和 HEAD 读取值，PUT 写入值，DELETE 删除本节点缓存的 key（不存在时返回 404），
+// POST 只用于带有 op 参数的操作，其他方法返回 405。
 //
 // 参数:
 //
@@ -135,34 +1518,536 @@ func (h *HTTPPool) Log(format string, a ...any) {
 //	r: 代表客户端发来的 HTTP 请求的 *http.Request。
 func (h *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
+	if h.h2cServer != nil && isH2C(r) {
+		h.serveH2C(w, r)
+		return
+	}
 	if !strings.HasPrefix(r.URL.Path, h.basePath) {
-		panic("HTTPPool serving unexpected path: " + r.URL.Path)
+		// 与应用共用一个 mux 或作为根 handler 时，其他路径的请求不属于节点间的协议
+		http.NotFound(w, r)
+		return
+	}
+	if h.accessLogging(r) {
+		lw := &accessLogWriter{ResponseWriter: w}
+		defer h.logAccess(lw, r, now())
+		w = lw
+	}
+	if !negotiateProto(w, r) {
+		return
+	}
+	if !h.requireClientCert(w, r) {
+		return
+	}
+	healthz := r.URL.Path == h.basePath+healthzPath
+	if !healthz && !h.throttle(w, r) {
+		// 在认证之前拒绝，反复重试的客户端不会让节点为每个请求计算签名
+		return
+	}
+	if len(h.secret) > 0 && !(healthz && h.skipHealthzAuth) && !h.authenticate(w, r) {
+		return
+	}
+	if healthz {
+		// 健康检查很频繁，不计数也不记录日志
+		h.serveHealthz(w, r)
+		return
+	}
+	if r.URL.Path == h.basePath+versionPath {
+		h.serveVersion(w, r)
+		return
+	}
+	if !h.drain.enter() {
+		rejectDraining(w)
+		return
+	}
+	defer h.drain.leave()
+	h.requests.Add(1)
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete:
+	default:
+		w.Header().Set("Allow", allowedMethods)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.statsOn && r.URL.Path == h.basePath+statsPath {
+		h.serveStats(w, r)
+		return
 	}
-	h.Log("%s %s", r.Method, r.URL.Path)
 	// 期望的请求路径格式为 /<basepath>/<groupname>/<key>
-	// 使用 SplitN 将路径切分为两部分
-	parts := strings.SplitN(r.URL.Path[len(h.basePath):], "/", 2)
-	if len(parts) != 2 {
+	groupName, key, err := h.splitKeyPath(r.URL)
+	if err != nil {
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
 
-	groupName := parts[0]
-	key := parts[1]
-
-	group := GetGroup(groupName)
+	group := h.registry.GetGroup(groupName)
 	if group == nil {
 		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
 		return
 	}
+	group.stats.serverRequests.Add(1)
+	group.metrics().IncServerRequest(groupName)
+	multi := r.Method == http.MethodPost && r.URL.Query().Get("op") == "getmulti"
+	if !multi && key == "" {
+		// 只有批量请求发往 /<basepath>/<groupname>/
+		http.Error(w, "missing key", http.StatusBadRequest)
+		return
+	}
+	if !multi {
+		// 与请求方使用同样的规范化，节点之间对 key 的拥有者才不会有分歧；批量请求逐个规范化
+		var err error
+		if key, err = group.canonicalKey(key); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if t := group.tracing(); !isNopTracer(t) {
+		// 让拥有者节点上的 span 接入调用方的追踪
+		ctx, span := group.startSpan(t.Extract(r.Context(), r.Header), SpanServe, SpanServer, key)
+		defer span.End(nil)
+		r = r.WithContext(ctx)
+	}
+
+	if r.Method == http.MethodPost && r.URL.Query().Get("op") == "touch" {
+		// 只刷新本节点的缓存，不再向其他节点转发
+		if group.maincache.touch(key) {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			http.Error(w, "no such key", http.StatusNotFound)
+		}
+		return
+	}
+
+	if multi {
+		h.serveGetMulti(w, r, group)
+		return
+	}
+
+	if (r.Method == http.MethodGet || r.Method == http.MethodHead) && r.URL.Query().Get("op") == "cached" {
+		// 只查看本节点的缓存，不触发加载
+		view, ok := group.GetCached(key)
+		if !ok {
+			http.Error(w, "not cached", http.StatusNotFound)
+			return
+		}
+		writeTTLHeaders(w.Header(), view)
+		h.writeBody(w, r, "application/octet-stream", view.b)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		h.serveSet(w, r, group, key)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		// 只删除本节点的缓存，不再向其他节点转发
+		if !group.RemoveLocal(key) {
+			w.Header().Set(errorHeader, notFoundReason)
+			http.Error(w, "no such key", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		http.Error(w, "unsupported op: "+r.URL.Query().Get("op"), http.StatusBadRequest)
+		return
+	}
 
-	view, err := group.Get(key)
+	view, err := servePeerValue(r.Context(), group, key, r.URL.Query().Get("refresh") != "")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writePeerError(w, group, key, err)
 		return
 	}
 
+	if notModified(w, r, view) {
+		return
+	}
+	if h.groupcache || acceptsProtobuf(r) && len(view.b) < rawValueThreshold {
+		h.writeGetResponse(w, r, view)
+		return
+	}
+	writeValueHeaders(w, view)
 	// 将获取到的缓存值作为二进制流写入响应体
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Write(view.ByteSlice())
+	h.writeBody(w, r, "application/octet-stream", view.b)
+}
+
+// splitKeyPath 从 /<basepath>/<groupname>/<key> 形式的 u 中取出 group 和 key。
+//
+// 请求方用 url.PathEscape 分别转义 group 和 key，其中的 "/" 被编码为 %2F，
+// 因此在转义之后的路径上切分再分别解码，group 中的 "/" 不会被当作分隔符。
+// 解码之后的 key 可以包含 "/"、"%"、空格和任意 UTF-8 字符，与请求方传入的字符串完全相同；
+// 不按这种方式转义的请求方发来的未转义的 "/" 仍然属于 key。
+// 兼容模式下请求方与 groupcache 一样用 url.QueryEscape 转义，路径段改用 url.QueryUnescape 解码，"+" 因此是空格。
+func (h *HTTPPool) splitKeyPath(u *url.URL) (group, key string, err error) {
+	// 跳过 basePath 占用的路径段，basePath 在转义之后的形式可能与它本身不同
+	rest, ok := u.EscapedPath(), true
+	for range strings.Count(h.basePath, "/") {
+		if _, rest, ok = strings.Cut(rest, "/"); !ok {
+			return "", "", errors.New("path outside base path")
+		}
+	}
+	rawGroup, rawKey, ok := strings.Cut(rest, "/")
+	if !ok {
+		return "", "", errors.New("missing key")
+	}
+	unescape := url.PathUnescape
+	if h.groupcache {
+		unescape = url.QueryUnescape
+	}
+	if group, err = unescape(rawGroup); err != nil {
+		return "", "", err
+	}
+	if key, err = unescape(rawKey); err != nil {
+		return "", "", err
+	}
+	return group, key, nil
+}
+
+// readValueHeaders 从响应头部中读取 writeValueHeaders 写入的剩余存活时间、版本号和不可缓存标记，没有的项保持不变。
+func readValueHeaders(header http.Header, r *PeerResult) (err error) {
+	if s := header.Get(ttlMsHeader); s != "" {
+		ms, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad %s header:%v", ttlMsHeader, err)
+		}
+		// 拥有者向下取整到毫秒，0 表示不到 1 毫秒就过期，而不是永不过期
+		r.TTL = max(time.Duration(ms)*time.Millisecond, time.Nanosecond)
+	} else if s := header.Get(ttlHeader); s != "" {
+		if r.TTL, err = time.ParseDuration(s); err != nil {
+			return fmt.Errorf("bad %s header:%v", ttlHeader, err)
+		}
+	}
+	if s := header.Get(versionHeader); s != "" {
+		if r.Version, err = strconv.ParseUint(s, 10, 64); err != nil {
+			return fmt.Errorf("bad %s header:%v", versionHeader, err)
+		}
+	}
+	r.NoStore = r.NoStore || header.Get(noStoreHeader) != ""
+	return nil
+}
+
+// writeValueHeaders 在响应头部中写入 view 的剩余存活时间、不可缓存标记和版本号。
+func writeValueHeaders(w http.ResponseWriter, view ByteView) {
+	writeTTLHeaders(w.Header(), view)
+	if view.noStore {
+		w.Header().Set(noStoreHeader, "1")
+	}
+	if view.version != 0 {
+		w.Header().Set(versionHeader, strconv.FormatUint(view.version, 10))
+	}
+}
+
+// peerError 按 err 的分类返回拥有者节点对其他节点报告加载失败时使用的状态码、errorHeader 的值和消息。
+//
+// key 不存在时保留原始的错误信息，请求方会把它放进自己的错误和墓碑条目中；
+// 其他错误只报告分类，原始的错误信息只记录在本节点的日志中，不会离开本节点。
+func peerError(group *Group, err error) (code int, reason string, msg string) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound, notFoundReason, err.Error()
+	case errors.Is(err, ErrGetterPanic):
+		return http.StatusInternalServerError, internalReason, ErrGetterPanic.Error()
+	case errors.Is(err, ErrValueTooLarge):
+		return http.StatusInternalServerError, internalReason, ErrValueTooLarge.Error()
+	case errors.Is(err, ErrTooManyLoads), errors.Is(err, context.DeadlineExceeded),
+		group.classifyError(err) == ErrorClassTransient:
+		return http.StatusServiceUnavailable, unavailableReason, ErrPeerUnavailable.Error()
+	default:
+		return http.StatusInternalServerError, internalReason, ErrPeerInternal.Error()
+	}
+}
+
+// writePeerError 把为其他节点加载 key 失败的错误写入响应：不存在时返回 404，
+// 暂时性的错误返回带有 Retry-After 的 503，其他错误返回 500，见 peerError。
+func writePeerError(w http.ResponseWriter, group *Group, key string, err error) {
+	code, reason, msg := peerError(group, err)
+	if code != http.StatusNotFound {
+		group.logf("[GeeCache] failed to serve %s to a peer: %v", key, err)
+	}
+	w.Header().Set(errorHeader, reason)
+	if code == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", retryAfterSeconds)
+	}
+	http.Error(w, msg, code)
+}
+
+// acceptsProtobuf 报告请求方是否接受以 GetResponse 编码的响应。
+func acceptsProtobuf(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, t := range strings.Split(accept, ",") {
+			if mt, _, _ := strings.Cut(strings.TrimSpace(t), ";"); mt == protobufType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeGetResponse 把 view 以 GetResponse 编码写入响应。
+func (h *HTTPPool) writeGetResponse(w http.ResponseWriter, r *http.Request, view ByteView) {
+	if h.groupcache {
+		// groupcache 的 GetResponse 只有 value 与 GeeCache 的字段相同，其余的信息放在头部中
+		b, err := proto.Marshal(&geecachepb.GetResponse{Value: view.b})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeValueHeaders(w, view)
+		h.writeBody(w, r, protobufType, b)
+		return
+	}
+	out := &geecachepb.GetResponse{Value: view.b, Version: view.version}
+	if !view.expire.IsZero() {
+		// 向上取整，不足 1 毫秒的剩余时间不能被当作永不过期
+		out.TtlMs = int64((max(view.expire.Sub(now()), time.Nanosecond) + time.Millisecond - 1) / time.Millisecond)
+	}
+	if view.noStore {
+		out.Flags |= uint32(geecachepb.Flag_FLAG_NO_STORE)
+	}
+	b, err := proto.Marshal(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeBody(w, r, protobufType, b)
+}
+
+// servePeerValue 为其他节点的请求获取 group 中 key 的值，并拒绝转发超过 WithMaxValueBytes 上限的值。
+// fresh 为 true 时跳过本节点的缓存重新加载，见 GetFresh。
+func servePeerValue(ctx context.Context, group *Group, key string, fresh bool) (ByteView, error) {
+	var view ByteView
+	var err error
+	if fresh {
+		view, err = group.getFreshForPeer(ctx, key)
+	} else {
+		view, err = group.getForPeer(ctx, key)
+	}
+	if errors.Is(err, ErrGetterPanic) {
+		// panic 的值和调用栈只留在本节点，请求方只需要知道加载失败
+		return ByteView{}, ErrGetterPanic
+	}
+	if err != nil {
+		return ByteView{}, err
+	}
+	if max := group.maincache.maxValueBytes; max > 0 && int64(view.Len()) > max {
+		// 不把过大的值转发出去，避免一个节点的问题扩散到其他节点的缓存
+		return ByteView{}, fmt.Errorf("%w: key %q is %d bytes, limit %d", ErrValueTooLarge, key, view.Len(), max)
+	}
+	return view, nil
+}
+
+// ServePeer 处理其他节点通过 HTTPPool 之外的传输（例如 gRPC）发来的获取 key 的请求，
+// 行为与 HTTPPool 处理 GET 请求相同：计入 Stats.ServerRequests，按 WithKeyNormalizer 规范化 key，
+// 在 SpanServe span 中只在本节点查找或加载而不再转发给其他节点，并拒绝返回超过 WithMaxValueBytes 上限的值。
+// getter 引发 panic 时只返回 ErrGetterPanic，panic 的值和调用栈不会离开本节点。
+//
+// 参数:
+//
+//	ctx: 请求的上下文，传输层可以先把调用方的追踪上下文放入其中。
+//	key: 请求方发来的 key。
+//
+// 返回值:
+//
+//	PeerResult: 值、剩余的存活时间（永不过期时为 0）、版本号以及值是否不应被缓存，Err 总是为 nil。
+//	            Value 与缓存共享，只能读取。
+//	error: key 不存在时满足 errors.Is(err, ErrNotFound)，key 被拒绝时满足 errors.Is(err, ErrInvalidKey)。
+func (g *Group) ServePeer(ctx context.Context, key string) (PeerResult, error) {
+	g.stats.serverRequests.Add(1)
+	g.metrics().IncServerRequest(g.name)
+	key, err := g.canonicalKey(key)
+	if err != nil {
+		return PeerResult{}, err
+	}
+	ctx, span := g.startSpan(ctx, SpanServe, SpanServer, key)
+	view, err := servePeerValue(ctx, g, key, false)
+	span.End(err)
+	if err != nil {
+		return PeerResult{}, err
+	}
+	r := PeerResult{Value: view.b, NoStore: view.noStore, Version: view.version}
+	if !view.expire.IsZero() {
+		r.TTL = max(view.expire.Sub(now()), time.Nanosecond)
+	}
+	return r, nil
+}
+
+// remainingTTL 返回 view 剩余存活时间的字符串形式，永不过期时返回空字符串。
+//
+// 传递剩余的存活时间而不是过期时刻，不依赖节点之间的时钟同步。
+func remainingTTL(view ByteView) string {
+	if view.expire.IsZero() {
+		return ""
+	}
+	return max(view.expire.Sub(now()), time.Nanosecond).String()
+}
+
+// writeTTLHeaders 在 header 中写入 view 的剩余存活时间，永不过期时什么也不写入。
+//
+// 毫秒数向下取整，热点副本不会比拥有者的副本晚过期。
+func writeTTLHeaders(header http.Header, view ByteView) {
+	if view.expire.IsZero() {
+		return
+	}
+	ttl := max(view.expire.Sub(now()), time.Nanosecond)
+	header.Set(ttlMsHeader, strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	header.Set(ttlHeader, ttl.String())
+}
+
+// serveGetMulti 处理其他节点发来的批量获取请求，并发获取每个 key，
+// 按请求中的顺序返回 JSON 编码的结果。单个 key 失败只体现在它自己的结果中。
+func (h *HTTPPool) serveGetMulti(w http.ResponseWriter, r *http.Request, group *Group) {
+	var req multiRequest
+	body := r.Body
+	if h.maxBody > 0 {
+		body = http.MaxBytesReader(w, r.Body, h.maxBody)
+	}
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("request body too large: limit %d", h.maxBody), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "decoding request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Keys) > h.maxBatch {
+		// 每个 key 都由一个 goroutine 加载，限制一次请求能引起的并发
+		http.Error(w, fmt.Sprintf("too many keys: %d, limit %d", len(req.Keys), h.maxBatch), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	results := make([]multiResult, len(req.Keys))
+	var wg sync.WaitGroup
+	for i, key := range req.Keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key, err := group.canonicalKey(key)
+			if err != nil {
+				results[i].Error = err.Error()
+				return
+			}
+			view, err := servePeerValue(r.Context(), group, key, false)
+			if err != nil {
+				code, reason, msg := peerError(group, err)
+				if code != http.StatusNotFound {
+					group.logf("[GeeCache] failed to serve %s to a peer: %v", key, err)
+				}
+				results[i].Error = msg
+				results[i].NotFound = code == http.StatusNotFound
+				results[i].Reason = reason
+				return
+			}
+			results[i].Value = view.b
+			results[i].TTL = remainingTTL(view)
+			results[i].NoStore = view.noStore
+			results[i].Version = view.version
+		}()
+	}
+	wg.Wait()
+
+	b, err := json.Marshal(results)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeBody(w, r, "application/json", b)
+}
+
+// serveStats 处理 WithStatsEndpoint 的统计接口。
+func (h *HTTPPool) serveStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stats := struct {
+		Self string `json:"self"`
+		poolStatsVars
+		Groups map[string]map[string]int64 `json:"groups"`
+	}{
+		Self:          h.self,
+		poolStatsVars: h.vars(),
+		Groups:        registryVars(h.registry),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// serveSet 处理其他节点通过 PUT 请求发来的写入，把请求体写入本节点的主缓存。
+// 请求体超过 WithMaxBodyBytes、group 的 WithMaxValueBytes 上限或缓存容量时返回 413。
+func (h *HTTPPool) serveSet(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	var ttl time.Duration
+	if s := r.Header.Get(ttlMsHeader); s != "" {
+		ms, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			http.Error(w, "bad "+ttlMsHeader+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		ttl = time.Duration(ms) * time.Millisecond
+	} else if s := r.URL.Query().Get("ttl"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			http.Error(w, "bad ttl: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+
+	limit := h.maxBody
+	if max := group.maincache.maxValueBytes; max > 0 && (limit <= 0 || max < limit) {
+		limit = max
+	}
+	body := io.Reader(r.Body)
+	if limit > 0 {
+		// 多读一个字节即可判断请求体是否超过上限
+		body = io.LimitReader(r.Body, limit+1)
+	}
+	value, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, "reading request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if limit > 0 && int64(len(value)) > limit {
+		http.Error(w, fmt.Sprintf("%v: limit %d", ErrValueTooLarge, limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if s := r.URL.Query().Get("ifversion"); s != "" {
+		expected, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			http.Error(w, "bad ifversion: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		version, err := group.setIfVersionLocally(key, value, expected)
+		if errors.Is(err, ErrVersionMismatch) {
+			w.Header().Set(errorHeader, versionMismatchReason)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			writeSetError(w, err)
+			return
+		}
+		w.Header().Set(versionHeader, strconv.FormatUint(version, 10))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if err := group.setLocally(key, value, ttl); err != nil {
+		writeSetError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeSetError 把写入本节点缓存失败的错误写入响应，值过大时返回 413。
+func writeSetError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, ErrValueTooLarge) || errors.Is(err, lru.ErrEntryTooLarge) {
+		status = http.StatusRequestEntityTooLarge
+	}
+	http.Error(w, err.Error(), status)
 }
@@ -0,0 +1,4716 @@
+package geecache
+
+import (
+	"GeeCache/geecachepb"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"maps"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestHTTPTouch(t *testing.T) {
+	gee := newTestGroup(t, "http-touch", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	gee.Get("Tom")
+
+	pool := NewHTTPPool("self")
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	if found, err := getter.Touch(context.Background(), "http-touch", "Tom"); err != nil || !found {
+		t.Fatalf("expect Tom touched on peer, got %v %v", found, err)
+	}
+	if found, err := getter.Touch(context.Background(), "http-touch", "Jack"); err != nil || found {
+		t.Fatalf("expect Jack absent on peer, got %v %v", found, err)
+	}
+	if n := getter.fetches.Load(); n != 2 {
+		t.Fatalf("expect touches to be recorded as peer requests, got %d", n)
+	}
+
+	// Touch 使用为节点配置的客户端
+	var sent atomic.Int32
+	getter.client = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		sent.Add(1)
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+	if found, err := getter.Touch(context.Background(), "http-touch", "Tom"); err != nil || !found || sent.Load() != 1 {
+		t.Fatalf("expect Tom touched through the peer client, got %v %v after %d requests", found, err, sent.Load())
+	}
+}
+
+func TestServeHTTPColdInsert(t *testing.T) {
+	gee := newTestGroup(t, "http-cold", int64(len("k1v1k2v2")), GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("v" + key[1:]), nil
+		}))
+	gee.Get("k1")
+
+	pool := NewHTTPPool("self")
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	if v, err := getter.Get(context.Background(), "http-cold", "k2"); err != nil || string(v) != "v2" {
+		t.Fatalf("expect k2=v2 from peer, got %s %v", v, err)
+	}
+	// 代替其他节点加载的 k2 是冷条目，再写入新条目时应先于 k1 被淘汰
+	gee.populateCache("k3", ByteView{b: []byte("v3")})
+	if _, ok := gee.maincache.get("k2"); ok {
+		t.Fatalf("expect cold k2 evicted first")
+	}
+	if _, ok := gee.maincache.get("k1"); !ok {
+		t.Fatalf("expect hot k1 kept")
+	}
+}
+
+func TestServeHTTPMaxValueBytes(t *testing.T) {
+	newTestGroup(t, "http-max-value", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(strings.Repeat("x", len(key)*10)), nil
+		}), WithMaxValueBytes(32))
+
+	srv := httptest.NewServer(NewHTTPPool("self"))
+	defer srv.Close()
+
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	if v, err := getter.Get(context.Background(), "http-max-value", "Tom"); err != nil || len(v) != 30 {
+		t.Fatalf("expect small value relayed, got %d bytes %v", len(v), err)
+	}
+	if _, err := getter.Get(context.Background(), "http-max-value", "Jackson"); err == nil {
+		t.Fatalf("expect oversized value refused by peer")
+	}
+}
+
+func TestRegisterPeersTwice(t *testing.T) {
+	gee := newTestGroup(t, "register-twice", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	gee.RegisterPeers(NewHTTPPool("self"))
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expect second RegisterPeers to panic")
+		}
+	}()
+	gee.RegisterPeers(NewHTTPPool("self"))
+}
+
+func TestHTTPPoolFetchesFromOwner(t *testing.T) {
+	var loads []string
+	gee := newTestGroup(t, "http-owner", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads = append(loads, key)
+			return []byte("v-" + key), nil
+		}), WithHotCacheRate(0))
+
+	// 两个节点共享同一个进程内的 Group 注册表，通过统计 b 收到的请求区分远程获取
+	var remote int32
+	b := NewHTTPPool("")
+	srvB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&remote, 1)
+		b.ServeHTTP(w, r)
+	}))
+	defer srvB.Close()
+	// a 是本节点，不会向自己发起请求，因此不需要真正监听
+	a := NewHTTPPool("http://node-a")
+	a.Set("http://node-a", srvB.URL)
+	gee.RegisterPeers(a)
+
+	var ownedByB, ownedByA string
+	for i := 0; ownedByA == "" || ownedByB == ""; i++ {
+		key := "key" + strconv.Itoa(i)
+		if peer, ok := a.PickPeer(key); ok && peer.(*httpGetter).baseURL == srvB.URL+defaultBasePath {
+			ownedByB = key
+		} else if !ok {
+			ownedByA = key
+		}
+	}
+
+	if view, err := gee.Get(ownedByB); err != nil || view.String() != "v-"+ownedByB {
+		t.Fatalf("get %s: %v %v", ownedByB, view, err)
+	}
+	if n := atomic.LoadInt32(&remote); n != 1 {
+		t.Fatalf("expect %s fetched over HTTP from its owner, got %d requests", ownedByB, n)
+	}
+	if view, err := gee.Get(ownedByA); err != nil || view.String() != "v-"+ownedByA {
+		t.Fatalf("get %s: %v %v", ownedByA, view, err)
+	}
+	if n := atomic.LoadInt32(&remote); n != 1 {
+		t.Fatalf("expect %s loaded locally, got %d remote requests", ownedByA, n)
+	}
+	if !reflect.DeepEqual(loads, []string{ownedByB, ownedByA}) {
+		t.Fatalf("unexpected loads %v", loads)
+	}
+}
+
+func TestWriteContextCancelsPeerRequest(t *testing.T) {
+	gee := newTestGroup(t, "http-write-cancel", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	var aborted atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 读完请求体之后服务端才能发现连接被关闭
+		io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+			aborted.Add(1)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+	gee.RegisterPeers(fakePicker{peer: &httpGetter{baseURL: srv.URL + defaultBasePath}})
+
+	for name, write := range map[string]func(ctx context.Context) error{
+		"set":    func(ctx context.Context) error { return gee.SetContext(ctx, "Tom", []byte("630"), 0) },
+		"remove": func(ctx context.Context) error { return gee.RemoveContext(ctx, "Tom") },
+		"setifversion": func(ctx context.Context) error {
+			_, err := gee.SetIfVersionContext(ctx, "Tom", []byte("630"), 0)
+			return err
+		},
+		"touch": func(ctx context.Context) error {
+			if gee.TouchContext(ctx, "Tom") {
+				return errors.New("expect Tom not to be touched")
+			}
+			return ctx.Err()
+		},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		start := time.Now()
+		err := write(ctx)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: expect context.DeadlineExceeded, got %v", name, err)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("%s: expect the write to return promptly, took %v", name, d)
+		}
+	}
+	// 取消的请求在拥有者上同样结束
+	for deadline := time.Now().Add(time.Second); aborted.Load() != 4 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if n := aborted.Load(); n != 4 {
+		t.Fatalf("expect 4 aborted requests on the owner, got %d", n)
+	}
+}
+
+func TestGetContextCancelsPeerRequest(t *testing.T) {
+	gee := newTestGroup(t, "http-cancel", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+
+	aborted := make(chan struct{}, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			aborted <- struct{}{}
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+	gee.RegisterPeers(fakePicker{peer: &httpGetter{baseURL: srv.URL + defaultBasePath}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := gee.GetContext(ctx, "Tom"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect context.DeadlineExceeded, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("expect GetContext to return promptly, took %v", d)
+	}
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Fatalf("expect the peer request to be aborted")
+	}
+
+	// GetInto 直接读取拥有者的响应体，被取消的流同样不算作节点的错误
+	m := NewMemoryCollector()
+	stream := newTestGroup(t, "http-cancel-stream", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithHotCacheRate(0), WithMetrics(m))
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	stream.RegisterPeers(fakePicker{peer: getter})
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	var buf bytes.Buffer
+	if err := stream.GetInto(ctx, "Tom", WriterSink(&buf)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect context.DeadlineExceeded, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("expect GetInto to return promptly, took %v", d)
+	}
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Fatalf("expect the peer stream to be aborted")
+	}
+	if s := stream.Stats(); s.PeerErrors != 0 || getter.errors.Load() != 0 || m.PeerErrors(peerName(getter)) != 0 {
+		t.Fatalf("expect a cancelled stream not to count as a peer error, got %+v", s)
+	}
+}
+
+func TestCancelledRequestCancelsOwnerLoad(t *testing.T) {
+	started := make(chan struct{})
+	cancelled := make(chan error, 1)
+	gee := newTestGroup(t, "http-cancel-owner", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			if key != "slow" {
+				return []byte(key), nil
+			}
+			close(started)
+			select {
+			case <-ctx.Done():
+				cancelled <- ctx.Err()
+				return nil, ctx.Err()
+			case <-time.After(5 * time.Second):
+				return []byte(key), nil
+			}
+		}))
+	srv := httptest.NewServer(NewHTTPPool("self"))
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	gee.RegisterPeers(fakePicker{peer: getter})
+
+	// 先建立一个连接，它的 goroutine 计入基线
+	if v, err := gee.Get("Tom"); err != nil || v.String() != "Tom" {
+		t.Fatalf("get Tom: %q %v", v, err)
+	}
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	start := time.Now()
+	if _, err := gee.GetContext(ctx, "slow"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect context.Canceled, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("expect GetContext to return promptly, took %v", d)
+	}
+	select {
+	case err := <-cancelled:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expect the owner's getter to see context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expect the owner's getter to be cancelled")
+	}
+
+	// 连接和两端的 goroutine 都被回收，同一个客户端之后的请求不受影响
+	if v, err := gee.Get("Jack"); err != nil || v.String() != "Jack" {
+		t.Fatalf("get Jack after cancellation: %q %v", v, err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Fatalf("goroutines leaked: %d before, %d after", before, n)
+	}
+}
+
+func TestCancelDuringBodyRead(t *testing.T) {
+	headers := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/fast") {
+			w.Write([]byte("fast"))
+			return
+		}
+		// 只写出一半的响应体，然后等待请求方放弃
+		w.Header().Set("Content-Length", "10")
+		w.Write([]byte("half-"))
+		w.(http.Flusher).Flush()
+		close(headers)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-headers
+		cancel()
+	}()
+	start := time.Now()
+	if _, err := getter.Get(ctx, "scores", "slow"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect context.Canceled, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("expect Get to return promptly, took %v", d)
+	}
+	if n := getter.errors.Load(); n != 0 {
+		t.Fatalf("expect a cancellation not to count as a peer error, got %d errors", n)
+	}
+	for i := 0; i < 3; i++ {
+		if b, err := getter.Get(context.Background(), "scores", "fast"); err != nil || string(b) != "fast" {
+			t.Fatalf("get after cancellation: %q %v", b, err)
+		}
+	}
+}
+
+func TestServeHTTPDelete(t *testing.T) {
+	gee := newTestGroup(t, "http-delete", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	gee.Get("Tom")
+
+	srv := httptest.NewServer(NewHTTPPool("self"))
+	defer srv.Close()
+
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	if err := getter.Remove(context.Background(), "http-delete", "Tom"); err != nil {
+		t.Fatalf("remove Tom on peer: %v", err)
+	}
+	if _, ok := gee.maincache.get("Tom"); ok {
+		t.Fatalf("expect Tom removed by the DELETE request")
+	}
+	if err := getter.Remove(context.Background(), "no-such-group", "Tom"); err == nil {
+		t.Fatalf("expect error for unknown group")
+	}
+}
+
+func TestSetRoutesToOwner(t *testing.T) {
+	owner := newTestGroup(t, "set-owner", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("owner should not load %s", key)
+		}), WithMaxValueBytes(64))
+	local := newTestGroup(t, "set-local", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("local node should not load %s", key)
+		}))
+
+	// 两个节点共享进程内的 Group 注册表，这里把发往 owner 节点的请求改写到它自己的 Group
+	pool := NewHTTPPool("owner")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = strings.Replace(r.URL.Path, "/set-local/", "/set-owner/", 1)
+		pool.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	local.RegisterPeers(fakePicker{peer: &httpGetter{baseURL: srv.URL + defaultBasePath}})
+
+	if err := local.Set("Tom", []byte("630"), time.Minute); err != nil {
+		t.Fatalf("set Tom through the owner: %v", err)
+	}
+	v, ok := owner.maincache.get("Tom")
+	if !ok || v.String() != "630" || v.Expire().IsZero() {
+		t.Fatalf("expect owner to hold Tom with a deadline, got %q %v", v, ok)
+	}
+	if _, ok := local.maincache.get("Tom"); ok {
+		t.Fatalf("expect non-owner not to store Tom in its main cache")
+	}
+	if view, err := local.Get("Tom"); err != nil || view.String() != "630" {
+		t.Fatalf("expect Tom fetched from the owner, got %q %v", view, err)
+	}
+
+	if err := local.Set("Jack", make([]byte, 128), 0); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("expect owner to refuse oversized value, got %v", err)
+	}
+}
+
+func TestServeHTTPCountsRequests(t *testing.T) {
+	m := NewMemoryCollector()
+	gee := newTestGroup(t, "http-stats", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithMetrics(m))
+	srv := httptest.NewServer(NewHTTPPool("self"))
+	defer srv.Close()
+
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	getter.Get(context.Background(), "http-stats", "Tom")
+	getter.Get(context.Background(), "http-stats", "Tom")
+	if st := gee.Stats(); st.ServerRequests != 2 || st.LocalLoads != 1 {
+		t.Fatalf("expect 2 server requests and 1 local load, got %+v", st)
+	}
+	if m.ServerRequests("http-stats") != 2 {
+		t.Fatalf("expect 2 server requests reported to the collector, got %d", m.ServerRequests("http-stats"))
+	}
+}
+
+func TestTTLPropagatesToPeers(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer setNow(&clock)()
+
+	ownerLoads := 0
+	newTestGroup(t, "ttl-owner", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			ownerLoads++
+			return []byte("v" + strconv.Itoa(ownerLoads)), nil
+		}), WithTTL(time.Minute))
+	local := newTestGroup(t, "ttl-local", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("local node should not load %s", key)
+		}), WithTTL(time.Minute), WithHotCacheRate(1))
+
+	pool := NewHTTPPool("owner")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = strings.Replace(r.URL.Path, "/ttl-local/", "/ttl-owner/", 1)
+		pool.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	local.RegisterPeers(fakePicker{peer: getter})
+
+	if _, ttl, err := getter.GetTTL(context.Background(), "ttl-owner", "Tom"); err != nil || ttl != time.Minute {
+		t.Fatalf("expect the owner to report a full minute for a fresh load, got %v %v", ttl, err)
+	}
+
+	// 拥有者缓存 Tom 40 秒之后，非拥有者拿到的副本只剩 20 秒
+	clock = clock.Add(40 * time.Second)
+	view, err := local.Get("Tom")
+	if err != nil || view.String() != "v1" {
+		t.Fatalf("get Tom from the owner: %q %v", view, err)
+	}
+	if want := clock.Add(20 * time.Second); !view.Expire().Equal(want) {
+		t.Fatalf("expect the replica to expire at %v, got %v", want, view.Expire())
+	}
+	if v, ok := local.hotcache.get("Tom"); !ok || !v.Expire().Equal(view.Expire()) {
+		t.Fatalf("expect the hot copy to keep the owner's deadline, got %v %v", v.Expire(), ok)
+	}
+
+	// 到期之后两个节点都把 Tom 当作未命中
+	clock = clock.Add(20 * time.Second)
+	if view, err := local.Get("Tom"); err != nil || view.String() != "v2" || ownerLoads != 2 {
+		t.Fatalf("expect Tom reloaded on the owner after expiry, got %q %v, %d loads", view, err, ownerLoads)
+	}
+}
+
+func TestHTTPGetMulti(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer setNow(&clock)()
+
+	newTestGroup(t, "http-multi", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}), WithTTL(time.Minute))
+	srv := httptest.NewServer(NewHTTPPool("self"))
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+
+	results, err := getter.GetMulti(context.Background(), "http-multi", []string{"Tom", "unknown", "Jack"})
+	if err != nil || len(results) != 3 {
+		t.Fatalf("GetMulti: %v %v", results, err)
+	}
+	if string(results[0].Value) != "630" || results[0].TTL != time.Minute || results[0].Err != nil {
+		t.Fatalf("unexpected result for Tom %+v", results[0])
+	}
+	// 数据源的错误信息不会离开拥有者，请求方只知道它的分类
+	if !errors.Is(results[1].Err, ErrPeerUnavailable) || strings.Contains(results[1].Err.Error(), "unknown not exist") {
+		t.Fatalf("expect the classified error for unknown carried per key, got %+v", results[1])
+	}
+	if string(results[2].Value) != "589" {
+		t.Fatalf("unexpected result for Jack %+v", results[2])
+	}
+	if _, err := getter.GetMulti(context.Background(), "no-such-group", []string{"Tom"}); err == nil {
+		t.Fatalf("expect error for unknown group")
+	}
+}
+
+func TestNotFoundAcrossPeers(t *testing.T) {
+	newTestGroup(t, "nf-owner", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "broken" {
+				return nil, errors.New("database is down")
+			}
+			return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+		}))
+	var localLoads []string
+	local := newTestGroup(t, "nf-local", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			localLoads = append(localLoads, key)
+			return []byte("local-" + key), nil
+		}), WithNegativeTTL(time.Minute))
+
+	var requests int32
+	pool := NewHTTPPool("owner")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		r.URL.Path = strings.Replace(r.URL.Path, "/nf-local/", "/nf-owner/", 1)
+		pool.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	local.RegisterPeers(fakePicker{peer: getter})
+
+	rsp, err := http.Get(getter.keyURL("nf-owner", "Tom"))
+	if err != nil {
+		t.Fatalf("get Tom: %v", err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expect 404 for a missing key, got %d", rsp.StatusCode)
+	}
+	if _, err := getter.Get(context.Background(), "no-such-group", "Tom"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect a missing group not to look like a missing key, got %v", err)
+	}
+
+	_, err = local.Get("Tom")
+	if !errors.Is(err, ErrNotFound) || err.Error() != "Tom not exist: geecache: key not found" {
+		t.Fatalf("expect the owner's ErrNotFound, got %v", err)
+	}
+	n := atomic.LoadInt32(&requests)
+	if _, err := local.Get("Tom"); !errors.Is(err, ErrNotFound) || atomic.LoadInt32(&requests) != n {
+		t.Fatalf("expect the miss cached on the non-owner, got %v", err)
+	}
+
+	// 其他错误仍然回退到本地加载
+	if v, err := local.Get("broken"); err != nil || v.String() != "local-broken" {
+		t.Fatalf("expect fallback to the local getter, got %q %v", v, err)
+	}
+	if !reflect.DeepEqual(localLoads, []string{"broken"}) {
+		t.Fatalf("expect only broken loaded locally, got %v", localLoads)
+	}
+
+	results, err := getter.GetMulti(context.Background(), "nf-owner", []string{"Jack", "broken"})
+	if err != nil || !errors.Is(results[0].Err, ErrNotFound) || errors.Is(results[1].Err, ErrNotFound) {
+		t.Fatalf("expect not-found to survive the batch path, got %+v %v", results, err)
+	}
+}
+
+func TestPeerRetry(t *testing.T) {
+	newTestGroup(t, "retry-owner", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "missing" {
+				return nil, ErrNotFound
+			}
+			return []byte("owner-" + key), nil
+		}))
+	local := newTestGroup(t, "retry-local", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("local-" + key), nil
+		}), WithPeerRetry(2, time.Millisecond))
+
+	var requests int32
+	pool := NewHTTPPool("owner")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 前两次请求模拟节点暂时不可用
+		if atomic.AddInt32(&requests, 1) <= 2 {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		r.URL.Path = strings.Replace(r.URL.Path, "/retry-local/", "/retry-owner/", 1)
+		pool.ServeHTTP(w, r)
+	}))
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	local.RegisterPeers(fakePicker{peer: getter})
+
+	if v, err := local.Get("Tom"); err != nil || v.String() != "owner-Tom" {
+		t.Fatalf("expect the owner's value after retrying, got %q %v", v, err)
+	}
+	if st := local.Stats(); st.PeerRetries != 2 || st.PeerExhausted != 0 || st.LocalLoads != 0 {
+		t.Fatalf("expect 2 retries and no local load, got %+v", st)
+	}
+
+	// ErrNotFound 不是暂时性错误，不会重试
+	n := atomic.LoadInt32(&requests)
+	if _, err := local.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound, got %v", err)
+	}
+	if atomic.LoadInt32(&requests) != n+1 {
+		t.Fatalf("expect a single request for a missing key, got %d", atomic.LoadInt32(&requests)-n)
+	}
+
+	// 节点宕机时重试用完之后回退到本地加载
+	srv.Close()
+	if v, err := local.Get("Jack"); err != nil || v.String() != "local-Jack" {
+		t.Fatalf("expect fallback to the local getter, got %q %v", v, err)
+	}
+	if st := local.Stats(); st.PeerRetries != 4 || st.PeerExhausted != 1 || st.LocalLoads != 1 {
+		t.Fatalf("expect retries exhausted before the local load, got %+v", st)
+	}
+}
+
+func TestPeerRetryDeadline(t *testing.T) {
+	local := newTestGroup(t, "retry-deadline", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("local-" + key), nil
+		}), WithPeerRetry(50, 20*time.Millisecond))
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	local.RegisterPeers(fakePicker{peer: &httpGetter{baseURL: srv.URL + defaultBasePath}})
+
+	// 加载在共享的 context 中进行，调用方的截止时间仍然限制重试
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	local.GetContext(ctx, "Tom")
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("expect the retries to stop at the caller's deadline, took %v", d)
+	}
+	if n := atomic.LoadInt32(&requests); n > 6 {
+		t.Fatalf("expect only the retries that fit before the deadline, got %d requests", n)
+	}
+	if st := local.Stats(); st.PeerExhausted != 1 {
+		t.Fatalf("expect the retries to give up before the deadline, got %+v", st)
+	}
+}
+
+func TestFallbackToSecondOwner(t *testing.T) {
+	second := newTestGroup(t, "second-owner", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("second-" + key), nil
+		}))
+	var localLoads []string
+	local := newTestGroup(t, "second-local", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			localLoads = append(localLoads, key)
+			return []byte("local-" + key), nil
+		}), WithPeerRetry(0, 0))
+
+	owner := NewHTTPPool("owner")
+	live := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = strings.Replace(r.URL.Path, "/second-local/", "/second-owner/", 1)
+		owner.ServeHTTP(w, r)
+	}))
+	defer live.Close()
+
+	// 在环上找到第一个拥有者宕机、第二个拥有者分别是存活节点和本节点的 key。
+	// 少数端口组合在环上找不到其中一种 key，这时换一个宕机节点的地址
+	self := "http://self"
+	var pool *HTTPPool
+	var deadURL, viaLive, viaSelf string
+	for attempt := 0; attempt < 10 && (viaLive == "" || viaSelf == ""); attempt++ {
+		dead := httptest.NewServer(http.NotFoundHandler())
+		dead.Close()
+		deadURL, viaLive, viaSelf = dead.URL, "", ""
+		pool = NewHTTPPool(self)
+		pool.Set(self, deadURL, live.URL)
+		for i := 0; i < 1000 && (viaLive == "" || viaSelf == ""); i++ {
+			key := strconv.Itoa(i)
+			owners := pool.peers.GetN(key, 2)
+			switch {
+			case owners[0] == deadURL && owners[1] == live.URL:
+				viaLive = key
+			case owners[0] == deadURL && owners[1] == self:
+				viaSelf = key
+			}
+		}
+	}
+	if viaLive == "" || viaSelf == "" {
+		t.Fatalf("no suitable keys on the ring")
+	}
+	local.RegisterPeers(pool)
+	ring := NewHTTPPool(live.URL)
+	ring.Set(self, deadURL, live.URL)
+	second.RegisterPeers(ring)
+	if peers := pool.PickPeers(viaSelf, 2); len(peers) != 1 {
+		t.Fatalf("expect PickPeers to stop before self, got %d peers", len(peers))
+	}
+
+	if v, err := local.Get(viaLive); err != nil || v.String() != "second-"+viaLive {
+		t.Fatalf("expect the second owner to serve %s, got %q %v", viaLive, v, err)
+	}
+	if st := local.Stats(); st.PeerLoads != 1 || st.SecondaryLoads != 1 || st.PeerErrors != 1 || st.LocalLoads != 0 {
+		t.Fatalf("expect one load served by the second owner, got %+v", st)
+	}
+	// 删除只会发往第一个拥有者，后备拥有者和请求方都不缓存这个值
+	if _, ok := second.maincache.get(viaLive); ok {
+		t.Fatalf("expect the second owner not to cache %s", viaLive)
+	}
+	if _, ok := local.hotcache.get(viaLive); ok {
+		t.Fatalf("expect %s not to be copied into the hot cache", viaLive)
+	}
+
+	if v, err := local.Get(viaSelf); err != nil || v.String() != "local-"+viaSelf {
+		t.Fatalf("expect %s loaded locally, got %q %v", viaSelf, v, err)
+	}
+	if !reflect.DeepEqual(localLoads, []string{viaSelf}) {
+		t.Fatalf("expect only %s loaded locally, got %v", viaSelf, localLoads)
+	}
+}
+
+func TestHTTPGetCached(t *testing.T) {
+	var calls int32
+	gee := newTestGroup(t, "http-cached", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			atomic.AddInt32(&calls, 1)
+			return []byte("v-" + key), nil
+		}))
+	gee.Get("Tom")
+
+	srv := httptest.NewServer(NewHTTPPool("self"))
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+
+	if v, ok, err := getter.GetCached(context.Background(), "http-cached", "Tom"); err != nil || !ok || string(v) != "v-Tom" {
+		t.Fatalf("expect Tom cached on the owner, got %q %v %v", v, ok, err)
+	}
+	if _, ok, err := getter.GetCached(context.Background(), "http-cached", "Jack"); err != nil || ok {
+		t.Fatalf("expect Jack not cached, got %v %v", ok, err)
+	}
+	rsp, err := http.Head(getter.keyURL("http-cached", "Tom") + "?op=cached")
+	if err != nil {
+		t.Fatalf("head Tom: %v", err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("expect HEAD to report Tom cached, got %d", rsp.StatusCode)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("expect probes not to load on the owner, got %d getter calls", n)
+	}
+}
+
+func TestCacheFilterAcrossPeers(t *testing.T) {
+	newTestGroup(t, "filter-owner", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("owner-" + key), nil
+		}), WithCacheFilter(func(key string) bool {
+		return !strings.HasPrefix(key, "nocache:")
+	}))
+	// 请求方自己没有过滤条件，并且总是把远程的值放入热点缓存
+	local := newTestGroup(t, "filter-local", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s should come from the owner", key)
+		}), WithHotCacheRate(1))
+
+	pool := NewHTTPPool("owner")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = strings.Replace(r.URL.Path, "/filter-local/", "/filter-owner/", 1)
+		pool.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	local.RegisterPeers(fakePicker{peer: &httpGetter{baseURL: srv.URL + defaultBasePath}})
+
+	if v, err := local.Get("nocache:token"); err != nil || v.String() != "owner-nocache:token" {
+		t.Fatalf("expect the owner to serve the filtered key, got %q %v", v, err)
+	}
+	if _, ok := local.GetCached("nocache:token"); ok {
+		t.Fatalf("expect the no-store response not cached by the requester")
+	}
+	local.Get("Tom")
+	if _, ok := local.GetCached("Tom"); !ok {
+		t.Fatalf("expect ordinary keys still cached by the requester")
+	}
+	if st := GetGroup("filter-owner").Stats(); st.Bypasses != 1 {
+		t.Fatalf("expect the owner to bypass its cache once, got %+v", st)
+	}
+}
+
+func TestRichGetterAcrossPeers(t *testing.T) {
+	newTestGroup(t, "rich-owner", 2<<10, RichGetterFunc(
+		func(ctx context.Context, key string) ([]byte, CacheOptions, error) {
+			if key == "volatile" {
+				return []byte("v"), CacheOptions{NoStore: true}, nil
+			}
+			return []byte("s"), CacheOptions{TTL: time.Minute}, nil
+		}))
+	local := newTestGroup(t, "rich-local", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s should come from the owner", key)
+		}), WithHotCacheRate(1))
+
+	pool := NewHTTPPool("owner")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = strings.Replace(r.URL.Path, "/rich-local/", "/rich-owner/", 1)
+		pool.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	local.RegisterPeers(fakePicker{peer: getter})
+
+	local.Get("short")
+	v, ok := local.GetCached("short")
+	if !ok || v.expire.IsZero() || time.Until(v.expire) > time.Minute {
+		t.Fatalf("expect the remote copy to inherit the owner's ttl, got %v %v", v.expire, ok)
+	}
+	if v, err := local.Get("volatile"); err != nil || v.String() != "v" {
+		t.Fatalf("get volatile: %q %v", v, err)
+	}
+	if _, ok := local.GetCached("volatile"); ok {
+		t.Fatalf("expect the NoStore value not cached by the requester")
+	}
+
+	results, err := getter.GetMulti(context.Background(), "rich-owner", []string{"short", "volatile"})
+	if err != nil || results[0].NoStore || !results[1].NoStore {
+		t.Fatalf("expect NoStore carried by batch results, got %+v %v", results, err)
+	}
+}
+
+func TestOnlyOwnersKeepValues(t *testing.T) {
+	const nodes = 3
+	var loads atomic.Int32
+	groups := make([]*Group, nodes)
+	pools := make([]*HTTPPool, nodes)
+	urls := make([]string, nodes)
+	for i := range groups {
+		name := "owners-only-" + strconv.Itoa(i)
+		groups[i] = newTestGroup(t, name, 2<<10, GetterFunc(
+			func(key string) ([]byte, error) {
+				loads.Add(1)
+				return []byte("v-" + key), nil
+			}), WithHotCacheRate(0))
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// 每个节点都有自己的 Group，把请求中的组名改写为本节点的组名
+			parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, defaultBasePath), "/", 2)
+			r.URL.Path = defaultBasePath + name + "/" + parts[1]
+			pools[i].ServeHTTP(w, r)
+		}))
+		defer srv.Close()
+		urls[i] = srv.URL
+	}
+	for i := range pools {
+		pools[i] = NewHTTPPool(urls[i])
+		pools[i].Set(urls...)
+		groups[i].RegisterPeers(pools[i])
+	}
+
+	const keys = 30
+	for round := 0; round < 3; round++ {
+		for _, g := range groups {
+			for k := 0; k < keys; k++ {
+				key := "key" + strconv.Itoa(k)
+				if v, err := g.Get(key); err != nil || v.String() != "v-"+key {
+					t.Fatalf("get %s: %q %v", key, v, err)
+				}
+			}
+		}
+	}
+	if n := loads.Load(); n != keys {
+		t.Fatalf("expect each key loaded once in the cluster, got %d loads", n)
+	}
+	entries := 0
+	for _, g := range groups {
+		st := g.CacheStats()
+		if st.Hot.Entries != 0 {
+			t.Fatalf("expect no copies in hotcache, got %d", st.Hot.Entries)
+		}
+		entries += st.Main.Entries
+	}
+	if entries != keys {
+		t.Fatalf("expect each key stored once in the cluster, got %d entries", entries)
+	}
+}
+
+func TestGetFreshAcrossPeers(t *testing.T) {
+	var version atomic.Int32
+	owner := newTestGroup(t, "fresh-owner", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("v" + strconv.Itoa(int(version.Add(1)))), nil
+		}))
+	local := newTestGroup(t, "fresh-local", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s should come from the owner", key)
+		}), WithHotCacheRate(1))
+
+	pool := NewHTTPPool("owner")
+	var refreshes atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("refresh") != "" {
+			refreshes.Add(1)
+		}
+		r.URL.Path = strings.Replace(r.URL.Path, "/fresh-local/", "/fresh-owner/", 1)
+		pool.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	local.RegisterPeers(fakePicker{peer: &httpGetter{baseURL: srv.URL + defaultBasePath}})
+
+	local.Get("Tom")
+	if v, _ := local.Get("Tom"); v.String() != "v1" {
+		t.Fatalf("expect v1 from the hot copy, got %q", v)
+	}
+	if v, err := local.GetFresh(context.Background(), "Tom"); err != nil || v.String() != "v2" {
+		t.Fatalf("expect the owner to reload instead of echoing its copy, got %q %v", v, err)
+	}
+	if refreshes.Load() != 1 {
+		t.Fatalf("expect one refresh request, got %d", refreshes.Load())
+	}
+	if v, ok := owner.GetCached("Tom"); !ok || v.String() != "v2" {
+		t.Fatalf("expect the owner to cache the reloaded value, got %q %v", v, ok)
+	}
+	if v, _ := local.Get("Tom"); v.String() != "v2" || version.Load() != 2 {
+		t.Fatalf("expect the hot copy replaced, got %q after %d loads", v, version.Load())
+	}
+}
+
+func TestSetIfVersionAcrossPeers(t *testing.T) {
+	owner := newTestGroup(t, "version-owner", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("v-" + key), nil
+		}))
+	local := newTestGroup(t, "version-local", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s should come from the owner", key)
+		}))
+
+	pool := NewHTTPPool("owner")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = strings.Replace(r.URL.Path, "/version-local/", "/version-owner/", 1)
+		pool.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	local.RegisterPeers(fakePicker{peer: getter})
+
+	v, err := local.Get("Tom")
+	if err != nil || v.Version() != 1 {
+		t.Fatalf("expect the owner's version over the wire, got %d %v", v.Version(), err)
+	}
+	if version, err := local.SetIfVersion("Tom", []byte("a"), v.Version()); err != nil || version != 2 {
+		t.Fatalf("expect the owner to accept the write, got %d %v", version, err)
+	}
+	if _, err := local.SetIfVersion("Tom", []byte("b"), v.Version()); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("expect ErrVersionMismatch from the owner, got %v", err)
+	}
+	if v, _ := owner.Get("Tom"); v.String() != "a" || v.Version() != 2 {
+		t.Fatalf("expect the first write stored on the owner, got %q at %d", v, v.Version())
+	}
+	results, err := getter.GetMulti(context.Background(), "version-owner", []string{"Tom"})
+	if err != nil || results[0].Version != 2 {
+		t.Fatalf("expect the version in batch results, got %+v %v", results, err)
+	}
+}
+
+func TestPutAcrossPeers(t *testing.T) {
+	owner := newTestGroup(t, "put-owner", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("old"), nil
+		}))
+	var stored []string
+	local := newTestGroup(t, "put-local", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s should come from the owner", key)
+		}), WithSetter(SetterFunc(func(ctx context.Context, key string, value []byte) error {
+		stored = append(stored, key+"="+string(value))
+		return nil
+	})))
+
+	pool := NewHTTPPool("owner")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = strings.Replace(r.URL.Path, "/put-local/", "/put-owner/", 1)
+		pool.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	local.RegisterPeers(fakePicker{peer: &httpGetter{baseURL: srv.URL + defaultBasePath}})
+
+	owner.Get("Tom")
+	if err := local.Put(context.Background(), "Tom", []byte("new")); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if !reflect.DeepEqual(stored, []string{"Tom=new"}) {
+		t.Fatalf("expect one write to the store, got %v", stored)
+	}
+	if v, ok := owner.GetCached("Tom"); !ok || v.String() != "new" {
+		t.Fatalf("expect the owner's cache updated, got %q %v", v, ok)
+	}
+}
+
+func TestPublishExpvar(t *testing.T) {
+	PublishExpvar()
+
+	owner := newTestGroup(t, "expvar-owner", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "Bad" {
+				return nil, errors.New("source is down")
+			}
+			return []byte(key), nil
+		}))
+	pool := NewHTTPPool("expvar-owner-node")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = strings.Replace(r.URL.Path, "/expvar-local/", "/expvar-owner/", 1)
+		pool.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	// 发布之后才创建的 Group 同样出现在 geecache.groups 中
+	local := newTestGroup(t, "expvar-local", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithPeerRetry(0, 0), WithHotCacheRate(0))
+	localPool := NewHTTPPool("expvar-local-node")
+	localPool.Set(srv.URL)
+	local.RegisterPeers(localPool)
+	PublishExpvar(pool, localPool)
+	defer pool.Close()
+	defer localPool.Close()
+
+	local.Get("Tom")
+	local.Get("Tom")
+	local.Get("Bad")
+	owner.Get("Jack")
+
+	var groupVars map[string]map[string]int64
+	if err := json.Unmarshal([]byte(expvar.Get("geecache.groups").String()), &groupVars); err != nil {
+		t.Fatalf("decode groups: %v", err)
+	}
+	for name, want := range map[string]map[string]int64{
+		"expvar-local": {"gets": 3, "hits": 0, "loads": 3, "peer_loads": 2, "errors": 1, "cache_entries": 1},
+		"expvar-owner": {"gets": 1, "local_loads": 2, "errors": 1, "server_requests": 3, "cache_entries": 2},
+	} {
+		got, ok := groupVars[name]
+		if !ok {
+			t.Fatalf("expect %s in geecache.groups, got %v", name, groupVars)
+		}
+		for k, v := range want {
+			if got[k] != v {
+				t.Errorf("%s %s = %d, want %d", name, k, got[k], v)
+			}
+		}
+	}
+
+	var poolVars map[string]struct {
+		Requests int64 `json:"requests"`
+		Peers    map[string]struct {
+			Fetches int64 `json:"fetches"`
+			Errors  int64 `json:"errors"`
+		} `json:"peers"`
+	}
+	if err := json.Unmarshal([]byte(expvar.Get("geecache.pools").String()), &poolVars); err != nil {
+		t.Fatalf("decode pools: %v", err)
+	}
+	if got := poolVars["expvar-owner-node"].Requests; got != 3 {
+		t.Errorf("owner pool requests = %d, want 3", got)
+	}
+	peer := poolVars["expvar-local-node"].Peers[srv.URL]
+	if peer.Fetches != 3 || peer.Errors != 1 {
+		t.Errorf("local pool peer stats = %+v, want 3 fetches and 1 error", peer)
+	}
+
+	// 没有传入 PublishExpvar 的 HTTPPool 不出现，Close 之后的 HTTPPool 不再出现
+	other := NewHTTPPool("expvar-other-node")
+	defer other.Close()
+	localPool.Close()
+	clear(poolVars)
+	if err := json.Unmarshal([]byte(expvar.Get("geecache.pools").String()), &poolVars); err != nil {
+		t.Fatalf("decode pools: %v", err)
+	}
+	if _, ok := poolVars["expvar-local-node"]; ok {
+		t.Error("expect a closed pool to be unpublished")
+	}
+	if _, ok := poolVars["expvar-other-node"]; ok {
+		t.Error("expect an unpublished pool to stay out of geecache.pools")
+	}
+	if _, ok := poolVars["expvar-owner-node"]; !ok {
+		t.Error("expect the open pool to stay published")
+	}
+}
+
+// recordingTracer 记录开始的每一个 span，并通过 traceHeader 在节点之间传递当前 span 的编号。
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+type recordedSpan struct {
+	mu         *sync.Mutex
+	id, parent int
+	name       string
+	kind       SpanKind
+	group      string
+	ended      bool
+	err        error
+}
+
+type spanIDKey struct{}
+
+const traceHeader = "X-Test-Span"
+
+func (r *recordingTracer) Start(ctx context.Context, name string, kind SpanKind, group, keyHash string) (context.Context, Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	parent, _ := ctx.Value(spanIDKey{}).(int)
+	s := &recordedSpan{mu: &r.mu, id: len(r.spans) + 1, parent: parent, name: name, kind: kind, group: group}
+	r.spans = append(r.spans, s)
+	return context.WithValue(ctx, spanIDKey{}, s.id), s
+}
+
+func (r *recordingTracer) Inject(ctx context.Context, header http.Header) {
+	if id, ok := ctx.Value(spanIDKey{}).(int); ok {
+		header.Set(traceHeader, strconv.Itoa(id))
+	}
+}
+
+func (r *recordingTracer) Extract(ctx context.Context, header http.Header) context.Context {
+	if id, err := strconv.Atoi(header.Get(traceHeader)); err == nil {
+		return context.WithValue(ctx, spanIDKey{}, id)
+	}
+	return ctx
+}
+
+func (s *recordedSpan) End(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ended = true
+	s.err = err
+}
+
+func TestTracerAcrossPeers(t *testing.T) {
+	tracer := &recordingTracer{}
+	newTestGroup(t, "trace-owner", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithTracer(tracer))
+	local := newTestGroup(t, "trace-local", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s should come from the owner", key)
+		}), WithTracer(tracer), WithHotCacheRate(0))
+
+	pool := NewHTTPPool("owner")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = strings.Replace(r.URL.Path, "/trace-local/", "/trace-owner/", 1)
+		pool.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	local.RegisterPeers(fakePicker{peer: &httpGetter{baseURL: srv.URL + defaultBasePath}})
+
+	if v, err := local.Get("Tom"); err != nil || v.String() != "Tom" {
+		t.Fatalf("get: %q %v", v, err)
+	}
+
+	type span struct {
+		name   string
+		kind   SpanKind
+		group  string
+		parent string
+	}
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	byID := map[int]string{}
+	for _, s := range tracer.spans {
+		byID[s.id] = s.name
+	}
+	var got []span
+	for _, s := range tracer.spans {
+		if !s.ended || s.err != nil {
+			t.Errorf("span %s: ended %v, err %v", s.name, s.ended, s.err)
+		}
+		got = append(got, span{s.name, s.kind, s.group, byID[s.parent]})
+	}
+	want := []span{
+		{SpanGet, SpanInternal, "trace-local", ""},
+		{SpanPeer, SpanClient, "trace-local", SpanGet},
+		{SpanServe, SpanServer, "trace-owner", SpanPeer},
+		{SpanLoad, SpanInternal, "trace-owner", SpanServe},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("spans = %+v, want %+v", got, want)
+	}
+}
+
+func TestHTTPGetterPanic(t *testing.T) {
+	newTestGroup(t, "http-panic", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			panic("source exploded")
+		}), WithLogger(NopLogger{}))
+
+	srv := httptest.NewServer(NewHTTPPool("self"))
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL + defaultBasePath + "http-panic/Tom")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	defer rsp.Body.Close()
+	body, _ := io.ReadAll(rsp.Body)
+	if rsp.StatusCode != http.StatusInternalServerError || string(body) != ErrGetterPanic.Error()+"\n" {
+		t.Fatalf("expect a terse 500, got %d %q", rsp.StatusCode, body)
+	}
+}
+
+func TestHTTPPoolRegistry(t *testing.T) {
+	var srvs []*httptest.Server
+	for _, tenant := range []string{"a", "b"} {
+		r := NewRegistry()
+		r.NewGroup("scores", 2<<10, GetterFunc(
+			func(key string) ([]byte, error) {
+				return []byte(tenant + ":" + key), nil
+			}))
+		defer r.DestroyGroup("scores")
+		srv := httptest.NewServer(NewHTTPPool("self", WithRegistry(r)))
+		defer srv.Close()
+		srvs = append(srvs, srv)
+	}
+	// 默认的 Registry 中没有 scores，只有绑定了 Registry 的 HTTPPool 能找到它
+	def := httptest.NewServer(NewHTTPPool("self"))
+	defer def.Close()
+
+	for i, want := range []string{"a:Tom", "b:Tom"} {
+		v, err := (&httpGetter{baseURL: srvs[i].URL + defaultBasePath}).Get(context.Background(), "scores", "Tom")
+		if err != nil || string(v) != want {
+			t.Fatalf("tenant %d: got %q %v, want %q", i, v, err, want)
+		}
+	}
+	if _, err := (&httpGetter{baseURL: def.URL + defaultBasePath}).Get(context.Background(), "scores", "Tom"); err == nil {
+		t.Fatalf("expect the default pool not to see other registries")
+	}
+}
+
+func TestServeHTTPKeyNormalizer(t *testing.T) {
+	newTestGroup(t, "http-normalizer", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("v:" + key), nil
+		}), WithKeyNormalizer(normalizeKey))
+	srv := httptest.NewServer(NewHTTPPool("self"))
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+
+	// 请求方没有规范化 key 时，拥有者节点仍然按规范化之后的 key 处理
+	if v, err := getter.Get(context.Background(), "http-normalizer", " Tom"); err != nil || string(v) != "v:tom" {
+		t.Fatalf("expect the owner to normalize the key, got %q %v", v, err)
+	}
+	if found, err := getter.Touch(context.Background(), "http-normalizer", "TOM"); err != nil || !found {
+		t.Fatalf("expect TOM touched as tom, got %v %v", found, err)
+	}
+	results, err := getter.GetMulti(context.Background(), "http-normalizer", []string{"TOM", " "})
+	if err != nil || string(results[0].Value) != "v:tom" || results[1].Err == nil {
+		t.Fatalf("GetMulti: %+v %v", results, err)
+	}
+
+	rsp, err := http.Get(srv.URL + defaultBasePath + "http-normalizer/%20")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expect 400 for an invalid key, got %d", rsp.StatusCode)
+	}
+}
+
+func TestHTTPProtobuf(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer setNow(&clock)()
+
+	newTestGroup(t, "http-protobuf", 2<<10, RichGetterFunc(
+		func(ctx context.Context, key string) ([]byte, CacheOptions, error) {
+			if key == "unknown" {
+				return nil, CacheOptions{}, fmt.Errorf("%s: %w", key, ErrNotFound)
+			}
+			return []byte("v:" + key), CacheOptions{NoStore: key == "volatile"}, nil
+		}), WithTTL(time.Minute))
+	srv := httptest.NewServer(NewHTTPPool("self"))
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+
+	r, err := getter.getValue(context.Background(), "http-protobuf", "Tom", false)
+	if err != nil || string(r.Value) != "v:Tom" || r.TTL != time.Minute || r.Version != 1 || r.NoStore {
+		t.Fatalf("unexpected result %+v %v", r, err)
+	}
+	if r, err := getter.getValue(context.Background(), "http-protobuf", "volatile", false); err != nil || !r.NoStore {
+		t.Fatalf("expect the no-store flag carried, got %+v %v", r, err)
+	}
+	if _, err := getter.Get(context.Background(), "http-protobuf", "unknown"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound, got %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+defaultBasePath+"http-protobuf/Tom", nil)
+	req.Header.Set("Accept", "text/plain, "+protobufType+";q=0.9")
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	rsp.Body.Close()
+	if ct := rsp.Header.Get("Content-Type"); ct != protobufType {
+		t.Fatalf("expect a protobuf response, got %q", ct)
+	}
+
+	// 不在 Accept 中声明 protobuf 的旧版本请求方仍然得到原始的字节和头部
+	rsp, err = http.Get(srv.URL + defaultBasePath + "http-protobuf/Tom")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	body, _ := io.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	if string(body) != "v:Tom" || rsp.Header.Get("Content-Type") != "application/octet-stream" || rsp.Header.Get(ttlHeader) != "1m0s" || rsp.Header.Get(ttlMsHeader) != "60000" {
+		t.Fatalf("expect the raw format, got %q %v", body, rsp.Header)
+	}
+
+	// group 和 key 只从路径中读取，发往 basePath 本身的请求被拒绝
+	in, _ := proto.Marshal(&geecachepb.GetRequest{Group: "http-protobuf", Key: "a/b c"})
+	rsp, err = http.Post(srv.URL+defaultBasePath, protobufType, bytes.NewReader(in))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expect a POST to the base path to be rejected, got %d", rsp.StatusCode)
+	}
+}
+
+func TestHTTPGetterRawPeer(t *testing.T) {
+	// 模拟一个旧版本的节点：忽略 Accept，只返回原始的字节和头部
+	old := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != protobufType {
+			t.Errorf("expect the requester to offer protobuf, got Accept %q", r.Header.Get("Accept"))
+		}
+		w.Header().Set(ttlHeader, "30s")
+		w.Header().Set(versionHeader, "3")
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte("raw"))
+	}))
+	defer old.Close()
+	getter := &httpGetter{baseURL: old.URL + defaultBasePath}
+
+	r, err := getter.getValue(context.Background(), "scores", "Tom", false)
+	if err != nil || string(r.Value) != "raw" || r.TTL != 30*time.Second || r.Version != 3 {
+		t.Fatalf("expect the raw response decoded, got %+v %v", r, err)
+	}
+}
+
+func TestHTTPPeerTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 模拟卡住的节点，直到测试结束
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	pool := NewHTTPPool("timeout-self", WithPeerTimeout(50*time.Millisecond))
+	pool.Set(srv.URL)
+	getter := pool.httpGetters[srv.URL]
+	start := time.Now()
+	_, err := getter.Get(context.Background(), "scores", "Tom")
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("request took %v, deadline did not fire", elapsed)
+	}
+	if !errors.Is(err, ErrPeerTimeout) {
+		t.Fatalf("expect ErrPeerTimeout, got %v", err)
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		t.Fatalf("timeout reported as status error: %v", err)
+	}
+	if !retryable(err) {
+		t.Fatalf("expect timeout to be retryable: %v", err)
+	}
+
+	// 调用方的上下文先结束时仍然返回上下文的错误
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := getter.Get(ctx, "scores", "Tom"); errors.Is(err, ErrPeerTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect caller's deadline, got %v", err)
+	}
+
+	if c := NewHTTPPool("timeout-default").client; c != nil {
+		t.Fatalf("expect default pool to share defaultPeerClient, got %v", c)
+	}
+	if defaultPeerClient.Timeout != defaultPeerTimeout {
+		t.Fatalf("expect default timeout %v, got %v", defaultPeerTimeout, defaultPeerClient.Timeout)
+	}
+}
+
+func TestHTTPPoolWithClient(t *testing.T) {
+	gee := newTestGroup(t, "http-client", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	srv := httptest.NewServer(NewHTTPPool("client-owner"))
+	defer srv.Close()
+
+	var requests atomic.Int64
+	c := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		requests.Add(1)
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+	pool := NewHTTPPool("client-self", WithClient(c), WithPeerTimeout(time.Second))
+	pool.Set(srv.URL)
+	if v, err := pool.httpGetters[srv.URL].Get(context.Background(), gee.name, "Tom"); err != nil || string(v) != "Tom" {
+		t.Fatalf("expect Tom from peer, got %s %v", v, err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("expect 1 request through the client, got %d", n)
+	}
+	if c.Timeout != 0 || pool.client.Timeout != time.Second {
+		t.Fatalf("expect timeout on a copy, got client %v pool %v", c.Timeout, pool.client.Timeout)
+	}
+}
+
+func TestHTTPPoolTransportOptions(t *testing.T) {
+	if tr := defaultPeerClient.Transport.(*http.Transport); tr.MaxIdleConnsPerHost != defaultMaxIdleConnsPerHost || tr.MaxIdleConns != 0 {
+		t.Fatalf("expect the default client tuned for a small peer set, got %d idle per host, %d total", tr.MaxIdleConnsPerHost, tr.MaxIdleConns)
+	}
+
+	pool, err := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{
+		MaxIdleConnsPerHost: 16,
+		MaxConnsPerHost:     32,
+		IdleConnTimeout:     time.Minute,
+		DialTimeout:         300 * time.Millisecond,
+		DisableKeepAlives:   true,
+	}, WithRegistry(NewRegistry()), WithPeerTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.client == nil || pool.client == defaultPeerClient {
+		t.Fatalf("expect the pool to own its client")
+	}
+	tr, ok := pool.client.Transport.(*http.Transport)
+	if !ok || tr == defaultPeerClient.Transport {
+		t.Fatalf("expect a copy of the default transport, got %T", pool.client.Transport)
+	}
+	if tr.MaxIdleConnsPerHost != 16 || tr.MaxConnsPerHost != 32 || tr.IdleConnTimeout != time.Minute ||
+		tr.TLSHandshakeTimeout != 300*time.Millisecond || !tr.DisableKeepAlives || pool.client.Timeout != time.Second {
+		t.Fatalf("expect the configured transport, got %+v", tr)
+	}
+	if dt := defaultPeerClient.Transport.(*http.Transport); dt.MaxIdleConnsPerHost != defaultMaxIdleConnsPerHost || dt.DisableKeepAlives {
+		t.Fatalf("expect the default transport unchanged")
+	}
+
+	if err := pool.Set("http://self", "http://a:1", "http://b:2", "http://c:3"); err != nil {
+		t.Fatal(err)
+	}
+	for peer, getter := range pool.httpGetters {
+		if getter.client != pool.client {
+			t.Fatalf("expect %s to share the pool's client", peer)
+		}
+	}
+
+	if _, err := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{MaxConnsPerHost: 1}, WithTransport(roundTripFunc(nil))); err == nil {
+		t.Fatalf("expect transport settings to be rejected for a custom RoundTripper")
+	}
+}
+
+// roundTripFunc 把函数适配为 http.RoundTripper。
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// signingTransport 为每个请求加上签名头，并记录经过它的请求。
+type signingTransport struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+func (s *signingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("X-Signature", "signed")
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.String())
+	s.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestHTTPPoolWithTransport(t *testing.T) {
+	gee := newTestGroup(t, "http-transport", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	owner := NewHTTPPool("transport-owner")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Signature") != "signed" {
+			http.Error(w, "unsigned", http.StatusForbidden)
+			return
+		}
+		owner.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	rt := &signingTransport{}
+	pool := NewHTTPPool("transport-self", WithTransport(rt), WithPeerTimeout(time.Second))
+	pool.Set(srv.URL)
+	getter := pool.httpGetters[srv.URL]
+	if v, err := getter.Get(context.Background(), gee.name, "Tom"); err != nil || string(v) != "Tom" {
+		t.Fatalf("expect Tom from peer, got %s %v", v, err)
+	}
+	if _, err := getter.GetMulti(context.Background(), gee.name, []string{"Jack"}); err != nil {
+		t.Fatalf("GetMulti: %v", err)
+	}
+	if err := getter.Set(context.Background(), gee.name, "Sam", []byte("567"), 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := getter.Remove(context.Background(), gee.name, "Sam"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	base := srv.URL + defaultBasePath + gee.name
+	want := []string{
+		"GET " + base + "/Tom",
+		"POST " + base + "/?op=getmulti",
+		"PUT " + base + "/Sam",
+		"DELETE " + base + "/Sam",
+	}
+	if !reflect.DeepEqual(rt.requests, want) {
+		t.Fatalf("expect requests %q, got %q", want, rt.requests)
+	}
+	if pool.client.Timeout != time.Second {
+		t.Fatalf("expect timeout to compose with the transport, got %v", pool.client.Timeout)
+	}
+}
+
+func TestNewHTTPPoolOptsBasePath(t *testing.T) {
+	const basePath = "/internal/cache/v1/"
+	type node struct {
+		pool  *HTTPPool
+		group *Group
+		srv   *httptest.Server
+	}
+	nodes := make([]*node, 2)
+	for i := range nodes {
+		nd := &node{}
+		registry := NewRegistry()
+		nd.group = registry.NewGroup("scores", 2<<10, GetterFunc(
+			func(key string) ([]byte, error) {
+				return []byte(fmt.Sprintf("node%d:%s", i, key)), nil
+			}))
+		mux := http.NewServeMux()
+		// 网关保留了 /_geecache/，只有配置的前缀会被转给 HTTPPool
+		mux.Handle(basePath, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			nd.pool.ServeHTTP(w, r)
+		}))
+		nd.srv = httptest.NewServer(mux)
+		defer nd.srv.Close()
+		pool, err := NewHTTPPoolOpts(nd.srv.URL, &HTTPPoolOptions{BasePath: "/internal/cache/v1"}, WithRegistry(registry))
+		if err != nil {
+			t.Fatal(err)
+		}
+		nd.pool = pool
+		nodes[i] = nd
+	}
+	for _, nd := range nodes {
+		nd.pool.Set(nodes[0].srv.URL, nodes[1].srv.URL)
+		nd.group.RegisterPeers(nd.pool)
+	}
+
+	var key string
+	for i := 0; key == "" && i < 1000; i++ {
+		if peer, ok := nodes[0].pool.PickPeer(fmt.Sprintf("key%d", i)); ok {
+			if got := peer.(*httpGetter).baseURL; got != nodes[1].srv.URL+basePath {
+				t.Fatalf("expect peer base URL %s, got %s", nodes[1].srv.URL+basePath, got)
+			}
+			key = fmt.Sprintf("key%d", i)
+		}
+	}
+	if key == "" {
+		t.Fatal("no key owned by the second node")
+	}
+	if v, err := nodes[0].group.Get(key); err != nil || v.String() != "node1:"+key {
+		t.Fatalf("expect %s from the second node, got %s %v", key, v, err)
+	}
+	if s := nodes[1].group.Stats(); s.ServerRequests != 1 {
+		t.Fatalf("expect the owner to serve 1 request, got %d", s.ServerRequests)
+	}
+}
+
+func TestNewHTTPPoolOptsInvalidBasePath(t *testing.T) {
+	for _, basePath := range []string{"internal/cache/", "/internal//cache/", "/internal/../cache/", "/cache?v=1"} {
+		if _, err := NewHTTPPoolOpts("invalid-base-path", &HTTPPoolOptions{BasePath: basePath}); err == nil {
+			t.Errorf("expect base path %q to be rejected", basePath)
+		}
+	}
+	p, err := NewHTTPPoolOpts("empty-base-path", &HTTPPoolOptions{})
+	if err != nil || p.basePath != defaultBasePath {
+		t.Fatalf("expect empty base path to default to %s, got %v %v", defaultBasePath, p, err)
+	}
+}
+
+func TestNewHTTPPoolOptsRing(t *testing.T) {
+	peers := []string{"http://ring-a", "http://ring-b", "http://ring-c"}
+
+	// 常数哈希让所有 key 都落在同一个节点上
+	var hashed atomic.Int64
+	constant, err := NewHTTPPoolOpts("http://ring-self", &HTTPPoolOptions{HashFn: func([]byte) uint32 {
+		hashed.Add(1)
+		return 42
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	constant.Set(peers...)
+	owners := make(map[string]bool)
+	for i := range 100 {
+		peer, ok := constant.PickPeer(fmt.Sprintf("key%d", i))
+		if !ok {
+			t.Fatal("expect a peer")
+		}
+		owners[peer.(*httpGetter).baseURL] = true
+	}
+	if len(owners) != 1 || hashed.Load() == 0 {
+		t.Fatalf("expect the custom hash to route every key to one peer, got %v after %d hashes", owners, hashed.Load())
+	}
+
+	// 虚拟节点越多，key 在节点之间分布得越均匀
+	spread := func(replicas int) int {
+		p, err := NewHTTPPoolOpts("http://ring-self", &HTTPPoolOptions{Replicas: replicas})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Set(peers...)
+		counts := make(map[string]int)
+		for i := range 3000 {
+			peer, _ := p.PickPeer(fmt.Sprintf("key%d", i))
+			counts[peer.(*httpGetter).baseURL]++
+		}
+		lo, hi := 3000, 0
+		for _, peer := range peers {
+			lo, hi = min(lo, counts[peer+defaultBasePath]), max(hi, counts[peer+defaultBasePath])
+		}
+		return hi - lo
+	}
+	if few, many := spread(1), spread(500); many >= few {
+		t.Fatalf("expect 500 replicas to spread keys more evenly than 1, got spread %d vs %d", many, few)
+	}
+}
+
+func TestServeHTTPPaths(t *testing.T) {
+	newTestGroup(t, "http-paths", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	pool := NewHTTPPool("paths-self")
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		path string
+		code int
+	}{
+		{"/", http.StatusNotFound},
+		{"/favicon.ico", http.StatusNotFound},
+		{"/_geecache", http.StatusNotFound},
+		{defaultBasePath, http.StatusBadRequest},
+		{defaultBasePath + "http-paths", http.StatusBadRequest},
+		{defaultBasePath + "http-paths/", http.StatusBadRequest},
+		{defaultBasePath + "http-paths/Tom", http.StatusOK},
+		{defaultBasePath + "http-paths/Tom/", http.StatusOK}, // key 可以包含 "/"
+		{defaultBasePath + "no-such-group/Tom", http.StatusNotFound},
+	} {
+		rsp, err := http.Get(srv.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode != tt.code {
+			t.Errorf("GET %s: expect %d, got %d", tt.path, tt.code, rsp.StatusCode)
+		}
+	}
+}
+
+func TestHTTPPoolRegisterOn(t *testing.T) {
+	newTestGroup(t, "http-mux", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	pool := NewHTTPPool("mux-self")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "api")
+	})
+	pool.RegisterOn(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	for path, want := range map[string]string{
+		"/api":                           "api",
+		pool.BasePath() + "http-mux/Tom": "Tom",
+	} {
+		rsp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		if rsp.StatusCode != http.StatusOK || string(b) != want {
+			t.Errorf("GET %s: expect %q, got %d %q", path, want, rsp.StatusCode, b)
+		}
+	}
+	if pool.Stats().Requests != 1 {
+		t.Errorf("expect only the peer request to reach the pool, got %d", pool.Stats().Requests)
+	}
+}
+
+func TestServeHTTPErrorClasses(t *testing.T) {
+	newTestGroup(t, "class-owner", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			switch key {
+			case "down":
+				return nil, errors.New("dial tcp 10.0.0.7:5432: connection refused")
+			case "corrupt":
+				return nil, errors.New("row 42 is corrupt")
+			case "panic":
+				panic("source exploded")
+			}
+			return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+		}), WithLogger(NopLogger{}), WithErrorClassifier(func(err error) ErrorClass {
+		switch {
+		case errors.Is(err, ErrNotFound):
+			return ErrorClassNotFound
+		case strings.Contains(err.Error(), "corrupt"):
+			return ErrorClassFatal
+		}
+		return ErrorClassTransient
+	}))
+	var localLoads atomic.Int64
+	local := newTestGroup(t, "class-local", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			localLoads.Add(1)
+			return []byte("local-" + key), nil
+		}), WithPeerRetry(2, time.Millisecond))
+
+	pool := NewHTTPPool("class-owner-node")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = strings.Replace(r.URL.Path, "/class-local/", "/class-owner/", 1)
+		pool.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	local.RegisterPeers(fakePicker{peer: getter})
+
+	for _, tt := range []struct {
+		key        string
+		code       int
+		reason     string
+		retryAfter string
+		class      error
+		retries    int64
+		fallback   bool
+	}{
+		{"missing", http.StatusNotFound, notFoundReason, "", ErrNotFound, 0, false},
+		{"down", http.StatusServiceUnavailable, unavailableReason, retryAfterSeconds, ErrPeerUnavailable, 2, true},
+		{"corrupt", http.StatusInternalServerError, internalReason, "", ErrPeerInternal, 0, true},
+		{"panic", http.StatusInternalServerError, internalReason, "", ErrPeerInternal, 0, true},
+	} {
+		rsp, err := http.Get(getter.keyURL("class-owner", tt.key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		if rsp.StatusCode != tt.code || rsp.Header.Get(errorHeader) != tt.reason || rsp.Header.Get("Retry-After") != tt.retryAfter {
+			t.Errorf("%s: expect %d %s Retry-After %q, got %d %s %q", tt.key, tt.code, tt.reason, tt.retryAfter,
+				rsp.StatusCode, rsp.Header.Get(errorHeader), rsp.Header.Get("Retry-After"))
+		}
+		if strings.Contains(string(body), "10.0.0.7") || strings.Contains(string(body), "row 42") || strings.Contains(string(body), "exploded") {
+			t.Errorf("%s: internal details leaked to the peer: %q", tt.key, body)
+		}
+
+		_, err = getter.Get(context.Background(), "class-owner", tt.key)
+		if !errors.Is(err, tt.class) {
+			t.Errorf("%s: expect %v from the peer, got %v", tt.key, tt.class, err)
+		}
+		for _, other := range []error{ErrNotFound, ErrPeerUnavailable, ErrPeerInternal} {
+			if other != tt.class && errors.Is(err, other) {
+				t.Errorf("%s: expect %v not to match %v", tt.key, err, other)
+			}
+		}
+
+		before, loads := local.Stats().PeerRetries, localLoads.Load()
+		v, err := local.Get(tt.key)
+		if retries := local.Stats().PeerRetries - before; retries != tt.retries {
+			t.Errorf("%s: expect %d retries, got %d", tt.key, tt.retries, retries)
+		}
+		if fellBack := localLoads.Load() > loads; fellBack != tt.fallback {
+			t.Errorf("%s: expect local fallback %v, got %v (%q %v)", tt.key, tt.fallback, fellBack, v, err)
+		}
+		if !tt.fallback && !errors.Is(err, tt.class) {
+			t.Errorf("%s: expect %v from Get, got %v", tt.key, tt.class, err)
+		}
+	}
+}
+
+func TestRemoveAcrossNodes(t *testing.T) {
+	type node struct {
+		pool  *HTTPPool
+		group *Group
+		srv   *httptest.Server
+		loads atomic.Int64
+	}
+	nodes := make([]*node, 2)
+	for i := range nodes {
+		nd := &node{}
+		registry := NewRegistry()
+		nd.group = registry.NewGroup("scores", 2<<10, GetterFunc(
+			func(key string) ([]byte, error) {
+				nd.loads.Add(1)
+				return []byte(key), nil
+			}), WithHotCacheRate(0))
+		nd.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			nd.pool.ServeHTTP(w, r)
+		}))
+		defer nd.srv.Close()
+		nd.pool = NewHTTPPool(nd.srv.URL, WithRegistry(registry))
+		nodes[i] = nd
+	}
+	a, b := nodes[0], nodes[1]
+	for _, nd := range nodes {
+		nd.pool.Set(a.srv.URL, b.srv.URL)
+		nd.group.RegisterPeers(nd.pool)
+	}
+
+	var key string
+	for i := 0; key == "" && i < 1000; i++ {
+		if _, ok := a.pool.PickPeer(fmt.Sprintf("key%d", i)); ok {
+			key = fmt.Sprintf("key%d", i)
+		}
+	}
+	if _, err := a.group.Get(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.group.maincache.get(key); !ok {
+		t.Fatalf("expect %s cached on its owner", key)
+	}
+
+	// 在 A 上删除会清掉拥有者 B 上的条目，之后的 Get 在 B 上重新加载
+	if err := a.group.Remove(key); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, ok := b.group.maincache.get(key); ok {
+		t.Fatalf("expect %s removed from its owner", key)
+	}
+	if _, err := a.group.Get(key); err != nil || b.loads.Load() != 2 {
+		t.Fatalf("expect %s reloaded on its owner, got %v after %d loads", key, err, b.loads.Load())
+	}
+
+	// 拥有者没有缓存这个 key 时返回 404，删除仍然是成功的
+	b.group.RemoveLocal(key)
+	req, _ := http.NewRequest(http.MethodDelete, b.srv.URL+defaultBasePath+"scores/"+key, nil)
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expect 404 deleting an absent key, got %d", rsp.StatusCode)
+	}
+	if err := a.group.Remove(key); err != nil {
+		t.Fatalf("expect removing an absent key to succeed, got %v", err)
+	}
+	if a.loads.Load() != 0 {
+		t.Fatalf("expect no loads on the non-owner, got %d", a.loads.Load())
+	}
+}
+
+func TestServeHTTPMethods(t *testing.T) {
+	newTestGroup(t, "http-methods", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	srv := httptest.NewServer(NewHTTPPool("methods-self"))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		method, query string
+		code          int
+	}{
+		{http.MethodPatch, "", http.StatusMethodNotAllowed},
+		{http.MethodOptions, "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "", http.StatusBadRequest},
+		{http.MethodPost, "?op=explode", http.StatusBadRequest},
+		{http.MethodGet, "", http.StatusOK},
+		{http.MethodHead, "", http.StatusOK},
+	} {
+		req, _ := http.NewRequest(tt.method, srv.URL+defaultBasePath+"http-methods/Tom"+tt.query, nil)
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode != tt.code {
+			t.Errorf("%s %s: expect %d, got %d", tt.method, tt.query, tt.code, rsp.StatusCode)
+		}
+		if tt.code == http.StatusMethodNotAllowed && rsp.Header.Get("Allow") != allowedMethods {
+			t.Errorf("%s: expect Allow %q, got %q", tt.method, allowedMethods, rsp.Header.Get("Allow"))
+		}
+	}
+}
+
+func TestServeHTTPPut(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer setNow(&clock)()
+
+	gee := newTestGroup(t, "http-put", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("owner should not load %s", key)
+		}))
+	srv := httptest.NewServer(NewHTTPPool("put-self", WithMaxBodyBytes(8)))
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+
+	// 存活时间通过头部传递，不足 1 毫秒的部分向上取整
+	if err := getter.Set(context.Background(), gee.name, "Tom", []byte("630"), 90*time.Second+time.Microsecond); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	view, ok := gee.maincache.get("Tom")
+	if !ok || view.String() != "630" || !view.Expire().Equal(clock.Add(90*time.Second+time.Millisecond)) {
+		t.Fatalf("expect Tom stored with the sent TTL, got %q %v %v", view, view.Expire(), ok)
+	}
+
+	// 旧版本的节点使用 ttl 查询参数
+	req, _ := http.NewRequest(http.MethodPut, getter.keyURL(gee.name, "Jack")+"?ttl=1m", strings.NewReader("589"))
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if view, ok := gee.maincache.get("Jack"); rsp.StatusCode != http.StatusNoContent || !ok || !view.Expire().Equal(clock.Add(time.Minute)) {
+		t.Fatalf("expect Jack stored with the query TTL, got %d %v %v", rsp.StatusCode, view.Expire(), ok)
+	}
+
+	if err := getter.Set(context.Background(), gee.name, "Sam", []byte("too large!"), 0); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("expect ErrValueTooLarge above the pool's body limit, got %v", err)
+	}
+	if _, ok := gee.maincache.get("Sam"); ok {
+		t.Fatalf("expect the oversized value not stored")
+	}
+}
+
+func TestHTTPGetMultiSingleRequest(t *testing.T) {
+	newTestGroup(t, "batch-owner", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "key7" {
+				return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+			}
+			return []byte("owner-" + key), nil
+		}))
+
+	var requests atomic.Int64
+	owner := NewHTTPPool("batch-owner-node")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		// 请求方的 Group 名称为 batch-local-<n>，都改写为 batch-owner
+		_, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, defaultBasePath), "/")
+		r.URL.Path = defaultBasePath + "batch-owner/" + rest
+		owner.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	keys := make([]string, 50)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+	}
+
+	for _, tt := range []struct {
+		maxKeys  int
+		requests int64
+	}{
+		{0, 1},  // 默认上限 100，50 个 key 只需要一次请求
+		{20, 3}, // 超过上限时分块
+	} {
+		local := newTestGroup(t, fmt.Sprintf("batch-local-%d", tt.maxKeys), 2<<10, GetterFunc(
+			func(key string) ([]byte, error) {
+				return nil, fmt.Errorf("local node should not load %s", key)
+			}))
+		pool := NewHTTPPool("batch-local-node", WithMaxBatchKeys(tt.maxKeys))
+		pool.Set(srv.URL)
+		local.RegisterPeers(fakePicker{peer: pool.httpGetters[srv.URL]})
+
+		requests.Store(0)
+		values, err := local.GetMulti(context.Background(), keys)
+		if n := requests.Load(); n != tt.requests {
+			t.Errorf("max %d: expect %d requests for %d keys, got %d", tt.maxKeys, tt.requests, len(keys), n)
+		}
+		errs, _ := err.(KeyErrors)
+		if len(values) != 49 || len(errs) != 1 || !errors.Is(errs["key7"], ErrNotFound) {
+			t.Fatalf("max %d: expect 49 values and key7 missing, got %d values and %v", tt.maxKeys, len(values), err)
+		}
+		if values["key3"].String() != "owner-key3" {
+			t.Fatalf("max %d: expect key3 from the owner, got %q", tt.maxKeys, values["key3"])
+		}
+	}
+
+	// 超过拥有者上限的批量请求被拒绝，它负责的 key 都带着这个错误
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath, maxBatchKeys: 200}
+	big := make([]string, 150)
+	for i := range big {
+		big[i] = fmt.Sprintf("key%d", i)
+	}
+	if _, err := getter.GetMulti(context.Background(), "batch-owner", big); err == nil || !strings.Contains(err.Error(), "413") {
+		t.Fatalf("expect the owner to reject %d keys with 413, got %v", len(big), err)
+	}
+
+	// 超过 WithMaxBodyBytes 的请求体在解码时被拒绝
+	small := httptest.NewServer(NewHTTPPool("batch-small-node", WithMaxBodyBytes(64)))
+	defer small.Close()
+	getter = &httpGetter{baseURL: small.URL + defaultBasePath, maxBatchKeys: 20}
+	if _, err := getter.GetMulti(context.Background(), "batch-owner", keys[:20]); err == nil || !strings.Contains(err.Error(), "413") {
+		t.Fatalf("expect a request body above the limit rejected with 413, got %v", err)
+	}
+
+	// 一个分块失败时，其余分块的结果照常返回
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if bytes.Contains(body, []byte(`"key45"`)) {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.URL.Path = strings.Replace(r.URL.Path, "/batch-flaky/", "/batch-owner/", 1)
+		owner.ServeHTTP(w, r)
+	}))
+	defer flaky.Close()
+	getter = &httpGetter{baseURL: flaky.URL + defaultBasePath, maxBatchKeys: 20}
+	results, err := getter.GetMulti(context.Background(), "batch-flaky", keys)
+	if err != nil || len(results) != len(keys) {
+		t.Fatalf("expect partial results, got %d results and %v", len(results), err)
+	}
+	if string(results[39].Value) != "owner-key39" || results[40].Err == nil || results[49].Err == nil {
+		t.Fatalf("expect only the last chunk to fail, got %+v %+v %+v", results[39], results[40], results[49])
+	}
+}
+
+func TestHTTPStatsEndpoint(t *testing.T) {
+	registry := NewRegistry()
+	scores := registry.NewGroup("scores", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+		}))
+	// 名为 stats 的 group 仍然可以访问
+	registry.NewGroup("stats", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	pool := NewHTTPPool("stats-self", WithRegistry(registry), WithStatsEndpoint())
+	pool.Set("stats-self", "http://stats-peer")
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+
+	scores.Get("Tom")
+	scores.Get("Tom")
+	scores.Get("unknown")
+	rsp, err := http.Get(srv.URL + defaultBasePath + "stats/Jack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+
+	rsp, err = http.Get(srv.URL + defaultBasePath + "-/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK || rsp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("expect JSON stats, got %d %s", rsp.StatusCode, rsp.Header.Get("Content-Type"))
+	}
+	var got struct {
+		Self     string                      `json:"self"`
+		Requests int64                       `json:"requests"`
+		Peers    map[string]peerVars         `json:"peers"`
+		Groups   map[string]map[string]int64 `json:"groups"`
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode stats: %v", err)
+	}
+	if got.Self != "stats-self" || got.Requests != 2 {
+		t.Fatalf("expect self and 2 requests, got %q %d", got.Self, got.Requests)
+	}
+	if _, ok := got.Peers["http://stats-peer"]; !ok || len(got.Peers) != 2 {
+		t.Fatalf("expect both peers listed, got %v", got.Peers)
+	}
+	s, c := scores.Stats(), scores.CacheStats()
+	want := map[string]int64{"gets": s.Gets, "hits": 1, "loads": 2, "errors": 1, "cache_entries": int64(c.Main.Entries), "cache_bytes": c.Main.Bytes}
+	for k, v := range want {
+		if got.Groups["scores"][k] != v {
+			t.Errorf("scores %s = %d, want %d", k, got.Groups["scores"][k], v)
+		}
+	}
+	if got.Groups["stats"]["server_requests"] != 1 {
+		t.Errorf("expect the stats group to have served 1 request, got %v", got.Groups["stats"])
+	}
+
+	// 未启用时这个路径与其他请求一样交给 group
+	plain := httptest.NewServer(NewHTTPPool("stats-plain", WithRegistry(registry)))
+	defer plain.Close()
+	rsp, err = http.Get(plain.URL + defaultBasePath + "-/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expect 404 without WithStatsEndpoint, got %d", rsp.StatusCode)
+	}
+}
+
+func TestHTTPHealthCheck(t *testing.T) {
+	// 两个远程节点都只提供健康检查接口，down 为 true 时模拟节点宕机
+	var down atomic.Bool
+	newPeer := func(crashable bool) *httptest.Server {
+		pool := NewHTTPPool("health-peer", WithRegistry(NewRegistry()))
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if crashable && down.Load() {
+				http.Error(w, "down", http.StatusServiceUnavailable)
+				return
+			}
+			pool.ServeHTTP(w, r)
+		}))
+	}
+	flaky, stable := newPeer(true), newPeer(false)
+	defer flaky.Close()
+	defer stable.Close()
+
+	pool := NewHTTPPool("health-self", WithHealthCheck(5*time.Millisecond, 2, 2))
+	defer pool.Close()
+	pool.Set("health-self", flaky.URL, stable.URL)
+
+	owner := func(key string) string {
+		peer, ok := pool.PickPeer(key)
+		if !ok {
+			return "health-self"
+		}
+		return strings.TrimSuffix(peer.(*httpGetter).baseURL, defaultBasePath)
+	}
+	// 找一个由 flaky 负责、环上的下一个节点是 stable 的 key
+	var key string
+	for i := 0; key == ""; i++ {
+		k := strconv.Itoa(i)
+		if peers := pool.PickPeers(k, 2); len(peers) == 2 && owner(k) == flaky.URL &&
+			peers[1].(*httpGetter).baseURL == stable.URL+defaultBasePath {
+			key = k
+		}
+	}
+	waitFor := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for owner(key) != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("expect %s to move to %s, still on %s", key, want, owner(key))
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	down.Store(true)
+	waitFor(stable.URL)
+	if s := pool.Stats().Peers[flaky.URL]; s.Healthy {
+		t.Fatalf("expect the crashed peer to be unhealthy, got %+v", s)
+	}
+	if s := pool.Stats().Peers[stable.URL]; !s.Healthy {
+		t.Fatalf("expect the stable peer to stay healthy, got %+v", s)
+	}
+
+	// Set 保留仍在列表中的节点的健康状态
+	pool.Set("health-self", flaky.URL, stable.URL)
+	if got := owner(key); got != stable.URL {
+		t.Fatalf("expect Set to keep the crashed peer off the ring, got %s", got)
+	}
+
+	down.Store(false)
+	waitFor(flaky.URL)
+	if s := pool.Stats().Peers[flaky.URL]; !s.Healthy {
+		t.Fatalf("expect the recovered peer to be healthy, got %+v", s)
+	}
+
+	// 健康检查接口不计入请求数，只接受 GET 和 HEAD
+	before := pool.Stats().Requests
+	rec := httptest.NewRecorder()
+	pool.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, defaultBasePath+"-/healthz", nil))
+	if rec.Code != http.StatusOK || pool.Stats().Requests != before {
+		t.Fatalf("expect an uncounted 200 from healthz, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	pool.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, defaultBasePath+"-/healthz", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expect 405 for POST healthz, got %d", rec.Code)
+	}
+}
+
+func TestHTTPPoolSecret(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewGroup("secret", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	owner, err := NewHTTPPoolOpts("secret-owner", &HTTPPoolOptions{Secret: []byte("s3cret"), SkipHealthzAuth: true},
+		WithRegistry(registry), WithStatsEndpoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(owner)
+	defer srv.Close()
+	getter := func(secret string) *httpGetter {
+		pool, err := NewHTTPPoolOpts("secret-client", &HTTPPoolOptions{Secret: []byte(secret)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pool.Set(srv.URL)
+		return pool.httpGetters[srv.URL]
+	}
+
+	// 正确的密钥可以使用所有接口，包括带请求体的 PUT 和批量获取
+	valid := getter("s3cret")
+	if v, err := valid.Get(context.Background(), "secret", "Tom"); err != nil || string(v) != "Tom" {
+		t.Fatalf("get with the right secret: %q %v", v, err)
+	}
+	if err := valid.Set(context.Background(), "secret", "Jack", []byte("589"), 0); err != nil {
+		t.Fatalf("put with the right secret: %v", err)
+	}
+	if rs, err := valid.GetMulti(t.Context(), "secret", []string{"Jack", "Sam"}); err != nil ||
+		string(rs[0].Value) != "589" || string(rs[1].Value) != "Sam" {
+		t.Fatalf("getmulti with the right secret: %+v %v", rs, err)
+	}
+	if found, err := valid.Touch(context.Background(), "secret", "Jack"); err != nil || !found {
+		t.Fatalf("touch with the right secret: %v %v", found, err)
+	}
+	if err := valid.Remove(context.Background(), "secret", "Jack"); err != nil {
+		t.Fatalf("delete with the right secret: %v", err)
+	}
+	stats, _ := http.NewRequest(http.MethodGet, valid.baseURL+statsPath, nil)
+	if rsp, err := valid.do(stats); err != nil || rsp.StatusCode != http.StatusOK {
+		t.Fatalf("stats with the right secret: %v %v", rsp, err)
+	} else {
+		rsp.Body.Close()
+	}
+
+	// 错误的密钥和没有签名的请求都以 401 拒绝，不会访问 group
+	wrong := getter("guess")
+	gets := registry.GetGroup("secret").Stats().ServerRequests
+	if _, err := wrong.Get(context.Background(), "secret", "Tom"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("get with a wrong secret: %v", err)
+	}
+	if err := wrong.Set(context.Background(), "secret", "Tom", []byte("poisoned"), 0); err == nil {
+		t.Fatal("put with a wrong secret succeeded")
+	}
+	if err := wrong.Remove(context.Background(), "secret", "Tom"); err == nil {
+		t.Fatal("delete with a wrong secret succeeded")
+	}
+	if _, err := wrong.Touch(context.Background(), "secret", "Tom"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("touch with a wrong secret: %v", err)
+	}
+	for _, c := range []struct {
+		method, path string
+	}{
+		{http.MethodGet, "secret/Tom"},
+		{http.MethodPut, "secret/Tom"},
+		{http.MethodDelete, "secret/Tom"},
+		{http.MethodPost, "secret/Tom?op=touch"},
+		{http.MethodGet, statsPath},
+	} {
+		req, _ := http.NewRequest(c.method, srv.URL+defaultBasePath+c.path, strings.NewReader("poisoned"))
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s %s without credentials: got %d, want 401", c.method, c.path, rsp.StatusCode)
+		}
+	}
+	// 签名覆盖存活时间的头部，签名时间超出允许的时钟偏差的请求被当作重放拒绝
+	tampered, _ := http.NewRequest(http.MethodPut, srv.URL+defaultBasePath+"secret/Tom", strings.NewReader("630"))
+	tampered.Header.Set(ttlMsHeader, "1000")
+	sign(tampered, []byte("s3cret"))
+	tampered.Header.Set(ttlMsHeader, "999999999")
+	clock := time.Now().Add(-2 * maxClockSkew)
+	restore := setNow(&clock)
+	replayed, _ := http.NewRequest(http.MethodDelete, srv.URL+defaultBasePath+"secret/Tom", nil)
+	sign(replayed, []byte("s3cret"))
+	restore()
+	for name, req := range map[string]*http.Request{"tampered ttl": tampered, "stale timestamp": replayed} {
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: got %d, want 401", name, rsp.StatusCode)
+		}
+	}
+	if n := registry.GetGroup("secret").Stats().ServerRequests; n != gets {
+		t.Fatalf("expect rejected requests not to reach the group, got %d more", n-gets)
+	}
+	if v, err := valid.Get(context.Background(), "secret", "Tom"); err != nil || string(v) != "Tom" {
+		t.Fatalf("expect Tom not to be poisoned, got %q %v", v, err)
+	}
+
+	// SkipHealthzAuth 让不知道密钥的组件也能探测节点
+	rsp, err := http.Get(srv.URL + defaultBasePath + healthzPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("expect healthz without credentials to succeed, got %d", rsp.StatusCode)
+	}
+}
+
+func TestHTTPPoolSetNormalizesPeers(t *testing.T) {
+	pool := NewHTTPPool("HTTP://Node-A:8000/")
+	if err := pool.Set("http://node-a:8000", "HTTPS://Cache-2:8443/", "https://cache-2:8443", "http://cache-3"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"http://node-a:8000", "https://cache-2:8443", "http://cache-3"}
+	if !reflect.DeepEqual(pool.members, want) || pool.self != want[0] {
+		t.Fatalf("expect normalized peers %v and self %s, got %v and %s", want, want[0], pool.members, pool.self)
+	}
+	if g := pool.httpGetters["https://cache-2:8443"]; g == nil || g.baseURL != "https://cache-2:8443"+defaultBasePath {
+		t.Fatalf("expect an https getter, got %+v", g)
+	}
+
+	for _, addr := range []string{
+		"cache-2:8443",
+		"ftp://cache-2",
+		"http://",
+		"http://cache-2/path",
+		"http://user@cache-2",
+		"http://cache-2?x=1",
+		"http://cache-2#frag",
+	} {
+		if err := pool.Set("http://node-a:8000", addr); err == nil {
+			t.Errorf("expect %q to be rejected", addr)
+		}
+	}
+	if !reflect.DeepEqual(pool.members, want) {
+		t.Fatalf("expect a rejected Set to leave the peers unchanged, got %v", pool.members)
+	}
+}
+
+func TestHTTPPoolAddRemovePeers(t *testing.T) {
+	self := "http://node-a"
+	pool := NewHTTPPool(self)
+	if err := pool.Set(self, "http://node-b", "http://node-c"); err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]string, 2000)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+	owners := func(p *HTTPPool) map[string]string {
+		m := make(map[string]string, len(keys))
+		for _, key := range keys {
+			if peer, ok := p.PickPeer(key); ok {
+				m[key] = peer.(*httpGetter).baseURL
+			} else {
+				m[key] = "self"
+			}
+		}
+		return m
+	}
+	before := owners(pool)
+	getterB := pool.httpGetters["http://node-b"]
+
+	if err := pool.AddPeers("HTTP://Node-D/", "http://node-b", "http://node-d"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{self, "http://node-b", "http://node-c", "http://node-d"}; !reflect.DeepEqual(pool.members, want) {
+		t.Fatalf("expect members %v, got %v", want, pool.members)
+	}
+	if pool.httpGetters["http://node-b"] != getterB {
+		t.Fatalf("expect the existing getter to be reused")
+	}
+	added := owners(pool)
+	moved := 0
+	for _, key := range keys {
+		if added[key] != before[key] {
+			moved++
+			if added[key] != "http://node-d"+defaultBasePath {
+				t.Fatalf("key %s moved from %s to %s, not to the new peer", key, before[key], added[key])
+			}
+		}
+	}
+	if moved == 0 {
+		t.Fatalf("expect the new peer to own some keys")
+	}
+	// 增量更新的环与用同样的节点重新 Set 的环完全相同
+	fresh := NewHTTPPool(self)
+	fresh.Set(self, "http://node-b", "http://node-c", "http://node-d")
+	if !reflect.DeepEqual(added, owners(fresh)) {
+		t.Fatalf("expect AddPeers to build the same ring as Set")
+	}
+
+	if err := pool.RemovePeers("http://node-d"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(owners(pool), before) {
+		t.Fatalf("expect removing the new peer to restore the old owners")
+	}
+	if err := pool.RemovePeers("http://node-b", "http://no-such-node"); err != nil {
+		t.Fatal(err)
+	}
+	for key, owner := range owners(pool) {
+		if owner != before[key] && before[key] != "http://node-b"+defaultBasePath {
+			t.Fatalf("key %s moved from %s to %s although its owner stayed", key, before[key], owner)
+		}
+	}
+	if _, ok := pool.httpGetters["http://node-b"]; ok || !reflect.DeepEqual(pool.members, []string{self, "http://node-c"}) {
+		t.Fatalf("expect node-b gone, got members %v", pool.members)
+	}
+
+	for _, peers := range [][]string{{self}, {"HTTP://Node-A/"}, {"http://node-c", "not a url"}} {
+		if err := pool.RemovePeers(peers...); err == nil {
+			t.Errorf("expect RemovePeers(%q) to be rejected", peers)
+		}
+	}
+	if err := pool.AddPeers("ftp://node-e"); err == nil {
+		t.Errorf("expect an invalid address to be rejected")
+	}
+	if !reflect.DeepEqual(pool.members, []string{self, "http://node-c"}) {
+		t.Fatalf("expect rejected calls to leave the pool unchanged, got %v", pool.members)
+	}
+
+	// AddPeers 不需要先调用 Set
+	empty := NewHTTPPool(self)
+	if err := empty.AddPeers(self, "http://node-c"); err != nil {
+		t.Fatal(err)
+	}
+	picked := false
+	for _, key := range keys[:100] {
+		if _, ok := empty.PickPeer(key); ok {
+			picked = true
+		}
+	}
+	if !picked {
+		t.Fatalf("expect node-c to own some keys")
+	}
+}
+
+func TestHTTPPoolAddRemovePeersConcurrent(t *testing.T) {
+	pool := NewHTTPPool("http://node-a")
+	pool.Set("http://node-a", "http://node-b")
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; ; j++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				key := strconv.Itoa(j)
+				if peer, ok := pool.PickPeer(key); ok && peer.(*httpGetter) == nil {
+					t.Errorf("picked a removed peer for %s", key)
+					return
+				}
+				pool.PickPeers(key, 3)
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		peer := "http://node-" + strconv.Itoa(i%5+3)
+		pool.AddPeers(peer)
+		pool.RemovePeers(peer)
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestHTTPPoolTLS(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewGroup("tls", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	owner := NewHTTPPool("tls-owner", WithRegistry(registry))
+	secure := httptest.NewTLSServer(owner)
+	defer secure.Close()
+	plain := httptest.NewServer(owner)
+	defer plain.Close()
+
+	// 只信任测试服务器的证书，同一个 HTTPPool 中 http 和 https 的节点可以混用
+	roots := x509.NewCertPool()
+	roots.AddCert(secure.Certificate())
+	pool := NewHTTPPool("tls-self", WithTLSConfig(&tls.Config{RootCAs: roots}))
+	if err := pool.Set("tls-self", secure.URL, plain.URL); err != nil {
+		t.Fatal(err)
+	}
+	for _, url := range []string{secure.URL, plain.URL} {
+		if v, err := pool.httpGetters[url].Get(context.Background(), "tls", "Tom"); err != nil || string(v) != "Tom" {
+			t.Fatalf("get from %s: %q %v", url, v, err)
+		}
+	}
+
+	// 不信任这个 CA 的客户端无法完成握手
+	untrusted := NewHTTPPool("tls-self")
+	untrusted.Set(secure.URL)
+	if _, err := untrusted.httpGetters[secure.URL].Get(context.Background(), "tls", "Tom"); err == nil {
+		t.Fatal("expect the default client to reject the test certificate")
+	}
+
+	if _, err := NewHTTPPoolOpts("tls-self", nil, WithTransport(roundTripFunc(nil)), WithTLSConfig(&tls.Config{})); err == nil {
+		t.Fatal("expect WithTLSConfig to need an *http.Transport")
+	}
+}
+
+// testCA 签发测试用的证书，并把证书和私钥写成 PEM 文件。
+type testCA struct {
+	t    *testing.T
+	dir  string
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string // CA 证书的 PEM 文件
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	ca := &testCA{t: t, dir: t.TempDir()}
+	ca.cert, ca.key, ca.file, _ = ca.issue(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}, nil, nil)
+	return ca
+}
+
+// leaf 签发一张名为 name 的证书，返回证书和私钥的 PEM 文件路径。
+func (ca *testCA) leaf(name string) (certFile, keyFile string) {
+	_, _, certFile, keyFile = ca.issue(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		DNSNames:    []string{name},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}, ca.cert, ca.key)
+	return certFile, keyFile
+}
+
+// issue 用 parent 和 parentKey 签发 template，两者为 nil 时自签名。
+func (ca *testCA) issue(template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	ca.t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	name := template.Subject.CommonName
+	certFile, keyFile := filepath.Join(ca.dir, name+".crt"), filepath.Join(ca.dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		ca.t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		ca.t.Fatal(err)
+	}
+	return cert, key, certFile, keyFile
+}
+
+func TestHTTPPoolMutualTLS(t *testing.T) {
+	ca := newTestCA(t, "cluster-ca")
+	load := func(ca *testCA, name string, allowed ...string) (server, client *tls.Config) {
+		t.Helper()
+		cert, key := ca.leaf(name)
+		server, client, err := LoadMutualTLS(MutualTLSFiles{CAFile: ca.file, CertFile: cert, KeyFile: key, AllowedNames: allowed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return server, client
+	}
+
+	registry := NewRegistry()
+	var loads atomic.Int64
+	registry.NewGroup("mtls", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads.Add(1)
+			return []byte(key), nil
+		}))
+	serverCfg, _ := load(ca, "cache-1.internal", "cache-*.internal")
+	owner := NewHTTPPool("mtls-owner", WithRegistry(registry), WithServerTLSConfig(serverCfg))
+	srv := httptest.NewUnstartedServer(owner)
+	srv.TLS = serverCfg
+	srv.StartTLS()
+	defer srv.Close()
+
+	get := func(client *tls.Config) error {
+		pool := NewHTTPPool("mtls-client", WithTLSConfig(client))
+		if err := pool.Set(srv.URL); err != nil {
+			t.Fatal(err)
+		}
+		v, err := pool.httpGetters[srv.URL].Get(context.Background(), "mtls", "Tom")
+		if err == nil && string(v) != "Tom" {
+			t.Fatalf("expect Tom, got %q", v)
+		}
+		return err
+	}
+
+	_, member := load(ca, "cache-2.internal")
+	if err := get(member); err != nil {
+		t.Fatalf("expect a cluster member to be served, got %v", err)
+	}
+
+	// CA 签发但名称不匹配的证书、其他 CA 签发的证书和不出示证书的客户端都在握手时被拒绝
+	_, intruder := load(ca, "intruder.external")
+	_, foreign := load(newTestCA(t, "other-ca"), "cache-3.internal")
+	foreign.RootCAs = member.RootCAs
+	anonymous := &tls.Config{RootCAs: member.RootCAs}
+	for name, client := range map[string]*tls.Config{"intruder": intruder, "foreign": foreign, "anonymous": anonymous} {
+		if err := get(client); err == nil {
+			t.Errorf("expect the %s client to be rejected", name)
+		}
+	}
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("expect only the member's request to reach the group, got %d loads", n)
+	}
+
+	// 被挂到普通的 HTTP 服务器上时，没有客户端证书的请求同样被拒绝
+	rec := httptest.NewRecorder()
+	owner.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, defaultBasePath+"mtls/Tom", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expect 403 without TLS, got %d", rec.Code)
+	}
+
+	if _, _, err := LoadMutualTLS(MutualTLSFiles{CAFile: ca.file, AllowedNames: []string{"cache-["}}); err == nil {
+		t.Fatal("expect an invalid name pattern to be rejected")
+	}
+}
+
+func TestHTTPCompression(t *testing.T) {
+	random := make([]byte, 64<<10)
+	rand.Read(random)
+	values := map[string][]byte{
+		"small":  bytes.Repeat([]byte("a"), defaultCompressThreshold-1),
+		"edge":   bytes.Repeat([]byte("a"), defaultCompressThreshold),
+		"big":    bytes.Repeat([]byte(`{"name":"Tom","score":630},`), 10000),
+		"random": random,
+	}
+	registry := NewRegistry()
+	registry.NewGroup("gzip", 2<<20, GetterFunc(
+		func(key string) ([]byte, error) {
+			return values[key], nil
+		}))
+	owner := NewHTTPPool("gzip-owner", WithRegistry(registry))
+	var accepted sync.Map
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accepted.Store(r.Header.Get("Accept-Encoding"), true)
+		owner.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	// 只有不小于阈值并且压缩之后变小的值才被压缩，Content-Length 是实际发送的字节数
+	for key, gzipped := range map[string]bool{"small": false, "edge": true, "big": true, "random": false} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+defaultBasePath+"gzip/"+key, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		if got := rsp.Header.Get("Content-Encoding") == "gzip"; got != gzipped {
+			t.Errorf("%s: gzipped = %v, want %v", key, got, gzipped)
+		}
+		if rsp.ContentLength != int64(len(body)) || (gzipped && len(body) >= len(values[key])) {
+			t.Errorf("%s: Content-Length %d for %d bytes sent, value is %d bytes", key, rsp.ContentLength, len(body), len(values[key]))
+		}
+	}
+
+	keys := []string{"small", "edge", "big", "random"}
+	for _, disabled := range []bool{false, true} {
+		pool, err := NewHTTPPoolOpts("gzip-client", &HTTPPoolOptions{DisableCompression: disabled})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pool.Set(srv.URL)
+		getter := pool.httpGetters[srv.URL]
+		for _, key := range keys {
+			if v, err := getter.Get(context.Background(), "gzip", key); err != nil || !bytes.Equal(v, values[key]) {
+				t.Fatalf("get %s (compression disabled: %v): %d bytes, %v", key, disabled, len(v), err)
+			}
+		}
+		rs, err := getter.GetMulti(t.Context(), "gzip", keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, key := range keys {
+			if !bytes.Equal(rs[i].Value, values[key]) {
+				t.Fatalf("getmulti %s (compression disabled: %v): %d bytes", key, disabled, len(rs[i].Value))
+			}
+		}
+	}
+	if _, ok := accepted.Load("identity"); !ok {
+		t.Fatal("expect a client with compression disabled not to accept gzip")
+	}
+
+	// 关闭压缩的节点不压缩任何响应
+	plain, err := NewHTTPPoolOpts("gzip-plain", &HTTPPoolOptions{DisableCompression: true}, WithRegistry(registry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, defaultBasePath+"gzip/big", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	plain.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != "" || !bytes.Equal(rec.Body.Bytes(), values["big"]) {
+		t.Fatalf("expect an uncompressed response, got %q encoding", rec.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestRevalidateHotCopy(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer setNow(&clock)()
+
+	ownerRegistry := NewRegistry()
+	owner := ownerRegistry.NewGroup("etag", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}), WithTTL(time.Minute))
+	ownerPool := NewHTTPPool("etag-owner", WithRegistry(ownerRegistry))
+	var mu sync.Mutex
+	var codes []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		ownerPool.ServeHTTP(rec, r)
+		mu.Lock()
+		codes = append(codes, rec.Code)
+		mu.Unlock()
+		maps.Copy(w.Header(), rec.Header())
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	}))
+	defer srv.Close()
+	lastCode := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return codes[len(codes)-1]
+	}
+
+	local := NewRegistry().NewGroup("etag", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s should come from the owner", key)
+		}), WithHotCacheRate(1), WithTTL(time.Minute))
+	pool := NewHTTPPool("etag-self")
+	pool.Set(srv.URL)
+	local.RegisterPeers(pool)
+
+	if v, err := local.Get("Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("get: %q %v", v, err)
+	}
+
+	// 值没有改变：拥有者返回 304，副本的过期时间按拥有者报告的剩余时间重新计算
+	clock = clock.Add(30 * time.Second)
+	v, err := local.Revalidate(t.Context(), "Tom")
+	if err != nil || v.String() != "630" || lastCode() != http.StatusNotModified {
+		t.Fatalf("expect an unchanged value revalidated with 304, got %q %v %d", v, err, lastCode())
+	}
+	if hot, ok := local.hotcache.peek("Tom"); !ok || !hot.Expire().Equal(clock.Add(30*time.Second)) {
+		t.Fatalf("expect the hot copy to follow the owner's deadline, got %v %v", hot.Expire(), ok)
+	}
+	if s := local.Stats(); s.Revalidations != 1 || s.NotModified != 1 {
+		t.Fatalf("expect 1 revalidation without transfer, got %+v", s)
+	}
+
+	// 值已经改变：拥有者返回新值，副本被替换
+	if err := owner.Set("Tom", []byte("700"), 0); err != nil {
+		t.Fatal(err)
+	}
+	v, err = local.Revalidate(t.Context(), "Tom")
+	if err != nil || v.String() != "700" || lastCode() != http.StatusOK {
+		t.Fatalf("expect the changed value with 200, got %q %v %d", v, err, lastCode())
+	}
+	if hot, ok := local.hotcache.peek("Tom"); !ok || hot.String() != "700" {
+		t.Fatalf("expect the hot copy to be replaced, got %q %v", hot, ok)
+	}
+	if s := local.Stats(); s.Revalidations != 2 || s.NotModified != 1 {
+		t.Fatalf("expect the second revalidation to transfer the value, got %+v", s)
+	}
+
+	// 没有热点副本时与 Get 相同
+	if v, err := local.Revalidate(t.Context(), "Jack"); err != nil || v.String() != "589" {
+		t.Fatalf("revalidate without a copy: %q %v", v, err)
+	}
+	if s := local.Stats(); s.Revalidations != 2 {
+		t.Fatalf("expect no conditional request without a copy, got %d", s.Revalidations)
+	}
+
+	// 只有与值相同的强 ETag 或 "*" 才返回 304
+	etag := valueETag([]byte("700"))
+	for inm, want := range map[string]int{
+		etag:                     http.StatusNotModified,
+		`"other", ` + etag:       http.StatusNotModified,
+		"*":                      http.StatusNotModified,
+		valueETag([]byte("630")): http.StatusOK,
+		"W/" + etag:              http.StatusOK,
+	} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+defaultBasePath+"etag/Tom", nil)
+		req.Header.Set("If-None-Match", inm)
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		if rsp.StatusCode != want || rsp.Header.Get("ETag") != etag {
+			t.Errorf("If-None-Match %s: got %d with ETag %s, want %d with %s", inm, rsp.StatusCode, rsp.Header.Get("ETag"), want, etag)
+		}
+		if want == http.StatusNotModified && len(body) != 0 {
+			t.Errorf("If-None-Match %s: expect no body with 304, got %q", inm, body)
+		}
+	}
+	rsp, err := http.Get(srv.URL + defaultBasePath + "etag/Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK || rsp.Header.Get("ETag") != "" {
+		t.Fatalf("expect no ETag without If-None-Match, got %d %q", rsp.StatusCode, rsp.Header.Get("ETag"))
+	}
+}
+
+// newStreamOwner 启动一个在独立 Registry 中提供 group 的拥有者节点，它的 "big" 是 size 字节的值。
+func newStreamOwner(t testing.TB, group string, size int) (*httptest.Server, []byte) {
+	big := bytes.Repeat([]byte("0123456789abcdef"), size/16)
+	r := NewRegistry()
+	r.NewGroup(group, 64<<20, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "big" {
+				return big, nil
+			}
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}))
+	t.Cleanup(func() { r.DestroyGroup(group) })
+	srv := httptest.NewServer(NewHTTPPool("owner", WithRegistry(r)))
+	t.Cleanup(srv.Close)
+	return srv, big
+}
+
+func TestGetIntoStream(t *testing.T) {
+	srv, big := newStreamOwner(t, "stream", 2<<20)
+	gee := newTestGroup(t, "stream", 64<<20, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("should not load %s locally", key)
+		}), WithHotCacheRate(0))
+	gee.RegisterPeers(fakePicker{peer: &httpGetter{baseURL: srv.URL + defaultBasePath}})
+
+	var b []byte
+	if err := gee.GetInto(context.Background(), "big", AllocatingByteSliceSink(&b)); err != nil || !bytes.Equal(b, big) {
+		t.Fatalf("stream into slice: %d bytes, %v", len(b), err)
+	}
+	if cap(b) != len(big) {
+		t.Fatalf("expect the slice allocated from Content-Length, got cap %d", cap(b))
+	}
+	var buf bytes.Buffer
+	if err := gee.GetInto(context.Background(), "big", WriterSink(&buf)); err != nil || !bytes.Equal(buf.Bytes(), big) {
+		t.Fatalf("stream into writer: %d bytes, %v", buf.Len(), err)
+	}
+	if _, ok := gee.GetCached("big"); ok {
+		t.Fatalf("expect a streamed value not to be cached")
+	}
+	if s := gee.Stats(); s.Gets != 2 || s.Loads != 2 || s.LoadsDeduped != 0 || s.PeerLoads != 2 || s.PeerErrors != 0 {
+		t.Fatalf("unexpected stats after streaming: %+v", s)
+	}
+	if err := gee.GetInto(context.Background(), "missing", AllocatingByteSliceSink(&b)); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound, got %v", err)
+	}
+}
+
+func TestGetIntoStreamHotCache(t *testing.T) {
+	srv, big := newStreamOwner(t, "stream-hot", 2<<20)
+	gee := newTestGroup(t, "stream-hot", 64<<20, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("should not load %s locally", key)
+		}), WithHotCacheRate(1))
+	gee.RegisterPeers(fakePicker{peer: &httpGetter{baseURL: srv.URL + defaultBasePath}})
+
+	// 按 hotRate 抽中的值按普通的方式获取并放入 hotcache，之后的 GetInto 直接使用它
+	var buf bytes.Buffer
+	if err := gee.GetInto(context.Background(), "big", WriterSink(&buf)); err != nil || !bytes.Equal(buf.Bytes(), big) {
+		t.Fatalf("get into writer: %d bytes, %v", buf.Len(), err)
+	}
+	if _, ok := gee.hotcache.peek("big"); !ok {
+		t.Fatalf("expect the value to be put in the hot cache")
+	}
+	var b []byte
+	if err := gee.GetInto(context.Background(), "big", AllocatingByteSliceSink(&b)); err != nil || !bytes.Equal(b, big) {
+		t.Fatalf("get cached into slice: %d bytes, %v", len(b), err)
+	}
+	if s := gee.Stats(); s.HotCacheHits != 1 || s.PeerLoads != 1 || s.LoadsDeduped != 1 {
+		t.Fatalf("expect the second GetInto to hit the hot cache, got %+v", s)
+	}
+}
+
+func TestGetIntoStreamConcurrent(t *testing.T) {
+	const group = "stream-concurrent"
+	release := make(chan struct{})
+	r := NewRegistry()
+	r.NewGroup(group, 1<<20, GetterFunc(
+		func(key string) ([]byte, error) {
+			<-release
+			return []byte("v:" + key), nil
+		}))
+	t.Cleanup(func() { r.DestroyGroup(group) })
+	owner := NewHTTPPool("owner", WithRegistry(r))
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		owner.ServeHTTP(w, req)
+	}))
+	defer srv.Close()
+	gee := newTestGroup(t, group, 1<<20, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("should not load %s locally", key)
+		}), WithHotCacheRate(0))
+	gee.RegisterPeers(fakePicker{peer: &httpGetter{baseURL: srv.URL + defaultBasePath}})
+
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var buf bytes.Buffer
+			if err := gee.GetInto(context.Background(), "Tom", WriterSink(&buf)); err != nil || buf.String() != "v:Tom" {
+				errs <- fmt.Errorf("got %q %v", buf.String(), err)
+			}
+		}()
+	}
+	// 流在收到响应头之后才计入 Loads，其余的调用者在加载之前计入，并合并为一次普通的请求
+	for {
+		loads := gee.Stats().Loads
+		if loads == n || loads == n-1 && requests.Load() == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if got := requests.Load(); got > 2 {
+		t.Fatalf("expect at most one stream and one shared load, got %d requests", got)
+	}
+	if s := gee.Stats(); s.Loads != n || s.LoadsDeduped != 1 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+}
+
+func TestGetIntoStreamMaxValueBytes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path.Base(r.URL.Path) {
+		case "huge":
+			// 声明一个无法分配的长度
+			w.Header().Set("Content-Length", strconv.FormatInt(1<<50, 10))
+		case "chunked":
+			// 不声明长度
+			w.(http.Flusher).Flush()
+		case "small":
+			w.Write([]byte("Tom"))
+			return
+		}
+		w.Write(bytes.Repeat([]byte("x"), 100))
+	}))
+	defer srv.Close()
+	gee := newTestGroup(t, "stream-max-value", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("should not load %s locally", key)
+		}), WithMaxValueBytes(64), WithHotCacheRate(0), WithLogger(NopLogger{}))
+	gee.RegisterPeers(fakePicker{peer: &httpGetter{baseURL: srv.URL + defaultBasePath}})
+
+	var b []byte
+	if err := gee.GetInto(context.Background(), "huge", AllocatingByteSliceSink(&b)); !errors.Is(err, ErrValueTooLarge) || b != nil {
+		t.Fatalf("expect ErrValueTooLarge before allocating, got %d bytes, %v", len(b), err)
+	}
+	var buf bytes.Buffer
+	if err := gee.GetInto(context.Background(), "chunked", WriterSink(&buf)); !errors.Is(err, ErrValueTooLarge) || buf.Len() > 64 {
+		t.Fatalf("expect ErrValueTooLarge after at most 64 bytes, got %d bytes, %v", buf.Len(), err)
+	}
+	if err := gee.GetInto(context.Background(), "small", AllocatingByteSliceSink(&b)); err != nil || string(b) != "Tom" {
+		t.Fatalf("expect a small value to be streamed, got %q %v", b, err)
+	}
+	if s := gee.Stats(); s.PeerErrors != 0 || s.LocalLoads != 0 {
+		t.Fatalf("expect oversized values not to count as peer errors, got %+v", s)
+	}
+}
+
+func TestGetIntoTruncatedStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 声明 100 字节，只发送一半就断开
+		w.Header().Set("Content-Length", "100")
+		w.Write(bytes.Repeat([]byte("x"), 50))
+	}))
+	defer srv.Close()
+	gee := newTestGroup(t, "stream-truncated", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithHotCacheRate(0), WithLogger(NopLogger{}))
+	gee.RegisterPeers(fakePicker{peer: &httpGetter{baseURL: srv.URL + defaultBasePath}})
+
+	var b []byte
+	if err := gee.GetInto(context.Background(), "Tom", AllocatingByteSliceSink(&b)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expect io.ErrUnexpectedEOF, got %v", err)
+	}
+	if b != nil {
+		t.Fatalf("expect the slice untouched, got %d bytes", len(b))
+	}
+	var buf bytes.Buffer
+	if err := gee.GetInto(context.Background(), "Tom", WriterSink(&buf)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expect io.ErrUnexpectedEOF, got %v", err)
+	}
+	if buf.Len() > 50 {
+		t.Fatalf("expect at most the bytes sent, got %d", buf.Len())
+	}
+	if s := gee.Stats(); s.PeerErrors != 2 || s.LocalLoads != 0 {
+		t.Fatalf("expect truncated streams to fail without a local fallback, got %+v", s)
+	}
+	if _, ok := gee.GetCached("Tom"); ok {
+		t.Fatalf("expect nothing cached from a truncated stream")
+	}
+}
+
+// BenchmarkGetIntoLargeValue 对比以 GetContext 获取 10 MB 的远程值再复制一份，与以 GetInto 从响应体直接读取的内存分配，
+// 可使用 go test -bench GetIntoLargeValue -benchmem 观察。
+func BenchmarkGetIntoLargeValue(b *testing.B) {
+	srv, big := newStreamOwner(b, "stream-bench", 10<<20)
+	gee := newTestGroup(b, "stream-bench", 64<<20, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("should not load %s locally", key)
+		}), WithHotCacheRate(0), WithLogger(NopLogger{}))
+	gee.RegisterPeers(fakePicker{peer: &httpGetter{baseURL: srv.URL + defaultBasePath}})
+
+	b.Run("buffered", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(big)))
+		for i := 0; i < b.N; i++ {
+			v, err := gee.GetContext(context.Background(), "big")
+			if err != nil || len(v.ByteSlice()) != len(big) {
+				b.Fatalf("get: %v", err)
+			}
+		}
+	})
+	b.Run("stream", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(big)))
+		for i := 0; i < b.N; i++ {
+			var dst []byte
+			if err := gee.GetInto(context.Background(), "big", AllocatingByteSliceSink(&dst)); err != nil || len(dst) != len(big) {
+				b.Fatalf("get into: %v", err)
+			}
+		}
+	})
+}
+
+func TestHTTPSpecialKeys(t *testing.T) {
+	keys := []string{
+		"user/42", "/leading", "trailing/", "a//b", "/", "//",
+		"100%", "%2F", "%zz", "a%20b", "a b", "a+b", "  ",
+		"?x=1", "#frag", "a;b", "a&b=c", "..", "../etc", "./x",
+		"键/值", "emoji 🚀", "\t\n", "\x00",
+	}
+	groups := []string{"http-special-keys", "http special/group"}
+	var mu sync.Mutex
+	var loaded []string
+	for _, name := range groups {
+		newTestGroup(t, name, 2<<10, GetterFunc(
+			func(key string) ([]byte, error) {
+				mu.Lock()
+				loaded = append(loaded, key)
+				mu.Unlock()
+				return []byte("v:" + key), nil
+			}))
+	}
+	srv := httptest.NewServer(NewHTTPPool("self"))
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+
+	for _, name := range groups {
+		for _, key := range keys {
+			b, err := getter.Get(context.Background(), name, key)
+			if err != nil || string(b) != "v:"+key {
+				t.Errorf("group %q key %q: got %q %v", name, key, b, err)
+			}
+			rs, err := getter.GetMulti(context.Background(), name, []string{key, "plain"})
+			if err != nil || string(rs[0].Value) != "v:"+key || rs[0].Err != nil {
+				t.Errorf("getmulti group %q key %q: got %+v %v", name, key, rs, err)
+			}
+			if err := getter.Remove(context.Background(), name, key); err != nil {
+				t.Errorf("remove group %q key %q: %v", name, key, err)
+			}
+		}
+	}
+	// 每个 key 被拥有者以原样的字符串加载，没有被当作别的 key 缓存
+	mu.Lock()
+	seen := make(map[string]bool)
+	for _, key := range loaded {
+		seen[key] = true
+	}
+	mu.Unlock()
+	for _, key := range keys {
+		if !seen[key] {
+			t.Errorf("key %q was never loaded under its own name, loaded %q", key, loaded)
+		}
+	}
+
+	// 没有转义的 "/" 属于 key，错误的转义被拒绝
+	for path, code := range map[string]int{
+		"http-special-keys/a/b":       http.StatusOK,
+		"http%20special%2Fgroup/a/b":  http.StatusOK,
+		"http-special-keys/a%2Fb%zz":  http.StatusBadRequest,
+		"http-special-keys":           http.StatusBadRequest,
+		"http-special-keys/":          http.StatusBadRequest,
+		"no%2Fsuch%2Fgroup/Tom":       http.StatusNotFound,
+		"http%20special%2Fgroup":      http.StatusBadRequest,
+		"http%20special%2Fgroup%2FTo": http.StatusBadRequest,
+	} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Opaque 使路径原样发送，不被客户端重新转义
+		req.URL.Opaque = defaultBasePath + path
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode != code {
+			t.Errorf("GET %s: got %d, want %d", path, rsp.StatusCode, code)
+		}
+	}
+}
+
+func TestHTTPPoolCircuitBreaker(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer setNow(&clock)()
+
+	var failing atomic.Bool
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failing.Load() {
+			http.Error(w, "sick", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("peer:" + path.Base(r.URL.Path)))
+	}))
+	defer srv.Close()
+
+	registry := NewRegistry()
+	pool, err := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{
+		BreakerFailures: 3,
+		BreakerWindow:   time.Minute,
+		BreakerCooldown: 10 * time.Second,
+	}, WithRegistry(registry), WithStatsEndpoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Set(srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	gee := newTestGroup(t, "breaker", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("local:" + key), nil
+		}), WithHotCacheRate(0), WithPeerRetry(0, 0), WithLogger(NopLogger{}))
+	gee.RegisterPeers(pool)
+
+	n := 0
+	get := func(want string) {
+		t.Helper()
+		n++
+		key := "k" + strconv.Itoa(n)
+		if v, err := gee.Get(key); err != nil || v.String() != want+":"+key {
+			t.Fatalf("get %s: got %q %v, want %s", key, v, err, want)
+		}
+	}
+	expect := func(state BreakerState, reqs int32) {
+		t.Helper()
+		if s := pool.Stats().Peers[srv.URL].Breaker; s != state {
+			t.Fatalf("expect the breaker %v, got %v", state, s)
+		}
+		if got := requests.Load(); got != reqs {
+			t.Fatalf("expect %d requests to reach the peer, got %d", reqs, got)
+		}
+	}
+
+	// closed：失败的请求仍然发出，回退到本地加载
+	get("peer")
+	failing.Store(true)
+	get("local")
+	get("local")
+	expect(BreakerClosed, 3)
+	get("local")
+	expect(BreakerOpen, 4)
+
+	// open：请求不再发出，立即回退
+	get("local")
+	get("local")
+	expect(BreakerOpen, 4)
+	rec := httptest.NewRecorder()
+	pool.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, defaultBasePath+statsPath, nil))
+	var stats struct {
+		Peers map[string]struct {
+			Breaker string `json:"breaker"`
+		} `json:"peers"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil || stats.Peers[srv.URL].Breaker != "open" {
+		t.Fatalf("expect the stats endpoint to report the open breaker, got %s %v", rec.Body, err)
+	}
+
+	// half-open：冷却之后放行一个探测请求，失败时重新打开
+	clock = clock.Add(10 * time.Second)
+	expect(BreakerHalfOpen, 4)
+	get("local")
+	expect(BreakerOpen, 5)
+	get("local")
+	expect(BreakerOpen, 5)
+
+	// 探测成功时关闭，之后的请求照常发出
+	clock = clock.Add(10 * time.Second)
+	failing.Store(false)
+	get("peer")
+	expect(BreakerClosed, 6)
+	get("peer")
+	expect(BreakerClosed, 7)
+
+	// 窗口之外的失败不累计
+	failing.Store(true)
+	get("local")
+	get("local")
+	clock = clock.Add(time.Minute)
+	get("local")
+	expect(BreakerClosed, 10)
+}
+
+func TestHedgedPeerRequests(t *testing.T) {
+	cancelled := make(chan struct{}, 10)
+	peer := func(name string, delay time.Duration) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(delay):
+				w.Write([]byte(name + ":" + path.Base(r.URL.Path)))
+			case <-r.Context().Done():
+				cancelled <- struct{}{}
+			}
+		}))
+	}
+	slow, fast := peer("slow", 300*time.Millisecond), peer("fast", 0)
+	defer slow.Close()
+	defer fast.Close()
+
+	pool := NewHTTPPool("http://self")
+	if err := pool.Set(slow.URL, fast.URL); err != nil {
+		t.Fatal(err)
+	}
+	// 找出第一个拥有者分别是慢节点和快节点的 key
+	var slowFirst, fastFirst string
+	for i := 0; slowFirst == "" || fastFirst == ""; i++ {
+		key := "key-" + strconv.Itoa(i)
+		switch pool.PickPeers(key, 1)[0].(*httpGetter).baseURL {
+		case slow.URL + defaultBasePath:
+			slowFirst = cmp.Or(slowFirst, key)
+		case fast.URL + defaultBasePath:
+			fastFirst = cmp.Or(fastFirst, key)
+		}
+	}
+	gee := newTestGroup(t, "hedge", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("should not load %s locally", key)
+		}), WithHedging(20*time.Millisecond, 1), WithHotCacheRate(0), WithLogger(NopLogger{}))
+	gee.RegisterPeers(pool)
+
+	start := time.Now()
+	if v, err := gee.Get(slowFirst); err != nil || v.String() != "fast:"+slowFirst {
+		t.Fatalf("get %s: %q %v", slowFirst, v, err)
+	}
+	if d := time.Since(start); d > 200*time.Millisecond {
+		t.Fatalf("expect the hedge to answer first, took %v", d)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatalf("expect the slow request to be cancelled")
+	}
+	if s := gee.Stats(); s.Hedges != 1 || s.HedgeWins != 1 || s.SecondaryLoads != 1 || s.PeerErrors != 0 {
+		t.Fatalf("expect one winning hedge, got %+v", s)
+	}
+
+	// 第一个拥有者及时响应时不对冲
+	if v, err := gee.Get(fastFirst); err != nil || v.String() != "fast:"+fastFirst {
+		t.Fatalf("get %s: %q %v", fastFirst, v, err)
+	}
+	if s := gee.Stats(); s.Hedges != 1 {
+		t.Fatalf("expect no hedge for a fast owner, got %+v", s)
+	}
+
+	// 对冲名额用完时只等待第一个拥有者
+	gee.hedging.Add(1)
+	defer gee.hedging.Add(-1)
+	if v, err := gee.Get(slowFirst); err != nil || v.String() != "slow:"+slowFirst {
+		t.Fatalf("get %s without a hedge slot: %q %v", slowFirst, v, err)
+	}
+	if s := gee.Stats(); s.Hedges != 1 || s.HedgeWins != 1 {
+		t.Fatalf("expect the hedge limit to apply, got %+v", s)
+	}
+}
+
+func TestHTTPPoolRateLimit(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer setNow(&clock)()
+	newTestGroup(t, "rate-limit", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	pool := NewHTTPPool("self", WithRateLimit(0.5, 2))
+	get := func(path, addr string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, defaultBasePath+path, nil)
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		pool.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := get("rate-limit/Tom", "10.0.0.1:1234"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d within the burst: got %d", i, rec.Code)
+		}
+	}
+	rec := get("rate-limit/Tom", "10.0.0.2:1234")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "2" {
+		t.Fatalf("expect 429 with Retry-After: 2, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := get(healthzPath, "10.0.0.1:1234"); rec.Code != http.StatusOK {
+		t.Fatalf("expect health checks not to be limited, got %d", rec.Code)
+	}
+	clock = clock.Add(time.Second)
+	if rec := get("rate-limit/Tom", "10.0.0.1:1234"); rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("expect Retry-After: 1 half a token later, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	clock = clock.Add(time.Second)
+	if rec := get("rate-limit/Tom", "10.0.0.1:1234"); rec.Code != http.StatusOK {
+		t.Fatalf("expect a refilled token to be accepted, got %d", rec.Code)
+	}
+	if s := pool.Stats(); s.Requests != 3 || s.Throttled != 2 {
+		t.Fatalf("expect 3 requests served and 2 throttled, got %+v", s)
+	}
+
+	// 运行时换成按地址限制：一个客户端用完额度不影响其他客户端
+	pool.SetRateLimit(0, 0)
+	pool.SetClientRateLimit(1, 1)
+	if rec := get("rate-limit/Tom", "10.0.0.1:1234"); rec.Code != http.StatusOK {
+		t.Fatalf("first request from a client: got %d", rec.Code)
+	}
+	if rec := get("rate-limit/Tom", "10.0.0.1:5678"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expect the same IP on another port to share the limit, got %d", rec.Code)
+	}
+	if rec := get("rate-limit/Tom", "10.0.0.2:1234"); rec.Code != http.StatusOK {
+		t.Fatalf("expect another client to keep its own limit, got %d", rec.Code)
+	}
+	pool.SetClientRateLimit(0, 0)
+	for i := 0; i < 5; i++ {
+		if rec := get("rate-limit/Tom", "10.0.0.1:1234"); rec.Code != http.StatusOK {
+			t.Fatalf("expect no limit after clearing it, got %d", rec.Code)
+		}
+	}
+
+	// 被全局限制拒绝的请求不消耗客户端的额度
+	pool.SetRateLimit(1, 1)
+	pool.SetClientRateLimit(1, 1)
+	if rec := get("rate-limit/Tom", "10.0.0.2:1234"); rec.Code != http.StatusOK {
+		t.Fatalf("first request with both limits: got %d", rec.Code)
+	}
+	if rec := get("rate-limit/Tom", "10.0.0.1:1234"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expect the global limit to reject, got %d", rec.Code)
+	}
+	pool.SetRateLimit(0, 0)
+	if rec := get("rate-limit/Tom", "10.0.0.1:1234"); rec.Code != http.StatusOK {
+		t.Fatalf("expect the client's token to be left after a global rejection, got %d", rec.Code)
+	}
+}
+
+func TestClientLimiterBound(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer setNow(&clock)()
+	c := &clientLimiter{rate: 1, burst: 2, buckets: make(map[string]*tokenBucket)}
+	addr := func(i int) string { return fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff) }
+	for i := 0; i < maxClientBuckets; i++ {
+		c.take(addr(i), clock)
+	}
+	// 所有令牌桶都在使用中：新的地址随机挤掉一个，记录的地址数量不超过上限
+	for i := maxClientBuckets; i < maxClientBuckets+100; i++ {
+		if ok, _ := c.take(addr(i), clock); !ok {
+			t.Fatalf("expect a new address to get a full bucket")
+		}
+		if n := len(c.buckets); n != maxClientBuckets {
+			t.Fatalf("expect %d buckets, got %d", maxClientBuckets, n)
+		}
+	}
+	if !c.lastSweep.Equal(clock) {
+		t.Fatalf("expect one sweep, last at %v", c.lastSweep)
+	}
+
+	// 令牌桶补满之后，下一个间隔的查找一次丢弃所有补满的令牌桶
+	clock = clock.Add(clientSweepInterval)
+	c.take("10.255.0.1", clock)
+	if n := len(c.buckets); n != 1 {
+		t.Fatalf("expect the refilled buckets to be dropped, got %d", n)
+	}
+}
+
+func TestHTTPPoolRateLimitLoad(t *testing.T) {
+	newTestGroup(t, "rate-limit-load", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	const rps, burst, window = 400, 20, 500 * time.Millisecond
+	pool := NewHTTPPool("self", WithRateLimit(rps, burst))
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+
+	var ok, throttled atomic.Int64
+	deadline := time.Now().Add(window)
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				rsp, err := http.Get(srv.URL + defaultBasePath + "rate-limit-load/Tom")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				io.Copy(io.Discard, rsp.Body)
+				rsp.Body.Close()
+				switch rsp.StatusCode {
+				case http.StatusOK:
+					ok.Add(1)
+				case http.StatusTooManyRequests:
+					throttled.Add(1)
+				default:
+					t.Errorf("unexpected status %d", rsp.StatusCode)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	// 接受的请求数量是初始的 burst 加上窗口内补充的令牌，允许 15% 的误差
+	want := float64(burst) + rps*window.Seconds()
+	if got := float64(ok.Load()); got < want*0.85 || got > want*1.15 {
+		t.Fatalf("accepted %v requests, want about %v (%d throttled)", got, want, throttled.Load())
+	}
+	if throttled.Load() == 0 {
+		t.Fatalf("expect the load to exceed the limit")
+	}
+}
+
+// waitFor 等待 cond 成立，最多等待一秒。
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met after 1s")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHTTPPoolMaxPeerRequests(t *testing.T) {
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast:" + path.Base(r.URL.Path)))
+	}))
+	defer fast.Close()
+
+	for _, failFast := range []bool{true, false} {
+		t.Run(fmt.Sprintf("failFast=%v", failFast), func(t *testing.T) {
+			release := make(chan struct{})
+			var active, peak atomic.Int32
+			slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := active.Add(1)
+				defer active.Add(-1)
+				for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+				}
+				<-release
+				w.Write([]byte("slow:" + path.Base(r.URL.Path)))
+			}))
+			defer slow.Close()
+
+			pool, err := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{
+				MaxPeerRequests:  2,
+				PeerBusyFailFast: failFast,
+			}, WithRegistry(NewRegistry()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := pool.Set(slow.URL, fast.URL); err != nil {
+				t.Fatal(err)
+			}
+			slowGetter := pool.httpGetters[slow.URL]
+			fastGetter := pool.httpGetters[fast.URL]
+
+			const callers = 5
+			errs := make(chan error, callers)
+			for i := 0; i < callers; i++ {
+				go func() {
+					_, err := slowGetter.Get(context.Background(), "g", "k")
+					errs <- err
+				}()
+			}
+			waitFor(t, func() bool { return active.Load() == 2 })
+			if failFast {
+				for i := 0; i < callers-2; i++ {
+					if err := <-errs; !errors.Is(err, ErrPeerBusy) {
+						t.Fatalf("expect ErrPeerBusy beyond the limit, got %v", err)
+					}
+				}
+			} else {
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				_, err := slowGetter.Get(ctx, "g", "k")
+				cancel()
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Fatalf("expect a queued request to honor its context, got %v", err)
+				}
+			}
+			if s := pool.Stats().Peers[slow.URL]; s.InFlight != 2 {
+				t.Fatalf("expect 2 requests in flight to the slow peer, got %d", s.InFlight)
+			}
+			// 另一个节点的名额不受影响
+			if v, err := fastGetter.Get(context.Background(), "g", "k"); err != nil || string(v) != "fast:k" {
+				t.Fatalf("expect the fast peer to be unaffected, got %q %v", v, err)
+			}
+
+			close(release)
+			pending := 2
+			if !failFast {
+				pending = callers
+			}
+			for i := 0; i < pending; i++ {
+				if err := <-errs; err != nil {
+					t.Fatalf("expect the admitted requests to succeed, got %v", err)
+				}
+			}
+			if p := peak.Load(); p != 2 {
+				t.Fatalf("expect at most 2 concurrent requests to reach the slow peer, got %d", p)
+			}
+			if s := pool.Stats().Peers[slow.URL]; s.InFlight != 0 {
+				t.Fatalf("expect no requests in flight after they finish, got %d", s.InFlight)
+			}
+		})
+	}
+}
+
+func TestPeerBusyFallsBackToLocal(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("peer:" + path.Base(r.URL.Path)))
+	}))
+	defer slow.Close()
+
+	pool, err := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{
+		MaxPeerRequests:  1,
+		PeerBusyFailFast: true,
+	}, WithRegistry(NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Set(slow.URL); err != nil {
+		t.Fatal(err)
+	}
+	gee := newTestGroup(t, "peer-busy", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("local:" + key), nil
+		}), WithHotCacheRate(0), WithLogger(NopLogger{}))
+	gee.RegisterPeers(pool)
+
+	first := make(chan struct{})
+	go func() {
+		defer close(first)
+		gee.Get("first")
+	}()
+	waitFor(t, func() bool { return pool.Stats().Peers[slow.URL].InFlight == 1 })
+	if v, err := gee.Get("second"); err != nil || v.String() != "local:second" {
+		t.Errorf("expect a busy peer to fall back to the local getter, got %q %v", v, err)
+	}
+	close(release)
+	<-first
+}
+
+// newH2COwner 启动一个在独立 Registry 中提供 group 的拥有者节点，getter 为 nil 时 key 的值就是 key 本身。
+// seen 返回它处理的每个请求的 HTTP 主版本号和接受的连接数量。
+func newH2COwner(t *testing.T, group string, getter any, opts ...PoolOption) (srv *httptest.Server, seen func() (protos []int, conns int)) {
+	if getter == nil {
+		getter = GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	}
+	r := NewRegistry()
+	r.NewGroup(group, 2<<10, getter)
+	t.Cleanup(func() { r.DestroyGroup(group) })
+	pool := NewHTTPPool("owner", append(opts, WithRegistry(r))...)
+	var mu sync.Mutex
+	var protos []int
+	var conns int
+	srv = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PRI" {
+			mu.Lock()
+			protos = append(protos, r.ProtoMajor)
+			mu.Unlock()
+		}
+		pool.ServeHTTP(w, r)
+	}))
+	srv.Config.ConnState = func(_ net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv, func() ([]int, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(protos), conns
+	}
+}
+
+func TestHTTPPoolH2C(t *testing.T) {
+	h2Owner, h2Seen := newH2COwner(t, "h2c", nil, WithH2C())
+	h1Owner, h1Seen := newH2COwner(t, "h2c", nil)
+
+	pool, err := NewHTTPPoolOpts("http://self", nil, WithRegistry(NewRegistry()), WithH2C())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Set(h2Owner.URL, h1Owner.URL); err != nil {
+		t.Fatal(err)
+	}
+	for _, owner := range []string{h2Owner.URL, h1Owner.URL} {
+		getter := pool.httpGetters[owner]
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				key := "k" + strconv.Itoa(i)
+				if v, err := getter.Get(context.Background(), "h2c", key); err != nil || string(v) != key {
+					t.Errorf("get %s from %s: %q %v", key, owner, v, err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+	got, n := h2Seen()
+	if len(got) != 8 || slices.ContainsFunc(got, func(p int) bool { return p != 2 }) {
+		t.Fatalf("expect every request to the h2c owner over HTTP/2, got %v", got)
+	}
+	if n != 1 {
+		t.Fatalf("expect the requests to share one connection, got %d", n)
+	}
+	// 没有启用 WithH2C 的节点回退到 HTTP/1.1
+	if got, _ := h1Seen(); len(got) != 8 || slices.ContainsFunc(got, func(p int) bool { return p != 1 }) {
+		t.Fatalf("expect every request to the HTTP/1.1 owner over HTTP/1.1, got %v", got)
+	}
+
+	// 启用 WithH2C 的节点仍然以 HTTP/1.1 服务普通的客户端
+	rsp, err := http.Get(h2Owner.URL + defaultBasePath + "h2c/Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK || rsp.ProtoMajor != 1 {
+		t.Fatalf("expect an HTTP/1.1 client to be served over HTTP/1.1, got %d %s", rsp.StatusCode, rsp.Proto)
+	}
+}
+
+func TestH2CTransportFallback(t *testing.T) {
+	var h1Reqs, h2Reqs atomic.Int32
+	h1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PRI" {
+			h1Reqs.Add(1)
+		}
+	}))
+	defer h1.Close()
+	h2 := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h2Reqs.Add(1)
+		panic(http.ErrAbortHandler)
+	}), &http2.Server{}))
+	defer h2.Close()
+	tr := newH2CTransport(&http.Transport{})
+	defer tr.CloseIdleConnections()
+	do := func(method, url string) (*http.Response, error) {
+		req, err := http.NewRequest(method, url, strings.NewReader("v"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tr.RoundTrip(req)
+	}
+
+	// 拒绝了连接前言的节点没有处理请求，PUT 返回原来的错误，之后的请求使用 HTTP/1.1
+	if _, err := do(http.MethodPut, h1.URL); err == nil || h1Reqs.Load() != 0 {
+		t.Fatalf("expect the rejected PUT to fail without a retry, got %v after %d requests", err, h1Reqs.Load())
+	}
+	rsp, err := do(http.MethodPut, h1.URL)
+	if err != nil || rsp.ProtoMajor != 1 || h1Reqs.Load() != 1 {
+		t.Fatalf("expect the next PUT over HTTP/1.1, got %v %v", rsp, err)
+	}
+	rsp.Body.Close()
+
+	// 以 HTTP/2 处理了请求之后失败的 GET 不重新发出
+	if _, err := do(http.MethodGet, h2.URL); err == nil || h2Reqs.Load() != 1 {
+		t.Fatalf("expect the failed GET not to be retried, got %v after %d requests", err, h2Reqs.Load())
+	}
+	if tr.useHTTP1(strings.TrimPrefix(h2.URL, "http://")) {
+		t.Fatal("expect the h2c node to stay on HTTP/2")
+	}
+}
+
+func TestHTTPPoolH2CCancellation(t *testing.T) {
+	started := make(chan struct{}, 1)
+	cancelled := make(chan error, 1)
+	owner, seen := newH2COwner(t, "h2c-cancel", ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			started <- struct{}{}
+			select {
+			case <-ctx.Done():
+				cancelled <- ctx.Err()
+				return nil, ctx.Err()
+			case <-time.After(5 * time.Second):
+				return []byte(key), nil
+			}
+		}), WithH2C())
+
+	pool, err := NewHTTPPoolOpts("http://self", nil, WithRegistry(NewRegistry()), WithH2C(), WithPeerTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Set(owner.URL); err != nil {
+		t.Fatal(err)
+	}
+	getter := pool.httpGetters[owner.URL]
+	expectCancelled := func() {
+		t.Helper()
+		select {
+		case err := <-cancelled:
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("expect the owner's getter to see context.Canceled, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expect the owner's getter to be cancelled")
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	start := time.Now()
+	if _, err := getter.Get(ctx, "h2c-cancel", "slow"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect context.Canceled, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("expect the request to return promptly, took %v", d)
+	}
+	expectCancelled()
+
+	if _, err := getter.Get(context.Background(), "h2c-cancel", "slow"); !errors.Is(err, ErrPeerTimeout) {
+		t.Fatalf("expect ErrPeerTimeout, got %v", err)
+	}
+	expectCancelled()
+	if got, _ := seen(); len(got) != 2 || got[0] != 2 || got[1] != 2 {
+		t.Fatalf("expect both requests over HTTP/2, got %v", got)
+	}
+}
+
+// flakyListener 在关闭 drop 个连接之后才正常地接受连接，被关闭的连接读完请求之前就被重置。
+type flakyListener struct {
+	net.Listener
+	drop     atomic.Int32
+	accepted atomic.Int32
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		l.accepted.Add(1)
+		if l.drop.Add(-1) < 0 {
+			return c, nil
+		}
+		if tc, ok := c.(*net.TCPConn); ok {
+			tc.SetLinger(0)
+		}
+		c.Close()
+	}
+}
+
+func TestHTTPPoolRetryPolicy(t *testing.T) {
+	r := NewRegistry()
+	r.NewGroup("retry-policy", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	t.Cleanup(func() { r.DestroyGroup("retry-policy") })
+	owner := NewHTTPPool("owner", WithRegistry(r))
+	ln := &flakyListener{}
+	srv := httptest.NewUnstartedServer(owner)
+	ln.Listener = srv.Listener
+	srv.Listener = ln
+	srv.Start()
+	defer srv.Close()
+
+	newGetter := func(p RetryPolicy) (*HTTPPool, *httpGetter) {
+		t.Helper()
+		// 每个 HTTPPool 使用自己的连接池，第一个请求总是建立新的连接
+		pool := NewHTTPPool("http://self", WithRegistry(NewRegistry()), WithClient(newPeerClient()), WithRetryPolicy(p))
+		if err := pool.Set(srv.URL); err != nil {
+			t.Fatal(err)
+		}
+		return pool, pool.httpGetters[srv.URL]
+	}
+
+	// 第一个连接被重置，在新的连接上重试一次之后成功
+	ln.drop.Store(1)
+	ln.accepted.Store(0)
+	pool, getter := newGetter(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+	if v, err := getter.Get(context.Background(), "retry-policy", "Tom"); err != nil || string(v) != "Tom" {
+		t.Fatalf("expect the retry to succeed, got %q %v", v, err)
+	}
+	if s := pool.Stats().Peers[srv.URL]; s.Retries != 1 || s.Fetches != 1 || s.Errors != 0 || ln.accepted.Load() != 2 {
+		t.Fatalf("expect exactly one retry on a second connection, got %+v after %d connections", s, ln.accepted.Load())
+	}
+
+	// 没有重试策略时失败直接交给调用方
+	ln.drop.Store(1)
+	_, getter = newGetter(RetryPolicy{})
+	if _, err := getter.Get(context.Background(), "retry-policy", "Tom"); err == nil || !IsConnectionError(err) {
+		t.Fatalf("expect a connection error without a retry policy, got %v", err)
+	}
+
+	// 批量获取是 POST，不会被重试
+	ln.drop.Store(1)
+	pool, getter = newGetter(RetryPolicy{MaxAttempts: 3})
+	if _, err := getter.GetMulti(context.Background(), "retry-policy", []string{"Tom"}); err == nil {
+		t.Fatalf("expect a dropped POST not to be retried")
+	}
+	if s := pool.Stats().Peers[srv.URL]; s.Retries != 0 {
+		t.Fatalf("expect no retries for POST, got %d", s.Retries)
+	}
+
+	// Retryable 决定哪些错误被重试
+	ln.drop.Store(1)
+	pool, getter = newGetter(RetryPolicy{MaxAttempts: 3, Retryable: func(error) bool { return false }})
+	if _, err := getter.Get(context.Background(), "retry-policy", "Tom"); err == nil {
+		t.Fatalf("expect the classifier to stop the retry")
+	}
+	if s := pool.Stats().Peers[srv.URL]; s.Retries != 0 {
+		t.Fatalf("expect no retries, got %d", s.Retries)
+	}
+
+	// 剩余时间不够等待下一次重试时直接放弃
+	ln.drop.Store(1)
+	pool, getter = newGetter(RetryPolicy{MaxAttempts: 3, Backoff: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := getter.Get(ctx, "retry-policy", "Tom"); err == nil || ctx.Err() != nil {
+		t.Fatalf("expect the retry to be abandoned before the deadline, got %v", err)
+	}
+	if s := pool.Stats().Peers[srv.URL]; s.Retries != 0 {
+		t.Fatalf("expect no retries past the deadline, got %d", s.Retries)
+	}
+}
+
+func TestHTTPPoolRetryPolicyAfterHeaders(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		// 响应头声明的长度比实际发送的多，读取响应体时连接断开
+		w.Header().Set("Content-Length", "100")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		c, _, _ := w.(http.Hijacker).Hijack()
+		c.Close()
+	}))
+	defer srv.Close()
+	pool := NewHTTPPool("http://self", WithRegistry(NewRegistry()), WithRetryPolicy(RetryPolicy{MaxAttempts: 3}))
+	if err := pool.Set(srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	_, err := pool.httpGetters[srv.URL].Get(context.Background(), "g", "k")
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expect the truncated body to fail, got %v", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("expect no retry after the response headers, got %d requests", n)
+	}
+}
+
+func TestPeerHeadersLimitHotCopies(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer setNow(&clock)()
+
+	// 拥有者以原始格式回应：Tom 只剩 50ms，Ann 只剩不到 1ms，Bob 来自只写入 ttlHeader 的旧版本节点，
+	// Jack 不可缓存，Sam 没有存活时间
+	owner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path.Base(r.URL.Path) {
+		case "Tom":
+			w.Header().Set(ttlMsHeader, "50")
+			w.Header().Set(ttlHeader, "50.9ms")
+		case "Ann":
+			w.Header().Set(ttlMsHeader, "0")
+		case "Bob":
+			w.Header().Set(ttlHeader, "30ms")
+		case "Jack":
+			w.Header().Set(noStoreHeader, "1")
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte("peer:" + path.Base(r.URL.Path)))
+	}))
+	defer owner.Close()
+	gee := newTestGroup(t, "peer-headers", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("local node should not load %s", key)
+		}), WithHotCacheRate(1))
+	gee.RegisterPeers(fakePicker{peer: &httpGetter{baseURL: owner.URL + defaultBasePath}})
+
+	for _, key := range []string{"Tom", "Ann", "Bob", "Jack", "Sam"} {
+		if v, err := gee.Get(key); err != nil || v.String() != "peer:"+key {
+			t.Fatalf("get %s: %q %v", key, v, err)
+		}
+	}
+	if v, ok := gee.hotcache.get("Tom"); !ok || !v.Expire().Equal(clock.Add(50*time.Millisecond)) {
+		t.Fatalf("expect the hot copy of Tom to expire with the owner's copy, got %v %v", v.Expire(), ok)
+	}
+	if v, ok := gee.hotcache.peek("Ann"); ok && (v.Expire().IsZero() || v.Expire().After(clock.Add(time.Millisecond))) {
+		t.Fatalf("expect a zero %s to mean nearly expired rather than never, got %v", ttlMsHeader, v.Expire())
+	}
+	if v, ok := gee.hotcache.get("Bob"); !ok || !v.Expire().Equal(clock.Add(30*time.Millisecond)) {
+		t.Fatalf("expect %s from an older owner to limit the hot copy, got %v %v", ttlHeader, v.Expire(), ok)
+	}
+	if _, ok := gee.hotcache.get("Jack"); ok {
+		t.Fatalf("expect a no-store value not to be hot-cached")
+	}
+	if v, ok := gee.hotcache.get("Sam"); !ok || !v.Expire().IsZero() {
+		t.Fatalf("expect a value without a TTL header to be hot-cached as before, got %v %v", v.Expire(), ok)
+	}
+	clock = clock.Add(50 * time.Millisecond)
+	if _, ok := gee.hotcache.get("Tom"); ok {
+		t.Fatalf("expect the hot copy of Tom gone once the owner's copy expires")
+	}
+}
+
+// BenchmarkPeerFetchSmall 衡量从拥有者获取 1 KiB 的值的分配，protobuf 是默认的格式，raw 是旧版本节点的格式。
+func BenchmarkPeerFetchSmall(b *testing.B) {
+	SetLogger(NopLogger{})
+	defer SetLogger(nil)
+	value := make([]byte, 1<<10)
+	rand.Read(value)
+	r := NewRegistry()
+	r.NewGroup("fetch-bench", 2<<20, GetterFunc(
+		func(key string) ([]byte, error) {
+			return value, nil
+		}))
+	b.Cleanup(func() { r.DestroyGroup("fetch-bench") })
+	owner := httptest.NewServer(NewHTTPPool("owner", WithRegistry(r)))
+	defer owner.Close()
+	raw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(len(value)))
+		w.Write(value)
+	}))
+	defer raw.Close()
+
+	for _, bc := range []struct {
+		name string
+		srv  *httptest.Server
+	}{{"protobuf", owner}, {"raw", raw}} {
+		b.Run(bc.name, func(b *testing.B) {
+			getter := &httpGetter{baseURL: bc.srv.URL + defaultBasePath}
+			b.ReportAllocs()
+			b.SetBytes(int64(len(value)))
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					r, err := getter.getValue(context.Background(), "fetch-bench", "k", false)
+					if err != nil || len(r.Value) != len(value) {
+						b.Errorf("get: %d bytes, %v", len(r.Value), err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestPeerBodyBuffersNotAliased(t *testing.T) {
+	r := NewRegistry()
+	r.NewGroup("body-buffers", 2<<20, GetterFunc(
+		func(key string) ([]byte, error) {
+			return bytes.Repeat([]byte(key), 300), nil
+		}))
+	t.Cleanup(func() { r.DestroyGroup("body-buffers") })
+	srv := httptest.NewServer(NewHTTPPool("owner", WithRegistry(r)))
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+
+	// 并发获取不同的值：复用的缓冲区不能出现在任何一个返回的值中
+	var wg sync.WaitGroup
+	results := make([][]byte, 32)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				r, err := getter.getValue(context.Background(), "body-buffers", strconv.Itoa(i), false)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				results[i] = r.Value
+			}
+		}()
+	}
+	wg.Wait()
+	for i, v := range results {
+		if want := bytes.Repeat([]byte(strconv.Itoa(i)), 300); !bytes.Equal(v, want) {
+			t.Fatalf("value of %d corrupted by a reused buffer: %q", i, v[:16])
+		}
+	}
+}
+
+func TestHTTPPoolShutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	r := NewRegistry()
+	r.NewGroup("shutdown", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "slow" {
+				close(started)
+				<-release
+			}
+			return []byte(key), nil
+		}))
+	t.Cleanup(func() { r.DestroyGroup("shutdown") })
+	pool := NewHTTPPool("owner", WithRegistry(r))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := "http://" + ln.Addr().String() + defaultBasePath
+	served := make(chan error, 1)
+	go func() { served <- pool.Serve(ln) }()
+	get := func(path string) (int, string, string) {
+		t.Helper()
+		rsp, err := http.Get(base + path)
+		if err != nil {
+			t.Fatalf("get %s: %v", path, err)
+		}
+		defer rsp.Body.Close()
+		body, _ := io.ReadAll(rsp.Body)
+		return rsp.StatusCode, rsp.Header.Get(errorHeader), string(body)
+	}
+
+	slow := make(chan string, 1)
+	go func() {
+		_, _, body := get("shutdown/slow")
+		slow <- body
+	}()
+	<-started
+	stopped := make(chan error, 1)
+	go func() { stopped <- pool.Shutdown(context.Background()) }()
+	waitFor(t, pool.drain.isDraining)
+
+	// 正在关闭时新的请求被拒绝，健康检查回应 draining，请求方不重试
+	if code, reason, _ := get("shutdown/Tom"); code != http.StatusServiceUnavailable || reason != drainingReason {
+		t.Fatalf("expect a new request refused while draining, got %d %q", code, reason)
+	}
+	if code, _, body := get(healthzPath); code != http.StatusServiceUnavailable || body != "draining\n" {
+		t.Fatalf("expect the health check to report draining, got %d %q", code, body)
+	}
+	_, err = (&httpGetter{baseURL: base}).Get(context.Background(), "shutdown", "Tom")
+	if !errors.Is(err, ErrPeerDraining) || retryable(err) {
+		t.Fatalf("expect a non-retryable ErrPeerDraining, got %v", err)
+	}
+	select {
+	case err := <-stopped:
+		t.Fatalf("expect Shutdown to wait for the in-flight request, returned %v", err)
+	default:
+	}
+
+	// 已经开始的请求完成之后 Shutdown 关闭服务器
+	close(release)
+	if body := <-slow; body != "slow" {
+		t.Fatalf("expect the in-flight request to complete, got %q", body)
+	}
+	if err := <-stopped; err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		t.Fatalf("expect Serve to return ErrServerClosed, got %v", err)
+	}
+	if _, err := http.Get(base + "shutdown/Tom"); err == nil {
+		t.Fatalf("expect the listener closed after Shutdown")
+	}
+	if err := pool.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		t.Fatalf("expect Serve after Shutdown to fail, got %v", err)
+	}
+}
+
+func TestHTTPPoolShutdownTimeout(t *testing.T) {
+	release := make(chan struct{})
+	r := NewRegistry()
+	r.NewGroup("shutdown-timeout", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			<-release
+			return []byte(key), nil
+		}))
+	t.Cleanup(func() { r.DestroyGroup("shutdown-timeout") })
+	pool := NewHTTPPool("owner", WithRegistry(r))
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		pool.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, defaultBasePath+"shutdown-timeout/Tom", nil))
+	}()
+	defer func() {
+		close(release)
+		<-served
+	}()
+	waitFor(t, func() bool { return pool.Stats().Requests == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pool.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect Shutdown to give up at the deadline, got %v", err)
+	}
+}
+
+func TestAPIServer(t *testing.T) {
+	SetLogger(NopLogger{})
+	defer SetLogger(nil)
+	r := NewRegistry()
+	r.NewGroup("scores", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "Tom" || key == "a/b" {
+				return []byte(`{"score":630}`), nil
+			}
+			if key == "boom" {
+				return nil, errors.New("db password wrong")
+			}
+			return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+		}))
+	r.NewGroup("secret", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("s"), nil
+		}))
+	srv := httptest.NewServer(NewAPIServer(r,
+		WithAPIGroups("scores"),
+		WithAPIContentType("scores", "application/json"),
+		WithAPICORS("https://app.example.com")))
+	defer srv.Close()
+
+	do := func(method, path string, header ...string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rsp.Body.Close()
+		body, _ := io.ReadAll(rsp.Body)
+		return rsp, string(body)
+	}
+	errorOf := func(body string) string {
+		t.Helper()
+		var e struct{ Error string }
+		if err := json.Unmarshal([]byte(body), &e); err != nil {
+			t.Fatalf("expect a JSON error, got %q", body)
+		}
+		return e.Error
+	}
+
+	rsp, body := do("GET", "/api/cache/scores/Tom")
+	if rsp.StatusCode != http.StatusOK || body != `{"score":630}` || rsp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("GET: got %d %q %q", rsp.StatusCode, rsp.Header.Get("Content-Type"), body)
+	}
+	if rsp, body = do("GET", "/api/cache/scores/a%2Fb"); rsp.StatusCode != http.StatusOK {
+		t.Fatalf("escaped key: got %d %q", rsp.StatusCode, body)
+	}
+	if rsp, body = do("HEAD", "/api/cache/scores/Tom"); rsp.StatusCode != http.StatusOK || body != "" || rsp.ContentLength != 13 {
+		t.Fatalf("HEAD: got %d %d %q", rsp.StatusCode, rsp.ContentLength, body)
+	}
+
+	for _, c := range []struct {
+		method, path string
+		code         int
+		msg          string
+	}{
+		{"GET", "/api/cache/scores/kkk", http.StatusNotFound, "not exist"},
+		{"GET", "/api/cache/nope/Tom", http.StatusNotFound, "no such group"},
+		{"GET", "/api/cache/secret/Tom", http.StatusNotFound, "no such group"},
+		{"GET", "/api/cache/scores/boom", http.StatusServiceUnavailable, ErrPeerUnavailable.Error()},
+		{"GET", "/api/cache/scores", http.StatusBadRequest, "<group>/<key>"},
+		{"PUT", "/api/cache/scores/Tom", http.StatusMethodNotAllowed, "method not allowed"},
+		{"DELETE", "/api/cache/scores/Tom", http.StatusMethodNotAllowed, "method not allowed"},
+	} {
+		rsp, body := do(c.method, c.path)
+		if rsp.StatusCode != c.code || !strings.Contains(errorOf(body), c.msg) {
+			t.Errorf("%s %s: got %d %q, want %d %q", c.method, c.path, rsp.StatusCode, body, c.code, c.msg)
+		}
+		if strings.Contains(body, "password") {
+			t.Errorf("%s %s: internal error leaked: %q", c.method, c.path, body)
+		}
+	}
+	if rsp, _ = do("PUT", "/api/cache/scores/Tom"); rsp.Header.Get("Allow") != "GET, HEAD, OPTIONS" {
+		t.Fatalf("expect Allow on 405, got %q", rsp.Header.Get("Allow"))
+	}
+
+	rsp, _ = do("OPTIONS", "/api/cache/scores/Tom", "Origin", "https://app.example.com",
+		"Access-Control-Request-Method", "GET")
+	if rsp.StatusCode != http.StatusNoContent || rsp.Header.Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		rsp.Header.Get("Access-Control-Allow-Methods") == "" {
+		t.Fatalf("preflight: got %d %v", rsp.StatusCode, rsp.Header)
+	}
+	if rsp, _ = do("GET", "/api/cache/scores/Tom", "Origin", "https://evil.example.com"); rsp.Header.Get("Access-Control-Allow-Origin") != "" ||
+		rsp.Header.Get("Vary") != "Origin" {
+		t.Fatalf("expect no CORS grant to other origins, got %v", rsp.Header)
+	}
+}
+
+func TestAPIServerWrites(t *testing.T) {
+	var clock time.Time = time.Unix(1000, 0)
+	defer setNow(&clock)()
+	r := NewRegistry()
+	var loads atomic.Int32
+	r.NewGroup("scores", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads.Add(1)
+			return nil, ErrNotFound
+		}), WithMaxValueBytes(16))
+	api := NewAPIServer(r, WithAPIWrites(), WithAPIBasePath("/v1"))
+	mux := http.NewServeMux()
+	api.RegisterOn(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	do := func(method, path, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, rsp.Body)
+		rsp.Body.Close()
+		return rsp
+	}
+
+	if rsp := do("PUT", "/v1/scores/Tom?ttl=1m", "630"); rsp.StatusCode != http.StatusNoContent {
+		t.Fatalf("PUT: got %d", rsp.StatusCode)
+	}
+	if v, err := r.GetGroup("scores").Get("Tom"); err != nil || v.String() != "630" || loads.Load() != 0 {
+		t.Fatalf("expect the written value, got %q %v after %d loads", v, err, loads.Load())
+	}
+	clock = clock.Add(2 * time.Minute)
+	if _, err := r.GetGroup("scores").Get("Tom"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect the ttl to apply, got %v", err)
+	}
+
+	do("PUT", "/v1/scores/Tom", "630")
+	if rsp := do("DELETE", "/v1/scores/Tom", ""); rsp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE: got %d", rsp.StatusCode)
+	}
+	if _, err := r.GetGroup("scores").Get("Tom"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect the key to be removed, got %v", err)
+	}
+
+	if rsp := do("PUT", "/v1/scores/Tom?ttl=soon", "630"); rsp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("bad ttl: got %d", rsp.StatusCode)
+	}
+	if rsp := do("PUT", "/v1/scores/Tom", strings.Repeat("x", 17)); rsp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("large value: got %d", rsp.StatusCode)
+	}
+	if rsp := do("POST", "/v1/scores/Tom", "630"); rsp.StatusCode != http.StatusMethodNotAllowed ||
+		rsp.Header.Get("Allow") != "GET, HEAD, PUT, DELETE, OPTIONS" {
+		t.Fatalf("POST: got %d %q", rsp.StatusCode, rsp.Header.Get("Allow"))
+	}
+}
+
+func TestHTTPPoolAccessLog(t *testing.T) {
+	newTestGroup(t, "access-log", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			switch key {
+			case "Tom":
+				return []byte("630"), nil
+			case "boom":
+				panic("db exploded")
+			}
+			return nil, ErrNotFound
+		}))
+	logs := &recordingLogger{}
+	SetLogger(logs)
+	defer SetLogger(nil)
+
+	serve := func(p *HTTPPool, path string) string {
+		t.Helper()
+		logs.mu.Lock()
+		logs.msgs = nil
+		logs.mu.Unlock()
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = "10.0.0.7:4242"
+		p.ServeHTTP(httptest.NewRecorder(), req)
+		logs.mu.Lock()
+		defer logs.mu.Unlock()
+		for _, m := range logs.msgs {
+			if strings.HasPrefix(m, "[Server self]GET ") {
+				return m
+			}
+		}
+		return ""
+	}
+
+	p := NewHTTPPool("self")
+	for _, c := range []struct{ path, want string }{
+		{"/_geecache/access-log/Tom", "GET /_geecache/access-log/Tom 200 3B "},
+		{"/_geecache/access-log/kkk", "GET /_geecache/access-log/kkk 404 "},
+		{"/_geecache/access-log/boom", "GET /_geecache/access-log/boom 500 "},
+	} {
+		line := serve(p, c.path)
+		if !strings.HasPrefix(line, "[Server self]"+c.want) || !strings.HasSuffix(line, " from 10.0.0.7:4242") {
+			t.Errorf("%s: got %q, want %q ... from 10.0.0.7:4242", c.path, line, c.want)
+		}
+	}
+	if line := serve(p, "/_geecache/-/healthz"); line != "" {
+		t.Errorf("expect health checks not to be logged, got %q", line)
+	}
+
+	redacted := NewHTTPPool("self", WithAccessLog(true, true))
+	line := serve(redacted, "/_geecache/access-log/Tom")
+	if strings.Contains(line, "Tom") || !strings.HasPrefix(line, "[Server self]GET /_geecache/access-log/#") {
+		t.Errorf("expect the key to be hashed, got %q", line)
+	}
+	if again := serve(redacted, "/_geecache/access-log/Tom"); again == "" || strings.Fields(again)[1] != strings.Fields(line)[1] {
+		t.Errorf("expect the same key to hash the same, got %q and %q", line, again)
+	}
+	if line := serve(NewHTTPPool("self", WithAccessLog(false, false)), "/_geecache/access-log/Tom"); line != "" {
+		t.Errorf("expect no access log when disabled, got %q", line)
+	}
+}
+
+func TestAccessLogWriterKeepsInterfaces(t *testing.T) {
+	rec := httptest.NewRecorder()
+	var w http.ResponseWriter = &accessLogWriter{ResponseWriter: rec}
+	f, ok := w.(http.Flusher)
+	if !ok {
+		t.Fatal("expect the wrapper to be a Flusher")
+	}
+	f.Flush()
+	if !rec.Flushed || w.(*accessLogWriter).status != http.StatusOK {
+		t.Fatalf("expect Flush to reach the recorder and commit a 200")
+	}
+	if _, _, err := w.(http.Hijacker).Hijack(); !errors.Is(err, http.ErrNotSupported) {
+		t.Fatalf("expect ErrNotSupported from a writer that cannot hijack, got %v", err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lw := &accessLogWriter{ResponseWriter: w}
+		conn, _, err := http.NewResponseController(lw).Hijack()
+		if err != nil {
+			t.Errorf("hijack: %v", err)
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 204 No Content\r\nConnection: close\r\n\r\n"))
+		conn.Close()
+	}))
+	defer srv.Close()
+	rsp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expect the hijacked response, got %d", rsp.StatusCode)
+	}
+}
+
+// oldPeerHandler 模拟没有协议版本的旧版本节点：它不认识 protoHeader、版本探测接口和批量请求。
+func oldPeerHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del(protoHeader)
+		if strings.HasSuffix(r.URL.Path, versionPath) {
+			http.Error(w, "no such group: -", http.StatusNotFound)
+			return
+		}
+		if op := r.URL.Query().Get("op"); op == "getmulti" {
+			http.Error(w, "unsupported op: "+op, http.StatusBadRequest)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func TestPeerProtoNegotiation(t *testing.T) {
+	r := NewRegistry()
+	r.NewGroup("scores", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+		}))
+	SetLogger(NopLogger{})
+	defer SetLogger(nil)
+	pool := NewHTTPPool("self", WithRegistry(r))
+	var old atomic.Bool
+	var probes, batches, inFlight, peak atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasSuffix(req.URL.Path, versionPath) {
+			probes.Add(1)
+		}
+		if req.URL.Query().Get("op") == "getmulti" {
+			batches.Add(1)
+		}
+		if old.Load() {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+			}
+			time.Sleep(time.Millisecond)
+			oldPeerHandler(pool).ServeHTTP(w, req)
+			return
+		}
+		pool.ServeHTTP(w, req)
+	}))
+	defer srv.Close()
+	g := &httpGetter{baseURL: srv.URL + defaultBasePath}
+
+	getMulti := func(want int32) {
+		t.Helper()
+		batches.Store(0)
+		out, err := g.GetMulti(context.Background(), "scores", []string{"Tom", "kkk", "Sam"})
+		if err != nil || len(out) != 3 || string(out[0].Value) != "630" || !errors.Is(out[1].Err, ErrNotFound) || string(out[2].Value) != "567" {
+			t.Fatalf("GetMulti: got %+v %v", out, err)
+		}
+		if batches.Load() != want {
+			t.Fatalf("expect %d batch requests, got %d", want, batches.Load())
+		}
+	}
+
+	// 新的节点之间使用批量请求，版本来自响应中的头部，不需要探测
+	getMulti(1)
+	if g.proto.Load() != protoV2 || probes.Load() != 0 {
+		t.Fatalf("expect protocol %d learned without a probe, got %d after %d probes", protoV2, g.proto.Load(), probes.Load())
+	}
+
+	// 节点回滚到旧版本：批量请求被拒绝之后探测一次版本，之后逐个获取
+	old.Store(true)
+	getMulti(1)
+	if g.proto.Load() != protoV1 || probes.Load() != 1 {
+		t.Fatalf("expect protocol %d after one probe, got %d after %d probes", protoV1, g.proto.Load(), probes.Load())
+	}
+	getMulti(0)
+	if v, err := g.Get(context.Background(), "scores", "Jack"); err != nil || string(v) != "589" {
+		t.Fatalf("Get from an old peer: got %q %v", v, err)
+	}
+	keys := make([]string, 5*maxEachRequests)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	if out, err := g.GetMulti(context.Background(), "scores", keys); err != nil || len(out) != len(keys) || !errors.Is(out[0].Err, ErrNotFound) {
+		t.Fatalf("GetMulti of %d keys from an old peer: got %d results, %v", len(keys), len(out), err)
+	}
+	if n := peak.Load(); n > maxEachRequests {
+		t.Fatalf("expect at most %d concurrent requests to an old peer, got %d", maxEachRequests, n)
+	}
+
+	// 节点再次升级之后，单个请求的响应让请求方重新使用批量请求
+	old.Store(false)
+	if v, err := g.Get(context.Background(), "scores", "Jack"); err != nil || string(v) != "589" {
+		t.Fatalf("Get: got %q %v", v, err)
+	}
+	getMulti(1)
+	if probes.Load() != 1 {
+		t.Fatalf("expect no more probes, got %d", probes.Load())
+	}
+}
+
+func TestPeerProtoOldClient(t *testing.T) {
+	newTestGroup(t, "proto-old-client", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("v:" + key), nil
+		}))
+	srv := httptest.NewServer(NewHTTPPool("self"))
+	defer srv.Close()
+
+	get := func(proto string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("GET", srv.URL+defaultBasePath+"proto-old-client/Tom", nil)
+		if proto != "" {
+			req.Header.Set(protoHeader, proto)
+		}
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rsp
+	}
+
+	// 旧版本的请求方不发送版本，得到与原来一样的原始字节
+	rsp := get("")
+	body, _ := io.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK || string(body) != "v:Tom" || rsp.Header.Get(protoHeader) != "" {
+		t.Fatalf("old client: got %d %q %q", rsp.StatusCode, body, rsp.Header.Get(protoHeader))
+	}
+	// 更高的未知版本降级到共同支持的版本
+	rsp = get("9")
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK || rsp.Header.Get(protoHeader) != strconv.Itoa(protoVersion) {
+		t.Fatalf("future client: got %d %q", rsp.StatusCode, rsp.Header.Get(protoHeader))
+	}
+	if rsp = get("two"); rsp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expect a malformed version to be rejected, got %d", rsp.StatusCode)
+	}
+	rsp.Body.Close()
+
+	rsp, err := http.Get(srv.URL + defaultBasePath + versionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+	var info versionInfo
+	if err := json.NewDecoder(rsp.Body).Decode(&info); err != nil || info.Proto != protoVersion {
+		t.Fatalf("version probe: got %+v %v", info, err)
+	}
+
+	future := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"proto":9,"features":["unknown"]}`))
+	}))
+	defer future.Close()
+	g := &httpGetter{baseURL: future.URL + "/"}
+	if v := g.probeProto(context.Background()); v != protoVersion || g.proto.Load() != protoVersion {
+		t.Fatalf("expect a future peer to be spoken to at %d, got %d", protoVersion, v)
+	}
+}
+
+func TestHTTPPoolGroupcacheCompat(t *testing.T) {
+	r := NewRegistry()
+	var keys []string
+	var mu sync.Mutex
+	r.NewGroup("scores", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			mu.Lock()
+			keys = append(keys, key)
+			mu.Unlock()
+			return []byte("v:" + key), nil
+		}), WithTTL(time.Minute))
+	owner := NewHTTPPool("owner", WithRegistry(r), WithGroupcacheCompat())
+	if owner.BasePath() != groupcacheBasePath {
+		t.Fatalf("expect base path %q, got %q", groupcacheBasePath, owner.BasePath())
+	}
+	srv := httptest.NewServer(owner)
+	defer srv.Close()
+
+	// groupcache 的请求方：按查询参数转义，不声明 Accept，期望只有 value 的 GetResponse
+	rsp, err := http.Get(srv.URL + "/_groupcache/scores/" + url.QueryEscape("a b/c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	var out geecachepb.GetResponse
+	if rsp.StatusCode != http.StatusOK || rsp.Header.Get("Content-Type") != protobufType || proto.Unmarshal(body, &out) != nil {
+		t.Fatalf("expect a GetResponse, got %d %q %q", rsp.StatusCode, rsp.Header.Get("Content-Type"), body)
+	}
+	if string(out.Value) != "v:a b/c" || out.TtlMs != 0 || out.Version != 0 || out.Flags != 0 {
+		t.Fatalf("expect only the value of the unescaped key, got %v", &out)
+	}
+	if rsp.Header.Get(ttlHeader) == "" {
+		t.Fatalf("expect the ttl in the %s header", ttlHeader)
+	}
+
+	// GeeCache 的请求方：与 groupcache 一样转义，只能获取值，存活时间来自头部
+	pool := NewHTTPPool("self", WithRegistry(NewRegistry()), WithGroupcacheCompat())
+	if err := pool.Set(srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	peer, ok := pool.PickPeer("a b")
+	if !ok {
+		t.Fatal("expect the owner to be picked")
+	}
+	for name, ok := range map[string]bool{
+		"PeerSetter":       is[PeerSetter](peer),
+		"PeerRemover":      is[PeerRemover](peer),
+		"PeerBatchGetter":  is[PeerBatchGetter](peer),
+		"PeerGetterStream": is[PeerGetterStream](peer),
+		"PeerRevalidator":  is[PeerRevalidator](peer),
+	} {
+		if ok {
+			t.Errorf("expect a groupcache peer not to be a %s", name)
+		}
+	}
+	v, err := peer.Get(context.Background(), "scores", "a b")
+	if err != nil || string(v) != "v:a b" {
+		t.Fatalf("Get: got %q %v", v, err)
+	}
+	res, err := peer.(peerValueGetter).getValue(context.Background(), "scores", "Tom", false)
+	if err != nil || string(res.Value) != "v:Tom" || res.TTL <= 0 || res.TTL > time.Minute {
+		t.Fatalf("getValue: got %+v %v", res, err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(keys, []string{"a b/c", "a b", "Tom"}) {
+		t.Fatalf("expect the owner to load the keys as sent, got %q", keys)
+	}
+}
+
+// is 报告 v 是否实现了接口 T。
+func is[T any](v any) bool {
+	_, ok := v.(T)
+	return ok
+}
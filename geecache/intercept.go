@@ -0,0 +1,93 @@
+package geecache
+
+import (
+	"context"
+	"time"
+)
+
+// Interceptor 包裹 Group 的一次 Get，用于附加鉴权、日志、延迟统计或测试中的故障注入等横切逻辑。
+//
+// next 执行被包裹的查找过程（之后的拦截器、缓存查找和加载），返回它的结果和错误。
+// 拦截器可以不调用 next 直接返回，也可以观察或替换 next 返回的值和错误；
+// next 最多调用一次。拦截器会被并发调用，实现需要是并发安全的。
+type Interceptor func(ctx context.Context, key string, next func() (ByteView, error)) (ByteView, error)
+
+// WithInterceptor 为 Group 添加一个拦截器，它包裹 Get、GetContext 和 GetInto 的整个查找过程，
+// 包括缓存查找和未命中时的加载。
+//
+// 多次使用时拦截器按注册顺序组合，先注册的在外层：第一个拦截器最先看到请求、最后看到结果。
+// 拦截器收到的是经过 WithKeyNormalizer 规范化之后的 key，被拒绝的 key 和已销毁的 Group
+// 不会经过拦截器。GetMulti、GetFresh 和其他节点发来的请求不经过拦截器。
+//
+// 参数:
+//
+//	ic: 要添加的拦截器，为 nil 时忽略。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithInterceptor(ic Interceptor) GroupOption {
+	return func(g *Group) {
+		if ic != nil {
+			g.interceptors = append(g.interceptors, ic)
+		}
+	}
+}
+
+// intercept 按注册顺序用拦截器包裹 get。
+func (g *Group) intercept(ctx context.Context, key string) (ByteView, error) {
+	next := func() (ByteView, error) {
+		return g.get(ctx, key)
+	}
+	for i := len(g.interceptors) - 1; i >= 0; i-- {
+		ic, inner := g.interceptors[i], next
+		next = func() (ByteView, error) {
+			return ic(ctx, key, inner)
+		}
+	}
+	return next()
+}
+
+// LoggingInterceptor 返回一个把每次 Get 的 key、耗时和错误写入 l 的拦截器。
+//
+// 参数:
+//
+//	l: 接收日志的 Logger，为 nil 时使用 SetLogger 设置的全局 Logger。
+//
+// 返回值:
+//
+//	Interceptor: 可传递给 WithInterceptor 的拦截器。
+func LoggingInterceptor(l Logger) Interceptor {
+	return func(ctx context.Context, key string, next func() (ByteView, error)) (ByteView, error) {
+		start := time.Now()
+		v, err := next()
+		logger := l
+		if logger == nil {
+			logger = globalLogger.Load().(loggerHolder).l
+		}
+		if err != nil {
+			logger.Printf("[GeeCache] Get %s failed in %v: %v", key, time.Since(start), err)
+		} else {
+			logger.Printf("[GeeCache] Get %s (%d bytes) in %v", key, v.Len(), time.Since(start))
+		}
+		return v, err
+	}
+}
+
+// LatencyInterceptor 返回一个在每次 Get 结束时把耗时交给 observe 的拦截器，例如记录到延迟直方图中。
+//
+// 参数:
+//
+//	observe: 接收 key、这次 Get 的耗时和它返回的错误的函数，会被并发调用。
+//
+// 返回值:
+//
+//	Interceptor: 可传递给 WithInterceptor 的拦截器。
+func LatencyInterceptor(observe func(key string, d time.Duration, err error)) Interceptor {
+	return func(ctx context.Context, key string, next func() (ByteView, error)) (ByteView, error) {
+		start := time.Now()
+		v, err := next()
+		observe(key, time.Since(start), err)
+		return v, err
+	}
+}
@@ -0,0 +1,104 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// ErrTooManyLoads 表示同时调用 getter 的加载达到了 WithMaxConcurrentLoads 的上限，
+// 并且等待的加载超过了 WithLoadQueueLimit 的限制。这类错误不会被缓存。
+var ErrTooManyLoads = errors.New("geecache: too many concurrent loads")
+
+// WithMaxConcurrentLoads 限制 Group 同时调用 getter 的加载数量，避免缓存冷启动时压垮数据源。
+//
+// 限制作用在 singleflight 合并之后，因此被限制的是不同 key 的加载，同一个 key 的并发请求仍然只加载一次。
+// 超过上限的加载会等待空出的名额，等待遵守加载的上下文；需要快速失败时配合 WithLoadQueueLimit 使用。
+//
+// 参数:
+//
+//	n: 同时调用 getter 的最大数量，小于 1 时不限制。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithMaxConcurrentLoads(n int) GroupOption {
+	return func(g *Group) {
+		g.maxLoads = max(n, 0)
+	}
+}
+
+// WithLoadQueueLimit 限制等待 WithMaxConcurrentLoads 名额的加载数量，超过时加载立即返回 ErrTooManyLoads。
+//
+// 参数:
+//
+//	n: 同时等待的加载的最大数量，为 0 时名额用完就立即失败，小于 0 时不限制（默认）。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithLoadQueueLimit(n int) GroupOption {
+	return func(g *Group) {
+		g.loadQueue = max(n, -1)
+	}
+}
+
+// loadLimiter 是 WithMaxConcurrentLoads 使用的信号量。
+type loadLimiter struct {
+	sem     chan struct{}
+	queue   int64 // 等待的加载数量上限，小于 0 表示不限制
+	waiting atomic.Int64
+}
+
+// newLoadLimiter 创建一个允许 n 个加载同时进行、最多 queue 个加载等待的信号量。
+func newLoadLimiter(n, queue int) *loadLimiter {
+	return &loadLimiter{sem: make(chan struct{}, n), queue: int64(queue)}
+}
+
+// acquire 获取一个名额。等待的加载已满时返回 ErrTooManyLoads，ctx 结束时返回 ctx.Err()。
+func (l *loadLimiter) acquire(ctx context.Context) error {
+	select {
+	case l.sem <- struct{}{}:
+		return nil
+	default:
+	}
+	waiting := l.waiting.Add(1)
+	defer l.waiting.Add(-1)
+	if l.queue >= 0 && waiting > l.queue {
+		return ErrTooManyLoads
+	}
+	select {
+	case l.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release 归还 acquire 获取的名额。
+func (l *loadLimiter) release() {
+	<-l.sem
+}
+
+// acquireLoad 在调用 getter 之前获取名额，并记录正在进行的加载数量。
+// 获取失败时返回的错误已计入 Stats.LoadRejections。
+func (g *Group) acquireLoad(ctx context.Context) error {
+	if g.loadLimit != nil {
+		if err := g.loadLimit.acquire(ctx); err != nil {
+			if errors.Is(err, ErrTooManyLoads) {
+				g.stats.loadRejections.Add(1)
+			}
+			return err
+		}
+	}
+	g.stats.loadsInFlight.Add(1)
+	return nil
+}
+
+// releaseLoad 在 getter 返回之后归还 acquireLoad 获取的名额。
+func (g *Group) releaseLoad() {
+	g.stats.loadsInFlight.Add(-1)
+	if g.loadLimit != nil {
+		g.loadLimit.release()
+	}
+}
@@ -0,0 +1,78 @@
+package geecache
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// Logger 接收 Group 和 HTTPPool 输出的日志，可以把日志接入任意的日志系统，或者按 Group 关闭日志。
+//
+// Printf 会被多个 goroutine 并发调用，实现需要是并发安全的。
+type Logger interface {
+	Printf(format string, v ...any)
+}
+
+// StdLogger 把日志写入标准库 log 包的默认 Logger，是默认使用的 Logger。
+type StdLogger struct{}
+
+// Printf 实现了 Logger 接口。
+func (StdLogger) Printf(format string, v ...any) {
+	log.Output(2, fmt.Sprintf(format, v...))
+}
+
+// NopLogger 丢弃所有日志。使用 NopLogger 时日志消息不会被格式化，命中缓存的 Get 不会因为日志分配内存。
+type NopLogger struct{}
+
+// Printf 实现了 Logger 接口。
+func (NopLogger) Printf(format string, v ...any) {}
+
+// loggerHolder 包装全局的 Logger，使不同的实现类型可以存入同一个 atomic.Value。
+type loggerHolder struct {
+	l Logger
+}
+
+// globalLogger 是没有通过 WithLogger 单独设置 Logger 的 Group 以及 HTTPPool 使用的 Logger。
+var globalLogger atomic.Value
+
+func init() {
+	globalLogger.Store(loggerHolder{StdLogger{}})
+}
+
+// SetLogger 设置全局的 Logger，它对 HTTPPool 和所有没有使用 WithLogger 的 Group 立即生效。
+//
+// 参数:
+//
+//	l: 新的全局 Logger，为 nil 时恢复为 StdLogger。
+func SetLogger(l Logger) {
+	if l == nil {
+		l = StdLogger{}
+	}
+	globalLogger.Store(loggerHolder{l})
+}
+
+// WithLogger 为 Group 单独设置 Logger，代替全局的 Logger。
+//
+// 参数:
+//
+//	l: Group 使用的 Logger，为 nil 时使用全局的 Logger。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithLogger(l Logger) GroupOption {
+	return func(g *Group) {
+		g.logger = l
+	}
+}
+
+// logf 把一条日志交给 Group 当前使用的 Logger。
+func (g *Group) logf(format string, v ...any) {
+	l := g.logger
+	if l == nil {
+		l = globalLogger.Load().(loggerHolder).l
+	}
+	if _, nop := l.(NopLogger); !nop {
+		l.Printf(format, v...)
+	}
+}
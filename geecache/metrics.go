@@ -0,0 +1,198 @@
+package geecache
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MetricsCollector 接收 Group 和 HTTPPool 产生的指标，可以对接 Prometheus、statsd 等任意监控系统。
+//
+// 这些方法在 Get 和节点间请求的过程中被同步调用，并且会被多个 goroutine 并发调用，
+// 实现需要是并发安全的并尽量轻量。
+type MetricsCollector interface {
+	IncGet(group string)                                              // 每次 Get 调用
+	IncHit(group, tier string)                                        // 在 tier 中命中，tier 为 "main"、"hot" 或 "negative"
+	ObserveLoadDuration(group string, source string, d time.Duration) // 一次加载的耗时，source 为 "local" 或 "peer"
+	IncPeerError(peer string)                                         // 一次失败的远程请求，peer 为节点的地址
+	IncServerRequest(group string)                                    // HTTPPool 收到其他节点的一次请求
+}
+
+// PeerRequestObserver 是 MetricsCollector 可以额外实现的接口，用于按节点记录每次远程请求的耗时。
+//
+// Group 每次向远程节点发起获取请求之后调用它，包括返回 ErrNotFound 和失败的请求；
+// 失败的请求同时照常调用 IncPeerError。与 MetricsCollector 的其他方法一样会被并发调用。
+type PeerRequestObserver interface {
+	ObservePeerRequest(peer string, d time.Duration, err error) // peer 为节点的地址，err 为请求返回的错误
+}
+
+// 指标中使用的缓存层级和加载来源。
+const (
+	TierMain     = "main"
+	TierHot      = "hot"
+	TierNegative = "negative"
+
+	SourceLocal = "local"
+	SourcePeer  = "peer"
+)
+
+// NopCollector 是 MetricsCollector 的空实现，也是默认的指标收集器。
+type NopCollector struct{}
+
+func (NopCollector) IncGet(group string)                                              {}
+func (NopCollector) IncHit(group, tier string)                                        {}
+func (NopCollector) ObserveLoadDuration(group string, source string, d time.Duration) {}
+func (NopCollector) IncPeerError(peer string)                                         {}
+func (NopCollector) IncServerRequest(group string)                                    {}
+
+// collectorHolder 包装全局的 MetricsCollector，使不同的实现类型可以存入同一个 atomic.Value。
+type collectorHolder struct {
+	c MetricsCollector
+}
+
+// globalCollector 是没有通过 WithMetrics 单独设置收集器的 Group 使用的收集器。
+var globalCollector atomic.Value
+
+func init() {
+	globalCollector.Store(collectorHolder{NopCollector{}})
+}
+
+// SetMetricsCollector 设置全局的指标收集器，它对所有没有使用 WithMetrics 的 Group 立即生效。
+//
+// 参数:
+//
+//	c: 新的全局收集器，为 nil 时恢复为 NopCollector。
+func SetMetricsCollector(c MetricsCollector) {
+	if c == nil {
+		c = NopCollector{}
+	}
+	globalCollector.Store(collectorHolder{c})
+}
+
+// WithMetrics 为 Group 单独设置指标收集器，代替全局的收集器。
+//
+// 参数:
+//
+//	c: Group 使用的收集器，为 nil 时使用全局的收集器。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithMetrics(c MetricsCollector) GroupOption {
+	return func(g *Group) {
+		g.collector = c
+	}
+}
+
+// metrics 返回 Group 当前使用的指标收集器。
+func (g *Group) metrics() MetricsCollector {
+	if g.collector != nil {
+		return g.collector
+	}
+	return globalCollector.Load().(collectorHolder).c
+}
+
+// peerName 返回指标中使用的节点名称：实现了 fmt.Stringer 的节点使用 String，否则使用类型名。
+func peerName(peer PeerGetter) string {
+	if s, ok := peer.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", peer)
+}
+
+// MemoryCollector 是把指标保存在内存中的 MetricsCollector，适合测试和调试。
+type MemoryCollector struct {
+	mu             sync.Mutex
+	gets           map[string]int64
+	hits           map[[2]string]int64
+	loads          map[[2]string][]time.Duration
+	peerErrors     map[string]int64
+	serverRequests map[string]int64
+}
+
+// NewMemoryCollector 创建一个空的 MemoryCollector。
+//
+// 返回值:
+//
+//	*MemoryCollector: 一个指向新创建的 MemoryCollector 实例的指针。
+func NewMemoryCollector() *MemoryCollector {
+	return &MemoryCollector{
+		gets:           make(map[string]int64),
+		hits:           make(map[[2]string]int64),
+		loads:          make(map[[2]string][]time.Duration),
+		peerErrors:     make(map[string]int64),
+		serverRequests: make(map[string]int64),
+	}
+}
+
+// IncGet 实现了 MetricsCollector 接口。
+func (m *MemoryCollector) IncGet(group string) {
+	m.mu.Lock()
+	m.gets[group]++
+	m.mu.Unlock()
+}
+
+// IncHit 实现了 MetricsCollector 接口。
+func (m *MemoryCollector) IncHit(group, tier string) {
+	m.mu.Lock()
+	m.hits[[2]string{group, tier}]++
+	m.mu.Unlock()
+}
+
+// ObserveLoadDuration 实现了 MetricsCollector 接口。
+func (m *MemoryCollector) ObserveLoadDuration(group string, source string, d time.Duration) {
+	m.mu.Lock()
+	k := [2]string{group, source}
+	m.loads[k] = append(m.loads[k], d)
+	m.mu.Unlock()
+}
+
+// IncPeerError 实现了 MetricsCollector 接口。
+func (m *MemoryCollector) IncPeerError(peer string) {
+	m.mu.Lock()
+	m.peerErrors[peer]++
+	m.mu.Unlock()
+}
+
+// IncServerRequest 实现了 MetricsCollector 接口。
+func (m *MemoryCollector) IncServerRequest(group string) {
+	m.mu.Lock()
+	m.serverRequests[group]++
+	m.mu.Unlock()
+}
+
+// Gets 返回 group 的 Get 调用次数。
+func (m *MemoryCollector) Gets(group string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.gets[group]
+}
+
+// Hits 返回 group 在 tier 中的命中次数。
+func (m *MemoryCollector) Hits(group, tier string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hits[[2]string{group, tier}]
+}
+
+// LoadDurations 返回 group 从 source 加载的每一次耗时，按记录的先后顺序排列。
+func (m *MemoryCollector) LoadDurations(group, source string) []time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]time.Duration(nil), m.loads[[2]string{group, source}]...)
+}
+
+// PeerErrors 返回对 peer 的失败请求次数。
+func (m *MemoryCollector) PeerErrors(peer string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.peerErrors[peer]
+}
+
+// ServerRequests 返回 group 收到的其他节点的请求次数。
+func (m *MemoryCollector) ServerRequests(group string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.serverRequests[group]
+}
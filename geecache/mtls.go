@@ -0,0 +1,161 @@
+package geecache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+)
+
+// MutualTLSFiles 是 LoadMutualTLS 使用的 PEM 文件和允许的节点名称。
+type MutualTLSFiles struct {
+	CAFile   string // 签发集群中所有节点证书的 CA，用来验证对方的证书
+	CertFile string // 本节点的证书，既作为服务端证书，也作为客户端证书
+	KeyFile  string // 本节点证书的私钥
+
+	// AllowedNames 是允许调用本节点的客户端证书名称的模式，例如 "cache-*.internal"，
+	// 按 path.Match 的语法与证书的 DNS SAN 和 CN 比较，任意一个匹配即可。为空时接受 CA 签发的所有证书。
+	AllowedNames []string
+}
+
+// LoadMutualTLS 从 PEM 文件创建节点之间双向 TLS 使用的一对配置。
+//
+// server 要求并验证客户端证书，只接受 CAFile 签发、名称匹配 AllowedNames 的证书，
+// 验证失败的连接在 TLS 握手时就被拒绝，不会到达 ServeHTTP；它可以传给 WithServerTLSConfig。
+// client 出示本节点的证书并用 CAFile 验证服务端，可以传给 WithTLSConfig。
+//
+// 参数:
+//
+//	f: PEM 文件的路径和允许的客户端名称。
+//
+// 返回值:
+//
+//	server: 服务端的 TLS 配置。
+//	client: 客户端的 TLS 配置。
+//	err: 读取或解析文件失败、CAFile 中没有证书或 AllowedNames 中有无效的模式时返回错误。
+func LoadMutualTLS(f MutualTLSFiles) (server, client *tls.Config, err error) {
+	for _, pattern := range f.AllowedNames {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, nil, fmt.Errorf("geecache: invalid allowed name %q: %v", pattern, err)
+		}
+	}
+	cert, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("geecache: load certificate: %w", err)
+	}
+	caPEM, err := os.ReadFile(f.CAFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("geecache: load CA: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		return nil, nil, fmt.Errorf("geecache: no certificates in %s", f.CAFile)
+	}
+
+	server = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    roots,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	if len(f.AllowedNames) > 0 {
+		server.VerifyConnection = VerifyPeerNames(f.AllowedNames...)
+	}
+	client = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      roots,
+	}
+	return server, client, nil
+}
+
+// VerifyPeerNames 返回一个可以用作 tls.Config.VerifyConnection 的函数，它只接受证书的 DNS SAN 或 CN
+// 匹配 patterns 中任意一个模式的对端，模式按 path.Match 的语法，例如 "cache-*.internal"。
+// 它在证书链验证通过之后调用，没有出示证书的对端同样被拒绝。
+//
+// 参数:
+//
+//	patterns: 允许的名称模式，无效的模式会引发 panic。
+//
+// 返回值:
+//
+//	func(tls.ConnectionState) error: 名称不匹配时返回错误，使握手失败。
+func VerifyPeerNames(patterns ...string) func(tls.ConnectionState) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			panic(fmt.Sprintf("geecache: invalid peer name pattern %q: %v", pattern, err))
+		}
+	}
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("geecache: peer presented no certificate")
+		}
+		leaf := cs.PeerCertificates[0]
+		names := append([]string{leaf.Subject.CommonName}, leaf.DNSNames...)
+		for _, pattern := range patterns {
+			for _, name := range names {
+				if ok, _ := path.Match(pattern, name); ok && name != "" {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("geecache: peer certificate %q is not an allowed cluster member", leaf.Subject.CommonName)
+	}
+}
+
+// WithServerTLSConfig 设置 HTTPPool 作为服务端时使用的 TLS 配置，例如 LoadMutualTLS 返回的 server，
+// 由 ListenAndServeTLS 使用。
+//
+// cfg 要求客户端证书时（ClientAuth 为 RequireAnyClientCert 或更严格），ServeHTTP 还会拒绝
+// 没有经过 TLS 或没有出示客户端证书的请求，返回 403，防止 HTTPPool 被误挂到普通的 HTTP 服务器上。
+//
+// 参数:
+//
+//	cfg: 服务端的 TLS 配置，需要包含本节点的证书。
+//
+// 返回值:
+//
+//	PoolOption: 可传递给 NewHTTPPool 的配置项。
+func WithServerTLSConfig(cfg *tls.Config) PoolOption {
+	return func(p *HTTPPool) {
+		p.serverTLS = cfg
+	}
+}
+
+// ListenAndServeTLS 在 addr 上以 WithServerTLSConfig 设置的配置提供 HTTPPool，直到 Shutdown 被调用或服务器出错。
+//
+// 参数:
+//
+//	addr: 监听的地址，例如 ":8443"。
+//
+// 返回值:
+//
+//	error: 没有设置 WithServerTLSConfig 时，或者与 http.Server.ListenAndServeTLS 相同的错误，
+//	       Shutdown 之后返回 http.ErrServerClosed。
+func (h *HTTPPool) ListenAndServeTLS(addr string) error {
+	if h.serverTLS == nil {
+		return errors.New("geecache: ListenAndServeTLS needs WithServerTLSConfig")
+	}
+	srv := h.newServer(addr)
+	if !h.track(srv) {
+		return http.ErrServerClosed
+	}
+	defer h.untrack(srv)
+	return srv.ListenAndServeTLS("", "")
+}
+
+// requireClientCert 在 WithServerTLSConfig 要求客户端证书、而 r 没有出示证书时返回 403 并返回 false。
+func (h *HTTPPool) requireClientCert(w http.ResponseWriter, r *http.Request) bool {
+	if h.serverTLS == nil || h.serverTLS.ClientAuth < tls.RequireAnyClientCert {
+		return true
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return true
+	}
+	h.Log("rejecting %s %s from %s: no client certificate", r.Method, r.URL.Path, r.RemoteAddr)
+	http.Error(w, "client certificate required", http.StatusForbidden)
+	return false
+}
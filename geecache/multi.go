@@ -0,0 +1,304 @@
+package geecache
+
+import (
+	"GeeCache/singleflight"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// KeyErrors 记录 GetMulti 中获取失败的 key 及其错误。
+//
+// 它实现了 error 接口，并支持 errors.Is 和 errors.As 检查其中任意一个错误。
+type KeyErrors map[string]error
+
+// Error 实现了 error 接口，按 key 的字典序列出每个失败的 key。
+func (e KeyErrors) Error() string {
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	fmt.Fprintf(&b, "geecache: %d keys failed", len(e))
+	for _, key := range keys {
+		fmt.Fprintf(&b, "; %s: %v", key, e[key])
+	}
+	return b.String()
+}
+
+// Unwrap 返回所有 key 的错误，供 errors.Is 和 errors.As 使用。
+func (e KeyErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, err := range e {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// BatchGetter 是可以一次查询多个 key 的数据源，例如用一条 WHERE key IN (...) 代替 N 次查询。
+//
+// Group 的 getter 实现了 BatchGetter 时，GetMulti 中由本节点加载的 key 通过一次 GetMulti 调用加载，
+// 其他加载仍然使用 getter 的 Get。返回的 map 中没有的 key 按 ErrNotFound 处理；
+// 返回错误时这次批量加载中的所有 key 都得到这个错误。返回的字节切片之后会被复制。
+type BatchGetter interface {
+	GetMulti(ctx context.Context, keys []string) (map[string][]byte, error)
+}
+
+// asBatchGetter 返回 NewGroup 接收的 getter 实现的 BatchGetter，没有实现时返回 nil。
+func asBatchGetter(loader RichGetter) BatchGetter {
+	var getter any = loader
+	switch a := loader.(type) {
+	case getterAdapter:
+		getter = a.getter
+	case contextGetterAdapter:
+		getter = a.getter
+	}
+	bg, _ := getter.(BatchGetter)
+	return bg
+}
+
+// localBatch 是 GetMulti 通过 BatchGetter 对本节点负责的 key 发起的一次批量加载。
+//
+// 每个 key 的加载仍然由 loader 合并：只有这次 GetMulti 作为 leader 发起的 key 才会放入批量加载，
+// 其他调用者对这些 key 的 Get 共享对应 key 的加载，而这个加载等待批量加载的结果。
+type localBatch struct {
+	getter  BatchGetter
+	keys    []string
+	done    chan struct{}
+	results map[string][]byte
+	err     error
+}
+
+// localBatchKey 是在加载的上下文中保存 localBatch 时使用的 key。
+type localBatchKey struct{}
+
+// localBatchFrom 返回 ctx 中保存的 localBatch，key 不属于批量加载时返回 nil。
+func localBatchFrom(ctx context.Context) *localBatch {
+	b, _ := ctx.Value(localBatchKey{}).(*localBatch)
+	return b
+}
+
+// run 调用 BatchGetter，并在结束时唤醒所有等待结果的加载。
+//
+// 批量加载为所有等待它的 key 进行，因此不随 GetMulti 的 ctx 取消，只受 WithLoadTimeout 的限制；
+// 每个 key 的加载在自己的上下文结束时放弃等待。整个批量加载只占用一个 WithMaxConcurrentLoads 的名额。
+func (b *localBatch) run(ctx context.Context, g *Group) {
+	defer close(b.done)
+	ctx = context.WithoutCancel(ctx)
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+	if b.err = g.acquireLoad(ctx); b.err != nil {
+		return
+	}
+	defer g.releaseLoad()
+	g.stats.batchLoads.Add(1)
+	b.results, b.err = g.callBatchGetter(ctx, b.getter, b.keys)
+}
+
+// wait 等待批量加载结束并返回 key 的数据，ctx 结束时返回 ctx.Err()。
+func (b *localBatch) wait(ctx context.Context, key string) ([]byte, error) {
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	v, ok := b.results[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q not returned by BatchGetter", ErrNotFound, key)
+	}
+	return v, nil
+}
+
+// peerBatch 是 GetMulti 发给同一个远程节点的一次批量请求。
+type peerBatch struct {
+	peer    PeerBatchGetter
+	keys    []string // 由这次 GetMulti 负责加载的 key，不包括共享其他调用者加载结果的 key
+	done    chan struct{}
+	results map[string]PeerResult
+	err     error
+}
+
+// run 发起批量请求，并在结束时唤醒所有等待结果的加载。
+func (b *peerBatch) run(ctx context.Context, group string) {
+	defer close(b.done)
+	results, err := b.peer.GetMulti(ctx, group, b.keys)
+	if err == nil && len(results) != len(b.keys) {
+		err = fmt.Errorf("peer returned %d results for %d keys", len(results), len(b.keys))
+	}
+	if err != nil {
+		b.err = err
+		return
+	}
+	b.results = make(map[string]PeerResult, len(b.keys))
+	for i, key := range b.keys {
+		b.results[key] = results[i]
+	}
+}
+
+// wait 等待批量请求结束并返回 key 的结果，ctx 结束时返回 ctx.Err()。
+func (b *peerBatch) wait(ctx context.Context, key string) (PeerResult, error) {
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return PeerResult{}, ctx.Err()
+	}
+	if b.err != nil {
+		return PeerResult{}, b.err
+	}
+	r := b.results[key]
+	return r, r.Err
+}
+
+// GetMulti 一次获取多个 key 的值。
+//
+// 它先在本地缓存中查找所有 key，再把未命中的 key 按负责它们的远程节点分组；
+// 实现了 PeerBatchGetter 的节点对每组 key 只发起一次批量请求，其余的 key
+// 与 Get 一样逐个加载。远程获取失败的 key 会回退到本地的 getter。
+// 每个 key 的加载同样经过 singleflight 合并：正在被其他调用者加载的 key
+// 不会再放入批量请求，而是共享那次加载的结果。
+// getter 实现了 BatchGetter 时，由本节点加载的 key 也合并为一次 BatchGetter.GetMulti 调用，
+// 远程获取失败之后回退到本地加载的 key 仍然逐个调用 getter。
+//
+// keys 中重复的 key 只会被加载一次，返回的 map 中每个 key 只出现一次。
+// 设置了 WithKeyNormalizer 时，规范化之后相同的 key 同样只加载一次，
+// 返回的 map 和 KeyErrors 仍然使用调用方传入的 key，被拒绝的 key 的错误是 *InvalidKeyError。
+// 单个 key 失败不会影响其他 key，失败的 key 及其错误通过 KeyErrors 返回。
+// 批量请求使用 ctx，因此 ctx 结束时共享这些加载的其他调用者会回退到本地加载。
+//
+// 参数:
+//
+//	ctx: 调用者的上下文。
+//	keys: 要获取的键。
+//
+// 返回值:
+//
+//	map[string]ByteView: 获取成功的 key 及其值。
+//	error: 有 key 获取失败时返回 KeyErrors；Group 已被销毁时返回 ErrGroupDestroyed。
+func (g *Group) GetMulti(ctx context.Context, keys []string) (map[string]ByteView, error) {
+	if g.destroyed.Load() {
+		return nil, ErrGroupDestroyed
+	}
+	if g.normalize != nil {
+		return g.getMultiNormalized(ctx, keys)
+	}
+	return g.getMulti(ctx, keys)
+}
+
+// getMulti 执行 GetMulti，keys 已经规范化，返回的错误只可能是 KeyErrors。
+func (g *Group) getMulti(ctx context.Context, keys []string) (map[string]ByteView, error) {
+	values := make(map[string]ByteView, len(keys))
+	errs := make(KeyErrors)
+	pending := make(map[string]*singleflight.Pending)
+	batches := make(map[PeerGetter]*peerBatch)
+	var local *localBatch
+	if g.batch != nil {
+		local = &localBatch{getter: g.batch, done: make(chan struct{})}
+	}
+
+	for _, key := range keys {
+		if _, ok := values[key]; ok {
+			continue
+		}
+		if _, ok := errs[key]; ok {
+			continue
+		}
+		if _, ok := pending[key]; ok {
+			continue
+		}
+		v, ok, err := g.lookupCache(key)
+		if err != nil {
+			errs[key] = err
+			continue
+		}
+		if ok {
+			values[key] = v
+			continue
+		}
+
+		g.stats.loads.Add(1)
+		var fetch peerFetch
+		var batch *peerBatch
+		if g.peers != nil {
+			if peer, ok := g.peers.PickPeer(key); ok {
+				fetch, batch = g.multiFetch(peer, key, batches)
+			}
+		}
+		var lb *localBatch
+		if fetch == nil {
+			lb = local
+		}
+		p := g.loader.Begin(ctx, key, func(ctx context.Context) (any, error) {
+			if lb != nil {
+				ctx = context.WithValue(ctx, localBatchKey{}, lb)
+			}
+			return g.loadOrStale(ctx, key, fetch)
+		})
+		if p.Leader && batch != nil {
+			batch.keys = append(batch.keys, key)
+		}
+		if p.Leader && lb != nil {
+			lb.keys = append(lb.keys, key)
+		}
+		pending[key] = p
+	}
+
+	for _, b := range batches {
+		if len(b.keys) > 0 {
+			go b.run(ctx, g.name)
+		}
+	}
+	if local != nil && len(local.keys) > 0 {
+		go local.run(ctx, g)
+	}
+	for key, p := range pending {
+		viewi, err := p.Wait()
+		if err != nil {
+			errs[key] = err
+			continue
+		}
+		values[key] = viewi.(ByteView)
+	}
+
+	if len(errs) > 0 {
+		return values, errs
+	}
+	return values, nil
+}
+
+// multiFetch 返回 GetMulti 从 peer 获取 key 的函数。
+//
+// 如果 peer 实现了 PeerBatchGetter，key 会从 batches 中该节点的批量请求里取得结果，
+// 同时返回这个批量请求，由调用方决定是否把 key 加入其中；否则与 Get 一样单独请求。
+// 批量请求失败时不会重试，其中的 key 直接回退到本地加载。
+func (g *Group) multiFetch(peer PeerGetter, key string, batches map[PeerGetter]*peerBatch) (peerFetch, *peerBatch) {
+	bg, ok := peer.(PeerBatchGetter)
+	if !ok {
+		return g.retryFetch(func(ctx context.Context) (ByteView, error) {
+			return g.getFromPeer(ctx, peer, key, false)
+		}), nil
+	}
+	removals := g.removals.load(key)
+	b := batches[peer]
+	if b == nil {
+		b = &peerBatch{peer: bg, done: make(chan struct{})}
+		batches[peer] = b
+	}
+	return func(ctx context.Context) (ByteView, error) {
+		r, err := b.wait(ctx, key)
+		if err != nil {
+			return ByteView{}, err
+		}
+		if r.NoStore {
+			return ByteView{b: r.Value, noStore: true}, nil
+		}
+		return g.acceptFromPeer(ctx, key, r, removals), nil
+	}, b
+}
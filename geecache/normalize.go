@@ -0,0 +1,106 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidKey 表示 key 被 WithKeyNormalizer 设置的函数拒绝。
+// 返回的错误是 *InvalidKeyError，它满足 errors.Is(err, ErrInvalidKey)。
+var ErrInvalidKey = errors.New("geecache: invalid key")
+
+// InvalidKeyError 记录被拒绝的 key 和规范化函数返回的错误。
+type InvalidKeyError struct {
+	Key string // 调用方传入的原始 key
+	Err error  // 规范化函数返回的错误
+}
+
+// Error 实现了 error 接口。
+func (e *InvalidKeyError) Error() string {
+	return fmt.Sprintf("geecache: invalid key %q: %v", e.Key, e.Err)
+}
+
+// Is 使 errors.Is(err, ErrInvalidKey) 成立。
+func (e *InvalidKeyError) Is(target error) bool {
+	return target == ErrInvalidKey
+}
+
+// Unwrap 返回规范化函数返回的错误。
+func (e *InvalidKeyError) Unwrap() error {
+	return e.Err
+}
+
+// WithKeyNormalizer 设置 key 的规范化函数，使只在大小写或首尾空白上不同的 key 共享同一个缓存条目。
+//
+// Get、GetContext、GetMulti、GetFresh、GetCached、Set、SetIfVersion、Put、PutBack、Remove、
+// RemoveLocal、Touch 和 Preload 在做其他任何事之前先规范化 key，因此缓存、一致性哈希环
+// 和节点之间的请求看到的都是规范化之后的 key，getter 和 Setter 收到的也是它。
+// HTTPPool 在处理其他节点的请求时同样会规范化 key，集群中的节点应当使用相同的规范化函数，
+// 否则它们对同一个 key 的拥有者可能会有不同的判断。
+//
+// fn 必须是幂等的：对规范化之后的 key 再次调用应当返回它本身。
+// fn 返回错误时（例如去掉空白之后 key 为空），调用返回 *InvalidKeyError，不会查找缓存或加载。
+//
+// 参数:
+//
+//	fn: 返回 key 的规范形式的函数，会被并发调用。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithKeyNormalizer(fn func(key string) (string, error)) GroupOption {
+	return func(g *Group) {
+		g.normalize = fn
+	}
+}
+
+// canonicalKey 返回 key 的规范形式，没有设置 WithKeyNormalizer 时原样返回 key。
+func (g *Group) canonicalKey(key string) (string, error) {
+	if g.normalize == nil {
+		return key, nil
+	}
+	canonical, err := g.normalize(key)
+	if err != nil {
+		return "", &InvalidKeyError{Key: key, Err: err}
+	}
+	return canonical, nil
+}
+
+// getMultiNormalized 在设置了 WithKeyNormalizer 时执行 GetMulti：规范化之后相同的 key 只加载一次，
+// 返回的值和错误仍然按调用方传入的 key 索引。
+func (g *Group) getMultiNormalized(ctx context.Context, keys []string) (map[string]ByteView, error) {
+	canonical := make(map[string]string, len(keys))
+	errs := make(KeyErrors)
+	unique := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if _, ok := canonical[key]; ok {
+			continue
+		}
+		if _, ok := errs[key]; ok {
+			continue
+		}
+		c, err := g.canonicalKey(key)
+		if err != nil {
+			errs[key] = err
+			continue
+		}
+		canonical[key] = c
+		unique = append(unique, c)
+	}
+
+	loaded, err := g.getMulti(ctx, unique)
+	loadErrs, _ := err.(KeyErrors)
+	values := make(map[string]ByteView, len(canonical))
+	for key, c := range canonical {
+		if v, ok := loaded[c]; ok {
+			values[key] = v
+		} else if err, ok := loadErrs[c]; ok {
+			errs[key] = err
+		}
+	}
+	if len(errs) > 0 {
+		return values, errs
+	}
+	return values, nil
+}
@@ -0,0 +1,58 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrPeerBusy 表示发往远程节点的请求已经达到 HTTPPoolOptions.MaxPeerRequests 的上限，
+// 并且设置了 PeerBusyFailFast，请求没有发出就失败了。它不会被重试，Group 回退到下一个拥有者或本地加载。
+var ErrPeerBusy = errors.New("geecache: too many in-flight requests to peer")
+
+// begin 在向节点发出获取请求之前占用一个并发名额并询问熔断器。
+// 名额已满时按 PeerBusyFailFast 立即返回 ErrPeerBusy 或者等待空出的名额，等待遵守 ctx；
+// 成功时返回的 end 必须在请求结束之后调用一次。
+func (h *httpGetter) begin(ctx context.Context) (end func(), err error) {
+	if h.sem != nil {
+		select {
+		case h.sem <- struct{}{}:
+		default:
+			if h.failFast {
+				return nil, ErrPeerBusy
+			}
+			select {
+			case h.sem <- struct{}{}:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+	if err := h.breaker.allow(); err != nil {
+		if h.sem != nil {
+			<-h.sem
+		}
+		return nil, err
+	}
+	h.inFlight.Add(1)
+	return func() {
+		h.inFlight.Add(-1)
+		if h.sem != nil {
+			<-h.sem
+		}
+	}, nil
+}
+
+// releaseBody 在响应体第一次被关闭时调用 end，让 GetStream 的请求在调用方读完响应体之前一直占用名额。
+type releaseBody struct {
+	io.ReadCloser
+	once sync.Once
+	end  func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.end)
+	return err
+}
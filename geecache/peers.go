@@ -1,14 +1,125 @@
 package geecache
 
+import (
+	"context"
+	"io"
+	"time"
+)
+
 // PeerPicker is the interface that must be implemented to locate
 // the peer that owns a specific key.
 type PeerPicker interface {
 	PickPeer(key string) (peer PeerGetter, ok bool)
 }
 
+// PeerListPicker is an optional interface a PeerPicker may implement to
+// return the successive owners of a key, so that a load can fall back to
+// the next owner when the first one is down. PickPeers returns up to n
+// distinct peers in preference order, stopping before the local node: an
+// empty result means the key is owned by this node.
+type PeerListPicker interface {
+	PickPeers(key string, n int) []PeerGetter
+}
+
 // PeerGetter is the interface that must be implemented by a peer.
+// Get must abort the request to the owner once ctx is done. The owner
+// serves the request with the inbound request's context, so a caller
+// giving up also cancels a slow ContextGetter on the owner.
+// The returned slice belongs to the caller: implementations must not
+// reuse or modify it afterwards, since it may be cached without a copy.
+// The same applies to the values returned by the optional interfaces below.
 type PeerGetter interface {
-	Get(group string, key string) ([]byte, error)
+	Get(ctx context.Context, group string, key string) ([]byte, error)
 }
 
+// PeerTTLGetter is an optional interface a PeerGetter may implement to
+// report how long the returned value has left to live on its owner.
+// A ttl of zero means the owner did not report one.
+type PeerTTLGetter interface {
+	GetTTL(ctx context.Context, group string, key string) (value []byte, ttl time.Duration, err error)
+}
 
+// PeerResultGetter is an optional interface a PeerGetter may implement to
+// report, besides the remaining lifetime, the version the owner assigned to
+// the value and whether it may be cached. The Err field of the result is
+// ignored: failures are returned as err. Owners usually produce the result
+// with Group.ServePeer.
+type PeerResultGetter interface {
+	GetResult(ctx context.Context, group string, key string) (PeerResult, error)
+}
+
+// PeerResult is the outcome for one key of a batched peer request, or of a
+// single request made through PeerResultGetter.
+type PeerResult struct {
+	Value   []byte
+	TTL     time.Duration // remaining lifetime on the owner, zero if not reported
+	NoStore bool          // the owner asked for the value not to be cached
+	Version uint64        // version the owner assigned to the value, zero if not reported
+	Err     error
+}
+
+// PeerBatchGetter is an optional interface a PeerGetter may implement to
+// fetch several keys of a group in a single request. The results must be
+// in the same order as keys. Implementations should be comparable (usually
+// a pointer) so that keys owned by the same peer can be grouped together.
+type PeerBatchGetter interface {
+	GetMulti(ctx context.Context, group string, keys []string) ([]PeerResult, error)
+}
+
+// PeerSetter is an optional interface a PeerGetter may implement to
+// store a value directly in the caches of its owner. Like Get, the write
+// methods below must abort the request to the owner once ctx is done.
+type PeerSetter interface {
+	Set(ctx context.Context, group string, key string, value []byte, ttl time.Duration) error
+}
+
+// PeerRemover is an optional interface a PeerGetter may implement to
+// drop a key from the caches of its owner.
+type PeerRemover interface {
+	Remove(ctx context.Context, group string, key string) error
+}
+
+// PeerToucher is an optional interface a PeerGetter may implement to
+// refresh the recency of a key on its owner without transferring the value.
+type PeerToucher interface {
+	Touch(ctx context.Context, group string, key string) (bool, error)
+}
+
+// PeerCacheChecker is an optional interface a PeerGetter may implement to
+// ask its owner whether it currently caches a key, without triggering a
+// load there. ok is false when the owner does not hold the key.
+type PeerCacheChecker interface {
+	GetCached(ctx context.Context, group string, key string) (value []byte, ok bool, err error)
+}
+
+// PeerRefresher is an optional interface a PeerGetter may implement to
+// make its owner reload a key from the data source, bypassing the copy it
+// caches. The owner stores the reloaded value before returning it.
+type PeerRefresher interface {
+	GetFresh(ctx context.Context, group string, key string) (value []byte, ttl time.Duration, err error)
+}
+
+// PeerRevalidator is an optional interface a PeerGetter may implement to
+// check with its owner whether a copy the caller already holds is still
+// current. etag identifies the caller's copy. When it still matches the
+// owner's value, modified is false and the result carries only the TTL,
+// version and NoStore reported by the owner, not the value itself.
+type PeerRevalidator interface {
+	Revalidate(ctx context.Context, group string, key string, etag string) (r PeerResult, modified bool, err error)
+}
+
+// PeerGetterStream is an optional interface a PeerGetter may implement to
+// hand a value over as a stream instead of one slice, so that large values
+// are not buffered in memory before reaching the caller. size is the length
+// of the value, or -1 when it is not known in advance. The caller must close
+// body; a body that ends before size bytes returns io.ErrUnexpectedEOF.
+type PeerGetterStream interface {
+	GetStream(ctx context.Context, group string, key string) (body io.ReadCloser, size int64, err error)
+}
+
+// PeerVersionSetter is an optional interface a PeerGetter may implement to
+// store a value on its owner only if the owner's copy still has the
+// expected version. It returns ErrVersionMismatch when it does not.
+type PeerVersionSetter interface {
+	SetIfVersion(ctx context.Context, group string, key string, value []byte, expected uint64) (version uint64, err error)
+}
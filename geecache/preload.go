@@ -0,0 +1,176 @@
+package geecache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// PreloadOption 是 Preload 的配置项。
+type PreloadOption func(*preloadConfig)
+
+// preloadConfig 记录一次 Preload 的配置。
+type preloadConfig struct {
+	push     bool
+	progress func(key string, err error)
+}
+
+// WithPreloadPush 让 Preload 在本地加载属于远程节点的 key，并通过 PeerSetter 写入拥有者节点，
+// 而不是跳过这些 key。
+//
+// 返回值:
+//
+//	PreloadOption: 可传递给 Preload 的配置项。
+func WithPreloadPush() PreloadOption {
+	return func(c *preloadConfig) {
+		c.push = true
+	}
+}
+
+// WithPreloadProgress 设置 Preload 每处理完一个 key 时调用的回调函数。
+//
+// 参数:
+//
+//	fn: 接收 key 及其加载结果的回调函数，err 为 nil 表示成功。
+//	    fn 会被串行调用，不需要自己加锁；被跳过的 key 不会回调 fn。
+//
+// 返回值:
+//
+//	PreloadOption: 可传递给 Preload 的配置项。
+func WithPreloadProgress(fn func(key string, err error)) PreloadOption {
+	return func(c *preloadConfig) {
+		c.progress = fn
+	}
+}
+
+// Preload 预先加载一组 key，例如在部署之后加载访问最多的 key，避免第一波请求同时压向数据源。
+//
+// 最多 concurrency 个 key 同时加载，已经缓存的 key 不会重新加载。与 Get 一样，
+// 加载经过 singleflight 合并；加载到的值以“冷”方式写入缓存，在被读取之前不会挤占热点数据。
+// 注册了节点时，属于远程节点的 key 默认被跳过，使用 WithPreloadPush 时则在本地加载之后
+// 通过 Set 写入拥有者节点。
+//
+// 参数:
+//
+//	ctx: 预热使用的上下文，结束时不再开始新的加载。
+//	keys: 要预热的键，重复的 key 只会加载一次。
+//	concurrency: 同时加载的 key 的最大数量，小于 1 时按 1 处理。
+//	opts: 预热的配置项。
+//
+// 返回值:
+//
+//	error: 有 key 加载失败时返回 KeyErrors；ctx 在所有 key 处理完之前结束时返回 ctx.Err()；
+//	Group 已被销毁时返回 ErrGroupDestroyed。
+func (g *Group) Preload(ctx context.Context, keys []string, concurrency int, opts ...PreloadOption) error {
+	if g.destroyed.Load() {
+		return ErrGroupDestroyed
+	}
+	var cfg preloadConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var mu sync.Mutex
+	errs := make(KeyErrors)
+	report := func(key string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs[key] = err
+		}
+		if cfg.progress != nil {
+			cfg.progress(key, err)
+		}
+	}
+
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range work {
+				if skipped, err := g.preloadKey(ctx, key, cfg.push); !skipped {
+					report(key, err)
+				}
+			}
+		}()
+	}
+
+	seen := make(map[string]bool, len(keys))
+feed:
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		select {
+		case work <- key:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// preloadKey 预热一个 key，并返回它是否因为属于远程节点或不可缓存而被跳过。
+func (g *Group) preloadKey(ctx context.Context, key string, push bool) (skipped bool, err error) {
+	if key, err = g.canonicalKey(key); err != nil {
+		return false, err
+	}
+	if !g.cacheable(key) {
+		return true, nil
+	}
+	if g.peers != nil {
+		if _, ok := g.peers.PickPeer(key); ok {
+			if !push {
+				return true, nil
+			}
+			value, err := g.fetchLocally(ctx, key)
+			if err != nil || value.noStore {
+				return false, err
+			}
+			var ttl time.Duration
+			if !value.expire.IsZero() {
+				ttl = max(value.expire.Sub(now()), time.Nanosecond)
+			}
+			return false, g.SetContext(ctx, key, value.b, ttl)
+		}
+	}
+	if _, ok := g.maincache.peek(key); ok {
+		return false, nil
+	}
+	_, err = g.loader.DoContext(ctx, key, func(ctx context.Context) (any, error) {
+		g.stats.loadsDeduped.Add(1)
+		return g.warmLocally(ctx, key)
+	})
+	return false, err
+}
+
+// warmLocally 与 getLocally 相同，但以“冷”方式把值写入缓存。
+func (g *Group) warmLocally(ctx context.Context, key string) (value ByteView, err error) {
+	removals := g.removals.load(key)
+	value, err = g.fetchLocally(ctx, key)
+	if g.removals.load(key) != removals {
+		// 加载期间发生过删除，结果可能已经过时，不写入缓存
+		return value, err
+	}
+	if err != nil {
+		g.populateNegative(ctx, key, err)
+		return ByteView{}, err
+	}
+	g.populateCacheCold(key, value)
+	return value, nil
+}
@@ -0,0 +1,244 @@
+// Package prometheus 以 Prometheus 的格式导出 geecache 的指标。
+//
+// 它是一个独立的模块，只有导入它的程序才会依赖 Prometheus 的客户端库：
+//
+//	c := prometheus.New()
+//	geecache.SetMetricsCollector(c)
+//	if err := c.Register(nil); err != nil {
+//		log.Fatal(err)
+//	}
+//
+// Collector 同时实现了 geecache.MetricsCollector 和 prometheus.Collector：
+// Get、命中、加载耗时和节点之间的请求通过 MetricsCollector 的回调计数，
+// 缓存的字节数、条目数、淘汰数和未命中数在每次抓取时从 Registry 中的 Group 重新收集。
+package prometheus
+
+import (
+	"GeeCache/geecache"
+	"errors"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// namespace 是所有指标名称的前缀。
+const namespace = "geecache"
+
+// tiers 是每次抓取时收集的缓存层级。
+var tiers = []string{geecache.TierMain, geecache.TierHot, geecache.TierNegative}
+
+// Option 是 New 的配置项。
+type Option func(*Collector)
+
+// WithRegistry 设置抓取时收集缓存统计信息的 Registry，默认使用 geecache 包级别的 Registry。
+//
+// 参数:
+//
+//	r: 收集的 Registry。
+//
+// 返回值:
+//
+//	Option: 可传递给 New 的配置项。
+func WithRegistry(r *geecache.Registry) Option {
+	return func(c *Collector) {
+		c.registry = r
+	}
+}
+
+// WithBuckets 设置加载耗时和节点请求耗时的直方图使用的桶，单位为秒，默认使用 prometheus.DefBuckets。
+//
+// 参数:
+//
+//	buckets: 按升序排列的桶的上界。
+//
+// 返回值:
+//
+//	Option: 可传递给 New 的配置项。
+func WithBuckets(buckets []float64) Option {
+	return func(c *Collector) {
+		c.buckets = buckets
+	}
+}
+
+// Collector 实现了 geecache.MetricsCollector、geecache.PeerRequestObserver 和 prometheus.Collector。
+type Collector struct {
+	registry *geecache.Registry // 为 nil 时收集包级别的 Registry
+	buckets  []float64
+
+	gets           *prom.CounterVec
+	hits           *prom.CounterVec
+	loadDuration   *prom.HistogramVec
+	peerErrors     *prom.CounterVec
+	peerRequests   *prom.HistogramVec
+	serverRequests *prom.CounterVec
+
+	misses       *prom.Desc
+	cacheBytes   *prom.Desc
+	cacheEntries *prom.Desc
+	evictions    *prom.Desc
+}
+
+// New 创建一个 Collector。
+//
+// 参数:
+//
+//	opts: 可选的配置项。
+//
+// 返回值:
+//
+//	*Collector: 一个指向新创建的 Collector 实例的指针，可传递给 geecache.SetMetricsCollector 或 geecache.WithMetrics，
+//	并通过 Register 注册到 Prometheus。
+func New(opts ...Option) *Collector {
+	c := &Collector{buckets: prom.DefBuckets}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.gets = prom.NewCounterVec(prom.CounterOpts{
+		Namespace: namespace,
+		Name:      "gets_total",
+		Help:      "Number of Get calls.",
+	}, []string{"group"})
+	c.hits = prom.NewCounterVec(prom.CounterOpts{
+		Namespace: namespace,
+		Name:      "hits_total",
+		Help:      "Number of Get calls served from a cache tier.",
+	}, []string{"group", "tier"})
+	c.loadDuration = prom.NewHistogramVec(prom.HistogramOpts{
+		Namespace: namespace,
+		Name:      "load_duration_seconds",
+		Help:      "Duration of loads by source (local getter or remote peer).",
+		Buckets:   c.buckets,
+	}, []string{"group", "source"})
+	c.peerErrors = prom.NewCounterVec(prom.CounterOpts{
+		Namespace: namespace,
+		Name:      "peer_errors_total",
+		Help:      "Number of failed requests to a peer.",
+	}, []string{"peer"})
+	c.peerRequests = prom.NewHistogramVec(prom.HistogramOpts{
+		Namespace: namespace,
+		Name:      "peer_request_duration_seconds",
+		Help:      "Duration of requests to a peer, including failed ones.",
+		Buckets:   c.buckets,
+	}, []string{"peer"})
+	c.serverRequests = prom.NewCounterVec(prom.CounterOpts{
+		Namespace: namespace,
+		Name:      "server_requests_total",
+		Help:      "Number of requests received from other peers.",
+	}, []string{"group"})
+
+	c.misses = prom.NewDesc(prom.BuildFQName(namespace, "", "misses_total"),
+		"Number of Get calls that missed every cache tier and needed a load.", []string{"group"}, nil)
+	c.cacheBytes = prom.NewDesc(prom.BuildFQName(namespace, "", "cache_bytes"),
+		"Bytes currently held by a cache tier.", []string{"group", "tier"}, nil)
+	c.cacheEntries = prom.NewDesc(prom.BuildFQName(namespace, "", "cache_entries"),
+		"Entries currently held by a cache tier.", []string{"group", "tier"}, nil)
+	c.evictions = prom.NewDesc(prom.BuildFQName(namespace, "", "evictions_total"),
+		"Entries evicted from a cache tier because of its capacity.", []string{"group", "tier"}, nil)
+	return c
+}
+
+// Register 把 c 注册到 reg，c 已经注册过时不返回错误，因此可以放心地多次调用。
+//
+// 参数:
+//
+//	reg: 注册 c 的 Registerer，为 nil 时使用 prometheus.DefaultRegisterer。
+//
+// 返回值:
+//
+//	error: reg 中已经注册了另一个导出相同指标的 Collector 时返回 prometheus.AlreadyRegisteredError。
+func (c *Collector) Register(reg prom.Registerer) error {
+	if reg == nil {
+		reg = prom.DefaultRegisterer
+	}
+	err := reg.Register(c)
+	var are prom.AlreadyRegisteredError
+	if errors.As(err, &are) && are.ExistingCollector == c {
+		return nil
+	}
+	return err
+}
+
+// IncGet 实现了 geecache.MetricsCollector 接口。
+func (c *Collector) IncGet(group string) {
+	c.gets.WithLabelValues(group).Inc()
+}
+
+// IncHit 实现了 geecache.MetricsCollector 接口。
+func (c *Collector) IncHit(group, tier string) {
+	c.hits.WithLabelValues(group, tier).Inc()
+}
+
+// ObserveLoadDuration 实现了 geecache.MetricsCollector 接口。
+func (c *Collector) ObserveLoadDuration(group string, source string, d time.Duration) {
+	c.loadDuration.WithLabelValues(group, source).Observe(d.Seconds())
+}
+
+// IncPeerError 实现了 geecache.MetricsCollector 接口。
+func (c *Collector) IncPeerError(peer string) {
+	c.peerErrors.WithLabelValues(peer).Inc()
+}
+
+// IncServerRequest 实现了 geecache.MetricsCollector 接口。
+func (c *Collector) IncServerRequest(group string) {
+	c.serverRequests.WithLabelValues(group).Inc()
+}
+
+// ObservePeerRequest 实现了 geecache.PeerRequestObserver 接口。
+func (c *Collector) ObservePeerRequest(peer string, d time.Duration, err error) {
+	c.peerRequests.WithLabelValues(peer).Observe(d.Seconds())
+}
+
+// Describe 实现了 prometheus.Collector 接口。
+func (c *Collector) Describe(ch chan<- *prom.Desc) {
+	c.gets.Describe(ch)
+	c.hits.Describe(ch)
+	c.loadDuration.Describe(ch)
+	c.peerErrors.Describe(ch)
+	c.peerRequests.Describe(ch)
+	c.serverRequests.Describe(ch)
+	ch <- c.misses
+	ch <- c.cacheBytes
+	ch <- c.cacheEntries
+	ch <- c.evictions
+}
+
+// Collect 实现了 prometheus.Collector 接口，回调计数的指标之外，还从 Registry 中的每个 Group 收集缓存的统计信息。
+func (c *Collector) Collect(ch chan<- prom.Metric) {
+	c.gets.Collect(ch)
+	c.hits.Collect(ch)
+	c.loadDuration.Collect(ch)
+	c.peerErrors.Collect(ch)
+	c.peerRequests.Collect(ch)
+	c.serverRequests.Collect(ch)
+
+	for _, name := range c.listGroups() {
+		g := c.getGroup(name)
+		if g == nil {
+			// 在 ListGroups 之后被销毁
+			continue
+		}
+		ch <- prom.MustNewConstMetric(c.misses, prom.CounterValue, float64(g.Stats().Loads), name)
+		s := g.CacheStats()
+		for i, t := range []geecache.TierStats{s.Main, s.Hot, s.Negative} {
+			ch <- prom.MustNewConstMetric(c.cacheBytes, prom.GaugeValue, float64(t.Bytes), name, tiers[i])
+			ch <- prom.MustNewConstMetric(c.cacheEntries, prom.GaugeValue, float64(t.Entries), name, tiers[i])
+			ch <- prom.MustNewConstMetric(c.evictions, prom.CounterValue, float64(t.Evictions), name, tiers[i])
+		}
+	}
+}
+
+// listGroups 返回收集的 Registry 中所有 Group 的名称。
+func (c *Collector) listGroups() []string {
+	if c.registry == nil {
+		return geecache.ListGroups()
+	}
+	return c.registry.ListGroups()
+}
+
+// getGroup 返回收集的 Registry 中名为 name 的 Group。
+func (c *Collector) getGroup(name string) *geecache.Group {
+	if c.registry == nil {
+		return geecache.GetGroup(name)
+	}
+	return c.registry.GetGroup(name)
+}
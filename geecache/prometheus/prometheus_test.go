@@ -0,0 +1,138 @@
+package prometheus
+
+import (
+	"GeeCache/geecache"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollectorAfterTraffic(t *testing.T) {
+	c := New(WithRegistry(geecache.NewRegistry()))
+	reg := prom.NewPedanticRegistry()
+	if err := c.Register(reg); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if err := c.Register(reg); err != nil {
+		t.Fatalf("second register: %v", err)
+	}
+	if err := New().Register(reg); err == nil {
+		t.Fatal("registering a second Collector with the same metrics succeeded")
+	}
+
+	// 两个节点在同一个进程中：发往 prom-owner 节点的请求由 prom-local 改写为 prom-owner
+	r := c.registry
+	r.NewGroup("prom-owner", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "broken" {
+				return nil, errors.New("database down")
+			}
+			return []byte(key), nil
+		}), geecache.WithMetrics(c))
+	local := r.NewGroup("prom-local", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s should come from the owner", key)
+		}), geecache.WithMetrics(c), geecache.WithHotCacheRate(0))
+
+	owner := geecache.NewHTTPPool("owner", geecache.WithRegistry(r))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.URL.Path = strings.Replace(req.URL.Path, "/prom-local/", "/prom-owner/", 1)
+		owner.ServeHTTP(w, req)
+	}))
+	defer srv.Close()
+	pool := geecache.NewHTTPPool("local")
+	pool.Set(srv.URL)
+	local.RegisterPeers(pool)
+
+	for range 2 {
+		if v, err := local.Get("Tom"); err != nil || v.String() != "Tom" {
+			t.Fatalf("get: %q %v", v, err)
+		}
+	}
+	// 拥有者的数据源故障时返回 503，请求方重试两次之后回退到本地加载
+	if _, err := local.Get("broken"); err == nil {
+		t.Fatal("get broken: want error")
+	}
+
+	peer := srv.URL + "/_geecache/"
+	want := fmt.Sprintf(`
+# HELP geecache_gets_total Number of Get calls.
+# TYPE geecache_gets_total counter
+geecache_gets_total{group="prom-local"} 3
+# HELP geecache_misses_total Number of Get calls that missed every cache tier and needed a load.
+# TYPE geecache_misses_total counter
+geecache_misses_total{group="prom-local"} 3
+geecache_misses_total{group="prom-owner"} 0
+# HELP geecache_peer_errors_total Number of failed requests to a peer.
+# TYPE geecache_peer_errors_total counter
+geecache_peer_errors_total{peer=%q} 3
+# HELP geecache_server_requests_total Number of requests received from other peers.
+# TYPE geecache_server_requests_total counter
+geecache_server_requests_total{group="prom-owner"} 5
+# HELP geecache_cache_entries Entries currently held by a cache tier.
+# TYPE geecache_cache_entries gauge
+geecache_cache_entries{group="prom-local",tier="hot"} 0
+geecache_cache_entries{group="prom-local",tier="main"} 0
+geecache_cache_entries{group="prom-local",tier="negative"} 0
+geecache_cache_entries{group="prom-owner",tier="hot"} 0
+geecache_cache_entries{group="prom-owner",tier="main"} 1
+geecache_cache_entries{group="prom-owner",tier="negative"} 0
+`, peer)
+	names := []string{"geecache_gets_total", "geecache_misses_total", "geecache_peer_errors_total",
+		"geecache_server_requests_total", "geecache_cache_entries"}
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), names...); err != nil {
+		t.Error(err)
+	}
+	if n := sampleCount(t, reg, "geecache_peer_request_duration_seconds", "peer", peer); n != 5 {
+		t.Errorf("peer requests: %d, want 5", n)
+	}
+	for _, c := range []struct {
+		group, source string
+		want          uint64
+	}{
+		{"prom-local", geecache.SourcePeer, 2},
+		{"prom-local", geecache.SourceLocal, 1},
+		{"prom-owner", geecache.SourceLocal, 4},
+	} {
+		if n := sampleCount(t, reg, "geecache_load_duration_seconds", "group", c.group, "source", c.source); n != c.want {
+			t.Errorf("loads of %s from %s: %d, want %d", c.group, c.source, n, c.want)
+		}
+	}
+	if problems, err := testutil.GatherAndLint(reg); err != nil || len(problems) > 0 {
+		t.Errorf("lint: %v %v", problems, err)
+	}
+}
+
+// sampleCount 返回 reg 中名为 name、带有 labels 中的全部标签的直方图的样本数量。
+func sampleCount(t *testing.T, reg prom.Gatherer, name string, labels ...string) uint64 {
+	t.Helper()
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range mf.GetMetric() {
+			pairs := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				pairs[l.GetName()] = l.GetValue()
+			}
+			for i := 0; i < len(labels); i += 2 {
+				if pairs[labels[i]] != labels[i+1] {
+					continue metrics
+				}
+			}
+			return m.GetHistogram().GetSampleCount()
+		}
+	}
+	return 0
+}
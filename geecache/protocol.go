@@ -0,0 +1,115 @@
+package geecache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// protoHeader 携带节点之间的协议版本。httpGetter 在每个请求中发送自己的版本，
+	// ServeHTTP 在响应中返回双方共同支持的版本，即两者中较小的一个。
+	protoHeader = "X-GeeCache-Proto"
+	// versionPath 是协议版本探测接口相对于 basePath 的路径，见 serveVersion。
+	versionPath = "-/version"
+
+	// protoV1 是没有协议版本的旧节点使用的基线：值以原始字节和头部返回，没有批量请求。
+	protoV1 = 1
+	// protoV2 增加了以 GetResponse 编码的响应和 op=getmulti 的批量请求。
+	protoV2 = 2
+	// protoVersion 是本节点支持的最高协议版本。
+	protoVersion = protoV2
+)
+
+// versionInfo 是协议版本探测接口的响应体。
+type versionInfo struct {
+	Proto int `json:"proto"`
+}
+
+// commonProto 返回对方的版本 v 和本节点共同支持的版本，更高的未知版本按本节点的版本处理。
+func commonProto(v int) int {
+	return max(min(v, protoVersion), protoV1)
+}
+
+// negotiateProto 检查请求携带的 protoHeader，并在响应中返回共同支持的版本。
+// 没有携带时请求来自旧版本的节点，不返回头部；头部不是正整数时以 400 拒绝请求，返回值报告请求能否继续处理。
+func negotiateProto(w http.ResponseWriter, r *http.Request) bool {
+	s := r.Header.Get(protoHeader)
+	if s == "" {
+		return true
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || v < protoV1 {
+		http.Error(w, "bad "+protoHeader+" header: "+s, http.StatusBadRequest)
+		return false
+	}
+	w.Header().Set(protoHeader, strconv.Itoa(commonProto(v)))
+	return true
+}
+
+// serveVersion 以 JSON 返回本节点支持的最高协议版本，旧版本的节点没有这个接口，对它返回 404。
+func (h *HTTPPool) serveVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versionInfo{Proto: protoVersion})
+}
+
+// batchRejected 报告批量请求的错误 err 是否可能是因为远程节点不认识 op=getmulti。
+func batchRejected(err error) bool {
+	var se *statusError
+	if !errors.As(err, &se) {
+		return false
+	}
+	switch se.code {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	}
+	return false
+}
+
+// probeProto 请求远程节点的协议版本探测接口，并把结果缓存在 httpGetter 中。
+// 返回 404、400 或 405 的节点是没有这个接口的旧版本节点；其他失败不缓存结果，返回 0。
+func (h *httpGetter) probeProto(ctx context.Context) int {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.baseURL+versionPath, nil)
+	if err != nil {
+		return 0
+	}
+	rsp, err := h.do(req)
+	if err != nil {
+		return 0
+	}
+	defer rsp.Body.Close()
+	v := protoV1
+	switch rsp.StatusCode {
+	case http.StatusOK:
+		var info versionInfo
+		if err := json.NewDecoder(rsp.Body).Decode(&info); err != nil {
+			return 0
+		}
+		v = commonProto(info.Proto)
+	case http.StatusNotFound, http.StatusBadRequest, http.StatusMethodNotAllowed:
+	default:
+		return 0
+	}
+	h.proto.Store(int32(v))
+	return v
+}
+
+// learnProto 按响应 rsp 中的 protoHeader 更新缓存的协议版本。没有这个头部的响应不改变缓存，
+// 它可能来自旧版本的节点，也可能来自代理等中间节点。
+func (h *httpGetter) learnProto(rsp *http.Response) {
+	s := rsp.Header.Get(protoHeader)
+	if s == "" {
+		return
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(s)); err == nil {
+		h.proto.Store(int32(commonProto(n)))
+	}
+}
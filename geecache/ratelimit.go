@@ -0,0 +1,208 @@
+package geecache
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// maxClientBuckets 是 WithClientRateLimit 记录的远程地址数量的上限。达到上限时丢弃已经补满、没有在使用的令牌桶，
+	// 仍然没有空位时随机丢弃一个，被丢弃的地址下一次请求时得到装满的令牌桶。
+	maxClientBuckets = 10000
+	// clientSweepInterval 是两次查找补满的令牌桶之间的最短间隔，间隔之内达到上限时直接随机丢弃一个令牌桶。
+	clientSweepInterval = time.Second
+)
+
+// tokenBucket 是一个令牌桶：每秒补充 rate 个令牌，最多积累 burst 个，每个请求消耗一个。
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time // 上一次补充令牌的时间
+}
+
+// newTokenBucket 返回一个装满令牌的 tokenBucket，burst 小于 1 时为 1。
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	b := float64(max(burst, 1))
+	return &tokenBucket{rate: rate, burst: b, tokens: b, last: now()}
+}
+
+// take 在 t 时刻取走一个令牌，没有令牌时返回 false 和下一个令牌补充之前需要等待的时间。
+func (b *tokenBucket) take(t time.Time) (ok bool, wait time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if elapsed := t.Sub(b.last); elapsed > 0 {
+		b.tokens = min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = t
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// full 报告令牌桶在 t 时刻是否已经补满，补满的令牌桶与新建的没有区别，可以丢弃。
+func (b *tokenBucket) full(t time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens+t.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+// clientLimiter 按远程地址分别限制请求速率，见 WithClientRateLimit。
+type clientLimiter struct {
+	rate  float64
+	burst int
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time // 上一次查找补满的令牌桶的时间
+}
+
+// take 为来自 addr 的请求取走一个令牌，见 tokenBucket.take。
+func (c *clientLimiter) take(addr string, t time.Time) (bool, time.Duration) {
+	c.mu.Lock()
+	b := c.buckets[addr]
+	if b == nil {
+		if len(c.buckets) >= maxClientBuckets {
+			c.evict(t)
+		}
+		b = newTokenBucket(c.rate, c.burst)
+		c.buckets[addr] = b
+	}
+	c.mu.Unlock()
+	return b.take(t)
+}
+
+// evict 为新的地址腾出至少一个位置，调用时必须持有 c.mu。
+//
+// 距离上一次查找超过 clientSweepInterval 时丢弃所有补满的令牌桶，
+// 否则或者没有补满的令牌桶时，丢弃 map 遍历到的第一个令牌桶，也就是随机的一个。
+func (c *clientLimiter) evict(t time.Time) {
+	if t.Sub(c.lastSweep) >= clientSweepInterval {
+		c.lastSweep = t
+		for a, idle := range c.buckets {
+			if idle.full(t) {
+				delete(c.buckets, a)
+			}
+		}
+	}
+	for a := range c.buckets {
+		if len(c.buckets) < maxClientBuckets {
+			break
+		}
+		delete(c.buckets, a)
+	}
+}
+
+// WithRateLimit 限制 HTTPPool 每秒处理的请求数量，见 SetRateLimit。
+//
+// 参数:
+//
+//	rps: 每秒允许的请求数量，小于等于 0 时不限制。
+//	burst: 短时间内允许超出 rps 的请求数量，小于 1 时为 1。
+//
+// 返回值:
+//
+//	PoolOption: 可传递给 NewHTTPPool 的配置项。
+func WithRateLimit(rps float64, burst int) PoolOption {
+	return func(p *HTTPPool) {
+		p.SetRateLimit(rps, burst)
+	}
+}
+
+// WithClientRateLimit 限制 HTTPPool 每秒处理的来自每个远程地址的请求数量，见 SetClientRateLimit。
+//
+// 参数:
+//
+//	rps: 每个远程地址每秒允许的请求数量，小于等于 0 时不限制。
+//	burst: 每个远程地址短时间内允许超出 rps 的请求数量，小于 1 时为 1。
+//
+// 返回值:
+//
+//	PoolOption: 可传递给 NewHTTPPool 的配置项。
+func WithClientRateLimit(rps float64, burst int) PoolOption {
+	return func(p *HTTPPool) {
+		p.SetClientRateLimit(rps, burst)
+	}
+}
+
+// SetRateLimit 设置 HTTPPool 每秒处理的请求数量的上限，可以在运行时调用，例如在故障期间临时收紧。
+//
+// 限制以令牌桶实现，超过限制的请求在访问任何 Group 之前以 429 拒绝，Retry-After 给出下一个令牌补充之前
+// 需要等待的秒数，这些请求不计入 PoolStats.Requests，而是计入 PoolStats.Throttled。
+// 健康检查接口不受限制。每次调用都会用装满的令牌桶替换原来的限制。
+//
+// 参数:
+//
+//	rps: 每秒允许的请求数量，小于等于 0 时取消限制。
+//	burst: 短时间内允许超出 rps 的请求数量，小于 1 时为 1。
+func (h *HTTPPool) SetRateLimit(rps float64, burst int) {
+	if rps <= 0 {
+		h.rateLimit.Store(nil)
+		return
+	}
+	h.rateLimit.Store(newTokenBucket(rps, burst))
+}
+
+// SetClientRateLimit 设置 HTTPPool 每秒处理的来自每个远程地址的请求数量的上限，可以在运行时调用。
+//
+// 它与 SetRateLimit 同时生效，一个请求需要同时通过两者，防止一个反复重试的客户端占满整个节点的额度。
+// 远程地址取自 http.Request.RemoteAddr 中的 IP，不看 X-Forwarded-For 等可以伪造的头部，
+// 因此经过代理的请求共享代理的额度。请求先消耗 SetRateLimit 的令牌，被全局限制拒绝的请求不消耗客户端的额度。
+// 最多记录 maxClientBuckets 个地址，大量不同地址涌入时会丢弃其中的一部分，见 maxClientBuckets。
+// 每次调用都会丢弃原来记录的所有地址。
+//
+// 参数:
+//
+//	rps: 每个远程地址每秒允许的请求数量，小于等于 0 时取消限制。
+//	burst: 每个远程地址短时间内允许超出 rps 的请求数量，小于 1 时为 1。
+func (h *HTTPPool) SetClientRateLimit(rps float64, burst int) {
+	if rps <= 0 {
+		h.clientLimit.Store(nil)
+		return
+	}
+	h.clientLimit.Store(&clientLimiter{rate: rps, burst: burst, buckets: make(map[string]*tokenBucket)})
+}
+
+// throttle 在请求超过 SetRateLimit 或 SetClientRateLimit 的限制时返回 429 并返回 false。
+// 没有设置限制时只有两次原子读取。
+func (h *HTTPPool) throttle(w http.ResponseWriter, r *http.Request) bool {
+	global, clients := h.rateLimit.Load(), h.clientLimit.Load()
+	if global == nil && clients == nil {
+		return true
+	}
+	t := now()
+	// 先取全局的令牌，被全局限制拒绝的请求不消耗客户端的额度
+	if global != nil {
+		if ok, wait := global.take(t); !ok {
+			h.rejectThrottled(w, wait)
+			return false
+		}
+	}
+	if clients != nil {
+		addr, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			addr = r.RemoteAddr
+		}
+		if ok, wait := clients.take(addr, t); !ok {
+			h.rejectThrottled(w, wait)
+			return false
+		}
+	}
+	return true
+}
+
+// rejectThrottled 以 429 拒绝请求，Retry-After 是向上取整的 wait，至少 1 秒。
+// 被拒绝的请求很可能大量涌来，因此不记录日志。
+func (h *HTTPPool) rejectThrottled(w http.ResponseWriter, wait time.Duration) {
+	h.throttled.Add(1)
+	w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(wait.Seconds())))))
+	http.Error(w, "too many requests", http.StatusTooManyRequests)
+}
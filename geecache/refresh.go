@@ -0,0 +1,142 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+)
+
+// maxRefreshes 是一个 Group 同时进行的后台刷新数量的上限。
+const maxRefreshes = 16
+
+// maybeRefresh 在主缓存中的 v 已经过了软过期时间时，为 key 发起一次后台刷新。
+//
+// 同一个 key 已经在刷新，或者后台刷新的数量已达上限时什么也不做，
+// 之后命中这个值的 Get 会再次尝试。
+func (g *Group) maybeRefresh(key string, v ByteView) {
+	if g.softTTL == 0 || !v.needsRefresh(now()) {
+		return
+	}
+	if _, busy := g.refreshing.LoadOrStore(key, struct{}{}); busy {
+		return
+	}
+	select {
+	case g.refreshSem <- struct{}{}:
+	default:
+		g.refreshing.Delete(key)
+		return
+	}
+	g.stats.refreshes.Add(1)
+	go func() {
+		defer func() {
+			g.refreshing.Delete(key)
+			<-g.refreshSem
+		}()
+		g.refresh(key)
+	}()
+}
+
+// refresh 重新调用 getter 加载 key，成功时替换主缓存中的值，失败时保留原来的值。
+//
+// 刷新与普通的加载共用 singleflight，正在因未命中而加载的 key 不会被重复加载。
+// 与 getLocally 相同，刷新期间执行过 RemoveLocal 时结果不会被写入缓存。
+func (g *Group) refresh(key string) {
+	_, err := g.loader.DoContext(context.Background(), key, func(ctx context.Context) (any, error) {
+		if g.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, g.timeout)
+			defer cancel()
+		}
+		removals := g.removals.load(key)
+		value, err := g.fetchLocally(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if g.removals.load(key) == removals {
+			g.populateCache(key, value)
+		}
+		return value, nil
+	})
+	if err != nil {
+		g.stats.refreshErrs.Add(1)
+		g.logf("[GeeCache] background refresh of %s failed: %v", key, err)
+	}
+}
+
+// GetFresh 跳过缓存重新加载 key，把新值写入缓存并返回它，适用于已知缓存中的值已经过时的场景，
+// 例如收到了数据变更的通知。
+//
+// key 属于远程节点时，请求会要求拥有者同样跳过它的缓存重新加载（见 PeerRefresher），
+// 本节点 hotcache 中已有的旧副本会被新值替换。重新加载确认 key 已不存在时，
+// 缓存中的旧值会被删除。同一个 key 并发的 GetFresh 合并为一次加载。
+//
+// 重新加载期间，其他调用者的 Get 不会等待它：命中缓存的 Get 仍然返回旧值，直到新值写入；
+// 未命中的 Get 照常加载，但与 RemoveLocal 一样，这些可能读到旧值的加载结果不会被写入缓存。
+//
+// 参数:
+//
+//	ctx: 调用者的上下文。
+//	key: 要重新加载的键。
+//
+// 返回值:
+//
+//	value: 重新加载到的值。
+//	err: 如果加载过程中发生错误或 ctx 已结束，则返回错误信息；Group 已被销毁时返回 ErrGroupDestroyed。
+func (g *Group) GetFresh(ctx context.Context, key string) (value ByteView, err error) {
+	if g.destroyed.Load() {
+		return ByteView{}, ErrGroupDestroyed
+	}
+	key, err = g.canonicalKey(key)
+	if err != nil {
+		return ByteView{}, err
+	}
+	if !g.cacheable(key) {
+		// 不经过缓存的 key 每次都会重新加载
+		return g.GetContext(ctx, key)
+	}
+	g.stats.gets.Add(1)
+	g.metrics().IncGet(g.name)
+	g.stats.loads.Add(1)
+	viewi, err := g.reloader.DoContext(ctx, key, func(ctx context.Context) (any, error) {
+		return g.reload(ctx, key, g.ownerFetch(key, true))
+	})
+	if err != nil {
+		return ByteView{}, err
+	}
+	return viewi.(ByteView), nil
+}
+
+// getFreshForPeer 为其他节点的 GetFresh 请求重新加载 key，只使用本地的数据源。
+func (g *Group) getFreshForPeer(ctx context.Context, key string) (ByteView, error) {
+	if !g.cacheable(key) || g.backupOwner(key) {
+		return g.getForPeer(ctx, key)
+	}
+	viewi, err := g.reloader.DoContext(ctx, key, func(ctx context.Context) (any, error) {
+		return g.reload(ctx, key, nil)
+	})
+	if err != nil {
+		return ByteView{}, err
+	}
+	return viewi.(ByteView), nil
+}
+
+// reload 执行一次经过 reloader 合并之后的重新加载，fetch 的含义与 doLoad 相同。
+//
+// 开始之前增加 removals，使与它并发、可能读到旧值的普通加载不再写入缓存。
+func (g *Group) reload(ctx context.Context, key string, fetch peerFetch) (any, error) {
+	g.removals.bump(key)
+	v, err := g.doLoad(ctx, key, fetch)
+	if errors.Is(err, ErrNotFound) {
+		// 数据源中已经没有这个 key，丢弃缓存中的旧值
+		g.maincache.delete(key)
+		g.hotcache.delete(key)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	g.negcache.delete(key)
+	if _, ok := g.hotcache.peek(key); ok && fetch != nil {
+		g.populateHotCache(key, v.(ByteView))
+	}
+	return v, nil
+}
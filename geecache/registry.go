@@ -0,0 +1,101 @@
+package geecache
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Registry 按名称管理一组 Group，不同 Registry 中的同名 Group 互不影响。
+//
+// 包级别的 NewGroup、GetGroup 等函数使用默认的 Registry。需要在一个进程中运行
+// 多套相互隔离的缓存时（例如多租户的应用或并行执行的测试），为每一套创建一个 Registry，
+// 并用 WithRegistry 让对应的 HTTPPool 从中查找 Group。
+type Registry struct {
+	mu     sync.RWMutex
+	groups map[string]*Group
+}
+
+// defaultRegistry 是包级别的函数使用的 Registry。
+var defaultRegistry = NewRegistry()
+
+// NewRegistry 创建一个空的 Registry。
+//
+// 返回值:
+//
+//	*Registry: 一个指向新创建的 Registry 实例的指针。
+func NewRegistry() *Registry {
+	return &Registry{groups: make(map[string]*Group)}
+}
+
+// NewGroup 与包级别的 NewGroup 相同，但把 Group 注册到 r 中。
+func (r *Registry) NewGroup(name string, cacheBytes int64, getter any, opts ...GroupOption) *Group {
+	g, err := r.NewGroupStrict(name, cacheBytes, getter, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+// NewGroupStrict 与包级别的 NewGroupStrict 相同，但把 Group 注册到 r 中。
+func (r *Registry) NewGroupStrict(name string, cacheBytes int64, getter any, opts ...GroupOption) (*Group, error) {
+	loader := richGetter(getter)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.groups[name]; ok {
+		return nil, fmt.Errorf("%w: %q", ErrGroupExists, name)
+	}
+	return r.registerGroup(name, cacheBytes, loader, opts), nil
+}
+
+// GetOrCreateGroup 与包级别的 GetOrCreateGroup 相同，但在 r 中查找和创建 Group。
+func (r *Registry) GetOrCreateGroup(name string, cacheBytes int64, getter any, opts ...GroupOption) *Group {
+	loader := richGetter(getter)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if g, ok := r.groups[name]; ok {
+		return g
+	}
+	return r.registerGroup(name, cacheBytes, loader, opts)
+}
+
+// GetGroup 返回 r 中名为 name 的 Group，不存在时返回 nil。
+func (r *Registry) GetGroup(name string) *Group {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.groups[name]
+}
+
+// DestroyGroup 与包级别的 DestroyGroup 相同，但销毁的是 r 中的 Group。
+func (r *Registry) DestroyGroup(name string) {
+	r.mu.Lock()
+	g := r.groups[name]
+	delete(r.groups, name)
+	r.mu.Unlock()
+	if g != nil {
+		g.destroy()
+	}
+}
+
+// ListGroups 返回 r 中已注册的所有 Group 的名称，按字典序排列。
+func (r *Registry) ListGroups() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.groups))
+	for name := range r.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// snapshot 返回 r 中当前所有的 Group。
+func (r *Registry) snapshot() []*Group {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	groups := make([]*Group, 0, len(r.groups))
+	for _, g := range r.groups {
+		groups = append(groups, g)
+	}
+	return groups
+}
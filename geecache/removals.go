@@ -0,0 +1,31 @@
+package geecache
+
+import "sync/atomic"
+
+// removalSlots 是 removalGens 中计数器的数量。不同的 key 可能共用一个计数器，
+// 此时删除一个 key 只会让与它共用计数器的少数 key 的并发加载不写入缓存。
+const removalSlots = 256
+
+// removalGens 按 key 的哈希记录删除和强制重新加载的次数。加载开始之前读取 key 对应的计数，
+// 结束时计数发生了变化说明期间 key 被删除过，结果可能已经过时，不应写入缓存。
+type removalGens [removalSlots]atomic.Uint64
+
+// slot 使用 FNV-1a 哈希为 key 选择计数器。
+func (r *removalGens) slot(key string) *atomic.Uint64 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return &r[h%removalSlots]
+}
+
+// load 返回 key 当前的计数。
+func (r *removalGens) load(key string) uint64 {
+	return r.slot(key).Load()
+}
+
+// bump 增加 key 的计数，使与之并发的 key 的加载不再写入缓存。
+func (r *removalGens) bump(key string) {
+	r.slot(key).Add(1)
+}
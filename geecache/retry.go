@@ -0,0 +1,155 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// temporary 是暂时性错误实现的接口，与 net.Error 中已废弃的方法相同。
+type temporary interface {
+	Temporary() bool
+}
+
+// retryable 判断从远程节点获取失败的错误是否值得重试。
+// 只有传输层错误（包括 ErrPeerTimeout）和 5xx 响应会被重试，ErrNotFound、ErrPeerInternal 和 ctx 结束都不会。
+func retryable(err error) bool {
+	if errors.Is(err, ErrPeerTimeout) {
+		// 它同时满足 context.DeadlineExceeded，但调用方的上下文并没有结束
+		return true
+	}
+	if errors.Is(err, ErrNotFound) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var te temporary
+	if errors.As(err, &te) {
+		if _, ok := te.(*statusError); ok {
+			return te.Temporary()
+		}
+	}
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// retryFetch 为 fetch 加上 WithPeerRetry 设置的重试策略。
+func (g *Group) retryFetch(fetch peerFetch) peerFetch {
+	if g.retries == 0 {
+		return fetch
+	}
+	return func(ctx context.Context) (ByteView, error) {
+		for attempt := 0; ; attempt++ {
+			v, err := fetch(ctx)
+			if err == nil || !retryable(err) || ctx.Err() != nil {
+				return v, err
+			}
+			if attempt == g.retries {
+				g.stats.peerExhausted.Add(1)
+				return v, err
+			}
+			delay := g.backoff(attempt)
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+				// 剩下的时间不够再等一次，把机会留给本地加载
+				g.stats.peerExhausted.Add(1)
+				return v, err
+			}
+			g.stats.peerRetries.Add(1)
+			t := time.NewTimer(delay)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return v, err
+			}
+		}
+	}
+}
+
+// backoff 返回第 attempt 次重试之前的等待时间：retryBase*2^attempt，
+// 并在 [1/2, 3/2) 倍之间随机抖动。
+func (g *Group) backoff(attempt int) time.Duration {
+	d := g.retryBase << attempt
+	return d/2 + rand.N(d)
+}
+
+// RetryPolicy 是 httpGetter 在传输层重试请求的策略，见 WithRetryPolicy。
+type RetryPolicy struct {
+	// MaxAttempts 是包括第一次在内的最大尝试次数，小于等于 1 时不重试。
+	MaxAttempts int
+
+	// Backoff 是第一次重试之前的等待时间，之后每次加倍，并在 [1/2, 3/2) 倍之间随机抖动；为 0 时立即重试。
+	Backoff time.Duration
+
+	// Retryable 判断请求失败的错误是否值得在新的连接上重试，为 nil 时使用 IsConnectionError。
+	Retryable func(err error) bool
+}
+
+// WithRetryPolicy 让 HTTPPool 向其他节点发出的 GET 和 HEAD 请求在连接层失败时按 p 重试，默认不重试。
+//
+// 与 WithPeerRetry 不同，重试发生在 httpGetter 发出一次请求的内部，Group 只看到最后的结果，
+// 熔断器和 PeerStats.Errors 也只记录一次。只有没有请求体的 GET 和 HEAD 会被重试，批量获取和写入等
+// 其他方法的请求从不重试；收到响应头之后的失败（例如读取响应体时连接断开）也不会重试，
+// 因为那时拥有者可能已经做完了加载。重试受请求上下文的截止时间约束，剩余时间不够等待下一次重试时直接放弃。
+//
+// 参数:
+//
+//	p: 重试策略。
+//
+// 返回值:
+//
+//	PoolOption: 可传递给 NewHTTPPool 的配置项。
+func WithRetryPolicy(p RetryPolicy) PoolOption {
+	return func(h *HTTPPool) {
+		h.retry = p
+	}
+}
+
+// IsConnectionError 报告 err 是否是连接层的失败：连接被重置或中止，或者在收到响应头之前读到了 EOF。
+// 这类失败通常是因为复用了对方已经关闭的连接，在新的连接上重试是安全并且便宜的。它是 RetryPolicy 默认的分类。
+//
+// 参数:
+//
+//	err: 请求失败的错误。
+//
+// 返回值:
+//
+//	bool: err 是连接层的失败时为 true。
+func IsConnectionError(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// send 用 c 发出 req，按 retry 重试连接层的失败，见 WithRetryPolicy。
+func (h *httpGetter) send(c *http.Client, req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	replayable := (req.Method == http.MethodGet || req.Method == http.MethodHead) && (req.Body == nil || req.Body == http.NoBody)
+	retryable := h.retry.Retryable
+	if retryable == nil {
+		retryable = IsConnectionError
+	}
+	for attempt := 1; ; attempt++ {
+		rsp, err := c.Do(req)
+		if err == nil || !replayable || attempt >= h.retry.MaxAttempts || ctx.Err() != nil || !retryable(err) {
+			return rsp, err
+		}
+		var delay time.Duration
+		if d := h.retry.Backoff << (attempt - 1); d > 0 {
+			delay = d/2 + rand.N(d)
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return rsp, err
+		}
+		h.retries.Add(1)
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return rsp, err
+		}
+	}
+}
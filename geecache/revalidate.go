@@ -0,0 +1,112 @@
+package geecache
+
+import (
+	"context"
+	"encoding/hex"
+	"hash/fnv"
+	"net/http"
+	"strings"
+)
+
+// valueETag 返回值 b 的强 ETag：带引号的 FNV-1a 64 位哈希。相同的字节总是得到相同的 ETag，
+// 因此拥有者和持有热点副本的节点不需要交换任何状态就能比较。
+func valueETag(b []byte) string {
+	h := fnv.New64a()
+	h.Write(b)
+	return `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+}
+
+// etagMatches 报告 If-None-Match 的值 header 是否包含 etag，"*" 匹配任何值。弱 ETag 不匹配。
+func etagMatches(header, etag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		if t = strings.TrimSpace(t); t == "*" || t == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified 在其他节点的请求携带的 If-None-Match 与 view 的 ETag 相同时返回 304，
+// 响应中仍然带有剩余存活时间和版本号，请求方据此刷新它的副本；返回值报告是否已经写入了响应。
+// ETag 只为条件请求计算并返回，普通的 GET 不需要对整个值求哈希。
+func notModified(w http.ResponseWriter, r *http.Request, view ByteView) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	etag := valueETag(view.b)
+	w.Header().Set("ETag", etag)
+	if !etagMatches(header, etag) {
+		return false
+	}
+	writeValueHeaders(w, view)
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// Revalidate 向拥有者确认本节点热点缓存中 key 的副本是否仍然是最新的。
+//
+// 副本仍是最新的时，拥有者只返回 304 和剩余存活时间，不传输值本身，副本的过期时间按拥有者的报告重新计算；
+// 值已经改变时副本被拥有者返回的新值替换。没有热点副本（包括已经过期并被删除的副本）、
+// key 由本节点负责或者远程节点没有实现 PeerRevalidator 时，与 GetContext 相同。
+// 副本仍在 WithStaleIfError 的 grace 之内时同样会被确认。
+//
+// 参数:
+//
+//	ctx: 调用者的上下文。
+//	key: 要确认的键。
+//
+// 返回值:
+//
+//	value: 确认之后的值。
+//	err: 请求拥有者失败时返回错误，此时热点副本保持不变；Group 已被销毁时返回 ErrGroupDestroyed。
+func (g *Group) Revalidate(ctx context.Context, key string) (value ByteView, err error) {
+	if g.destroyed.Load() {
+		return ByteView{}, ErrGroupDestroyed
+	}
+	key, err = g.canonicalKey(key)
+	if err != nil {
+		return ByteView{}, err
+	}
+	old, ok := g.hotcache.peek(key)
+	if !ok {
+		old, ok = g.hotcache.stale(key)
+	}
+	if !ok || g.peers == nil {
+		return g.GetContext(ctx, key)
+	}
+	peer, ok := g.peers.PickPeer(key)
+	if !ok {
+		return g.GetContext(ctx, key)
+	}
+	rv, ok := peer.(PeerRevalidator)
+	if !ok {
+		return g.GetContext(ctx, key)
+	}
+
+	removals := g.removals.load(key)
+	g.stats.revalidations.Add(1)
+	r, modified, err := rv.Revalidate(ctx, g.name, key, valueETag(old.b))
+	if err != nil {
+		g.metrics().IncPeerError(peerName(peer))
+		return ByteView{}, err
+	}
+	if !modified {
+		g.stats.notModified.Add(1)
+		r.Value = old.b
+	}
+	ttl := r.TTL
+	if ttl <= 0 {
+		ttl = g.ttl
+	}
+	value = ByteView{b: r.Value, expire: expireAfter(ttl), version: r.Version, noStore: r.NoStore}
+	if g.removals.load(key) != removals {
+		return value, nil
+	}
+	if r.NoStore {
+		g.hotcache.delete(key)
+		return value, nil
+	}
+	g.populateHotCache(key, value)
+	return value, nil
+}
@@ -0,0 +1,159 @@
+package geecache
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// drainingReason 是正在关闭的节点拒绝请求、返回 503 时 errorHeader 的值，见 ErrPeerDraining。
+const drainingReason = "draining"
+
+// ErrPeerDraining 表示远程节点正在 Shutdown，不再接受新的请求。它不会被 WithPeerRetry 重试，
+// Group 直接回退到下一个拥有者或本地加载。
+var ErrPeerDraining = errors.New("geecache: peer is shutting down")
+
+// drainState 记录 HTTPPool 的关闭状态和正在处理的请求，见 Shutdown。
+type drainState struct {
+	mu       sync.RWMutex // 保证 Shutdown 开始等待之后不会再有请求计入 inflight
+	draining bool
+	inflight sync.WaitGroup
+
+	serversMu sync.Mutex
+	servers   map[*http.Server]struct{} // Serve 和 ListenAndServeTLS 正在使用的服务器
+}
+
+// enter 在处理一个请求之前调用，正在关闭时返回 false，否则返回 true，请求结束之后需要调用 leave。
+func (d *drainState) enter() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.draining {
+		return false
+	}
+	d.inflight.Add(1)
+	return true
+}
+
+// leave 在 enter 返回 true 的请求结束之后调用。
+func (d *drainState) leave() {
+	d.inflight.Done()
+}
+
+// isDraining 报告 Shutdown 是否已经开始。
+func (d *drainState) isDraining() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.draining
+}
+
+// rejectDraining 以 503 拒绝正在关闭的节点收到的请求。
+func rejectDraining(w http.ResponseWriter) {
+	w.Header().Set(errorHeader, drainingReason)
+	w.Header().Set("Connection", "close")
+	http.Error(w, ErrPeerDraining.Error(), http.StatusServiceUnavailable)
+}
+
+// Serve 在 l 上提供 HTTPPool，直到 Shutdown 被调用或服务器出错。
+// 设置了 WithServerTLSConfig 时连接以它进行 TLS 握手。
+//
+// 参数:
+//
+//	l: 接受连接的 Listener，Serve 返回时它已经被关闭。
+//
+// 返回值:
+//
+//	error: Shutdown 之后返回 http.ErrServerClosed，其他情况与 http.Server.Serve 相同。
+func (h *HTTPPool) Serve(l net.Listener) error {
+	srv := h.newServer("")
+	if !h.track(srv) {
+		l.Close()
+		return http.ErrServerClosed
+	}
+	defer h.untrack(srv)
+	if srv.TLSConfig != nil {
+		return srv.ServeTLS(l, "", "")
+	}
+	return srv.Serve(l)
+}
+
+// newServer 返回以 h 为 handler、以 WithServerTLSConfig 设置的配置提供 TLS 的服务器。
+func (h *HTTPPool) newServer(addr string) *http.Server {
+	srv := &http.Server{Addr: addr, Handler: h}
+	if h.serverTLS != nil {
+		srv.TLSConfig = h.serverTLS.Clone()
+	}
+	return srv
+}
+
+// track 登记 Shutdown 需要关闭的服务器，已经开始关闭时返回 false。
+func (h *HTTPPool) track(srv *http.Server) bool {
+	h.drain.serversMu.Lock()
+	defer h.drain.serversMu.Unlock()
+	if h.drain.isDraining() {
+		return false
+	}
+	if h.drain.servers == nil {
+		h.drain.servers = make(map[*http.Server]struct{})
+	}
+	h.drain.servers[srv] = struct{}{}
+	return true
+}
+
+// untrack 取消 track 的登记。
+func (h *HTTPPool) untrack(srv *http.Server) {
+	h.drain.serversMu.Lock()
+	defer h.drain.serversMu.Unlock()
+	delete(h.drain.servers, srv)
+}
+
+// Shutdown 平滑地关闭节点，用于滚动升级等场景。
+//
+// 调用之后 ServeHTTP 以 503 拒绝新的请求，请求方得到 ErrPeerDraining 并立即回退，不会重试；
+// 健康检查接口继续回应，但返回 503 和 "draining"，启用了 WithHealthCheck 的其他节点因此把本节点移出一致性哈希环，
+// 负载均衡器也不再转发请求。Shutdown 等待已经开始的请求处理完毕，然后关闭 Serve 和 ListenAndServeTLS
+// 启动的服务器、停止后台的健康检查，并关闭客户端的空闲连接。由其他服务器提供的 HTTPPool 需要调用方在
+// Shutdown 返回之后自己关闭服务器。Shutdown 之后 HTTPPool 不能再恢复服务。
+//
+// 参数:
+//
+//	ctx: 等待的时限，结束时 Shutdown 不再等待尚未完成的请求。
+//
+// 返回值:
+//
+//	error: ctx 在请求完成之前结束时返回 ctx.Err()，或者关闭服务器的错误。
+func (h *HTTPPool) Shutdown(ctx context.Context) error {
+	h.drain.mu.Lock()
+	h.drain.draining = true
+	h.drain.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.drain.inflight.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	h.drain.serversMu.Lock()
+	servers := make([]*http.Server, 0, len(h.drain.servers))
+	for srv := range h.drain.servers {
+		servers = append(servers, srv)
+	}
+	h.drain.serversMu.Unlock()
+	for _, srv := range servers {
+		if e := srv.Shutdown(ctx); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	h.Close()
+	cmp.Or(h.client, defaultPeerClient).CloseIdleConnections()
+	return err
+}
@@ -0,0 +1,294 @@
+package geecache
+
+import (
+	"io"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Sink 接收 GetInto 获取到的值，调用方可以按需要的类型直接拿到结果，
+// 而不必先得到 ByteView 再自行复制或解码。
+//
+// 缓存中的数据是只读的，Sink 的实现如果要把数据交给调用方修改，必须自己复制一份。
+type Sink interface {
+	// SetString 把值设置为 s。
+	SetString(s string) error
+
+	// SetBytes 把值设置为 v 的内容。v 可能直接指向缓存中的数据，Sink 不能修改或保留它。
+	SetBytes(v []byte) error
+
+	// SetProto 把值设置为 m 编码之后的内容，调用之后 m 仍归调用方所有，Sink 不能保留它。
+	SetProto(m proto.Message) error
+}
+
+// viewSetter 是 Sink 可选实现的接口，可以直接接收 ByteView 以省去一次复制。
+type viewSetter interface {
+	setView(v ByteView) error
+}
+
+// streamSetter 是 Sink 可选实现的接口，可以直接从远程节点的响应体读取值，省去中间的缓冲区，见 GetInto。
+// size 是值的长度，-1 表示长度未知。读取失败时 Sink 返回错误。
+type streamSetter interface {
+	setStream(r io.Reader, size int64) error
+}
+
+// setSinkView 把 v 写入 dst，dst 实现了 viewSetter 时不复制数据。
+func setSinkView(dst Sink, v ByteView) error {
+	if vs, ok := dst.(viewSetter); ok {
+		return vs.setView(v)
+	}
+	return dst.SetBytes(v.b)
+}
+
+// StringSink 返回一个把值写入 *sp 的 Sink。
+//
+// 参数:
+//
+//	sp: 接收值的字符串指针。
+//
+// 返回值:
+//
+//	Sink: 写入 *sp 的 Sink。
+func StringSink(sp *string) Sink {
+	return &stringSink{sp: sp}
+}
+
+// stringSink 是 StringSink 返回的 Sink。
+type stringSink struct {
+	sp *string
+}
+
+// SetString 实现了 Sink 接口。
+func (s *stringSink) SetString(v string) error {
+	*s.sp = v
+	return nil
+}
+
+// SetBytes 实现了 Sink 接口。
+func (s *stringSink) SetBytes(v []byte) error {
+	*s.sp = string(v)
+	return nil
+}
+
+// SetProto 实现了 Sink 接口。
+func (s *stringSink) SetProto(m proto.Message) error {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	*s.sp = string(b)
+	return nil
+}
+
+// ByteViewSink 返回一个把值写入 *dst 的 Sink。
+//
+// ByteView 是只读的，因此来自缓存的值可以直接交给 *dst 而不需要复制。
+//
+// 参数:
+//
+//	dst: 接收值的 ByteView 指针。
+//
+// 返回值:
+//
+//	Sink: 写入 *dst 的 Sink。
+func ByteViewSink(dst *ByteView) Sink {
+	if dst == nil {
+		panic("geecache: nil dst passed to ByteViewSink")
+	}
+	return &byteViewSink{dst: dst}
+}
+
+// byteViewSink 是 ByteViewSink 返回的 Sink。
+type byteViewSink struct {
+	dst *ByteView
+}
+
+// setView 实现了 viewSetter 接口。
+func (s *byteViewSink) setView(v ByteView) error {
+	*s.dst = v
+	return nil
+}
+
+// SetString 实现了 Sink 接口。
+func (s *byteViewSink) SetString(v string) error {
+	*s.dst = ByteView{b: []byte(v)}
+	return nil
+}
+
+// SetBytes 实现了 Sink 接口。
+func (s *byteViewSink) SetBytes(v []byte) error {
+	*s.dst = ByteView{b: cloneBytes(v)}
+	return nil
+}
+
+// SetProto 实现了 Sink 接口。
+func (s *byteViewSink) SetProto(m proto.Message) error {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	*s.dst = ByteView{b: b}
+	return nil
+}
+
+// AllocatingByteSliceSink 返回一个把值的一份新拷贝写入 *dst 的 Sink。
+//
+// 调用方可以随意修改得到的切片，而不会影响缓存中的数据。
+//
+// 参数:
+//
+//	dst: 接收值的字节切片指针。
+//
+// 返回值:
+//
+//	Sink: 写入 *dst 的 Sink。
+func AllocatingByteSliceSink(dst *[]byte) Sink {
+	return &allocBytesSink{dst: dst}
+}
+
+// allocBytesSink 是 AllocatingByteSliceSink 返回的 Sink。
+type allocBytesSink struct {
+	dst *[]byte
+}
+
+// SetString 实现了 Sink 接口。
+func (s *allocBytesSink) SetString(v string) error {
+	*s.dst = []byte(v)
+	return nil
+}
+
+// SetBytes 实现了 Sink 接口。
+func (s *allocBytesSink) SetBytes(v []byte) error {
+	*s.dst = cloneBytes(v)
+	return nil
+}
+
+// SetProto 实现了 Sink 接口。
+func (s *allocBytesSink) SetProto(m proto.Message) error {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	*s.dst = b
+	return nil
+}
+
+// setStream 实现了 streamSetter 接口。长度已知时一次分配刚好的空间，读取不完整时 *dst 保持不变。
+func (s *allocBytesSink) setStream(r io.Reader, size int64) error {
+	if size < 0 {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		*s.dst = b
+		return nil
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	*s.dst = b
+	return nil
+}
+
+// WriterSink 返回一个把值写入 w 的 Sink，例如一个文件。
+//
+// 来自缓存的值直接写入 w 而不复制；从远程节点获取的值由 GetInto 从响应体复制到 w，
+// 不会先读入内存。写入或读取中途失败时 w 中可能已经有一部分数据，调用方需要自己丢弃。
+//
+// 参数:
+//
+//	w: 接收值的 Writer。
+//
+// 返回值:
+//
+//	Sink: 写入 w 的 Sink。
+func WriterSink(w io.Writer) Sink {
+	if w == nil {
+		panic("geecache: nil writer passed to WriterSink")
+	}
+	return &writerSink{w: w}
+}
+
+// writerSink 是 WriterSink 返回的 Sink。
+type writerSink struct {
+	w io.Writer
+}
+
+// setView 实现了 viewSetter 接口。
+func (s *writerSink) setView(v ByteView) error {
+	_, err := v.WriteTo(s.w)
+	return err
+}
+
+// setStream 实现了 streamSetter 接口。
+func (s *writerSink) setStream(r io.Reader, size int64) error {
+	n, err := io.Copy(s.w, r)
+	if err == nil && size >= 0 && n < size {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// SetString 实现了 Sink 接口。
+func (s *writerSink) SetString(v string) error {
+	_, err := io.WriteString(s.w, v)
+	return err
+}
+
+// SetBytes 实现了 Sink 接口。
+func (s *writerSink) SetBytes(v []byte) error {
+	_, err := s.w.Write(v)
+	return err
+}
+
+// SetProto 实现了 Sink 接口。
+func (s *writerSink) SetProto(m proto.Message) error {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return s.SetBytes(b)
+}
+
+// ProtoSink 返回一个把值解码到 m 中的 Sink，值必须是 m 对应类型的 protobuf 编码。
+//
+// 参数:
+//
+//	m: 接收值的 protobuf 消息。
+//
+// 返回值:
+//
+//	Sink: 解码到 m 的 Sink。
+func ProtoSink(m proto.Message) Sink {
+	return &protoSink{dst: m}
+}
+
+// protoSink 是 ProtoSink 返回的 Sink。
+type protoSink struct {
+	dst proto.Message
+}
+
+// SetString 实现了 Sink 接口。
+func (s *protoSink) SetString(v string) error {
+	return s.SetBytes([]byte(v))
+}
+
+// SetBytes 实现了 Sink 接口。
+func (s *protoSink) SetBytes(v []byte) error {
+	// 解码得到的消息不会引用 v，缓存中的数据不会因为修改消息而改变
+	return proto.Unmarshal(v, s.dst)
+}
+
+// SetProto 实现了 Sink 接口。
+func (s *protoSink) SetProto(m proto.Message) error {
+	// 经过一次编码再解码，m 与目标消息的类型不同时也能按字段编号转换
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(b, s.dst)
+}
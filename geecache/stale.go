@@ -0,0 +1,61 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// WithStaleIfError 让过期的值在过期之后再保留 grace，期间重新加载失败时返回这个旧值而不是错误，
+// 例如在数据源故障时继续提供两分钟前过期的数据。
+//
+// 过期的值不会再被 Get 直接命中：每次未命中仍然照常（经过 singleflight 合并）从远程节点或本地重新加载，
+// 只有加载失败时才返回旧值，共享这次加载的调用者都会得到它；旧值的过期时间不会因此延长，
+// 超过 grace 之后加载失败的错误照常返回。加载确认 key 已不存在（ErrNotFound）时不返回旧值。
+// 负缓存中缓存的暂时性错误（WithErrorCacheTTL）同样会被旧值代替。
+//
+// 与 WithRefreshAhead 同时使用时，后台刷新的行为不变；值硬过期之后的 Get 同步地重新加载，
+// 失败时在 grace 之内返回旧值。主缓存和热点缓存中的值都适用。
+//
+// 参数:
+//
+//	grace: 值过期之后仍可在加载失败时返回的时长，小于等于 0 时不启用。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithStaleIfError(grace time.Duration) GroupOption {
+	return func(g *Group) {
+		grace = max(grace, 0)
+		g.maincache.grace = grace
+		g.hotcache.grace = grace
+	}
+}
+
+// loadOrStale 与 doLoad 相同，但加载失败时按 WithStaleIfError 返回过期的旧值。
+func (g *Group) loadOrStale(ctx context.Context, key string, fetch peerFetch) (any, error) {
+	v, err := g.doLoad(ctx, key, fetch)
+	if err != nil {
+		if stale, ok := g.serveStale(key, err); ok {
+			return stale, nil
+		}
+	}
+	return v, err
+}
+
+// serveStale 在加载 key 失败并得到 err 时，返回主缓存或热点缓存中仍在 grace 之内的旧值。
+func (g *Group) serveStale(key string, err error) (ByteView, bool) {
+	if g.maincache.grace <= 0 || errors.Is(err, ErrNotFound) {
+		return ByteView{}, false
+	}
+	v, ok := g.maincache.stale(key)
+	if !ok {
+		v, ok = g.hotcache.stale(key)
+	}
+	if !ok {
+		return ByteView{}, false
+	}
+	g.stats.staleServes.Add(1)
+	g.logf("[GeeCache] serving stale %s after load failed: %v", key, err)
+	return v, true
+}
@@ -0,0 +1,174 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// rawValueThreshold 是拥有者节点总是以原始字节发送的值的大小。不小于它的值即使请求方接受 protobufType
+// 也不编码为 GetResponse，省去编码时对整个值的一次复制；请求方按 Content-Type 解码两种响应。
+const rawValueThreshold = 1 << 20
+
+// GetStream 实现了 PeerGetterStream 接口。
+//
+// 请求既不接受 protobufType 也不接受 gzip，拥有者以原始字节发送值并设置 Content-Length，
+// 响应体原样交给调用方读取，httpGetter 不会把值读入内存。
+func (h *httpGetter) GetStream(ctx context.Context, group string, key string) (body io.ReadCloser, size int64, err error) {
+	end, err := h.begin(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() {
+		if err != nil {
+			end()
+		}
+	}()
+	defer func() { h.record(ctx, err) }()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.keyURL(group, key), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "application/octet-stream")
+	req.Header.Set("Accept-Encoding", "identity")
+	injectTrace(ctx, req.Header)
+	rsp, err := h.do(req)
+	if err == nil && rsp.StatusCode != http.StatusOK {
+		if rsp.StatusCode == http.StatusNotFound && rsp.Header.Get(errorHeader) == notFoundReason {
+			msg, _ := io.ReadAll(rsp.Body)
+			err = notFoundError(strings.TrimSpace(string(msg)))
+		} else {
+			err = responseError(rsp)
+		}
+		rsp.Body.Close()
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return &releaseBody{ReadCloser: rsp.Body, end: end}, rsp.ContentLength, nil
+}
+
+// hotCopyKey 是 GetInto 在获取的上下文中标记值已经按 WithHotCacheRate 抽中放入 hotcache 时使用的 key。
+type hotCopyKey struct{}
+
+// getStream 尝试以流的方式为 GetInto 获取 key，返回值 handled 报告是否已经处理了这次获取。
+//
+// key 没有缓存在本节点（包括负缓存）、由实现了 PeerGetterStream 的远程节点负责、没有设置拦截器，
+// 并且不是需要复制到 hotcache 的热点 key 时，拥有者的响应体直接交给 dst。这样获取的值只交给 dst，不会放入 hotcache。
+// 流不能与其他调用者共享，因此只在 key 没有正在进行的加载或流时使用，否则返回 false，
+// 由 GetContext 与其他加载合并：同一个 key 并发的 GetInto 最多发起一次流和一次普通的加载。
+// 设置了 WithMaxValueBytes 时，超过上限的值在分配内存之前就返回 ErrValueTooLarge。
+// 请求拥有者失败时（key 不存在和 ctx 结束除外）返回 false，由 GetContext 按普通的方式重试和回退；
+// 读取响应体的途中失败时 dst 可能已经收到一部分数据，因此直接返回错误。
+func (g *Group) getStream(ctx context.Context, key string, dst streamSetter) (handled bool, err error) {
+	if g.destroyed.Load() || g.peers == nil || len(g.interceptors) > 0 {
+		return false, nil
+	}
+	if key, err = g.canonicalKey(key); err != nil {
+		return false, nil
+	}
+	if _, ok := g.GetCached(key); ok {
+		return false, nil
+	}
+	if _, ok := g.negcache.peek(key); ok {
+		return false, nil
+	}
+	peer, ok := g.peers.PickPeer(key)
+	if !ok {
+		return false, nil
+	}
+	sp, ok := peer.(PeerGetterStream)
+	if !ok {
+		return false, nil
+	}
+	if g.hotKeys != nil && g.hotKeys.hot(key) {
+		// 由 acceptFromPeer 复制到 hotcache
+		return false, nil
+	}
+	if _, busy := g.streaming.LoadOrStore(key, struct{}{}); busy {
+		return false, nil
+	}
+	defer g.streaming.Delete(key)
+	if g.loader.InFlight(key) {
+		return false, nil
+	}
+	if g.hotKeys != nil {
+		g.hotKeys.record(key)
+	}
+
+	m := g.metrics()
+	start := time.Now()
+	ctx, span := g.startSpan(ctx, SpanPeer, SpanClient, key)
+	body, size, err := sp.GetStream(ctx, g.name, key)
+	if err != nil && !errors.Is(err, ErrNotFound) && ctx.Err() == nil {
+		span.End(err)
+		m.IncPeerError(peerName(peer))
+		g.logf("[GeeCache] Failed to stream from peer, will get it normally: %v", err)
+		return false, nil
+	}
+	g.stats.gets.Add(1)
+	m.IncGet(g.name)
+	g.stats.loads.Add(1)
+	if err == nil {
+		err = g.setStream(dst, body, size)
+		body.Close()
+	}
+	span.End(err)
+	if o, ok := m.(PeerRequestObserver); ok {
+		o.ObservePeerRequest(peerName(peer), time.Since(start), err)
+	}
+	if errors.Is(err, ErrValueTooLarge) {
+		return true, err
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		if ctx.Err() == nil {
+			// 调用者放弃了请求，不是节点的问题
+			g.stats.peerErrors.Add(1)
+			m.IncPeerError(peerName(peer))
+		}
+		return true, err
+	}
+	g.stats.peerLoads.Add(1)
+	m.ObserveLoadDuration(g.name, SourcePeer, time.Since(start))
+	if err != nil {
+		g.populateNegative(ctx, key, err)
+	}
+	return true, err
+}
+
+// setStream 把拥有者的响应体交给 dst，值超过 WithMaxValueBytes 的上限时返回 ErrValueTooLarge。
+func (g *Group) setStream(dst streamSetter, body io.Reader, size int64) error {
+	max := g.maincache.maxValueBytes
+	if max <= 0 {
+		return dst.setStream(body, size)
+	}
+	if size > max {
+		return ErrValueTooLarge
+	}
+	// 拥有者没有声明长度或者声明的长度不属实时，读取到的数据同样受上限约束
+	return dst.setStream(&capReader{r: body, n: max}, size)
+}
+
+// capReader 从 r 中读取最多 n 字节，r 中还有更多数据时返回 ErrValueTooLarge。
+type capReader struct {
+	r io.Reader
+	n int64 // 还允许读取的字节数
+}
+
+// Read 实现了 io.Reader 接口。
+func (c *capReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > c.n+1 {
+		// 多读一个字节即可判断是否超过上限
+		p = p[:c.n+1]
+	}
+	n, err := c.r.Read(p)
+	if int64(n) > c.n {
+		n, c.n = int(c.n), 0
+		return n, ErrValueTooLarge
+	}
+	c.n -= int64(n)
+	return n, err
+}
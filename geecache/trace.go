@@ -0,0 +1,145 @@
+package geecache
+
+import (
+	"context"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+// SpanKind 表示 span 在一次调用中的角色，与 OpenTelemetry 的 SpanKind 对应。
+type SpanKind int
+
+const (
+	SpanInternal SpanKind = iota // 本节点内部的处理，如 Get 和调用 getter
+	SpanClient                   // 向其他节点发起的请求
+	SpanServer                   // 处理其他节点发来的请求
+)
+
+// Group 和 HTTPPool 创建的 span 的名称。
+const (
+	SpanGet   = "geecache.Get"   // Get 和 GetContext 的一次调用
+	SpanLoad  = "geecache.load"  // 调用本地的 getter
+	SpanPeer  = "geecache.peer"  // 向远程节点获取值
+	SpanServe = "geecache.serve" // HTTPPool 或 Group.ServePeer 处理其他节点的请求
+)
+
+// Span 是 Tracer 开始的一个 span。
+type Span interface {
+	// End 结束 span，err 不为 nil 时表示这一步失败。
+	End(err error)
+}
+
+// Tracer 为 Group 和 HTTPPool 创建 span，并在节点之间传递追踪上下文，可以对接 OpenTelemetry 等追踪系统。
+//
+// 这些方法在 Get 和节点间请求的过程中被同步调用，并且会被多个 goroutine 并发调用，
+// 实现需要是并发安全的并尽量轻量。
+type Tracer interface {
+	// Start 在 ctx 中开始一个名为 name 的 span，返回带有该 span 的上下文。
+	// keyHash 是 key 的哈希值而不是 key 本身，避免把 key 写入追踪系统。
+	Start(ctx context.Context, name string, kind SpanKind, group, keyHash string) (context.Context, Span)
+
+	// Inject 把 ctx 中的追踪上下文写入发往其他节点的请求头。
+	Inject(ctx context.Context, header http.Header)
+
+	// Extract 从其他节点发来的请求头中取出追踪上下文，返回带有它的上下文。
+	Extract(ctx context.Context, header http.Header) context.Context
+}
+
+// NopTracer 是 Tracer 的空实现，也是默认的 Tracer。使用它时 Group 不会计算 key 的哈希值，也不会创建 span。
+type NopTracer struct{}
+
+func (NopTracer) Start(ctx context.Context, name string, kind SpanKind, group, keyHash string) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+func (NopTracer) Inject(ctx context.Context, header http.Header)                  {}
+func (NopTracer) Extract(ctx context.Context, header http.Header) context.Context { return ctx }
+
+// nopSpan 是 NopTracer 开始的 span。
+type nopSpan struct{}
+
+func (nopSpan) End(err error) {}
+
+// tracerHolder 包装全局的 Tracer，使不同的实现类型可以存入同一个 atomic.Value。
+type tracerHolder struct {
+	t Tracer
+}
+
+// globalTracer 是没有通过 WithTracer 单独设置 Tracer 的 Group 使用的 Tracer。
+var globalTracer atomic.Value
+
+func init() {
+	globalTracer.Store(tracerHolder{NopTracer{}})
+}
+
+// SetTracer 设置全局的 Tracer，它对所有没有使用 WithTracer 的 Group 立即生效。
+//
+// 参数:
+//
+//	t: 新的全局 Tracer，为 nil 时恢复为 NopTracer。
+func SetTracer(t Tracer) {
+	if t == nil {
+		t = NopTracer{}
+	}
+	globalTracer.Store(tracerHolder{t})
+}
+
+// WithTracer 为 Group 单独设置 Tracer，代替全局的 Tracer。
+//
+// 参数:
+//
+//	t: Group 使用的 Tracer，为 nil 时使用全局的 Tracer。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithTracer(t Tracer) GroupOption {
+	return func(g *Group) {
+		g.tracer = t
+	}
+}
+
+// tracing 返回 Group 当前使用的 Tracer。
+func (g *Group) tracing() Tracer {
+	if g.tracer != nil {
+		return g.tracer
+	}
+	return globalTracer.Load().(tracerHolder).t
+}
+
+// isNopTracer 报告 t 是否是 NopTracer。
+func isNopTracer(t Tracer) bool {
+	_, nop := t.(NopTracer)
+	return nop
+}
+
+// tracerKey 是上下文中保存开始客户端 span 的 Tracer 的键，httpGetter 用它注入追踪上下文。
+type tracerKey struct{}
+
+// startSpan 为 key 开始一个 span，Tracer 是 NopTracer 时直接返回 ctx。
+// 客户端 span 的上下文中还会记录 Tracer，供发起请求的 PeerGetter 注入追踪上下文。
+func (g *Group) startSpan(ctx context.Context, name string, kind SpanKind, key string) (context.Context, Span) {
+	t := g.tracing()
+	if isNopTracer(t) {
+		return ctx, nopSpan{}
+	}
+	if kind == SpanClient {
+		ctx = context.WithValue(ctx, tracerKey{}, t)
+	}
+	return t.Start(ctx, name, kind, g.name, keyHash(key))
+}
+
+// injectTrace 把 ctx 中的追踪上下文写入发往其他节点的请求头，ctx 不在客户端 span 中时什么也不做。
+func injectTrace(ctx context.Context, header http.Header) {
+	if t, ok := ctx.Value(tracerKey{}).(Tracer); ok {
+		t.Inject(ctx, header)
+	}
+}
+
+// keyHash 返回 span 中代替 key 记录的哈希值。
+func keyHash(key string) string {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
@@ -0,0 +1,93 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrVersionMismatch 表示 SetIfVersion 期望的版本号与缓存中条目当前的版本号不一致。
+var ErrVersionMismatch = errors.New("geecache: version mismatch")
+
+// nextVersion 返回 cache.update 使用的函数，它为 value 分配一个新的版本号。
+//
+// 版本号来自 c 中单调递增的计数器，而不是当前条目的版本号加 1：key 被删除、淘汰或过期之后再写入时，
+// 新的版本号也比之前分配过的都大，持有旧版本号的写入方不会误以为值没有变过。
+func (c *cache) nextVersion(value ByteView) func(old ByteView) (ByteView, error) {
+	return func(old ByteView) (ByteView, error) {
+		value.version = c.versions.Add(1)
+		return value, nil
+	}
+}
+
+// SetIfVersion 只在 key 当前的版本号等于 expected 时写入 value，用于多个写入方通过缓存协调，
+// 而不需要额外的锁：读取时通过 ByteView.Version 得到版本号，写入时带上它，
+// 期间被其他写入方抢先修改过的值不会被覆盖。
+//
+// 版本号由 key 的拥有者节点分配：每次写入 maincache（加载、Set 或成功的 SetIfVersion）
+// 都会从 group 中单调递增的计数器取得比之前更大的版本号，不存在的 key 的版本号为 0。
+// 条目被删除、淘汰或过期之后再写入的值也会得到新的版本号，不会重新使用旧的版本号；
+// 计数器不随快照保存，节点重启之后重新开始。key 属于远程节点时，写入通过 PeerVersionSetter 转发给拥有者节点，
+// 同时删除本节点热点缓存中的旧副本。值的存活时间使用拥有者节点上 WithTTL 设置的默认值。
+//
+// 参数:
+//
+//	key: 要写入的键。
+//	value: 要写入的值，会被复制。
+//	expected: 期望的当前版本号，0 表示只在 key 不存在时写入。
+//
+// 返回值:
+//
+//	uint64: 写入成功之后值的版本号。
+//	error: 版本号不一致时返回 ErrVersionMismatch；其余错误与 Set 相同。
+func (g *Group) SetIfVersion(key string, value []byte, expected uint64) (uint64, error) {
+	return g.SetIfVersionContext(context.Background(), key, value, expected)
+}
+
+// SetIfVersionContext 与 SetIfVersion 相同，但 ctx 结束时转发给拥有者节点的请求会被取消。
+func (g *Group) SetIfVersionContext(ctx context.Context, key string, value []byte, expected uint64) (uint64, error) {
+	if g.destroyed.Load() {
+		return 0, ErrGroupDestroyed
+	}
+	key, err := g.canonicalKey(key)
+	if err != nil {
+		return 0, err
+	}
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(key); ok {
+			setter, ok := peer.(PeerVersionSetter)
+			if !ok {
+				return 0, fmt.Errorf("geecache: peer for %q does not support versioned set", key)
+			}
+			if max := g.maincache.maxValueBytes; max > 0 && int64(len(value)) > max {
+				return 0, ErrValueTooLarge
+			}
+			g.invalidate(key)
+			return setter.SetIfVersion(ctx, g.name, key, value, expected)
+		}
+	}
+	return g.setIfVersionLocally(key, value, expected)
+}
+
+// setIfVersionLocally 在本节点的主缓存上执行 SetIfVersion，用于本地的调用和来自其他节点的请求。
+//
+// 不经过缓存的 key 没有版本号，与 setLocally 一样什么也不写入并返回 0。
+func (g *Group) setIfVersionLocally(key string, value []byte, expected uint64) (uint64, error) {
+	g.invalidate(key)
+	if !g.cacheable(key) {
+		return 0, nil
+	}
+	view := ByteView{b: cloneBytes(value), expire: expireAfter(g.ttl)}
+	stored, err := g.maincache.update(key, false, func(old ByteView) (ByteView, error) {
+		if old.version != expected {
+			return ByteView{}, ErrVersionMismatch
+		}
+		view.version = g.maincache.versions.Add(1)
+		return view, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	g.enforceCacheBytes()
+	return stored.version, nil
+}
@@ -0,0 +1,512 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// OverflowPolicy 决定写回队列中的脏 key 达到上限时 PutBack 的行为，见 WithWriteBackLimit。
+type OverflowPolicy int
+
+const (
+	// OverflowBlock 让 PutBack 立即开始刷新全部脏 key，并等待到队列腾出空间或 ctx 结束，这是默认的策略。
+	OverflowBlock OverflowPolicy = iota
+	// OverflowReject 让 PutBack 返回 ErrWriteBackFull，缓存和数据源都不会被修改。
+	OverflowReject
+	// OverflowWriteThrough 让 PutBack 像 Put 一样同步写入数据源，不进入队列。
+	OverflowWriteThrough
+)
+
+const (
+	defaultMaxDirty         = 1024
+	defaultWriteBackEvery   = time.Second
+	defaultWriteBackBatch   = 64
+	defaultWriteBackWorkers = 4
+	defaultWriteBackRetries = 3
+	defaultWriteBackBase    = 100 * time.Millisecond
+)
+
+// ErrNoWriteBack 表示 Group 没有通过 WithWriteBack 启用写回，不能使用 PutBack。
+var ErrNoWriteBack = errors.New("geecache: write-back not enabled")
+
+// ErrWriteBackFull 表示写回队列已满，由使用 OverflowReject 的 PutBack 返回。
+var ErrWriteBackFull = errors.New("geecache: write-back queue full")
+
+// WriteBackQueue 记录通过 PutBack 写入、还没有写回数据源的脏 key，并在后台把它们写回 Setter。
+//
+// 脏 key 在以下时机被写回：它的条目离开主缓存（被淘汰、过期或删除）之后尽快写回；
+// 每隔 WithWriteBackInterval 设置的间隔写回全部脏 key；调用 Flush 时写回全部脏 key。
+// 同一个 key 在写回之前的多次 PutBack 只会写回最后一个值，
+// 同一个 key 同一时刻最多只有一次写入在进行，因此数据源看到的写入顺序与 PutBack 相同。
+//
+// 写回是异步的，以下情况会丢失数据：
+//   - 进程退出或崩溃时，队列中所有还没有写回的值都会丢失，最多相当于一个刷新间隔内的写入；
+//   - DestroyGroup 只停止后台刷新而不写回，需要先调用 Flush；
+//   - 重试用完仍然写入失败的值会留在队列中等待下一次刷新，在此之前同样只存在于内存中。
+type WriteBackQueue struct {
+	g           *Group
+	maxDirty    int
+	policy      OverflowPolicy
+	interval    time.Duration
+	batchSize   int
+	concurrency int
+	retries     int
+	retryBase   time.Duration
+
+	mu       sync.Mutex
+	dirty    map[string]ByteView // 等待写回的 key 及其最新的值
+	inflight map[string]ByteView // 正在写回的 key 及其值
+	urgent   []string            // 条目已经离开主缓存、需要尽快写回的脏 key
+	drain    bool                // 为 true 时下一次后台刷新写回全部脏 key
+	changed  chan struct{}       // dirty 或 inflight 变少时关闭并替换，用于等待
+	kick     chan struct{}       // 唤醒后台刷新
+	stop     chan struct{}       // 关闭后后台刷新退出
+	stopOnce sync.Once
+}
+
+// dirtyEntry 是一个正在写回的 key 及其值。
+type dirtyEntry struct {
+	key   string
+	value ByteView
+}
+
+// WriteBackOption 是 WithWriteBack 的配置项。
+type WriteBackOption func(*WriteBackQueue)
+
+// WithWriteBackLimit 设置写回队列中脏 key 的数量上限以及达到上限时的策略，默认为 1024 和 OverflowBlock。
+//
+// 参数:
+//
+//	n: 脏 key 的数量上限，小于 1 时使用默认值。
+//	policy: 达到上限时 PutBack 的行为。
+//
+// 返回值:
+//
+//	WriteBackOption: 可传递给 WithWriteBack 的配置项。
+func WithWriteBackLimit(n int, policy OverflowPolicy) WriteBackOption {
+	return func(q *WriteBackQueue) {
+		if n >= 1 {
+			q.maxDirty = n
+		}
+		q.policy = policy
+	}
+}
+
+// WithWriteBackInterval 设置定期写回全部脏 key 的间隔，默认为 1 秒。
+//
+// 参数:
+//
+//	d: 写回间隔，小于等于 0 时只在条目离开主缓存和调用 Flush 时写回。
+//
+// 返回值:
+//
+//	WriteBackOption: 可传递给 WithWriteBack 的配置项。
+func WithWriteBackInterval(d time.Duration) WriteBackOption {
+	return func(q *WriteBackQueue) {
+		q.interval = max(d, 0)
+	}
+}
+
+// WithWriteBackBatch 设置每批写回的 key 数量和同时写回的批数，默认为 64 和 4。
+// 一批中的 key 依次调用 Setter，不同的批并发执行，因此同时进行的 Setter 调用不超过 concurrency 个。
+//
+// 参数:
+//
+//	size: 每批的 key 数量，小于 1 时使用默认值。
+//	concurrency: 同时写回的批数，小于 1 时使用默认值。
+//
+// 返回值:
+//
+//	WriteBackOption: 可传递给 WithWriteBack 的配置项。
+func WithWriteBackBatch(size, concurrency int) WriteBackOption {
+	return func(q *WriteBackQueue) {
+		if size >= 1 {
+			q.batchSize = size
+		}
+		if concurrency >= 1 {
+			q.concurrency = concurrency
+		}
+	}
+}
+
+// WithWriteBackRetry 设置写回失败时的重试策略：最多重试 retries 次，第 i 次重试之前等待大约 base*2^i。
+// 默认重试 3 次，初始等待 100ms。
+//
+// 参数:
+//
+//	retries: 最大重试次数，小于 0 时按 0 处理。
+//	base: 第一次重试之前的等待时间，小于等于 0 时使用默认值。
+//
+// 返回值:
+//
+//	WriteBackOption: 可传递给 WithWriteBack 的配置项。
+func WithWriteBackRetry(retries int, base time.Duration) WriteBackOption {
+	return func(q *WriteBackQueue) {
+		q.retries = max(retries, 0)
+		if base > 0 {
+			q.retryBase = base
+		}
+	}
+}
+
+// WithWriteBack 为 Group 启用写回：PutBack 只写入缓存并把 key 记为脏，
+// 之后由 WriteBackQueue 批量写回 WithSetter 注册的 Setter，适合频繁更新的计数器等数据。
+//
+// 参数:
+//
+//	opts: 写回队列的配置项。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithWriteBack(opts ...WriteBackOption) GroupOption {
+	return func(g *Group) {
+		q := &WriteBackQueue{
+			maxDirty:    defaultMaxDirty,
+			interval:    defaultWriteBackEvery,
+			batchSize:   defaultWriteBackBatch,
+			concurrency: defaultWriteBackWorkers,
+			retries:     defaultWriteBackRetries,
+			retryBase:   defaultWriteBackBase,
+			dirty:       make(map[string]ByteView),
+			inflight:    make(map[string]ByteView),
+			changed:     make(chan struct{}),
+			kick:        make(chan struct{}, 1),
+			stop:        make(chan struct{}),
+		}
+		for _, opt := range opts {
+			opt(q)
+		}
+		g.writeBack = q
+	}
+}
+
+// WriteBack 返回 Group 的写回队列，没有启用 WithWriteBack 时返回 nil。
+func (g *Group) WriteBack() *WriteBackQueue {
+	return g.writeBack
+}
+
+// PutBack 以写回的方式写入 key：值立即写入本节点的主缓存，之后的 Get 可以读到它，
+// 而写入数据源的操作由 WriteBackQueue 在后台完成，见 WriteBackQueue 中的写回时机和数据丢失的情况。
+//
+// 脏状态只保存在本节点上，因此 key 属于远程节点时 PutBack 返回错误，这时应当使用 Put。
+// 被 WithCacheFilter 排除的 key 不经过缓存，与 Put 一样同步写入数据源。
+//
+// 参数:
+//
+//	ctx: 调用者的上下文，队列已满并使用 OverflowBlock 时用于放弃等待，同步写入时会传递给 Setter。
+//	key: 要写入的键。
+//	value: 要写入的值，调用方之后修改它不会影响缓存中的值。
+//
+// 返回值:
+//
+//	error: 没有启用写回时返回 ErrNoWriteBack，没有设置 Setter 时返回 ErrNoSetter，
+//	队列已满时按 OverflowPolicy 返回 ErrWriteBackFull、ctx.Err() 或同步写入的错误；
+//	值过大无法缓存时返回与 Set 相同的错误，此时 key 不会被记为脏。
+func (g *Group) PutBack(ctx context.Context, key string, value []byte) error {
+	if g.destroyed.Load() {
+		return ErrGroupDestroyed
+	}
+	q := g.writeBack
+	if q == nil {
+		return ErrNoWriteBack
+	}
+	if g.setter == nil {
+		return ErrNoSetter
+	}
+	key, err := g.canonicalKey(key)
+	if err != nil {
+		return err
+	}
+	if g.peers != nil {
+		if _, ok := g.peers.PickPeer(key); ok {
+			return fmt.Errorf("geecache: %q is owned by another node, use Put instead", key)
+		}
+	}
+	if !g.cacheable(key) {
+		return g.setter.Set(ctx, key, value)
+	}
+
+	view := ByteView{b: cloneBytes(value), expire: expireAfter(g.ttl)}
+	g.invalidate(key)
+	if _, err := g.maincache.update(key, false, g.maincache.nextVersion(view)); err != nil {
+		g.maincache.delete(key)
+		return err
+	}
+	g.enforceCacheBytes()
+
+	queued, err := q.mark(ctx, key, view)
+	if queued {
+		return nil
+	}
+	if err == nil {
+		// OverflowWriteThrough：队列已满，同步写入数据源
+		err = g.setter.Set(ctx, key, view.b)
+	}
+	if err != nil {
+		// 值既没有进入队列也没有写入数据源，不能留在缓存中
+		g.maincache.delete(key)
+	}
+	return err
+}
+
+// Len 返回队列中还没有写回完成的 key 的数量，包括正在写回的 key。
+func (q *WriteBackQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := len(q.inflight)
+	for key := range q.dirty {
+		if _, ok := q.inflight[key]; !ok {
+			n++
+		}
+	}
+	return n
+}
+
+// Flush 立即写回全部脏 key，并等待后台正在进行的写回结束，适合在关闭服务之前调用。
+//
+// 参数:
+//
+//	ctx: Flush 使用的上下文，会传递给 Setter；结束时 Flush 不再等待并返回 ctx.Err()。
+//
+// 返回值:
+//
+//	error: 有 key 写回失败时返回 KeyErrors，这些 key 仍然留在队列中。
+func (q *WriteBackQueue) Flush(ctx context.Context) error {
+	q.flush(ctx, q.take(true))
+	// 后台写回失败的 key 会回到 dirty，等它们结束之后再写回一次
+	for {
+		q.mu.Lock()
+		busy := len(q.inflight) > 0
+		changed := q.changed
+		q.mu.Unlock()
+		if !busy {
+			break
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return q.flush(ctx, q.take(true))
+}
+
+// start 把队列关联到 g，在主缓存的条目离开时唤醒写回，并启动后台刷新。
+// 它在 Group 的配置项全部应用之后、主缓存初始化之前调用。
+func (q *WriteBackQueue) start(g *Group) {
+	q.g = g
+	prev := g.maincache.handler
+	g.maincache.handler = func(key string, value ByteView, reason EvictionReason) {
+		if prev != nil {
+			prev(key, value, reason)
+		}
+		q.evicted(key)
+	}
+	go q.run()
+}
+
+// close 停止后台刷新，不写回队列中剩下的 key。
+func (q *WriteBackQueue) close() {
+	q.stopOnce.Do(func() { close(q.stop) })
+}
+
+// run 是后台刷新的主循环。
+func (q *WriteBackQueue) run() {
+	var tick <-chan time.Time
+	if q.interval > 0 {
+		ticker := time.NewTicker(q.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-tick:
+			q.flush(context.Background(), q.take(true))
+		case <-q.kick:
+			q.flush(context.Background(), q.take(false))
+		case <-q.stop:
+			return
+		}
+	}
+}
+
+// signal 唤醒后台刷新，已经有未处理的唤醒时什么也不做。
+func (q *WriteBackQueue) signal() {
+	select {
+	case q.kick <- struct{}{}:
+	default:
+	}
+}
+
+// broadcast 唤醒所有等待 changed 的调用方。调用方需要持有 q.mu。
+func (q *WriteBackQueue) broadcast() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// mark 把 key 记为脏，值为 view。已经是脏 key 时只替换它的值。
+//
+// 队列已满时按 policy 处理：OverflowBlock 等待腾出空间；OverflowReject 返回 ErrWriteBackFull；
+// OverflowWriteThrough 返回 queued 为 false、err 为 nil，由调用方同步写入。
+func (q *WriteBackQueue) mark(ctx context.Context, key string, view ByteView) (queued bool, err error) {
+	q.mu.Lock()
+	for {
+		if _, ok := q.dirty[key]; ok || len(q.dirty) < q.maxDirty {
+			q.dirty[key] = view
+			q.mu.Unlock()
+			return true, nil
+		}
+		switch q.policy {
+		case OverflowReject:
+			q.mu.Unlock()
+			return false, ErrWriteBackFull
+		case OverflowWriteThrough:
+			q.mu.Unlock()
+			return false, nil
+		}
+		q.drain = true
+		changed := q.changed
+		q.mu.Unlock()
+		q.signal()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+		q.mu.Lock()
+	}
+}
+
+// evicted 在 key 的条目离开主缓存时调用，key 是脏 key 时让后台尽快写回它。
+func (q *WriteBackQueue) evicted(key string) {
+	q.mu.Lock()
+	_, dirty := q.dirty[key]
+	if dirty {
+		q.urgent = append(q.urgent, key)
+	}
+	q.mu.Unlock()
+	if dirty {
+		q.signal()
+	}
+}
+
+// pending 返回 key 还没有写回完成的最新值，供加载时代替数据源中的旧值。对 nil 也可以调用。
+func (q *WriteBackQueue) pending(key string) (ByteView, bool) {
+	if q == nil {
+		return ByteView{}, false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if v, ok := q.dirty[key]; ok {
+		return v, true
+	}
+	v, ok := q.inflight[key]
+	return v, ok
+}
+
+// take 把要写回的脏 key 移入 inflight 并返回它们。all 为 false 时只取出需要尽快写回的 key，
+// 除非有 PutBack 正在等待队列腾出空间。正在写回的 key 留在 dirty 中，等下一次刷新。
+func (q *WriteBackQueue) take(all bool) []dirtyEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	keys := q.urgent
+	if all || q.drain {
+		keys = make([]string, 0, len(q.dirty))
+		for key := range q.dirty {
+			keys = append(keys, key)
+		}
+		q.drain = false
+	}
+	q.urgent = nil
+
+	var entries []dirtyEntry
+	for _, key := range keys {
+		v, ok := q.dirty[key]
+		if !ok {
+			continue
+		}
+		if _, busy := q.inflight[key]; busy {
+			continue
+		}
+		delete(q.dirty, key)
+		q.inflight[key] = v
+		entries = append(entries, dirtyEntry{key: key, value: v})
+	}
+	if len(entries) > 0 {
+		q.broadcast()
+	}
+	return entries
+}
+
+// flush 把 entries 分批写回 Setter，最多 concurrency 批同时进行。
+// 写回失败的 key 除非已经有了更新的值，否则会回到 dirty 中。
+func (q *WriteBackQueue) flush(ctx context.Context, entries []dirtyEntry) error {
+	var mu sync.Mutex
+	errs := make(KeyErrors)
+	sem := make(chan struct{}, q.concurrency)
+	var wg sync.WaitGroup
+	for start := 0; start < len(entries); start += q.batchSize {
+		batch := entries[start:min(start+q.batchSize, len(entries))]
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			for _, e := range batch {
+				err := q.write(ctx, e)
+				q.done(e, err)
+				if err != nil {
+					mu.Lock()
+					errs[e.key] = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// write 调用 Setter 写回一个 key，失败时按 WithWriteBackRetry 重试。
+func (q *WriteBackQueue) write(ctx context.Context, e dirtyEntry) error {
+	for attempt := 0; ; attempt++ {
+		err := q.g.setter.Set(ctx, e.key, e.value.b)
+		if err == nil || attempt >= q.retries || ctx.Err() != nil {
+			return err
+		}
+		d := q.retryBase << attempt
+		t := time.NewTimer(d/2 + rand.N(d))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// done 记录一个 key 写回的结果。
+func (q *WriteBackQueue) done(e dirtyEntry, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inflight, e.key)
+	if err != nil {
+		q.g.stats.writeBackErrs.Add(1)
+		if _, ok := q.dirty[e.key]; !ok {
+			q.dirty[e.key] = e.value
+		}
+	} else {
+		q.g.stats.writeBacks.Add(1)
+	}
+	q.broadcast()
+}
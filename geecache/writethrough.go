@@ -0,0 +1,86 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Setter 把值写入 Group 背后的数据源，与 Getter 相对，用于 Put 的写穿。
+type Setter interface {
+	Set(ctx context.Context, key string, value []byte) error
+}
+
+// SetterFunc 类型是一个函数类型，它实现了 Setter 接口。
+type SetterFunc func(ctx context.Context, key string, value []byte) error
+
+// Set 实现了 Setter 接口的 Set 方法。
+//
+// 参数:
+//
+//	ctx: Put 调用方的上下文。
+//	key: 要写入的键。
+//	value: 要写入的值。
+//
+// 返回值:
+//
+//	error: 如果写入过程中发生错误，则返回错误信息。
+func (f SetterFunc) Set(ctx context.Context, key string, value []byte) error {
+	return f(ctx, key, value)
+}
+
+// ErrNoSetter 表示 Group 没有通过 WithSetter 注册 Setter，不能使用 Put。
+var ErrNoSetter = errors.New("geecache: group has no setter")
+
+// WithSetter 为 Group 注册写穿使用的 Setter，见 Put。
+//
+// 参数:
+//
+//	s: 写入数据源的 Setter。
+//
+// 返回值:
+//
+//	GroupOption: 可传递给 NewGroup 的配置项。
+func WithSetter(s Setter) GroupOption {
+	return func(g *Group) {
+		g.setter = s
+	}
+}
+
+// Put 以写穿的方式写入 key：先通过 Setter 写入数据源，成功之后再像 Set 一样写入缓存，
+// key 属于远程节点时写入拥有者节点的缓存。写入数据源失败时缓存不会被修改。
+//
+// 数据源写入成功而缓存写入失败时（例如值超过 WithMaxValueBytes 的上限或拥有者节点不可用），
+// Put 会尝试删除各个节点上的旧值，使之后的 Get 从数据源重新加载，而不是继续返回旧值。
+//
+// 参数:
+//
+//	ctx: 调用者的上下文，会传递给 Setter。
+//	key: 要写入的键。
+//	value: 要写入的值，调用方之后修改它不会影响缓存中的值。
+//
+// 返回值:
+//
+//	error: 没有注册 Setter 时返回 ErrNoSetter；Setter 失败时透传它的错误；
+//	数据源写入成功但缓存写入失败时返回包装了缓存错误的错误；Group 已被销毁时返回 ErrGroupDestroyed。
+func (g *Group) Put(ctx context.Context, key string, value []byte) error {
+	if g.destroyed.Load() {
+		return ErrGroupDestroyed
+	}
+	if g.setter == nil {
+		return ErrNoSetter
+	}
+	key, err := g.canonicalKey(key)
+	if err != nil {
+		return err
+	}
+	if err := g.setter.Set(ctx, key, value); err != nil {
+		return err
+	}
+	if err := g.SetContext(ctx, key, value, 0); err != nil {
+		// 旧值已经与数据源不一致，不能留在缓存中
+		g.Remove(key)
+		return fmt.Errorf("geecache: %q stored but not cached: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,6 @@
+// Package geecachepb 定义 GeeCache 节点之间的协议使用的 protobuf 消息。
+//
+// geecachepb.pb.go 由 geecachepb.proto 生成，修改消息之后需要重新生成。
+package geecachepb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative geecachepb.proto
@@ -0,0 +1,266 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: geecachepb.proto
+
+package geecachepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Flag 是 GetResponse.flags 中的各位。
+type Flag int32
+
+const (
+	Flag_FLAG_NONE Flag = 0
+	// FLAG_NO_STORE 表示值只返回给请求方，不应被它缓存。
+	Flag_FLAG_NO_STORE Flag = 1
+)
+
+// Enum value maps for Flag.
+var (
+	Flag_name = map[int32]string{
+		0: "FLAG_NONE",
+		1: "FLAG_NO_STORE",
+	}
+	Flag_value = map[string]int32{
+		"FLAG_NONE":     0,
+		"FLAG_NO_STORE": 1,
+	}
+)
+
+func (x Flag) Enum() *Flag {
+	p := new(Flag)
+	*p = x
+	return p
+}
+
+func (x Flag) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Flag) Descriptor() protoreflect.EnumDescriptor {
+	return file_geecachepb_proto_enumTypes[0].Descriptor()
+}
+
+func (Flag) Type() protoreflect.EnumType {
+	return &file_geecachepb_proto_enumTypes[0]
+}
+
+func (x Flag) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Flag.Descriptor instead.
+func (Flag) EnumDescriptor() ([]byte, []int) {
+	return file_geecachepb_proto_rawDescGZIP(), []int{0}
+}
+
+// GetRequest 是节点之间获取一个 key 的请求。
+type GetRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Key           string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRequest) Reset() {
+	*x = GetRequest{}
+	mi := &file_geecachepb_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRequest) ProtoMessage() {}
+
+func (x *GetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_geecachepb_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRequest.ProtoReflect.Descriptor instead.
+func (*GetRequest) Descriptor() ([]byte, []int) {
+	return file_geecachepb_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GetRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *GetRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+// GetResponse 是拥有者节点对 GetRequest 的响应。
+type GetResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Value []byte                 `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	// ttl_ms 是值剩余的存活时间（毫秒），0 表示永不过期。
+	TtlMs int64 `protobuf:"varint,2,opt,name=ttl_ms,json=ttlMs,proto3" json:"ttl_ms,omitempty"`
+	// flags 是 FLAG_* 各位的组合。
+	Flags uint32 `protobuf:"varint,3,opt,name=flags,proto3" json:"flags,omitempty"`
+	// version 是拥有者节点上值的版本号，0 表示没有版本号。
+	Version       uint64 `protobuf:"varint,4,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetResponse) Reset() {
+	*x = GetResponse{}
+	mi := &file_geecachepb_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetResponse) ProtoMessage() {}
+
+func (x *GetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_geecachepb_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetResponse.ProtoReflect.Descriptor instead.
+func (*GetResponse) Descriptor() ([]byte, []int) {
+	return file_geecachepb_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetResponse) GetValue() []byte {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *GetResponse) GetTtlMs() int64 {
+	if x != nil {
+		return x.TtlMs
+	}
+	return 0
+}
+
+func (x *GetResponse) GetFlags() uint32 {
+	if x != nil {
+		return x.Flags
+	}
+	return 0
+}
+
+func (x *GetResponse) GetVersion() uint64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+var File_geecachepb_proto protoreflect.FileDescriptor
+
+const file_geecachepb_proto_rawDesc = "" +
+	"\n" +
+	"\x10geecachepb.proto\x12\n" +
+	"geecachepb\"4\n" +
+	"\n" +
+	"GetRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\"j\n" +
+	"\vGetResponse\x12\x14\n" +
+	"\x05value\x18\x01 \x01(\fR\x05value\x12\x15\n" +
+	"\x06ttl_ms\x18\x02 \x01(\x03R\x05ttlMs\x12\x14\n" +
+	"\x05flags\x18\x03 \x01(\rR\x05flags\x12\x18\n" +
+	"\aversion\x18\x04 \x01(\x04R\aversion*(\n" +
+	"\x04Flag\x12\r\n" +
+	"\tFLAG_NONE\x10\x00\x12\x11\n" +
+	"\rFLAG_NO_STORE\x10\x01B\x15Z\x13GeeCache/geecachepbb\x06proto3"
+
+var (
+	file_geecachepb_proto_rawDescOnce sync.Once
+	file_geecachepb_proto_rawDescData []byte
+)
+
+func file_geecachepb_proto_rawDescGZIP() []byte {
+	file_geecachepb_proto_rawDescOnce.Do(func() {
+		file_geecachepb_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_geecachepb_proto_rawDesc), len(file_geecachepb_proto_rawDesc)))
+	})
+	return file_geecachepb_proto_rawDescData
+}
+
+var file_geecachepb_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_geecachepb_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_geecachepb_proto_goTypes = []any{
+	(Flag)(0),           // 0: geecachepb.Flag
+	(*GetRequest)(nil),  // 1: geecachepb.GetRequest
+	(*GetResponse)(nil), // 2: geecachepb.GetResponse
+}
+var file_geecachepb_proto_depIdxs = []int32{
+	0, // [0:0] is the sub-list for method output_type
+	0, // [0:0] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_geecachepb_proto_init() }
+func file_geecachepb_proto_init() {
+	if File_geecachepb_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_geecachepb_proto_rawDesc), len(file_geecachepb_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_geecachepb_proto_goTypes,
+		DependencyIndexes: file_geecachepb_proto_depIdxs,
+		EnumInfos:         file_geecachepb_proto_enumTypes,
+		MessageInfos:      file_geecachepb_proto_msgTypes,
+	}.Build()
+	File_geecachepb_proto = out.File
+	file_geecachepb_proto_goTypes = nil
+	file_geecachepb_proto_depIdxs = nil
+}
@@ -0,0 +1,34 @@
+package geecachepb
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// 固定的编码来自第一版协议，消息的字段编号和类型改变时这个测试会失败，
+// 说明新旧版本的节点之间已经无法互相解码。
+func TestWireCompatibility(t *testing.T) {
+	for _, c := range []struct {
+		fixture string
+		msg     proto.Message
+		empty   proto.Message
+	}{
+		{"testdata/get_request.bin", &GetRequest{Group: "scores", Key: "Tom"}, &GetRequest{}},
+		{"testdata/get_response.bin", &GetResponse{Value: []byte("630"), TtlMs: 60000, Flags: uint32(Flag_FLAG_NO_STORE), Version: 7}, &GetResponse{}},
+	} {
+		want, err := os.ReadFile(c.fixture)
+		if err != nil {
+			t.Fatalf("read fixture: %v", err)
+		}
+		got, err := proto.MarshalOptions{Deterministic: true}.Marshal(c.msg)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("marshal %v = %x %v, want %x", c.msg, got, err, want)
+		}
+		if err := proto.Unmarshal(want, c.empty); err != nil || !proto.Equal(c.empty, c.msg) {
+			t.Fatalf("unmarshal %s = %v %v, want %v", c.fixture, c.empty, err, c.msg)
+		}
+	}
+}
@@ -1,3 +1,10 @@
 module GeeCache
 
 go 1.24.2
+
+require (
+	golang.org/x/net v0.41.0
+	google.golang.org/protobuf v1.36.12
+)
+
+require golang.org/x/text v0.26.0 // indirect
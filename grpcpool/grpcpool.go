@@ -0,0 +1,228 @@
+// Package grpcpool 提供基于 gRPC 的节点间传输，可以代替 geecache.HTTPPool。
+//
+// GRPCPool 实现了 geecache.PeerPicker，使用与 HTTPPool 相同的一致性哈希环选择 key 的拥有者，
+// 并为每个节点复用一个 *grpc.ClientConn；Register 在已有的 *grpc.Server 上注册处理其他节点请求的服务。
+// Group 只通过 PeerPicker 和 PeerGetter 与其他节点通信，因此换用 gRPC 不需要修改 Group 的代码：
+//
+//	pool := grpcpool.NewGRPCPool("10.0.0.1:8000")
+//	pool.Set("10.0.0.1:8000", "10.0.0.2:8000")
+//	group.RegisterPeers(pool)
+//
+//	s := grpc.NewServer()
+//	grpcpool.Register(s)
+//	s.Serve(lis)
+package grpcpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"GeeCache/consistenthash"
+	"GeeCache/geecache"
+	"GeeCache/geecachepb"
+	"GeeCache/grpcpool/grpcpoolpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// defaultReplicas 与 HTTPPool 使用的虚拟节点数相同，同一组节点在两种传输下对 key 的拥有者判断一致。
+const defaultReplicas = 50
+
+// GRPCPool 通过 gRPC 向其他节点请求 key 的值，实现了 geecache.PeerPicker 和 geecache.PeerListPicker。
+type GRPCPool struct {
+	self     string            // 本节点的地址，与 Set 中的地址使用相同的形式，例如 "10.0.0.1:8000"
+	dialOpts []grpc.DialOption // 创建 ClientConn 时使用的选项
+	mu       sync.Mutex        // 保护 peers 和 getters
+	peers    *consistenthash.Map
+	getters  map[string]*grpcGetter // 按节点地址索引的 grpcGetter
+}
+
+// Option 是 GRPCPool 的配置项，可以传递给 NewGRPCPool。
+type Option func(*GRPCPool)
+
+// WithDialOptions 设置创建到其他节点的 ClientConn 时使用的选项，例如用 grpc.WithTransportCredentials 启用 TLS。
+//
+// 默认不加密传输，与 HTTPPool 使用的 http.DefaultClient 相同；opts 在默认选项之后应用，可以覆盖它。
+//
+// 参数:
+//
+//	opts: 传递给 grpc.NewClient 的选项。
+//
+// 返回值:
+//
+//	Option: 可传递给 NewGRPCPool 的配置项。
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(p *GRPCPool) {
+		p.dialOpts = append(p.dialOpts, opts...)
+	}
+}
+
+// NewGRPCPool 为本节点创建一个 GRPCPool，创建之后需要调用 Set 设置集群中的节点。
+//
+// 参数:
+//
+//	self: 本节点的地址，与传给 Set 的地址使用相同的形式。
+//	opts: 可选的配置项。
+//
+// 返回值:
+//
+//	*GRPCPool: 一个指向新创建的 GRPCPool 实例的指针。
+func NewGRPCPool(self string, opts ...Option) *GRPCPool {
+	p := &GRPCPool{
+		self:     self,
+		dialOpts: []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Set 更新集群中的节点，peers 中包含本节点时它不会被选为其他 key 的远程节点。
+//
+// 仍在集群中的节点继续使用已有的 ClientConn，被移除的节点的 ClientConn 会被关闭，
+// 正在向它们发出的请求会失败。ClientConn 在第一次请求时才建立连接，因此节点暂时不可达不会使 Set 失败。
+//
+// 参数:
+//
+//	peers: 节点的地址，作为 grpc.NewClient 的 target。
+//
+// 返回值:
+//
+//	error: 某个地址无法创建 ClientConn 时返回错误，此时节点列表保持不变。
+func (p *GRPCPool) Set(peers ...string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	getters := make(map[string]*grpcGetter, len(peers))
+	for _, peer := range peers {
+		if peer == p.self {
+			continue
+		}
+		if g, ok := p.getters[peer]; ok {
+			getters[peer] = g
+			continue
+		}
+		if _, ok := getters[peer]; ok {
+			continue
+		}
+		conn, err := grpc.NewClient(peer, p.dialOpts...)
+		if err != nil {
+			for addr, g := range getters {
+				if _, ok := p.getters[addr]; !ok {
+					g.conn.Close()
+				}
+			}
+			return fmt.Errorf("grpcpool: peer %s: %w", peer, err)
+		}
+		getters[peer] = &grpcGetter{addr: peer, conn: conn, client: grpcpoolpb.NewPeerClient(conn)}
+	}
+	for addr, g := range p.getters {
+		if _, ok := getters[addr]; !ok {
+			g.conn.Close()
+		}
+	}
+
+	p.peers = consistenthash.New(defaultReplicas, nil)
+	p.peers.Add(peers...)
+	p.getters = getters
+	return nil
+}
+
+// PickPeer 实现了 geecache.PeerPicker 接口，返回 key 在哈希环上的拥有者，拥有者是本节点时 ok 为 false。
+func (p *GRPCPool) PickPeer(key string) (geecache.PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.peers == nil {
+		return nil, false
+	}
+	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+		return p.getters[peer], true
+	}
+	return nil, false
+}
+
+// PickPeers 实现了 geecache.PeerListPicker 接口，返回 key 在哈希环上最多 n 个相继的拥有者，遇到本节点时停止。
+func (p *GRPCPool) PickPeers(key string, n int) []geecache.PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.peers == nil {
+		return nil
+	}
+	var getters []geecache.PeerGetter
+	for _, peer := range p.peers.GetN(key, n) {
+		if peer == p.self {
+			break
+		}
+		getters = append(getters, p.getters[peer])
+	}
+	return getters
+}
+
+// Close 关闭到所有节点的 ClientConn。之后仍可以调用 Set 重新设置节点。
+//
+// 返回值:
+//
+//	error: 关闭某个 ClientConn 失败时返回它的错误。
+func (p *GRPCPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var errs []error
+	for _, g := range p.getters {
+		if err := g.conn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	p.peers = nil
+	p.getters = nil
+	return errors.Join(errs...)
+}
+
+// grpcGetter 通过一个 ClientConn 向某个节点发出请求，实现了 geecache.PeerGetter 以及
+// geecache.PeerTTLGetter 和 geecache.PeerResultGetter。
+type grpcGetter struct {
+	addr   string
+	conn   *grpc.ClientConn
+	client grpcpoolpb.PeerClient
+}
+
+// String 返回节点的地址，用作指标中的节点名称。
+func (g *grpcGetter) String() string {
+	return g.addr
+}
+
+// Get 实现了 geecache.PeerGetter 接口，ctx 结束时请求被取消。
+func (g *grpcGetter) Get(ctx context.Context, group string, key string) ([]byte, error) {
+	r, err := g.GetResult(ctx, group, key)
+	return r.Value, err
+}
+
+// GetTTL 实现了 geecache.PeerTTLGetter 接口。
+func (g *grpcGetter) GetTTL(ctx context.Context, group string, key string) ([]byte, time.Duration, error) {
+	r, err := g.GetResult(ctx, group, key)
+	return r.Value, r.TTL, err
+}
+
+// GetResult 实现了 geecache.PeerResultGetter 接口。
+//
+// 拥有者返回 NOT_FOUND 时，返回的错误满足 errors.Is(err, geecache.ErrNotFound)；
+// 返回 UNAVAILABLE 时错误被视为暂时性的网络错误，可以被 WithPeerRetry 重试。
+func (g *grpcGetter) GetResult(ctx context.Context, group string, key string) (geecache.PeerResult, error) {
+	rsp, err := g.client.Get(ctx, &geecachepb.GetRequest{Group: group, Key: key})
+	if err != nil {
+		return geecache.PeerResult{}, fromStatus(err)
+	}
+	return geecache.PeerResult{
+		Value:   rsp.GetValue(),
+		TTL:     time.Duration(rsp.GetTtlMs()) * time.Millisecond,
+		NoStore: rsp.GetFlags()&uint32(geecachepb.Flag_FLAG_NO_STORE) != 0,
+		Version: rsp.GetVersion(),
+	}, nil
+}
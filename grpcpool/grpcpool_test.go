@@ -0,0 +1,145 @@
+package grpcpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"GeeCache/geecache"
+
+	"google.golang.org/grpc"
+)
+
+// node 是测试中的一个节点：独立的 Registry、监听本地端口的 gRPC 服务端和指向其他节点的 GRPCPool。
+type node struct {
+	addr  string
+	pool  *GRPCPool
+	group *geecache.Group
+	loads atomic.Int64
+}
+
+// startNodes 在本进程中启动 n 个节点，每个节点都有名为 scores 的 Group，getter 把 key 当作值返回，
+// key 以 "missing" 开头时返回 ErrNotFound。热点缓存被关闭，使请求方是否缓存值不受随机抽样影响。
+func startNodes(t *testing.T, n int) []*node {
+	t.Helper()
+	nodes := make([]*node, n)
+	addrs := make([]string, n)
+	for i := range nodes {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		nd := &node{addr: lis.Addr().String()}
+		registry := geecache.NewRegistry()
+		nd.group = registry.NewGroup("scores", 2<<10, geecache.GetterFunc(
+			func(key string) ([]byte, error) {
+				nd.loads.Add(1)
+				if len(key) >= 7 && key[:7] == "missing" {
+					return nil, fmt.Errorf("%s: %w", key, geecache.ErrNotFound)
+				}
+				return []byte(nd.addr + ":" + key), nil
+			}), geecache.WithTTL(time.Minute), geecache.WithHotCacheRate(0))
+		s := grpc.NewServer()
+		Register(s, WithRegistry(registry))
+		go s.Serve(lis)
+		t.Cleanup(s.Stop)
+		nodes[i], addrs[i] = nd, nd.addr
+	}
+	for _, nd := range nodes {
+		nd.pool = NewGRPCPool(nd.addr)
+		if err := nd.pool.Set(addrs...); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { nd.pool.Close() })
+		nd.group.RegisterPeers(nd.pool)
+	}
+	return nodes
+}
+
+// ownedBy 返回一个以 prefix 开头、在哈希环上由 owner 拥有的 key。
+func ownedBy(t *testing.T, from *node, owner *node, prefix string) string {
+	t.Helper()
+	for i := range 1000 {
+		key := fmt.Sprintf("%s%d", prefix, i)
+		if peer, ok := from.pool.PickPeer(key); ok && peer.(*grpcGetter).addr == owner.addr {
+			return key
+		}
+	}
+	t.Fatalf("no key owned by %s", owner.addr)
+	return ""
+}
+
+func TestExchangeKey(t *testing.T) {
+	nodes := startNodes(t, 2)
+	a, b := nodes[0], nodes[1]
+
+	key := ownedBy(t, a, b, "key")
+	for range 2 {
+		v, err := a.group.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := b.addr + ":" + key; v.String() != want {
+			t.Fatalf("Get(%q) = %q, want %q", key, v.String(), want)
+		}
+	}
+	if n := b.loads.Load(); n != 1 {
+		t.Errorf("owner loaded %d times, want 1", n)
+	}
+	if n := a.loads.Load(); n != 0 {
+		t.Errorf("requester loaded %d times, want 0", n)
+	}
+	// 不是热点的值只缓存在拥有者上，两次 Get 都请求了拥有者
+	if s := a.group.Stats(); s.PeerLoads != 2 {
+		t.Errorf("requester PeerLoads = %d, want 2", s.PeerLoads)
+	}
+	if s := b.group.Stats(); s.ServerRequests != 2 {
+		t.Errorf("owner ServerRequests = %d, want 2", s.ServerRequests)
+	}
+
+	// 值带着拥有者剩余的存活时间回到请求方
+	r, err := a.pool.getters[b.addr].GetResult(t.Context(), "scores", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.TTL <= 0 || r.TTL > time.Minute {
+		t.Errorf("TTL = %v, want within (0, 1m]", r.TTL)
+	}
+
+	missing := ownedBy(t, a, b, "missing")
+	if _, err := a.group.Get(missing); !errors.Is(err, geecache.ErrNotFound) {
+		t.Errorf("Get(%q) error = %v, want ErrNotFound", missing, err)
+	}
+	if n := a.loads.Load(); n != 0 {
+		t.Errorf("requester fell back to its getter %d times", n)
+	}
+
+	if _, err := a.pool.getters[b.addr].Get(context.Background(), "no-such-group", key); err == nil || errors.Is(err, geecache.ErrNotFound) {
+		t.Errorf("Get from unknown group error = %v, want a non-NotFound error", err)
+	}
+}
+
+func TestSetReusesConns(t *testing.T) {
+	p := NewGRPCPool("127.0.0.1:1")
+	defer p.Close()
+	if err := p.Set("127.0.0.1:1", "127.0.0.1:2", "127.0.0.1:3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.getters["127.0.0.1:1"]; ok {
+		t.Error("self has a getter")
+	}
+	kept := p.getters["127.0.0.1:2"]
+	if err := p.Set("127.0.0.1:1", "127.0.0.1:2"); err != nil {
+		t.Fatal(err)
+	}
+	if p.getters["127.0.0.1:2"] != kept {
+		t.Error("Set replaced the conn of a peer that stayed")
+	}
+	if _, ok := p.getters["127.0.0.1:3"]; ok {
+		t.Error("removed peer still has a getter")
+	}
+}
@@ -0,0 +1,6 @@
+// Package grpcpoolpb 定义 grpcpool 使用的 gRPC 服务，消息复用 geecachepb 中的定义。
+//
+// peer.pb.go 和 peer_grpc.pb.go 由 peer.proto 生成，修改服务之后需要重新生成。
+package grpcpoolpb
+
+//go:generate protoc -I . -I ../../geecachepb --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative peer.proto
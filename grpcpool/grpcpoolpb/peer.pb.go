@@ -0,0 +1,69 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: peer.proto
+
+package grpcpoolpb
+
+import (
+	geecachepb "GeeCache/geecachepb"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+var File_peer_proto protoreflect.FileDescriptor
+
+const file_peer_proto_rawDesc = "" +
+	"\n" +
+	"\n" +
+	"peer.proto\x12\n" +
+	"grpcpoolpb\x1a\x10geecachepb.proto2>\n" +
+	"\x04Peer\x126\n" +
+	"\x03Get\x12\x16.geecachepb.GetRequest\x1a\x17.geecachepb.GetResponseB\x1eZ\x1cGeeCache/grpcpool/grpcpoolpbb\x06proto3"
+
+var file_peer_proto_goTypes = []any{
+	(*geecachepb.GetRequest)(nil),  // 0: geecachepb.GetRequest
+	(*geecachepb.GetResponse)(nil), // 1: geecachepb.GetResponse
+}
+var file_peer_proto_depIdxs = []int32{
+	0, // 0: grpcpoolpb.Peer.Get:input_type -> geecachepb.GetRequest
+	1, // 1: grpcpoolpb.Peer.Get:output_type -> geecachepb.GetResponse
+	1, // [1:2] is the sub-list for method output_type
+	0, // [0:1] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_peer_proto_init() }
+func file_peer_proto_init() {
+	if File_peer_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_peer_proto_rawDesc), len(file_peer_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   0,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_peer_proto_goTypes,
+		DependencyIndexes: file_peer_proto_depIdxs,
+	}.Build()
+	File_peer_proto = out.File
+	file_peer_proto_goTypes = nil
+	file_peer_proto_depIdxs = nil
+}
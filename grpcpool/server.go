@@ -0,0 +1,159 @@
+package grpcpool
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"GeeCache/geecache"
+	"GeeCache/geecachepb"
+	"GeeCache/grpcpool/grpcpoolpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ServerOption 是 Register 的配置项。
+type ServerOption func(*server)
+
+// WithRegistry 让服务从 r 而不是默认的 Registry 中查找 Group，与 geecache.WithRegistry 对应。
+//
+// 参数:
+//
+//	r: 查找 Group 使用的 Registry。
+//
+// 返回值:
+//
+//	ServerOption: 可传递给 Register 的配置项。
+func WithRegistry(r *geecache.Registry) ServerOption {
+	return func(s *server) {
+		s.registry = r
+	}
+}
+
+// Register 在 s 上注册处理其他节点请求的 Peer 服务，应当在 s.Serve 之前调用。
+//
+// 收到的请求由 Group.ServePeer 处理，只在本节点查找或加载，不会再转发给其他节点。
+// key 不存在时返回 NOT_FOUND，Group 不存在时返回 FAILED_PRECONDITION，key 被拒绝时返回 INVALID_ARGUMENT。
+//
+// 参数:
+//
+//	s: 已有的 gRPC 服务端，可以同时注册其他服务。
+//	opts: 可选的配置项。
+func Register(s *grpc.Server, opts ...ServerOption) {
+	srv := &server{}
+	for _, opt := range opts {
+		opt(srv)
+	}
+	grpcpoolpb.RegisterPeerServer(s, srv)
+}
+
+// server 实现了 grpcpoolpb.PeerServer。
+type server struct {
+	grpcpoolpb.UnimplementedPeerServer
+	registry *geecache.Registry // 为 nil 时使用默认的 Registry
+}
+
+// group 返回名为 name 的 Group，不存在时返回 nil。
+func (s *server) group(name string) *geecache.Group {
+	if s.registry != nil {
+		return s.registry.GetGroup(name)
+	}
+	return geecache.GetGroup(name)
+}
+
+// Get 实现了 grpcpoolpb.PeerServer 接口。
+func (s *server) Get(ctx context.Context, in *geecachepb.GetRequest) (*geecachepb.GetResponse, error) {
+	group := s.group(in.GetGroup())
+	if group == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "no such group: %s", in.GetGroup())
+	}
+	r, err := group.ServePeer(ctx, in.GetKey())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	out := &geecachepb.GetResponse{Value: r.Value, Version: r.Version}
+	if r.TTL > 0 {
+		// 向上取整，不足 1 毫秒的剩余时间不能被当作永不过期
+		out.TtlMs = int64((r.TTL + time.Millisecond - 1) / time.Millisecond)
+	}
+	if r.NoStore {
+		out.Flags |= uint32(geecachepb.Flag_FLAG_NO_STORE)
+	}
+	return out, nil
+}
+
+// toStatus 把 Group.ServePeer 返回的错误转换为 gRPC 状态。
+func toStatus(err error) error {
+	var code codes.Code
+	switch {
+	case errors.Is(err, geecache.ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, geecache.ErrInvalidKey):
+		code = codes.InvalidArgument
+	case errors.Is(err, geecache.ErrTooManyLoads):
+		code = codes.ResourceExhausted
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	default:
+		code = codes.Internal
+	}
+	return status.Error(code, err.Error())
+}
+
+// fromStatus 把请求返回的 gRPC 状态转换为 Group 能够识别的错误。
+func fromStatus(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch st.Code() {
+	case codes.NotFound:
+		// 保留拥有者节点上的错误信息，同时让 errors.Is(err, geecache.ErrNotFound) 成立
+		return notFoundError(st.Message())
+	case codes.Unavailable:
+		return &unavailableError{err: err}
+	}
+	return err
+}
+
+// notFoundError 是拥有者节点返回 NOT_FOUND 时的错误。
+type notFoundError string
+
+// Error 实现了 error 接口。
+func (e notFoundError) Error() string {
+	return string(e)
+}
+
+// Is 使 errors.Is(err, geecache.ErrNotFound) 成立。
+func (e notFoundError) Is(target error) bool {
+	return target == geecache.ErrNotFound
+}
+
+// unavailableError 是拥有者节点不可达时的错误，它实现了 net.Error，因此会被 geecache.WithPeerRetry 重试。
+type unavailableError struct {
+	err error
+}
+
+// Error 实现了 error 接口。
+func (e *unavailableError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap 返回 gRPC 状态错误，status.FromError 仍然可以取得它。
+func (e *unavailableError) Unwrap() error {
+	return e.err
+}
+
+// Timeout 实现了 net.Error 接口。
+func (e *unavailableError) Timeout() bool {
+	return false
+}
+
+// Temporary 实现了 net.Error 接口。
+func (e *unavailableError) Temporary() bool {
+	return true
+}
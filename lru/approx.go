@@ -0,0 +1,366 @@
+package lru
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"time"
+)
+
+// DefaultSamples 是 Approx 在未指定采样数量时，每次淘汰所采样的条目数。
+const DefaultSamples = 5
+
+// oldestSamples 是 Approx 估计最久未使用的条目的闲置时长时采样的条目数。
+const oldestSamples = 64
+
+// Approx 是一个近似 LRU 缓存，提供与 Cache 相同的公开方法。
+//
+// 它不使用双向链表，而是为每个条目记录最近一次访问的逻辑时间戳；
+// 需要淘汰时从哈希表中随机采样 Samples 个条目，淘汰其中最久未访问的一个
+// （与 Redis 的近似 LRU 相同）。这样可以省去链表节点的内存开销，
+// Get 也只需要更新一个时间戳。它不是并发安全的。
+type Approx struct {
+	maxBytes  int64
+	nBytes    int64
+	clock     uint64 // 逻辑时钟，每次访问递增
+	cache     map[string]*approxEntry
+	Samples   int                                 // 每次淘汰采样的条目数，小于 1 时使用 DefaultSamples
+	OnEvicted func(key string, value Value)       // 某个条目被移除时的回调函数，可以为 nil
+	OnExpired func(key string, value Value)       // 某个条目因过期被删除时的回调函数，可以为 nil
+	OnRemoved func(key string, value Value)       // 某个条目被 Remove 主动删除时的回调函数，为 nil 时调用 OnEvicted
+	Decode    func(data []byte) Value             // Load 从快照恢复条目时用于构造值，可以为 nil
+	Events    Events                              // 缓存事件钩子，为 nil 时不做任何处理
+	Cost      func(key string, value Value) int64 // 计算条目开销的函数，为 nil 时使用键和值的长度之和
+	hits      int64
+	misses    int64
+	evictions int64
+	expired   int64
+}
+
+// approxEntry 是 Approx 中存储的条目，access 为最近一次访问的逻辑时间，0 表示冷条目。
+type approxEntry struct {
+	Entry
+	access uint64
+}
+
+// NewApprox 创建并返回一个新的 Approx 实例。
+//
+// 参数:
+//
+//	maxBytes: 缓存的最大容量（以字节为单位）。如果为 0，表示不限制容量。
+//	OnEvicted: 当一个条目被淘汰时调用的回调函数。可以为 nil。
+//
+// 返回值:
+//
+//	*Approx: 一个指向新创建的 Approx 实例的指针。
+func NewApprox(maxBytes int64, OnEvicted func(key string, value Value)) *Approx {
+	return &Approx{
+		maxBytes:  maxBytes,
+		cache:     make(map[string]*approxEntry),
+		OnEvicted: OnEvicted,
+	}
+}
+
+// size 计算一个键值对的开销，规则与 Cache 相同。
+func (c *Approx) size(key string, value Value) int64 {
+	if c.Cost != nil {
+		return c.Cost(key, value)
+	}
+	return int64(value.Len()) + int64(len(key))
+}
+
+// events 返回当前生效的事件钩子，未设置时返回 NopEvents。
+func (c *Approx) events() Events {
+	if c.Events == nil {
+		return NopEvents{}
+	}
+	return c.Events
+}
+
+// tick 推进逻辑时钟并返回新的时间戳。
+func (c *Approx) tick() uint64 {
+	c.clock++
+	return c.clock
+}
+
+// access 记录对 e 的一次访问。
+func (c *Approx) access(e *approxEntry) {
+	e.access = c.tick()
+	e.used = now()
+}
+
+// Get 根据键查找对应的值，并刷新条目的访问时间戳。
+// 已过期的条目会在此时被删除并按未命中处理，同时调用 OnExpired。
+func (c *Approx) Get(key string) (Value, bool) {
+	if e, ok := c.cache[key]; ok && !c.expireIfNeeded(e) {
+		c.access(e)
+		c.hits++
+		c.events().OnHit(key)
+		return e.value, true
+	}
+	c.misses++
+	c.events().OnMiss(key)
+	return nil, false
+}
+
+// Peek 根据键查找对应的值，但不修改缓存的任何状态，语义与 Cache.Peek 相同。
+func (c *Approx) Peek(key string) (Value, bool) {
+	if e, ok := c.cache[key]; ok && !e.expiredAt(now()) {
+		return e.value, true
+	}
+	return nil, false
+}
+
+// Promote 补记一次对 key 的命中，语义与 Cache.Promote 相同。
+func (c *Approx) Promote(key string) bool {
+	e, ok := c.cache[key]
+	if !ok {
+		return false
+	}
+	c.access(e)
+	c.hits++
+	c.events().OnHit(key)
+	return true
+}
+
+// Touch 刷新条目的访问时间戳和 TTL，但不读取它的值，也不计入命中统计。
+func (c *Approx) Touch(key string) bool {
+	if e, ok := c.cache[key]; ok && !c.expireIfNeeded(e) {
+		c.access(e)
+		if e.ttl > 0 {
+			e.expire = now().Add(e.ttl)
+		}
+		return true
+	}
+	return false
+}
+
+// Add 向缓存中添加或更新一个键值对，过大的条目会被忽略。
+func (c *Approx) Add(key string, value Value) {
+	_ = c.AddE(key, value)
+}
+
+// AddE 与 Add 相同，但在条目超过容量时返回 ErrEntryTooLarge。
+func (c *Approx) AddE(key string, value Value) error {
+	return c.add(key, value, 0, false)
+}
+
+// AddWithTTL 向缓存中添加或更新一个会在 ttl 之后过期的键值对。
+func (c *Approx) AddWithTTL(key string, value Value, ttl time.Duration) error {
+	return c.add(key, value, ttl, false)
+}
+
+// AddCold 以“冷”方式添加或更新一个键值对。
+// 新条目的访问时间戳为 0，在被读取之前总是采样中最先被淘汰的条目。
+func (c *Approx) AddCold(key string, value Value) error {
+	return c.add(key, value, 0, true)
+}
+
+// add 是各个写入方法的共同实现。
+func (c *Approx) add(key string, value Value, ttl time.Duration, cold bool) error {
+	size := c.size(key, value)
+	if c.maxBytes != 0 && size > c.maxBytes {
+		return ErrEntryTooLarge
+	}
+	e, ok := c.cache[key]
+	if ok {
+		c.nBytes -= c.size(e.key, e.value)
+		e.value = value
+	} else {
+		e = &approxEntry{Entry: Entry{key: key, value: value}}
+		c.cache[key] = e
+	}
+	e.setTTL(ttl)
+	if cold {
+		e.used = now()
+	} else {
+		c.access(e)
+	}
+	c.nBytes += size
+	c.events().OnAdd(key, value)
+
+	for c.maxBytes != 0 && c.nBytes > c.maxBytes {
+		c.evictSample(e)
+	}
+	return nil
+}
+
+// evictSample 随机采样若干条目，淘汰其中访问时间戳最小的一个。
+// 当缓存中还有其他条目时，刚写入的 keep 不会被淘汰。
+func (c *Approx) evictSample(keep *approxEntry) {
+	samples := c.Samples
+	if samples < 1 {
+		samples = DefaultSamples
+	}
+	var victim *approxEntry
+	n := 0
+	// map 的遍历顺序是随机的，取前 samples 个条目即可得到随机样本
+	for _, e := range c.cache {
+		if e == keep && len(c.cache) > 1 {
+			continue
+		}
+		if victim == nil || e.access < victim.access {
+			victim = e
+		}
+		if n++; n >= samples {
+			break
+		}
+	}
+	if victim == nil {
+		return
+	}
+	c.removeEntry(victim)
+	c.evictions++
+	c.events().OnEvict(victim.key, victim.value)
+	if c.OnEvicted != nil {
+		c.OnEvicted(victim.key, victim.value)
+	}
+}
+
+// RemoveOldest 按采样规则淘汰一个近似最久未使用的条目。
+func (c *Approx) RemoveOldest() {
+	c.evictSample(nil)
+}
+
+// Remove 从缓存中删除指定的键，并调用 OnRemoved 或 OnEvicted。主动删除不计入淘汰次数。
+func (c *Approx) Remove(key string) bool {
+	e, ok := c.cache[key]
+	if !ok {
+		return false
+	}
+	c.removeEntry(e)
+	if c.OnRemoved != nil {
+		c.OnRemoved(e.key, e.value)
+	} else if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+	return true
+}
+
+// removeEntry 将条目从哈希表中删除并更新已用字节数。
+func (c *Approx) removeEntry(e *approxEntry) {
+	delete(c.cache, e.key)
+	c.nBytes -= c.size(e.key, e.value)
+}
+
+// RemoveExpired 删除所有已过期的条目，并返回删除的数量。
+func (c *Approx) RemoveExpired() int {
+	t := now()
+	n := 0
+	for _, e := range c.cache {
+		if e.expiredAt(t) {
+			c.expire(e)
+			n++
+		}
+	}
+	return n
+}
+
+// expireIfNeeded 在条目已过期时将其删除，并返回它是否已过期。
+func (c *Approx) expireIfNeeded(e *approxEntry) bool {
+	if !e.expiredAt(now()) {
+		return false
+	}
+	c.expire(e)
+	return true
+}
+
+// expire 删除一个已过期的条目并调用 OnExpired。
+func (c *Approx) expire(e *approxEntry) {
+	c.removeEntry(e)
+	c.expired++
+	if c.OnExpired != nil {
+		c.OnExpired(e.key, e.value)
+	}
+}
+
+// Clear 删除缓存中的全部条目，语义与 Cache.Clear 相同。
+func (c *Approx) Clear() {
+	c.cache = make(map[string]*approxEntry)
+	c.nBytes = 0
+}
+
+// Len 返回缓存中当前的条目数量。
+func (c *Approx) Len() int {
+	return len(c.cache)
+}
+
+// Bytes 返回缓存当前已用的字节数。
+func (c *Approx) Bytes() int64 {
+	return c.nBytes
+}
+
+// MaxBytes 返回缓存允许使用的最大字节数，0 表示不限制容量。
+func (c *Approx) MaxBytes() int64 {
+	return c.maxBytes
+}
+
+// Stats 返回缓存当前的统计信息。
+func (c *Approx) Stats() Stats {
+	return Stats{
+		Entries:   len(c.cache),
+		Bytes:     c.nBytes,
+		MaxBytes:  c.maxBytes,
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Expired:   c.expired,
+		OldestAge: c.oldestAge(),
+	}
+}
+
+// oldestAge 估计最久未使用的条目的闲置时长：与淘汰时一样随机采样，取其中最旧的一个。
+func (c *Approx) oldestAge() time.Duration {
+	var oldest time.Time
+	n := 0
+	for _, e := range c.cache {
+		if oldest.IsZero() || e.used.Before(oldest) {
+			oldest = e.used
+		}
+		if n++; n >= oldestSamples {
+			break
+		}
+	}
+	if oldest.IsZero() {
+		return 0
+	}
+	return now().Sub(oldest)
+}
+
+// Save 将缓存中的全部条目按访问时间戳从旧到新写入 w，格式与 Cache.Save 相同。
+func (c *Approx) Save(w io.Writer) error {
+	entries := make([]*approxEntry, 0, len(c.cache))
+	for _, e := range c.cache {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].access < entries[j].access
+	})
+
+	l := New(0, nil)
+	for _, e := range entries {
+		l.cache[e.key] = l.ll.PushFront(&e.Entry)
+	}
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(snapshotMagic); err != nil {
+		return err
+	}
+	if err := l.writeEntries(bw); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Load 从 r 中读取快照，并把条目依次加入缓存，语义与 Cache.Load 相同。
+func (c *Approx) Load(r io.Reader) error {
+	decode := func(data []byte) Value {
+		if c.Decode != nil {
+			return c.Decode(data)
+		}
+		return Bytes(data)
+	}
+	return readSnapshot(r, decode, func(key string, value Value, ttl time.Duration) {
+		_ = c.add(key, value, ttl, false)
+	})
+}
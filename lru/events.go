@@ -0,0 +1,26 @@
+package lru
+
+// Events 是缓存事件的钩子接口，可用于日志、计数或链路追踪。
+// 这些方法在 Cache 的操作过程中被同步调用，实现应当尽量轻量。
+type Events interface {
+	OnAdd(key string, value Value)   // 新增或更新一个条目后调用
+	OnHit(key string)                // Get 命中时调用
+	OnMiss(key string)               // Get 未命中时调用
+	OnEvict(key string, value Value) // 条目因容量限制被淘汰时调用
+}
+
+// NopEvents 是 Events 的空实现，也是 Cache 的默认钩子。
+type NopEvents struct{}
+
+func (NopEvents) OnAdd(key string, value Value)   {}
+func (NopEvents) OnHit(key string)                {}
+func (NopEvents) OnMiss(key string)               {}
+func (NopEvents) OnEvict(key string, value Value) {}
+
+// events 返回当前生效的事件钩子，未设置时返回 NopEvents。
+func (c *Cache) events() Events {
+	if c.Events == nil {
+		return NopEvents{}
+	}
+	return c.Events
+}
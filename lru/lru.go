@@ -2,17 +2,30 @@ package lru
 
 import (
     "container/list"
-    "fmt"
+    "errors"
+    "time"
 )
 
+// ErrEntryTooLarge 表示单个条目的大小超过了缓存的最大容量，无法被缓存。
+var ErrEntryTooLarge = errors.New("lru: entry larger than cache capacity")
+
 // Cache 是一个采用 LRU (最近最少使用) 策略的缓存结构体。
 // 它不是并发安全的。
 type Cache struct {
-    maxBytes  int64                         // 表示缓存能存储的最大字节数上限
-    nBytes    int64                         // 已经存储的字节数
-    ll        *list.List                    // 使用标准库的双向链表作为缓存队列
-    cache     map[string]*list.Element      // 哈希表，用于存储键到链表节点的映射
-    OnEvicted func(key string, value Value) // 某个条目被移除时的回调函数，可以为 nil
+    maxBytes  int64                               // 表示缓存能存储的最大字节数上限
+    nBytes    int64                               // 已经存储的字节数
+    ll        *list.List                          // 使用标准库的双向链表作为缓存队列
+    cache     map[string]*list.Element            // 哈希表，用于存储键到链表节点的映射
+    OnEvicted func(key string, value Value)       // 某个条目被移除时的回调函数，可以为 nil
+    Decode    func(data []byte) Value             // Load 从快照恢复条目时用于构造值，可以为 nil
+    Events    Events                              // 缓存事件钩子，为 nil 时不做任何处理
+    Cost      func(key string, value Value) int64 // 计算条目开销的函数，为 nil 时使用键和值的长度之和
+    OnExpired func(key string, value Value)       // 某个条目因过期被删除时的回调函数，可以为 nil
+    OnRemoved func(key string, value Value)       // 某个条目被 Remove 主动删除时的回调函数，为 nil 时调用 OnEvicted
+    hits      int64                               // Get 命中的次数
+    misses    int64                               // Get 未命中的次数
+    evictions int64                               // 因容量限制被淘汰的条目数
+    expired   int64                               // 因过期被删除的条目数
 }
 
 // Value 是一个接口，用于计算一个值所占用的内存大小。
@@ -24,8 +37,11 @@ type Value interface {
 // Entry 是双向链表中存储的数据类型。
 // 它包含键和值，方便在淘汰队尾节点时，能通过键从哈希表中删除映射。
 type Entry struct {
-    key   string
-    value Value
+    key    string
+    value  Value
+    expire time.Time     // 过期时间，零值表示永不过期
+    ttl    time.Duration // 写入时指定的存活时间，Touch 时用于重置过期时间
+    used   time.Time     // 最近一次写入或访问的时间，用于报告最久未使用的条目的闲置时长
 }
 
 // New 创建并返回一个新的 Cache 实例。
@@ -56,7 +72,17 @@ func New(maxBytes int64, OnEvicted func(key string, value Value)) *Cache {
 // 参数:
 //   node: 指向要计算空间的 Entry 节点的指针。
 func (c *Cache) allocate(node *Entry) {
-    c.nBytes += int64(node.value.Len()) + int64(len(node.key))
+    c.nBytes += c.size(node.key, node.value)
+}
+
+// size 计算一个键值对的开销。
+//
+// 如果设置了 Cost，则使用它的结果；否则为键和值的长度之和。
+func (c *Cache) size(key string, value Value) int64 {
+    if c.Cost != nil {
+        return c.Cost(key, value)
+    }
+    return int64(value.Len()) + int64(len(key))
 }
 
 // deallocate 减少缓存已用字节数。
@@ -67,12 +93,13 @@ func (c *Cache) allocate(node *Entry) {
 // 参数:
 //   node: 指向要计算空间的 Entry 节点的指针。
 func (c *Cache) deallocate(node *Entry) {
-    c.nBytes -= int64(node.value.Len()) + int64(len(node.key))
+    c.nBytes -= c.size(node.key, node.value)
 }
 
 // Get 方法根据键从缓存中查找对应的值。
 //
 // 如果键存在于缓存中，此方法会将对应的条目移动到双向链表的头部（表示最近使用），并返回其值。
+// 已过期的条目会在此时被删除并按未命中处理，同时调用 OnExpired。
 //
 // 参数:
 //   key: 要查找的键。
@@ -81,15 +108,116 @@ func (c *Cache) deallocate(node *Entry) {
 //   Value: 查找到的值。如果未找到，则为 nil。
 //   bool: 如果找到了键，则为 true；否则为 false。
 func (c *Cache) Get(key string) (Value, bool) {
-    if p, ok := c.cache[key]; ok {
+    if p, ok := c.cache[key]; ok && !c.expireIfNeeded(p) {
         c.ll.MoveToFront(p)
         kv := p.Value.(*Entry)
+        kv.used = now()
+        c.hits++
+        c.events().OnHit(key)
         return kv.value, true
 
     }
+    c.misses++
+    c.events().OnMiss(key)
+    return nil, false
+}
+
+// Peek 方法根据键查找对应的值，但不改变条目的最近使用顺序。
+//
+// Peek 不修改缓存的任何状态：不计入命中统计、不触发 Events，
+// 已过期的条目按未命中处理但不会被删除。因此在外部使用读写锁时，
+// 可以在只持有读锁的情况下并发调用 Peek。
+//
+// 参数:
+//   key: 要查找的键。
+//
+// 返回值:
+//   Value: 查找到的值。如果未找到，则为 nil。
+//   bool: 如果找到了未过期的键，则为 true；否则为 false。
+func (c *Cache) Peek(key string) (Value, bool) {
+    if p, ok := c.cache[key]; ok {
+        kv := p.Value.(*Entry)
+        if !kv.expiredAt(now()) {
+            return kv.value, true
+        }
+    }
     return nil, false
 }
 
+// Promote 方法补记一次对 key 的命中。
+//
+// 它与 Get 命中时的处理相同：将条目移动到链表头部、计入命中次数并触发
+// Events.OnHit，用于在 Peek 之后延迟完成 LRU 提升。键不存在时不做任何处理。
+//
+// 参数:
+//   key: 被命中的键。
+//
+// 返回值:
+//   bool: 如果键存在，则为 true；否则为 false。
+func (c *Cache) Promote(key string) bool {
+    p, ok := c.cache[key]
+    if !ok {
+        return false
+    }
+    c.ll.MoveToFront(p)
+    p.Value.(*Entry).used = now()
+    c.hits++
+    c.events().OnHit(key)
+    return true
+}
+
+// Touch 方法刷新一个条目的最近使用时间，但不读取它的值。
+//
+// 如果键存在，对应的条目会被移动到双向链表的头部；如果条目设置了 TTL，
+// 它的过期时间会被重置为当前时间加上原来的 TTL。Touch 不会触发
+// Events 的 OnHit/OnMiss，因此不会影响命中率统计。
+//
+// 参数:
+//   key: 要刷新的键。
+//
+// 返回值:
+//   bool: 如果键存在，则为 true；否则为 false。
+func (c *Cache) Touch(key string) bool {
+    if p, ok := c.cache[key]; ok && !c.expireIfNeeded(p) {
+        c.ll.MoveToFront(p)
+        kv := p.Value.(*Entry)
+        kv.used = now()
+        if kv.ttl > 0 {
+            kv.expire = now().Add(kv.ttl)
+        }
+        return true
+    }
+    return false
+}
+
+// Remove 方法从缓存中删除指定的键。
+//
+// 如果键存在，会将其从链表和哈希表中删除并更新已用字节数。
+// 如果设置了 OnRemoved 回调函数则调用它，否则调用 OnEvicted。主动删除不计入淘汰次数。
+//
+// 参数:
+//   key: 要删除的键。
+//
+// 返回值:
+//   bool: 如果键存在并被删除，则为 true；否则为 false。
+func (c *Cache) Remove(key string) bool {
+    p, ok := c.cache[key]
+    if !ok {
+        return false
+    }
+    kv := p.Value.(*Entry)
+    c.ll.Remove(p)
+    c.deallocate(kv)
+    delete(c.cache, kv.key)
+
+    if c.OnRemoved != nil {
+        c.OnRemoved(kv.key, kv.value)
+    } else if c.OnEvicted != nil {
+        c.OnEvicted(kv.key, kv.value)
+    }
+    return true
+}
+
 // RemoveOldest 淘汰并移除缓存中最久未使用的条目。
 //
 // 此方法会找到双向链表的尾部元素（即最久未使用的条目），将其从链表和哈希表中删除，
@@ -98,16 +226,88 @@ func (c *Cache) RemoveOldest() {
 
     oldest := c.ll.Back()
     if oldest != nil {
-        kv := oldest.Value.(*Entry)
-        c.ll.Remove(oldest)
+        c.evict(oldest)
+    }
+}
+
+// evict 因容量限制淘汰链表中的一个元素。
+//
+// 它会将元素从链表和哈希表中删除、更新已用字节数和淘汰次数，
+// 并依次调用 Events.OnEvict 与 OnEvicted。
+//
+// 参数:
+//   e: 要淘汰的链表元素。
+func (c *Cache) evict(e *list.Element) {
+    kv := e.Value.(*Entry)
+    c.ll.Remove(e)
+    c.deallocate(kv)
+    delete(c.cache, kv.key)
+
+    c.evictions++
+    c.events().OnEvict(kv.key, kv.value)
+    if c.OnEvicted != nil {
+        c.OnEvicted(kv.key, kv.value)
+    }
+}
+
+// AddCold 方法以“冷”方式添加或更新一个键值对。
+//
+// 新条目会被放到双向链表的尾部，在被真正读取之前，它是最先被淘汰的条目，
+// 因此预热或推测性写入的数据不会挤占真正的热点数据。
+// 如果键已存在，则更新其值，但不改变它在链表中的位置。
+// 为了避免新条目刚插入就被自身淘汰，AddCold 会先淘汰其他旧条目腾出空间。
+//
+// 参数:
+//   key: 要添加或更新的键。
+//   value: 与键关联的值，该值必须实现 Value 接口。
+//
+// 返回值:
+//   error: 条目过大时返回 ErrEntryTooLarge，否则为 nil。
+func (c *Cache) AddCold(key string, value Value) error {
+    size := c.size(key, value)
+    if c.maxBytes != 0 && size > c.maxBytes {
+        return ErrEntryTooLarge
+    }
+    if p, ok := c.cache[key]; ok {
+        kv := p.Value.(*Entry)
+        c.makeRoom(size-c.size(kv.key, kv.value), p)
         c.deallocate(kv)
-        delete(c.cache, kv.key)
+        kv.value = value
+        c.allocate(kv)
+    } else {
+        c.makeRoom(size, nil)
+        ele := &Entry{
+            key:   key,
+            value: value,
+            used:  now(),
+        }
+        if back := c.ll.Back(); back != nil {
+            // 沿用队尾条目的时间，链表仍按 used 从新到旧排列
+            ele.used = back.Value.(*Entry).used
+        }
+        c.cache[key] = c.ll.PushBack(ele)
+        c.allocate(ele)
+    }
+    c.events().OnAdd(key, value)
+    return nil
+}
 
-        if c.OnEvicted != nil {
-            c.OnEvicted(kv.key, kv.value)
+// makeRoom 从链表尾部开始淘汰条目，直到再增加 need 字节也不会超过容量。
+//
+// 参数:
+//   need: 即将增加的字节数。
+//   keep: 不允许被淘汰的元素，可以为 nil。
+func (c *Cache) makeRoom(need int64, keep *list.Element) {
+    for c.maxBytes != 0 && c.nBytes+need > c.maxBytes {
+        e := c.ll.Back()
+        if e == keep {
+            e = e.Prev()
+        }
+        if e == nil {
+            return
         }
+        c.evict(e)
     }
-    fmt.Println(c.ll.Len())
 }
 
 // Add 方法向缓存中添加或更新一个键值对。
@@ -116,15 +316,50 @@ func (c *Cache) RemoveOldest() {
 // 如果键不存在，则创建一个新条目并将其添加到链表头部。
 // 添加或更新后，会检查当前已用字节数是否超过最大限制，如果超过，
 // 则会循环调用 RemoveOldest 来淘汰旧条目，直到满足容量要求。
+// 大小超过最大容量的条目会被直接拒绝，此时缓存保持不变。
+// 如果调用方需要知道条目是否被拒绝，请使用 AddE。
 //
 // 参数:
 //   key: 要添加或更新的键。
 //   value: 与键关联的值，该值必须实现 Value 接口。
 func (c *Cache) Add(key string, value Value) {
+    _ = c.AddE(key, value)
+}
+
+// AddE 方法与 Add 相同，但在条目被拒绝时返回错误。
+//
+// 如果键和值的大小之和超过 maxBytes，AddE 不会修改缓存
+// （包括已存在的同名条目），并返回 ErrEntryTooLarge。
+//
+// 参数:
+//   key: 要添加或更新的键。
+//   value: 与键关联的值，该值必须实现 Value 接口。
+//
+// 返回值:
+//   error: 条目过大时返回 ErrEntryTooLarge，否则为 nil。
+func (c *Cache) AddE(key string, value Value) error {
+    return c.add(key, value, 0)
+}
+
+// add 是 AddE 与 AddWithTTL 的共同实现。
+//
+// 参数:
+//   key: 要添加或更新的键。
+//   value: 与键关联的值。
+//   ttl: 条目的存活时间，小于等于 0 表示永不过期。
+//
+// 返回值:
+//   error: 条目过大时返回 ErrEntryTooLarge，否则为 nil。
+func (c *Cache) add(key string, value Value, ttl time.Duration) error {
+    if c.maxBytes != 0 && c.size(key, value) > c.maxBytes {
+        return ErrEntryTooLarge
+    }
     if p, ok := c.cache[key]; ok {
         kv := p.Value.(*Entry)
         c.deallocate(kv)
         kv.value = value
+        kv.setTTL(ttl)
+        kv.used = now()
         c.allocate(kv)
         c.ll.MoveToFront(p)
 
@@ -132,16 +367,20 @@ func (c *Cache) Add(key string, value Value) {
         ele := &Entry{
             key:   key,
             value: value,
+            used:  now(),
         }
+        ele.setTTL(ttl)
         listEle := c.ll.PushFront(ele)
         c.allocate(ele)
         c.cache[ele.key] = listEle
 
     }
+    c.events().OnAdd(key, value)
 
     for c.maxBytes != 0 && c.nBytes > c.maxBytes {
         c.RemoveOldest()
     }
+    return nil
 }
 
 // Len 方法返回缓存中当前的条目数量。
@@ -152,4 +391,29 @@ func (c *Cache) Add(key string, value Value) {
 //   int: 缓存中的条目总数。
 func (c *Cache) Len() int {
     return c.ll.Len()
-}
\ No newline at end of file
+}
+
+// Clear 删除缓存中的全部条目，不调用任何回调，统计信息保持不变。
+func (c *Cache) Clear() {
+    c.ll.Init()
+    c.cache = make(map[string]*list.Element)
+    c.nBytes = 0
+}
+
+// Bytes 方法返回缓存当前已用的字节数。
+//
+// 已用字节数为所有条目的键长度与值长度之和。
+//
+// 返回值:
+//   int64: 当前已用的字节数。
+func (c *Cache) Bytes() int64 {
+    return c.nBytes
+}
+
+// MaxBytes 方法返回缓存允许使用的最大字节数。
+//
+// 返回值:
+//   int64: 最大字节数，0 表示不限制容量。
+func (c *Cache) MaxBytes() int64 {
+    return c.maxBytes
+}
@@ -1,8 +1,18 @@
 package lru
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
 	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 type String string
@@ -54,6 +64,27 @@ func TestOnEvicted(t *testing.T) {
 	}
 }
 
+func TestOnRemoved(t *testing.T) {
+	var evicted, removed []string
+	lru := New(int64(0), func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2"))
+	lru.Remove("k1")
+	if !reflect.DeepEqual(evicted, []string{"k1"}) {
+		t.Fatalf("expect Remove to fall back to OnEvicted, got %v", evicted)
+	}
+
+	lru.OnRemoved = func(key string, value Value) {
+		removed = append(removed, key)
+	}
+	lru.Remove("k2")
+	if !reflect.DeepEqual(removed, []string{"k2"}) || len(evicted) != 1 {
+		t.Fatalf("expect Remove to call only OnRemoved, got removed %v evicted %v", removed, evicted)
+	}
+}
+
 func TestAdd(t *testing.T) {
 	lru := New(int64(0), nil)
 	lru.Add("key", String("1"))
@@ -63,3 +94,716 @@ func TestAdd(t *testing.T) {
 		t.Fatal("expected 6 but got", lru.nBytes)
 	}
 }
+
+func TestSaveLoad(t *testing.T) {
+	src := New(int64(0), nil)
+	src.Add("k1", Bytes("v1"))
+	src.Add("k2", Bytes("v2"))
+	src.Add("k3", Bytes("v3"))
+	src.Get("k1")
+
+	var buf bytes.Buffer
+	if err := src.Save(&buf); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	cap := len("k1v1k3v3")
+	dst := New(int64(cap), nil)
+	if err := dst.Load(&buf); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	// k2 是最久未使用的条目，恢复时应最先被淘汰
+	if _, ok := dst.Get("k2"); ok || dst.Len() != 2 {
+		t.Fatalf("expect k2 evicted after load, got len %d", dst.Len())
+	}
+	if v, ok := dst.Get("k1"); !ok || string(v.(Bytes)) != "v1" {
+		t.Fatalf("expect k1=v1 after load")
+	}
+}
+
+func TestSaveNotSerializable(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("key1", String("1234"))
+	if err := lru.Save(io.Discard); !errors.Is(err, ErrNotSerializable) {
+		t.Fatalf("expect ErrNotSerializable, got %v", err)
+	}
+}
+
+type recordEvents struct {
+	log []string
+}
+
+func (r *recordEvents) OnAdd(key string, value Value)   { r.log = append(r.log, "add:"+key) }
+func (r *recordEvents) OnHit(key string)                { r.log = append(r.log, "hit:"+key) }
+func (r *recordEvents) OnMiss(key string)               { r.log = append(r.log, "miss:"+key) }
+func (r *recordEvents) OnEvict(key string, value Value) { r.log = append(r.log, "evict:"+key) }
+
+func TestEvents(t *testing.T) {
+	ev := &recordEvents{}
+	lru := New(int64(10), nil)
+	lru.Events = ev
+	lru.Add("key1", String("123456"))
+	lru.Get("key1")
+	lru.Get("key2")
+	lru.Add("k2", String("k2"))
+
+	expect := []string{"add:key1", "hit:key1", "miss:key2", "add:k2", "evict:key1"}
+	if !reflect.DeepEqual(expect, ev.log) {
+		t.Fatalf("expect events %v, got %v", expect, ev.log)
+	}
+}
+
+// sumBytes 独立地遍历所有条目计算已用字节数，用于校验 nBytes 的记账。
+func sumBytes(c *Cache) int64 {
+	var n int64
+	for e := c.ll.Front(); e != nil; e = e.Next() {
+		kv := e.Value.(*Entry)
+		n += int64(len(kv.key) + kv.value.Len())
+	}
+	return n
+}
+
+func TestBytesAccounting(t *testing.T) {
+	lru := New(int64(20), nil)
+	check := func(step string) {
+		t.Helper()
+		if got, want := lru.Bytes(), sumBytes(lru); got != want {
+			t.Fatalf("%s: Bytes() = %d, but entries sum to %d", step, got, want)
+		}
+		if lru.Bytes() > lru.MaxBytes() {
+			t.Fatalf("%s: Bytes() = %d exceeds MaxBytes() = %d", step, lru.Bytes(), lru.MaxBytes())
+		}
+	}
+
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2"))
+	check("add")
+
+	lru.Add("k1", String("value1"))
+	check("update in place")
+
+	lru.Add("k2", String(""))
+	check("zero-length value")
+
+	// 将 k2 更新为恰好占满容量的值，k1 会被淘汰
+	lru.Add("k2", String("123456789012345678"))
+	check("update then evict others")
+	if _, ok := lru.Get("k1"); ok || lru.Len() != 1 {
+		t.Fatalf("expect k1 to be evicted by the grown k2")
+	}
+
+	// 将 k2 更新为超过容量的值会被拒绝，原值保持不变
+	lru.Add("k2", String("a value much larger than the budget"))
+	check("oversized update")
+	if v, ok := lru.Get("k2"); !ok || string(v.(String)) != "123456789012345678" {
+		t.Fatalf("expect oversized update of k2 to be refused")
+	}
+
+	if lru.MaxBytes() != 20 {
+		t.Fatalf("expect MaxBytes 20, got %d", lru.MaxBytes())
+	}
+}
+
+func TestTouch(t *testing.T) {
+	ev := &recordEvents{}
+	k1, k2, k3 := "key1", "key2", "k3"
+	v1, v2, v3 := "value1", "value2", "v3"
+	cap := len(k1 + k2 + v1 + v2)
+	lru := New(int64(cap), nil)
+	lru.Add(k1, String(v1))
+	lru.Add(k2, String(v2))
+	lru.Events = ev
+
+	if !lru.Touch(k1) || lru.Touch("missing") {
+		t.Fatalf("Touch reported wrong presence")
+	}
+	lru.Add(k3, String(v3))
+
+	if _, ok := lru.cache[k1]; !ok {
+		t.Fatalf("expect touched key1 to survive eviction")
+	}
+	if _, ok := lru.cache[k2]; ok {
+		t.Fatalf("expect key2 to be evicted")
+	}
+	expect := []string{"add:k3", "evict:key2"}
+	if !reflect.DeepEqual(expect, ev.log) {
+		t.Fatalf("Touch should not fire hit/miss events, got %v", ev.log)
+	}
+}
+
+func TestAddTooLarge(t *testing.T) {
+	lru := New(int64(10), nil)
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2"))
+
+	if err := lru.AddE("big", String("0123456789")); !errors.Is(err, ErrEntryTooLarge) {
+		t.Fatalf("expect ErrEntryTooLarge, got %v", err)
+	}
+	if lru.Len() != 2 || lru.Bytes() != 8 {
+		t.Fatalf("expect cache untouched, got len %d bytes %d", lru.Len(), lru.Bytes())
+	}
+	if _, ok := lru.Get("big"); ok {
+		t.Fatalf("oversized entry should not be cached")
+	}
+}
+
+func TestShardedByteLimit(t *testing.T) {
+	const maxBytes = 1000
+	s := NewSharded(8, maxBytes, nil)
+	if s.MaxBytes() != maxBytes {
+		t.Fatalf("expect shard budgets to sum to %d, got %d", maxBytes, s.MaxBytes())
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := "key" + strconv.Itoa(g*1000+i)
+				s.Add(key, String("value"))
+				s.Get(key)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if s.Bytes() > maxBytes {
+		t.Fatalf("sharded cache uses %d bytes, over limit %d", s.Bytes(), maxBytes)
+	}
+	st := s.Stats()
+	if st.Entries != s.Len() || st.Bytes != s.Bytes() || st.Evictions == 0 {
+		t.Fatalf("unexpected aggregate stats %+v", st)
+	}
+	if st.Hits+st.Misses != 8*500 {
+		t.Fatalf("expect %d lookups in stats, got %d", 8*500, st.Hits+st.Misses)
+	}
+}
+
+func TestShardedSmallBudget(t *testing.T) {
+	// 容量小于分片数时，每个分片仍然有不为 0 的额度，缓存不会变成不限制容量
+	s := NewSharded(16, 5, nil)
+	if s.MaxBytes() != 5 {
+		t.Fatalf("expect shard budgets to sum to 5, got %d", s.MaxBytes())
+	}
+	for i := 0; i < 100; i++ {
+		s.Add("k"+strconv.Itoa(i), String("v"))
+	}
+	if s.Bytes() > 5 {
+		t.Fatalf("sharded cache uses %d bytes, over limit 5", s.Bytes())
+	}
+}
+
+func TestShardedRemove(t *testing.T) {
+	s := NewSharded(4, 0, nil)
+	s.Add("k1", String("v1"))
+	if !s.Remove("k1") || s.Remove("k1") || s.Len() != 0 || s.Bytes() != 0 {
+		t.Fatalf("Remove failed, len %d bytes %d", s.Len(), s.Bytes())
+	}
+}
+
+func TestShardedPeek(t *testing.T) {
+	s := NewSharded(4, 0, nil)
+	if _, ok := s.Peek("k1"); ok {
+		t.Fatalf("expect Peek on an empty shard to miss")
+	}
+	s.Add("k1", String("v1"))
+	if v, ok := s.Peek("k1"); !ok || string(v.(String)) != "v1" {
+		t.Fatalf("expect Peek to find k1")
+	}
+	if st := s.Stats(); st.Hits != 0 || st.Misses != 0 {
+		t.Fatalf("Peek should not count lookups, got %+v", st)
+	}
+}
+
+func TestShardedDo(t *testing.T) {
+	s := NewSharded(4, 0, nil)
+	s.Add("k1", String("1"))
+	incr := func(c *Cache) error {
+		v, _ := c.Peek("k1")
+		return c.AddE("k1", v.(String)+"1")
+	}
+	if err := s.Do("k1", incr); err != nil {
+		t.Fatalf("do: %v", err)
+	}
+	if v, _ := s.Peek("k1"); string(v.(String)) != "11" {
+		t.Fatalf("expect Do to update k1 in place, got %v", v)
+	}
+}
+
+func benchmarkParallel(b *testing.B, get func(key string), add func(key string)) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		add(keys[i])
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			get(keys[i&1023])
+			i++
+		}
+	})
+}
+
+func BenchmarkSingleMutexGet(b *testing.B) {
+	var mu sync.Mutex
+	c := New(0, nil)
+	benchmarkParallel(b, func(key string) {
+		mu.Lock()
+		c.Get(key)
+		mu.Unlock()
+	}, func(key string) {
+		c.Add(key, String("value"))
+	})
+}
+
+func BenchmarkShardedGet(b *testing.B) {
+	s := NewSharded(32, 0, nil)
+	benchmarkParallel(b, func(key string) {
+		s.Get(key)
+	}, func(key string) {
+		s.Add(key, String("value"))
+	})
+}
+
+func TestAddCold(t *testing.T) {
+	k1, k2, k3 := "key1", "key2", "k3"
+	v1, v2, v3 := "value1", "value2", "v3"
+	cap := len(k1 + k2 + v1 + v2)
+	lru := New(int64(cap), nil)
+	lru.Add(k1, String(v1))
+	lru.Add(k2, String(v2))
+
+	// 冷插入会先淘汰最久未使用的 key1，自身排在队尾
+	if err := lru.AddCold(k3, String(v3)); err != nil {
+		t.Fatalf("AddCold failed: %v", err)
+	}
+	if _, ok := lru.cache[k1]; ok || lru.Len() != 2 || lru.Bytes() != sumBytes(lru) {
+		t.Fatalf("expect key1 evicted to make room for cold k3")
+	}
+	if lru.ll.Back().Value.(*Entry).key != k3 {
+		t.Fatalf("expect cold k3 at the back of the list")
+	}
+
+	// 更新已存在的冷条目不会提升它的位置
+	lru.AddCold(k3, String("v4"))
+	if lru.ll.Back().Value.(*Entry).key != k3 || lru.Bytes() != sumBytes(lru) {
+		t.Fatalf("expect cold update of k3 to keep its position")
+	}
+
+	lru.RemoveOldest()
+	if _, ok := lru.Get(k3); ok {
+		t.Fatalf("expect unread cold k3 to be evicted first")
+	}
+
+	if err := lru.AddCold("big", String("a value much larger than the budget")); !errors.Is(err, ErrEntryTooLarge) {
+		t.Fatalf("expect ErrEntryTooLarge, got %v", err)
+	}
+}
+
+func TestCost(t *testing.T) {
+	lru := New(int64(2), nil)
+	lru.Cost = func(key string, value Value) int64 { return 1 }
+	lru.Add("k1", String("a long value"))
+	lru.Add("k2", String("another long value"))
+	lru.Add("k3", String("v3"))
+
+	if lru.Len() != 2 || lru.Bytes() != 2 {
+		t.Fatalf("expect cost=1 to cap entries at 2, got len %d bytes %d", lru.Len(), lru.Bytes())
+	}
+	if _, ok := lru.Get("k1"); ok {
+		t.Fatalf("expect k1 evicted")
+	}
+
+	weight := New(int64(0), nil)
+	weight.Cost = func(key string, value Value) int64 { return int64(value.Len()) * 10 }
+	weight.Add("k1", String("1"))
+	weight.Add("k1", String("123"))
+	if weight.Bytes() != 30 {
+		t.Fatalf("expect update to re-evaluate cost, got %d", weight.Bytes())
+	}
+}
+
+// fakeClock 替换包内的 now，返回一个可以手动推进时间的函数。
+func fakeClock(t *testing.T) func(d time.Duration) {
+	cur := time.Unix(1700000000, 0)
+	now = func() time.Time { return cur }
+	t.Cleanup(func() { now = time.Now })
+	return func(d time.Duration) { cur = cur.Add(d) }
+}
+
+func TestExpireOnGet(t *testing.T) {
+	advance := fakeClock(t)
+	var expired, evicted []string
+	lru := New(int64(0), func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	lru.OnExpired = func(key string, value Value) {
+		expired = append(expired, key)
+	}
+	lru.AddWithTTL("k1", String("v1"), time.Second)
+	lru.Add("k2", String("v2"))
+
+	advance(500 * time.Millisecond)
+	if _, ok := lru.Get("k1"); !ok {
+		t.Fatalf("expect k1 alive before its TTL")
+	}
+	advance(time.Second)
+	if _, ok := lru.Get("k1"); ok {
+		t.Fatalf("expect k1 expired after its TTL")
+	}
+	if _, ok := lru.Get("k2"); !ok {
+		t.Fatalf("expect k2 without TTL to never expire")
+	}
+	if !reflect.DeepEqual(expired, []string{"k1"}) || len(evicted) != 0 {
+		t.Fatalf("expect only OnExpired for k1, got expired %v evicted %v", expired, evicted)
+	}
+	if st := lru.Stats(); st.Expired != 1 || st.Evictions != 0 || lru.Bytes() != sumBytes(lru) {
+		t.Fatalf("unexpected stats after expiry %+v", st)
+	}
+}
+
+func TestRemoveExpired(t *testing.T) {
+	advance := fakeClock(t)
+	var expired []string
+	lru := New(int64(0), nil)
+	lru.OnExpired = func(key string, value Value) {
+		expired = append(expired, key)
+	}
+	lru.AddWithTTL("k1", String("v1"), time.Second)
+	lru.AddWithTTL("k2", String("v2"), time.Minute)
+	lru.AddWithTTL("k3", String("v3"), time.Second)
+
+	advance(2 * time.Second)
+	if n := lru.RemoveExpired(); n != 2 || lru.Len() != 1 {
+		t.Fatalf("expect 2 expired entries removed, got %d (len %d)", n, lru.Len())
+	}
+	if !reflect.DeepEqual(expired, []string{"k1", "k3"}) {
+		t.Fatalf("unexpected OnExpired keys %v", expired)
+	}
+}
+
+func TestTouchDelaysExpiration(t *testing.T) {
+	advance := fakeClock(t)
+	ev := &recordEvents{}
+	lru := New(int64(0), nil)
+	lru.AddWithTTL("k1", String("v1"), time.Second)
+	lru.Events = ev
+
+	advance(800 * time.Millisecond)
+	lru.Touch("k1")
+	advance(800 * time.Millisecond)
+	if _, ok := lru.cache["k1"]; !ok || lru.RemoveExpired() != 0 {
+		t.Fatalf("expect Touch to reset the TTL of k1")
+	}
+	if len(ev.log) != 0 {
+		t.Fatalf("Touch should not fire hit/miss events, got %v", ev.log)
+	}
+	advance(time.Second)
+	if lru.Touch("k1") {
+		t.Fatalf("expect expired k1 not to be touched")
+	}
+}
+
+func TestSnapshotExpiry(t *testing.T) {
+	advance := fakeClock(t)
+	src := New(int64(0), nil)
+	src.AddWithTTL("k1", Bytes("v1"), time.Second)
+	src.AddWithTTL("k2", Bytes("v2"), time.Minute)
+	src.Add("k3", Bytes("v3"))
+
+	var buf bytes.Buffer
+	if err := src.Save(&buf); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	advance(2 * time.Second)
+
+	dst := New(int64(0), nil)
+	if err := dst.Load(&buf); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if _, ok := dst.cache["k1"]; ok || dst.Len() != 2 {
+		t.Fatalf("expect expired k1 to be skipped on load")
+	}
+	advance(time.Minute)
+	if _, ok := dst.Get("k2"); ok {
+		t.Fatalf("expect restored k2 to keep its expiry")
+	}
+}
+
+func TestSnapshotHostileLength(t *testing.T) {
+	// 声明了巨大长度的键不能让 Load 按声明的长度分配内存或 panic
+	for _, n := range []uint64{1 << 62, math.MaxUint64} {
+		b := append([]byte(snapshotMagic), binary.AppendUvarint(nil, n)...)
+		b = append(b, "short"...)
+		if err := New(int64(0), nil).Load(bytes.NewReader(b)); err == nil {
+			t.Fatalf("length %d: expect an error from a truncated snapshot", n)
+		}
+	}
+
+	// 超过预先分配上限的值仍然能完整地还原
+	big := strings.Repeat("x", snapshotPrealloc*3+1)
+	src := New(int64(0), nil)
+	src.Add("big", Bytes(big))
+	var buf bytes.Buffer
+	if err := src.Save(&buf); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	dst := New(int64(0), nil)
+	if err := dst.Load(&buf); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if v, ok := dst.Get("big"); !ok || string(v.(Bytes)) != big {
+		t.Fatalf("expect the large value to be restored")
+	}
+}
+
+func TestApprox(t *testing.T) {
+	k1, k2, k3 := "key1", "key2", "k3"
+	v1, v2, v3 := "value1", "value2", "v3"
+	cap := len(k1 + k2 + v1 + v2)
+	c := NewApprox(int64(cap), nil)
+	// 采样数不小于条目数时，近似 LRU 与精确 LRU 的淘汰结果相同
+	c.Samples = 10
+	c.Add(k1, String(v1))
+	c.Add(k2, String(v2))
+	c.Get(k1)
+	c.Add(k3, String(v3))
+
+	if _, ok := c.Get(k2); ok || c.Len() != 2 {
+		t.Fatalf("expect key2 evicted, len %d", c.Len())
+	}
+	if _, ok := c.Get(k1); !ok {
+		t.Fatalf("expect recently read key1 kept")
+	}
+	if !c.Remove(k1) || c.Bytes() != int64(len(k3+v3)) {
+		t.Fatalf("Remove failed, bytes %d", c.Bytes())
+	}
+	if err := c.AddE("big", String("a value much larger than the budget")); !errors.Is(err, ErrEntryTooLarge) {
+		t.Fatalf("expect ErrEntryTooLarge, got %v", err)
+	}
+}
+
+func TestApproxByteLimit(t *testing.T) {
+	c := NewApprox(int64(1000), nil)
+	for i := 0; i < 1000; i++ {
+		c.Add("key"+strconv.Itoa(i), String("value"))
+		if c.Bytes() > c.MaxBytes() {
+			t.Fatalf("approx cache uses %d bytes, over limit %d", c.Bytes(), c.MaxBytes())
+		}
+	}
+	if st := c.Stats(); st.Evictions == 0 || st.Entries != c.Len() {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestApproxColdAndTTL(t *testing.T) {
+	advance := fakeClock(t)
+	c := NewApprox(int64(len("k1v1k2v2")), nil)
+	c.Samples = 10
+	c.Add("k1", String("v1"))
+	c.AddCold("k2", String("v2"))
+	c.Add("k3", String("v3"))
+	if _, ok := c.cache["k2"]; ok {
+		t.Fatalf("expect unread cold k2 evicted first")
+	}
+
+	c.AddWithTTL("k4", String("v4"), time.Second)
+	advance(2 * time.Second)
+	if _, ok := c.Get("k4"); ok {
+		t.Fatalf("expect k4 expired")
+	}
+
+	var buf bytes.Buffer
+	src := NewApprox(0, nil)
+	src.Add("a", Bytes("1"))
+	src.Add("b", Bytes("2"))
+	if err := src.Save(&buf); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	dst := New(int64(len("b2")), nil)
+	if err := dst.Load(&buf); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if _, ok := dst.Get("b"); !ok {
+		t.Fatalf("expect most recently used b kept after load")
+	}
+}
+
+func benchmarkGet(b *testing.B, add func(key string), get func(key string)) {
+	keys := make([]string, 1<<16)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		add(keys[i])
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		get(keys[i&(1<<16-1)])
+	}
+}
+
+func BenchmarkExactGet(b *testing.B) {
+	c := New(0, nil)
+	benchmarkGet(b, func(key string) { c.Add(key, String("value")) }, func(key string) { c.Get(key) })
+}
+
+func BenchmarkApproxGet(b *testing.B) {
+	c := NewApprox(0, nil)
+	benchmarkGet(b, func(key string) { c.Add(key, String("value")) }, func(key string) { c.Get(key) })
+}
+
+// benchmarkMemory 报告每个条目占用的堆内存。
+func benchmarkMemory(b *testing.B, fill func(n int) any) {
+	const n = 100000
+	var ms runtime.MemStats
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		runtime.ReadMemStats(&ms)
+		before := ms.HeapAlloc
+		c := fill(n)
+		runtime.GC()
+		runtime.ReadMemStats(&ms)
+		b.ReportMetric(float64(ms.HeapAlloc-before)/n, "B/entry")
+		runtime.KeepAlive(c)
+	}
+}
+
+func BenchmarkExactMemory(b *testing.B) {
+	benchmarkMemory(b, func(n int) any {
+		c := New(0, nil)
+		for i := 0; i < n; i++ {
+			c.Add("key"+strconv.Itoa(i), String("value"))
+		}
+		return c
+	})
+}
+
+func BenchmarkApproxMemory(b *testing.B) {
+	benchmarkMemory(b, func(n int) any {
+		c := NewApprox(0, nil)
+		for i := 0; i < n; i++ {
+			c.Add("key"+strconv.Itoa(i), String("value"))
+		}
+		return c
+	})
+}
+
+func TestShardedLazyInit(t *testing.T) {
+	s := NewSharded(4, 400, nil)
+	if _, ok := s.Get("k1"); ok || s.Touch("k1") || s.Remove("k1") {
+		t.Fatalf("expect empty sharded cache to miss")
+	}
+	for _, sh := range s.shards {
+		if sh.cache != nil {
+			t.Fatalf("expect shard caches to be created on first write")
+		}
+	}
+	s.Add("k1", String("v1"))
+	created := 0
+	for _, sh := range s.shards {
+		if sh.cache != nil {
+			created++
+		}
+	}
+	if created != 1 || s.Stats().MaxBytes != 400 {
+		t.Fatalf("expect exactly one shard created, got %d", created)
+	}
+}
+
+func TestPeekPromote(t *testing.T) {
+	ev := &recordEvents{}
+	lru := New(int64(0), nil)
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2"))
+	lru.Events = ev
+
+	if v, ok := lru.Peek("k1"); !ok || string(v.(String)) != "v1" {
+		t.Fatalf("expect Peek to find k1")
+	}
+	if lru.ll.Back().Value.(*Entry).key != "k1" || len(ev.log) != 0 {
+		t.Fatalf("Peek should not change recency or fire events")
+	}
+	if !lru.Promote("k1") || lru.Promote("missing") {
+		t.Fatalf("Promote reported wrong presence")
+	}
+	if lru.ll.Front().Value.(*Entry).key != "k1" || lru.Stats().Hits != 1 {
+		t.Fatalf("expect Promote to move k1 to front and count a hit")
+	}
+}
+
+func TestClear(t *testing.T) {
+	c := New(int64(0), func(key string, value Value) {
+		t.Fatalf("expect Clear not to call OnEvicted")
+	})
+	c.Add("k1", String("v1"))
+	c.Add("k2", String("v2"))
+	c.Clear()
+	if c.Len() != 0 || c.Bytes() != 0 {
+		t.Fatalf("expect empty cache after Clear, len %d bytes %d", c.Len(), c.Bytes())
+	}
+	if _, ok := c.Get("k1"); ok {
+		t.Fatalf("expect k1 gone after Clear")
+	}
+	c.Add("k3", String("v3"))
+	if c.Len() != 1 {
+		t.Fatalf("expect cache usable after Clear")
+	}
+
+	s := NewSharded(4, 0, nil)
+	s.Add("k1", String("v1"))
+	s.Clear()
+	if s.Len() != 0 || s.Bytes() != 0 {
+		t.Fatalf("expect empty sharded cache after Clear")
+	}
+
+	a := NewApprox(0, nil)
+	a.Add("k1", String("v1"))
+	a.Clear()
+	if a.Len() != 0 || a.Bytes() != 0 {
+		t.Fatalf("expect empty approx cache after Clear")
+	}
+}
+
+func TestStatsOldestAge(t *testing.T) {
+	advance := fakeClock(t)
+	c := New(int64(0), nil)
+	if age := c.Stats().OldestAge; age != 0 {
+		t.Fatalf("expect 0 for an empty cache, got %v", age)
+	}
+	c.Add("k1", String("1"))
+	advance(time.Second)
+	c.Add("k2", String("2"))
+	advance(time.Second)
+	if age := c.Stats().OldestAge; age != 2*time.Second {
+		t.Fatalf("expect k1 idle for 2s, got %v", age)
+	}
+	// 冷条目沿用队尾的时间，不会让报告的时长变短
+	c.AddCold("k3", String("3"))
+	if age := c.Stats().OldestAge; age != 2*time.Second {
+		t.Fatalf("expect the cold entry to inherit 2s, got %v", age)
+	}
+	c.Get("k1")
+	c.Get("k3")
+	if age := c.Stats().OldestAge; age != time.Second {
+		t.Fatalf("expect k2 idle for 1s, got %v", age)
+	}
+
+	a := NewApprox(0, nil)
+	a.Add("k1", String("1"))
+	advance(time.Second)
+	a.Add("k2", String("2"))
+	if age := a.Stats().OldestAge; age != time.Second {
+		t.Fatalf("expect approx to find k1 idle for 1s, got %v", age)
+	}
+
+	s := NewSharded(4, 0, nil)
+	for i := 0; i < 8; i++ {
+		s.Add(strconv.Itoa(i), String("v"))
+		advance(time.Second)
+	}
+	if age := s.Stats().OldestAge; age != 8*time.Second {
+		t.Fatalf("expect the oldest shard to report 8s, got %v", age)
+	}
+}
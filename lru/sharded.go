@@ -0,0 +1,343 @@
+package lru
+
+import (
+	"bufio"
+	"io"
+	"sync"
+	"time"
+)
+
+// ShardedCache 是一个并发安全的分片 LRU 缓存。
+// 它按 key 的哈希值把键空间划分到多个 Cache 分片中，每个分片拥有独立的锁
+// 和 maxBytes 的一份额度，从而减少并发访问时的锁竞争。
+// 注意 LRU 顺序只在分片内部维护，淘汰也只发生在分片内部。
+// 每个分片的 Cache 在第一次写入时才会创建。
+type ShardedCache struct {
+	shards    []*shard
+	mask      uint32
+	onEvicted func(key string, value Value)
+	onExpired func(key string, value Value)
+	onRemoved func(key string, value Value)
+	decode    func(data []byte) Value
+	events    Events
+	cost      func(key string, value Value) int64
+}
+
+// shard 是 ShardedCache 中的一个分片，用互斥锁保护内部的 Cache。
+type shard struct {
+	mu       sync.Mutex
+	cache    *Cache // 为 nil 表示分片尚未写入过数据
+	maxBytes int64
+	misses   int64 // 分片的 Cache 创建之前发生的未命中次数
+}
+
+// NewSharded 创建并返回一个新的 ShardedCache 实例。
+//
+// 分片数会被向上取整为 2 的幂，maxBytes 会被平均分配给各个分片，
+// 因此单个条目的大小不能超过 maxBytes/n。maxBytes 小于分片数时分片数减少到不超过 maxBytes 的 2 的幂。
+//
+// 参数:
+//
+//	n: 分片数量，小于 1 时按 1 处理。
+//	maxBytes: 所有分片合计的最大容量（字节），0 表示不限制容量。
+//	OnEvicted: 当一个条目被淘汰时调用的回调函数，会被多个分片并发调用。可以为 nil。
+//
+// 返回值:
+//
+//	*ShardedCache: 一个指向新创建的 ShardedCache 实例的指针。
+func NewSharded(n int, maxBytes int64, OnEvicted func(key string, value Value)) *ShardedCache {
+	size := 1
+	for size < n && (maxBytes == 0 || int64(size)*2 <= maxBytes) {
+		// 每个分片至少分到 1 字节，额度为 0 的分片会变成不限制容量的 Cache
+		size <<= 1
+	}
+
+	s := &ShardedCache{
+		shards:    make([]*shard, size),
+		mask:      uint32(size - 1),
+		onEvicted: OnEvicted,
+	}
+	per := maxBytes / int64(size)
+	for i := range s.shards {
+		budget := per
+		// 余数分给前面的分片，保证各分片额度之和等于 maxBytes
+		if int64(i) < maxBytes%int64(size) {
+			budget++
+		}
+		s.shards[i] = &shard{maxBytes: budget}
+	}
+	return s
+}
+
+// shardFor 使用 FNV-1a 哈希为 key 选择分片。
+func (s *ShardedCache) shardFor(key string) *shard {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return s.shards[h&s.mask]
+}
+
+// writable 返回分片的 Cache，必要时按 ShardedCache 的配置创建它。
+// 调用方需要持有 sh.mu。
+func (s *ShardedCache) writable(sh *shard) *Cache {
+	if sh.cache == nil {
+		c := New(sh.maxBytes, s.onEvicted)
+		c.OnExpired = s.onExpired
+		c.OnRemoved = s.onRemoved
+		c.Decode = s.decode
+		c.Events = s.events
+		c.Cost = s.cost
+		sh.cache = c
+	}
+	return sh.cache
+}
+
+// each 依次在持有分片锁的情况下对每个已创建的分片执行 fn。
+func (s *ShardedCache) each(fn func(c *Cache)) {
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		if sh.cache != nil {
+			fn(sh.cache)
+		}
+		sh.mu.Unlock()
+	}
+}
+
+// SetEvents 为所有分片安装事件钩子，ev 需要是并发安全的。
+func (s *ShardedCache) SetEvents(ev Events) {
+	s.events = ev
+	s.each(func(c *Cache) { c.Events = ev })
+}
+
+// SetDecode 为所有分片设置 Load 恢复条目时使用的 Decode 函数。
+func (s *ShardedCache) SetDecode(decode func(data []byte) Value) {
+	s.decode = decode
+	s.each(func(c *Cache) { c.Decode = decode })
+}
+
+// SetOnExpired 为所有分片设置条目过期时的回调函数，它会被多个分片并发调用。
+func (s *ShardedCache) SetOnExpired(onExpired func(key string, value Value)) {
+	s.onExpired = onExpired
+	s.each(func(c *Cache) { c.OnExpired = onExpired })
+}
+
+// SetOnRemoved 为所有分片设置条目被 Remove 主动删除时的回调函数，它会被多个分片并发调用。
+func (s *ShardedCache) SetOnRemoved(onRemoved func(key string, value Value)) {
+	s.onRemoved = onRemoved
+	s.each(func(c *Cache) { c.OnRemoved = onRemoved })
+}
+
+// SetCost 为所有分片设置条目开销的计算函数，必须在添加条目之前调用。
+func (s *ShardedCache) SetCost(cost func(key string, value Value) int64) {
+	s.cost = cost
+	s.each(func(c *Cache) { c.Cost = cost })
+}
+
+// Get 根据键从所在分片中查找对应的值，语义与 Cache.Get 相同。
+func (s *ShardedCache) Get(key string) (Value, bool) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if sh.cache == nil {
+		sh.misses++
+		if s.events != nil {
+			s.events.OnMiss(key)
+		}
+		return nil, false
+	}
+	return sh.cache.Get(key)
+}
+
+// Peek 根据键从所在分片中查找对应的值，但不修改缓存的任何状态，语义与 Cache.Peek 相同。
+func (s *ShardedCache) Peek(key string) (Value, bool) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if sh.cache == nil {
+		return nil, false
+	}
+	return sh.cache.Peek(key)
+}
+
+// Add 向所在分片中添加或更新一个键值对，语义与 Cache.Add 相同。
+func (s *ShardedCache) Add(key string, value Value) {
+	_ = s.AddE(key, value)
+}
+
+// AddE 与 Add 相同，但在条目超过分片容量时返回 ErrEntryTooLarge。
+func (s *ShardedCache) AddE(key string, value Value) error {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return s.writable(sh).AddE(key, value)
+}
+
+// AddCold 以“冷”方式向所在分片添加或更新一个键值对，语义与 Cache.AddCold 相同。
+func (s *ShardedCache) AddCold(key string, value Value) error {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return s.writable(sh).AddCold(key, value)
+}
+
+// AddWithTTL 向所在分片中添加一个会在 ttl 之后过期的键值对，语义与 Cache.AddWithTTL 相同。
+func (s *ShardedCache) AddWithTTL(key string, value Value, ttl time.Duration) error {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return s.writable(sh).AddWithTTL(key, value, ttl)
+}
+
+// Do 在持有 key 所在分片的锁时对分片的 Cache 调用 fn，用于需要先读取再写入的原子操作。
+//
+// fn 只能操作传入的 Cache，不能再调用 s 的方法，否则会死锁。
+//
+// 参数:
+//
+//	key: 决定分片的键。
+//	fn: 对分片的 Cache 执行的操作。
+//
+// 返回值:
+//
+//	error: fn 返回的错误。
+func (s *ShardedCache) Do(key string, fn func(c *Cache) error) error {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return fn(s.writable(sh))
+}
+
+// RemoveExpired 依次清理每个分片中已过期的条目，并返回删除的总数。
+func (s *ShardedCache) RemoveExpired() int {
+	n := 0
+	s.each(func(c *Cache) { n += c.RemoveExpired() })
+	return n
+}
+
+// Touch 刷新所在分片中条目的最近使用时间，语义与 Cache.Touch 相同。
+func (s *ShardedCache) Touch(key string) bool {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if sh.cache == nil {
+		return false
+	}
+	return sh.cache.Touch(key)
+}
+
+// Remove 从所在分片中删除指定的键，语义与 Cache.Remove 相同。
+func (s *ShardedCache) Remove(key string) bool {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if sh.cache == nil {
+		return false
+	}
+	return sh.cache.Remove(key)
+}
+
+// RemoveOldest 从已用字节数最多的分片中淘汰最久未使用的条目。
+//
+// 返回值:
+//
+//	bool: 如果有条目被淘汰，则为 true；所有分片都为空时为 false。
+func (s *ShardedCache) RemoveOldest() bool {
+	var victim *shard
+	var most int64
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		if sh.cache != nil && sh.cache.Len() > 0 && (victim == nil || sh.cache.Bytes() > most) {
+			victim, most = sh, sh.cache.Bytes()
+		}
+		sh.mu.Unlock()
+	}
+	if victim == nil {
+		return false
+	}
+	victim.mu.Lock()
+	defer victim.mu.Unlock()
+	if victim.cache.Len() == 0 {
+		return false
+	}
+	victim.cache.RemoveOldest()
+	return true
+}
+
+// Clear 删除所有分片中的全部条目，语义与 Cache.Clear 相同。
+func (s *ShardedCache) Clear() {
+	s.each(func(c *Cache) { c.Clear() })
+}
+
+// Len 返回所有分片的条目总数。
+func (s *ShardedCache) Len() int {
+	n := 0
+	s.each(func(c *Cache) { n += c.Len() })
+	return n
+}
+
+// Bytes 返回所有分片已用字节数之和。
+func (s *ShardedCache) Bytes() int64 {
+	var n int64
+	s.each(func(c *Cache) { n += c.Bytes() })
+	return n
+}
+
+// MaxBytes 返回所有分片的容量之和。
+func (s *ShardedCache) MaxBytes() int64 {
+	var n int64
+	for _, sh := range s.shards {
+		n += sh.maxBytes
+	}
+	return n
+}
+
+// Stats 返回所有分片汇总后的统计信息。
+func (s *ShardedCache) Stats() Stats {
+	var st Stats
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		if sh.cache != nil {
+			st.add(sh.cache.Stats())
+		}
+		st.Misses += sh.misses
+		sh.mu.Unlock()
+	}
+	st.MaxBytes = s.MaxBytes()
+	return st
+}
+
+// Save 将所有分片的条目写入同一份快照。
+//
+// 快照格式与 Cache.Save 相同，可以被 Cache.Load 读取。
+// 保存期间每次只锁定一个分片，因此不是整个缓存的原子快照。
+func (s *ShardedCache) Save(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(snapshotMagic); err != nil {
+		return err
+	}
+	var err error
+	s.each(func(c *Cache) {
+		if err == nil {
+			err = c.writeEntries(bw)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Load 读取 Save 或 Cache.Save 写出的快照，并将条目按 key 分配到各个分片。
+func (s *ShardedCache) Load(r io.Reader) error {
+	decode := func(data []byte) Value {
+		if s.decode != nil {
+			return s.decode(data)
+		}
+		return Bytes(data)
+	}
+	return readSnapshot(r, decode, func(key string, value Value, ttl time.Duration) {
+		_ = s.AddWithTTL(key, value, ttl)
+	})
+}
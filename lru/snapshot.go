@@ -0,0 +1,201 @@
+package lru
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// snapshotMagic 是快照文件的魔数，用于在 Load 时识别格式和版本。
+const snapshotMagic = "GEELRU01"
+
+// ErrNotSerializable 表示缓存中存在无法转换为字节的值，导致快照无法保存。
+var ErrNotSerializable = errors.New("lru: value does not implement ByteSlicer")
+
+// ByteSlicer 是可以被写入快照的值需要实现的接口。
+// geecache.ByteView 天然满足此接口。
+type ByteSlicer interface {
+	ByteSlice() []byte
+}
+
+// Bytes 是 Load 在未设置 Decode 时使用的默认值类型。
+type Bytes []byte
+
+// Len 实现了 Value 接口。
+func (b Bytes) Len() int {
+	return len(b)
+}
+
+// ByteSlice 实现了 ByteSlicer 接口，返回数据的拷贝。
+func (b Bytes) ByteSlice() []byte {
+	return append([]byte(nil), b...)
+}
+
+// Save 将缓存中的全部条目写入 w。
+//
+// 快照格式为：魔数，随后按从最久未使用到最近使用的顺序写出每个条目，
+// 每个条目依次为 uvarint 长度前缀的 key、uvarint 长度前缀的 value
+// 以及 varint 编码的过期时间（Unix 纳秒，0 表示永不过期）。
+// 按此顺序写出可以保证 Load 依次 Add 之后恢复出相同的 LRU 顺序。
+//
+// 参数:
+//
+//	w: 快照写入的目标。
+//
+// 返回值:
+//
+//	error: 值未实现 ByteSlicer 或写入失败时返回错误。
+func (c *Cache) Save(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(snapshotMagic); err != nil {
+		return err
+	}
+	if err := c.writeEntries(bw); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// writeEntries 按从最久未使用到最近使用的顺序将所有条目写入 bw。
+func (c *Cache) writeEntries(bw *bufio.Writer) error {
+	buf := make([]byte, binary.MaxVarintLen64)
+	writeBytes := func(b []byte) error {
+		n := binary.PutUvarint(buf, uint64(len(b)))
+		if _, err := bw.Write(buf[:n]); err != nil {
+			return err
+		}
+		_, err := bw.Write(b)
+		return err
+	}
+
+	for e := c.ll.Back(); e != nil; e = e.Prev() {
+		kv := e.Value.(*Entry)
+		bs, ok := kv.value.(ByteSlicer)
+		if !ok {
+			return fmt.Errorf("%w: key %q", ErrNotSerializable, kv.key)
+		}
+		if err := writeBytes([]byte(kv.key)); err != nil {
+			return err
+		}
+		if err := writeBytes(bs.ByteSlice()); err != nil {
+			return err
+		}
+		var expire int64
+		if !kv.expire.IsZero() {
+			expire = kv.expire.UnixNano()
+		}
+		n := binary.PutVarint(buf, expire)
+		if _, err := bw.Write(buf[:n]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load 从 r 中读取 Save 写出的快照，并把条目依次加入缓存。
+//
+// 已存在于缓存中的同名 key 会被快照中的值覆盖。值通过 c.Decode 构造，
+// 如果 Decode 为 nil，则使用 Bytes 类型。若快照总量超过 maxBytes，
+// 较旧的条目会按正常的 LRU 规则被淘汰。快照中已经过期的条目会被跳过，
+// 其余带过期时间的条目以剩余的存活时间作为新的 TTL。
+//
+// 参数:
+//
+//	r: 快照数据的来源。
+//
+// 返回值:
+//
+//	error: 格式不正确或读取失败时返回错误。
+func (c *Cache) Load(r io.Reader) error {
+	return readSnapshot(r, c.decode, c.restore)
+}
+
+// restore 将快照中的一个条目加入缓存，过大的条目会被忽略。
+func (c *Cache) restore(key string, value Value, ttl time.Duration) {
+	_ = c.add(key, value, ttl)
+}
+
+// decode 使用 c.Decode 构造值，未设置时返回 Bytes。
+func (c *Cache) decode(data []byte) Value {
+	if c.Decode != nil {
+		return c.Decode(data)
+	}
+	return Bytes(data)
+}
+
+// snapshotPrealloc 是读取快照时按声明的长度直接分配的最大字节数，更长的键和值边读边扩大。
+const snapshotPrealloc = 64 << 10
+
+// readSnapshot 解析快照，并对每个未过期的条目依次调用 add。
+// 传给 add 的 ttl 为条目剩余的存活时间，0 表示永不过期。
+func readSnapshot(r io.Reader, decode func(data []byte) Value, add func(key string, value Value, ttl time.Duration)) error {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return fmt.Errorf("lru: reading snapshot header: %w", err)
+	}
+	if string(magic) != snapshotMagic {
+		return errors.New("lru: bad snapshot header")
+	}
+
+	readBytes := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		// 已经读到长度之后的 EOF 说明快照被截断了
+		if n <= snapshotPrealloc {
+			b := make([]byte, n)
+			if _, err := io.ReadFull(br, b); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			return b, nil
+		}
+		// 长度来自快照本身，损坏或伪造的快照可能声明任意大的长度，
+		// 按实际读到的字节扩大缓冲区，而不是按声明的长度一次分配
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, br, int64(min(n, math.MaxInt64))); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		return buf.Bytes(), nil
+	}
+
+	for {
+		key, err := readBytes()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("lru: reading snapshot key: %w", err)
+		}
+		data, err := readBytes()
+		if err != nil {
+			return fmt.Errorf("lru: reading snapshot value: %w", unexpectedEOF(err))
+		}
+		expire, err := binary.ReadVarint(br)
+		if err != nil {
+			return fmt.Errorf("lru: reading snapshot expiry: %w", unexpectedEOF(err))
+		}
+
+		var ttl time.Duration
+		if expire != 0 {
+			if ttl = time.Unix(0, expire).Sub(now()); ttl <= 0 {
+				continue
+			}
+		}
+		add(string(key), decode(data), ttl)
+	}
+}
+
+// unexpectedEOF 将条目中途遇到的 io.EOF 转换为 io.ErrUnexpectedEOF。
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,52 @@
+package lru
+
+import "time"
+
+// Stats 描述了缓存在某一时刻的使用情况。
+type Stats struct {
+	Entries   int   // 当前的条目数量
+	Bytes     int64 // 当前已用的字节数
+	MaxBytes  int64 // 最大字节数，0 表示不限制容量
+	Hits      int64 // Get 命中的次数
+	Misses    int64 // Get 未命中的次数
+	Evictions int64 // 因容量限制被淘汰的条目数
+	Expired   int64 // 因过期被删除的条目数
+	// OldestAge 是最久未使用的条目自最近一次写入或访问以来的时长，没有条目时为 0。
+	// 以“冷”方式写入的条目沿用写入时队尾条目的时间。
+	OldestAge time.Duration
+}
+
+// add 将另一份统计累加到 s 上，用于汇总多个分片的统计。
+func (s *Stats) add(o Stats) {
+	s.Entries += o.Entries
+	s.Bytes += o.Bytes
+	s.MaxBytes += o.MaxBytes
+	s.Hits += o.Hits
+	s.Misses += o.Misses
+	s.Evictions += o.Evictions
+	s.Expired += o.Expired
+	s.OldestAge = max(s.OldestAge, o.OldestAge)
+}
+
+// Stats 返回缓存当前的统计信息。
+func (c *Cache) Stats() Stats {
+	return Stats{
+		Entries:   c.Len(),
+		Bytes:     c.nBytes,
+		MaxBytes:  c.maxBytes,
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Expired:   c.expired,
+		OldestAge: c.oldestAge(),
+	}
+}
+
+// oldestAge 返回链表尾部条目的闲置时长。
+func (c *Cache) oldestAge() time.Duration {
+	back := c.ll.Back()
+	if back == nil {
+		return 0
+	}
+	return now().Sub(back.Value.(*Entry).used)
+}
@@ -0,0 +1,82 @@
+package lru
+
+import (
+	"container/list"
+	"time"
+)
+
+// now 返回当前时间，测试中可以替换它来控制时钟。
+var now = time.Now
+
+// setTTL 根据 ttl 设置条目的过期时间，ttl 小于等于 0 表示永不过期。
+func (e *Entry) setTTL(ttl time.Duration) {
+	if ttl > 0 {
+		e.ttl = ttl
+		e.expire = now().Add(ttl)
+		return
+	}
+	e.ttl = 0
+	e.expire = time.Time{}
+}
+
+// expiredAt 判断条目在 t 时刻是否已经过期。
+func (e *Entry) expiredAt(t time.Time) bool {
+	return !e.expire.IsZero() && !t.Before(e.expire)
+}
+
+// AddWithTTL 向缓存中添加或更新一个会在 ttl 之后过期的键值对。
+//
+// 除了过期时间之外，其语义与 AddE 相同。过期的条目会在被 Get 访问时
+// 或调用 RemoveExpired 时删除，并调用 OnExpired 而不是 OnEvicted。
+//
+// 参数:
+//
+//	key: 要添加或更新的键。
+//	value: 与键关联的值。
+//	ttl: 条目的存活时间，小于等于 0 表示永不过期。
+//
+// 返回值:
+//
+//	error: 条目过大时返回 ErrEntryTooLarge，否则为 nil。
+func (c *Cache) AddWithTTL(key string, value Value, ttl time.Duration) error {
+	return c.add(key, value, ttl)
+}
+
+// RemoveExpired 删除缓存中所有已过期的条目，并返回删除的数量。
+//
+// 它会遍历全部条目，适合由后台清理任务（janitor）周期性调用。
+func (c *Cache) RemoveExpired() int {
+	t := now()
+	n := 0
+	for e := c.ll.Back(); e != nil; {
+		prev := e.Prev()
+		if e.Value.(*Entry).expiredAt(t) {
+			c.expire(e)
+			n++
+		}
+		e = prev
+	}
+	return n
+}
+
+// expireIfNeeded 在条目已过期时将其删除，并返回它是否已过期。
+func (c *Cache) expireIfNeeded(e *list.Element) bool {
+	if !e.Value.(*Entry).expiredAt(now()) {
+		return false
+	}
+	c.expire(e)
+	return true
+}
+
+// expire 删除一个已过期的条目并调用 OnExpired。
+func (c *Cache) expire(e *list.Element) {
+	kv := e.Value.(*Entry)
+	c.ll.Remove(e)
+	c.deallocate(kv)
+	delete(c.cache, kv.key)
+
+	c.expired++
+	if c.OnExpired != nil {
+		c.OnExpired(kv.key, kv.value)
+	}
+}
@@ -1,11 +1,11 @@
 package main
 
 /*
-$ curl "http://localhost:9999/api?key=Tom"
+$ curl "http://localhost:9999/api/cache/scores/Tom"
 630
 
-$ curl "http://localhost:9999/api?key=kkk"
-kkk not exist
+$ curl "http://localhost:9999/api/cache/scores/kkk"
+{"error":"kkk not exist: geecache: key not found"}
 */
 
 import (
@@ -24,40 +24,40 @@ var db = map[string]string{
 }
 
 func createGroup() *geecache.Group {
-	return geecache.NewGroup("scores", 2<<10, geecache.GetterFunc(
+	gee, err := geecache.NewGroupStrict("scores", 2<<10, geecache.GetterFunc(
 		func(key string) ([]byte, error) {
 			log.Println("[SlowDB] search key", key)
 			if v, ok := db[key]; ok {
 				return []byte(v), nil
 			}
-			return nil, fmt.Errorf("%s not exist", key)
+			return nil, fmt.Errorf("%s not exist: %w", key, geecache.ErrNotFound)
 		}))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return gee
 }
 
 func startCacheServer(addr string, addrs []string, gee *geecache.Group) {
 	peers := geecache.NewHTTPPool(addr)
-	peers.Set(addrs...)
+	if err := peers.Set(addrs...); err != nil {
+		log.Fatal(err)
+	}
 	gee.RegisterPeers(peers)
+	mux := http.NewServeMux()
+	peers.RegisterOn(mux)
 	log.Println("geecache is running at", addr)
-	log.Fatal(http.ListenAndServe(addr[7:], peers))
+	log.Fatal(http.ListenAndServe(addr[7:], mux))
 }
 
-func startAPIServer(apiAddr string, gee *geecache.Group) {
-	http.Handle("/api", http.HandlerFunc(
-		func(w http.ResponseWriter, r *http.Request) {
-			key := r.URL.Query().Get("key")
-			view, err := gee.Get(key)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			w.Header().Set("Content-Type", "application/octet-stream")
-			w.Write(view.ByteSlice())
-
-		}))
+func startAPIServer(apiAddr string) {
+	api := geecache.NewAPIServer(nil,
+		geecache.WithAPIGroups("scores"),
+		geecache.WithAPIContentType("scores", "text/plain; charset=utf-8"))
+	mux := http.NewServeMux()
+	api.RegisterOn(mux)
 	log.Println("fontend server is running at", apiAddr)
-	log.Fatal(http.ListenAndServe(apiAddr[7:], nil))
-
+	log.Fatal(http.ListenAndServe(apiAddr[7:], mux))
 }
 
 func main() {
@@ -81,7 +81,7 @@ func main() {
 
 	gee := createGroup()
 	if api {
-		go startAPIServer(apiAddr, gee)
+		go startAPIServer(apiAddr)
 	}
 	startCacheServer(addrMap[port], addrs, gee)
 }
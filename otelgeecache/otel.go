@@ -0,0 +1,139 @@
+// Package otelgeecache 把 geecache 的 Tracer 接到 OpenTelemetry。
+//
+// 它是一个独立的模块，只有导入它的程序才会依赖 OpenTelemetry：
+//
+//	geecache.SetTracer(otelgeecache.New())
+//
+// 之后 Group.Get、调用 getter 以及节点之间的请求都会产生 span，
+// 追踪上下文通过 HTTP 请求头传递，拥有者节点上的 span 会接入调用方的追踪。
+package otelgeecache
+
+import (
+	"GeeCache/geecache"
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName 是创建 span 的 trace.Tracer 的名称。
+const instrumentationName = "GeeCache/otelgeecache"
+
+// span 的属性名。
+const (
+	GroupKey   = attribute.Key("geecache.group")
+	KeyHashKey = attribute.Key("geecache.key_hash")
+)
+
+// Option 是 New 的配置项。
+type Option func(*Tracer)
+
+// WithTracerProvider 设置创建 span 使用的 TracerProvider，默认使用 otel.GetTracerProvider()。
+//
+// 参数:
+//
+//	tp: 使用的 TracerProvider。
+//
+// 返回值:
+//
+//	Option: 可传递给 New 的配置项。
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(t *Tracer) {
+		t.provider = tp
+	}
+}
+
+// WithPropagator 设置在节点之间传递追踪上下文使用的 TextMapPropagator，默认使用 W3C Trace Context。
+//
+// 参数:
+//
+//	p: 使用的 TextMapPropagator。
+//
+// 返回值:
+//
+//	Option: 可传递给 New 的配置项。
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return func(t *Tracer) {
+		t.propagator = p
+	}
+}
+
+// Tracer 实现了 geecache.Tracer 接口，用 OpenTelemetry 创建 span。
+type Tracer struct {
+	provider   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+	tracer     trace.Tracer
+}
+
+// New 创建一个 Tracer。
+//
+// 参数:
+//
+//	opts: 可选的配置项。
+//
+// 返回值:
+//
+//	*Tracer: 一个指向新创建的 Tracer 实例的指针，可传递给 geecache.SetTracer 或 geecache.WithTracer。
+func New(opts ...Option) *Tracer {
+	t := &Tracer{}
+	for _, opt := range opts {
+		opt(t)
+	}
+	if t.provider == nil {
+		t.provider = otel.GetTracerProvider()
+	}
+	if t.propagator == nil {
+		t.propagator = propagation.TraceContext{}
+	}
+	t.tracer = t.provider.Tracer(instrumentationName)
+	return t
+}
+
+// Start 实现了 geecache.Tracer 接口。
+func (t *Tracer) Start(ctx context.Context, name string, kind geecache.SpanKind, group, keyHash string) (context.Context, geecache.Span) {
+	ctx, s := t.tracer.Start(ctx, name,
+		trace.WithSpanKind(spanKind(kind)),
+		trace.WithAttributes(GroupKey.String(group), KeyHashKey.String(keyHash)),
+	)
+	return ctx, span{s}
+}
+
+// Inject 实现了 geecache.Tracer 接口。
+func (t *Tracer) Inject(ctx context.Context, header http.Header) {
+	t.propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// Extract 实现了 geecache.Tracer 接口。
+func (t *Tracer) Extract(ctx context.Context, header http.Header) context.Context {
+	return t.propagator.Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// spanKind 把 geecache.SpanKind 转换为 OpenTelemetry 的 SpanKind。
+func spanKind(kind geecache.SpanKind) trace.SpanKind {
+	switch kind {
+	case geecache.SpanClient:
+		return trace.SpanKindClient
+	case geecache.SpanServer:
+		return trace.SpanKindServer
+	default:
+		return trace.SpanKindInternal
+	}
+}
+
+// span 包装 OpenTelemetry 的 span，实现了 geecache.Span 接口。
+type span struct {
+	trace.Span
+}
+
+// End 实现了 geecache.Span 接口，err 不为 nil 时记录错误并把 span 的状态设为 Error。
+func (s span) End(err error) {
+	if err != nil {
+		s.Span.RecordError(err)
+		s.Span.SetStatus(codes.Error, err.Error())
+	}
+	s.Span.End()
+}
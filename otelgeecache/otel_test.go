@@ -0,0 +1,91 @@
+package otelgeecache
+
+import (
+	"GeeCache/geecache"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSpansAcrossPeers(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer tp.Shutdown(t.Context())
+	tracer := New(WithTracerProvider(tp))
+
+	// 两个节点在同一个进程中：发往 otel-owner 节点的请求由 otel-local 改写为 otel-owner
+	geecache.NewGroup("otel-owner", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), geecache.WithTracer(tracer))
+	defer geecache.DestroyGroup("otel-owner")
+	local := geecache.NewGroup("otel-local", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s should come from the owner", key)
+		}), geecache.WithTracer(tracer))
+	defer geecache.DestroyGroup("otel-local")
+
+	owner := geecache.NewHTTPPool("owner")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = strings.Replace(r.URL.Path, "/otel-local/", "/otel-owner/", 1)
+		owner.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	pool := geecache.NewHTTPPool("local")
+	pool.Set(srv.URL)
+	local.RegisterPeers(pool)
+
+	if v, err := local.Get("Tom"); err != nil || v.String() != "Tom" {
+		t.Fatalf("get: %q %v", v, err)
+	}
+
+	spans := make(map[string]tracetest.SpanStub)
+	for _, s := range exporter.GetSpans() {
+		spans[s.Name] = s
+	}
+	get, peer, serve, load := spans[geecache.SpanGet], spans[geecache.SpanPeer], spans[geecache.SpanServe], spans[geecache.SpanLoad]
+
+	for _, c := range []struct {
+		span   tracetest.SpanStub
+		name   string
+		kind   trace.SpanKind
+		group  string
+		parent tracetest.SpanStub
+	}{
+		{peer, geecache.SpanPeer, trace.SpanKindClient, "otel-local", get},
+		{serve, geecache.SpanServe, trace.SpanKindServer, "otel-owner", peer},
+		{load, geecache.SpanLoad, trace.SpanKindInternal, "otel-owner", serve},
+	} {
+		if c.span.Name != c.name {
+			t.Fatalf("expect a %s span, got %v", c.name, exporter.GetSpans())
+		}
+		if c.span.SpanKind != c.kind {
+			t.Errorf("%s kind = %v, want %v", c.name, c.span.SpanKind, c.kind)
+		}
+		if c.span.SpanContext.TraceID() != get.SpanContext.TraceID() {
+			t.Errorf("%s is not in the caller's trace", c.name)
+		}
+		if c.span.Parent.SpanID() != c.parent.SpanContext.SpanID() {
+			t.Errorf("%s parent = %s, want %s", c.name, c.span.Parent.SpanID(), c.parent.Name)
+		}
+		var group attribute.Value
+		for _, kv := range c.span.Attributes {
+			if kv.Key == GroupKey {
+				group = kv.Value
+			}
+		}
+		if group.AsString() != c.group {
+			t.Errorf("%s group = %q, want %q", c.name, group.AsString(), c.group)
+		}
+	}
+	if get.Parent.IsValid() {
+		t.Errorf("expect %s to be the root span", geecache.SpanGet)
+	}
+}
@@ -8,8 +8,8 @@ go build -o server
 
 sleep 2
 echo ">>> start test"
-curl "http://localhost:9999/api?key=Tom" &
-curl "http://localhost:9999/api?key=Tom" &
-curl "http://localhost:9999/api?key=Tom" &
+curl "http://localhost:9999/api/cache/scores/Tom" &
+curl "http://localhost:9999/api/cache/scores/Tom" &
+curl "http://localhost:9999/api/cache/scores/Tom" &
 
 wait
\ No newline at end of file
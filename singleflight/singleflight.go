@@ -0,0 +1,257 @@
+// Package singleflight 提供对同一个 key 的重复调用的合并机制。
+package singleflight
+
+import (
+	"context"
+	"sync"
+)
+
+// call 表示一次正在进行或已经结束的调用。
+type call struct {
+	wg      sync.WaitGroup
+	val     any
+	err     error
+	dups    int                // 共享这次调用结果的其他调用者数量
+	chans   []chan<- Result    // 通过 DoChan 或 DoContext 等待结果的调用者
+	waiters int                // 仍在等待结果的调用者数量
+	cancel  context.CancelFunc // 由 DoContext 发起的调用在所有等待者放弃后被取消，否则为 nil
+}
+
+// Result 是 DoChan 通过 channel 返回的调用结果。
+type Result struct {
+	Val    any
+	Err    error
+	Shared bool // 结果是否被多个调用者共享
+}
+
+// Group 管理不同 key 的调用，保证同一时刻每个 key 只有一个调用在执行。
+// 零值即可使用。
+type Group struct {
+	mu sync.Mutex       // 保护 m
+	m  map[string]*call // 正在进行中的调用，调用结束或被 Forget 后即被删除
+}
+
+// Do 执行 fn 并返回它的结果。
+//
+// 如果同一个 key 已经有调用在执行，Do 会等待它结束并返回相同的结果和错误，
+// 而不会再次执行 fn。
+//
+// 参数:
+//
+//	key: 用于合并调用的键。
+//	fn: 实际执行的函数。
+//
+// 返回值:
+//
+//	any: fn 返回的值。
+//	error: fn 返回的错误。
+func (g *Group) Do(key string, fn func() (any, error)) (any, error) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		c.waiters++
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err
+	}
+	c := &call{waiters: 1}
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	g.doCall(c, key, fn)
+	return c.val, c.err
+}
+
+// DoChan 与 Do 相同，但不等待调用结束，而是返回一个接收结果的 channel。
+//
+// 调用者可以在等待 channel 时自行设置超时并放弃等待，
+// 共享的调用会继续执行，其他调用者仍然能够收到结果。
+// 返回的 channel 带有缓冲，放弃等待不会阻塞调用的执行。
+//
+// 参数:
+//
+//	key: 用于合并调用的键。
+//	fn: 实际执行的函数，会在新的 goroutine 中执行。
+//
+// 返回值:
+//
+//	<-chan Result: 调用结束时会收到唯一一个结果。
+func (g *Group) DoChan(key string, fn func() (any, error)) <-chan Result {
+	ch := make(chan Result, 1)
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		c.waiters++
+		c.chans = append(c.chans, ch)
+		g.mu.Unlock()
+		return ch
+	}
+	c := &call{chans: []chan<- Result{ch}, waiters: 1}
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	go g.doCall(c, key, fn)
+	return ch
+}
+
+// DoContext 与 Do 相同，但调用者会在 ctx 结束时放弃等待并返回 ctx.Err()。
+//
+// fn 收到的 context 保留了发起调用的 ctx 中的值和截止时间，但不会随它一起被取消，
+// 因此一个调用者放弃等待不会影响共享同一次调用的其他调用者；
+// 只有当所有等待者都放弃之后，或者发起调用的 ctx 的截止时间到了，fn 收到的 context 才会被取消。
+// 保留截止时间让 fn 中的重试等逻辑知道还剩多少时间，共享调用的其他调用者最多等到这个截止时间。
+//
+// 参数:
+//
+//	ctx: 调用者的上下文。
+//	key: 用于合并调用的键。
+//	fn: 实际执行的函数，会在新的 goroutine 中执行。
+//
+// 返回值:
+//
+//	any: fn 返回的值。
+//	error: fn 返回的错误，或调用者放弃等待时的 ctx.Err()。
+func (g *Group) DoContext(ctx context.Context, key string, fn func(ctx context.Context) (any, error)) (any, error) {
+	return g.Begin(ctx, key, fn).Wait()
+}
+
+// Pending 是 Begin 登记的一次等待，调用 Wait 获取结果。
+type Pending struct {
+	Leader bool // 是否由这次 Begin 发起了新的调用，为 false 时共享的是已有的调用
+
+	g   *Group
+	ctx context.Context
+	key string
+	c   *call
+	ch  chan Result
+}
+
+// Begin 与 DoContext 相同，但只登记调用而不等待它结束。
+//
+// 调用者可以先根据 Pending.Leader 知道 fn 是否会被执行，再通过 Wait 等待结果，
+// 适用于需要把多个 key 的调用合并成一次批量请求的场景。
+// 每个 Pending 都必须调用一次 Wait，否则 ctx 结束时不会减少等待者的数量。
+//
+// 参数:
+//
+//	ctx: 调用者的上下文，Wait 会在它结束时放弃等待。
+//	key: 用于合并调用的键。
+//	fn: 实际执行的函数，会在新的 goroutine 中执行。
+//
+// 返回值:
+//
+//	*Pending: 这次等待的句柄。
+func (g *Group) Begin(ctx context.Context, key string, fn func(ctx context.Context) (any, error)) *Pending {
+	p := &Pending{g: g, ctx: ctx, key: key, ch: make(chan Result, 1)}
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	c, ok := g.m[key]
+	if ok {
+		c.dups++
+	} else {
+		var fctx context.Context
+		var cancel context.CancelFunc
+		if deadline, ok := ctx.Deadline(); ok {
+			fctx, cancel = context.WithDeadline(context.WithoutCancel(ctx), deadline)
+		} else {
+			fctx, cancel = context.WithCancel(context.WithoutCancel(ctx))
+		}
+		c = &call{cancel: cancel}
+		c.wg.Add(1)
+		g.m[key] = c
+		p.Leader = true
+		go func() {
+			defer cancel()
+			g.doCall(c, key, func() (any, error) { return fn(fctx) })
+		}()
+	}
+	c.waiters++
+	c.chans = append(c.chans, p.ch)
+	g.mu.Unlock()
+	p.c = c
+	return p
+}
+
+// Wait 等待 Begin 登记的调用结束并返回它的结果，ctx 结束时返回 ctx.Err()。
+//
+// 返回值:
+//
+//	any: fn 返回的值。
+//	error: fn 返回的错误，或调用者放弃等待时的 ctx.Err()。
+func (p *Pending) Wait() (any, error) {
+	select {
+	case res := <-p.ch:
+		return res.Val, res.Err
+	case <-p.ctx.Done():
+		g, c := p.g, p.c
+		g.mu.Lock()
+		if c.waiters--; c.waiters == 0 && c.cancel != nil {
+			// 没有人再等待结果，取消调用，之后的调用者会发起新的调用
+			c.cancel()
+			if g.m[p.key] == c {
+				delete(g.m, p.key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, p.ctx.Err()
+	}
+}
+
+// doCall 执行 fn，并把结果交给所有等待者。
+func (g *Group) doCall(c *call, key string, fn func() (any, error)) {
+	c.val, c.err = fn()
+
+	g.mu.Lock()
+	c.wg.Done()
+	// 被 Forget 之后同一个 key 可能已经开始了新的调用，不能把它删除
+	if g.m[key] == c {
+		delete(g.m, key)
+	}
+	for _, ch := range c.chans {
+		ch <- Result{Val: c.val, Err: c.err, Shared: c.dups > 0}
+	}
+	g.mu.Unlock()
+}
+
+// InFlight 报告 key 上是否有正在进行的调用。
+//
+// 结果只反映调用时的状态：返回之后随时可能有新的调用开始，或者正在进行的调用结束。
+//
+// 参数:
+//
+//	key: 要检查的键。
+//
+// 返回值:
+//
+//	bool: 有正在进行并且没有被 Forget 的调用时为 true。
+func (g *Group) InFlight(key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, ok := g.m[key]
+	return ok
+}
+
+// Forget 让 Group 忘记 key 上正在进行的调用。
+//
+// 之后对该 key 的 Do 或 DoChan 会立即开始一次新的调用，而不会等待之前那次；
+// 已经在等待之前那次调用的调用者仍会收到它的结果。
+// 适用于数据源中的数据被修改之后，避免新的调用者拿到基于旧数据的结果。
+//
+// 参数:
+//
+//	key: 要忘记的键。
+func (g *Group) Forget(key string) {
+	g.mu.Lock()
+	delete(g.m, key)
+	g.mu.Unlock()
+}
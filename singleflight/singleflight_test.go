@@ -0,0 +1,262 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	var g Group
+	v, err := g.Do("key", func() (any, error) {
+		return "bar", nil
+	})
+	if v != "bar" || err != nil {
+		t.Fatalf("Do = %v, %v", v, err)
+	}
+}
+
+func TestDoErr(t *testing.T) {
+	var g Group
+	someErr := errors.New("some error")
+	v, err := g.Do("key", func() (any, error) {
+		return nil, someErr
+	})
+	if err != someErr || v != nil {
+		t.Fatalf("Do = %v, %v; want nil, %v", v, err, someErr)
+	}
+}
+
+func TestDoDupSuppress(t *testing.T) {
+	var g Group
+	var calls int32
+	release := make(chan struct{})
+	fn := func() (any, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "bar", nil
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := g.Do("key", fn); v != "bar" || err != nil {
+				t.Errorf("Do = %v, %v", v, err)
+			}
+		}()
+	}
+	// 等待其他 goroutine 进入 Do 并阻塞在第一次调用上
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("number of calls = %d; want 1", got)
+	}
+	if len(g.m) != 0 {
+		t.Fatalf("expect no calls left after completion, got %d", len(g.m))
+	}
+}
+
+func TestDoChanTimeout(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func() (any, error) {
+		<-release
+		return "bar", nil
+	}
+
+	impatient := g.DoChan("key", fn)
+	patient := g.DoChan("key", fn)
+	select {
+	case <-impatient:
+		t.Fatalf("expect no result before the call finishes")
+	case <-time.After(10 * time.Millisecond):
+		// 放弃等待，共享的调用继续执行
+	}
+
+	close(release)
+	res := <-patient
+	if res.Val != "bar" || res.Err != nil || !res.Shared {
+		t.Fatalf("DoChan = %+v; want shared bar", res)
+	}
+}
+
+func TestForget(t *testing.T) {
+	var g Group
+	var calls int32
+	release := make(chan struct{})
+	first := g.DoChan("key", func() (any, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "stale", nil
+	})
+
+	g.Forget("key")
+	v, err := g.Do("key", func() (any, error) {
+		atomic.AddInt32(&calls, 1)
+		return "fresh", nil
+	})
+	if v != "fresh" || err != nil {
+		t.Fatalf("Do after Forget = %v, %v; want fresh", v, err)
+	}
+
+	close(release)
+	if res := <-first; res.Val != "stale" {
+		t.Fatalf("expect the forgotten call to still deliver its result, got %+v", res)
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Fatalf("number of calls = %d; want 2", got)
+	}
+}
+
+func TestInFlight(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	done := g.DoChan("key", func() (any, error) {
+		<-release
+		return "bar", nil
+	})
+	if !g.InFlight("key") || g.InFlight("other") {
+		t.Fatal("expect only key to be in flight")
+	}
+	close(release)
+	<-done
+	if g.InFlight("key") {
+		t.Fatal("expect key not to be in flight after the call")
+	}
+
+	release = make(chan struct{})
+	defer close(release)
+	g.DoChan("key", func() (any, error) {
+		<-release
+		return "bar", nil
+	})
+	g.Forget("key")
+	if g.InFlight("key") {
+		t.Fatal("expect a forgotten call not to be in flight")
+	}
+}
+
+func TestDoContextAbandon(t *testing.T) {
+	var g Group
+	started := make(chan struct{})
+	fnCtx := make(chan context.Context, 1)
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (any, error) {
+		fnCtx <- ctx
+		close(started)
+		select {
+		case <-release:
+			return "bar", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, err := g.DoContext(ctx1, "key", fn)
+		errc <- err
+	}()
+	<-started
+	shared := make(chan any, 1)
+	go func() {
+		v, _ := g.DoContext(context.Background(), "key", fn)
+		shared <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	cancel1()
+	if err := <-errc; err != context.Canceled {
+		t.Fatalf("expect abandoned caller to get context.Canceled, got %v", err)
+	}
+	if err := (<-fnCtx).Err(); err != nil {
+		t.Fatalf("expect shared call to keep running while others wait, got %v", err)
+	}
+	close(release)
+	if v := <-shared; v != "bar" {
+		t.Fatalf("expect remaining caller to get bar, got %v", v)
+	}
+}
+
+func TestDoContextCancelLastWaiter(t *testing.T) {
+	var g Group
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	stopped := make(chan struct{})
+	_, err := g.DoContext(ctx, "key", func(ctx context.Context) (any, error) {
+		<-ctx.Done()
+		close(stopped)
+		return nil, ctx.Err()
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expect context.DeadlineExceeded, got %v", err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("expect call cancelled after its only waiter gave up")
+	}
+
+	v, err := g.DoContext(context.Background(), "key", func(ctx context.Context) (any, error) {
+		return "fresh", nil
+	})
+	if v != "fresh" || err != nil {
+		t.Fatalf("expect a new call after cancellation, got %v %v", v, err)
+	}
+}
+
+func TestDoContextDeadline(t *testing.T) {
+	var g Group
+	deadline := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	v, err := g.DoContext(ctx, "key", func(ctx context.Context) (any, error) {
+		d, _ := ctx.Deadline()
+		return d, nil
+	})
+	if err != nil || !v.(time.Time).Equal(deadline) {
+		t.Fatalf("expect fn to see the caller's deadline, got %v %v", v, err)
+	}
+
+	v, _ = g.DoContext(context.Background(), "key", func(ctx context.Context) (any, error) {
+		_, ok := ctx.Deadline()
+		return ok, nil
+	})
+	if v != false {
+		t.Fatal("expect no deadline without one on the caller's context")
+	}
+}
+
+func TestBeginLeader(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	var calls int32
+	fn := func(ctx context.Context) (any, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "bar", nil
+	}
+	first := g.Begin(context.Background(), "key", fn)
+	second := g.Begin(context.Background(), "key", fn)
+	if !first.Leader || second.Leader {
+		t.Fatalf("expect only the first Begin to lead, got %v %v", first.Leader, second.Leader)
+	}
+	close(release)
+	for _, p := range []*Pending{first, second} {
+		if v, err := p.Wait(); v != "bar" || err != nil {
+			t.Fatalf("Wait = %v, %v", v, err)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("expect fn called once, got %d", n)
+	}
+}